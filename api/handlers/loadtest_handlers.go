@@ -33,6 +33,9 @@ type LoadTestHandler struct {
 	grpcServer *grpcserver.GameServer
 	grpcConn   *grpc.Server
 
+	// gRPC服务器的Prometheus指标端点
+	grpcMetricsServer *http.Server
+
 	// 配置
 	testServerPorts map[string]int
 	portMutex       sync.Mutex
@@ -140,7 +143,7 @@ func (h *LoadTestHandler) StartTestServers() error {
 
 	log.Printf("Starting gRPC test server on port %d", grpcPort)
 	h.grpcServer = grpcserver.NewGameServer()
-	h.grpcConn = grpc.NewServer()
+	h.grpcConn = grpc.NewServer(h.grpcServer.ServerOptions()...)
 	gamev1.RegisterGameServiceServer(h.grpcConn, h.grpcServer)
 
 	go func() {
@@ -154,7 +157,20 @@ func (h *LoadTestHandler) StartTestServers() error {
 		}
 	}()
 
-	log.Printf("Test servers started - HTTP: %d, gRPC: %d", httpPort, grpcPort)
+	// gRPC指标通过独立HTTP端口暴露
+	metricsPort := h.findAvailablePort(h.allocatePort("grpc_metrics"), 10)
+	if metricsPort != 0 {
+		metricsMux := http.NewServeMux()
+		metricsMux.Handle("/metrics", h.grpcServer.MetricsHandler())
+		h.grpcMetricsServer = &http.Server{Addr: fmt.Sprintf(":%d", metricsPort), Handler: metricsMux}
+		go func() {
+			if err := h.grpcMetricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Printf("gRPC metrics server error: %v", err)
+			}
+		}()
+	}
+
+	log.Printf("Test servers started - HTTP: %d, gRPC: %d, gRPC metrics: %d", httpPort, grpcPort, metricsPort)
 	return nil
 }
 
@@ -824,6 +840,9 @@ func (h *LoadTestHandler) Stop() error {
 	if h.grpcConn != nil {
 		h.grpcConn.GracefulStop()
 	}
+	if h.grpcMetricsServer != nil {
+		h.grpcMetricsServer.Close()
+	}
 
 	return nil
 }
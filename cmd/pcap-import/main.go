@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"GoSlgBenchmarkTest/internal/session"
+)
+
+// 命令行参数
+var (
+	inputPath  = flag.String("in", "", "抓包文件（pcap或pcapng，如tcpdump -w的输出）")
+	outputDir  = flag.String("out", ".", "会话输出目录")
+	portsFlag  = flag.String("ports", "", "游戏服务端口，逗号分隔；为空时导入所有TCP连接")
+	idPrefix   = flag.String("id", "pcap", "会话ID前缀")
+	jsonOutput = flag.Bool("json", false, "输出JSON导出格式，默认输出分块会话文件")
+	decode     = flag.Bool("decode", false, "解码消息体，JSON输出中每帧带有消息类型和JSON内容")
+)
+
+func main() {
+	flag.Parse()
+
+	if *inputPath == "" {
+		log.Fatal("❌ 必须指定抓包文件 (--in)")
+	}
+
+	options := session.DefaultPcapImportOptions()
+	options.SessionID = *idPrefix
+	if *portsFlag != "" {
+		for _, text := range strings.Split(*portsFlag, ",") {
+			port, err := strconv.ParseUint(strings.TrimSpace(text), 10, 16)
+			if err != nil {
+				log.Fatalf("❌ 无效端口 %q", text)
+			}
+			options.ServerPorts = append(options.ServerPorts, uint16(port))
+		}
+	}
+
+	sessions, err := session.LoadPcap(*inputPath, options)
+	if err != nil {
+		log.Fatalf("❌ 导入抓包失败: %v", err)
+	}
+	if len(sessions) == 0 {
+		log.Fatal("❌ 抓包中没有可导入的TCP连接")
+	}
+	if err := os.MkdirAll(*outputDir, 0o755); err != nil {
+		log.Fatalf("❌ 创建输出目录失败: %v", err)
+	}
+
+	fmt.Printf("📦 从 %s 导入 %d 个会话\n", *inputPath, len(sessions))
+	for i, imported := range sessions {
+		if *decode {
+			session.DecodeSessionPayloads(imported, nil)
+		}
+		path, err := writeSession(i+1, imported)
+		if err != nil {
+			log.Fatalf("❌ 写出会话 %s 失败: %v", imported.ID, err)
+		}
+		fmt.Printf("   %-40s 帧=%-6d 事件=%-6d 错误=%-3d -> %s\n", imported.ID, len(imported.Frames),
+			len(imported.Events), imported.Stats.ErrorCount, path)
+	}
+}
+
+// writeSession 按输出格式写出一个会话
+func writeSession(index int, imported *session.Session) (string, error) {
+	name := fmt.Sprintf("%s_%d", *idPrefix, index)
+	if *jsonOutput {
+		path := filepath.Join(*outputDir, name+".json")
+		data, err := json.MarshalIndent(imported, "", "  ")
+		if err != nil {
+			return "", err
+		}
+		return path, os.WriteFile(path, data, 0o644)
+	}
+
+	path := filepath.Join(*outputDir, name+".session")
+	writer, err := session.CreateSessionFile(path, imported.ID, imported.StartTime, nil)
+	if err != nil {
+		return "", err
+	}
+	if err := writer.WriteSession(imported); err != nil {
+		writer.Close()
+		return "", err
+	}
+	return path, writer.Close()
+}
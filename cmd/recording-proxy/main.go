@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
@@ -15,6 +16,7 @@ import (
 
 	"github.com/gorilla/websocket"
 
+	"GoSlgBenchmarkTest/internal/database"
 	"GoSlgBenchmarkTest/internal/protocol"
 	"GoSlgBenchmarkTest/internal/session"
 )
@@ -25,6 +27,14 @@ var (
 	targetURL  = flag.String("target", "", "真实游戏服务器WebSocket地址")
 	sessionID  = flag.String("session", "", "录制会话ID")
 	verbose    = flag.Bool("verbose", false, "启用详细日志")
+	decode     = flag.Bool("decode", false, "录制时解码消息体，导出的每帧带有消息类型和JSON内容")
+
+	flightWindow = flag.Duration("flight-window", 0, "飞行记录器模式：只保留最近这段时间的记录，出错或异常关闭时写出快照（如 10m），0表示完整录制")
+	flightMaxMB  = flag.Int("flight-max-mb", 64, "飞行记录器缓冲区上限（MB）")
+	flightDir    = flag.String("flight-dir", "recordings/flight", "飞行记录器快照目录")
+
+	dbURL    = flag.String("db-url", "", "PostgreSQL连接串，设置后录制内容分批写入test_sessions/session_events/session_messages表")
+	dbTestID = flag.Int64("db-test-id", 0, "录制关联的tests记录ID，0表示自动创建一条session_recording测试")
 )
 
 // ProxyConnection 代理连接
@@ -42,6 +52,7 @@ type RecordingProxy struct {
 	targetURL  string
 	upgrader   websocket.Upgrader
 	recorder   *session.SessionRecorder
+	persister  *database.SessionPersister
 	verbose    bool
 }
 
@@ -78,11 +89,50 @@ func main() {
 		verbose:  *verbose,
 	}
 
+	if *decode {
+		proxy.recorder.SetPayloadDecoding(session.DefaultPayloadDecodeOptions())
+	}
+
+	if *flightWindow > 0 {
+		flightConfig := session.DefaultFlightRecorderConfig()
+		flightConfig.Window = *flightWindow
+		flightConfig.MaxBytes = int64(*flightMaxMB) << 20
+		flightConfig.SnapshotDir = *flightDir
+		flightConfig.OnSnapshot = func(snapshot session.FlightSnapshot) {
+			fmt.Printf("📸 快照已保存: %s (%s)\n", snapshot.Path, snapshot.Reason)
+		}
+		if err := proxy.recorder.EnableFlightRecorder(flightConfig); err != nil {
+			log.Fatalf("❌ 启用飞行记录器失败: %v", err)
+		}
+		fmt.Printf("✈️  飞行记录器: 保留最近 %v / %dMB, 快照目录 %s\n", *flightWindow, *flightMaxMB, *flightDir)
+	}
+
+	if *dbURL != "" {
+		if *flightWindow > 0 {
+			log.Fatal("❌ 飞行记录器不能与数据库持久化同时使用")
+		}
+		if err := database.ConnectPgxURL(*dbURL); err != nil {
+			log.Fatalf("❌ 数据库连接失败: %v", err)
+		}
+		persistOptions := database.DefaultSessionPersisterOptions()
+		persistOptions.TestID = *dbTestID
+		persistOptions.ClientType = "recording-proxy"
+		persistOptions.ClientInfo = map[string]interface{}{"listen": *listenAddr, "target": *targetURL}
+		persister, err := database.NewSessionPersister(context.Background(), database.GetQueries(), *sessionID, time.Now(), persistOptions)
+		if err != nil {
+			log.Fatalf("❌ 创建会话记录失败: %v", err)
+		}
+		proxy.recorder.StreamTo(persister, true)
+		proxy.persister = persister
+		fmt.Printf("🗄️  录制写入数据库: test_id=%d, test_session=%d\n", persister.Row().TestID, persister.Row().ID)
+	}
+
 	// 设置HTTP路由
 	http.HandleFunc("/ws", proxy.handleWebSocket)
 	http.HandleFunc("/status", proxy.handleStatus)
 	http.HandleFunc("/start-recording", proxy.handleStartRecording)
 	http.HandleFunc("/stop-recording", proxy.handleStopRecording)
+	http.HandleFunc("/snapshot", proxy.handleSnapshot)
 
 	// 启动HTTP服务器
 	server := &http.Server{
@@ -121,6 +171,7 @@ func main() {
 	// 导出录制数据
 	fmt.Println("💾 导出录制数据...")
 	proxy.exportRecording()
+	proxy.closePersister()
 
 	fmt.Println("✅ 服务器已关闭")
 }
@@ -276,26 +327,29 @@ func (pc *ProxyConnection) recordMessage(direction string, data []byte) {
 		return // 消息太短，跳过
 	}
 
+	// 以客户端视角记录方向，与会话格式的send/receive一致
+	recordedDirection := "send"
+	eventType := session.EventMessageSend
+	if direction == "server_to_client" {
+		recordedDirection = "receive"
+		eventType = session.EventMessageReceive
+	}
+
 	// 尝试解析协议帧
 	opcode, body, err := protocol.DecodeFrame(data)
 	if err != nil {
 		// 如果不是协议帧，记录原始数据
-		pc.recorder.RecordMessage(direction, data, 0, data, 0)
+		pc.recorder.RecordMessage(recordedDirection, data, 0, data, 0)
 		return
 	}
 
 	// 记录协议消息
 	sequenceNum := uint64(0) // 这里可以从消息中提取序列号
-	pc.recorder.RecordMessage(direction, data, opcode, body, sequenceNum)
+	pc.recorder.RecordMessage(recordedDirection, data, opcode, body, sequenceNum)
 
 	// 记录事件
-	eventType := session.EventMessageSend
-	if direction == "server_to_client" {
-		eventType = session.EventMessageReceive
-	}
-
 	pc.recorder.RecordEvent(eventType, map[string]interface{}{
-		"direction":    direction,
+		"direction":    recordedDirection,
 		"opcode":       opcode,
 		"message_size": len(data),
 		"body_size":    len(body),
@@ -321,6 +375,10 @@ func (p *RecordingProxy) handleStatus(w http.ResponseWriter, r *http.Request) {
 		"recording":    true,
 		"stats":        stats,
 	}
+	if flightStats := p.recorder.FlightStats(); flightStats != nil {
+		status["flight_recorder"] = flightStats
+		status["snapshots"] = p.recorder.FlightSnapshots()
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(status); err != nil {
@@ -358,6 +416,34 @@ func (p *RecordingProxy) handleStopRecording(w http.ResponseWriter, r *http.Requ
 	json.NewEncoder(w).Encode(response)
 }
 
+// handleSnapshot 飞行记录器模式下立即写出快照
+func (p *RecordingProxy) handleSnapshot(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if p.recorder.FlightStats() == nil {
+		http.Error(w, "Flight recorder is disabled (--flight-window)", http.StatusConflict)
+		return
+	}
+
+	reason := r.URL.Query().Get("reason")
+	if reason == "" {
+		reason = "api"
+	}
+	snapshot, err := p.recorder.Snapshot(reason)
+	if errors.Is(err, session.ErrSnapshotSuppressed) {
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(snapshot)
+}
+
 // exportRecording 导出录制数据
 func (p *RecordingProxy) exportRecording() {
 	recordedSession := p.recorder.GetSession()
@@ -384,3 +470,21 @@ func (p *RecordingProxy) exportRecording() {
 	fmt.Printf("📊 录制统计: %d 个事件, %d 个消息帧\n",
 		len(recordedSession.Events), len(recordedSession.Frames))
 }
+
+// closePersister 停止录制并写入数据库中剩余的事件和帧
+func (p *RecordingProxy) closePersister() {
+	if p.persister == nil {
+		return
+	}
+	defer database.ClosePgx()
+
+	p.recorder.Stop()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := p.persister.Close(ctx); err != nil {
+		log.Printf("❌ 写入数据库失败: %v", err)
+		return
+	}
+	row := p.persister.Row()
+	fmt.Printf("🗄️  录制已写入数据库: test_session=%d, %d 条消息\n", row.ID, row.MessageCount.Int32)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"time"
+
+	"GoSlgBenchmarkTest/internal/session"
+)
+
+// 命令行参数
+var (
+	sessionPath   = flag.String("session", "", "会话文件（JSON导出或分块会话文件），需包含客户端发送帧")
+	targetURL     = flag.String("url", "ws://localhost:18090/ws", "目标服务器WebSocket地址")
+	clients       = flag.Int("clients", 10, "虚拟客户端数量")
+	startInterval = flag.Duration("start-interval", 50*time.Millisecond, "相邻虚拟客户端的启动间隔")
+	startJitter   = flag.Duration("start-jitter", 0, "启动时间的随机偏移上限")
+	jitter        = flag.Float64("jitter", 0.1, "发送间隔的随机抖动比例")
+	speed         = flag.Float64("speed", 1, "回放速度倍数，0表示不等待发送间隔")
+	battleSize    = flag.Int("battle-size", 0, "每场战斗的虚拟玩家数，0表示沿用录制的战斗ID")
+	seed          = flag.Int64("seed", time.Now().UnixNano(), "抖动随机数种子")
+	tokenPattern  = flag.String("token-pattern", "", "虚拟客户端令牌模板，%d替换为客户端序号，为空时沿用录制的令牌")
+	outputPath    = flag.String("out", "", "汇总报告JSON输出路径")
+)
+
+func main() {
+	flag.Parse()
+
+	if *sessionPath == "" {
+		log.Fatal("❌ 必须指定会话文件 (--session)")
+	}
+	recorded, err := session.LoadSession(*sessionPath)
+	if err != nil {
+		log.Fatalf("❌ 加载会话失败: %v", err)
+	}
+
+	config := session.DefaultAmplifierConfig(*targetURL, *clients)
+	config.StartInterval = *startInterval
+	config.StartJitter = *startJitter
+	config.Jitter = *jitter
+	config.Speed = session.ReplaySpeed(*speed)
+	config.BattleSize = *battleSize
+	config.Seed = *seed
+	if *tokenPattern != "" {
+		config.TokenFor = func(index int) string {
+			return fmt.Sprintf(*tokenPattern, index)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	fmt.Printf("🚀 将 %s 放大为 %d 个虚拟客户端 -> %s\n", recorded.ID, *clients, *targetURL)
+	report, err := session.NewSessionAmplifier(recorded, config).Run(ctx)
+	if err != nil && report == nil {
+		log.Fatalf("❌ 放大回放失败: %v", err)
+	}
+
+	fmt.Printf("📊 耗时 %v, 成功 %d, 失败 %d, 发送 %d 帧 (%.1f 帧/秒), 接收 %d 帧\n",
+		report.Duration.Round(time.Millisecond), report.Succeeded, report.Failed,
+		report.SentFrames, report.SendRate, report.ReceivedFrames)
+	for _, entry := range report.Latency {
+		fmt.Printf("   %-16s n=%-6d p50=%-10v p90=%-10v p99=%-10v max=%v\n", entry.Name, entry.Latency.Count,
+			entry.Latency.P50, entry.Latency.P90, entry.Latency.P99, entry.Latency.Max)
+	}
+	for message, count := range report.Errors {
+		fmt.Printf("   ❌ %s ×%d\n", message, count)
+	}
+
+	if *outputPath != "" {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			log.Fatalf("❌ 序列化报告失败: %v", err)
+		}
+		if err := os.WriteFile(*outputPath, data, 0644); err != nil {
+			log.Fatalf("❌ 写出报告失败: %v", err)
+		}
+		fmt.Printf("✅ 报告已保存到: %s\n", *outputPath)
+	}
+	if report.Failed > 0 {
+		os.Exit(1)
+	}
+}
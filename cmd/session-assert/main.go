@@ -0,0 +1,78 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"GoSlgBenchmarkTest/internal/session"
+)
+
+// 命令行参数
+var (
+	sessionPath = flag.String("session", "", "会话文件（JSON导出或分块会话文件）")
+	suitePath   = flag.String("suite", "", "YAML断言套件，格式见 configs/assertion-suite.yaml")
+	junitPath   = flag.String("junit", "", "JUnit XML报告输出路径，为空时不输出")
+	peersFlag   = flag.String("peers", "", "同一战斗中其他客户端的会话文件，逗号分隔，用于状态哈希一致性等跨客户端断言")
+)
+
+func main() {
+	flag.Parse()
+
+	if *sessionPath == "" || *suitePath == "" {
+		log.Fatal("❌ 必须指定会话和断言套件 (--session, --suite)")
+	}
+
+	recorded, err := session.LoadSession(*sessionPath)
+	if err != nil {
+		log.Fatalf("❌ 加载会话失败: %v", err)
+	}
+	suite, err := session.LoadAssertionSuite(*suitePath)
+	if err != nil {
+		log.Fatalf("❌ 加载断言套件失败: %v", err)
+	}
+
+	if *peersFlag != "" {
+		var peers []*session.Session
+		for _, path := range strings.Split(*peersFlag, ",") {
+			peer, err := session.LoadSession(strings.TrimSpace(path))
+			if err != nil {
+				log.Fatalf("❌ 加载会话 %s 失败: %v", path, err)
+			}
+			peers = append(peers, peer)
+		}
+		suite.AttachPeers(peers...)
+	}
+
+	results := suite.RunAssertions(recorded)
+	fmt.Printf("🧪 %s (%s)\n", suite.Name, recorded.ID)
+	for i, result := range results {
+		status := "✅"
+		if !result.Passed {
+			status = "❌"
+		}
+		fmt.Printf("   %s %s: %s\n", status, suite.Assertions[i].GetName(), result.Message)
+	}
+	fmt.Println(suite.GetSummary())
+
+	if *junitPath != "" {
+		report, err := os.Create(*junitPath)
+		if err != nil {
+			log.Fatalf("❌ 创建报告失败: %v", err)
+		}
+		if err := suite.WriteJUnit(report, recorded.ID); err != nil {
+			report.Close()
+			log.Fatalf("❌ 写出报告失败: %v", err)
+		}
+		if err := report.Close(); err != nil {
+			log.Fatalf("❌ 写出报告失败: %v", err)
+		}
+		fmt.Printf("📄 JUnit报告已保存: %s\n", *junitPath)
+	}
+
+	if suite.GetFailedCount() > 0 {
+		os.Exit(1)
+	}
+}
@@ -263,10 +263,23 @@ func main() {
 		}
 	}
 
+	// 10. 导出Chrome trace，可在Perfetto中查看
+	traceFilename := fmt.Sprintf("trace_%s.json", sessionID)
+	if traceFile, err := os.Create(traceFilename); err != nil {
+		log.Printf("创建trace文件失败: %v", err)
+	} else {
+		if err := analyzer.WriteChromeTrace(traceFile, nil); err != nil {
+			log.Printf("导出trace失败: %v", err)
+		}
+		traceFile.Close()
+		fmt.Printf("✅ Chrome trace已保存到: %s (用 https://ui.perfetto.dev 打开)\n", traceFilename)
+	}
+
 	fmt.Println("\n🎉 演示完成！")
 	fmt.Println("\n📁 生成的文件:")
 	fmt.Printf("   - %s (会话数据)\n", fmt.Sprintf("session_%s.json", sessionID))
 	fmt.Printf("   - %s (时间线报告)\n", fmt.Sprintf("timeline_report_%s.json", sessionID))
+	fmt.Printf("   - %s (Chrome trace)\n", traceFilename)
 
 	fmt.Println("\n🔍 功能特性:")
 	fmt.Println("   ✅ 完整会话录制 (握手→认证→心跳→业务收发→异常/关闭)")
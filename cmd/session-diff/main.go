@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"GoSlgBenchmarkTest/internal/protocol"
+	"GoSlgBenchmarkTest/internal/session"
+)
+
+// ignoreFlags 可重复的忽略规则参数，格式为 opcode 或 opcode:field1,field2
+type ignoreFlags []session.IgnoreRule
+
+func (f *ignoreFlags) String() string {
+	return fmt.Sprintf("%d rules", len(*f))
+}
+
+func (f *ignoreFlags) Set(value string) error {
+	opcodeText, fields, _ := strings.Cut(value, ":")
+	opcode, err := strconv.ParseUint(opcodeText, 10, 16)
+	if err != nil {
+		return fmt.Errorf("invalid opcode %q", opcodeText)
+	}
+	rule := session.IgnoreRule{Opcode: uint16(opcode)}
+	if fields != "" {
+		rule.Fields = strings.Split(fields, ",")
+	}
+	*f = append(*f, rule)
+	return nil
+}
+
+// 命令行参数
+var (
+	basePath      = flag.String("base", "", "基准会话文件（JSON导出或分块会话文件）")
+	targetPath    = flag.String("target", "", "目标会话文件")
+	jsonOutput    = flag.Bool("json", false, "以JSON格式输出差异")
+	noDefaults    = flag.Bool("no-default-ignore", false, "不使用默认忽略规则（时间戳、服务器ID和心跳）")
+	maxListed     = flag.Int("max", 20, "每类差异最多列出的条数")
+	failOnLatency = flag.Duration("fail-p90-shift", 0, "P90延迟增加超过该值时视为差异，0表示不检查")
+	ignoreRules   ignoreFlags
+)
+
+func main() {
+	flag.Var(&ignoreRules, "ignore", "忽略规则，可重复：opcode 或 opcode:field1,field2（嵌套字段用点分隔）")
+	flag.Parse()
+
+	if *basePath == "" || *targetPath == "" {
+		log.Fatal("❌ 必须指定基准和目标会话 (--base, --target)")
+	}
+
+	base, err := session.LoadSession(*basePath)
+	if err != nil {
+		log.Fatalf("❌ 加载基准会话失败: %v", err)
+	}
+	target, err := session.LoadSession(*targetPath)
+	if err != nil {
+		log.Fatalf("❌ 加载目标会话失败: %v", err)
+	}
+
+	options := session.DefaultSessionDiffOptions()
+	if *noDefaults {
+		options.IgnoreRules = nil
+	}
+	options.IgnoreRules = append(options.IgnoreRules, ignoreRules...)
+
+	diff := session.DiffSessions(base, target, options)
+
+	if *jsonOutput {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(diff); err != nil {
+			log.Fatalf("❌ 输出JSON失败: %v", err)
+		}
+	} else {
+		printDiff(diff)
+	}
+
+	if !diff.Identical() || latencyRegressed(diff) {
+		os.Exit(1)
+	}
+}
+
+// latencyRegressed P90延迟增加是否超过阈值
+func latencyRegressed(diff *session.SessionDiff) bool {
+	if *failOnLatency <= 0 {
+		return false
+	}
+	for _, shift := range diff.Latency {
+		if shift.Base.Count > 0 && shift.Target.Count > 0 && shift.P90Shift > *failOnLatency {
+			return true
+		}
+	}
+	return false
+}
+
+// printDiff 输出可读的差异报告
+func printDiff(diff *session.SessionDiff) {
+	fmt.Println("🔍 会话差异对比")
+	fmt.Println("==================================")
+	fmt.Printf("📼 基准: %s\n", diff.BaseID)
+	fmt.Printf("📼 目标: %s\n", diff.TargetID)
+	fmt.Printf("🔗 已对齐消息: %d\n\n", diff.Matched)
+
+	printMessages("➕ 新增消息", diff.Added)
+	printMessages("➖ 缺失消息", diff.Removed)
+	printMessages("🔀 乱序消息", diff.Reordered)
+
+	if len(diff.Changed) > 0 {
+		fmt.Printf("✏️  内容变化 (%d):\n", len(diff.Changed))
+		for i, change := range diff.Changed {
+			if i >= *maxListed {
+				fmt.Printf("   ... 另有 %d 条\n", len(diff.Changed)-i)
+				break
+			}
+			fmt.Printf("   %-7s %-14s %-16s %s\n", change.Direction, protocol.OpcodeToString(change.Opcode),
+				change.Key, strings.Join(change.Fields, ", "))
+		}
+		fmt.Println()
+	}
+
+	if len(diff.Latency) > 0 {
+		fmt.Println("⏱️  响应延迟 (基准 -> 目标):")
+		for _, shift := range diff.Latency {
+			fmt.Printf("   %-14s n=%d->%d  p50 %v->%v (%+v)  p90 %v->%v (%+v)  p99 %v->%v (%+v)\n",
+				protocol.OpcodeToString(shift.Opcode), shift.Base.Count, shift.Target.Count,
+				shift.Base.P50, shift.Target.P50, shift.P50Shift,
+				shift.Base.P90, shift.Target.P90, shift.P90Shift,
+				shift.Base.P99, shift.Target.P99, shift.P99Shift)
+		}
+		fmt.Println()
+	}
+
+	if diff.Identical() {
+		fmt.Println("✅ 消息流一致")
+	} else {
+		fmt.Println("❌ 消息流存在差异")
+	}
+}
+
+// printMessages 输出增删或乱序的消息
+func printMessages(title string, messages []*session.DiffedMessage) {
+	if len(messages) == 0 {
+		return
+	}
+	fmt.Printf("%s (%d):\n", title, len(messages))
+	for i, message := range messages {
+		if i >= *maxListed {
+			fmt.Printf("   ... 另有 %d 条\n", len(messages)-i)
+			break
+		}
+		fmt.Printf("   %-7s %-14s %-16s base#%d target#%d\n", message.Direction,
+			protocol.OpcodeToString(message.Opcode), message.Key, message.BaseIndex, message.TargetIndex)
+	}
+	fmt.Println()
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"GoSlgBenchmarkTest/internal/session"
+)
+
+// keyEnv 脱敏密钥的环境变量，避免密钥出现在命令行历史中
+const keyEnv = "SESSION_REDACT_KEY"
+
+// 命令行参数
+var (
+	sessionsFlag = flag.String("sessions", "", "会话文件（JSON导出或分块会话文件），多个玩家的录制用逗号分隔，共享同一套假名")
+	outputDir    = flag.String("out", ".", "脱敏后会话的输出目录")
+	configPath   = flag.String("config", "", "脱敏规则JSON文件，覆盖默认规则中出现的字段")
+	jsonOutput   = flag.Bool("json", false, "输出JSON导出格式，默认输出分块会话文件")
+)
+
+func main() {
+	flag.Parse()
+
+	if *sessionsFlag == "" {
+		log.Fatal("❌ 必须指定会话文件 (--sessions)")
+	}
+
+	config := session.DefaultRedactionConfig()
+	if *configPath != "" {
+		data, err := os.ReadFile(*configPath)
+		if err != nil {
+			log.Fatalf("❌ 读取脱敏规则失败: %v", err)
+		}
+		if err := json.Unmarshal(data, config); err != nil {
+			log.Fatalf("❌ 解析脱敏规则失败: %v", err)
+		}
+	}
+	config.Key = os.Getenv(keyEnv)
+	if config.Key == "" {
+		fmt.Printf("⚠️  未设置 %s，使用随机密钥，假名只在本次处理的会话之间一致\n", keyEnv)
+	}
+	if err := os.MkdirAll(*outputDir, 0o755); err != nil {
+		log.Fatalf("❌ 创建输出目录失败: %v", err)
+	}
+
+	redactor := session.NewRedactor(config)
+	for _, path := range strings.Split(*sessionsFlag, ",") {
+		path = strings.TrimSpace(path)
+		recorded, err := session.LoadSession(path)
+		if err != nil {
+			log.Fatalf("❌ 加载会话 %s 失败: %v", path, err)
+		}
+		redacted, report, err := redactor.Redact(recorded)
+		if err != nil {
+			log.Fatalf("❌ 脱敏会话 %s 失败: %v", path, err)
+		}
+		output, err := writeSession(path, redacted)
+		if err != nil {
+			log.Fatalf("❌ 写出会话 %s 失败: %v", redacted.ID, err)
+		}
+		fmt.Printf("🔒 %-40s 帧=%-6d 事件=%-6d 字段=%-6d 未知消息体=%-4d -> %s\n", redacted.ID,
+			report.Frames, report.Events, report.Fields, report.OpaqueFrames, output)
+	}
+}
+
+// writeSession 按输出格式写出脱敏后的会话，文件名沿用输入文件名
+func writeSession(input string, redacted *session.Session) (string, error) {
+	name := strings.TrimSuffix(filepath.Base(input), filepath.Ext(input)) + ".redacted"
+	if *jsonOutput {
+		path := filepath.Join(*outputDir, name+".json")
+		data, err := json.MarshalIndent(redacted, "", "  ")
+		if err != nil {
+			return "", err
+		}
+		return path, os.WriteFile(path, data, 0o644)
+	}
+
+	path := filepath.Join(*outputDir, name+".session")
+	writer, err := session.CreateSessionFile(path, redacted.ID, redacted.StartTime, nil)
+	if err != nil {
+		return "", err
+	}
+	if err := writer.WriteSession(redacted); err != nil {
+		writer.Close()
+		return "", err
+	}
+	return path, writer.Close()
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+
+	"GoSlgBenchmarkTest/internal/session"
+)
+
+// 命令行参数
+var (
+	sessionPath = flag.String("session", "", "会话文件（JSON导出或分块会话文件）")
+	addr        = flag.String("addr", "localhost:18090", "回放控制接口监听地址")
+	speed       = flag.Float64("speed", 1, "回放速度倍数，0表示不等待事件间隔")
+	stream      = flag.Bool("stream", false, "从分块会话文件流式回放，不加载整个会话；只支持按时间跳转")
+)
+
+func main() {
+	flag.Parse()
+
+	if *sessionPath == "" {
+		log.Fatal("❌ 必须指定会话文件 (--session)")
+	}
+
+	config := &session.ReplayConfig{Speed: session.ReplaySpeed(*speed)}
+
+	var replayer *session.SessionReplayer
+	if *stream {
+		reader, err := session.OpenSessionFile(*sessionPath)
+		if err != nil {
+			log.Fatalf("❌ 打开会话文件失败: %v", err)
+		}
+		defer reader.Close()
+		replayer = session.NewStreamingReplayer(reader, config)
+	} else {
+		recorded, err := session.LoadSession(*sessionPath)
+		if err != nil {
+			log.Fatalf("❌ 加载会话失败: %v", err)
+		}
+		replayer = session.NewSessionReplayer(recorded, config)
+		fmt.Printf("📼 %s: %d 个事件, %d 帧\n", recorded.ID, len(recorded.Events), len(recorded.Frames))
+	}
+
+	controller := session.NewReplayController(replayer)
+	fmt.Printf("🎛️  回放控制接口: http://%s/state\n", *addr)
+	fmt.Printf("   POST /play /pause /resume /step?direction=forward|back /seek?offset=10m30s\n")
+	fmt.Printf("   POST /breakpoints  {\"opcodes\":[2001],\"payload\":[{\"field\":\"units.hp\",\"op\":\"<=\",\"value\":0}]}\n")
+	fmt.Printf("   WebSocket: ws://%s/ws\n", *addr)
+
+	if err := http.ListenAndServe(*addr, controller); err != nil {
+		log.Fatalf("❌ 控制接口退出: %v", err)
+	}
+}
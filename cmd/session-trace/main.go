@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"GoSlgBenchmarkTest/internal/session"
+)
+
+// 命令行参数
+var (
+	sessionsFlag = flag.String("sessions", "", "会话文件（JSON导出或分块会话文件），多个玩家的录制用逗号分隔")
+	outputPath   = flag.String("out", "trace.json", "Chrome trace输出路径，可在 https://ui.perfetto.dev 或 chrome://tracing 中打开")
+	omitMessages = flag.Bool("omit-messages", false, "不输出未配对消息（如战斗推送）的即时事件，减小长录制的trace文件")
+)
+
+func main() {
+	flag.Parse()
+
+	if *sessionsFlag == "" {
+		log.Fatal("❌ 必须指定会话文件 (--sessions)")
+	}
+
+	var sessions []*session.Session
+	for _, path := range strings.Split(*sessionsFlag, ",") {
+		recorded, err := session.LoadSession(strings.TrimSpace(path))
+		if err != nil {
+			log.Fatalf("❌ 加载会话 %s 失败: %v", path, err)
+		}
+		sessions = append(sessions, recorded)
+	}
+
+	trace := session.BuildChromeTrace(sessions, &session.ChromeTraceOptions{OmitMessages: *omitMessages})
+
+	output, err := os.Create(*outputPath)
+	if err != nil {
+		log.Fatalf("❌ 创建输出文件失败: %v", err)
+	}
+	if err := json.NewEncoder(output).Encode(trace); err != nil {
+		output.Close()
+		log.Fatalf("❌ 写出trace失败: %v", err)
+	}
+	if err := output.Close(); err != nil {
+		log.Fatalf("❌ 写出trace失败: %v", err)
+	}
+
+	fmt.Printf("🧭 已导出 %d 个会话, %d 个trace事件: %s\n", len(sessions), len(trace.TraceEvents), *outputPath)
+}
@@ -12,6 +12,8 @@ import (
 	"time"
 
 	"GoSlgBenchmarkTest/internal/config"
+	"GoSlgBenchmarkTest/internal/database"
+	"GoSlgBenchmarkTest/internal/protocol"
 	"GoSlgBenchmarkTest/internal/session"
 	"GoSlgBenchmarkTest/internal/wsclient"
 
@@ -27,6 +29,8 @@ var (
 	outputFlag   = flag.String("output", "", "输出目录 (默认使用配置文件中的设置)")
 	verboseFlag  = flag.Bool("verbose", false, "启用详细日志")
 	dryRunFlag   = flag.Bool("dry-run", false, "干运行模式，只显示配置不实际录制")
+	dbURLFlag    = flag.String("db-url", "", "PostgreSQL连接串，设置后录制内容分批写入test_sessions/session_events/session_messages表")
+	dbTestFlag   = flag.Int64("db-test-id", 0, "录制关联的tests记录ID，0表示自动创建一条session_recording测试")
 )
 
 func main() {
@@ -122,7 +126,7 @@ func main() {
 
 // startRecording 开始录制会话
 func startRecording(testConfig *config.TestEnvironmentConfig, env *config.Environment,
-	testAccount *config.TestAccount, outputDir string, duration time.Duration) error {
+	testAccount *config.TestAccount, outputDir string, duration time.Duration) (err error) {
 
 	// 创建会话录制器
 	sessionID := fmt.Sprintf("%s_%s_%d",
@@ -131,6 +135,47 @@ func startRecording(testConfig *config.TestEnvironmentConfig, env *config.Enviro
 
 	fmt.Printf("📹 会话ID: %s\n", sessionID)
 
+	// 边录制边写入数据库
+	var persister *database.SessionPersister
+	if *dbURLFlag != "" {
+		if err := database.ConnectPgxURL(*dbURLFlag); err != nil {
+			return fmt.Errorf("数据库连接失败: %w", err)
+		}
+		defer database.ClosePgx()
+
+		persistOptions := database.DefaultSessionPersisterOptions()
+		persistOptions.TestID = *dbTestFlag
+		persistOptions.ClientType = "unity-recorder"
+		persistOptions.ClientInfo = map[string]interface{}{
+			"environment": string(env.Name),
+			"player_id":   testAccount.PlayerID,
+			"username":    testAccount.Username,
+			"server_url":  env.Server.WsURL,
+		}
+		persister, err = database.NewSessionPersister(context.Background(), database.GetQueries(), sessionID, time.Now(), persistOptions)
+		if err != nil {
+			return fmt.Errorf("创建会话记录失败: %w", err)
+		}
+		// 任何退出路径都写完缓冲并更新会话记录，录制失败时测试标记为失败
+		defer func() {
+			recorder.Stop()
+			if err != nil {
+				persister.Fail(err)
+			}
+			persistCtx, persistCancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer persistCancel()
+			if closeErr := persister.Close(persistCtx); closeErr != nil {
+				if err == nil {
+					err = fmt.Errorf("写入数据库失败: %w", closeErr)
+				}
+				return
+			}
+			fmt.Printf("🗄️  录制已写入数据库: test_session=%d, %d 条消息\n", persister.Row().ID, persister.Row().MessageCount.Int32)
+		}()
+		recorder.StreamTo(persister, true)
+		fmt.Printf("🗄️  录制写入数据库: test_id=%d, test_session=%d\n", persister.Row().TestID, persister.Row().ID)
+	}
+
 	// 配置WebSocket客户端
 	clientConfig := &wsclient.ClientConfig{
 		URL:               env.Server.WsURL,
@@ -277,65 +322,35 @@ func exportSession(testConfig *config.TestEnvironmentConfig, recorder *session.S
 	}
 
 	// 如果启用了自动断言，运行断言测试
-	if testConfig.Global.Assertions.MessageOrder.Enabled ||
-		testConfig.Global.Assertions.Latency.Enabled ||
-		testConfig.Global.Assertions.Reconnect.Enabled ||
-		testConfig.Global.Assertions.ErrorRate.Enabled {
+	assertions := testConfig.Global.Assertions
+	if assertions.SuiteFile != "" ||
+		assertions.MessageOrder.Enabled ||
+		assertions.Latency.Enabled ||
+		assertions.Reconnect.Enabled ||
+		assertions.ErrorRate.Enabled {
 
 		fmt.Println("🧪 运行自动断言测试...")
-		runAssertions(testConfig, recorder.GetSession())
+		if err := runAssertions(testConfig, recorder.GetSession(), outputDir); err != nil {
+			return fmt.Errorf("断言测试失败: %w", err)
+		}
 	}
 
 	return nil
 }
 
-// runAssertions 运行断言测试
-func runAssertions(testConfig *config.TestEnvironmentConfig, recordedSession *session.Session) {
-	suite := session.NewAssertionSuite("Unity Recording Quality Test", "Unity录制质量自动测试")
-
-	// 消息顺序断言
-	if testConfig.Global.Assertions.MessageOrder.Enabled {
-		// 这里需要根据实际的协议操作码来配置
-		// 示例使用通用的操作码
-		suite.AddAssertion(session.NewMessageOrderAssertion(
-			"Message Order Check",
-			"验证消息按顺序接收",
-			2002, // 这里应该使用配置文件中定义的操作码
-			testConfig.Global.Assertions.MessageOrder.MinMessages,
-			testConfig.Global.Assertions.MessageOrder.MaxMessages,
-		))
-	}
-
-	// 延迟断言
-	if testConfig.Global.Assertions.Latency.Enabled {
-		suite.AddAssertion(session.NewLatencyAssertion(
-			"Latency Check",
-			"验证延迟在可接受范围内",
-			testConfig.Global.Assertions.Latency.MaxLatency,
-			testConfig.Global.Assertions.Latency.Percentile,
-		))
-	}
-
-	// 重连断言
-	if testConfig.Global.Assertions.Reconnect.Enabled {
-		suite.AddAssertion(session.NewReconnectAssertion(
-			"Reconnect Check",
-			"验证重连次数和耗时",
-			testConfig.Global.Assertions.Reconnect.MaxCount,
-			testConfig.Global.Assertions.Reconnect.MaxDuration,
-		))
+// runAssertions 运行断言测试，结果以JUnit XML写入输出目录
+func runAssertions(testConfig *config.TestEnvironmentConfig, recordedSession *session.Session, outputDir string) error {
+	var suite *session.AssertionSuite
+	var err error
+	if path := testConfig.Global.Assertions.SuiteFile; path != "" {
+		suite, err = session.LoadAssertionSuite(path)
+	} else {
+		suite, err = legacyAssertionSpec(testConfig.Global.Assertions).Build()
 	}
-
-	// 错误率断言
-	if testConfig.Global.Assertions.ErrorRate.Enabled {
-		suite.AddAssertion(session.NewErrorRateAssertion(
-			"Error Rate Check",
-			"验证错误率在可接受范围内",
-			testConfig.Global.Assertions.ErrorRate.MaxRate,
-		))
+	if err != nil {
+		return err
 	}
 
-	// 运行断言
 	suite.RunAssertions(recordedSession)
 
 	passedCount := suite.GetPassedCount()
@@ -348,6 +363,69 @@ func runAssertions(testConfig *config.TestEnvironmentConfig, recordedSession *se
 	if failedCount > 0 {
 		fmt.Println("⚠️  存在失败的断言，请检查录制质量")
 	}
+
+	reportFile := filepath.Join(outputDir, fmt.Sprintf("assertions_%s.xml", recordedSession.ID))
+	report, err := os.Create(reportFile)
+	if err != nil {
+		return err
+	}
+	defer report.Close()
+	if err := suite.WriteJUnit(report, recordedSession.ID); err != nil {
+		return err
+	}
+	fmt.Printf("📄 断言报告已保存: %s\n", reportFile)
+	return nil
+}
+
+// legacyAssertionSpec 将配置文件中的内置断言开关转换为断言套件描述
+func legacyAssertionSpec(assertions config.AssertionConfig) *session.AssertionSuiteSpec {
+	spec := &session.AssertionSuiteSpec{Name: "Unity Recording Quality Test", Description: "Unity录制质量自动测试"}
+
+	// 消息顺序断言
+	if assertions.MessageOrder.Enabled {
+		spec.Assertions = append(spec.Assertions, session.AssertionSpec{
+			Name:        "Message Order Check",
+			Description: "验证消息按顺序接收",
+			Type:        session.AssertionTypeMessageOrder,
+			Opcode:      protocol.OpPlayerAction,
+			MinCount:    assertions.MessageOrder.MinMessages,
+			MaxCount:    assertions.MessageOrder.MaxMessages,
+		})
+	}
+
+	// 延迟断言
+	if assertions.Latency.Enabled {
+		spec.Assertions = append(spec.Assertions, session.AssertionSpec{
+			Name:        "Latency Check",
+			Description: "验证延迟在可接受范围内",
+			Type:        session.AssertionTypeLatency,
+			MaxLatency:  assertions.Latency.MaxLatency,
+			Percentile:  assertions.Latency.Percentile,
+		})
+	}
+
+	// 重连断言
+	if assertions.Reconnect.Enabled {
+		spec.Assertions = append(spec.Assertions, session.AssertionSpec{
+			Name:        "Reconnect Check",
+			Description: "验证重连次数和耗时",
+			Type:        session.AssertionTypeReconnect,
+			MaxCount:    assertions.Reconnect.MaxCount,
+			MaxDuration: assertions.Reconnect.MaxDuration,
+		})
+	}
+
+	// 错误率断言
+	if assertions.ErrorRate.Enabled {
+		spec.Assertions = append(spec.Assertions, session.AssertionSpec{
+			Name:        "Error Rate Check",
+			Description: "验证错误率在可接受范围内",
+			Type:        session.AssertionTypeErrorRate,
+			MaxRate:     assertions.ErrorRate.MaxRate,
+		})
+	}
+
+	return spec
 }
 
 // contains 检查切片中是否包含指定元素
@@ -0,0 +1,406 @@
+// Package auth 提供WS、HTTP和gRPC测试服务器共用的HMAC签名令牌（兼容JWT HS256）
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"GoSlgBenchmarkTest/internal/config"
+)
+
+// 令牌类型
+const (
+	TokenAccess  = "access"
+	TokenRefresh = "refresh"
+)
+
+var (
+	ErrMalformed = errors.New("malformed token")
+	ErrSignature = errors.New("invalid token signature")
+	ErrExpired   = errors.New("token expired")
+	ErrRevoked   = errors.New("token revoked")
+	ErrTokenType = errors.New("unexpected token type")
+)
+
+// jwtHeader 固定的JWT头
+var jwtHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// Claims 令牌声明，字段名与JWT注册声明保持一致
+type Claims struct {
+	Subject   string `json:"sub"` // 玩家ID
+	Username  string `json:"name,omitempty"`
+	DeviceID  string `json:"device_id,omitempty"`
+	Issuer    string `json:"iss,omitempty"`
+	ID        string `json:"jti"`
+	Type      string `json:"typ"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// PlayerID 返回声明中的玩家ID
+func (c *Claims) PlayerID() string {
+	return c.Subject
+}
+
+// ExpiresTime 返回过期时间
+func (c *Claims) ExpiresTime() time.Time {
+	return time.Unix(c.ExpiresAt, 0)
+}
+
+// Config 认证配置
+type Config struct {
+	Secret     []byte           // HMAC密钥
+	Issuer     string           // 签发者
+	AccessTTL  time.Duration    // 访问令牌有效期
+	RefreshTTL time.Duration    // 刷新令牌有效期
+	Leeway     time.Duration    // 过期判定的时钟容差
+	Clock      func() time.Time // 时间来源，为nil时使用time.Now，测试中可替换以模拟过期
+}
+
+// DefaultConfig 返回默认认证配置
+func DefaultConfig() *Config {
+	return &Config{
+		Secret:     []byte("slg-benchmark-test-secret"),
+		Issuer:     "slg-test-server",
+		AccessTTL:  time.Hour,
+		RefreshTTL: 24 * time.Hour,
+	}
+}
+
+// Stats 认证统计
+type Stats struct {
+	Issued   uint64            `json:"issued"`
+	Verified uint64            `json:"verified"`
+	Rejected map[string]uint64 `json:"rejected"` // 按失败原因统计
+	Revoked  int               `json:"revoked"`
+}
+
+// Authenticator 令牌签发与校验
+type Authenticator struct {
+	config *Config
+
+	// 吊销状态：按令牌ID吊销，或吊销玩家在某时间之前签发的全部令牌
+	revokedIDs     map[string]time.Time // jti -> 过期时间，过期后清理
+	revokedPlayers map[string]int64     // 玩家ID -> 在此时间(unix)之前签发的令牌无效
+	mu             sync.RWMutex
+
+	issued   atomic.Uint64
+	verified atomic.Uint64
+	rejected sync.Map // 原因 -> *atomic.Uint64
+}
+
+// New 创建认证器
+func New(cfg *Config) *Authenticator {
+	if cfg == nil {
+		cfg = DefaultConfig()
+	}
+	return &Authenticator{
+		config:         cfg,
+		revokedIDs:     make(map[string]time.Time),
+		revokedPlayers: make(map[string]int64),
+	}
+}
+
+// now 当前时间
+func (a *Authenticator) now() time.Time {
+	if a.config.Clock != nil {
+		return a.config.Clock()
+	}
+	return time.Now()
+}
+
+// AccessTTL 访问令牌有效期
+func (a *Authenticator) AccessTTL() time.Duration {
+	return a.config.AccessTTL
+}
+
+// Issue 为玩家签发访问令牌
+func (a *Authenticator) Issue(playerID, username string) (string, error) {
+	token, _, err := a.IssueClaims(Claims{Subject: playerID, Username: username, Type: TokenAccess})
+	return token, err
+}
+
+// IssuePair 签发访问令牌和刷新令牌
+func (a *Authenticator) IssuePair(playerID, username string) (access, refresh string, err error) {
+	access, err = a.Issue(playerID, username)
+	if err != nil {
+		return "", "", err
+	}
+	refresh, _, err = a.IssueClaims(Claims{Subject: playerID, Username: username, Type: TokenRefresh})
+	if err != nil {
+		return "", "", err
+	}
+	return access, refresh, nil
+}
+
+// IssueClaims 按给定声明签发令牌，未填写的签发时间、过期时间、ID和签发者自动补全
+func (a *Authenticator) IssueClaims(claims Claims) (string, *Claims, error) {
+	if claims.Subject == "" {
+		return "", nil, errors.New("player id is required")
+	}
+	if claims.Type == "" {
+		claims.Type = TokenAccess
+	}
+
+	now := a.now()
+	if claims.IssuedAt == 0 {
+		claims.IssuedAt = now.Unix()
+	}
+	if claims.ExpiresAt == 0 {
+		ttl := a.config.AccessTTL
+		if claims.Type == TokenRefresh {
+			ttl = a.config.RefreshTTL
+		}
+		claims.ExpiresAt = now.Add(ttl).Unix()
+	}
+	if claims.ID == "" {
+		id, err := newTokenID()
+		if err != nil {
+			return "", nil, err
+		}
+		claims.ID = id
+	}
+	if claims.Issuer == "" {
+		claims.Issuer = a.config.Issuer
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", nil, fmt.Errorf("marshal claims failed: %w", err)
+	}
+
+	signingInput := jwtHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	token := signingInput + "." + a.sign(signingInput)
+
+	a.issued.Add(1)
+	return token, &claims, nil
+}
+
+// IssueForAccount 将配置中的测试账号转换为有效的访问令牌
+func (a *Authenticator) IssueForAccount(account config.TestAccount) (string, error) {
+	playerID := account.PlayerID
+	if playerID == "" {
+		playerID = fmt.Sprintf("player_%s", account.Username)
+	}
+	return a.Issue(playerID, account.Username)
+}
+
+// IssueForAccounts 为一组测试账号签发访问令牌，返回用户名 -> 令牌
+func (a *Authenticator) IssueForAccounts(accounts []config.TestAccount) (map[string]string, error) {
+	tokens := make(map[string]string, len(accounts))
+	for _, account := range accounts {
+		token, err := a.IssueForAccount(account)
+		if err != nil {
+			return nil, fmt.Errorf("issue token for %s failed: %w", account.Username, err)
+		}
+		tokens[account.Username] = token
+	}
+	return tokens, nil
+}
+
+// Verify 校验访问令牌
+func (a *Authenticator) Verify(token string) (*Claims, error) {
+	return a.VerifyType(token, TokenAccess)
+}
+
+// VerifyType 校验令牌签名、类型、有效期与吊销状态
+func (a *Authenticator) VerifyType(token, tokenType string) (*Claims, error) {
+	claims, err := a.parse(token)
+	if err == nil && claims.Type != tokenType {
+		err = fmt.Errorf("%w: want %s, got %s", ErrTokenType, tokenType, claims.Type)
+	}
+	if err == nil {
+		err = a.checkValidity(claims)
+	}
+	if err != nil {
+		a.reject(err)
+		return nil, err
+	}
+
+	a.verified.Add(1)
+	return claims, nil
+}
+
+// Inspect 校验签名并解析声明，不检查有效期与吊销状态，也不计入统计；供网关等只需识别玩家的场景使用
+func (a *Authenticator) Inspect(token string) (*Claims, error) {
+	return a.parse(token)
+}
+
+// Refresh 用刷新令牌换取新的令牌对，旧的刷新令牌随即吊销
+func (a *Authenticator) Refresh(refreshToken string) (access, refresh string, err error) {
+	claims, err := a.VerifyType(refreshToken, TokenRefresh)
+	if err != nil {
+		return "", "", err
+	}
+	a.revokeClaims(claims)
+	return a.IssuePair(claims.Subject, claims.Username)
+}
+
+// Revoke 吊销单个令牌（签名必须有效，过期与否均可）
+func (a *Authenticator) Revoke(token string) error {
+	claims, err := a.parse(token)
+	if err != nil {
+		return err
+	}
+	a.revokeClaims(claims)
+	return nil
+}
+
+// RevokePlayer 吊销玩家在此刻之前签发的全部令牌（签发时间精度为秒，同一秒内签发的令牌同样失效）
+func (a *Authenticator) RevokePlayer(playerID string) {
+	a.mu.Lock()
+	a.revokedPlayers[playerID] = a.now().Unix()
+	a.mu.Unlock()
+}
+
+// Stats 获取认证统计
+func (a *Authenticator) Stats() Stats {
+	stats := Stats{
+		Issued:   a.issued.Load(),
+		Verified: a.verified.Load(),
+		Rejected: make(map[string]uint64),
+	}
+	a.rejected.Range(func(key, value interface{}) bool {
+		stats.Rejected[key.(string)] = value.(*atomic.Uint64).Load()
+		return true
+	})
+
+	a.mu.RLock()
+	stats.Revoked = len(a.revokedIDs) + len(a.revokedPlayers)
+	a.mu.RUnlock()
+	return stats
+}
+
+// BearerToken 从Authorization头中取出令牌，兼容带或不带Bearer前缀
+func BearerToken(header string) string {
+	header = strings.TrimSpace(header)
+	if len(header) > 7 && strings.EqualFold(header[:7], "bearer ") {
+		return strings.TrimSpace(header[7:])
+	}
+	return header
+}
+
+// parse 解析令牌并校验签名
+func (a *Authenticator) parse(token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrMalformed
+	}
+	if err := checkHeader(parts[0]); err != nil {
+		return nil, err
+	}
+
+	expected := a.sign(parts[0] + "." + parts[1])
+	if !hmac.Equal([]byte(expected), []byte(parts[2])) {
+		return nil, ErrSignature
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+	claims := &Claims{}
+	if err := json.Unmarshal(payload, claims); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+	return claims, nil
+}
+
+// checkHeader 解码JWT头，只接受HS256，拒绝alg=none等其他算法；typ可省略，出现时必须为JWT
+func checkHeader(segment string) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+	var header struct {
+		Alg string  `json:"alg"`
+		Typ *string `json:"typ"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+	if header.Alg != "HS256" {
+		return fmt.Errorf("%w: unsupported alg %q", ErrMalformed, header.Alg)
+	}
+	if header.Typ != nil && !strings.EqualFold(*header.Typ, "JWT") {
+		return fmt.Errorf("%w: unsupported typ %q", ErrMalformed, *header.Typ)
+	}
+	return nil
+}
+
+// checkValidity 检查有效期与吊销状态
+func (a *Authenticator) checkValidity(claims *Claims) error {
+	now := a.now()
+	if now.After(claims.ExpiresTime().Add(a.config.Leeway)) {
+		return ErrExpired
+	}
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if _, ok := a.revokedIDs[claims.ID]; ok {
+		return ErrRevoked
+	}
+	if before, ok := a.revokedPlayers[claims.Subject]; ok && claims.IssuedAt <= before {
+		return ErrRevoked
+	}
+	return nil
+}
+
+// revokeClaims 按令牌ID吊销，并顺带清理已过期的吊销记录
+func (a *Authenticator) revokeClaims(claims *Claims) {
+	now := a.now()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.revokedIDs[claims.ID] = claims.ExpiresTime()
+	for id, expires := range a.revokedIDs {
+		if now.After(expires.Add(a.config.Leeway)) {
+			delete(a.revokedIDs, id)
+		}
+	}
+}
+
+// reject 按原因统计校验失败
+func (a *Authenticator) reject(err error) {
+	reason := "malformed"
+	switch {
+	case errors.Is(err, ErrSignature):
+		reason = "signature"
+	case errors.Is(err, ErrExpired):
+		reason = "expired"
+	case errors.Is(err, ErrRevoked):
+		reason = "revoked"
+	case errors.Is(err, ErrTokenType):
+		reason = "type"
+	}
+
+	counter, _ := a.rejected.LoadOrStore(reason, &atomic.Uint64{})
+	counter.(*atomic.Uint64).Add(1)
+}
+
+// sign 计算HMAC-SHA256签名
+func (a *Authenticator) sign(signingInput string) string {
+	mac := hmac.New(sha256.New, a.config.Secret)
+	mac.Write([]byte(signingInput))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// newTokenID 生成随机令牌ID
+func newTokenID() (string, error) {
+	buf := make([]byte, 12)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("generate token id failed: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,279 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"GoSlgBenchmarkTest/internal/auth"
+	"GoSlgBenchmarkTest/internal/testserver"
+)
+
+// Config 集群配置
+type Config struct {
+	Nodes        int    // 节点数
+	Replicas     int    // 每个节点在哈希环上的虚拟节点数
+	GatewayAddr  string // 网关监听地址
+	DrainTimeout time.Duration
+
+	// 认证器：设置后所有节点共享，网关按令牌中的玩家ID路由，重连后玩家ID保持不变才能恢复交接状态
+	Authenticator *auth.Authenticator
+
+	// NodeConfig 为每个节点（包括重启后的新实例）生成服务器配置，为nil时使用监听随机端口的默认配置
+	NodeConfig func(nodeID string) *testserver.ServerConfig
+}
+
+// DefaultConfig 返回默认集群配置
+func DefaultConfig() *Config {
+	return &Config{
+		Nodes:        3,
+		Replicas:     100,
+		GatewayAddr:  "127.0.0.1:0",
+		DrainTimeout: 10 * time.Second,
+	}
+}
+
+// Node 集群中的一个节点
+type Node struct {
+	ID         string
+	Server     *testserver.Server
+	Generation int // 重启次数，首次启动为0
+}
+
+// Cluster 多节点测试集群
+type Cluster struct {
+	config  *Config
+	gateway *Gateway
+
+	nodes map[string]*Node
+	mu    sync.RWMutex
+
+	handoffs []*testserver.HandoffState // 历次排空的交接记录
+}
+
+// New 创建集群
+func New(cfg *Config) *Cluster {
+	if cfg == nil {
+		cfg = DefaultConfig()
+	}
+	if cfg.DrainTimeout <= 0 {
+		cfg.DrainTimeout = 10 * time.Second
+	}
+
+	return &Cluster{
+		config:  cfg,
+		gateway: NewGateway(cfg.GatewayAddr, cfg.Replicas, cfg.Authenticator),
+		nodes:   make(map[string]*Node),
+	}
+}
+
+// Start 启动所有节点和网关
+func (c *Cluster) Start() error {
+	for i := 1; i <= c.config.Nodes; i++ {
+		nodeID := fmt.Sprintf("node-%d", i)
+		node, err := c.startNode(nodeID, 0)
+		if err != nil {
+			return err
+		}
+
+		c.mu.Lock()
+		c.nodes[nodeID] = node
+		c.mu.Unlock()
+	}
+
+	return c.gateway.Start()
+}
+
+// Stop 关闭网关和所有节点
+func (c *Cluster) Stop(ctx context.Context) error {
+	err := c.gateway.Shutdown(ctx)
+
+	for _, node := range c.Nodes() {
+		if shutdownErr := node.Server.Shutdown(ctx); shutdownErr != nil && err == nil {
+			err = shutdownErr
+		}
+	}
+	return err
+}
+
+// startNode 创建并启动节点实例，启动后加入网关路由
+func (c *Cluster) startNode(nodeID string, generation int) (*Node, error) {
+	var serverConfig *testserver.ServerConfig
+	if c.config.NodeConfig != nil {
+		serverConfig = c.config.NodeConfig(nodeID)
+	} else {
+		serverConfig = testserver.DefaultServerConfig("127.0.0.1:0")
+	}
+	serverConfig.NodeID = nodeID
+	if serverConfig.Authenticator == nil {
+		serverConfig.Authenticator = c.config.Authenticator
+	}
+
+	server := testserver.New(serverConfig)
+	if err := server.Start(); err != nil {
+		return nil, fmt.Errorf("start node %s failed: %w", nodeID, err)
+	}
+
+	c.gateway.AddNode(nodeID, fmt.Sprintf("ws://%s/ws", server.Addr()))
+	log.Printf("Cluster node %s (generation %d) started on %s", nodeID, generation, server.Addr())
+
+	return &Node{ID: nodeID, Server: server, Generation: generation}, nil
+}
+
+// GatewayURL 获取客户端连接集群使用的WebSocket URL
+func (c *Cluster) GatewayURL() string {
+	return c.gateway.URL()
+}
+
+// Gateway 获取网关
+func (c *Cluster) Gateway() *Gateway {
+	return c.gateway
+}
+
+// Node 获取节点，不存在时返回nil
+func (c *Cluster) Node(nodeID string) *Node {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.nodes[nodeID]
+}
+
+// Nodes 获取所有节点（按ID排序）
+func (c *Cluster) Nodes() []*Node {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	nodes := make([]*Node, 0, len(c.nodes))
+	for _, node := range c.nodes {
+		nodes = append(nodes, node)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].ID < nodes[j].ID })
+	return nodes
+}
+
+// NodeFor 获取玩家当前应路由到的节点ID
+func (c *Cluster) NodeFor(playerID string) (string, bool) {
+	return c.gateway.Route(playerID)
+}
+
+// DrainNode 排空节点：先移出网关路由，使重连落到其他节点，再由节点以1012关闭连接并交接状态。
+// 排空后的节点不再接受连接，但仍保留在集群中直到RestartNode或Stop。
+func (c *Cluster) DrainNode(ctx context.Context, nodeID string) (*testserver.HandoffState, error) {
+	node := c.Node(nodeID)
+	if node == nil {
+		return nil, fmt.Errorf("node %s not found", nodeID)
+	}
+
+	c.gateway.RemoveNode(nodeID)
+
+	ctx, cancel := context.WithTimeout(ctx, c.config.DrainTimeout)
+	defer cancel()
+
+	state, err := node.Server.Drain(ctx, c.handOff)
+	if state != nil {
+		c.mu.Lock()
+		c.handoffs = append(c.handoffs, state)
+		c.mu.Unlock()
+	}
+	return state, err
+}
+
+// handOff 将排空节点的状态交给其他节点：每个玩家的状态交给其重连后将路由到的节点，
+// 序列号交给所有在线节点，保证之后任何迁移都不会让客户端看到序列号回退
+func (c *Cluster) handOff(state *testserver.HandoffState) {
+	targets := make(map[string]*testserver.HandoffState)
+	for _, node := range c.Nodes() {
+		if node.ID == state.NodeID || node.Server.IsDraining() {
+			continue
+		}
+		targets[node.ID] = &testserver.HandoffState{
+			NodeID:    state.NodeID,
+			Sequence:  state.Sequence,
+			DrainedAt: state.DrainedAt,
+		}
+	}
+
+	for _, player := range state.Players {
+		nodeID, ok := c.gateway.Route(player.PlayerID)
+		if !ok || targets[nodeID] == nil {
+			log.Printf("No target node for player %s, handoff dropped", player.PlayerID)
+			continue
+		}
+		targets[nodeID].Players = append(targets[nodeID].Players, player)
+	}
+
+	for nodeID, target := range targets {
+		c.Node(nodeID).Server.ApplyHandoff(target)
+	}
+}
+
+// RestartNode 排空并关闭节点，然后以同一节点ID启动新实例并重新加入路由
+func (c *Cluster) RestartNode(ctx context.Context, nodeID string) error {
+	old := c.Node(nodeID)
+	if old == nil {
+		return fmt.Errorf("node %s not found", nodeID)
+	}
+
+	if !old.Server.IsDraining() {
+		if _, err := c.DrainNode(ctx, nodeID); err != nil {
+			return err
+		}
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(ctx, c.config.DrainTimeout)
+	defer cancel()
+	if err := old.Server.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("shutdown node %s failed: %w", nodeID, err)
+	}
+
+	node, err := c.startNode(nodeID, old.Generation+1)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.nodes[nodeID] = node
+	c.mu.Unlock()
+	return nil
+}
+
+// RollingRestart 按节点ID顺序逐个重启，每个节点重启后等待pause再处理下一个
+func (c *Cluster) RollingRestart(ctx context.Context, pause time.Duration) error {
+	for _, node := range c.Nodes() {
+		if err := c.RestartNode(ctx, node.ID); err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(pause):
+		}
+	}
+	return nil
+}
+
+// Handoffs 获取历次排空的交接记录
+func (c *Cluster) Handoffs() []*testserver.HandoffState {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return append([]*testserver.HandoffState(nil), c.handoffs...)
+}
+
+// GetStats 获取集群统计：网关统计与每个节点的服务器统计
+func (c *Cluster) GetStats() map[string]interface{} {
+	nodes := make(map[string]interface{})
+	for _, node := range c.Nodes() {
+		stats := node.Server.GetStats()
+		stats["generation"] = node.Generation
+		nodes[node.ID] = stats
+	}
+
+	return map[string]interface{}{
+		"gateway":  c.gateway.Stats(),
+		"nodes":    nodes,
+		"handoffs": len(c.Handoffs()),
+	}
+}
@@ -0,0 +1,307 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"google.golang.org/protobuf/proto"
+
+	"GoSlgBenchmarkTest/internal/auth"
+	"GoSlgBenchmarkTest/internal/protocol"
+	gamev1 "GoSlgBenchmarkTest/proto/game/v1"
+)
+
+// GatewayStats 网关统计
+type GatewayStats struct {
+	Nodes       []string          `json:"nodes"`        // 当前参与路由的节点
+	Routed      map[string]uint64 `json:"routed"`       // 节点ID -> 累计路由的连接数
+	Active      map[string]int    `json:"active"`       // 节点ID -> 当前代理中的连接数
+	RouteErrors uint64            `json:"route_errors"` // 无可用节点或连接后端失败的次数
+}
+
+// proxyConn 一条经网关代理的连接
+type proxyConn struct {
+	nodeID  string
+	key     string
+	client  *websocket.Conn
+	backend *websocket.Conn
+}
+
+// Gateway WebSocket网关：读取客户端的登录帧，按玩家ID一致性哈希选择节点后双向转发，
+// 后端关闭连接时原样转发关闭码（如排空时的1012）
+type Gateway struct {
+	addr          string
+	ring          *HashRing
+	authenticator *auth.Authenticator // 为nil时按设备ID路由
+
+	backends   map[string]string // 节点ID -> WebSocket URL
+	backendsMu sync.RWMutex
+
+	upgrader websocket.Upgrader
+	dialer   websocket.Dialer
+	server   *http.Server
+	listener net.Listener
+	connWg   sync.WaitGroup
+
+	conns       sync.Map // *proxyConn -> struct{}
+	routed      sync.Map // 节点ID -> *atomic.Uint64
+	routeErrors atomic.Uint64
+}
+
+// NewGateway 创建网关，authenticator用于从登录令牌中识别玩家ID（只校验签名）
+func NewGateway(addr string, replicas int, authenticator *auth.Authenticator) *Gateway {
+	gateway := &Gateway{
+		addr:          addr,
+		ring:          NewHashRing(replicas),
+		authenticator: authenticator,
+		backends:      make(map[string]string),
+		upgrader: websocket.Upgrader{
+			EnableCompression: true,
+			CheckOrigin: func(r *http.Request) bool {
+				return true
+			},
+		},
+		dialer: websocket.Dialer{
+			HandshakeTimeout:  5 * time.Second,
+			EnableCompression: true,
+		},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws", gateway.handleWebSocket)
+	mux.HandleFunc("/stats", gateway.handleStats)
+	gateway.server = &http.Server{Handler: mux}
+
+	return gateway
+}
+
+// AddNode 添加后端节点并加入路由
+func (g *Gateway) AddNode(nodeID, wsURL string) {
+	g.backendsMu.Lock()
+	g.backends[nodeID] = wsURL
+	g.backendsMu.Unlock()
+
+	g.ring.Add(nodeID)
+}
+
+// RemoveNode 将节点移出路由，已建立的代理连接不受影响
+func (g *Gateway) RemoveNode(nodeID string) {
+	g.ring.Remove(nodeID)
+
+	g.backendsMu.Lock()
+	delete(g.backends, nodeID)
+	g.backendsMu.Unlock()
+}
+
+// Route 查找玩家当前应路由到的节点
+func (g *Gateway) Route(playerID string) (string, bool) {
+	return g.ring.Lookup(playerID)
+}
+
+// Start 启动网关
+func (g *Gateway) Start() error {
+	ln, err := net.Listen("tcp", g.addr)
+	if err != nil {
+		return fmt.Errorf("gateway listen on %s failed: %w", g.addr, err)
+	}
+	g.listener = ln
+
+	go func() {
+		if err := g.server.Serve(ln); err != nil && err != http.ErrServerClosed {
+			log.Printf("Gateway error: %v", err)
+		}
+	}()
+
+	log.Printf("✅ Gateway listening on %s", ln.Addr())
+	return nil
+}
+
+// Shutdown 关闭网关及所有代理连接
+func (g *Gateway) Shutdown(ctx context.Context) error {
+	err := g.server.Shutdown(ctx)
+
+	g.conns.Range(func(key, value interface{}) bool {
+		pc := key.(*proxyConn)
+		closeWith(pc.client, websocket.CloseGoingAway, "gateway shutdown")
+		pc.backend.Close()
+		return true
+	})
+	g.connWg.Wait()
+
+	return err
+}
+
+// Addr 获取网关实际监听地址
+func (g *Gateway) Addr() string {
+	if g.listener != nil {
+		return g.listener.Addr().String()
+	}
+	return g.addr
+}
+
+// URL 获取客户端连接网关使用的WebSocket URL
+func (g *Gateway) URL() string {
+	return fmt.Sprintf("ws://%s/ws", g.Addr())
+}
+
+// Stats 获取网关统计
+func (g *Gateway) Stats() GatewayStats {
+	stats := GatewayStats{
+		Nodes:       g.ring.Nodes(),
+		Routed:      make(map[string]uint64),
+		Active:      make(map[string]int),
+		RouteErrors: g.routeErrors.Load(),
+	}
+	g.routed.Range(func(key, value interface{}) bool {
+		stats.Routed[key.(string)] = value.(*atomic.Uint64).Load()
+		return true
+	})
+	g.conns.Range(func(key, value interface{}) bool {
+		stats.Active[key.(*proxyConn).nodeID]++
+		return true
+	})
+	return stats
+}
+
+// handleStats 处理/stats请求
+func (g *Gateway) handleStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(g.Stats())
+}
+
+// handleWebSocket 接受客户端连接，读取登录帧后选择节点并开始转发
+func (g *Gateway) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	client, err := g.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("Gateway upgrade failed: %v", err)
+		return
+	}
+
+	g.connWg.Add(1)
+	defer g.connWg.Done()
+
+	client.SetReadDeadline(time.Now().Add(10 * time.Second))
+	messageType, loginFrame, err := client.ReadMessage()
+	if err != nil {
+		log.Printf("Gateway read login from %s failed: %v", r.RemoteAddr, err)
+		client.Close()
+		return
+	}
+	client.SetReadDeadline(time.Time{})
+
+	key := g.routeKey(loginFrame, r.RemoteAddr)
+	nodeID, backendURL, ok := g.pick(key)
+	if !ok {
+		g.routeErrors.Add(1)
+		closeWith(client, websocket.CloseTryAgainLater, "no backend available")
+		return
+	}
+
+	backend, resp, err := g.dialer.Dial(backendURL, nil)
+	if resp != nil && resp.Body != nil {
+		resp.Body.Close()
+	}
+	if err != nil {
+		g.routeErrors.Add(1)
+		log.Printf("Gateway dial node %s failed: %v", nodeID, err)
+		closeWith(client, websocket.CloseTryAgainLater, "backend unavailable")
+		return
+	}
+
+	if err := backend.WriteMessage(messageType, loginFrame); err != nil {
+		log.Printf("Gateway forward login to %s failed: %v", nodeID, err)
+		backend.Close()
+		closeWith(client, websocket.CloseTryAgainLater, "backend unavailable")
+		return
+	}
+
+	pc := &proxyConn{nodeID: nodeID, key: key, client: client, backend: backend}
+	g.conns.Store(pc, struct{}{})
+	defer g.conns.Delete(pc)
+
+	counter, _ := g.routed.LoadOrStore(nodeID, &atomic.Uint64{})
+	counter.(*atomic.Uint64).Add(1)
+	log.Printf("Gateway routed %s -> %s", key, nodeID)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		pipe(backend, client)
+	}()
+	pipe(client, backend)
+	<-done
+}
+
+// routeKey 从登录帧中取路由键：优先使用令牌中的玩家ID，否则使用设备ID，都没有时按客户端地址
+func (g *Gateway) routeKey(loginFrame []byte, remoteAddr string) string {
+	opcode, body, err := protocol.DecodeFrame(loginFrame)
+	if err != nil || opcode != protocol.OpLoginReq {
+		return remoteAddr
+	}
+
+	loginReq := &gamev1.LoginReq{}
+	if err := proto.Unmarshal(body, loginReq); err != nil {
+		return remoteAddr
+	}
+
+	if g.authenticator != nil {
+		if claims, err := g.authenticator.Inspect(loginReq.Token); err == nil {
+			return claims.PlayerID()
+		}
+	}
+	if loginReq.DeviceId != "" {
+		return loginReq.DeviceId
+	}
+	return remoteAddr
+}
+
+// pick 按路由键选择节点
+func (g *Gateway) pick(key string) (string, string, bool) {
+	nodeID, ok := g.ring.Lookup(key)
+	if !ok {
+		return "", "", false
+	}
+
+	g.backendsMu.RLock()
+	backendURL, ok := g.backends[nodeID]
+	g.backendsMu.RUnlock()
+	return nodeID, backendURL, ok
+}
+
+// pipe 将src收到的消息转发给dst，src关闭时把关闭码转发给dst并关闭dst
+func pipe(src, dst *websocket.Conn) {
+	for {
+		messageType, data, err := src.ReadMessage()
+		if err != nil {
+			code, text := websocket.CloseGoingAway, "peer gone"
+			var closeErr *websocket.CloseError
+			if errors.As(err, &closeErr) &&
+				closeErr.Code != websocket.CloseNoStatusReceived &&
+				closeErr.Code != websocket.CloseAbnormalClosure {
+				code, text = closeErr.Code, closeErr.Text
+			}
+			closeWith(dst, code, text)
+			return
+		}
+
+		if err := dst.WriteMessage(messageType, data); err != nil {
+			src.Close()
+			return
+		}
+	}
+}
+
+// closeWith 发送关闭帧后关闭连接
+func closeWith(conn *websocket.Conn, code int, text string) {
+	conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, text), time.Now().Add(time.Second))
+	conn.Close()
+}
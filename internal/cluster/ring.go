@@ -0,0 +1,103 @@
+// Package cluster 提供多节点测试集群：若干testserver节点加一个按玩家ID一致性哈希路由的网关，
+// 支持节点排空与滚动重启，用于测试客户端重连和会话恢复
+package cluster
+
+import (
+	"fmt"
+	"hash/crc32"
+	"sort"
+	"sync"
+)
+
+// HashRing 带虚拟节点的一致性哈希环
+type HashRing struct {
+	replicas int               // 每个节点的虚拟节点数
+	points   []uint32          // 排序后的虚拟节点哈希
+	owners   map[uint32]string // 虚拟节点哈希 -> 节点ID
+	nodes    map[string]bool
+	mu       sync.RWMutex
+}
+
+// NewHashRing 创建哈希环，replicas<=0时使用默认的100个虚拟节点
+func NewHashRing(replicas int) *HashRing {
+	if replicas <= 0 {
+		replicas = 100
+	}
+	return &HashRing{
+		replicas: replicas,
+		owners:   make(map[uint32]string),
+		nodes:    make(map[string]bool),
+	}
+}
+
+// Add 添加节点，重复添加无效果
+func (r *HashRing) Add(nodeID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.nodes[nodeID] {
+		return
+	}
+	r.nodes[nodeID] = true
+
+	for i := 0; i < r.replicas; i++ {
+		point := crc32.ChecksumIEEE([]byte(fmt.Sprintf("%s#%d", nodeID, i)))
+		if _, taken := r.owners[point]; taken {
+			continue // 极少见的哈希碰撞，保留先加入的节点
+		}
+		r.owners[point] = nodeID
+		r.points = append(r.points, point)
+	}
+	sort.Slice(r.points, func(i, j int) bool { return r.points[i] < r.points[j] })
+}
+
+// Remove 移除节点，原属于该节点的键顺延到环上的下一个节点，其他键不受影响
+func (r *HashRing) Remove(nodeID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.nodes[nodeID] {
+		return
+	}
+	delete(r.nodes, nodeID)
+
+	points := r.points[:0]
+	for _, point := range r.points {
+		if r.owners[point] == nodeID {
+			delete(r.owners, point)
+			continue
+		}
+		points = append(points, point)
+	}
+	r.points = points
+}
+
+// Lookup 查找键所属的节点，环为空时返回false
+func (r *HashRing) Lookup(key string) (string, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if len(r.points) == 0 {
+		return "", false
+	}
+
+	hash := crc32.ChecksumIEEE([]byte(key))
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i] >= hash })
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.owners[r.points[i]], true
+}
+
+// Nodes 获取环上的节点ID（已排序）
+func (r *HashRing) Nodes() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	nodes := make([]string, 0, len(r.nodes))
+	for nodeID := range r.nodes {
+		nodes = append(nodes, nodeID)
+	}
+	sort.Strings(nodes)
+	return nodes
+}
@@ -100,6 +100,8 @@ type AssertionConfig struct {
 	Latency      LatencyAssertionConfig      `yaml:"latency"`
 	Reconnect    ReconnectAssertionConfig    `yaml:"reconnect"`
 	ErrorRate    ErrorRateAssertionConfig    `yaml:"error_rate"`
+	// SuiteFile YAML断言套件文件，设置后代替上面的内置断言配置
+	SuiteFile string `yaml:"suite_file" mapstructure:"suite_file"`
 }
 
 // MessageOrderAssertionConfig 消息顺序断言配置
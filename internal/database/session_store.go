@@ -0,0 +1,479 @@
+package database
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+
+	"GoSlgBenchmarkTest/internal/db"
+	"GoSlgBenchmarkTest/internal/protocol"
+	"GoSlgBenchmarkTest/internal/session"
+)
+
+// RecordingTestType 持久化录制时自动创建的tests记录类型
+const RecordingTestType = "session_recording"
+
+// SessionPersisterOptions 会话持久化选项
+type SessionPersisterOptions struct {
+	TestID        int64                  // 关联的tests记录，0表示自动创建一条session_recording类型的测试
+	ClientType    string                 // test_sessions.client_type，如 recording-proxy、unity-recorder
+	ClientInfo    map[string]interface{} // test_sessions.client_info
+	BatchSize     int                    // 每次COPY写入的最大行数，缓冲达到该数量时立即写入
+	FlushInterval time.Duration          // 未攒满一批时的最长写入间隔
+}
+
+// DefaultSessionPersisterOptions 默认持久化选项
+func DefaultSessionPersisterOptions() *SessionPersisterOptions {
+	return &SessionPersisterOptions{
+		BatchSize:     500,
+		FlushInterval: time.Second,
+	}
+}
+
+// SessionPersister 将录制器的事件和帧分批写入test_sessions、session_events和session_messages表。
+// 实现session.SessionSink，通过SessionRecorder.StreamTo接入；写入在后台协程中进行，不阻塞录制
+type SessionPersister struct {
+	queries *db.Queries
+	options SessionPersisterOptions
+	row     db.TestSession
+	ownTest bool
+
+	mu       sync.Mutex
+	events   []db.CopySessionEventsParams
+	messages []db.CopySessionMessagesParams
+	stats    *session.SessionStats
+	err      error // 写入错误，出现后停止接收和写入缓冲
+	failure  error // 调用方标记的失败原因，只用于关闭时把测试标记为失败
+	closed   bool
+
+	// 已写入的统计，仅由写入协程访问
+	persistedMessages int64
+	bytesTransfer     int64
+	connections       int32
+	lastTimestamp     time.Time
+
+	flushCh chan struct{}
+	stopCh  chan struct{}
+	done    chan struct{}
+}
+
+// NewSessionPersister 创建test_sessions记录并启动后台写入
+func NewSessionPersister(ctx context.Context, queries *db.Queries, sessionID string, startTime time.Time, options *SessionPersisterOptions) (*SessionPersister, error) {
+	if options == nil {
+		options = DefaultSessionPersisterOptions()
+	}
+	p := &SessionPersister{
+		queries: queries,
+		options: *options,
+		flushCh: make(chan struct{}, 1),
+		stopCh:  make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	if p.options.BatchSize <= 0 {
+		p.options.BatchSize = 500
+	}
+	if p.options.FlushInterval <= 0 {
+		p.options.FlushInterval = time.Second
+	}
+
+	testID := p.options.TestID
+	if testID == 0 {
+		test, err := queries.CreateTest(ctx, db.CreateTestParams{
+			Name:   sessionID,
+			Type:   RecordingTestType,
+			Status: "running",
+		})
+		if err != nil {
+			return nil, fmt.Errorf("create test for session %s: %w", sessionID, err)
+		}
+		testID = test.ID
+		p.ownTest = true
+	}
+
+	var clientInfo []byte
+	if p.options.ClientInfo != nil {
+		data, err := json.Marshal(p.options.ClientInfo)
+		if err != nil {
+			return nil, fmt.Errorf("marshal client info: %w", err)
+		}
+		clientInfo = data
+	}
+
+	row, err := queries.CreateTestSession(ctx, db.CreateTestSessionParams{
+		TestID:     testID,
+		SessionID:  sessionID,
+		ClientType: pgtype.Text{String: p.options.ClientType, Valid: p.options.ClientType != ""},
+		ClientInfo: clientInfo,
+		StartTime:  pgtype.Timestamptz{Time: startTime, Valid: true},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create test session %s: %w", sessionID, err)
+	}
+	p.row = row
+
+	go p.loop()
+	return p, nil
+}
+
+// Row 持久化的test_sessions记录
+func (p *SessionPersister) Row() db.TestSession {
+	return p.row
+}
+
+// WriteEvent 缓冲一个事件
+func (p *SessionPersister) WriteEvent(event *session.SessionEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("marshal event %s: %w", event.ID, err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.writableLocked(); err != nil {
+		return err
+	}
+	p.events = append(p.events, db.CopySessionEventsParams{
+		SessionID: p.row.ID,
+		EventType: string(event.Type),
+		EventData: data,
+		Timestamp: pgtype.Timestamptz{Time: event.Timestamp, Valid: true},
+	})
+	p.signalLocked()
+	return nil
+}
+
+// WriteFrame 缓冲一帧消息
+func (p *SessionPersister) WriteFrame(frame *session.MessageFrame) error {
+	hash := sha256.Sum256(frame.RawData)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.writableLocked(); err != nil {
+		return err
+	}
+	p.messages = append(p.messages, db.CopySessionMessagesParams{
+		SessionID:   p.row.ID,
+		Direction:   frame.Direction,
+		Opcode:      pgtype.Int4{Int32: int32(frame.Opcode), Valid: true},
+		MessageSize: pgtype.Int4{Int32: int32(len(frame.RawData)), Valid: true},
+		BodySize:    pgtype.Int4{Int32: int32(len(frame.Body)), Valid: true},
+		SequenceNum: pgtype.Int8{Int64: int64(frame.SequenceNum), Valid: frame.SequenceNum != 0},
+		MessageHash: pgtype.Text{String: hex.EncodeToString(hash[:]), Valid: true},
+		RawData:     frame.RawData,
+		Timestamp:   pgtype.Timestamptz{Time: frame.Timestamp, Valid: true},
+	})
+	p.signalLocked()
+	return nil
+}
+
+// WriteSession 缓冲整个会话的事件和帧
+func (p *SessionPersister) WriteSession(recorded *session.Session) error {
+	for _, event := range recorded.Events {
+		if err := p.WriteEvent(event); err != nil {
+			return err
+		}
+	}
+	for _, frame := range recorded.Frames {
+		if err := p.WriteFrame(frame); err != nil {
+			return err
+		}
+	}
+	if recorded.Stats != nil {
+		p.SetStats(recorded.Stats)
+	}
+	return nil
+}
+
+// SetStats 设置录制结束时的统计，关闭时写入test_sessions
+func (p *SessionPersister) SetStats(stats *session.SessionStats) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.stats = stats
+}
+
+// Err 后台写入遇到的第一个错误
+func (p *SessionPersister) Err() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}
+
+// Fail 将录制标记为失败（如连接服务器失败、断言失败），缓冲照常写入，Close时自动创建的测试以该原因结束
+func (p *SessionPersister) Fail(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.failure == nil {
+		p.failure = err
+	}
+}
+
+// Close 写入剩余的缓冲并更新test_sessions的统计；自动创建的测试同时标记为完成或失败
+func (p *SessionPersister) Close(ctx context.Context) error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return p.Err()
+	}
+	p.closed = true
+	p.mu.Unlock()
+
+	close(p.stopCh)
+	<-p.done
+	p.flush(ctx)
+
+	p.mu.Lock()
+	stats := p.stats
+	flushErr := p.err
+	failure := p.failure
+	p.mu.Unlock()
+	if flushErr != nil {
+		failure = flushErr
+	}
+
+	endTime := p.lastTimestamp
+	if stats != nil && !stats.EndTime.IsZero() {
+		endTime = stats.EndTime
+	}
+	params := db.UpdateTestSessionParams{
+		ID:              p.row.ID,
+		EndTime:         pgtype.Timestamptz{Time: endTime, Valid: !endTime.IsZero()},
+		ConnectionCount: pgtype.Int4{Int32: p.connections, Valid: true},
+		MessageCount:    pgtype.Int4{Int32: int32(p.persistedMessages), Valid: true},
+		BytesTransfer:   pgtype.Int8{Int64: p.bytesTransfer, Valid: true},
+		AvgLatency:      pgtype.Int8{Valid: true},
+		MinLatency:      pgtype.Int8{Valid: true},
+		MaxLatency:      pgtype.Int8{Valid: true},
+		ErrorCount:      pgtype.Int4{Valid: true},
+		ReconnectCount:  pgtype.Int4{Valid: true},
+	}
+	if stats != nil {
+		params.AvgLatency.Int64 = int64(stats.AverageLatency)
+		params.MinLatency.Int64 = int64(stats.MinLatency)
+		params.MaxLatency.Int64 = int64(stats.MaxLatency)
+		params.ErrorCount.Int32 = int32(stats.ErrorCount)
+		params.ReconnectCount.Int32 = int32(stats.ReconnectCount)
+	}
+	row, err := p.queries.UpdateTestSession(ctx, params)
+	if err != nil {
+		return fmt.Errorf("update test session %s: %w", p.row.SessionID, err)
+	}
+	p.row = row
+
+	if p.ownTest {
+		status := "completed"
+		errorMessage := pgtype.Text{}
+		if failure != nil {
+			status = "failed"
+			errorMessage = pgtype.Text{String: failure.Error(), Valid: true}
+		}
+		_, err := p.queries.UpdateTest(ctx, db.UpdateTestParams{
+			ID:           row.TestID,
+			Status:       status,
+			StartTime:    row.StartTime,
+			EndTime:      row.EndTime,
+			Duration:     pgtype.Int8{Int64: endTime.Sub(row.StartTime.Time).Milliseconds(), Valid: row.EndTime.Valid},
+			ErrorMessage: errorMessage,
+		})
+		if err != nil {
+			return fmt.Errorf("update test %d: %w", row.TestID, err)
+		}
+	}
+	return flushErr
+}
+
+// writableLocked 检查是否还能接收写入，调用方需持有锁
+func (p *SessionPersister) writableLocked() error {
+	if p.err != nil {
+		return p.err
+	}
+	if p.closed {
+		return fmt.Errorf("session persister for %s is closed", p.row.SessionID)
+	}
+	return nil
+}
+
+// signalLocked 缓冲攒满一批时唤醒写入协程，调用方需持有锁
+func (p *SessionPersister) signalLocked() {
+	if len(p.events) >= p.options.BatchSize || len(p.messages) >= p.options.BatchSize {
+		select {
+		case p.flushCh <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// loop 按批量大小或时间间隔写入缓冲
+func (p *SessionPersister) loop() {
+	defer close(p.done)
+
+	ticker := time.NewTicker(p.options.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.flushCh:
+		case <-ticker.C:
+		case <-p.stopCh:
+			return
+		}
+		p.flush(context.Background())
+	}
+}
+
+// flush 按批量大小用COPY写入当前缓冲的事件和帧，失败后停止接收写入
+func (p *SessionPersister) flush(ctx context.Context) {
+	p.mu.Lock()
+	events, messages := p.events, p.messages
+	p.events, p.messages = nil, nil
+	failed := p.err != nil
+	p.mu.Unlock()
+	if failed {
+		return
+	}
+
+	for start := 0; start < len(events); start += p.options.BatchSize {
+		batch := events[start:min(start+p.options.BatchSize, len(events))]
+		if _, err := p.queries.CopySessionEvents(ctx, batch); err != nil {
+			p.fail(fmt.Errorf("copy %d session events: %w", len(batch), err))
+			return
+		}
+		for _, event := range batch {
+			if event.EventType == string(session.EventConnect) || event.EventType == string(session.EventReconnect) {
+				p.connections++
+			}
+			if event.Timestamp.Time.After(p.lastTimestamp) {
+				p.lastTimestamp = event.Timestamp.Time
+			}
+		}
+	}
+	for start := 0; start < len(messages); start += p.options.BatchSize {
+		batch := messages[start:min(start+p.options.BatchSize, len(messages))]
+		if _, err := p.queries.CopySessionMessages(ctx, batch); err != nil {
+			p.fail(fmt.Errorf("copy %d session messages: %w", len(batch), err))
+			return
+		}
+		p.persistedMessages += int64(len(batch))
+		for _, message := range batch {
+			p.bytesTransfer += int64(len(message.RawData))
+			if message.Timestamp.Time.After(p.lastTimestamp) {
+				p.lastTimestamp = message.Timestamp.Time
+			}
+		}
+	}
+}
+
+// fail 记录第一个写入错误
+func (p *SessionPersister) fail(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err == nil {
+		p.err = err
+	}
+}
+
+// PersistSession 将已录制的会话（如加载的JSON导出）写入数据库，返回test_sessions记录
+func PersistSession(ctx context.Context, queries *db.Queries, recorded *session.Session, options *SessionPersisterOptions) (db.TestSession, error) {
+	persister, err := NewSessionPersister(ctx, queries, recorded.ID, recorded.StartTime, options)
+	if err != nil {
+		return db.TestSession{}, err
+	}
+	writeErr := persister.WriteSession(recorded)
+	if err := persister.Close(ctx); err != nil {
+		return persister.Row(), err
+	}
+	return persister.Row(), writeErr
+}
+
+// LoadSession 从数据库重建会话，sessionID为录制时的会话ID
+func LoadSession(ctx context.Context, queries *db.Queries, sessionID string) (*session.Session, error) {
+	row, err := queries.GetTestSession(ctx, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("get test session %s: %w", sessionID, err)
+	}
+	return LoadSessionRow(ctx, queries, row)
+}
+
+// LoadSessionRow 从test_sessions记录及其事件和消息重建会话，帧的消息体从原始字节解出；
+// 记录时解码的消息类型和JSON内容不入库，需要时调用session.DecodeSessionPayloads重新解码
+func LoadSessionRow(ctx context.Context, queries *db.Queries, row db.TestSession) (*session.Session, error) {
+	eventRows, err := queries.ListSessionEvents(ctx, row.ID)
+	if err != nil {
+		return nil, fmt.Errorf("list events of session %s: %w", row.SessionID, err)
+	}
+	messageRows, err := queries.ListSessionMessages(ctx, row.ID)
+	if err != nil {
+		return nil, fmt.Errorf("list messages of session %s: %w", row.SessionID, err)
+	}
+
+	recorded := &session.Session{
+		SchemaVersion: session.CurrentSchemaVersion,
+		ID:            row.SessionID,
+		StartTime:     row.StartTime.Time,
+		EndTime:       row.EndTime.Time,
+		Events:        make([]*session.SessionEvent, 0, len(eventRows)),
+		Frames:        make([]*session.MessageFrame, 0, len(messageRows)),
+	}
+	for _, eventRow := range eventRows {
+		event := &session.SessionEvent{}
+		if len(eventRow.EventData) > 0 {
+			if err := json.Unmarshal(eventRow.EventData, event); err != nil {
+				return nil, fmt.Errorf("decode event %d of session %s: %w", eventRow.ID, row.SessionID, err)
+			}
+		}
+		event.Type = session.EventType(eventRow.EventType)
+		event.Timestamp = eventRow.Timestamp.Time
+		recorded.Events = append(recorded.Events, event)
+	}
+
+	stats := &session.SessionStats{
+		StartTime:          row.StartTime.Time,
+		EndTime:            row.EndTime.Time,
+		TotalEvents:        int64(len(eventRows)),
+		ReconnectCount:     int64(row.ReconnectCount.Int32),
+		ErrorCount:         int64(row.ErrorCount.Int32),
+		AverageLatency:     time.Duration(row.AvgLatency.Int64),
+		MinLatency:         time.Duration(row.MinLatency.Int64),
+		MaxLatency:         time.Duration(row.MaxLatency.Int64),
+		LatencyPercentiles: make(map[int]time.Duration),
+	}
+	if row.EndTime.Valid {
+		stats.Duration = row.EndTime.Time.Sub(row.StartTime.Time)
+	}
+	for _, messageRow := range messageRows {
+		frame := &session.MessageFrame{
+			RawData:     messageRow.RawData,
+			Opcode:      uint16(messageRow.Opcode.Int32),
+			Body:        messageRow.RawData,
+			Timestamp:   messageRow.Timestamp.Time,
+			Direction:   messageRow.Direction,
+			SequenceNum: uint64(messageRow.SequenceNum.Int64),
+		}
+		// opcode为0的是代理记录的非协议帧，消息体即原始字节
+		if frame.Opcode != 0 {
+			if _, body, err := protocol.DecodeFrame(frame.RawData); err == nil {
+				frame.Body = body
+			}
+		}
+		recorded.Frames = append(recorded.Frames, frame)
+
+		if frame.Direction == "send" {
+			stats.MessagesSent++
+			stats.BytesSent += int64(len(frame.RawData))
+		} else {
+			stats.MessagesReceived++
+			stats.BytesReceived += int64(len(frame.RawData))
+		}
+	}
+	recorded.Stats = stats
+
+	if err := session.ValidateSession(recorded); err != nil {
+		return nil, err
+	}
+	return recorded, nil
+}
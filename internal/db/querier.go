@@ -9,6 +9,8 @@ import (
 )
 
 type Querier interface {
+	CopySessionEvents(ctx context.Context, arg []CopySessionEventsParams) (int64, error)
+	CopySessionMessages(ctx context.Context, arg []CopySessionMessagesParams) (int64, error)
 	CountSessionMessages(ctx context.Context, sessionID int64) (int64, error)
 	CountTests(ctx context.Context, arg CountTestsParams) (int64, error)
 	CreateSLGBattle(ctx context.Context, arg CreateSLGBattleParams) (SlgBattleRecord, error)
@@ -41,6 +43,8 @@ type Querier interface {
 	GetUnityClientStats(ctx context.Context, testID int64) (GetUnityClientStatsRow, error)
 	GetUnityClients(ctx context.Context, testID int64) ([]UnityClientRecord, error)
 	IncrementActionCount(ctx context.Context, arg IncrementActionCountParams) error
+	ListSessionEvents(ctx context.Context, sessionID int64) ([]SessionEvent, error)
+	ListSessionMessages(ctx context.Context, sessionID int64) ([]SessionMessage, error)
 	UpdateSLGBattle(ctx context.Context, arg UpdateSLGBattleParams) (SlgBattleRecord, error)
 	UpdateTest(ctx context.Context, arg UpdateTestParams) (Test, error)
 	UpdateTestSession(ctx context.Context, arg UpdateTestSessionParams) (TestSession, error)
@@ -11,6 +11,13 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+type CopySessionEventsParams struct {
+	SessionID int64              `json:"session_id"`
+	EventType string             `json:"event_type"`
+	EventData []byte             `json:"event_data"`
+	Timestamp pgtype.Timestamptz `json:"timestamp"`
+}
+
 const createSessionEvent = `-- name: CreateSessionEvent :one
 INSERT INTO session_events (
     session_id, event_type, event_data, timestamp
@@ -115,3 +122,36 @@ func (q *Queries) GetSessionEventsByType(ctx context.Context, arg GetSessionEven
 	}
 	return items, nil
 }
+
+const listSessionEvents = `-- name: ListSessionEvents :many
+SELECT id, session_id, event_type, event_data, timestamp, created_at FROM session_events
+WHERE session_id = $1
+ORDER BY id
+`
+
+func (q *Queries) ListSessionEvents(ctx context.Context, sessionID int64) ([]SessionEvent, error) {
+	rows, err := q.db.Query(ctx, listSessionEvents, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []SessionEvent{}
+	for rows.Next() {
+		var i SessionEvent
+		if err := rows.Scan(
+			&i.ID,
+			&i.SessionID,
+			&i.EventType,
+			&i.EventData,
+			&i.Timestamp,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
@@ -22,6 +22,18 @@ func (q *Queries) CountSessionMessages(ctx context.Context, sessionID int64) (in
 	return count, err
 }
 
+type CopySessionMessagesParams struct {
+	SessionID   int64              `json:"session_id"`
+	Direction   string             `json:"direction"`
+	Opcode      pgtype.Int4        `json:"opcode"`
+	MessageSize pgtype.Int4        `json:"message_size"`
+	BodySize    pgtype.Int4        `json:"body_size"`
+	SequenceNum pgtype.Int8        `json:"sequence_num"`
+	MessageHash pgtype.Text        `json:"message_hash"`
+	RawData     []byte             `json:"raw_data"`
+	Timestamp   pgtype.Timestamptz `json:"timestamp"`
+}
+
 const createSessionMessage = `-- name: CreateSessionMessage :one
 INSERT INTO session_messages (
     session_id, direction, opcode, message_size, body_size, 
@@ -159,3 +171,41 @@ func (q *Queries) GetSessionMessagesByDirection(ctx context.Context, arg GetSess
 	}
 	return items, nil
 }
+
+const listSessionMessages = `-- name: ListSessionMessages :many
+SELECT id, session_id, direction, opcode, message_size, body_size, sequence_num, message_hash, raw_data, timestamp, created_at FROM session_messages
+WHERE session_id = $1
+ORDER BY id
+`
+
+func (q *Queries) ListSessionMessages(ctx context.Context, sessionID int64) ([]SessionMessage, error) {
+	rows, err := q.db.Query(ctx, listSessionMessages, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []SessionMessage{}
+	for rows.Next() {
+		var i SessionMessage
+		if err := rows.Scan(
+			&i.ID,
+			&i.SessionID,
+			&i.Direction,
+			&i.Opcode,
+			&i.MessageSize,
+			&i.BodySize,
+			&i.SequenceNum,
+			&i.MessageHash,
+			&i.RawData,
+			&i.Timestamp,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
@@ -5,11 +5,14 @@ import (
 	"fmt"
 	"log"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 
+	"GoSlgBenchmarkTest/internal/auth"
+	"GoSlgBenchmarkTest/internal/protocol"
 	gamev1 "GoSlgBenchmarkTest/proto/game/v1"
 )
 
@@ -26,6 +29,19 @@ type GameServer struct {
 	requestCount int64
 	startTime    time.Time
 	mu           sync.RWMutex
+
+	// Prometheus指标，通过ServerOptions挂载拦截器后采集
+	metrics *grpcMetrics
+
+	// 令牌认证器，为nil时接受任意非空令牌
+	auth *auth.Authenticator
+
+	// 重复登录：loginMu保证同一玩家的在线检查与会话登记原子，并保护kickWatchers
+	loginPolicy  protocol.DuplicateLoginPolicy
+	loginMu      sync.Mutex
+	kicked       sync.Map                                         // 被踢的会话ID -> protocol.KickReason
+	kickWatchers map[string]map[chan protocol.KickReason]struct{} // 玩家ID -> 事件流的踢下线通知
+	kickCount    atomic.Uint64
 }
 
 type PlayerData struct {
@@ -57,9 +73,25 @@ type SessionData struct {
 
 // NewGameServer 创建新的游戏服务器实例
 func NewGameServer() *GameServer {
-	return &GameServer{
-		startTime: time.Now(),
+	server := &GameServer{
+		startTime:    time.Now(),
+		loginPolicy:  protocol.DuplicateLoginAllow,
+		kickWatchers: make(map[string]map[chan protocol.KickReason]struct{}),
 	}
+	server.metrics = newGRPCMetrics(server)
+	return server
+}
+
+// SetAuthenticator 设置令牌认证器，之后登录必须使用其签发的有效令牌
+func (s *GameServer) SetAuthenticator(authenticator *auth.Authenticator) {
+	s.auth = authenticator
+}
+
+// SetDuplicateLoginPolicy 设置重复登录策略，默认allow
+func (s *GameServer) SetDuplicateLoginPolicy(policy protocol.DuplicateLoginPolicy) {
+	s.loginMu.Lock()
+	defer s.loginMu.Unlock()
+	s.loginPolicy = policy
 }
 
 // Login 用户登录
@@ -73,8 +105,21 @@ func (s *GameServer) Login(ctx context.Context, req *gamev1.LoginReq) (*gamev1.L
 	time.Sleep(2 * time.Millisecond)
 
 	playerID := fmt.Sprintf("player_%s", req.Token)
+	if s.auth != nil {
+		claims, err := s.auth.Verify(req.Token)
+		if err != nil {
+			return nil, status.Errorf(codes.Unauthenticated, "invalid token: %v", err)
+		}
+		playerID = claims.PlayerID()
+	}
 	sessionID := fmt.Sprintf("session_%d", time.Now().UnixNano())
 
+	s.loginMu.Lock()
+	defer s.loginMu.Unlock()
+	if err := s.applyLoginPolicy(playerID); err != nil {
+		return nil, err
+	}
+
 	// 存储会话信息
 	s.sessions.Store(sessionID, &SessionData{
 		SessionID:    sessionID,
@@ -102,8 +147,73 @@ func (s *GameServer) Login(ctx context.Context, req *gamev1.LoginReq) (*gamev1.L
 	}, nil
 }
 
+// applyLoginPolicy 按重复登录策略处理玩家已有的会话，调用方需持有loginMu
+func (s *GameServer) applyLoginPolicy(playerID string) error {
+	if s.loginPolicy == protocol.DuplicateLoginAllow {
+		return nil
+	}
+
+	var active []string
+	s.sessions.Range(func(key, value interface{}) bool {
+		if value.(*SessionData).PlayerID == playerID {
+			active = append(active, key.(string))
+		}
+		return true
+	})
+	if len(active) == 0 {
+		return nil
+	}
+
+	if s.loginPolicy == protocol.DuplicateLoginRejectNew {
+		return status.Errorf(codes.AlreadyExists, "%s: player %s is already online", protocol.KickLoginConflict, playerID)
+	}
+
+	// kick_old：旧会话失效，已打开的玩家事件流收到踢下线事件后结束
+	for _, sessionID := range active {
+		s.sessions.Delete(sessionID)
+		s.kicked.Store(sessionID, protocol.KickDuplicateLogin)
+		s.kickCount.Add(1)
+	}
+	for watcher := range s.kickWatchers[playerID] {
+		select {
+		case watcher <- protocol.KickDuplicateLogin:
+		default:
+		}
+	}
+	log.Printf("Kicked %d sessions of %s: %s", len(active), playerID, protocol.KickDuplicateLogin)
+	return nil
+}
+
+// watchKick 注册玩家的踢下线通知，返回的函数用于注销
+func (s *GameServer) watchKick(playerID string) (<-chan protocol.KickReason, func()) {
+	watcher := make(chan protocol.KickReason, 1)
+
+	s.loginMu.Lock()
+	if s.kickWatchers[playerID] == nil {
+		s.kickWatchers[playerID] = make(map[chan protocol.KickReason]struct{})
+	}
+	s.kickWatchers[playerID][watcher] = struct{}{}
+	s.loginMu.Unlock()
+
+	return watcher, func() {
+		s.loginMu.Lock()
+		delete(s.kickWatchers[playerID], watcher)
+		if len(s.kickWatchers[playerID]) == 0 {
+			delete(s.kickWatchers, playerID)
+		}
+		s.loginMu.Unlock()
+	}
+}
+
 // Logout 用户登出
 func (s *GameServer) Logout(ctx context.Context, req *gamev1.LogoutReq) (*gamev1.LogoutResp, error) {
+	if reason, ok := s.kicked.LoadAndDelete(req.SessionId); ok {
+		return &gamev1.LogoutResp{
+			Success: false,
+			Message: fmt.Sprintf("session was kicked: %s", reason.(protocol.KickReason)),
+		}, nil
+	}
+
 	if session, ok := s.sessions.Load(req.SessionId); ok {
 		sessionData := session.(*SessionData)
 		// 更新玩家状态
@@ -129,6 +239,19 @@ func (s *GameServer) RefreshToken(ctx context.Context, req *gamev1.RefreshTokenR
 		return nil, status.Error(codes.Unauthenticated, "refresh token is required")
 	}
 
+	if s.auth != nil {
+		accessToken, refreshToken, err := s.auth.Refresh(req.RefreshToken)
+		if err != nil {
+			return nil, status.Errorf(codes.Unauthenticated, "invalid refresh token: %v", err)
+		}
+		return &gamev1.RefreshTokenResp{
+			Success:      true,
+			AccessToken:  accessToken,
+			RefreshToken: refreshToken,
+			ExpiresAt:    time.Now().Add(s.auth.AccessTTL()).UnixMilli(),
+		}, nil
+	}
+
 	newAccessToken := fmt.Sprintf("access_%d", time.Now().UnixNano())
 	newRefreshToken := fmt.Sprintf("refresh_%d", time.Now().UnixNano())
 
@@ -389,10 +512,24 @@ func (s *GameServer) StreamPlayerEvents(req *gamev1.PlayerEventStreamReq, stream
 
 	eventTypes := []string{"level_up", "item_received", "achievement", "friend_request"}
 
+	kicks, unwatch := s.watchKick(req.PlayerId)
+	defer unwatch()
+
 	for {
 		select {
 		case <-stream.Context().Done():
 			return nil
+		case reason := <-kicks:
+			event := &gamev1.PlayerEventPush{
+				PlayerId:  req.PlayerId,
+				EventType: "kicked",
+				EventData: fmt.Sprintf(`{"reason":"%s","code":%d}`, reason, int32(reason)),
+				Timestamp: time.Now().UnixMilli(),
+			}
+			if err := stream.Send(event); err != nil {
+				return err
+			}
+			return status.Errorf(codes.Aborted, "kicked: %s", reason)
 		case <-ticker.C:
 			eventType := eventTypes[time.Now().Unix()%int64(len(eventTypes))]
 
@@ -523,5 +660,6 @@ func (s *GameServer) GetStats() map[string]interface{} {
 		"active_battles":  battleCount,
 		"active_sessions": sessionCount,
 		"request_count":   s.requestCount,
+		"kicked_sessions": s.kickCount.Load(),
 	}
 }
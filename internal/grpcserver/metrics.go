@@ -0,0 +1,131 @@
+package grpcserver
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+
+	"GoSlgBenchmarkTest/internal/metrics"
+)
+
+// grpcMetrics gRPC游戏服务器的Prometheus指标
+type grpcMetrics struct {
+	registry        *metrics.Registry
+	requestsTotal   *metrics.CounterVec
+	requestDuration *metrics.HistogramVec
+	activeStreams   *metrics.GaugeVec
+	streamMessages  *metrics.CounterVec
+}
+
+// newGRPCMetrics 创建并注册gRPC指标
+func newGRPCMetrics(s *GameServer) *grpcMetrics {
+	registry := metrics.NewRegistry()
+
+	m := &grpcMetrics{
+		registry: registry,
+		requestsTotal: registry.Counter("slg_grpc_requests_total",
+			"gRPC calls by full method name and status code.", "method", "code"),
+		requestDuration: registry.Histogram("slg_grpc_request_duration_seconds",
+			"gRPC call latency by full method name; streams measure their whole lifetime.", nil, "method"),
+		activeStreams: registry.Gauge("slg_grpc_active_streams",
+			"Open server streams by full method name.", "method"),
+		streamMessages: registry.Counter("slg_grpc_stream_messages_sent_total",
+			"Messages sent on server streams by full method name.", "method"),
+	}
+
+	registry.GaugeFunc("slg_grpc_active_sessions", "Sessions stored by the game server.", func() float64 {
+		return float64(countEntries(&s.sessions))
+	})
+	registry.GaugeFunc("slg_grpc_active_battles", "Battles stored by the game server.", func() float64 {
+		return float64(countEntries(&s.battles))
+	})
+	registry.GaugeFunc("slg_grpc_uptime_seconds", "Seconds since the server was created.", func() float64 {
+		return time.Since(s.startTime).Seconds()
+	})
+
+	return m
+}
+
+// UnaryInterceptor 返回记录请求数与延迟的一元拦截器
+func (s *GameServer) UnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		s.observeCall(info.FullMethod, err, time.Since(start))
+		return resp, err
+	}
+}
+
+// StreamInterceptor 返回记录流生命周期与发送消息数的流拦截器
+func (s *GameServer) StreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		active := s.metrics.activeStreams.WithLabelValues(info.FullMethod)
+		active.Inc()
+		defer active.Dec()
+
+		start := time.Now()
+		err := handler(srv, &countingStream{
+			ServerStream: stream,
+			sent:         s.metrics.streamMessages.WithLabelValues(info.FullMethod),
+		})
+		s.observeCall(info.FullMethod, err, time.Since(start))
+		return err
+	}
+}
+
+// ServerOptions 返回挂载指标拦截器的服务器选项
+func (s *GameServer) ServerOptions() []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(s.UnaryInterceptor()),
+		grpc.ChainStreamInterceptor(s.StreamInterceptor()),
+	}
+}
+
+// MetricsHandler 返回/metrics的HTTP处理器
+func (s *GameServer) MetricsHandler() http.Handler {
+	return s.metrics.registry.Handler()
+}
+
+// GetMetrics 获取指标注册表
+func (s *GameServer) GetMetrics() *metrics.Registry {
+	return s.metrics.registry
+}
+
+// observeCall 记录一次调用
+func (s *GameServer) observeCall(method string, err error, elapsed time.Duration) {
+	s.mu.Lock()
+	s.requestCount++
+	s.mu.Unlock()
+
+	s.metrics.requestsTotal.WithLabelValues(method, status.Code(err).String()).Inc()
+	s.metrics.requestDuration.WithLabelValues(method).ObserveDuration(elapsed)
+}
+
+// countingStream 统计发送消息数的服务端流
+type countingStream struct {
+	grpc.ServerStream
+	sent *metrics.Counter
+}
+
+// SendMsg 发送消息并计数
+func (c *countingStream) SendMsg(m interface{}) error {
+	err := c.ServerStream.SendMsg(m)
+	if err == nil {
+		c.sent.Inc()
+	}
+	return err
+}
+
+// countEntries 统计sync.Map中的条目数
+func countEntries(m *sync.Map) int {
+	count := 0
+	m.Range(func(key, value interface{}) bool {
+		count++
+		return true
+	})
+	return count
+}
@@ -12,6 +12,9 @@ import (
 
 	"github.com/gorilla/mux"
 	"github.com/rs/cors"
+
+	"GoSlgBenchmarkTest/internal/auth"
+	"GoSlgBenchmarkTest/internal/metrics"
 )
 
 // APIServer HTTP API服务器（用于压测）
@@ -28,6 +31,14 @@ type APIServer struct {
 	errorCount   int64
 	startTime    time.Time
 	mu           sync.RWMutex
+
+	// 令牌签发与校验
+	auth *auth.Authenticator
+
+	// Prometheus指标
+	registry        *metrics.Registry
+	requestsTotal   *metrics.CounterVec
+	requestDuration *metrics.HistogramVec
 }
 
 // PlayerAPIData HTTP API的玩家数据结构
@@ -106,8 +117,10 @@ func NewAPIServer(addr string) *APIServer {
 	server := &APIServer{
 		router:    mux.NewRouter(),
 		startTime: time.Now(),
+		auth:      auth.New(auth.DefaultConfig()),
 	}
 
+	server.setupMetrics()
 	server.setupRoutes()
 
 	// 设置CORS
@@ -134,6 +147,14 @@ func (s *APIServer) setupRoutes() {
 	// 添加中间件
 	s.router.Use(s.loggingMiddleware)
 	s.router.Use(s.metricsMiddleware)
+	// 未匹配的请求不经过路由中间件，单独计入unmatched
+	s.router.NotFoundHandler = s.metricsMiddleware(http.NotFoundHandler())
+	s.router.MethodNotAllowedHandler = s.metricsMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}))
+
+	// Prometheus文本格式指标
+	s.router.Handle("/metrics", s.registry.Handler()).Methods("GET")
 
 	// API路由
 	api := s.router.PathPrefix("/api/v1").Subrouter()
@@ -205,9 +226,20 @@ func (s *APIServer) loggingMiddleware(next http.Handler) http.Handler {
 func (s *APIServer) metricsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
-		next.ServeHTTP(w, r)
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
 		duration := time.Since(start)
 
+		// 未匹配路由时使用固定标签，避免每个不同的URL产生新的时间序列
+		route := unmatchedRoute
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+		s.requestsTotal.WithLabelValues(r.Method, route, strconv.Itoa(recorder.status)).Inc()
+		s.requestDuration.WithLabelValues(r.Method, route).ObserveDuration(duration)
+
 		s.mu.Lock()
 		s.requestCount++
 		s.responseTime = append(s.responseTime, duration)
@@ -271,12 +303,18 @@ func (s *APIServer) loginHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	s.players.Store(playerID, player)
 
+	accessToken, refreshToken, err := s.auth.IssuePair(playerID, req.Username)
+	if err != nil {
+		s.writeErrorResponse(w, http.StatusInternalServerError, "token_issue_failed", err.Error())
+		return
+	}
+
 	response := map[string]interface{}{
 		"session_id":    sessionID,
 		"player_id":     playerID,
-		"access_token":  fmt.Sprintf("token_%d", time.Now().UnixNano()),
-		"refresh_token": fmt.Sprintf("refresh_%d", time.Now().UnixNano()),
-		"expires_at":    time.Now().Add(time.Hour).UnixMilli(),
+		"access_token":  accessToken,
+		"refresh_token": refreshToken,
+		"expires_at":    time.Now().Add(s.auth.AccessTTL()).UnixMilli(),
 	}
 
 	s.writeSuccessResponse(w, response)
@@ -304,6 +342,11 @@ func (s *APIServer) logoutHandler(w http.ResponseWriter, r *http.Request) {
 		s.sessions.Delete(req.SessionID)
 	}
 
+	// 携带令牌时一并吊销
+	if token := auth.BearerToken(r.Header.Get("Authorization")); token != "" {
+		s.auth.Revoke(token)
+	}
+
 	s.writeSuccessResponse(w, map[string]string{"message": "Logged out successfully"})
 }
 
@@ -322,26 +365,38 @@ func (s *APIServer) refreshTokenHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	accessToken, refreshToken, err := s.auth.Refresh(req.RefreshToken)
+	if err != nil {
+		s.writeErrorResponse(w, http.StatusUnauthorized, "invalid_token", err.Error())
+		return
+	}
+
 	response := map[string]interface{}{
-		"access_token":  fmt.Sprintf("token_%d", time.Now().UnixNano()),
-		"refresh_token": fmt.Sprintf("refresh_%d", time.Now().UnixNano()),
-		"expires_at":    time.Now().Add(time.Hour).UnixMilli(),
+		"access_token":  accessToken,
+		"refresh_token": refreshToken,
+		"expires_at":    time.Now().Add(s.auth.AccessTTL()).UnixMilli(),
 	}
 
 	s.writeSuccessResponse(w, response)
 }
 
 func (s *APIServer) verifyTokenHandler(w http.ResponseWriter, r *http.Request) {
-	token := r.Header.Get("Authorization")
+	token := auth.BearerToken(r.Header.Get("Authorization"))
 	if token == "" {
 		s.writeErrorResponse(w, http.StatusUnauthorized, "missing_token", "Authorization header is required")
 		return
 	}
 
-	// 简单的token验证
+	claims, err := s.auth.Verify(token)
+	if err != nil {
+		s.writeErrorResponse(w, http.StatusUnauthorized, "invalid_token", err.Error())
+		return
+	}
+
 	response := map[string]interface{}{
 		"valid":      true,
-		"expires_at": time.Now().Add(time.Hour).UnixMilli(),
+		"player_id":  claims.PlayerID(),
+		"expires_at": claims.ExpiresTime().UnixMilli(),
 	}
 
 	s.writeSuccessResponse(w, response)
@@ -637,6 +692,11 @@ func generateTestData(size int) []map[string]interface{} {
 	return data
 }
 
+// SetAuthenticator 替换令牌认证器，用于与其他测试服务器共享同一密钥和吊销状态
+func (s *APIServer) SetAuthenticator(authenticator *auth.Authenticator) {
+	s.auth = authenticator
+}
+
 // Start 启动服务器
 func (s *APIServer) Start() error {
 	log.Printf("Starting HTTP API server on %s", s.server.Addr)
@@ -0,0 +1,71 @@
+package httpserver
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"GoSlgBenchmarkTest/internal/metrics"
+)
+
+// unmatchedRoute 没有匹配到路由的请求使用的route标签
+const unmatchedRoute = "unmatched"
+
+// setupMetrics 注册HTTP API服务器的Prometheus指标
+func (s *APIServer) setupMetrics() {
+	s.registry = metrics.NewRegistry()
+	s.requestsTotal = s.registry.Counter("slg_http_requests_total",
+		"HTTP requests by method, route template and status code.", "method", "route", "code")
+	s.requestDuration = s.registry.Histogram("slg_http_request_duration_seconds",
+		"HTTP request latency by method and route template.", nil, "method", "route")
+
+	s.registry.GaugeFunc("slg_http_active_players", "Players stored by the API server.", func() float64 {
+		return float64(countEntries(&s.players))
+	})
+	s.registry.GaugeFunc("slg_http_active_battles", "Battles stored by the API server.", func() float64 {
+		return float64(countEntries(&s.battles))
+	})
+	s.registry.GaugeFunc("slg_http_active_sessions", "Sessions stored by the API server.", func() float64 {
+		return float64(countEntries(&s.sessions))
+	})
+	s.registry.CounterFunc("slg_http_errors_total", "Error responses written by the API server.", func() float64 {
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+		return float64(s.errorCount)
+	})
+	s.registry.GaugeFunc("slg_http_uptime_seconds", "Seconds since the server was created.", func() float64 {
+		return time.Since(s.startTime).Seconds()
+	})
+}
+
+// GetMetrics 获取指标注册表
+func (s *APIServer) GetMetrics() *metrics.Registry {
+	return s.registry
+}
+
+// Handler 返回服务器的HTTP处理器，便于在httptest中挂载
+func (s *APIServer) Handler() http.Handler {
+	return s.server.Handler
+}
+
+// statusRecorder 记录响应状态码
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+// WriteHeader 记录状态码后写出
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// countEntries 统计sync.Map中的条目数
+func countEntries(m *sync.Map) int {
+	count := 0
+	m.Range(func(key, value interface{}) bool {
+		count++
+		return true
+	})
+	return count
+}
@@ -0,0 +1,434 @@
+// Package metrics 提供测试服务器共用的指标注册表，以Prometheus文本格式导出
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ContentType Prometheus文本格式的Content-Type
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefaultBuckets 默认延迟直方图分桶（秒），覆盖0.5ms到10s
+var DefaultBuckets = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// metricType 指标类型
+type metricType string
+
+const (
+	typeCounter   metricType = "counter"
+	typeGauge     metricType = "gauge"
+	typeHistogram metricType = "histogram"
+)
+
+// collector 可导出的指标族
+type collector interface {
+	write(w *bufio.Writer)
+}
+
+// Registry 指标注册表
+type Registry struct {
+	mu         sync.RWMutex
+	collectors map[string]collector
+	names      []string
+}
+
+// NewRegistry 创建指标注册表
+func NewRegistry() *Registry {
+	return &Registry{collectors: make(map[string]collector)}
+}
+
+// register 注册指标族，同名指标重复注册时返回已有实例
+func (r *Registry) register(name string, create func() collector) collector {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if existing, ok := r.collectors[name]; ok {
+		return existing
+	}
+	c := create()
+	r.collectors[name] = c
+	r.names = append(r.names, name)
+	sort.Strings(r.names)
+	return c
+}
+
+// Counter 注册计数器
+func (r *Registry) Counter(name, help string, labelNames ...string) *CounterVec {
+	return r.register(name, func() collector {
+		return &CounterVec{family: newFamily(name, help, typeCounter, labelNames)}
+	}).(*CounterVec)
+}
+
+// Gauge 注册仪表盘
+func (r *Registry) Gauge(name, help string, labelNames ...string) *GaugeVec {
+	return r.register(name, func() collector {
+		return &GaugeVec{family: newFamily(name, help, typeGauge, labelNames)}
+	}).(*GaugeVec)
+}
+
+// GaugeFunc 注册在采集时求值的仪表盘，用于导出已有统计
+func (r *Registry) GaugeFunc(name, help string, fn func() float64) {
+	r.register(name, func() collector {
+		return &gaugeFunc{family: newFamily(name, help, typeGauge, nil), fn: fn}
+	})
+}
+
+// CounterFunc 注册在采集时求值的计数器，用于导出已有的单调计数
+func (r *Registry) CounterFunc(name, help string, fn func() float64) {
+	r.register(name, func() collector {
+		return &gaugeFunc{family: newFamily(name, help, typeCounter, nil), fn: fn}
+	})
+}
+
+// Histogram 注册直方图，buckets为空时使用DefaultBuckets
+func (r *Registry) Histogram(name, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	sorted := append([]float64(nil), buckets...)
+	sort.Float64s(sorted)
+
+	return r.register(name, func() collector {
+		return &HistogramVec{family: newFamily(name, help, typeHistogram, labelNames), buckets: sorted}
+	}).(*HistogramVec)
+}
+
+// WriteText 以Prometheus文本格式写出所有指标
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.RLock()
+	collectors := make([]collector, 0, len(r.names))
+	for _, name := range r.names {
+		collectors = append(collectors, r.collectors[name])
+	}
+	r.mu.RUnlock()
+
+	buf := bufio.NewWriter(w)
+	for _, c := range collectors {
+		c.write(buf)
+	}
+	return buf.Flush()
+}
+
+// Handler 返回/metrics的HTTP处理器
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", ContentType)
+		if err := r.WriteText(w); err != nil {
+			http.Error(w, fmt.Sprintf("write metrics failed: %v", err), http.StatusInternalServerError)
+		}
+	})
+}
+
+// family 指标族公共部分：名称、说明与按标签值索引的序列
+type family struct {
+	name       string
+	help       string
+	kind       metricType
+	labelNames []string
+
+	mu     sync.RWMutex
+	series map[string]interface{}
+	keys   []string
+	labels map[string][]string
+}
+
+// newFamily 创建指标族
+func newFamily(name, help string, kind metricType, labelNames []string) family {
+	return family{
+		name:       name,
+		help:       help,
+		kind:       kind,
+		labelNames: labelNames,
+		series:     make(map[string]interface{}),
+		labels:     make(map[string][]string),
+	}
+}
+
+// get 获取或创建标签值对应的序列
+func (f *family) get(values []string, create func() interface{}) interface{} {
+	if len(values) != len(f.labelNames) {
+		panic(fmt.Sprintf("metric %s: expected %d label values, got %d", f.name, len(f.labelNames), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+
+	f.mu.RLock()
+	s, ok := f.series[key]
+	f.mu.RUnlock()
+	if ok {
+		return s
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if s, ok := f.series[key]; ok {
+		return s
+	}
+	s = create()
+	f.series[key] = s
+	f.labels[key] = append([]string(nil), values...)
+	f.keys = append(f.keys, key)
+	sort.Strings(f.keys)
+	return s
+}
+
+// snapshot 按标签排序返回所有序列
+func (f *family) snapshot() ([][]string, []interface{}) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	labels := make([][]string, 0, len(f.keys))
+	series := make([]interface{}, 0, len(f.keys))
+	for _, key := range f.keys {
+		labels = append(labels, f.labels[key])
+		series = append(series, f.series[key])
+	}
+	return labels, series
+}
+
+// writeHeader 写出HELP与TYPE行
+func (f *family) writeHeader(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", f.name, escapeHelp(f.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", f.name, f.kind)
+}
+
+// writeSample 写出一个样本行
+func (f *family) writeSample(w *bufio.Writer, name string, values []string, extraName, extraValue string, value float64) {
+	w.WriteString(name)
+
+	if len(values) > 0 || extraName != "" {
+		w.WriteByte('{')
+		for i, labelName := range f.labelNames {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, "%s=\"%s\"", labelName, escapeLabel(values[i]))
+		}
+		if extraName != "" {
+			if len(values) > 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, "%s=\"%s\"", extraName, extraValue)
+		}
+		w.WriteByte('}')
+	}
+
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(value))
+	w.WriteByte('\n')
+}
+
+// CounterVec 带标签的计数器
+type CounterVec struct {
+	family
+}
+
+// Counter 单个计数器序列
+type Counter struct {
+	bits atomic.Uint64
+}
+
+// WithLabelValues 获取标签值对应的计数器
+func (c *CounterVec) WithLabelValues(values ...string) *Counter {
+	return c.get(values, func() interface{} { return &Counter{} }).(*Counter)
+}
+
+// Inc 计数加1
+func (c *Counter) Inc() {
+	c.Add(1)
+}
+
+// Add 增加计数，负值被忽略
+func (c *Counter) Add(delta float64) {
+	if delta < 0 {
+		return
+	}
+	addFloat(&c.bits, delta)
+}
+
+// Value 当前计数
+func (c *Counter) Value() float64 {
+	return math.Float64frombits(c.bits.Load())
+}
+
+func (c *CounterVec) write(w *bufio.Writer) {
+	c.writeHeader(w)
+	labels, series := c.snapshot()
+	for i, s := range series {
+		c.writeSample(w, c.name, labels[i], "", "", s.(*Counter).Value())
+	}
+}
+
+// GaugeVec 带标签的仪表盘
+type GaugeVec struct {
+	family
+}
+
+// Gauge 单个仪表盘序列
+type Gauge struct {
+	bits atomic.Uint64
+}
+
+// WithLabelValues 获取标签值对应的仪表盘
+func (g *GaugeVec) WithLabelValues(values ...string) *Gauge {
+	return g.get(values, func() interface{} { return &Gauge{} }).(*Gauge)
+}
+
+// Set 设置当前值
+func (g *Gauge) Set(value float64) {
+	g.bits.Store(math.Float64bits(value))
+}
+
+// Add 增加（可为负）
+func (g *Gauge) Add(delta float64) {
+	addFloat(&g.bits, delta)
+}
+
+// Inc 加1
+func (g *Gauge) Inc() {
+	g.Add(1)
+}
+
+// Dec 减1
+func (g *Gauge) Dec() {
+	g.Add(-1)
+}
+
+// Value 当前值
+func (g *Gauge) Value() float64 {
+	return math.Float64frombits(g.bits.Load())
+}
+
+func (g *GaugeVec) write(w *bufio.Writer) {
+	g.writeHeader(w)
+	labels, series := g.snapshot()
+	for i, s := range series {
+		g.writeSample(w, g.name, labels[i], "", "", s.(*Gauge).Value())
+	}
+}
+
+// gaugeFunc 采集时求值的无标签指标
+type gaugeFunc struct {
+	family
+	fn func() float64
+}
+
+func (g *gaugeFunc) write(w *bufio.Writer) {
+	g.writeHeader(w)
+	g.writeSample(w, g.name, nil, "", "", g.fn())
+}
+
+// HistogramVec 带标签的直方图
+type HistogramVec struct {
+	family
+	buckets []float64
+}
+
+// Histogram 单个直方图序列
+type Histogram struct {
+	upperBounds []float64
+	mu          sync.Mutex
+	counts      []uint64 // 各分桶的非累积计数，最后一个为+Inf
+	count       uint64
+	sum         float64
+}
+
+// WithLabelValues 获取标签值对应的直方图
+func (h *HistogramVec) WithLabelValues(values ...string) *Histogram {
+	return h.get(values, func() interface{} {
+		return &Histogram{upperBounds: h.buckets, counts: make([]uint64, len(h.buckets)+1)}
+	}).(*Histogram)
+}
+
+// Observe 记录一次观测值
+func (h *Histogram) Observe(value float64) {
+	idx := sort.SearchFloat64s(h.upperBounds, value)
+
+	h.mu.Lock()
+	h.counts[idx]++
+	h.count++
+	h.sum += value
+	h.mu.Unlock()
+}
+
+// ObserveDuration 以秒为单位记录耗时
+func (h *Histogram) ObserveDuration(d time.Duration) {
+	h.Observe(d.Seconds())
+}
+
+// Count 观测次数
+func (h *Histogram) Count() uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.count
+}
+
+func (h *HistogramVec) write(w *bufio.Writer) {
+	h.writeHeader(w)
+	labels, series := h.snapshot()
+	for i, s := range series {
+		hist := s.(*Histogram)
+
+		hist.mu.Lock()
+		counts := append([]uint64(nil), hist.counts...)
+		count, sum := hist.count, hist.sum
+		hist.mu.Unlock()
+
+		var cumulative uint64
+		for j, bound := range h.buckets {
+			cumulative += counts[j]
+			h.writeSample(w, h.name+"_bucket", labels[i], "le", formatFloat(bound), float64(cumulative))
+		}
+		h.writeSample(w, h.name+"_bucket", labels[i], "le", "+Inf", float64(count))
+		h.writeSample(w, h.name+"_sum", labels[i], "", "", sum)
+		h.writeSample(w, h.name+"_count", labels[i], "", "", float64(count))
+	}
+}
+
+// addFloat 原子地累加浮点数
+func addFloat(bits *atomic.Uint64, delta float64) {
+	for {
+		old := bits.Load()
+		updated := math.Float64bits(math.Float64frombits(old) + delta)
+		if bits.CompareAndSwap(old, updated) {
+			return
+		}
+	}
+}
+
+// formatFloat 按Prometheus约定格式化数值
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+// escapeHelp 转义HELP文本
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+// escapeLabel 转义标签值
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
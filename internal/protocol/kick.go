@@ -0,0 +1,61 @@
+package protocol
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/proto"
+
+	gamev1 "GoSlgBenchmarkTest/proto/game/v1"
+)
+
+// CloseKicked 踢下线时使用的WebSocket关闭码（应用私有范围），客户端收到后不应自动重连
+const CloseKicked = 4010
+
+// KickReason 踢下线原因码，作为OpKick消息（ErrorResp）的error_code
+type KickReason int32
+
+const (
+	KickDuplicateLogin KickReason = 1 // 同一玩家在其他连接登录，旧连接被踢
+	KickLoginConflict  KickReason = 2 // 玩家已在其他连接在线，新登录被拒绝
+)
+
+func (r KickReason) String() string {
+	switch r {
+	case KickDuplicateLogin:
+		return "duplicate_login"
+	case KickLoginConflict:
+		return "login_conflict"
+	default:
+		return fmt.Sprintf("kick_%d", int32(r))
+	}
+}
+
+// DuplicateLoginPolicy 同一玩家重复登录时的处理策略
+type DuplicateLoginPolicy string
+
+const (
+	DuplicateLoginAllow     DuplicateLoginPolicy = "allow"      // 允许并存，按玩家寻址的推送发往最新的连接
+	DuplicateLoginKickOld   DuplicateLoginPolicy = "kick_old"   // 踢掉旧连接（线上服务器的行为）
+	DuplicateLoginRejectNew DuplicateLoginPolicy = "reject_new" // 拒绝新登录，保留旧连接
+)
+
+// ParseDuplicateLoginPolicy 解析重复登录策略，空字符串返回allow
+func ParseDuplicateLoginPolicy(s string) (DuplicateLoginPolicy, error) {
+	switch policy := DuplicateLoginPolicy(s); policy {
+	case "":
+		return DuplicateLoginAllow, nil
+	case DuplicateLoginAllow, DuplicateLoginKickOld, DuplicateLoginRejectNew:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown duplicate login policy: %q", s)
+	}
+}
+
+// EncodeKick 编码踢下线帧
+func EncodeKick(reason KickReason, message string) ([]byte, error) {
+	body, err := proto.Marshal(&gamev1.ErrorResp{ErrorCode: int32(reason), ErrorMessage: message})
+	if err != nil {
+		return nil, fmt.Errorf("marshal kick message failed: %w", err)
+	}
+	return EncodeFrame(OpKick, body), nil
+}
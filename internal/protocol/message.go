@@ -0,0 +1,38 @@
+package protocol
+
+import (
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"GoSlgBenchmarkTest/generated/slg/v1_1_0/building"
+	"GoSlgBenchmarkTest/generated/slg/v1_1_0/combat"
+	gamev1 "GoSlgBenchmarkTest/proto/game/v1"
+)
+
+// NewMessage 按操作码创建对应的空消息，用于反序列化消息体；未知操作码返回nil
+func NewMessage(opcode uint16) proto.Message {
+	switch opcode {
+	case OpLoginReq:
+		return &gamev1.LoginReq{}
+	case OpLoginResp:
+		return &gamev1.LoginResp{}
+	case OpHeartbeat:
+		return &gamev1.Heartbeat{}
+	case OpHeartbeatResp:
+		return &gamev1.HeartbeatResp{}
+	case OpBattlePush:
+		return &gamev1.BattlePush{}
+	case OpPlayerAction, OpActionResp:
+		return &gamev1.PlayerAction{} // 操作响应沿用PlayerAction
+	case OpError, OpKick:
+		return &gamev1.ErrorResp{}
+	case OpRoomJoin, OpRoomLeave, OpRoomResp:
+		return &wrapperspb.StringValue{}
+	case OpSLGCityUpdate:
+		return &building.CityInfo{}
+	case OpSLGBattleEnd:
+		return &combat.BattleResponse{}
+	default:
+		return nil
+	}
+}
@@ -1,11 +1,14 @@
 package protocol
 
+import "maps"
+
 // 操作码定义 - 用于识别不同类型的消息
 const (
 	// 认证相关
 	OpLoginReq  uint16 = 1001
 	OpLoginResp uint16 = 1002
 	OpLogout    uint16 = 1003
+	OpKick      uint16 = 1004 // 服务器踢下线，消息体为ErrorResp（error_code为KickReason）
 
 	// 心跳相关
 	OpHeartbeat     uint16 = 1100
@@ -20,6 +23,11 @@ const (
 	OpChatMessage uint16 = 3001
 	OpChatResp    uint16 = 3002
 
+	// 房间订阅 - 消息体为房间ID（wrapperspb.StringValue）
+	OpRoomJoin  uint16 = 4001
+	OpRoomLeave uint16 = 4002
+	OpRoomResp  uint16 = 4003
+
 	// 错误响应
 	OpError uint16 = 9999
 )
@@ -33,6 +41,8 @@ func OpcodeToString(op uint16) string {
 		return "LOGIN_RESP"
 	case OpLogout:
 		return "LOGOUT"
+	case OpKick:
+		return "KICK"
 	case OpHeartbeat:
 		return "HEARTBEAT"
 	case OpHeartbeatResp:
@@ -47,6 +57,12 @@ func OpcodeToString(op uint16) string {
 		return "CHAT_MESSAGE"
 	case OpChatResp:
 		return "CHAT_RESP"
+	case OpRoomJoin:
+		return "ROOM_JOIN"
+	case OpRoomLeave:
+		return "ROOM_LEAVE"
+	case OpRoomResp:
+		return "ROOM_RESP"
 	case OpError:
 		return "ERROR"
 	default:
@@ -57,10 +73,11 @@ func OpcodeToString(op uint16) string {
 // IsValidOpcode 检查操作码是否有效
 func IsValidOpcode(op uint16) bool {
 	switch op {
-	case OpLoginReq, OpLoginResp, OpLogout,
+	case OpLoginReq, OpLoginResp, OpLogout, OpKick,
 		OpHeartbeat, OpHeartbeatResp,
 		OpBattlePush, OpPlayerAction, OpActionResp,
 		OpChatMessage, OpChatResp,
+		OpRoomJoin, OpRoomLeave, OpRoomResp,
 		OpError:
 		return true
 	default:
@@ -71,7 +88,7 @@ func IsValidOpcode(op uint16) bool {
 // IsRequestOpcode 判断是否为请求类型的操作码
 func IsRequestOpcode(op uint16) bool {
 	switch op {
-	case OpLoginReq, OpLogout, OpHeartbeat, OpPlayerAction, OpChatMessage:
+	case OpLoginReq, OpLogout, OpHeartbeat, OpPlayerAction, OpChatMessage, OpRoomJoin, OpRoomLeave:
 		return true
 	default:
 		return false
@@ -81,7 +98,7 @@ func IsRequestOpcode(op uint16) bool {
 // IsResponseOpcode 判断是否为响应类型的操作码
 func IsResponseOpcode(op uint16) bool {
 	switch op {
-	case OpLoginResp, OpHeartbeatResp, OpActionResp, OpChatResp, OpError:
+	case OpLoginResp, OpHeartbeatResp, OpActionResp, OpChatResp, OpRoomResp, OpError:
 		return true
 	default:
 		return false
@@ -91,9 +108,30 @@ func IsResponseOpcode(op uint16) bool {
 // IsPushOpcode 判断是否为推送类型的操作码
 func IsPushOpcode(op uint16) bool {
 	switch op {
-	case OpBattlePush:
+	case OpBattlePush, OpKick:
 		return true
 	default:
 		return false
 	}
 }
+
+// requestResponses 请求操作码对应的响应操作码
+var requestResponses = map[uint16]uint16{
+	OpLoginReq:     OpLoginResp,
+	OpHeartbeat:    OpHeartbeatResp,
+	OpPlayerAction: OpActionResp,
+	OpChatMessage:  OpChatResp,
+	OpRoomJoin:     OpRoomResp,
+	OpRoomLeave:    OpRoomResp,
+}
+
+// ResponseOpcode 返回请求操作码对应的响应操作码，没有响应的操作码返回false
+func ResponseOpcode(op uint16) (uint16, bool) {
+	response, ok := requestResponses[op]
+	return response, ok
+}
+
+// RequestResponseOpcodes 返回请求→响应操作码映射的副本
+func RequestResponseOpcodes() map[uint16]uint16 {
+	return maps.Clone(requestResponses)
+}
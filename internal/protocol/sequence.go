@@ -0,0 +1,34 @@
+package protocol
+
+import (
+	"google.golang.org/protobuf/proto"
+
+	gamev1 "GoSlgBenchmarkTest/proto/game/v1"
+)
+
+// MessageSequence 提取消息体中的序列号，用于跨端关联同一条消息；无序列号时返回0
+func MessageSequence(opcode uint16, body []byte) uint64 {
+	switch opcode {
+	case OpBattlePush:
+		push := &gamev1.BattlePush{}
+		if proto.Unmarshal(body, push) == nil {
+			return push.Seq
+		}
+	case OpPlayerAction:
+		action := &gamev1.PlayerAction{}
+		if proto.Unmarshal(body, action) == nil {
+			return action.ActionSeq
+		}
+	case OpHeartbeat:
+		heartbeat := &gamev1.Heartbeat{}
+		if proto.Unmarshal(body, heartbeat) == nil {
+			return uint64(heartbeat.PingSeq)
+		}
+	case OpHeartbeatResp:
+		resp := &gamev1.HeartbeatResp{}
+		if proto.Unmarshal(body, resp) == nil {
+			return uint64(resp.PingSeq)
+		}
+	}
+	return 0
+}
@@ -110,6 +110,9 @@ func (adapter *SLGMessageAdapter) createV1_0_0Message(opcode uint16) (proto.Mess
 	case OpSLGBattleUpdate:
 		// BattleUpdate 不存在，使用 BattleResponse 作为更新
 		return &v1_0_0_combat.BattleResponse{}, nil
+	case OpSLGBattleEnd:
+		// BattleEnd 不存在，使用 BattleResponse 作为战报
+		return &v1_0_0_combat.BattleResponse{}, nil
 	case OpSLGCityUpdate:
 		// CityUpdate 不存在，使用 CityInfo 作为更新
 		return &v1_0_0_building.CityInfo{}, nil
@@ -128,6 +131,9 @@ func (adapter *SLGMessageAdapter) createV1_1_0Message(opcode uint16) (proto.Mess
 	case OpSLGBattleUpdate:
 		// BattleUpdate 不存在，使用 BattleResponse 作为更新
 		return &v1_1_0_combat.BattleResponse{}, nil
+	case OpSLGBattleEnd:
+		// BattleEnd 不存在，使用 BattleResponse 作为战报
+		return &v1_1_0_combat.BattleResponse{}, nil
 	case OpSLGCityUpdate:
 		// CityUpdate 不存在，使用 CityInfo 作为更新
 		return &v1_1_0_building.CityInfo{}, nil
@@ -0,0 +1,494 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"GoSlgBenchmarkTest/internal/protocol"
+	gamev1 "GoSlgBenchmarkTest/proto/game/v1"
+)
+
+// battleRoomPrefix 战斗房间ID的前缀，与测试服务器的房间命名一致
+const battleRoomPrefix = "battle:"
+
+// AmplifierConfig 会话放大配置
+type AmplifierConfig struct {
+	URL             string        `json:"url"`              // 目标服务器WebSocket地址
+	Clients         int           `json:"clients"`          // 虚拟客户端数量
+	StartInterval   time.Duration `json:"start_interval"`   // 相邻虚拟客户端的启动间隔
+	StartJitter     time.Duration `json:"start_jitter"`     // 启动时间的随机偏移上限
+	Jitter          float64       `json:"jitter"`           // 发送间隔的随机抖动比例，0.2表示每个间隔在±20%内浮动
+	Speed           ReplaySpeed   `json:"speed"`            // 按录制的发送间隔回放的倍速，SpeedInstant不等待
+	BattleSize      int           `json:"battle_size"`      // 每场战斗的虚拟玩家数，0表示所有客户端沿用录制的战斗ID
+	Seed            int64         `json:"seed"`             // 抖动随机数种子，相同种子产生相同的负载曲线
+	DialTimeout     time.Duration `json:"dial_timeout"`     // 连接超时
+	ResponseTimeout time.Duration `json:"response_timeout"` // 等待登录响应和剩余响应的时间
+	Header          http.Header   `json:"-"`                // 握手附加的HTTP头
+
+	// TokenFor 返回第index个虚拟客户端的登录令牌，为空时沿用录制的令牌
+	TokenFor func(index int) string `json:"-"`
+}
+
+// DefaultAmplifierConfig 默认会话放大配置
+func DefaultAmplifierConfig(url string, clients int) *AmplifierConfig {
+	return &AmplifierConfig{
+		URL:             url,
+		Clients:         clients,
+		StartInterval:   50 * time.Millisecond,
+		Jitter:          0.1,
+		Speed:           SpeedNormal,
+		DialTimeout:     5 * time.Second,
+		ResponseTimeout: 2 * time.Second,
+	}
+}
+
+// VirtualClientResult 单个虚拟客户端的回放结果
+type VirtualClientResult struct {
+	Index          int           `json:"index"`
+	PlayerID       string        `json:"player_id"`
+	DeviceID       string        `json:"device_id"`
+	BattleID       string        `json:"battle_id,omitempty"`
+	StartOffset    time.Duration `json:"start_offset"`
+	Duration       time.Duration `json:"duration"`
+	SentFrames     int           `json:"sent_frames"`
+	ReceivedFrames int           `json:"received_frames"`
+	Error          string        `json:"error,omitempty"`
+	Session        *Session      `json:"-"` // 虚拟客户端录制的会话
+}
+
+// OpcodeLatency 某种请求在所有虚拟客户端上的响应延迟分布
+type OpcodeLatency struct {
+	Opcode  uint16              `json:"opcode"`
+	Name    string              `json:"name"`
+	Latency LatencyDistribution `json:"latency"`
+}
+
+// AmplifierReport 会话放大结果，指标在所有虚拟客户端上汇总
+type AmplifierReport struct {
+	SessionID      string                 `json:"session_id"`
+	StartTime      time.Time              `json:"start_time"`
+	Duration       time.Duration          `json:"duration"`
+	Clients        int                    `json:"clients"`
+	Succeeded      int                    `json:"succeeded"`
+	Failed         int                    `json:"failed"`
+	SentFrames     int                    `json:"sent_frames"`
+	ReceivedFrames int                    `json:"received_frames"`
+	SentBytes      int64                  `json:"sent_bytes"`
+	ReceivedBytes  int64                  `json:"received_bytes"`
+	SendRate       float64                `json:"send_rate"` // 每秒发送帧数
+	Latency        []*OpcodeLatency       `json:"latency"`
+	Errors         map[string]int         `json:"errors,omitempty"` // 错误信息 -> 出现次数
+	Results        []*VirtualClientResult `json:"results"`
+}
+
+// SessionAmplifier 将一个录制会话放大为N个虚拟客户端，每个客户端按录制节奏重发发送帧，
+// 并改写令牌、设备ID、玩家ID、战斗ID和序列号，使真实玩家行为成为容量测试的负载曲线
+type SessionAmplifier struct {
+	session *Session
+	config  *AmplifierConfig
+	sends   []*MessageFrame
+}
+
+// NewSessionAmplifier 创建会话放大器，session需包含客户端视角录制的帧
+func NewSessionAmplifier(session *Session, config *AmplifierConfig) *SessionAmplifier {
+	if config == nil {
+		config = DefaultAmplifierConfig("", 1)
+	}
+	if config.Clients <= 0 {
+		config.Clients = 1
+	}
+	if config.DialTimeout <= 0 {
+		config.DialTimeout = 5 * time.Second
+	}
+	if config.ResponseTimeout <= 0 {
+		config.ResponseTimeout = 2 * time.Second
+	}
+
+	sends := make([]*MessageFrame, 0)
+	for _, frame := range session.Frames {
+		if frame.Direction == "send" {
+			sends = append(sends, frame)
+		}
+	}
+	return &SessionAmplifier{session: session, config: config, sends: sends}
+}
+
+// Run 启动所有虚拟客户端并等待它们结束，返回汇总结果。单个客户端失败不会中断其他客户端
+func (a *SessionAmplifier) Run(ctx context.Context) (*AmplifierReport, error) {
+	if len(a.sends) == 0 {
+		return nil, ErrNothingToReplay
+	}
+
+	report := &AmplifierReport{
+		SessionID: a.session.ID,
+		StartTime: time.Now(),
+		Clients:   a.config.Clients,
+		Results:   make([]*VirtualClientResult, a.config.Clients),
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < a.config.Clients; i++ {
+		client := a.newVirtualClient(i)
+		report.Results[i] = client.result
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			client.run(ctx, report.StartTime)
+		}()
+	}
+	wg.Wait()
+
+	report.Duration = time.Since(report.StartTime)
+	a.aggregate(report)
+	return report, ctx.Err()
+}
+
+// newVirtualClient 创建第index个虚拟客户端，计算它的启动偏移和改写后的身份
+func (a *SessionAmplifier) newVirtualClient(index int) *virtualClient {
+	random := rand.New(rand.NewSource(a.config.Seed + int64(index)))
+	offset := time.Duration(index) * a.config.StartInterval
+	if a.config.StartJitter > 0 {
+		offset += time.Duration(random.Int63n(int64(a.config.StartJitter)))
+	}
+
+	client := &virtualClient{
+		amplifier: a,
+		random:    random,
+		recorder:  NewSessionRecorder(fmt.Sprintf("%s_vc%d_%d", a.session.ID, index, time.Now().UnixNano())),
+		loginCh:   make(chan *gamev1.LoginResp, 1),
+		result: &VirtualClientResult{
+			Index:       index,
+			StartOffset: offset,
+		},
+	}
+	if a.config.TokenFor != nil {
+		client.token = a.config.TokenFor(index)
+	}
+	if a.config.BattleSize > 0 {
+		client.battleGroup = index / a.config.BattleSize
+	}
+	return client
+}
+
+// aggregate 汇总所有虚拟客户端的帧数、字节数、错误和每种请求的延迟分布
+func (a *SessionAmplifier) aggregate(report *AmplifierReport) {
+	latencies := make(map[uint16][]time.Duration)
+	for _, result := range report.Results {
+		report.SentFrames += result.SentFrames
+		report.ReceivedFrames += result.ReceivedFrames
+		if result.Error != "" {
+			report.Failed++
+			if report.Errors == nil {
+				report.Errors = make(map[string]int)
+			}
+			report.Errors[result.Error]++
+		} else {
+			report.Succeeded++
+		}
+
+		if result.Session == nil {
+			continue
+		}
+		for _, frame := range result.Session.Frames {
+			if frame.Direction == "send" {
+				report.SentBytes += int64(len(frame.RawData))
+			} else {
+				report.ReceivedBytes += int64(len(frame.RawData))
+			}
+		}
+		for opcode, values := range responseLatencies(result.Session) {
+			latencies[opcode] = append(latencies[opcode], values...)
+		}
+	}
+
+	if seconds := report.Duration.Seconds(); seconds > 0 {
+		report.SendRate = float64(report.SentFrames) / seconds
+	}
+
+	opcodes := make([]int, 0, len(latencies))
+	for opcode := range latencies {
+		opcodes = append(opcodes, int(opcode))
+	}
+	sort.Ints(opcodes)
+	report.Latency = make([]*OpcodeLatency, 0, len(opcodes))
+	for _, op := range opcodes {
+		opcode := uint16(op)
+		report.Latency = append(report.Latency, &OpcodeLatency{
+			Opcode:  opcode,
+			Name:    protocol.OpcodeToString(opcode),
+			Latency: newLatencyDistribution(latencies[opcode]),
+		})
+	}
+}
+
+// virtualClient 放大出的单个虚拟客户端
+type virtualClient struct {
+	amplifier *SessionAmplifier
+	random    *rand.Rand
+	recorder  *SessionRecorder
+	result    *VirtualClientResult
+
+	conn    *websocket.Conn
+	writeMu sync.Mutex
+	loginCh chan *gamev1.LoginResp
+
+	// 改写状态，仅由发送协程访问
+	token       string
+	battleGroup int
+	actionSeq   uint64
+	pingSeq     int32
+}
+
+// run 在启动偏移之后连接服务器、回放发送帧并等待剩余响应
+func (c *virtualClient) run(ctx context.Context, start time.Time) {
+	defer func() {
+		c.recorder.Stop()
+		c.result.Session = c.recorder.GetSession()
+	}()
+
+	select {
+	case <-time.After(time.Until(start.Add(c.result.StartOffset))):
+	case <-ctx.Done():
+		c.result.Error = ctx.Err().Error()
+		return
+	}
+
+	began := time.Now()
+	defer func() { c.result.Duration = time.Since(began) }()
+
+	config := c.amplifier.config
+	dialer := websocket.Dialer{HandshakeTimeout: config.DialTimeout}
+	conn, _, err := dialer.DialContext(ctx, config.URL, config.Header)
+	if err != nil {
+		c.recorder.RecordError(err, nil)
+		c.result.Error = fmt.Sprintf("dial: %v", err)
+		return
+	}
+	c.conn = conn
+	c.recorder.RecordEvent(EventConnect, map[string]interface{}{"url": config.URL, "virtual_client": c.result.Index})
+
+	readDone := make(chan struct{})
+	go c.readLoop(readDone)
+
+	if err := c.sendFrames(ctx); err != nil {
+		c.recorder.RecordError(err, nil)
+		c.result.Error = err.Error()
+	} else {
+		c.awaitResponses(ctx)
+	}
+
+	c.writeMu.Lock()
+	conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, "amplified replay finished"), time.Now().Add(time.Second))
+	c.writeMu.Unlock()
+	conn.Close()
+	<-readDone
+	c.recorder.RecordClose(CloseNormal, "amplified replay finished")
+}
+
+// sendFrames 按录制的发送间隔（叠加抖动）依次改写并发送帧
+func (c *virtualClient) sendFrames(ctx context.Context) error {
+	config := c.amplifier.config
+	sends := c.amplifier.sends
+	next := time.Now()
+
+	for i, frame := range sends {
+		if i > 0 && config.Speed > 0 {
+			gap := float64(frame.Timestamp.Sub(sends[i-1].Timestamp)) / float64(config.Speed)
+			if config.Jitter > 0 {
+				gap *= 1 + config.Jitter*(2*c.random.Float64()-1)
+			}
+			if gap > 0 {
+				next = next.Add(time.Duration(gap))
+			}
+			if wait := time.Until(next); wait > 0 {
+				select {
+				case <-time.After(wait):
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+		} else if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		opcode, data, err := c.rewrite(frame)
+		if err != nil {
+			return fmt.Errorf("rewrite frame %d: %w", c.result.SentFrames, err)
+		}
+		if err := c.write(data); err != nil {
+			return fmt.Errorf("send frame %d: %w", c.result.SentFrames, err)
+		}
+		c.result.SentFrames++
+
+		// 后续帧需要使用服务器分配的玩家ID，登录后先等待登录响应
+		if opcode == protocol.OpLoginReq {
+			select {
+			case resp := <-c.loginCh:
+				if !resp.Ok {
+					return fmt.Errorf("login rejected")
+				}
+				c.result.PlayerID = resp.PlayerId
+			case <-time.After(config.ResponseTimeout):
+				return fmt.Errorf("no login response within %v", config.ResponseTimeout)
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+	return nil
+}
+
+// write 发送一帧并记录
+func (c *virtualClient) write(data []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if err := c.conn.WriteMessage(websocket.BinaryMessage, data); err != nil {
+		return err
+	}
+	c.recordFrame("send", data)
+	return nil
+}
+
+// readLoop 读取并录制虚拟客户端收到的帧
+func (c *virtualClient) readLoop(done chan struct{}) {
+	defer close(done)
+
+	for {
+		messageType, data, err := c.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		if messageType != websocket.BinaryMessage {
+			continue
+		}
+		opcode := c.recordFrame("receive", data)
+		c.result.ReceivedFrames++
+
+		if opcode == protocol.OpLoginResp || opcode == protocol.OpError || opcode == protocol.OpKick {
+			resp := &gamev1.LoginResp{}
+			if opcode == protocol.OpLoginResp {
+				_, body, _ := protocol.DecodeFrame(data)
+				proto.Unmarshal(body, resp)
+			}
+			select {
+			case c.loginCh <- resp:
+			default:
+			}
+		}
+	}
+}
+
+// recordFrame 录制虚拟客户端上的帧，返回操作码
+func (c *virtualClient) recordFrame(direction string, data []byte) uint16 {
+	opcode, body, err := protocol.DecodeFrame(data)
+	if err != nil {
+		c.recorder.RecordMessage(direction, data, 0, data, 0)
+		return 0
+	}
+	c.recorder.RecordMessage(direction, data, opcode, body, protocol.MessageSequence(opcode, body))
+	return opcode
+}
+
+// awaitResponses 等待所有请求收到响应，或超时
+func (c *virtualClient) awaitResponses(ctx context.Context) {
+	deadline := time.NewTimer(c.amplifier.config.ResponseTimeout)
+	defer deadline.Stop()
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		pending := make(map[uint16]int)
+		for _, frame := range c.recorder.GetFrames() {
+			if frame.Direction == "send" {
+				if response, ok := protocol.ResponseOpcode(frame.Opcode); ok {
+					pending[response]++
+				}
+			} else if pending[frame.Opcode] > 0 {
+				pending[frame.Opcode]--
+			}
+		}
+		complete := true
+		for _, count := range pending {
+			if count > 0 {
+				complete = false
+				break
+			}
+		}
+		if complete {
+			return
+		}
+
+		select {
+		case <-ticker.C:
+		case <-deadline.C:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// rewrite 将录制的发送帧改写为虚拟客户端的令牌、设备ID、玩家ID、战斗ID和序列号
+func (c *virtualClient) rewrite(frame *MessageFrame) (uint16, []byte, error) {
+	opcode, body, err := protocol.DecodeFrame(frame.RawData)
+	if err != nil {
+		// 非协议帧原样发送
+		return 0, frame.RawData, nil
+	}
+	message := protocol.NewMessage(opcode)
+	if message == nil {
+		return opcode, frame.RawData, nil
+	}
+	if err := proto.Unmarshal(body, message); err != nil {
+		return opcode, nil, err
+	}
+
+	switch msg := message.(type) {
+	case *gamev1.LoginReq:
+		if c.token != "" {
+			msg.Token = c.token
+		}
+		// 未启用鉴权的服务器按设备ID分配玩家ID，每个虚拟客户端使用不同的设备ID避免互相顶号
+		msg.DeviceId = fmt.Sprintf("%s_vc%d", msg.DeviceId, c.result.Index)
+		c.result.DeviceID = msg.DeviceId
+	case *gamev1.PlayerAction:
+		c.actionSeq++
+		msg.ActionSeq = c.actionSeq
+		if c.result.PlayerID != "" {
+			msg.PlayerId = c.result.PlayerID
+		}
+		msg.ClientTimestamp = time.Now().UnixMilli()
+	case *gamev1.Heartbeat:
+		c.pingSeq++
+		msg.PingSeq = c.pingSeq
+		msg.ClientUnixMs = time.Now().UnixMilli()
+	case *wrapperspb.StringValue:
+		battleID, ok := strings.CutPrefix(msg.Value, battleRoomPrefix)
+		if !ok || c.amplifier.config.BattleSize <= 0 {
+			return opcode, frame.RawData, nil
+		}
+		c.result.BattleID = fmt.Sprintf("%s_%d", battleID, c.battleGroup)
+		msg.Value = battleRoomPrefix + c.result.BattleID
+	default:
+		return opcode, frame.RawData, nil
+	}
+
+	rewritten, err := proto.Marshal(message)
+	if err != nil {
+		return opcode, nil, err
+	}
+	return opcode, protocol.EncodeFrame(opcode, rewritten), nil
+}
@@ -0,0 +1,121 @@
+package session
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// junitTestSuites JUnit XML根元素，CI（Jenkins、GitLab等）可以直接展示
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+// junitTestSuite 对应一个断言套件
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Errors    int             `xml:"errors,attr"`
+	Time      string          `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr,omitempty"`
+	Cases     []junitTestCase `xml:"testcase"`
+}
+
+// junitTestCase 对应一条断言
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+// junitFailure 断言失败的详情
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// WriteJUnit 以JUnit XML格式写出最近一次RunAssertions的结果，sessionID写入classname便于区分多个会话
+func (s *AssertionSuite) WriteJUnit(w io.Writer, sessionID string) error {
+	if len(s.Results) != len(s.Assertions) {
+		return errors.New("assertion suite has not been run")
+	}
+
+	classname := s.Name
+	if sessionID != "" {
+		classname = s.Name + "." + sessionID
+	}
+	suite := junitTestSuite{Name: s.Name, Tests: len(s.Results)}
+	var total time.Duration
+	for i, result := range s.Results {
+		assertion := s.Assertions[i]
+		testCase := junitTestCase{
+			Name:      assertion.GetName(),
+			Classname: classname,
+			Time:      junitSeconds(result.Duration),
+		}
+		if result.Passed {
+			testCase.SystemOut = result.Message
+		} else {
+			suite.Failures++
+			testCase.Failure = &junitFailure{
+				Message: result.Message,
+				Type:    "AssertionFailed",
+				Text:    junitFailureText(assertion, result),
+			}
+		}
+		if suite.Timestamp == "" && !result.Timestamp.IsZero() {
+			suite.Timestamp = result.Timestamp.UTC().Format("2006-01-02T15:04:05")
+		}
+		total += result.Duration
+		suite.Cases = append(suite.Cases, testCase)
+	}
+	suite.Time = junitSeconds(total)
+
+	report := junitTestSuites{
+		Tests:    suite.Tests,
+		Failures: suite.Failures,
+		Time:     suite.Time,
+		Suites:   []junitTestSuite{suite},
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// junitFailureText 失败详情：描述、期望值和实际值
+func junitFailureText(assertion Assertion, result *AssertionResult) string {
+	var text strings.Builder
+	if description := assertion.GetDescription(); description != "" {
+		fmt.Fprintf(&text, "%s\n", description)
+	}
+	if result.Expected != nil {
+		fmt.Fprintf(&text, "expected: %v\n", result.Expected)
+	}
+	if result.Actual != nil {
+		fmt.Fprintf(&text, "actual: %v\n", result.Actual)
+	}
+	return text.String()
+}
+
+// junitSeconds JUnit的time属性以秒为单位
+func junitSeconds(d time.Duration) string {
+	return fmt.Sprintf("%.6f", d.Seconds())
+}
@@ -0,0 +1,466 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 断言类型，对应YAML中的type字段
+const (
+	AssertionTypeMessageOrder      = "message_order"
+	AssertionTypeLatency           = "latency"
+	AssertionTypeReconnect         = "reconnect"
+	AssertionTypeErrorRate         = "error_rate"
+	AssertionTypeRecoveryTime      = "recovery_time"
+	AssertionTypePlannedFault      = "planned_fault"
+	AssertionTypeGoodput           = "goodput"
+	AssertionTypeTailLatencyBudget = "tail_latency_budget"
+	AssertionTypeBattleSequence    = "battle_sequence"
+	AssertionTypeStateHash         = "state_hash"
+	AssertionTypeUnitSanity        = "unit_sanity"
+)
+
+// 组合断言的运算符
+const (
+	CompositeAll = "all"
+	CompositeAny = "any"
+	CompositeNot = "not"
+)
+
+// AssertionSuiteSpec 断言套件的声明式描述，QA在YAML中编写，无需改动Go代码
+//
+//	name: battle smoke
+//	assertions:
+//	  - name: push latency
+//	    type: latency
+//	    max_latency: 200ms
+//	    percentile: 95
+//	    filter: {opcodes: [2001], from: 10s}
+//	  - name: stable or recovered
+//	    any:
+//	      - {type: reconnect, max_count: 0}
+//	      - {type: recovery_time, max_recovery_time: 3s}
+type AssertionSuiteSpec struct {
+	Name        string          `yaml:"name"`
+	Description string          `yaml:"description"`
+	Assertions  []AssertionSpec `yaml:"assertions"`
+}
+
+// AssertionSpec 单个断言的描述。type选择内置断言，all/any/not组合子断言，两者只能选其一；
+// filter在断言（或组合下的所有子断言）执行前过滤会话
+type AssertionSpec struct {
+	Name        string           `yaml:"name"`
+	Description string           `yaml:"description"`
+	Type        string           `yaml:"type"`
+	Filter      *AssertionFilter `yaml:"filter"`
+
+	// 内置断言参数，按类型取用
+	Opcode          uint16        `yaml:"opcode"`            // message_order
+	MinCount        int           `yaml:"min_count"`         // message_order
+	MaxCount        int           `yaml:"max_count"`         // message_order, reconnect
+	MaxLatency      time.Duration `yaml:"max_latency"`       // latency
+	Percentile      int           `yaml:"percentile"`        // latency，默认95
+	MaxDuration     time.Duration `yaml:"max_duration"`      // reconnect
+	MaxRate         float64       `yaml:"max_rate"`          // error_rate (0.0-1.0)
+	MaxRecoveryTime time.Duration `yaml:"max_recovery_time"` // recovery_time
+	ExemptionZone   int           `yaml:"exemption_zone"`    // planned_fault（消息数）
+	MinGoodput      float64       `yaml:"min_goodput"`       // goodput (msg/s)
+	Window          time.Duration `yaml:"window"`            // goodput，默认5s
+	Budget          time.Duration `yaml:"budget"`            // tail_latency_budget
+	WindowCount     int           `yaml:"window_count"`      // tail_latency_budget
+	MaxSpeed        float64       `yaml:"max_speed"`         // unit_sanity，0表示不检查速度
+	HealSkills      []int32       `yaml:"heal_skills"`       // unit_sanity
+	HealWindow      time.Duration `yaml:"heal_window"`       // unit_sanity，默认1s
+
+	// 组合
+	All []AssertionSpec `yaml:"all"`
+	Any []AssertionSpec `yaml:"any"`
+	Not *AssertionSpec  `yaml:"not"`
+}
+
+// AssertionFilter 断言执行前的会话过滤条件，未设置的条件不过滤。
+// 操作码和方向只作用于消息事件和帧，连接、重连、错误等事件保留，
+// 以便错误率和重连类断言在按操作码过滤后仍然可用
+type AssertionFilter struct {
+	Opcodes    []uint16    `yaml:"opcodes"`
+	Directions []string    `yaml:"directions"` // send / receive
+	EventTypes []EventType `yaml:"event_types"`
+	// From/To 时间窗口，相对会话开始时间，To为0表示到会话结束
+	From time.Duration `yaml:"from"`
+	To   time.Duration `yaml:"to"`
+}
+
+// ParseAssertionSuiteSpec 解析YAML断言套件，未知字段视为错误以便尽早发现拼写问题
+func ParseAssertionSuiteSpec(r io.Reader) (*AssertionSuiteSpec, error) {
+	decoder := yaml.NewDecoder(r)
+	decoder.KnownFields(true)
+
+	var spec AssertionSuiteSpec
+	if err := decoder.Decode(&spec); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("parse assertion suite: %w", err)
+	}
+	return &spec, nil
+}
+
+// LoadAssertionSuite 从YAML文件加载并构建断言套件
+func LoadAssertionSuite(path string) (*AssertionSuite, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	spec, err := ParseAssertionSuiteSpec(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	suite, err := spec.Build()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return suite, nil
+}
+
+// Build 校验描述并构建断言套件，错误信息带有断言在文件中的路径
+func (s *AssertionSuiteSpec) Build() (*AssertionSuite, error) {
+	if len(s.Assertions) == 0 {
+		return nil, errors.New("assertion suite has no assertions")
+	}
+	suite := NewAssertionSuite(s.Name, s.Description)
+	for i := range s.Assertions {
+		assertion, err := s.Assertions[i].build(fmt.Sprintf("assertions[%d]", i))
+		if err != nil {
+			return nil, err
+		}
+		suite.AddAssertion(assertion)
+	}
+	return suite, nil
+}
+
+// Build 构建单个断言
+func (s *AssertionSpec) Build() (Assertion, error) {
+	return s.build("assertion")
+}
+
+// build 按类型或组合构建断言，path用于错误信息和默认名称
+func (s *AssertionSpec) build(path string) (Assertion, error) {
+	operator, children := s.composite()
+	switch {
+	case s.Type != "" && operator != "":
+		return nil, fmt.Errorf("%s: type %q cannot be combined with %s", path, s.Type, operator)
+	case s.Type == "" && operator == "":
+		return nil, fmt.Errorf("%s: either type or one of all/any/not is required", path)
+	case len(s.All) > 0 && (len(s.Any) > 0 || s.Not != nil), len(s.Any) > 0 && s.Not != nil:
+		return nil, fmt.Errorf("%s: only one of all/any/not may be set", path)
+	}
+	if err := s.Filter.validate(); err != nil {
+		return nil, fmt.Errorf("%s: filter: %w", path, err)
+	}
+
+	name := s.Name
+	if name == "" {
+		name = path
+	}
+
+	var assertion Assertion
+	if operator != "" {
+		composite := NewCompositeAssertion(name, s.Description, operator)
+		for i := range children {
+			child, err := children[i].build(fmt.Sprintf("%s.%s[%d]", path, operator, i))
+			if err != nil {
+				return nil, err
+			}
+			composite.AddAssertion(child)
+		}
+		assertion = composite
+	} else {
+		builder, ok := assertionBuilders[s.Type]
+		if !ok {
+			return nil, fmt.Errorf("%s: unknown assertion type %q", path, s.Type)
+		}
+		built, err := builder(s, name)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", path, s.Type, err)
+		}
+		assertion = built
+	}
+
+	if s.Filter != nil {
+		assertion = &filteredAssertion{Assertion: assertion, filter: s.Filter}
+	}
+	return assertion, nil
+}
+
+// composite 返回组合运算符和子断言，not视为只有一个子断言的组合
+func (s *AssertionSpec) composite() (string, []AssertionSpec) {
+	switch {
+	case len(s.All) > 0:
+		return CompositeAll, s.All
+	case len(s.Any) > 0:
+		return CompositeAny, s.Any
+	case s.Not != nil:
+		return CompositeNot, []AssertionSpec{*s.Not}
+	}
+	return "", nil
+}
+
+// assertionBuilders 内置断言类型到构造函数的映射，参数校验在这里完成
+var assertionBuilders = map[string]func(spec *AssertionSpec, name string) (Assertion, error){
+	AssertionTypeMessageOrder: func(spec *AssertionSpec, name string) (Assertion, error) {
+		if spec.Opcode == 0 {
+			return nil, errors.New("opcode is required")
+		}
+		if spec.MaxCount > 0 && spec.MaxCount < spec.MinCount {
+			return nil, fmt.Errorf("max_count %d is below min_count %d", spec.MaxCount, spec.MinCount)
+		}
+		return NewMessageOrderAssertion(name, spec.Description, spec.Opcode, spec.MinCount, spec.MaxCount), nil
+	},
+	AssertionTypeLatency: func(spec *AssertionSpec, name string) (Assertion, error) {
+		percentile := spec.Percentile
+		if percentile == 0 {
+			percentile = 95
+		}
+		if spec.MaxLatency <= 0 {
+			return nil, errors.New("max_latency must be positive")
+		}
+		if percentile < 1 || percentile > 100 {
+			return nil, fmt.Errorf("percentile %d out of range 1-100", percentile)
+		}
+		return NewLatencyAssertion(name, spec.Description, spec.MaxLatency, percentile), nil
+	},
+	AssertionTypeReconnect: func(spec *AssertionSpec, name string) (Assertion, error) {
+		if spec.MaxCount < 0 || spec.MaxDuration < 0 {
+			return nil, errors.New("max_count and max_duration must not be negative")
+		}
+		return NewReconnectAssertion(name, spec.Description, spec.MaxCount, spec.MaxDuration), nil
+	},
+	AssertionTypeErrorRate: func(spec *AssertionSpec, name string) (Assertion, error) {
+		if spec.MaxRate < 0 || spec.MaxRate > 1 {
+			return nil, fmt.Errorf("max_rate %v out of range 0-1", spec.MaxRate)
+		}
+		return NewErrorRateAssertion(name, spec.Description, spec.MaxRate), nil
+	},
+	AssertionTypeRecoveryTime: func(spec *AssertionSpec, name string) (Assertion, error) {
+		if spec.MaxRecoveryTime <= 0 {
+			return nil, errors.New("max_recovery_time must be positive")
+		}
+		return NewRecoveryTimeAssertion(name, spec.Description, spec.MaxRecoveryTime), nil
+	},
+	AssertionTypePlannedFault: func(spec *AssertionSpec, name string) (Assertion, error) {
+		if spec.ExemptionZone <= 0 {
+			return nil, errors.New("exemption_zone must be positive")
+		}
+		return NewPlannedFaultExemptionAssertion(name, spec.Description, spec.ExemptionZone), nil
+	},
+	AssertionTypeGoodput: func(spec *AssertionSpec, name string) (Assertion, error) {
+		window := spec.Window
+		if window == 0 {
+			window = 5 * time.Second
+		}
+		if spec.MinGoodput <= 0 || window < 0 {
+			return nil, errors.New("min_goodput and window must be positive")
+		}
+		return NewGoodputAssertion(name, spec.Description, spec.MinGoodput, window), nil
+	},
+	AssertionTypeTailLatencyBudget: func(spec *AssertionSpec, name string) (Assertion, error) {
+		if spec.Budget <= 0 {
+			return nil, errors.New("budget must be positive")
+		}
+		return NewTailLatencyBudgetAssertion(name, spec.Description, spec.Budget, spec.WindowCount), nil
+	},
+	AssertionTypeBattleSequence: func(spec *AssertionSpec, name string) (Assertion, error) {
+		return NewBattleSequenceAssertion(name, spec.Description), nil
+	},
+	AssertionTypeStateHash: func(spec *AssertionSpec, name string) (Assertion, error) {
+		return NewStateHashAgreementAssertion(name, spec.Description), nil
+	},
+	AssertionTypeUnitSanity: func(spec *AssertionSpec, name string) (Assertion, error) {
+		if spec.MaxSpeed < 0 || spec.HealWindow < 0 {
+			return nil, errors.New("max_speed and heal_window must not be negative")
+		}
+		assertion := NewUnitSanityAssertion(name, spec.Description, spec.MaxSpeed)
+		assertion.HealSkills = spec.HealSkills
+		if spec.HealWindow > 0 {
+			assertion.HealWindow = spec.HealWindow
+		}
+		return assertion, nil
+	},
+}
+
+// validate 校验过滤条件，nil表示不过滤
+func (f *AssertionFilter) validate() error {
+	if f == nil {
+		return nil
+	}
+	for _, direction := range f.Directions {
+		if direction != "send" && direction != "receive" {
+			return fmt.Errorf("unknown direction %q", direction)
+		}
+	}
+	if f.From < 0 || f.To < 0 || (f.To > 0 && f.To <= f.From) {
+		return fmt.Errorf("invalid time window [%v, %v)", f.From, f.To)
+	}
+	return nil
+}
+
+// Apply 返回只包含匹配事件和帧的会话副本，原会话不变
+func (f *AssertionFilter) Apply(session *Session) *Session {
+	if f == nil {
+		return session
+	}
+	origin := session.StartTime
+	if origin.IsZero() && len(session.Events) > 0 && session.Events[0] != nil {
+		origin = session.Events[0].Timestamp
+	}
+
+	filtered := *session
+	filtered.Events = make([]*SessionEvent, 0, len(session.Events))
+	for _, event := range session.Events {
+		if event != nil && f.matchEvent(event, origin) {
+			filtered.Events = append(filtered.Events, event)
+		}
+	}
+	filtered.Frames = make([]*MessageFrame, 0, len(session.Frames))
+	for _, frame := range session.Frames {
+		if frame != nil && f.matchMessage(frame.Opcode, frame.Direction) && f.inWindow(frame.Timestamp, origin) {
+			filtered.Frames = append(filtered.Frames, frame)
+		}
+	}
+	return &filtered
+}
+
+// matchEvent 判断事件是否满足过滤条件
+func (f *AssertionFilter) matchEvent(event *SessionEvent, origin time.Time) bool {
+	if len(f.EventTypes) > 0 && !slices.Contains(f.EventTypes, event.Type) {
+		return false
+	}
+	if !f.inWindow(event.Timestamp, origin) {
+		return false
+	}
+	switch event.Type {
+	case EventMessageSend:
+		return f.matchMessage(event.Opcode, "send")
+	case EventMessageReceive:
+		return f.matchMessage(event.Opcode, "receive")
+	}
+	return true
+}
+
+// matchMessage 判断消息的操作码和方向是否满足过滤条件
+func (f *AssertionFilter) matchMessage(opcode uint16, direction string) bool {
+	if len(f.Opcodes) > 0 && !slices.Contains(f.Opcodes, opcode) {
+		return false
+	}
+	return len(f.Directions) == 0 || slices.Contains(f.Directions, direction)
+}
+
+// inWindow 判断时间戳是否在[From, To)窗口内
+func (f *AssertionFilter) inWindow(timestamp, origin time.Time) bool {
+	offset := timestamp.Sub(origin)
+	if offset < f.From {
+		return false
+	}
+	return f.To == 0 || offset < f.To
+}
+
+// filteredAssertion 在过滤后的会话上执行断言
+type filteredAssertion struct {
+	Assertion
+	filter *AssertionFilter
+}
+
+// Assert 执行断言
+func (a *filteredAssertion) Assert(session *Session) *AssertionResult {
+	return a.Assertion.Assert(a.filter.Apply(session))
+}
+
+// CompositeAssertion 组合断言：all要求全部通过，any要求至少一个通过，not要求唯一的子断言失败
+type CompositeAssertion struct {
+	Name        string
+	Description string
+	Operator    string
+	Assertions  []Assertion
+}
+
+// NewCompositeAssertion 创建组合断言
+func NewCompositeAssertion(name, description, operator string) *CompositeAssertion {
+	return &CompositeAssertion{
+		Name:        name,
+		Description: description,
+		Operator:    operator,
+		Assertions:  make([]Assertion, 0),
+	}
+}
+
+// AddAssertion 添加子断言
+func (a *CompositeAssertion) AddAssertion(assertion Assertion) {
+	a.Assertions = append(a.Assertions, assertion)
+}
+
+// Assert 执行组合断言，子断言的结果汇总在Actual中
+func (a *CompositeAssertion) Assert(session *Session) *AssertionResult {
+	start := time.Now()
+
+	passed := 0
+	details := make([]string, 0, len(a.Assertions))
+	for _, assertion := range a.Assertions {
+		result := assertion.Assert(session)
+		status := "FAIL"
+		if result.Passed {
+			passed++
+			status = "PASS"
+		}
+		details = append(details, fmt.Sprintf("[%s] %s: %s", status, assertion.GetName(), result.Message))
+	}
+
+	var ok bool
+	var expected string
+	switch a.Operator {
+	case CompositeAll:
+		ok = passed == len(a.Assertions)
+		expected = fmt.Sprintf("all %d sub-assertions pass", len(a.Assertions))
+	case CompositeAny:
+		ok = passed > 0
+		expected = fmt.Sprintf("at least 1 of %d sub-assertions passes", len(a.Assertions))
+	case CompositeNot:
+		ok = len(a.Assertions) == 1 && passed == 0
+		expected = "sub-assertion fails"
+	default:
+		return &AssertionResult{
+			Passed:    false,
+			Message:   fmt.Sprintf("Unknown composite operator %q", a.Operator),
+			Timestamp: time.Now(),
+			Duration:  time.Since(start),
+		}
+	}
+
+	verdict := "passed"
+	if !ok {
+		verdict = "failed"
+	}
+	return &AssertionResult{
+		Passed:    ok,
+		Message:   fmt.Sprintf("Composite %s assertion %s: %d/%d sub-assertions passed", a.Operator, verdict, passed, len(a.Assertions)),
+		Expected:  expected,
+		Actual:    strings.Join(details, "\n"),
+		Timestamp: time.Now(),
+		Duration:  time.Since(start),
+	}
+}
+
+// GetName 获取断言名称
+func (a *CompositeAssertion) GetName() string {
+	return a.Name
+}
+
+// GetDescription 获取断言描述
+func (a *CompositeAssertion) GetDescription() string {
+	return a.Description
+}
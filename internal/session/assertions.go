@@ -552,10 +552,10 @@ func NewPlannedFaultExemptionAssertion(name, description string, exemptionZoneLe
 func (a *PlannedFaultExemptionAssertion) Assert(session *Session) *AssertionResult {
 	start := time.Now()
 
-	// 查找故障注入点（重连事件）
+	// 查找故障注入点（重连事件或服务端注入的故障）
 	var faultPoints []time.Time
 	for _, event := range session.Events {
-		if event.Type == EventReconnect {
+		if event.Type == EventReconnect || event.Type == EventFaultInjected {
 			faultPoints = append(faultPoints, event.Timestamp)
 		}
 	}
@@ -0,0 +1,356 @@
+package session
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	"GoSlgBenchmarkTest/internal/protocol"
+	gamev1 "GoSlgBenchmarkTest/proto/game/v1"
+)
+
+// maxListedViolations 断言结果中最多列出的违规条数，完整数量写在消息中
+const maxListedViolations = 10
+
+// battlePushRecord 会话中收到的一条战斗推送
+type battlePushRecord struct {
+	push      *gamev1.BattlePush
+	frame     *MessageFrame
+	sessionID string
+}
+
+// collectBattlePushes 按录制顺序解码会话中收到的战斗推送，无法解码的帧记为违规
+func collectBattlePushes(session *Session) ([]battlePushRecord, []string) {
+	var records []battlePushRecord
+	var violations []string
+	for i, frame := range session.Frames {
+		if frame == nil || frame.Direction != "receive" || frame.Opcode != protocol.OpBattlePush {
+			continue
+		}
+		push := &gamev1.BattlePush{}
+		if err := proto.Unmarshal(frame.Body, push); err != nil {
+			violations = append(violations, fmt.Sprintf("session %s frame #%d: undecodable battle push: %v", session.ID, i, err))
+			continue
+		}
+		records = append(records, battlePushRecord{push: push, frame: frame, sessionID: session.ID})
+	}
+	return records, violations
+}
+
+// violationResult 根据违规列表生成断言结果
+func violationResult(start time.Time, violations []string, expected, failed, passed string) *AssertionResult {
+	if len(violations) == 0 {
+		return &AssertionResult{
+			Passed:    true,
+			Message:   passed,
+			Expected:  expected,
+			Actual:    "no violations",
+			Timestamp: time.Now(),
+			Duration:  time.Since(start),
+		}
+	}
+
+	listed := violations
+	if len(listed) > maxListedViolations {
+		listed = append(listed[:maxListedViolations:maxListedViolations], fmt.Sprintf("... %d more", len(violations)-maxListedViolations))
+	}
+	return &AssertionResult{
+		Passed:    false,
+		Message:   fmt.Sprintf("%s: %d violations", failed, len(violations)),
+		Expected:  expected,
+		Actual:    strings.Join(listed, "\n"),
+		Timestamp: time.Now(),
+		Duration:  time.Since(start),
+	}
+}
+
+// BattleSequenceAssertion 战斗序列号断言 - 同一战斗的推送序列号严格递增
+type BattleSequenceAssertion struct {
+	Name        string
+	Description string
+}
+
+// NewBattleSequenceAssertion 创建战斗序列号断言
+func NewBattleSequenceAssertion(name, description string) *BattleSequenceAssertion {
+	return &BattleSequenceAssertion{
+		Name:        name,
+		Description: description,
+	}
+}
+
+// Assert 执行战斗序列号断言，按接收顺序检查，重复的序列号也视为违规
+func (a *BattleSequenceAssertion) Assert(session *Session) *AssertionResult {
+	start := time.Now()
+
+	records, violations := collectBattlePushes(session)
+	lastSeq := make(map[string]uint64)
+	for _, record := range records {
+		battleID, seq := record.push.GetBattleId(), record.push.GetSeq()
+		if last, ok := lastSeq[battleID]; ok && seq <= last {
+			violations = append(violations, fmt.Sprintf("battle %s: seq %d received after %d at %s",
+				battleID, seq, last, record.frame.Timestamp.Format(time.RFC3339Nano)))
+			continue
+		}
+		lastSeq[battleID] = seq
+	}
+
+	return violationResult(start, violations, "strictly increasing seq per battle_id",
+		"Battle sequence assertion failed",
+		fmt.Sprintf("Battle sequence assertion passed: %d pushes across %d battles in order", len(records), len(lastSeq)))
+}
+
+// GetName 获取断言名称
+func (a *BattleSequenceAssertion) GetName() string {
+	return a.Name
+}
+
+// GetDescription 获取断言描述
+func (a *BattleSequenceAssertion) GetDescription() string {
+	return a.Description
+}
+
+// StateHashAgreementAssertion 状态哈希一致性断言 - 同一战斗同一序列号的状态哈希在所有客户端上相同。
+// 被断言的会话与Peers（同一场战斗中其他客户端的录制）一起比较；没有Peers时只检查会话内的重复推送
+type StateHashAgreementAssertion struct {
+	Name        string
+	Description string
+	Peers       []*Session
+}
+
+// NewStateHashAgreementAssertion 创建状态哈希一致性断言
+func NewStateHashAgreementAssertion(name, description string, peers ...*Session) *StateHashAgreementAssertion {
+	return &StateHashAgreementAssertion{
+		Name:        name,
+		Description: description,
+		Peers:       peers,
+	}
+}
+
+// Assert 执行状态哈希一致性断言
+func (a *StateHashAgreementAssertion) Assert(session *Session) *AssertionResult {
+	start := time.Now()
+
+	type stateKey struct {
+		battleID string
+		seq      uint64
+	}
+	type observation struct {
+		hash      []byte
+		sessionID string
+		shared    bool
+	}
+
+	var violations []string
+	observed := make(map[stateKey]*observation)
+	for _, recorded := range append([]*Session{session}, a.Peers...) {
+		if recorded == nil {
+			continue
+		}
+		records, undecodable := collectBattlePushes(recorded)
+		violations = append(violations, undecodable...)
+		for _, record := range records {
+			key := stateKey{record.push.GetBattleId(), record.push.GetSeq()}
+			hash := record.push.GetStateHash()
+			first, ok := observed[key]
+			if !ok {
+				observed[key] = &observation{hash: hash, sessionID: record.sessionID}
+				continue
+			}
+			if record.sessionID != first.sessionID {
+				first.shared = true
+			}
+			if !bytes.Equal(first.hash, hash) {
+				violations = append(violations, fmt.Sprintf("battle %s seq %d: %s=%x, %s=%x",
+					key.battleID, key.seq, first.sessionID, first.hash, record.sessionID, hash))
+			}
+		}
+	}
+
+	shared := 0
+	for _, state := range observed {
+		if state.shared {
+			shared++
+		}
+	}
+
+	return violationResult(start, violations, "identical state_hash for the same battle_id and seq",
+		"State hash agreement assertion failed",
+		fmt.Sprintf("State hash agreement assertion passed: %d battle states, %d seen by multiple sessions", len(observed), shared))
+}
+
+// GetName 获取断言名称
+func (a *StateHashAgreementAssertion) GetName() string {
+	return a.Name
+}
+
+// GetDescription 获取断言描述
+func (a *StateHashAgreementAssertion) GetDescription() string {
+	return a.Description
+}
+
+// UnitSanityAssertion 单位状态合理性断言 - 没有治疗时血量不应增加，移动速度不超过上限
+type UnitSanityAssertion struct {
+	Name        string
+	Description string
+	MaxSpeed    float64       // 最大移动速度（坐标单位/秒），0表示不检查
+	HealSkills  []int32       // 视为治疗的技能ID，为空表示所有技能都可能治疗
+	HealWindow  time.Duration // 治疗操作生效的时间窗口：推送前该时间内的治疗可以解释血量增加
+	Peers       []*Session    // 同一战斗中其他客户端的录制，其中的治疗操作同样有效
+}
+
+// NewUnitSanityAssertion 创建单位状态合理性断言
+func NewUnitSanityAssertion(name, description string, maxSpeed float64) *UnitSanityAssertion {
+	return &UnitSanityAssertion{
+		Name:        name,
+		Description: description,
+		MaxSpeed:    maxSpeed,
+		HealWindow:  time.Second,
+	}
+}
+
+// healAction 一次可能的治疗操作
+type healAction struct {
+	at      time.Time
+	targets []string // 为空表示目标未知，可能作用于任何单位
+}
+
+// unitState 单位在上一条推送中的状态
+type unitState struct {
+	hp       int32
+	position *gamev1.Position
+	at       time.Time
+	seq      uint64
+}
+
+// Assert 执行单位状态合理性断言
+func (a *UnitSanityAssertion) Assert(session *Session) *AssertionResult {
+	start := time.Now()
+
+	var heals []healAction
+	for _, recorded := range append([]*Session{session}, a.Peers...) {
+		if recorded != nil {
+			heals = append(heals, a.collectHeals(recorded)...)
+		}
+	}
+
+	records, violations := collectBattlePushes(session)
+	states := make(map[string]*unitState)
+	for _, record := range records {
+		at := record.frame.Timestamp
+		if record.push.GetTimestamp() > 0 {
+			at = time.UnixMilli(record.push.GetTimestamp())
+		}
+
+		for _, unit := range record.push.GetUnits() {
+			key := record.push.GetBattleId() + "/" + unit.GetUnitId()
+			previous := states[key]
+			states[key] = &unitState{hp: unit.GetHp(), position: unit.GetPosition(), at: at, seq: record.push.GetSeq()}
+			if previous == nil {
+				continue
+			}
+
+			if unit.GetHp() > previous.hp && !a.healed(heals, unit.GetUnitId(), record.frame.Timestamp) {
+				violations = append(violations, fmt.Sprintf("battle %s unit %s: hp %d -> %d without heal (seq %d -> %d)",
+					record.push.GetBattleId(), unit.GetUnitId(), previous.hp, unit.GetHp(), previous.seq, record.push.GetSeq()))
+			}
+
+			elapsed := at.Sub(previous.at)
+			if a.MaxSpeed <= 0 || previous.position == nil || unit.GetPosition() == nil || elapsed <= 0 {
+				continue
+			}
+			distance := positionDistance(previous.position, unit.GetPosition())
+			if speed := distance / elapsed.Seconds(); speed > a.MaxSpeed {
+				violations = append(violations, fmt.Sprintf("battle %s unit %s: moved %.2f in %v (%.2f/s > %.2f/s, seq %d -> %d)",
+					record.push.GetBattleId(), unit.GetUnitId(), distance, elapsed, speed, a.MaxSpeed, previous.seq, record.push.GetSeq()))
+			}
+		}
+	}
+
+	expected := "hp increases only after heal"
+	if a.MaxSpeed > 0 {
+		expected += fmt.Sprintf(", speed ≤ %.2f/s", a.MaxSpeed)
+	}
+	return violationResult(start, violations, expected,
+		"Unit sanity assertion failed",
+		fmt.Sprintf("Unit sanity assertion passed: %d units checked across %d pushes", len(states), len(records)))
+}
+
+// collectHeals 收集会话中的治疗操作（发送的操作和收到的操作响应）
+func (a *UnitSanityAssertion) collectHeals(session *Session) []healAction {
+	var heals []healAction
+	for _, frame := range session.Frames {
+		if frame == nil || (frame.Opcode != protocol.OpPlayerAction && frame.Opcode != protocol.OpActionResp) {
+			continue
+		}
+		action := &gamev1.PlayerAction{}
+		if err := proto.Unmarshal(frame.Body, action); err != nil || action.GetActionType() != gamev1.ActionType_ACTION_TYPE_SKILL {
+			continue
+		}
+		skill := action.GetActionData().GetSkill()
+		if len(a.HealSkills) > 0 && !slices.Contains(a.HealSkills, skill.GetSkillId()) {
+			continue
+		}
+		heals = append(heals, healAction{at: frame.Timestamp, targets: skill.GetTargetUnitIds()})
+	}
+	return heals
+}
+
+// healed 判断推送时刻之前的治疗窗口内是否有作用于该单位的治疗
+func (a *UnitSanityAssertion) healed(heals []healAction, unitID string, at time.Time) bool {
+	for _, heal := range heals {
+		if heal.at.After(at) || at.Sub(heal.at) > a.HealWindow {
+			continue
+		}
+		if len(heal.targets) == 0 || slices.Contains(heal.targets, unitID) {
+			return true
+		}
+	}
+	return false
+}
+
+// positionDistance 两个位置之间的直线距离
+func positionDistance(from, to *gamev1.Position) float64 {
+	dx := float64(to.GetX() - from.GetX())
+	dy := float64(to.GetY() - from.GetY())
+	dz := float64(to.GetZ() - from.GetZ())
+	return math.Sqrt(dx*dx + dy*dy + dz*dz)
+}
+
+// GetName 获取断言名称
+func (a *UnitSanityAssertion) GetName() string {
+	return a.Name
+}
+
+// GetDescription 获取断言描述
+func (a *UnitSanityAssertion) GetDescription() string {
+	return a.Description
+}
+
+// AttachPeers 为套件中（包括组合断言内）的跨客户端断言设置其他客户端的录制，
+// 用于YAML套件这类无法在描述中引用其他会话的场景。Peers不经过断言的过滤条件
+func (s *AssertionSuite) AttachPeers(peers ...*Session) {
+	for _, assertion := range s.Assertions {
+		attachPeers(assertion, peers)
+	}
+}
+
+// attachPeers 递归设置跨客户端断言的Peers
+func attachPeers(assertion Assertion, peers []*Session) {
+	switch a := assertion.(type) {
+	case *StateHashAgreementAssertion:
+		a.Peers = peers
+	case *UnitSanityAssertion:
+		a.Peers = peers
+	case *filteredAssertion:
+		attachPeers(a.Assertion, peers)
+	case *CompositeAssertion:
+		for _, child := range a.Assertions {
+			attachPeers(child, peers)
+		}
+	}
+}
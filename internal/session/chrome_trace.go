@@ -0,0 +1,383 @@
+package session
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"GoSlgBenchmarkTest/internal/protocol"
+)
+
+// ChromeTraceOptions Chrome trace导出选项
+type ChromeTraceOptions struct {
+	// RequestResponse 请求操作码到响应操作码的映射，按先进先出配对为请求→响应区间；nil使用默认映射
+	RequestResponse map[uint16]uint16
+	// OmitMessages 不输出未配对消息（如战斗推送）的即时事件，长录制时可显著减小文件
+	OmitMessages bool
+}
+
+// DefaultRequestResponseOpcodes 默认的请求→响应操作码映射
+func DefaultRequestResponseOpcodes() map[uint16]uint16 {
+	return protocol.RequestResponseOpcodes()
+}
+
+// TraceEvent Chrome trace事件（Trace Event Format），时间单位为微秒
+type TraceEvent struct {
+	Name      string                 `json:"name"`
+	Category  string                 `json:"cat,omitempty"`
+	Phase     string                 `json:"ph"`
+	Timestamp float64                `json:"ts"`
+	Duration  float64                `json:"dur,omitempty"`
+	PID       int                    `json:"pid"`
+	TID       int                    `json:"tid"`
+	ID        string                 `json:"id,omitempty"`
+	Scope     string                 `json:"s,omitempty"`
+	Args      map[string]interface{} `json:"args,omitempty"`
+}
+
+// ChromeTrace 可直接在Perfetto或chrome://tracing中打开的trace文件
+type ChromeTrace struct {
+	TraceEvents     []*TraceEvent          `json:"traceEvents"`
+	DisplayTimeUnit string                 `json:"displayTimeUnit"`
+	OtherData       map[string]interface{} `json:"otherData,omitempty"`
+}
+
+// Chrome trace事件阶段
+const (
+	tracePhaseComplete   = "X"
+	tracePhaseInstant    = "i"
+	tracePhaseAsyncBegin = "b"
+	tracePhaseAsyncEnd   = "e"
+	tracePhaseCounter    = "C"
+	tracePhaseMetadata   = "M"
+)
+
+// WriteChromeTrace 将时间线导出为Chrome trace JSON
+func (a *TimelineAnalyzer) WriteChromeTrace(w io.Writer, options *ChromeTraceOptions) error {
+	return WriteChromeTrace(w, []*Session{a.session}, options)
+}
+
+// WriteChromeTrace 将多个会话（如同一战斗中的多个玩家）导出到同一个Chrome trace JSON
+func WriteChromeTrace(w io.Writer, sessions []*Session, options *ChromeTraceOptions) error {
+	return json.NewEncoder(w).Encode(BuildChromeTrace(sessions, options))
+}
+
+// BuildChromeTrace 构建Chrome trace。每个会话是一个进程（玩家），每条连接是一个线程轨道，
+// 连接在重连或断开后的再次连接处切分；请求→响应为异步区间，RTT为计数器轨道，
+// 重连、错误、心跳、关闭等为即时事件
+func BuildChromeTrace(sessions []*Session, options *ChromeTraceOptions) *ChromeTrace {
+	if options == nil {
+		options = &ChromeTraceOptions{}
+	}
+	pairs := options.RequestResponse
+	if pairs == nil {
+		pairs = DefaultRequestResponseOpcodes()
+	}
+
+	// 所有会话共用时间原点，便于对齐多个玩家
+	var origin time.Time
+	for _, session := range sessions {
+		for _, event := range session.Events {
+			if event != nil && (origin.IsZero() || event.Timestamp.Before(origin)) {
+				origin = event.Timestamp
+			}
+		}
+	}
+
+	trace := &ChromeTrace{
+		TraceEvents:     make([]*TraceEvent, 0),
+		DisplayTimeUnit: "ms",
+		OtherData:       map[string]interface{}{"origin": origin},
+	}
+	for i, session := range sessions {
+		builder := &traceBuilder{
+			trace:   trace,
+			pid:     i + 1,
+			origin:  origin,
+			pairs:   pairs,
+			options: options,
+			pending: make(map[uint16][]*pendingRequest),
+		}
+		builder.addSession(session)
+	}
+	return trace
+}
+
+// pendingRequest 等待响应的请求
+type pendingRequest struct {
+	event      *SessionEvent
+	connection int
+}
+
+// traceBuilder 单个会话的trace构建状态
+type traceBuilder struct {
+	trace   *ChromeTrace
+	pid     int
+	origin  time.Time
+	pairs   map[uint16]uint16
+	options *ChromeTraceOptions
+
+	connection       int
+	connectionStart  time.Time
+	connectionEnd    time.Time // 断开或关闭的时间，零值表示连接仍然活跃
+	connectionReason string
+	lastTime         time.Time
+
+	pending  map[uint16][]*pendingRequest // 按期望的响应操作码排队
+	requests int
+}
+
+// addSession 按时间顺序输出会话的所有事件
+func (b *traceBuilder) addSession(session *Session) {
+	events := make([]*SessionEvent, 0, len(session.Events))
+	for _, event := range session.Events {
+		if event != nil {
+			events = append(events, event)
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Timestamp.Before(events[j].Timestamp)
+	})
+
+	b.metadata(0, "process_name", map[string]interface{}{"name": session.ID})
+	b.metadata(0, "process_sort_index", map[string]interface{}{"sort_index": b.pid})
+	if len(events) == 0 {
+		return
+	}
+	b.startConnection(events[0].Timestamp, "session start")
+
+	for _, event := range events {
+		b.addEvent(event)
+		b.lastTime = event.Timestamp
+	}
+	b.endConnection()
+
+	// 没有收到响应的请求
+	for _, queue := range b.pending {
+		for _, request := range queue {
+			b.instant(request.connection, request.event.Timestamp, "request",
+				opcodeName(request.event.Opcode)+" unanswered", "t", messageArgs(request.event))
+		}
+	}
+}
+
+// addEvent 输出单个事件
+func (b *traceBuilder) addEvent(event *SessionEvent) {
+	switch event.Type {
+	case EventReconnect:
+		b.endConnection()
+		b.startConnection(event.Timestamp, "reconnect")
+		b.instant(b.connection, event.Timestamp, "connection", "reconnect", "p", metadataArgs(event, "attempt", "duration", "success"))
+	case EventConnect:
+		if !b.connectionEnd.IsZero() {
+			b.endConnection()
+			b.startConnection(event.Timestamp, "connect")
+		}
+		b.instant(b.connection, event.Timestamp, "connection", "connect", "t", nil)
+	case EventDisconnect, EventClose:
+		if b.connectionEnd.IsZero() {
+			b.connectionEnd = event.Timestamp
+		}
+		name := "disconnect"
+		if event.Type == EventClose {
+			name = "close"
+		}
+		b.instant(b.connection, event.Timestamp, "connection", name, "t", metadataArgs(event, "close_code", "reason"))
+	case EventError:
+		args := metadataArgs(event, "error")
+		if event.Error != "" {
+			args["error"] = event.Error
+		}
+		b.instant(b.connection, event.Timestamp, "error", "error", "p", args)
+	case EventHeartbeat:
+		b.instant(b.connection, event.Timestamp, "heartbeat", "heartbeat", "t", nil)
+	case EventFaultInjected:
+		b.instant(b.connection, event.Timestamp, "fault", "fault injected", "p", metadataArgs(event, "fault_type"))
+	case EventFrameDropped:
+		b.instant(b.connection, event.Timestamp, "fault", "frame dropped", "t", messageArgs(event))
+	case EventMessageSend, EventMessageReceive:
+		b.addMessage(event)
+	default:
+		b.instant(b.connection, event.Timestamp, "event", string(event.Type), "t", nil)
+	}
+}
+
+// addMessage 配对请求和响应，其余消息输出为即时事件
+func (b *traceBuilder) addMessage(event *SessionEvent) {
+	heartbeat := event.Opcode == protocol.OpHeartbeat || event.Opcode == protocol.OpHeartbeatResp
+	if heartbeat {
+		b.instant(b.connection, event.Timestamp, "heartbeat", opcodeName(event.Opcode), "t", messageArgs(event))
+	}
+
+	if event.Type == EventMessageSend {
+		if response, ok := b.pairs[event.Opcode]; ok {
+			b.pending[response] = append(b.pending[response], &pendingRequest{event: event, connection: b.connection})
+			return
+		}
+	} else if request := b.takeRequest(event.Opcode); request != nil {
+		b.addRequestSpan(request, event, heartbeat)
+		return
+	} else if event.Duration > 0 {
+		// 录制时已测得往返时间的响应
+		b.counter(event.Timestamp, event.Duration)
+	}
+
+	if !heartbeat && !b.options.OmitMessages {
+		b.instant(b.connection, event.Timestamp, "message", opcodeName(event.Opcode), "t", messageArgs(event))
+	}
+}
+
+// takeRequest 取出响应对应的最早请求；错误响应对应所有类型中最早的请求
+func (b *traceBuilder) takeRequest(opcode uint16) *pendingRequest {
+	if opcode == protocol.OpError && len(b.pending[opcode]) == 0 {
+		var oldest uint16
+		found := false
+		for response, queue := range b.pending {
+			if len(queue) > 0 && (!found || queue[0].event.Timestamp.Before(b.pending[oldest][0].event.Timestamp)) {
+				oldest, found = response, true
+			}
+		}
+		if !found {
+			return nil
+		}
+		opcode = oldest
+	}
+
+	queue := b.pending[opcode]
+	if len(queue) == 0 {
+		return nil
+	}
+	b.pending[opcode] = queue[1:]
+	return queue[0]
+}
+
+// addRequestSpan 输出请求→响应区间和RTT计数器，心跳只记录RTT
+func (b *traceBuilder) addRequestSpan(request *pendingRequest, response *SessionEvent, heartbeat bool) {
+	rtt := response.Timestamp.Sub(request.event.Timestamp)
+	b.counter(response.Timestamp, rtt)
+	if heartbeat {
+		return
+	}
+
+	b.requests++
+	id := fmt.Sprintf("%d.%d", b.pid, b.requests)
+	name := opcodeName(request.event.Opcode)
+	args := messageArgs(request.event)
+	args["connection"] = request.connection
+	b.add(&TraceEvent{
+		Name: name, Category: "request", Phase: tracePhaseAsyncBegin, ID: id,
+		Timestamp: b.micros(request.event.Timestamp), PID: b.pid, TID: request.connection, Args: args,
+	})
+
+	endArgs := map[string]interface{}{
+		"response": opcodeName(response.Opcode),
+		"rtt_ms":   float64(rtt) / float64(time.Millisecond),
+	}
+	if response.Opcode == protocol.OpError {
+		endArgs["status"] = "error"
+	}
+	b.add(&TraceEvent{
+		Name: name, Category: "request", Phase: tracePhaseAsyncEnd, ID: id,
+		Timestamp: b.micros(response.Timestamp), PID: b.pid, TID: request.connection, Args: endArgs,
+	})
+}
+
+// startConnection 开始新的连接轨道
+func (b *traceBuilder) startConnection(at time.Time, reason string) {
+	b.connection++
+	b.connectionStart = at
+	b.connectionEnd = time.Time{}
+	b.connectionReason = reason
+	b.metadata(b.connection, "thread_name", map[string]interface{}{"name": fmt.Sprintf("connection %d", b.connection)})
+	b.metadata(b.connection, "thread_sort_index", map[string]interface{}{"sort_index": b.connection})
+}
+
+// endConnection 输出当前连接的生命周期区间
+func (b *traceBuilder) endConnection() {
+	end := b.connectionEnd
+	if end.IsZero() {
+		end = b.lastTime
+	}
+	if end.Before(b.connectionStart) {
+		end = b.connectionStart
+	}
+	b.add(&TraceEvent{
+		Name:      fmt.Sprintf("connection %d", b.connection),
+		Category:  "connection",
+		Phase:     tracePhaseComplete,
+		Timestamp: b.micros(b.connectionStart),
+		Duration:  b.micros(end) - b.micros(b.connectionStart),
+		PID:       b.pid,
+		TID:       b.connection,
+		Args:      map[string]interface{}{"started_by": b.connectionReason},
+	})
+}
+
+// instant 输出即时事件，scope为t（线程）或p（进程）
+func (b *traceBuilder) instant(tid int, at time.Time, category, name, scope string, args map[string]interface{}) {
+	if len(args) == 0 {
+		args = nil
+	}
+	b.add(&TraceEvent{
+		Name: name, Category: category, Phase: tracePhaseInstant, Scope: scope,
+		Timestamp: b.micros(at), PID: b.pid, TID: tid, Args: args,
+	})
+}
+
+// counter 输出RTT计数器样本
+func (b *traceBuilder) counter(at time.Time, rtt time.Duration) {
+	b.add(&TraceEvent{
+		Name: "RTT (ms)", Category: "latency", Phase: tracePhaseCounter,
+		Timestamp: b.micros(at), PID: b.pid,
+		Args: map[string]interface{}{"rtt": float64(rtt) / float64(time.Millisecond)},
+	})
+}
+
+// metadata 输出进程或线程的元数据
+func (b *traceBuilder) metadata(tid int, name string, args map[string]interface{}) {
+	b.add(&TraceEvent{Name: name, Phase: tracePhaseMetadata, PID: b.pid, TID: tid, Args: args})
+}
+
+func (b *traceBuilder) add(event *TraceEvent) {
+	b.trace.TraceEvents = append(b.trace.TraceEvents, event)
+}
+
+// micros 相对时间原点的微秒数
+func (b *traceBuilder) micros(t time.Time) float64 {
+	return float64(t.Sub(b.origin)) / float64(time.Microsecond)
+}
+
+// opcodeName 操作码的可读名称
+func opcodeName(opcode uint16) string {
+	if name := protocol.OpcodeToString(opcode); name != "UNKNOWN" {
+		return name
+	}
+	return fmt.Sprintf("opcode %d", opcode)
+}
+
+// messageArgs 消息事件的参数
+func messageArgs(event *SessionEvent) map[string]interface{} {
+	args := map[string]interface{}{"opcode": event.Opcode}
+	if event.MessageSize > 0 {
+		args["size"] = event.MessageSize
+	} else if size, ok := event.Metadata["message_size"]; ok {
+		args["size"] = size
+	}
+	if messageType := eventMessageType(event); messageType != "" {
+		args["message_type"] = messageType
+	}
+	return args
+}
+
+// metadataArgs 从事件元数据中取出指定的参数
+func metadataArgs(event *SessionEvent, keys ...string) map[string]interface{} {
+	args := make(map[string]interface{})
+	for _, key := range keys {
+		if value, ok := event.Metadata[key]; ok {
+			args[key] = value
+		}
+	}
+	return args
+}
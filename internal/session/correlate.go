@@ -0,0 +1,106 @@
+package session
+
+import (
+	"crypto/sha256"
+	"time"
+)
+
+// FrameMatch 在发送端和接收端都被记录的同一帧
+type FrameMatch struct {
+	Opcode      uint16        `json:"opcode"`
+	SequenceNum uint64        `json:"sequence_num,omitempty"`
+	SentAt      time.Time     `json:"sent_at"`
+	ReceivedAt  time.Time     `json:"received_at"`
+	Delay       time.Duration `json:"delay"` // 单向延迟
+}
+
+// DirectionReport 单一方向的帧关联结果
+type DirectionReport struct {
+	Matched    []*FrameMatch   `json:"matched"`
+	Lost       []*MessageFrame `json:"lost"`       // 发送端有记录但接收端未收到
+	Unexpected []*MessageFrame `json:"unexpected"` // 接收端收到但发送端无记录（如被篡改或重复注入）
+	AvgDelay   time.Duration   `json:"avg_delay"`
+	MinDelay   time.Duration   `json:"min_delay"`
+	MaxDelay   time.Duration   `json:"max_delay"`
+}
+
+// CrossSessionReport 客户端与服务端录制的对比结果
+type CrossSessionReport struct {
+	Uplink   *DirectionReport `json:"uplink"`   // 客户端 -> 服务端
+	Downlink *DirectionReport `json:"downlink"` // 服务端 -> 客户端
+}
+
+// CorrelateSessions 按帧内容关联同一连接在客户端和服务端的录制，
+// 计算每个方向的单向延迟并找出丢失的帧。两端需使用同一时钟（如同机测试）
+func CorrelateSessions(client, server *Session) *CrossSessionReport {
+	return &CrossSessionReport{
+		Uplink:   correlateDirection(client.Frames, server.Frames),
+		Downlink: correlateDirection(server.Frames, client.Frames),
+	}
+}
+
+// correlateDirection 关联sender发出的帧与receiver收到的帧，相同内容按先进先出匹配
+func correlateDirection(senderFrames, receiverFrames []*MessageFrame) *DirectionReport {
+	report := &DirectionReport{
+		Matched:    make([]*FrameMatch, 0),
+		Lost:       make([]*MessageFrame, 0),
+		Unexpected: make([]*MessageFrame, 0),
+	}
+
+	pending := make(map[[sha256.Size]byte][]*MessageFrame)
+	var order []*MessageFrame
+	for _, frame := range senderFrames {
+		if frame.Direction != "send" {
+			continue
+		}
+		key := sha256.Sum256(frame.RawData)
+		pending[key] = append(pending[key], frame)
+		order = append(order, frame)
+	}
+
+	matched := make(map[*MessageFrame]bool)
+	var total time.Duration
+	for _, frame := range receiverFrames {
+		if frame.Direction != "receive" {
+			continue
+		}
+		key := sha256.Sum256(frame.RawData)
+		queue := pending[key]
+		if len(queue) == 0 {
+			report.Unexpected = append(report.Unexpected, frame)
+			continue
+		}
+
+		sent := queue[0]
+		pending[key] = queue[1:]
+		matched[sent] = true
+
+		delay := frame.Timestamp.Sub(sent.Timestamp)
+		report.Matched = append(report.Matched, &FrameMatch{
+			Opcode:      sent.Opcode,
+			SequenceNum: sent.SequenceNum,
+			SentAt:      sent.Timestamp,
+			ReceivedAt:  frame.Timestamp,
+			Delay:       delay,
+		})
+
+		total += delay
+		if report.MinDelay == 0 || delay < report.MinDelay {
+			report.MinDelay = delay
+		}
+		if delay > report.MaxDelay {
+			report.MaxDelay = delay
+		}
+	}
+
+	for _, frame := range order {
+		if !matched[frame] {
+			report.Lost = append(report.Lost, frame)
+		}
+	}
+
+	if len(report.Matched) > 0 {
+		report.AvgDelay = total / time.Duration(len(report.Matched))
+	}
+	return report
+}
@@ -0,0 +1,397 @@
+package session
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	"GoSlgBenchmarkTest/internal/protocol"
+	gamev1 "GoSlgBenchmarkTest/proto/game/v1"
+)
+
+// SessionDiffOptions 会话对比选项
+type SessionDiffOptions struct {
+	IgnoreRules []IgnoreRule `json:"ignore_rules"` // 对齐和比较消息时忽略的操作码和字段
+}
+
+// DefaultSessionDiffOptions 忽略时间戳、服务器分配的ID，以及数量取决于会话时长的心跳
+func DefaultSessionDiffOptions() *SessionDiffOptions {
+	return &SessionDiffOptions{
+		IgnoreRules: []IgnoreRule{
+			{Opcode: protocol.OpHeartbeat},
+			{Opcode: protocol.OpHeartbeatResp},
+			{Opcode: protocol.OpLoginReq, Fields: []string{"token"}},
+			{Opcode: protocol.OpLoginResp, Fields: []string{"player_id", "session_id", "server_time"}},
+			{Opcode: protocol.OpPlayerAction, Fields: []string{"player_id", "client_timestamp"}},
+			{Opcode: protocol.OpActionResp, Fields: []string{"player_id", "client_timestamp"}},
+			{Opcode: protocol.OpBattlePush, Fields: []string{"timestamp"}},
+		},
+	}
+}
+
+// DiffedMessage 只在一侧出现或顺序变化的消息
+type DiffedMessage struct {
+	Direction   string        `json:"direction"`
+	Opcode      uint16        `json:"opcode"`
+	Key         string        `json:"key"`          // 对齐键：序列号或同类消息中的序号
+	BaseIndex   int           `json:"base_index"`   // 在基准会话同方向消息中的位置，-1表示不存在
+	TargetIndex int           `json:"target_index"` // 在目标会话同方向消息中的位置，-1表示不存在
+	Frame       *MessageFrame `json:"frame"`
+}
+
+// PayloadDiff 对齐后消息体不一致的字段
+type PayloadDiff struct {
+	Direction string   `json:"direction"`
+	Opcode    uint16   `json:"opcode"`
+	Key       string   `json:"key"`
+	Fields    []string `json:"fields"`
+}
+
+// LatencyDistribution 某种请求的响应延迟分布
+type LatencyDistribution struct {
+	Count int           `json:"count"`
+	Mean  time.Duration `json:"mean"`
+	P50   time.Duration `json:"p50"`
+	P90   time.Duration `json:"p90"`
+	P99   time.Duration `json:"p99"`
+	Max   time.Duration `json:"max"`
+}
+
+// LatencyShift 某种请求在两个会话中的延迟分布变化
+type LatencyShift struct {
+	Opcode   uint16              `json:"opcode"`
+	Base     LatencyDistribution `json:"base"`
+	Target   LatencyDistribution `json:"target"`
+	P50Shift time.Duration       `json:"p50_shift"`
+	P90Shift time.Duration       `json:"p90_shift"`
+	P99Shift time.Duration       `json:"p99_shift"`
+}
+
+// SessionDiff 两个会话的语义差异
+type SessionDiff struct {
+	BaseID    string           `json:"base_id"`
+	TargetID  string           `json:"target_id"`
+	Matched   int              `json:"matched"`
+	Added     []*DiffedMessage `json:"added"`     // 只在目标会话中出现
+	Removed   []*DiffedMessage `json:"removed"`   // 只在基准会话中出现
+	Reordered []*DiffedMessage `json:"reordered"` // 两侧都有但相对顺序改变
+	Changed   []*PayloadDiff   `json:"changed"`
+	Latency   []*LatencyShift  `json:"latency"` // 按请求操作码排序
+}
+
+// Identical 两个会话的消息流一致（不考虑延迟变化）
+func (d *SessionDiff) Identical() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Reordered) == 0 && len(d.Changed) == 0
+}
+
+// alignedFrame 参与对齐的帧
+type alignedFrame struct {
+	frame *MessageFrame
+	key   string
+	index int // 在同方向消息中的位置
+}
+
+// DiffSessions 按方向、操作码和序列号对齐两个会话的消息流，报告增删、乱序、字段差异和延迟变化
+func DiffSessions(base, target *Session, options *SessionDiffOptions) *SessionDiff {
+	if options == nil {
+		options = DefaultSessionDiffOptions()
+	}
+
+	diff := &SessionDiff{
+		BaseID:    base.ID,
+		TargetID:  target.ID,
+		Added:     make([]*DiffedMessage, 0),
+		Removed:   make([]*DiffedMessage, 0),
+		Reordered: make([]*DiffedMessage, 0),
+		Changed:   make([]*PayloadDiff, 0),
+	}
+
+	for _, direction := range []string{"send", "receive"} {
+		diffDirection(diff, direction,
+			alignFrames(base.Frames, direction, options.IgnoreRules),
+			alignFrames(target.Frames, direction, options.IgnoreRules),
+			options.IgnoreRules)
+	}
+	diff.Latency = diffLatency(base, target)
+	return diff
+}
+
+// diffDirection 对比同一方向的消息
+func diffDirection(diff *SessionDiff, direction string, baseFrames, targetFrames []*alignedFrame, rules []IgnoreRule) {
+	targetByKey := make(map[string]*alignedFrame, len(targetFrames))
+	for _, aligned := range targetFrames {
+		targetByKey[aligned.key] = aligned
+	}
+
+	type pair struct{ base, target *alignedFrame }
+	pairs := make([]pair, 0, len(baseFrames))
+	matched := make(map[string]bool, len(baseFrames))
+	for _, aligned := range baseFrames {
+		other, ok := targetByKey[aligned.key]
+		if !ok {
+			diff.Removed = append(diff.Removed, newDiffedMessage(direction, aligned, nil))
+			continue
+		}
+		matched[aligned.key] = true
+		pairs = append(pairs, pair{aligned, other})
+
+		if fields := diffPayload(aligned.frame, other.frame, rules); len(fields) > 0 {
+			diff.Changed = append(diff.Changed, &PayloadDiff{
+				Direction: direction,
+				Opcode:    aligned.frame.Opcode,
+				Key:       aligned.key,
+				Fields:    fields,
+			})
+		}
+	}
+	for _, aligned := range targetFrames {
+		if !matched[aligned.key] {
+			diff.Added = append(diff.Added, newDiffedMessage(direction, nil, aligned))
+		}
+	}
+	diff.Matched += len(pairs)
+
+	// 按基准顺序排列后，目标位置的最长递增子序列之外的消息即为乱序
+	order := make([]int, len(pairs))
+	for i, p := range pairs {
+		order[i] = p.target.index
+	}
+	inOrder := longestIncreasing(order)
+	for i, p := range pairs {
+		if !inOrder[i] {
+			diff.Reordered = append(diff.Reordered, newDiffedMessage(direction, p.base, p.target))
+		}
+	}
+}
+
+// newDiffedMessage 构造差异消息，缺失的一侧位置为-1
+func newDiffedMessage(direction string, base, target *alignedFrame) *DiffedMessage {
+	message := &DiffedMessage{Direction: direction, BaseIndex: -1, TargetIndex: -1}
+	if base != nil {
+		message.Opcode, message.Key, message.BaseIndex, message.Frame = base.frame.Opcode, base.key, base.index, base.frame
+	}
+	if target != nil {
+		message.Opcode, message.Key, message.TargetIndex = target.frame.Opcode, target.key, target.index
+		if message.Frame == nil {
+			message.Frame = target.frame
+		}
+	}
+	return message
+}
+
+// alignFrames 为同方向的帧计算对齐键：带序列号的消息使用序列号，其余使用同操作码消息中的序号
+func alignFrames(frames []*MessageFrame, direction string, rules []IgnoreRule) []*alignedFrame {
+	aligned := make([]*alignedFrame, 0, len(frames))
+	occurrences := make(map[uint16]int)
+	seen := make(map[string]bool)
+	index := 0
+
+	for _, frame := range frames {
+		if frame.Direction != direction {
+			continue
+		}
+		position := index
+		index++
+		if ignoresWholeOpcode(rules, frame.Opcode) {
+			continue
+		}
+
+		key := ""
+		if seq := frameSequence(frame); seq != 0 {
+			key = fmt.Sprintf("%d/seq:%d", frame.Opcode, seq)
+		}
+		// 重复的序列号（如重发）退回按序号对齐
+		if key == "" || seen[key] {
+			key = fmt.Sprintf("%d/#%d", frame.Opcode, occurrences[frame.Opcode])
+			occurrences[frame.Opcode]++
+		}
+		seen[key] = true
+		aligned = append(aligned, &alignedFrame{frame: frame, key: key, index: position})
+	}
+	return aligned
+}
+
+// frameSequence 帧的序列号，优先使用录制时提取的值，操作响应从消息体中解析
+func frameSequence(frame *MessageFrame) uint64 {
+	if frame.SequenceNum != 0 {
+		return frame.SequenceNum
+	}
+	if frame.Opcode == protocol.OpActionResp {
+		action := &gamev1.PlayerAction{}
+		if proto.Unmarshal(frame.Body, action) == nil {
+			return action.ActionSeq
+		}
+	}
+	return protocol.MessageSequence(frame.Opcode, frame.Body)
+}
+
+// ignoresWholeOpcode 规则是否忽略该操作码的全部消息
+func ignoresWholeOpcode(rules []IgnoreRule, opcode uint16) bool {
+	for _, rule := range rules {
+		if rule.Opcode == opcode && len(rule.Fields) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// diffPayload 解码两帧的消息体，按忽略规则清除字段后逐字段比较
+func diffPayload(base, target *MessageFrame, rules []IgnoreRule) []string {
+	if base.Opcode != target.Opcode {
+		return []string{"<opcode>"}
+	}
+	baseMessage := protocol.NewMessage(base.Opcode)
+	targetMessage := protocol.NewMessage(target.Opcode)
+	if baseMessage == nil || proto.Unmarshal(base.Body, baseMessage) != nil ||
+		proto.Unmarshal(target.Body, targetMessage) != nil {
+		// 无法解码时按字节比较
+		if string(base.Body) != string(target.Body) {
+			return []string{"<body>"}
+		}
+		return nil
+	}
+
+	for _, rule := range rules {
+		if rule.Opcode != 0 && rule.Opcode != base.Opcode {
+			continue
+		}
+		for _, field := range rule.Fields {
+			path := strings.Split(field, ".")
+			clearField(baseMessage.ProtoReflect(), path)
+			clearField(targetMessage.ProtoReflect(), path)
+		}
+	}
+	return diffMessages(baseMessage.ProtoReflect(), targetMessage.ProtoReflect(), "")
+}
+
+// longestIncreasing 标记序列中属于某个最长递增子序列的元素
+func longestIncreasing(values []int) []bool {
+	member := make([]bool, len(values))
+	if len(values) == 0 {
+		return member
+	}
+
+	tails := make([]int, 0, len(values)) // tails[k] 长度为k+1的递增子序列的最小结尾下标
+	prev := make([]int, len(values))
+	for i, value := range values {
+		k := sort.Search(len(tails), func(j int) bool { return values[tails[j]] >= value })
+		if k > 0 {
+			prev[i] = tails[k-1]
+		} else {
+			prev[i] = -1
+		}
+		if k == len(tails) {
+			tails = append(tails, i)
+		} else {
+			tails[k] = i
+		}
+	}
+
+	for i := tails[len(tails)-1]; i >= 0; i = prev[i] {
+		member[i] = true
+	}
+	return member
+}
+
+// diffLatency 比较两个会话中每种请求的响应延迟分布
+func diffLatency(base, target *Session) []*LatencyShift {
+	baseLatencies := responseLatencies(base)
+	targetLatencies := responseLatencies(target)
+
+	opcodes := make([]int, 0, len(baseLatencies)+len(targetLatencies))
+	for opcode := range baseLatencies {
+		opcodes = append(opcodes, int(opcode))
+	}
+	for opcode := range targetLatencies {
+		if _, exists := baseLatencies[opcode]; !exists {
+			opcodes = append(opcodes, int(opcode))
+		}
+	}
+	sort.Ints(opcodes)
+
+	shifts := make([]*LatencyShift, 0, len(opcodes))
+	for _, op := range opcodes {
+		opcode := uint16(op)
+		shift := &LatencyShift{
+			Opcode: opcode,
+			Base:   newLatencyDistribution(baseLatencies[opcode]),
+			Target: newLatencyDistribution(targetLatencies[opcode]),
+		}
+		shift.P50Shift = shift.Target.P50 - shift.Base.P50
+		shift.P90Shift = shift.Target.P90 - shift.Base.P90
+		shift.P99Shift = shift.Target.P99 - shift.Base.P99
+		shifts = append(shifts, shift)
+	}
+	return shifts
+}
+
+// responseLatencies 将响应与请求配对，按请求操作码汇总延迟。响应带序列号时只按序列号配对，不带序列号时配对最早未响应的请求
+func responseLatencies(session *Session) map[uint16][]time.Duration {
+	pending := make(map[uint16][]*MessageFrame) // 响应操作码 -> 等待响应的请求
+	latencies := make(map[uint16][]time.Duration)
+
+	for _, frame := range session.Frames {
+		switch frame.Direction {
+		case "send":
+			if response, ok := protocol.ResponseOpcode(frame.Opcode); ok {
+				pending[response] = append(pending[response], frame)
+			}
+		case "receive":
+			queue := pending[frame.Opcode]
+			if len(queue) == 0 {
+				continue
+			}
+			match := 0
+			if seq := frameSequence(frame); seq != 0 {
+				// 序列号对不上任何等待中的请求时跳过，避免误配最早的请求
+				match = -1
+				for i, request := range queue {
+					if frameSequence(request) == seq {
+						match = i
+						break
+					}
+				}
+				if match < 0 {
+					continue
+				}
+			}
+			request := queue[match]
+			pending[frame.Opcode] = append(queue[:match:match], queue[match+1:]...)
+			latencies[request.Opcode] = append(latencies[request.Opcode], frame.Timestamp.Sub(request.Timestamp))
+		}
+	}
+	return latencies
+}
+
+// newLatencyDistribution 计算延迟分布
+func newLatencyDistribution(latencies []time.Duration) LatencyDistribution {
+	distribution := LatencyDistribution{Count: len(latencies)}
+	if len(latencies) == 0 {
+		return distribution
+	}
+
+	sorted := append([]time.Duration(nil), latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	var total time.Duration
+	for _, latency := range sorted {
+		total += latency
+	}
+	percentile := func(p int) time.Duration {
+		index := (len(sorted)*p+99)/100 - 1
+		if index < 0 {
+			index = 0
+		}
+		return sorted[index]
+	}
+
+	distribution.Mean = total / time.Duration(len(sorted))
+	distribution.P50 = percentile(50)
+	distribution.P90 = percentile(90)
+	distribution.P99 = percentile(99)
+	distribution.Max = sorted[len(sorted)-1]
+	return distribution
+}
@@ -0,0 +1,455 @@
+package session
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrSnapshotSuppressed 快照因限流、去重或数量上限被跳过
+var ErrSnapshotSuppressed = errors.New("session: snapshot suppressed")
+
+// 快照触发类型
+const (
+	TriggerError         = "error"
+	TriggerAbnormalClose = "close"
+	TriggerLatencySpike  = "latency"
+	TriggerAssertion     = "assertion"
+	TriggerManual        = "manual"
+)
+
+// FlightRecorderConfig 飞行记录器配置：只保留最近一段时间或一定大小的事件和帧，
+// 触发条件满足时将缓冲区写出为快照文件
+type FlightRecorderConfig struct {
+	Window      time.Duration       // 保留最近多长时间的记录（相对最新一条记录），0表示不按时间裁剪
+	MaxBytes    int64               // 缓冲区估算字节数上限，0表示不按大小裁剪
+	SnapshotDir string              // 快照目录
+	FileOptions *SessionFileOptions // 快照文件写入选项，nil使用默认选项
+
+	TriggerOnError         bool            // 错误事件
+	TriggerOnAbnormalClose bool            // 关闭代码不是1000
+	LatencyThreshold       time.Duration   // RecordLatency超过该值，0表示不检查
+	Assertions             *AssertionSuite // 定期对缓冲区运行的断言套件，失败时触发
+	AssertionInterval      time.Duration   // 断言检查间隔
+
+	MinInterval  time.Duration // 任意两次快照的最小间隔，0表示不限流
+	DedupWindow  time.Duration // 相同触发原因在该时间内只快照一次，0表示不去重
+	MaxSnapshots int           // 快照数量上限，0表示不限制
+
+	OnSnapshot func(snapshot FlightSnapshot) // 快照写出后回调（可选）
+}
+
+// DefaultFlightRecorderConfig 默认配置：保留最近10分钟、最多64MB，错误和异常关闭时快照，
+// 每分钟最多一次，相同原因10分钟内只快照一次
+func DefaultFlightRecorderConfig() *FlightRecorderConfig {
+	return &FlightRecorderConfig{
+		Window:                 10 * time.Minute,
+		MaxBytes:               64 << 20,
+		SnapshotDir:            "recordings/flight",
+		TriggerOnError:         true,
+		TriggerOnAbnormalClose: true,
+		AssertionInterval:      30 * time.Second,
+		MinInterval:            time.Minute,
+		DedupWindow:            10 * time.Minute,
+	}
+}
+
+// FlightSnapshot 已写出的快照
+type FlightSnapshot struct {
+	Path    string    `json:"path"`
+	Trigger string    `json:"trigger"`
+	Reason  string    `json:"reason"`
+	Time    time.Time `json:"time"`
+	Events  int       `json:"events"`
+	Frames  int       `json:"frames"`
+}
+
+// FlightRecorderStats 飞行记录器统计
+type FlightRecorderStats struct {
+	BufferedEvents int   `json:"buffered_events"`
+	BufferedFrames int   `json:"buffered_frames"`
+	BufferedBytes  int64 `json:"buffered_bytes"`
+	DroppedEvents  int64 `json:"dropped_events"`
+	DroppedFrames  int64 `json:"dropped_frames"`
+	Snapshots      int   `json:"snapshots"`
+	Suppressed     int   `json:"suppressed"`
+}
+
+// flightRecorder 飞行记录器状态。缓冲区字段由SessionRecorder.mu保护，快照状态由mu保护
+type flightRecorder struct {
+	config FlightRecorderConfig
+
+	bytes         int64
+	droppedEvents int64
+	droppedFrames int64
+
+	mu           sync.Mutex
+	lastSnapshot time.Time
+	lastByKey    map[string]time.Time
+	snapshots    []FlightSnapshot
+	suppressed   int
+	sequence     int
+	writing      chan struct{} // 正在写出的快照，写完后关闭；同一时间只写一个快照
+}
+
+// EnableFlightRecorder 切换到飞行记录器模式，已录制的内容按配置裁剪。
+// 与StreamTo流式写入互斥；配置了断言套件时在录制停止前定期检查
+func (r *SessionRecorder) EnableFlightRecorder(config *FlightRecorderConfig) error {
+	if config == nil {
+		config = DefaultFlightRecorderConfig()
+	}
+	switch {
+	case config.Window < 0 || config.MaxBytes < 0:
+		return fmt.Errorf("flight recorder window and max bytes must not be negative")
+	case config.Window == 0 && config.MaxBytes == 0:
+		return fmt.Errorf("flight recorder needs a window or a max bytes limit")
+	case config.SnapshotDir == "":
+		return fmt.Errorf("flight recorder snapshot dir is required")
+	case config.Assertions != nil && config.AssertionInterval <= 0:
+		return fmt.Errorf("flight recorder assertion interval must be positive")
+	}
+
+	r.mu.Lock()
+	if r.sink != nil {
+		r.mu.Unlock()
+		return fmt.Errorf("flight recorder cannot be combined with streaming to a session file")
+	}
+	if r.flight != nil {
+		r.mu.Unlock()
+		return fmt.Errorf("flight recorder is already enabled")
+	}
+	flight := &flightRecorder{config: *config, lastByKey: make(map[string]time.Time)}
+	for _, event := range r.events {
+		flight.bytes += estimateEventSize(event)
+	}
+	for _, frame := range r.frames {
+		flight.bytes += estimateFrameSize(frame)
+	}
+	r.flight = flight
+	r.trimFlightBufferLocked()
+	r.mu.Unlock()
+
+	if config.Assertions != nil {
+		go r.runFlightAssertions(config.Assertions, config.AssertionInterval)
+	}
+	return nil
+}
+
+// Snapshot 立即将缓冲区写出为快照（例如由控制接口调用），同样受限流和去重约束，
+// 已有快照正在写出时跳过
+func (r *SessionRecorder) Snapshot(reason string) (*FlightSnapshot, error) {
+	job, err := r.reserveSnapshot(TriggerManual, TriggerManual+":"+reason, reason)
+	if err != nil {
+		return nil, err
+	}
+	return job.run()
+}
+
+// WaitFlightSnapshots 等待后台正在写出的快照完成
+func (r *SessionRecorder) WaitFlightSnapshots() {
+	flight := r.flightRecorder()
+	if flight == nil {
+		return
+	}
+	flight.mu.Lock()
+	writing := flight.writing
+	flight.mu.Unlock()
+	if writing != nil {
+		<-writing
+	}
+}
+
+// FlightSnapshots 获取已写出的快照列表
+func (r *SessionRecorder) FlightSnapshots() []FlightSnapshot {
+	flight := r.flightRecorder()
+	if flight == nil {
+		return nil
+	}
+	flight.mu.Lock()
+	defer flight.mu.Unlock()
+	return slices.Clone(flight.snapshots)
+}
+
+// FlightStats 获取飞行记录器统计，未启用时返回nil
+func (r *SessionRecorder) FlightStats() *FlightRecorderStats {
+	r.mu.RLock()
+	flight := r.flight
+	if flight == nil {
+		r.mu.RUnlock()
+		return nil
+	}
+	stats := &FlightRecorderStats{
+		BufferedEvents: len(r.events),
+		BufferedFrames: len(r.frames),
+		BufferedBytes:  flight.bytes,
+		DroppedEvents:  flight.droppedEvents,
+		DroppedFrames:  flight.droppedFrames,
+	}
+	r.mu.RUnlock()
+
+	flight.mu.Lock()
+	defer flight.mu.Unlock()
+	stats.Snapshots = len(flight.snapshots)
+	stats.Suppressed = flight.suppressed
+	return stats
+}
+
+// flightRecorder 获取飞行记录器，未启用时返回nil
+func (r *SessionRecorder) flightRecorder() *flightRecorder {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.flight
+}
+
+// trimFlightBufferLocked 按时间窗口和大小上限丢弃最旧的记录，调用方需持有写锁
+func (r *SessionRecorder) trimFlightBufferLocked() {
+	flight := r.flight
+
+	if flight.config.Window > 0 {
+		var latest time.Time
+		if len(r.events) > 0 {
+			latest = r.events[len(r.events)-1].Timestamp
+		}
+		if len(r.frames) > 0 && r.frames[len(r.frames)-1].Timestamp.After(latest) {
+			latest = r.frames[len(r.frames)-1].Timestamp
+		}
+		cutoff := latest.Add(-flight.config.Window)
+		for len(r.events) > 0 && r.events[0].Timestamp.Before(cutoff) {
+			r.dropOldestEventLocked()
+		}
+		for len(r.frames) > 0 && r.frames[0].Timestamp.Before(cutoff) {
+			r.dropOldestFrameLocked()
+		}
+	}
+
+	if flight.config.MaxBytes > 0 {
+		for flight.bytes > flight.config.MaxBytes && (len(r.events) > 0 || len(r.frames) > 0) {
+			if len(r.frames) == 0 || (len(r.events) > 0 && !r.frames[0].Timestamp.Before(r.events[0].Timestamp)) {
+				r.dropOldestEventLocked()
+			} else {
+				r.dropOldestFrameLocked()
+			}
+		}
+	}
+}
+
+// dropOldestEventLocked 丢弃最旧的事件
+func (r *SessionRecorder) dropOldestEventLocked() {
+	r.flight.bytes -= estimateEventSize(r.events[0])
+	r.flight.droppedEvents++
+	r.events[0] = nil
+	r.events = r.events[1:]
+}
+
+// dropOldestFrameLocked 丢弃最旧的帧
+func (r *SessionRecorder) dropOldestFrameLocked() {
+	r.flight.bytes -= estimateFrameSize(r.frames[0])
+	r.flight.droppedFrames++
+	r.frames[0] = nil
+	r.frames = r.frames[1:]
+}
+
+// checkEventTrigger 检查错误事件和异常关闭触发
+func (r *SessionRecorder) checkEventTrigger(flight *flightRecorder, event *SessionEvent) {
+	switch event.Type {
+	case EventError:
+		if !flight.config.TriggerOnError {
+			return
+		}
+		message := event.Error
+		if text, ok := event.Metadata["error"].(string); ok && message == "" {
+			message = text
+		}
+		r.triggerSnapshotAsync(TriggerError, TriggerError+":"+message, message)
+	case EventClose:
+		if !flight.config.TriggerOnAbnormalClose {
+			return
+		}
+		code := event.CloseCode
+		if metadataCode, ok := event.Metadata["close_code"].(CloseCode); ok {
+			code = metadataCode
+		}
+		if code == CloseNormal {
+			return
+		}
+		reason := fmt.Sprintf("close code %d", code)
+		if text, ok := event.Metadata["reason"].(string); ok && text != "" {
+			reason += ": " + text
+		}
+		r.triggerSnapshotAsync(TriggerAbnormalClose, fmt.Sprintf("%s:%d", TriggerAbnormalClose, code), reason)
+	}
+}
+
+// checkLatencyTrigger 检查延迟尖刺触发
+func (r *SessionRecorder) checkLatencyTrigger(latency time.Duration) {
+	flight := r.flightRecorder()
+	if flight == nil || flight.config.LatencyThreshold <= 0 || latency <= flight.config.LatencyThreshold {
+		return
+	}
+	r.triggerSnapshotAsync(TriggerLatencySpike, TriggerLatencySpike,
+		fmt.Sprintf("latency %v exceeds %v", latency, flight.config.LatencyThreshold))
+}
+
+// runFlightAssertions 定期对缓冲区运行断言套件，失败时触发快照
+func (r *SessionRecorder) runFlightAssertions(suite *AssertionSuite, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		// 去重键只取失败断言的名称，消息中的计数和数值每次都不同
+		var names, failed []string
+		for i, result := range suite.RunAssertions(r.GetSession()) {
+			if !result.Passed {
+				name := suite.Assertions[i].GetName()
+				names = append(names, name)
+				failed = append(failed, fmt.Sprintf("%s: %s", name, result.Message))
+			}
+		}
+		if len(failed) > 0 {
+			slices.Sort(names)
+			r.triggerSnapshotAsync(TriggerAssertion, TriggerAssertion+":"+strings.Join(names, "\n"), strings.Join(failed, "; "))
+		}
+	}
+}
+
+// triggerSnapshotAsync 记录路径上的触发：同步取下缓冲区内容，文件交给后台写出，
+// 记录调用不等待写盘；已有快照正在写出时跳过
+func (r *SessionRecorder) triggerSnapshotAsync(trigger, key, reason string) {
+	job, err := r.reserveSnapshot(trigger, key, reason)
+	if err != nil {
+		return
+	}
+	go func() {
+		if _, err := job.run(); err != nil {
+			log.Printf("Flight recorder %s: %v", r.sessionID, err)
+		}
+	}()
+}
+
+// snapshotJob 已占用写出槽位、待写出的快照
+type snapshotJob struct {
+	flight   *flightRecorder
+	snapshot FlightSnapshot
+	session  *Session
+	stats    *SessionStats
+}
+
+// reserveSnapshot 经过写出中、数量上限、去重和限流检查后占用写出槽位，并取下当前缓冲区
+func (r *SessionRecorder) reserveSnapshot(trigger, key, reason string) (*snapshotJob, error) {
+	flight := r.flightRecorder()
+	if flight == nil {
+		return nil, fmt.Errorf("flight recorder is not enabled")
+	}
+	config := flight.config
+
+	flight.mu.Lock()
+	now := time.Now()
+	last, seen := flight.lastByKey[key]
+	switch {
+	case flight.writing != nil,
+		config.MaxSnapshots > 0 && len(flight.snapshots) >= config.MaxSnapshots,
+		seen && config.DedupWindow > 0 && now.Sub(last) < config.DedupWindow,
+		!flight.lastSnapshot.IsZero() && config.MinInterval > 0 && now.Sub(flight.lastSnapshot) < config.MinInterval:
+		flight.suppressed++
+		flight.mu.Unlock()
+		return nil, ErrSnapshotSuppressed
+	}
+	flight.lastSnapshot = now
+	flight.lastByKey[key] = now
+	flight.sequence++
+	sequence := flight.sequence
+	flight.writing = make(chan struct{})
+	flight.mu.Unlock()
+
+	session := r.GetSession()
+	return &snapshotJob{
+		flight: flight,
+		snapshot: FlightSnapshot{
+			Path: filepath.Join(config.SnapshotDir,
+				fmt.Sprintf("flight_%s_%s_%03d_%s.slgs", r.sessionID, now.Format("20060102T150405"), sequence, trigger)),
+			Trigger: trigger,
+			Reason:  reason,
+			Time:    now,
+			Events:  len(session.Events),
+			Frames:  len(session.Frames),
+		},
+		session: session,
+		stats:   r.GetStats(),
+	}, nil
+}
+
+// run 写出快照并释放写出槽位
+func (job *snapshotJob) run() (*FlightSnapshot, error) {
+	flight, snapshot := job.flight, job.snapshot
+	defer func() {
+		flight.mu.Lock()
+		close(flight.writing)
+		flight.writing = nil
+		flight.mu.Unlock()
+	}()
+
+	if err := writeSnapshot(snapshot.Path, job.session, job.stats, flight.config.FileOptions); err != nil {
+		return nil, fmt.Errorf("write flight snapshot: %w", err)
+	}
+	flight.mu.Lock()
+	flight.snapshots = append(flight.snapshots, snapshot)
+	flight.mu.Unlock()
+
+	if flight.config.OnSnapshot != nil {
+		flight.config.OnSnapshot(snapshot)
+	}
+	return &snapshot, nil
+}
+
+// writeSnapshot 将缓冲区写为分块会话文件，会话开始时间取缓冲区中最早的记录
+func writeSnapshot(path string, session *Session, stats *SessionStats, options *SessionFileOptions) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	start := session.StartTime
+	if len(session.Events) > 0 {
+		start = session.Events[0].Timestamp
+	}
+	if len(session.Frames) > 0 && session.Frames[0].Timestamp.Before(start) {
+		start = session.Frames[0].Timestamp
+	}
+
+	writer, err := CreateSessionFile(path, session.ID, start, options)
+	if err != nil {
+		return err
+	}
+	if err := writer.WriteSession(session); err != nil {
+		writer.Close()
+		return err
+	}
+	writer.SetStats(stats)
+	return writer.Close()
+}
+
+// estimateEventSize 估算事件占用的内存，只用于缓冲区大小上限
+func estimateEventSize(event *SessionEvent) int64 {
+	size := int64(160 + len(event.ID) + len(event.Error) + len(event.MessageHash) + 48*len(event.Metadata))
+	if payload, ok := event.Metadata["payload"].(json.RawMessage); ok {
+		size += int64(len(payload))
+	}
+	return size
+}
+
+// estimateFrameSize 估算帧占用的内存
+func estimateFrameSize(frame *MessageFrame) int64 {
+	return int64(96 + len(frame.RawData) + len(frame.Body) + len(frame.MessageType) + len(frame.Payload))
+}
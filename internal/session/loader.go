@@ -0,0 +1,252 @@
+package session
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"GoSlgBenchmarkTest/internal/protocol"
+)
+
+// CurrentSchemaVersion 当前会话JSON格式版本。修改Session、SessionEvent或MessageFrame的JSON表示时
+// 递增该版本，并在sessionMigrations中登记从上一版本升级的迁移
+const CurrentSchemaVersion = 1
+
+var (
+	// ErrSessionCorrupt 会话数据损坏或不完整
+	ErrSessionCorrupt = errors.New("session: corrupt session data")
+	// ErrUnsupportedSchema 会话格式版本过新或缺少对应迁移
+	ErrUnsupportedSchema = errors.New("session: unsupported schema version")
+)
+
+// sessionDocument 迁移阶段使用的原始JSON文档，迁移直接改写字段，不依赖当前的结构体定义
+type sessionDocument map[string]interface{}
+
+// sessionMigration 将文档从某一版本升级到下一版本
+type sessionMigration func(doc sessionDocument) error
+
+// sessionMigrations 按源版本索引的迁移
+var sessionMigrations = map[int]sessionMigration{
+	0: migrateV0ToV1,
+}
+
+// LoadSession 从文件加载会话，自动识别JSON导出和分块会话文件
+func LoadSession(path string) (*Session, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	session, err := ReadSession(file)
+	if err != nil {
+		return nil, fmt.Errorf("load session %s: %w", path, err)
+	}
+	return session, nil
+}
+
+// ReadSession 读取并校验会话，旧版本的JSON导出会先迁移到当前版本
+func ReadSession(r io.Reader) (*Session, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if bytes.HasPrefix(data, sessionFileMagic[:]) {
+		return readSessionFile(data)
+	}
+	return decodeSessionJSON(data)
+}
+
+// readSessionFile 读取完整的分块会话文件；未正常关闭的文件需通过OpenSessionFile恢复
+func readSessionFile(data []byte) (*Session, error) {
+	reader, err := NewSessionFileReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrSessionCorrupt, err)
+	}
+	session, err := reader.ReadSession(nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrSessionCorrupt, err)
+	}
+	if reader.Truncated() || !reader.Complete() {
+		return nil, fmt.Errorf("%w: partial session file, %d records readable", ErrSessionCorrupt, len(session.Events)+len(session.Frames))
+	}
+	if err := ValidateSession(session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// decodeSessionJSON 解析JSON导出，依次执行迁移后再解码为Session
+func decodeSessionJSON(data []byte) (*Session, error) {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, fmt.Errorf("%w: empty input", ErrSessionCorrupt)
+	}
+
+	var doc sessionDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrSessionCorrupt, err)
+	}
+	if doc == nil {
+		return nil, fmt.Errorf("%w: not a session object", ErrSessionCorrupt)
+	}
+
+	version, err := doc.schemaVersion()
+	if err != nil {
+		return nil, err
+	}
+	if version > CurrentSchemaVersion {
+		return nil, fmt.Errorf("%w: %d is newer than %d", ErrUnsupportedSchema, version, CurrentSchemaVersion)
+	}
+	for ; version < CurrentSchemaVersion; version++ {
+		migrate, ok := sessionMigrations[version]
+		if !ok {
+			return nil, fmt.Errorf("%w: no migration from version %d", ErrUnsupportedSchema, version)
+		}
+		if err := migrate(doc); err != nil {
+			return nil, fmt.Errorf("migrate session from version %d: %w", version, err)
+		}
+	}
+	doc["schema_version"] = CurrentSchemaVersion
+
+	migrated, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	var session Session
+	if err := json.Unmarshal(migrated, &session); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrSessionCorrupt, err)
+	}
+	for _, event := range session.Events {
+		if event != nil {
+			restoreMetadataTypes(event)
+		}
+	}
+
+	if err := ValidateSession(&session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// schemaVersion 文档的格式版本，没有该字段的是版本0
+func (doc sessionDocument) schemaVersion() (int, error) {
+	value, exists := doc["schema_version"]
+	if !exists || value == nil {
+		return 0, nil
+	}
+	number, ok := value.(float64)
+	if !ok || number != float64(int(number)) || number < 0 {
+		return 0, fmt.Errorf("%w: invalid schema_version %v", ErrSessionCorrupt, value)
+	}
+	return int(number), nil
+}
+
+// objects 取出数组字段中的对象，非对象元素保持原样交给解码和校验处理
+func (doc sessionDocument) objects(key string) []map[string]interface{} {
+	items, _ := doc[key].([]interface{})
+	objects := make([]map[string]interface{}, 0, len(items))
+	for _, item := range items {
+		if object, ok := item.(map[string]interface{}); ok {
+			objects = append(objects, object)
+		}
+	}
+	return objects
+}
+
+// migrateV0ToV1 版本0是加入schema_version之前的导出：
+//   - recording-proxy以client_to_server/server_to_client记录方向，统一为send/receive，
+//     并修正被误记为MESSAGE_SEND的下行消息事件
+//   - 以非uint16类型传入opcode的事件没有顶层opcode，从元数据中补齐
+func migrateV0ToV1(doc sessionDocument) error {
+	for _, event := range doc.objects("events") {
+		metadata, _ := event["metadata"].(map[string]interface{})
+		if metadata == nil {
+			continue
+		}
+		if direction, ok := metadata["direction"].(string); ok {
+			normalized := normalizeDirection(direction)
+			metadata["direction"] = normalized
+			if event["type"] == string(EventMessageSend) && normalized == "receive" {
+				event["type"] = string(EventMessageReceive)
+			}
+		}
+		if _, exists := event["opcode"]; !exists {
+			if opcode, ok := metadata["opcode"].(float64); ok && opcode > 0 {
+				event["opcode"] = opcode
+			}
+		}
+	}
+
+	for _, frame := range doc.objects("frames") {
+		if direction, ok := frame["direction"].(string); ok {
+			frame["direction"] = normalizeDirection(direction)
+		}
+	}
+	return nil
+}
+
+// normalizeDirection 将代理记录的方向转换为send/receive
+func normalizeDirection(direction string) string {
+	switch direction {
+	case "client_to_server":
+		return "send"
+	case "server_to_client":
+		return "receive"
+	default:
+		return direction
+	}
+}
+
+// ValidateSession 校验会话结构完整性，返回的错误包装ErrSessionCorrupt
+func ValidateSession(session *Session) error {
+	if session == nil {
+		return fmt.Errorf("%w: nil session", ErrSessionCorrupt)
+	}
+	if session.SchemaVersion > CurrentSchemaVersion {
+		return fmt.Errorf("%w: %d is newer than %d", ErrUnsupportedSchema, session.SchemaVersion, CurrentSchemaVersion)
+	}
+	if session.ID == "" {
+		return fmt.Errorf("%w: missing session id", ErrSessionCorrupt)
+	}
+	if !session.StartTime.IsZero() && !session.EndTime.IsZero() && session.EndTime.Before(session.StartTime) {
+		return fmt.Errorf("%w: end_time %v before start_time %v", ErrSessionCorrupt, session.EndTime, session.StartTime)
+	}
+
+	for i, event := range session.Events {
+		switch {
+		case event == nil:
+			return fmt.Errorf("%w: events[%d] is null", ErrSessionCorrupt, i)
+		case event.Type == "":
+			return fmt.Errorf("%w: events[%d] missing type", ErrSessionCorrupt, i)
+		case event.Timestamp.IsZero():
+			return fmt.Errorf("%w: events[%d] missing timestamp", ErrSessionCorrupt, i)
+		}
+	}
+
+	for i, frame := range session.Frames {
+		if frame == nil {
+			return fmt.Errorf("%w: frames[%d] is null", ErrSessionCorrupt, i)
+		}
+		if frame.Direction != "send" && frame.Direction != "receive" {
+			return fmt.Errorf("%w: frames[%d] invalid direction %q", ErrSessionCorrupt, i, frame.Direction)
+		}
+		if frame.Timestamp.IsZero() {
+			return fmt.Errorf("%w: frames[%d] missing timestamp", ErrSessionCorrupt, i)
+		}
+		// opcode为0的是代理记录的非协议帧，原样保存不做解析
+		if frame.Opcode != 0 && len(frame.RawData) > 0 {
+			opcode, body, err := protocol.DecodeFrame(frame.RawData)
+			if err != nil {
+				return fmt.Errorf("%w: frames[%d] raw_data: %w", ErrSessionCorrupt, i, err)
+			}
+			if opcode != frame.Opcode || !bytes.Equal(body, frame.Body) {
+				return fmt.Errorf("%w: frames[%d] raw_data does not match opcode/body", ErrSessionCorrupt, i)
+			}
+		}
+	}
+	return nil
+}
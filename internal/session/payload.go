@@ -0,0 +1,185 @@
+package session
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"GoSlgBenchmarkTest/internal/protocol"
+)
+
+// PayloadDecodeOptions 消息体解码选项
+type PayloadDecodeOptions struct {
+	// Opcodes 只解码这些操作码，为空表示所有已知操作码
+	Opcodes []uint16
+	// Fields 按操作码配置的字段白名单（proto字段名，嵌套字段用点分隔，如 units.hp），
+	// 未配置的操作码输出全部字段。用于只保留关心的字段，避免大推送撑大录制文件
+	Fields map[uint16][]string
+}
+
+// DefaultPayloadDecodeOptions 默认解码选项：解码所有已知操作码的全部字段
+func DefaultPayloadDecodeOptions() *PayloadDecodeOptions {
+	return &PayloadDecodeOptions{}
+}
+
+// payloadMarshaler 使用proto字段名，与字段白名单和忽略规则的写法一致
+var payloadMarshaler = protojson.MarshalOptions{UseProtoNames: true}
+
+// DecodePayload 按操作码解码消息体，返回消息类型全名和protojson渲染；
+// 未知或未选中的操作码返回空类型名
+func DecodePayload(opcode uint16, body []byte, options *PayloadDecodeOptions) (string, json.RawMessage, error) {
+	if options == nil {
+		options = DefaultPayloadDecodeOptions()
+	}
+	if len(options.Opcodes) > 0 && !slices.Contains(options.Opcodes, opcode) {
+		return "", nil, nil
+	}
+
+	message := protocol.NewMessage(opcode)
+	if message == nil {
+		return "", nil, nil
+	}
+	messageType := string(message.ProtoReflect().Descriptor().FullName())
+	if err := proto.Unmarshal(body, message); err != nil {
+		return messageType, nil, fmt.Errorf("decode %s: %w", messageType, err)
+	}
+	if fields, ok := options.Fields[opcode]; ok {
+		keepFields(message.ProtoReflect(), fields)
+	}
+
+	payload, err := renderPayload(message)
+	return messageType, payload, err
+}
+
+// renderPayload 将消息渲染为紧凑的protojson
+func renderPayload(message proto.Message) (json.RawMessage, error) {
+	rendered, err := payloadMarshaler.Marshal(message)
+	if err != nil {
+		return nil, fmt.Errorf("render %s: %w", message.ProtoReflect().Descriptor().FullName(), err)
+	}
+	// protojson的输出空白不稳定，压缩后便于比较和存储
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, rendered); err != nil {
+		return nil, err
+	}
+	return compact.Bytes(), nil
+}
+
+// DecodeFramePayload 解码帧的消息体并填入MessageType和Payload，已解码的帧保持不变
+func DecodeFramePayload(frame *MessageFrame, options *PayloadDecodeOptions) error {
+	if frame.Payload != nil {
+		return nil
+	}
+	messageType, payload, err := DecodePayload(frame.Opcode, frame.Body, options)
+	frame.MessageType, frame.Payload = messageType, payload
+	return err
+}
+
+// DecodeSessionPayloads 对已录制或导入的会话补充解码，并将结果写入对应的消息事件。
+// 消息事件与帧按方向依次配对，操作码不一致时不写入。返回解码失败的帧数
+func DecodeSessionPayloads(session *Session, options *PayloadDecodeOptions) int {
+	failures := 0
+	for _, frame := range session.Frames {
+		if frame == nil {
+			continue
+		}
+		if err := DecodeFramePayload(frame, options); err != nil {
+			failures++
+		}
+	}
+
+	for event, frame := range pairMessageFrames(session) {
+		if frame.MessageType == "" {
+			continue
+		}
+		if event.Metadata == nil {
+			event.Metadata = map[string]interface{}{}
+		}
+		annotateMessageEvent(event.Metadata, frame)
+	}
+	return failures
+}
+
+// pairMessageFrames 将消息事件与帧按方向依次配对，只返回操作码一致的配对
+func pairMessageFrames(session *Session) map[*SessionEvent]*MessageFrame {
+	pending := map[string][]*MessageFrame{}
+	for _, frame := range session.Frames {
+		if frame != nil {
+			pending[frame.Direction] = append(pending[frame.Direction], frame)
+		}
+	}
+
+	pairs := make(map[*SessionEvent]*MessageFrame)
+	for _, event := range session.Events {
+		direction := ""
+		switch {
+		case event == nil:
+			continue
+		case event.Type == EventMessageSend:
+			direction = "send"
+		case event.Type == EventMessageReceive:
+			direction = "receive"
+		default:
+			continue
+		}
+		frames := pending[direction]
+		if len(frames) == 0 {
+			continue
+		}
+		pending[direction] = frames[1:]
+		if frames[0].Opcode == event.Opcode {
+			pairs[event] = frames[0]
+		}
+	}
+	return pairs
+}
+
+// annotateMessageEvent 在消息事件的元数据中记录解码结果，时间线报告从这里读取
+func annotateMessageEvent(metadata map[string]interface{}, frame *MessageFrame) {
+	if metadata == nil || frame.MessageType == "" {
+		return
+	}
+	metadata["message_type"] = frame.MessageType
+	if frame.Payload != nil {
+		metadata["payload"] = frame.Payload
+	}
+}
+
+// keepFields 只保留白名单中的字段，嵌套路径递归到单个和重复的消息字段
+func keepFields(message protoreflect.Message, paths []string) {
+	keep := make(map[string]bool)
+	nested := make(map[string][]string)
+	for _, path := range paths {
+		name, rest, hasRest := strings.Cut(path, ".")
+		if hasRest {
+			nested[name] = append(nested[name], rest)
+		} else {
+			keep[name] = true
+		}
+	}
+
+	message.Range(func(fd protoreflect.FieldDescriptor, value protoreflect.Value) bool {
+		name := string(fd.Name())
+		switch {
+		case keep[name]:
+		case len(nested[name]) > 0 && fd.Kind() == protoreflect.MessageKind && !fd.IsMap():
+			if fd.IsList() {
+				list := value.List()
+				for i := 0; i < list.Len(); i++ {
+					keepFields(list.Get(i).Message(), nested[name])
+				}
+			} else {
+				keepFields(value.Message(), nested[name])
+			}
+		default:
+			message.Clear(fd)
+		}
+		return true
+	})
+}
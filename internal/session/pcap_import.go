@@ -0,0 +1,1037 @@
+package session
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/netip"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"GoSlgBenchmarkTest/internal/protocol"
+)
+
+// ErrNotPcap 输入既不是pcap也不是pcapng抓包文件
+var ErrNotPcap = errors.New("session: not a pcap or pcapng capture")
+
+// 支持的链路层类型
+const (
+	linkTypeNull     = 0   // BSD回环，4字节地址族
+	linkTypeEthernet = 1   // 以太网，支持VLAN标签
+	linkTypeRaw      = 101 // 无链路层的IP报文
+	linkTypeRawAlt   = 12  // 部分平台上的LINKTYPE_RAW
+	linkTypeLoop     = 108 // OpenBSD回环
+	linkTypeSLL      = 113 // Linux cooked capture（tcpdump -i any）
+	linkTypeIPv4     = 228
+	linkTypeIPv6     = 229
+	linkTypeSLL2     = 276 // Linux cooked capture v2
+)
+
+// PcapImportOptions pcap导入选项
+type PcapImportOptions struct {
+	// ServerPorts 游戏服务端口，只导入这些端口上的连接；为空时导入所有TCP连接，
+	// 客户端按SYN、HTTP升级请求或临时端口判断
+	ServerPorts []uint16
+	// SessionID 会话ID前缀，每个TCP连接生成一个会话
+	SessionID string
+}
+
+// DefaultPcapImportOptions 默认pcap导入选项
+func DefaultPcapImportOptions() *PcapImportOptions {
+	return &PcapImportOptions{SessionID: "pcap"}
+}
+
+// LoadPcap 从pcap或pcapng文件导入会话
+func LoadPcap(path string, options *PcapImportOptions) ([]*Session, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ReadPcap(file, options)
+}
+
+// ReadPcap 重组抓包中的TCP流，提取WebSocket帧或原始长度前缀帧，每个TCP连接生成一个客户端视角的会话
+func ReadPcap(r io.Reader, options *PcapImportOptions) ([]*Session, error) {
+	if options == nil {
+		options = DefaultPcapImportOptions()
+	}
+
+	assembler := newTCPAssembler(options)
+	if err := readCapture(bufio.NewReader(r), assembler.addPacket); err != nil {
+		return nil, err
+	}
+
+	prefix := options.SessionID
+	if prefix == "" {
+		prefix = "pcap"
+	}
+
+	sessions := make([]*Session, 0, len(assembler.connections))
+	for _, conn := range assembler.connections {
+		conn.finish()
+		if conn.streams[0].size() == 0 && conn.streams[1].size() == 0 {
+			continue
+		}
+		client := conn.clientIndex(options.ServerPorts)
+		if client < 0 {
+			continue
+		}
+		id := fmt.Sprintf("%s_%d_%s", prefix, len(sessions)+1, conn.endpoints[client])
+		sessions = append(sessions, conn.buildSession(id, client))
+	}
+	return sessions, nil
+}
+
+// capturePacket 抓包中的一个报文
+type capturePacket struct {
+	timestamp time.Time
+	linkType  uint32
+	data      []byte
+}
+
+// readCapture 识别pcap或pcapng格式并逐个回调报文
+func readCapture(r *bufio.Reader, handle func(capturePacket)) error {
+	magic, err := r.Peek(4)
+	if err != nil {
+		return ErrNotPcap
+	}
+
+	switch {
+	case binary.LittleEndian.Uint32(magic) == pcapBlockSHB:
+		return readPcapngCapture(r, handle)
+	case isPcapMagic(binary.LittleEndian.Uint32(magic)):
+		return readClassicPcap(r, binary.LittleEndian, handle)
+	case isPcapMagic(binary.BigEndian.Uint32(magic)):
+		return readClassicPcap(r, binary.BigEndian, handle)
+	default:
+		return ErrNotPcap
+	}
+}
+
+// isPcapMagic 经典pcap的微秒或纳秒魔数
+func isPcapMagic(magic uint32) bool {
+	return magic == 0xA1B2C3D4 || magic == 0xA1B23C4D
+}
+
+// readClassicPcap 读取经典pcap文件
+func readClassicPcap(r io.Reader, order binary.ByteOrder, handle func(capturePacket)) error {
+	header := make([]byte, 24)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return fmt.Errorf("%w: truncated pcap header", ErrSessionCorrupt)
+	}
+	nanos := order.Uint32(header[0:4]) == 0xA1B23C4D
+	linkType := order.Uint32(header[20:24]) & 0x0FFFFFFF
+
+	record := make([]byte, 16)
+	for {
+		if _, err := io.ReadFull(r, record); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("%w: truncated pcap record", ErrSessionCorrupt)
+		}
+		seconds := int64(order.Uint32(record[0:4]))
+		fraction := int64(order.Uint32(record[4:8]))
+		captured := order.Uint32(record[8:12])
+		if captured > protocol.MaxFrameSize*4 {
+			return fmt.Errorf("%w: pcap record of %d bytes", ErrSessionCorrupt, captured)
+		}
+		data := make([]byte, captured)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return fmt.Errorf("%w: truncated pcap record", ErrSessionCorrupt)
+		}
+		if !nanos {
+			fraction *= int64(time.Microsecond)
+		}
+		handle(capturePacket{timestamp: time.Unix(seconds, fraction), linkType: linkType, data: data})
+	}
+}
+
+// pcapngInterface 接口描述块中解析时间戳所需的信息
+type pcapngInterface struct {
+	linkType     uint32
+	unitsPerSec  uint64
+	offsetSecond int64
+}
+
+// readPcapngCapture 读取pcapng文件，支持多个段和多个接口
+func readPcapngCapture(r io.Reader, handle func(capturePacket)) error {
+	var order binary.ByteOrder = binary.LittleEndian
+	var interfaces []pcapngInterface
+
+	for {
+		head := make([]byte, 8)
+		if _, err := io.ReadFull(r, head); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("%w: truncated pcapng block", ErrSessionCorrupt)
+		}
+
+		blockType := order.Uint32(head[0:4])
+		if binary.LittleEndian.Uint32(head[0:4]) == pcapBlockSHB {
+			// 新的段：按字节序标记确定后续块的字节序
+			bom := make([]byte, 4)
+			if _, err := io.ReadFull(r, bom); err != nil {
+				return fmt.Errorf("%w: truncated pcapng section header", ErrSessionCorrupt)
+			}
+			switch {
+			case binary.LittleEndian.Uint32(bom) == 0x1A2B3C4D:
+				order = binary.LittleEndian
+			case binary.BigEndian.Uint32(bom) == 0x1A2B3C4D:
+				order = binary.BigEndian
+			default:
+				return fmt.Errorf("%w: bad pcapng byte order magic", ErrSessionCorrupt)
+			}
+			total := order.Uint32(head[4:8])
+			if total < 28 || total%4 != 0 {
+				return fmt.Errorf("%w: bad pcapng section length %d", ErrSessionCorrupt, total)
+			}
+			if _, err := io.CopyN(io.Discard, r, int64(total-12)); err != nil {
+				return fmt.Errorf("%w: truncated pcapng section header", ErrSessionCorrupt)
+			}
+			interfaces = interfaces[:0]
+			continue
+		}
+
+		total := order.Uint32(head[4:8])
+		if total < 12 || total%4 != 0 || total > protocol.MaxFrameSize*4 {
+			return fmt.Errorf("%w: bad pcapng block length %d", ErrSessionCorrupt, total)
+		}
+		body := make([]byte, total-8)
+		if _, err := io.ReadFull(r, body); err != nil {
+			return fmt.Errorf("%w: truncated pcapng block", ErrSessionCorrupt)
+		}
+		body = body[:len(body)-4]
+
+		switch blockType {
+		case pcapBlockIDB:
+			if len(body) < 8 {
+				return fmt.Errorf("%w: short interface description block", ErrSessionCorrupt)
+			}
+			iface := pcapngInterface{linkType: uint32(order.Uint16(body[0:2])), unitsPerSec: 1_000_000}
+			forEachPcapngOption(body[8:], order, func(code uint16, value []byte) {
+				switch {
+				case code == pcapOptTsResol && len(value) >= 1:
+					iface.unitsPerSec = pcapngResolution(value[0])
+				case code == 14 && len(value) >= 8: // if_tsoffset
+					iface.offsetSecond = int64(order.Uint64(value))
+				}
+			})
+			interfaces = append(interfaces, iface)
+
+		case pcapBlockEPB, 2: // 增强报文块和已废弃的报文块
+			if len(body) < 20 {
+				return fmt.Errorf("%w: short packet block", ErrSessionCorrupt)
+			}
+			ifaceID := order.Uint32(body[0:4])
+			if blockType != pcapBlockEPB {
+				ifaceID = uint32(order.Uint16(body[0:2])) // 后两字节为丢包计数
+			}
+			high, low, captured := order.Uint32(body[4:8]), order.Uint32(body[8:12]), int(order.Uint32(body[12:16]))
+			if int(ifaceID) >= len(interfaces) || 20+captured > len(body) {
+				return fmt.Errorf("%w: bad packet block for interface %d", ErrSessionCorrupt, ifaceID)
+			}
+			iface := interfaces[ifaceID]
+			handle(capturePacket{
+				timestamp: pcapngTimestamp(uint64(high)<<32|uint64(low), iface),
+				linkType:  iface.linkType,
+				data:      body[20 : 20+captured],
+			})
+		}
+		// 其余块（简单报文块没有时间戳、名称解析、统计等）与会话无关
+	}
+}
+
+// forEachPcapngOption 遍历选项列表
+func forEachPcapngOption(data []byte, order binary.ByteOrder, visit func(code uint16, value []byte)) {
+	for len(data) >= 4 {
+		code, length := order.Uint16(data[0:2]), int(order.Uint16(data[2:4]))
+		if code == pcapOptEnd || 4+length > len(data) {
+			return
+		}
+		visit(code, data[4:4+length])
+		data = data[min(len(data), 4+length+pad4(length)):]
+	}
+}
+
+// pcapngResolution 解析if_tsresol：最高位为0表示10的负幂，为1表示2的负幂
+func pcapngResolution(value byte) uint64 {
+	exponent := uint64(value & 0x7F)
+	if value&0x80 != 0 {
+		return 1 << min(exponent, 63)
+	}
+	return uint64(math.Pow10(int(min(exponent, 19))))
+}
+
+// pcapngTimestamp 按接口精度换算时间戳
+func pcapngTimestamp(ts uint64, iface pcapngInterface) time.Time {
+	units := iface.unitsPerSec
+	if units == 0 {
+		units = 1_000_000
+	}
+	seconds := ts / units
+	nanos := uint64(float64(ts%units) * 1e9 / float64(units))
+	return time.Unix(int64(seconds)+iface.offsetSecond, int64(nanos))
+}
+
+// tcpSegment 从链路层报文中解析出的TCP段
+type tcpSegment struct {
+	src, dst netip.AddrPort
+	seq      uint32
+	flags    byte
+	payload  []byte
+}
+
+// parseTCPSegment 剥离链路层和IP层，非TCP报文和IP分片返回false
+func parseTCPSegment(linkType uint32, data []byte) (tcpSegment, bool) {
+	ip, ok := stripLinkLayer(linkType, data)
+	if !ok || len(ip) < 1 {
+		return tcpSegment{}, false
+	}
+
+	var src, dst netip.Addr
+	var tcp []byte
+	switch ip[0] >> 4 {
+	case 4:
+		if len(ip) < 20 {
+			return tcpSegment{}, false
+		}
+		headerLen := int(ip[0]&0x0F) * 4
+		totalLen := int(binary.BigEndian.Uint16(ip[2:4]))
+		fragment := binary.BigEndian.Uint16(ip[6:8])
+		if ip[9] != ipProtocolTCP || fragment&0x3FFF != 0 || headerLen < 20 || totalLen > len(ip) || totalLen < headerLen {
+			return tcpSegment{}, false
+		}
+		src, dst = netip.AddrFrom4([4]byte(ip[12:16])), netip.AddrFrom4([4]byte(ip[16:20]))
+		tcp = ip[headerLen:totalLen]
+	case 6:
+		if len(ip) < 40 {
+			return tcpSegment{}, false
+		}
+		payloadLen := int(binary.BigEndian.Uint16(ip[4:6]))
+		if 40+payloadLen > len(ip) {
+			return tcpSegment{}, false
+		}
+		src, dst = netip.AddrFrom16([16]byte(ip[8:24])), netip.AddrFrom16([16]byte(ip[24:40]))
+		next, rest := ip[6], ip[40:40+payloadLen]
+		// 跳过逐跳、路由和目的选项扩展头；分片不支持
+		for next == 0 || next == 43 || next == 60 {
+			if len(rest) < 8 || len(rest) < (int(rest[1])+1)*8 {
+				return tcpSegment{}, false
+			}
+			next, rest = rest[0], rest[(int(rest[1])+1)*8:]
+		}
+		if next != ipProtocolTCP {
+			return tcpSegment{}, false
+		}
+		tcp = rest
+	default:
+		return tcpSegment{}, false
+	}
+
+	if len(tcp) < 20 {
+		return tcpSegment{}, false
+	}
+	dataOffset := int(tcp[12]>>4) * 4
+	if dataOffset < 20 || dataOffset > len(tcp) {
+		return tcpSegment{}, false
+	}
+	return tcpSegment{
+		src:     netip.AddrPortFrom(src, binary.BigEndian.Uint16(tcp[0:2])),
+		dst:     netip.AddrPortFrom(dst, binary.BigEndian.Uint16(tcp[2:4])),
+		seq:     binary.BigEndian.Uint32(tcp[4:8]),
+		flags:   tcp[13],
+		payload: tcp[dataOffset:],
+	}, true
+}
+
+// stripLinkLayer 返回链路层承载的IP报文
+func stripLinkLayer(linkType uint32, data []byte) ([]byte, bool) {
+	switch linkType {
+	case linkTypeEthernet:
+		if len(data) < 14 {
+			return nil, false
+		}
+		etherType, offset := binary.BigEndian.Uint16(data[12:14]), 14
+		for etherType == 0x8100 || etherType == 0x88A8 {
+			if len(data) < offset+4 {
+				return nil, false
+			}
+			etherType, offset = binary.BigEndian.Uint16(data[offset+2:offset+4]), offset+4
+		}
+		if etherType != etherTypeIPv4 && etherType != 0x86DD {
+			return nil, false
+		}
+		return data[offset:], true
+	case linkTypeSLL:
+		if len(data) < 16 {
+			return nil, false
+		}
+		return data[16:], true
+	case linkTypeSLL2:
+		if len(data) < 20 {
+			return nil, false
+		}
+		return data[20:], true
+	case linkTypeNull, linkTypeLoop:
+		if len(data) < 4 {
+			return nil, false
+		}
+		return data[4:], true
+	case linkTypeRaw, linkTypeRawAlt, linkTypeIPv4, linkTypeIPv6:
+		return data, true
+	default:
+		return nil, false
+	}
+}
+
+// tcpAssembler 按四元组归并TCP段
+type tcpAssembler struct {
+	options     *PcapImportOptions
+	active      map[[2]netip.AddrPort]*tcpConnection
+	connections []*tcpConnection
+}
+
+func newTCPAssembler(options *PcapImportOptions) *tcpAssembler {
+	return &tcpAssembler{options: options, active: make(map[[2]netip.AddrPort]*tcpConnection)}
+}
+
+// addPacket 处理一个抓包报文
+func (a *tcpAssembler) addPacket(packet capturePacket) {
+	segment, ok := parseTCPSegment(packet.linkType, packet.data)
+	if !ok {
+		return
+	}
+	if len(a.options.ServerPorts) > 0 && !containsPort(a.options.ServerPorts, segment.src.Port()) &&
+		!containsPort(a.options.ServerPorts, segment.dst.Port()) {
+		return
+	}
+
+	key := [2]netip.AddrPort{segment.src, segment.dst}
+	if segment.dst.Compare(segment.src) < 0 {
+		key = [2]netip.AddrPort{segment.dst, segment.src}
+	}
+
+	conn := a.active[key]
+	isSYN := segment.flags&tcpFlagSYN != 0 && segment.flags&tcpFlagACK == 0
+	// 同一四元组上的新SYN表示端口复用的新连接
+	if conn == nil || (isSYN && (conn.closed || conn.streams[conn.index(segment.src)].size() > 0)) {
+		conn = &tcpConnection{endpoints: key, synFrom: -1, first: packet.timestamp}
+		conn.streams[0], conn.streams[1] = &tcpStream{}, &tcpStream{}
+		a.active[key] = conn
+		a.connections = append(a.connections, conn)
+	}
+	conn.add(packet.timestamp, segment)
+}
+
+// containsPort 端口是否在列表中
+func containsPort(ports []uint16, port uint16) bool {
+	for _, p := range ports {
+		if p == port {
+			return true
+		}
+	}
+	return false
+}
+
+// tcpConnection 一个TCP连接的双向流
+type tcpConnection struct {
+	endpoints [2]netip.AddrPort
+	streams   [2]*tcpStream // 按发送方索引
+	synFrom   int           // 发送SYN的一方，-1表示抓包中没有握手
+	first     time.Time
+	last      time.Time
+	closed    bool
+	closedAt  time.Time
+	reset     bool
+}
+
+// index 端点在连接中的索引
+func (c *tcpConnection) index(endpoint netip.AddrPort) int {
+	if c.endpoints[0] == endpoint {
+		return 0
+	}
+	return 1
+}
+
+// add 处理属于该连接的TCP段
+func (c *tcpConnection) add(timestamp time.Time, segment tcpSegment) {
+	sender := c.index(segment.src)
+	c.last = timestamp
+	if segment.flags&tcpFlagSYN != 0 && segment.flags&tcpFlagACK == 0 {
+		c.synFrom = sender
+	}
+	c.streams[sender].add(timestamp, segment)
+
+	if segment.flags&0x04 != 0 { // RST
+		c.closed, c.reset = true, true
+		if c.closedAt.IsZero() {
+			c.closedAt = timestamp
+		}
+	}
+	if segment.flags&tcpFlagFIN != 0 {
+		c.closed = true
+		if c.closedAt.IsZero() {
+			c.closedAt = timestamp
+		}
+	}
+}
+
+// finish 抓包结束，补齐无法重组的缺口
+func (c *tcpConnection) finish() {
+	c.streams[0].finish()
+	c.streams[1].finish()
+}
+
+// clientIndex 判断客户端一方：SYN发送方、服务端口的对端、发起HTTP升级的一方，最后按临时端口判断
+func (c *tcpConnection) clientIndex(serverPorts []uint16) int {
+	if c.synFrom >= 0 {
+		return c.synFrom
+	}
+	for i, endpoint := range c.endpoints {
+		if containsPort(serverPorts, endpoint.Port()) {
+			return 1 - i
+		}
+	}
+	for i, stream := range c.streams {
+		if bytes.HasPrefix(stream.data, []byte("GET ")) {
+			return i
+		}
+	}
+	if c.endpoints[0].Port() > c.endpoints[1].Port() {
+		return 0
+	}
+	return 1
+}
+
+// tcpStream 单方向的TCP重组流
+type tcpStream struct {
+	started bool
+	next    uint32
+	pending map[uint32]pendingSegment
+	data    []byte
+	offsets []int       // 每个数据块在data中的起始位置
+	times   []time.Time // 每个数据块的抓包时间
+	gaps    []int       // 缺失数据的位置，解析不能跨越缺口
+}
+
+// pendingSegment 乱序到达、等待前面数据的段
+type pendingSegment struct {
+	timestamp time.Time
+	data      []byte
+}
+
+// size 已重组的字节数
+func (s *tcpStream) size() int {
+	return len(s.data)
+}
+
+// add 按序号重组：丢弃重传的重叠部分，缓存乱序段
+func (s *tcpStream) add(timestamp time.Time, segment tcpSegment) {
+	seq := segment.seq
+	if segment.flags&tcpFlagSYN != 0 {
+		s.started, s.next = true, seq+1
+		return
+	}
+	if len(segment.payload) == 0 {
+		return
+	}
+	if !s.started {
+		s.started, s.next = true, seq
+	}
+
+	if int32(seq-s.next) > 0 {
+		if s.pending == nil {
+			s.pending = make(map[uint32]pendingSegment)
+		}
+		if existing, ok := s.pending[seq]; !ok || len(existing.data) < len(segment.payload) {
+			s.pending[seq] = pendingSegment{timestamp: timestamp, data: append([]byte(nil), segment.payload...)}
+		}
+		return
+	}
+	s.accept(timestamp, seq, segment.payload)
+	s.flush(timestamp)
+}
+
+// accept 追加从seq开始的数据，跳过已收到的部分
+func (s *tcpStream) accept(timestamp time.Time, seq uint32, payload []byte) {
+	overlap := int(int32(s.next - seq))
+	if overlap >= len(payload) {
+		return
+	}
+	payload = payload[overlap:]
+	s.offsets = append(s.offsets, len(s.data))
+	s.times = append(s.times, timestamp)
+	s.data = append(s.data, payload...)
+	s.next += uint32(len(payload))
+}
+
+// flush 追加已经连续的缓存段。乱序段要等前面的数据到达后才可用，时间取两者中较晚的一个
+func (s *tcpStream) flush(arrived time.Time) {
+	for progress := true; progress && len(s.pending) > 0; {
+		progress = false
+		for seq, segment := range s.pending {
+			if int32(seq-s.next) <= 0 {
+				delete(s.pending, seq)
+				timestamp := segment.timestamp
+				if arrived.After(timestamp) {
+					timestamp = arrived
+				}
+				s.accept(timestamp, seq, segment.data)
+				progress = true
+			}
+		}
+	}
+}
+
+// finish 剩余的缓存段之前缺少数据，记录缺口后继续重组
+func (s *tcpStream) finish() {
+	for len(s.pending) > 0 {
+		first := true
+		var earliest uint32
+		for seq := range s.pending {
+			if first || int32(seq-earliest) < 0 {
+				earliest, first = seq, false
+			}
+		}
+		s.gaps = append(s.gaps, len(s.data))
+		s.next = earliest
+		s.flush(time.Time{})
+	}
+}
+
+// runs 以缺口切分的连续区间
+func (s *tcpStream) runs() [][2]int {
+	runs := make([][2]int, 0, len(s.gaps)+1)
+	start := 0
+	for _, gap := range s.gaps {
+		runs = append(runs, [2]int{start, gap})
+		start = gap
+	}
+	return append(runs, [2]int{start, len(s.data)})
+}
+
+// timeAt 包含位置end-1字节的数据块的抓包时间，即数据在接收端可用的时间
+func (s *tcpStream) timeAt(end int) time.Time {
+	i := sort.SearchInts(s.offsets, end) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(s.times) {
+		return time.Time{}
+	}
+	return s.times[i]
+}
+
+// importedRecord 导入过程中按时间排序的帧或事件
+type importedRecord struct {
+	timestamp time.Time
+	frame     *MessageFrame
+	event     *SessionEvent
+}
+
+// streamImporter 从一个方向的流中提取帧
+type streamImporter struct {
+	stream    *tcpStream
+	direction string
+	records   []importedRecord
+}
+
+// buildSession 按客户端视角生成会话
+func (c *tcpConnection) buildSession(id string, client int) *Session {
+	clientStream, serverStream := c.streams[client], c.streams[1-client]
+	clientStart, serverStart, websocket, deflate, upgradeErr := detectWebSocket(clientStream, serverStream)
+
+	encapsulation := "tcp"
+	if websocket {
+		encapsulation = "websocket"
+	}
+	connectMetadata := map[string]interface{}{
+		"source":        "pcap",
+		"client":        c.endpoints[client].String(),
+		"server":        c.endpoints[1-client].String(),
+		"encapsulation": encapsulation,
+	}
+	if deflate != nil {
+		connectMetadata["compression"] = "permessage-deflate"
+	}
+	records := []importedRecord{{timestamp: c.first, event: &SessionEvent{Type: EventConnect, Metadata: connectMetadata}}}
+
+	importers := []*streamImporter{
+		{stream: clientStream, direction: "send"},
+		{stream: serverStream, direction: "receive"},
+	}
+	starts := []int{clientStart, serverStart}
+	var inflaters [2]*messageInflater
+	if deflate != nil {
+		inflaters[0] = newMessageInflater(!deflate.clientNoContextTakeover)
+		inflaters[1] = newMessageInflater(!deflate.serverNoContextTakeover)
+	}
+	for i, importer := range importers {
+		if upgradeErr != nil {
+			break
+		}
+		if websocket {
+			importer.extractWebSocket(starts[i], inflaters[i])
+		} else {
+			importer.extractRaw(starts[i])
+		}
+		for _, gap := range importer.stream.gaps {
+			importer.records = append(importer.records, importedRecord{
+				timestamp: importer.stream.timeAt(gap + 1),
+				event: &SessionEvent{Type: EventError, Error: "tcp stream gap: missing segments in capture",
+					Metadata: map[string]interface{}{"direction": importer.direction, "offset": gap}},
+			})
+		}
+		records = append(records, importer.records...)
+	}
+	if upgradeErr != nil {
+		records = append(records, importedRecord{timestamp: c.first,
+			event: &SessionEvent{Type: EventError, Error: upgradeErr.Error()}})
+	}
+
+	if c.closed {
+		records = append(records, importedRecord{timestamp: c.closedAt,
+			event: &SessionEvent{Type: EventDisconnect, Metadata: map[string]interface{}{"reset": c.reset}}})
+	}
+
+	sort.SliceStable(records, func(i, j int) bool { return records[i].timestamp.Before(records[j].timestamp) })
+
+	session := &Session{
+		SchemaVersion: CurrentSchemaVersion,
+		ID:            id,
+		StartTime:     c.first,
+		EndTime:       c.last,
+		Stats:         &SessionStats{StartTime: c.first, EndTime: c.last, Duration: c.last.Sub(c.first), LatencyPercentiles: make(map[int]time.Duration)},
+	}
+	for _, record := range records {
+		if record.frame != nil {
+			session.Frames = append(session.Frames, record.frame)
+			continue
+		}
+		event := record.event
+		event.ID = fmt.Sprintf("event_%d", len(session.Events)+1)
+		event.Timestamp, event.ClientTime, event.ServerTime = record.timestamp, record.timestamp, record.timestamp
+		session.Events = append(session.Events, event)
+
+		stats := session.Stats
+		stats.TotalEvents++
+		switch event.Type {
+		case EventMessageSend:
+			stats.MessagesSent++
+			stats.BytesSent += int64(event.MessageSize)
+		case EventMessageReceive:
+			stats.MessagesReceived++
+			stats.BytesReceived += int64(event.MessageSize)
+		case EventError:
+			stats.ErrorCount++
+		}
+	}
+	return session
+}
+
+// detectWebSocket 识别HTTP升级握手，返回双方WebSocket数据的起始位置和协商的permessage-deflate参数
+func detectWebSocket(client, server *tcpStream) (clientStart, serverStart int, websocket bool, deflate *wsDeflate, err error) {
+	if !bytes.HasPrefix(client.data, []byte("GET ")) {
+		return 0, 0, false, nil, nil
+	}
+	requestEnd := bytes.Index(client.data, []byte("\r\n\r\n"))
+	if requestEnd < 0 || !bytes.Contains(bytes.ToLower(client.data[:requestEnd]), []byte("upgrade: websocket")) {
+		return 0, 0, false, nil, nil
+	}
+
+	responseEnd := bytes.Index(server.data, []byte("\r\n\r\n"))
+	if responseEnd < 0 {
+		return requestEnd + 4, 0, true, nil, errors.New("websocket upgrade response missing from capture")
+	}
+	statusLine, headers, _ := strings.Cut(string(server.data[:responseEnd]), "\r\n")
+	fields := strings.Fields(statusLine)
+	if len(fields) < 2 || fields[1] != strconv.Itoa(101) {
+		return requestEnd + 4, responseEnd + 4, true, nil, fmt.Errorf("websocket upgrade rejected: %s", statusLine)
+	}
+	return requestEnd + 4, responseEnd + 4, true, parseDeflateExtension(headers), nil
+}
+
+// wsDeflate 握手响应中协商的permessage-deflate参数
+type wsDeflate struct {
+	serverNoContextTakeover bool // 服务端每条消息重置压缩上下文
+	clientNoContextTakeover bool // 客户端每条消息重置压缩上下文
+}
+
+// parseDeflateExtension 从握手响应头中解析服务端接受的permessage-deflate扩展，未协商时返回nil
+func parseDeflateExtension(headers string) *wsDeflate {
+	for _, line := range strings.Split(headers, "\r\n") {
+		name, value, ok := strings.Cut(line, ":")
+		if !ok || !strings.EqualFold(strings.TrimSpace(name), "Sec-WebSocket-Extensions") {
+			continue
+		}
+		for _, extension := range strings.Split(value, ",") {
+			params := strings.Split(extension, ";")
+			if !strings.EqualFold(strings.TrimSpace(params[0]), "permessage-deflate") {
+				continue
+			}
+			deflate := &wsDeflate{}
+			for _, param := range params[1:] {
+				key, _, _ := strings.Cut(param, "=")
+				switch strings.ToLower(strings.TrimSpace(key)) {
+				case "server_no_context_takeover":
+					deflate.serverNoContextTakeover = true
+				case "client_no_context_takeover":
+					deflate.clientNoContextTakeover = true
+				}
+			}
+			return deflate
+		}
+	}
+	return nil
+}
+
+// deflateTail 发送端省略的同步刷新尾部，之后再补一个空的最终块使解压器正常结束
+var deflateTail = []byte{0x00, 0x00, 0xff, 0xff, 0x01, 0x00, 0x00, 0xff, 0xff}
+
+const (
+	deflateWindowSize  = 32 * 1024        // 保留上下文时跨消息共享的滑动窗口
+	maxInflatedMessage = 16 * 1024 * 1024 // 解压后的消息长度上限，防止压缩炸弹
+)
+
+// messageInflater 解压一个方向上的permessage-deflate消息，保留上下文时以之前的输出作为字典
+type messageInflater struct {
+	reader   io.ReadCloser
+	takeover bool
+	window   []byte
+}
+
+// newMessageInflater 创建消息解压器，takeover表示该方向跨消息保留压缩上下文
+func newMessageInflater(takeover bool) *messageInflater {
+	return &messageInflater{takeover: takeover}
+}
+
+// inflate 解压一条完整消息
+func (m *messageInflater) inflate(message []byte) ([]byte, error) {
+	source := io.MultiReader(bytes.NewReader(message), bytes.NewReader(deflateTail))
+	var dict []byte
+	if m.takeover {
+		dict = m.window
+	}
+	if m.reader == nil {
+		m.reader = flate.NewReaderDict(source, dict)
+	} else if err := m.reader.(flate.Resetter).Reset(source, dict); err != nil {
+		return nil, err
+	}
+
+	output, err := io.ReadAll(io.LimitReader(m.reader, maxInflatedMessage+1))
+	if err == nil && len(output) > maxInflatedMessage {
+		err = protocol.ErrFrameTooLarge
+	}
+	if err != nil {
+		m.window = nil // 上下文已不可信，后续依赖它的消息会解压失败并各自记录错误
+		return nil, err
+	}
+
+	if m.takeover {
+		m.window = append(m.window, output...)
+		if len(m.window) > deflateWindowSize {
+			m.window = append([]byte(nil), m.window[len(m.window)-deflateWindowSize:]...)
+		}
+	}
+	return output, nil
+}
+
+// extractRaw 直接按帧头切分TCP流
+func (si *streamImporter) extractRaw(start int) {
+	stream := si.stream
+	for _, run := range stream.runs() {
+		from := max(run[0], start)
+		decoder := protocol.NewFrameDecoder()
+		chunk := sort.SearchInts(stream.offsets, from+1) - 1
+		for pos := from; pos < run[1]; {
+			end := run[1]
+			if chunk+1 < len(stream.offsets) && stream.offsets[chunk+1] < end {
+				end = stream.offsets[chunk+1]
+			}
+			if !si.feed(decoder, stream.data[pos:end], stream.times[max(chunk, 0)]) {
+				break
+			}
+			pos = end
+			chunk++
+		}
+	}
+}
+
+// extractWebSocket 解析WebSocket帧，合并分片消息并解压permessage-deflate消息后按帧头切分二进制消息
+func (si *streamImporter) extractWebSocket(start int, inflater *messageInflater) {
+	stream := si.stream
+	for _, run := range stream.runs() {
+		decoder := protocol.NewFrameDecoder()
+		var message []byte
+		collecting, compressed := false, false
+
+		for pos := max(run[0], start); pos < run[1]; {
+			header, length, mask, ok := parseWebSocketHeader(stream.data[pos:run[1]])
+			if !ok || uint64(run[1]-pos-header) < length {
+				break // 帧不完整：抓包结束或遇到缺口
+			}
+			payload := append([]byte(nil), stream.data[pos+header:pos+header+int(length)]...)
+			if mask != nil {
+				for i := range payload {
+					payload[i] ^= mask[i%4]
+				}
+			}
+			fin, opcode := stream.data[pos]&wsFinBit != 0, stream.data[pos]&0x0F
+			rsv1 := stream.data[pos]&wsRsv1Bit != 0 // 只在消息首帧上有效
+			pos += header + int(length)
+			timestamp := stream.timeAt(pos)
+
+			switch opcode {
+			case 0x0: // 续帧
+				if collecting {
+					message = append(message, payload...)
+				}
+			case wsOpcodeBinary:
+				message, collecting, compressed = payload, true, rsv1
+			case 0x8: // 关闭
+				si.recordClose(timestamp, payload)
+				continue
+			default: // 文本、ping、pong不承载协议帧
+				continue
+			}
+			if fin && collecting {
+				collecting = false
+				if compressed {
+					var err error
+					if inflater == nil {
+						err = errors.New("compressed websocket message without negotiated permessage-deflate")
+					} else if message, err = inflater.inflate(message); err != nil {
+						err = fmt.Errorf("inflate websocket message: %w", err)
+					}
+					if err != nil {
+						si.recordError(timestamp, err)
+						continue
+					}
+				}
+				if !si.feed(decoder, message, timestamp) {
+					decoder.Reset()
+				}
+			}
+		}
+	}
+}
+
+// parseWebSocketHeader 解析WebSocket帧头，返回帧头长度、载荷长度和掩码
+func parseWebSocketHeader(data []byte) (header int, length uint64, mask []byte, ok bool) {
+	if len(data) < 2 {
+		return 0, 0, nil, false
+	}
+	header, length = 2, uint64(data[1]&0x7F)
+	switch length {
+	case 126:
+		if len(data) < 4 {
+			return 0, 0, nil, false
+		}
+		header, length = 4, uint64(binary.BigEndian.Uint16(data[2:4]))
+	case 127:
+		if len(data) < 10 {
+			return 0, 0, nil, false
+		}
+		header, length = 10, binary.BigEndian.Uint64(data[2:10])
+	}
+	if data[1]&wsMaskBit != 0 {
+		if len(data) < header+4 {
+			return 0, 0, nil, false
+		}
+		mask = data[header : header+4]
+		header += 4
+	}
+	return header, length, mask, length <= protocol.MaxFrameSize
+}
+
+// feed 将数据送入帧解码器并取出完整帧，解码失败时记录错误并返回false
+func (si *streamImporter) feed(decoder *protocol.FrameDecoder, data []byte, timestamp time.Time) bool {
+	const feedLimit = 64 * 1024 // FrameDecoder单次输入上限
+	for len(data) > 0 {
+		piece := data[:min(len(data), feedLimit)]
+		data = data[len(piece):]
+		if decoder.BufferSize()+len(piece) > 128*1024 {
+			si.recordError(timestamp, protocol.ErrFrameTooLarge)
+			return false
+		}
+		decoder.Feed(piece)
+
+		for {
+			frame, err := decoder.Next()
+			if err != nil {
+				si.recordError(timestamp, err)
+				return false
+			}
+			if frame == nil {
+				break
+			}
+			si.recordFrame(timestamp, frame)
+		}
+	}
+	return true
+}
+
+// recordFrame 记录一帧及对应的消息事件，字段与SessionRecorder.RecordMessage一致
+func (si *streamImporter) recordFrame(timestamp time.Time, frame *protocol.Frame) {
+	raw := protocol.EncodeFrame(frame.Opcode, frame.Body)
+	sequence := protocol.MessageSequence(frame.Opcode, frame.Body)
+	eventType := EventMessageSend
+	if si.direction == "receive" {
+		eventType = EventMessageReceive
+	}
+
+	si.records = append(si.records,
+		importedRecord{timestamp: timestamp, frame: &MessageFrame{
+			RawData:     raw,
+			Opcode:      frame.Opcode,
+			Body:        frame.Body,
+			Timestamp:   timestamp,
+			Direction:   si.direction,
+			SequenceNum: sequence,
+		}},
+		importedRecord{timestamp: timestamp, event: &SessionEvent{
+			Type:        eventType,
+			Opcode:      frame.Opcode,
+			MessageSize: len(raw),
+			Metadata: map[string]interface{}{
+				"opcode":       frame.Opcode,
+				"message_size": len(raw),
+				"body_size":    len(frame.Body),
+				"sequence_num": sequence,
+				"direction":    si.direction,
+			},
+		}})
+}
+
+// recordClose 记录WebSocket关闭帧
+func (si *streamImporter) recordClose(timestamp time.Time, payload []byte) {
+	code, reason := CloseNoStatus, ""
+	if len(payload) >= 2 {
+		code, reason = CloseCode(binary.BigEndian.Uint16(payload[0:2])), string(payload[2:])
+	}
+	si.records = append(si.records, importedRecord{timestamp: timestamp, event: &SessionEvent{
+		Type:      EventClose,
+		CloseCode: code,
+		Metadata:  map[string]interface{}{"close_code": int(code), "reason": reason, "direction": si.direction},
+	}})
+}
+
+// recordError 记录解码失败
+func (si *streamImporter) recordError(timestamp time.Time, err error) {
+	si.records = append(si.records, importedRecord{timestamp: timestamp, event: &SessionEvent{
+		Type:     EventError,
+		Error:    err.Error(),
+		Metadata: map[string]interface{}{"direction": si.direction},
+	}})
+}
@@ -0,0 +1,441 @@
+package session
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"sort"
+	"time"
+
+	"GoSlgBenchmarkTest/internal/protocol"
+)
+
+// PcapEncapsulation 协议帧在pcapng中的封装方式
+type PcapEncapsulation int
+
+const (
+	// PcapWebSocket 以WebSocket二进制帧承载，前面补上合成的TCP握手和HTTP升级请求，Wireshark可直接识别为WebSocket
+	PcapWebSocket PcapEncapsulation = iota
+	// PcapTCP 协议帧直接作为TCP载荷，对应不经过WebSocket的原始长连接
+	PcapTCP
+)
+
+const (
+	// PcapWebSocketPort WebSocket封装默认的服务端端口，与Lua解析器注册的ws.port一致
+	PcapWebSocketPort = 18000
+	// PcapTCPPort TCP封装默认的服务端端口，与Lua解析器注册的tcp.port一致
+	PcapTCPPort = 18100
+
+	pcapMSS = 1460 // 合成TCP段的最大载荷
+)
+
+// pcapng块类型和选项
+const (
+	pcapBlockSHB = 0x0A0D0D0A
+	pcapBlockIDB = 0x00000001
+	pcapBlockEPB = 0x00000006
+
+	pcapOptEnd      = 0
+	pcapOptComment  = 1
+	pcapOptUserAppl = 4 // shb_userappl
+	pcapOptIfName   = 2 // if_name
+	pcapOptTsResol  = 9 // if_tsresol
+	pcapOptEPBFlags = 2 // epb_flags
+	pcapLinkEther   = 1 // LINKTYPE_ETHERNET
+	pcapTsResolNano = 9 // 时间戳单位10^-9秒
+	pcapInbound     = 1 // epb_flags方向：入站
+	pcapOutbound    = 2 // epb_flags方向：出站
+	tcpFlagFIN      = 0x01
+	tcpFlagSYN      = 0x02
+	tcpFlagPSH      = 0x08
+	tcpFlagACK      = 0x10
+	ipProtocolTCP   = 6
+	etherTypeIPv4   = 0x0800
+	wsOpcodeBinary  = 0x2
+	wsFinBit        = 0x80
+	wsRsv1Bit       = 0x40 // permessage-deflate压缩的消息在首帧置位
+	wsMaskBit       = 0x80
+	pcapHandshakeNs = 1000 // 合成握手包之间的间隔
+)
+
+// PcapOptions pcapng导出选项
+type PcapOptions struct {
+	Encapsulation PcapEncapsulation
+	ClientAddr    netip.AddrPort // 客户端地址，默认10.0.0.2:50000
+	ServerAddr    netip.AddrPort // 服务端地址，默认10.0.0.1加封装对应的端口
+	Path          string         // WebSocket升级请求路径
+	// ServerPerspective 会话由服务端录制（如测试服务器的连接录制），此时receive是客户端发往服务端的帧
+	ServerPerspective bool
+}
+
+// DefaultPcapOptions 默认pcapng导出选项
+func DefaultPcapOptions() *PcapOptions {
+	return &PcapOptions{
+		Encapsulation: PcapWebSocket,
+		ClientAddr:    netip.MustParseAddrPort("10.0.0.2:50000"),
+		Path:          "/ws",
+	}
+}
+
+// pcapEndpoint 合成连接的一端
+type pcapEndpoint struct {
+	addr netip.AddrPort
+	mac  [6]byte
+	seq  uint32 // 下一个发送序号
+	ipID uint16
+}
+
+// pcapWriter 按时间顺序写出合成连接上的报文
+type pcapWriter struct {
+	w       *bufio.Writer
+	options *PcapOptions
+	client  *pcapEndpoint
+	server  *pcapEndpoint
+	masks   uint32 // 客户端帧掩码计数，保证输出确定
+	err     error
+}
+
+// WritePcapng 将会话中的帧写为pcapng，使用原始时间戳和方向，会话元数据写入文件头注释
+func WritePcapng(w io.Writer, session *Session, options *PcapOptions) error {
+	if options == nil {
+		options = DefaultPcapOptions()
+	}
+	resolved := *options
+	if !resolved.ClientAddr.IsValid() {
+		resolved.ClientAddr = DefaultPcapOptions().ClientAddr
+	}
+	if !resolved.ServerAddr.IsValid() {
+		port := uint16(PcapWebSocketPort)
+		if resolved.Encapsulation == PcapTCP {
+			port = PcapTCPPort
+		}
+		resolved.ServerAddr = netip.AddrPortFrom(netip.MustParseAddr("10.0.0.1"), port)
+	}
+	if resolved.Path == "" {
+		resolved.Path = "/ws"
+	}
+	if !resolved.ClientAddr.Addr().Is4() || !resolved.ServerAddr.Addr().Is4() {
+		return fmt.Errorf("pcapng export supports IPv4 addresses only")
+	}
+
+	writer := &pcapWriter{
+		w:       bufio.NewWriter(w),
+		options: &resolved,
+		client:  &pcapEndpoint{addr: resolved.ClientAddr, mac: [6]byte{0x02, 0, 0, 0, 0, 0x02}, seq: 1000},
+		server:  &pcapEndpoint{addr: resolved.ServerAddr, mac: [6]byte{0x02, 0, 0, 0, 0, 0x01}, seq: 5000},
+	}
+
+	frames := make([]*MessageFrame, 0, len(session.Frames))
+	for _, frame := range session.Frames {
+		if frame != nil {
+			frames = append(frames, frame)
+		}
+	}
+	sort.SliceStable(frames, func(i, j int) bool { return frames[i].Timestamp.Before(frames[j].Timestamp) })
+
+	writer.writeSectionHeader(session)
+	writer.writeInterface(session)
+
+	start := session.StartTime
+	// 握手最多占用5个间隔，必须早于第一帧
+	if len(frames) > 0 {
+		latest := frames[0].Timestamp.Add(-6 * pcapHandshakeNs)
+		if start.IsZero() || start.After(latest) {
+			start = latest
+		}
+	}
+	at := writer.writeHandshake(start)
+
+	for _, frame := range frames {
+		fromClient := frame.Direction == "send"
+		if resolved.ServerPerspective {
+			fromClient = !fromClient
+		}
+		payload := frame.RawData
+		if resolved.Encapsulation == PcapWebSocket {
+			payload = writer.websocketFrame(frame.RawData, fromClient)
+		}
+		comment := fmt.Sprintf("%s %s", frame.Direction, protocol.OpcodeToString(frame.Opcode))
+		if frame.SequenceNum != 0 {
+			comment += fmt.Sprintf(" seq=%d", frame.SequenceNum)
+		}
+		writer.writeSegments(frame.Timestamp, fromClient, payload, comment)
+		at = frame.Timestamp
+	}
+
+	writer.writeTeardown(at.Add(pcapHandshakeNs))
+
+	if writer.err != nil {
+		return writer.err
+	}
+	return writer.w.Flush()
+}
+
+// ExportPcapng 将会话导出为pcapng文件
+func (r *SessionRecorder) ExportPcapng(path string, options *PcapOptions) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := WritePcapng(file, r.GetSession(), options); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// writeHandshake 写出TCP三次握手，WebSocket封装时再写出HTTP升级请求和响应，返回最后一个报文的时间
+func (pw *pcapWriter) writeHandshake(at time.Time) time.Time {
+	client, server := pw.client, pw.server
+
+	pw.writeTCP(at, true, tcpFlagSYN, nil, "")
+	client.seq++
+	at = at.Add(pcapHandshakeNs)
+	pw.writeTCP(at, false, tcpFlagSYN|tcpFlagACK, nil, "")
+	server.seq++
+	at = at.Add(pcapHandshakeNs)
+	pw.writeTCP(at, true, tcpFlagACK, nil, "")
+
+	if pw.options.Encapsulation != PcapWebSocket {
+		return at
+	}
+
+	request := fmt.Sprintf("GET %s HTTP/1.1\r\nHost: %s\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"+
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n", pw.options.Path, server.addr)
+	response := "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: s3pPLMBiTxaQ9kYGzzhZRbK+xOo=\r\n\r\n"
+
+	at = at.Add(pcapHandshakeNs)
+	pw.writeSegments(at, true, []byte(request), "synthetic websocket upgrade")
+	at = at.Add(pcapHandshakeNs)
+	pw.writeSegments(at, false, []byte(response), "")
+	return at
+}
+
+// writeTeardown 写出双方的FIN
+func (pw *pcapWriter) writeTeardown(at time.Time) {
+	pw.writeTCP(at, true, tcpFlagFIN|tcpFlagACK, nil, "")
+	pw.client.seq++
+	at = at.Add(pcapHandshakeNs)
+	pw.writeTCP(at, false, tcpFlagFIN|tcpFlagACK, nil, "")
+	pw.server.seq++
+	at = at.Add(pcapHandshakeNs)
+	pw.writeTCP(at, true, tcpFlagACK, nil, "")
+}
+
+// writeSegments 按MSS切分载荷写出TCP段，注释只加在第一个段上
+func (pw *pcapWriter) writeSegments(at time.Time, fromClient bool, payload []byte, comment string) {
+	sender := pw.server
+	if fromClient {
+		sender = pw.client
+	}
+	for offset := 0; offset < len(payload); offset += pcapMSS {
+		end := offset + pcapMSS
+		if end > len(payload) {
+			end = len(payload)
+		}
+		pw.writeTCP(at, fromClient, tcpFlagPSH|tcpFlagACK, payload[offset:end], comment)
+		sender.seq += uint32(end - offset)
+		comment = ""
+	}
+}
+
+// websocketFrame 封装为单帧WebSocket二进制消息，客户端发出的帧按协议加掩码
+func (pw *pcapWriter) websocketFrame(data []byte, fromClient bool) []byte {
+	header := make([]byte, 2, 14)
+	header[0] = wsFinBit | wsOpcodeBinary
+	switch {
+	case len(data) < 126:
+		header[1] = byte(len(data))
+	case len(data) <= 0xFFFF:
+		header[1] = 126
+		header = binary.BigEndian.AppendUint16(header, uint16(len(data)))
+	default:
+		header[1] = 127
+		header = binary.BigEndian.AppendUint64(header, uint64(len(data)))
+	}
+
+	if !fromClient {
+		return append(header, data...)
+	}
+
+	header[1] |= wsMaskBit
+	pw.masks++
+	var mask [4]byte
+	binary.BigEndian.PutUint32(mask[:], 0x5a17c0de^pw.masks)
+	header = append(header, mask[:]...)
+	framed := append(header, data...)
+	for i := range data {
+		framed[len(header)+i] ^= mask[i%4]
+	}
+	return framed
+}
+
+// writeTCP 写出一个Ethernet/IPv4/TCP报文
+func (pw *pcapWriter) writeTCP(at time.Time, fromClient bool, flags byte, payload []byte, comment string) {
+	src, dst := pw.server, pw.client
+	direction := uint32(pcapInbound)
+	if fromClient {
+		src, dst = pw.client, pw.server
+		direction = pcapOutbound
+	}
+
+	ack := uint32(0)
+	if flags&tcpFlagACK != 0 {
+		ack = dst.seq
+	}
+
+	tcp := make([]byte, 20, 20+len(payload))
+	binary.BigEndian.PutUint16(tcp[0:2], src.addr.Port())
+	binary.BigEndian.PutUint16(tcp[2:4], dst.addr.Port())
+	binary.BigEndian.PutUint32(tcp[4:8], src.seq)
+	binary.BigEndian.PutUint32(tcp[8:12], ack)
+	tcp[12] = 5 << 4 // 数据偏移：20字节
+	tcp[13] = flags
+	binary.BigEndian.PutUint16(tcp[14:16], 0xFFFF)
+	tcp = append(tcp, payload...)
+	binary.BigEndian.PutUint16(tcp[16:18], tcpChecksum(src.addr.Addr(), dst.addr.Addr(), tcp))
+
+	ip := make([]byte, 20, 20+len(tcp))
+	ip[0] = 0x45
+	binary.BigEndian.PutUint16(ip[2:4], uint16(20+len(tcp)))
+	binary.BigEndian.PutUint16(ip[4:6], src.ipID)
+	src.ipID++
+	binary.BigEndian.PutUint16(ip[6:8], 0x4000) // DF
+	ip[8] = 64
+	ip[9] = ipProtocolTCP
+	srcIP, dstIP := src.addr.Addr().As4(), dst.addr.Addr().As4()
+	copy(ip[12:16], srcIP[:])
+	copy(ip[16:20], dstIP[:])
+	binary.BigEndian.PutUint16(ip[10:12], internetChecksum(ip, 0))
+	ip = append(ip, tcp...)
+
+	packet := make([]byte, 14, 14+len(ip))
+	copy(packet[0:6], dst.mac[:])
+	copy(packet[6:12], src.mac[:])
+	binary.BigEndian.PutUint16(packet[12:14], etherTypeIPv4)
+	packet = append(packet, ip...)
+
+	pw.writePacket(at, packet, direction, comment)
+}
+
+// writeSectionHeader 写出文件头，会话元数据以JSON注释保存
+func (pw *pcapWriter) writeSectionHeader(session *Session) {
+	metadata := map[string]interface{}{
+		"session_id":     session.ID,
+		"schema_version": session.SchemaVersion,
+		"start_time":     session.StartTime,
+		"end_time":       session.EndTime,
+		"events":         len(session.Events),
+		"frames":         len(session.Frames),
+	}
+	if session.Stats != nil {
+		metadata["stats"] = session.Stats
+	}
+	comment, _ := json.Marshal(metadata)
+
+	body := make([]byte, 16)
+	binary.LittleEndian.PutUint32(body[0:4], 0x1A2B3C4D)
+	binary.LittleEndian.PutUint16(body[4:6], 1)
+	binary.LittleEndian.PutUint16(body[6:8], 0)
+	binary.LittleEndian.PutUint64(body[8:16], ^uint64(0)) // 段长度未知
+	body = appendPcapOption(body, pcapOptComment, comment)
+	body = appendPcapOption(body, pcapOptUserAppl, []byte("GoSlgBenchmarkTest session exporter"))
+	body = appendPcapOption(body, pcapOptEnd, nil)
+	pw.writeBlock(pcapBlockSHB, body)
+}
+
+// writeInterface 写出接口描述块，时间戳精度为纳秒
+func (pw *pcapWriter) writeInterface(session *Session) {
+	body := make([]byte, 8)
+	binary.LittleEndian.PutUint16(body[0:2], pcapLinkEther)
+	binary.LittleEndian.PutUint32(body[4:8], 0) // 不限制抓包长度
+	body = appendPcapOption(body, pcapOptIfName, []byte("session:"+session.ID))
+	body = appendPcapOption(body, pcapOptTsResol, []byte{pcapTsResolNano})
+	body = appendPcapOption(body, pcapOptEnd, nil)
+	pw.writeBlock(pcapBlockIDB, body)
+}
+
+// writePacket 写出增强报文块
+func (pw *pcapWriter) writePacket(at time.Time, packet []byte, direction uint32, comment string) {
+	timestamp := uint64(at.UnixNano())
+	body := make([]byte, 20, 20+len(packet)+32)
+	binary.LittleEndian.PutUint32(body[0:4], 0)
+	binary.LittleEndian.PutUint32(body[4:8], uint32(timestamp>>32))
+	binary.LittleEndian.PutUint32(body[8:12], uint32(timestamp))
+	binary.LittleEndian.PutUint32(body[12:16], uint32(len(packet)))
+	binary.LittleEndian.PutUint32(body[16:20], uint32(len(packet)))
+	body = append(body, packet...)
+	body = append(body, make([]byte, pad4(len(packet)))...)
+
+	flags := make([]byte, 4)
+	binary.LittleEndian.PutUint32(flags, direction)
+	body = appendPcapOption(body, pcapOptEPBFlags, flags)
+	if comment != "" {
+		body = appendPcapOption(body, pcapOptComment, []byte(comment))
+	}
+	body = appendPcapOption(body, pcapOptEnd, nil)
+	pw.writeBlock(pcapBlockEPB, body)
+}
+
+// writeBlock 写出块：类型 | 总长度 | 块体 | 总长度
+func (pw *pcapWriter) writeBlock(blockType uint32, body []byte) {
+	if pw.err != nil {
+		return
+	}
+	total := uint32(12 + len(body))
+	block := make([]byte, 0, total)
+	block = binary.LittleEndian.AppendUint32(block, blockType)
+	block = binary.LittleEndian.AppendUint32(block, total)
+	block = append(block, body...)
+	block = binary.LittleEndian.AppendUint32(block, total)
+	_, pw.err = pw.w.Write(block)
+}
+
+// appendPcapOption 追加一个选项，值按4字节对齐
+func appendPcapOption(buf []byte, code uint16, value []byte) []byte {
+	buf = binary.LittleEndian.AppendUint16(buf, code)
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(len(value)))
+	buf = append(buf, value...)
+	return append(buf, make([]byte, pad4(len(value)))...)
+}
+
+// pad4 补齐到4字节所需的填充长度
+func pad4(n int) int {
+	return (4 - n%4) % 4
+}
+
+// tcpChecksum 计算包含IPv4伪首部的TCP校验和
+func tcpChecksum(src, dst netip.Addr, segment []byte) uint16 {
+	srcIP, dstIP := src.As4(), dst.As4()
+	pseudo := make([]byte, 0, 12)
+	pseudo = append(pseudo, srcIP[:]...)
+	pseudo = append(pseudo, dstIP[:]...)
+	pseudo = append(pseudo, 0, ipProtocolTCP)
+	pseudo = binary.BigEndian.AppendUint16(pseudo, uint16(len(segment)))
+	return internetChecksum(segment, checksumSum(pseudo, 0))
+}
+
+// internetChecksum RFC 1071校验和，initial为已累加的部分和
+func internetChecksum(data []byte, initial uint32) uint16 {
+	sum := checksumSum(data, initial)
+	for sum>>16 != 0 {
+		sum = (sum & 0xFFFF) + (sum >> 16)
+	}
+	return ^uint16(sum)
+}
+
+// checksumSum 按16位大端字累加
+func checksumSum(data []byte, sum uint32) uint32 {
+	for i := 0; i+1 < len(data); i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(data[i:]))
+	}
+	if len(data)%2 == 1 {
+		sum += uint32(data[len(data)-1]) << 8
+	}
+	return sum
+}
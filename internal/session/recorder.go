@@ -22,6 +22,8 @@ const (
 	EventError          EventType = "ERROR"
 	EventReconnect      EventType = "RECONNECT"
 	EventClose          EventType = "CLOSE"
+	EventFaultInjected  EventType = "FAULT_INJECTED"
+	EventFrameDropped   EventType = "FRAME_DROPPED"
 )
 
 // CloseCode WebSocket关闭代码
@@ -67,6 +69,9 @@ type MessageFrame struct {
 	Timestamp   time.Time `json:"timestamp"`
 	Direction   string    `json:"direction"` // "send" or "receive"
 	SequenceNum uint64    `json:"sequence_num,omitempty"`
+	// 解码后的消息，启用消息体解码或调用DecodeSessionPayloads后填充
+	MessageType string          `json:"message_type,omitempty"` // 消息类型全名，如 game.v1.BattlePush
+	Payload     json.RawMessage `json:"payload,omitempty"`      // 消息体的protojson渲染，按字段白名单裁剪
 }
 
 // SessionStats 会话统计
@@ -108,6 +113,17 @@ type SessionRecorder struct {
 	minLatency   atomic.Int64
 	maxLatency   atomic.Int64
 
+	// 流式写入的会话文件或数据库（可选），retain为false时事件和帧不再保留在内存中
+	sink    SessionSink
+	retain  bool
+	sinkErr error
+
+	// 记录时解码消息体（可选），为nil时只保存原始字节
+	payloadOptions *PayloadDecodeOptions
+
+	// 飞行记录器模式（可选），只保留最近的记录并在触发时写出快照
+	flight *flightRecorder
+
 	// 同步控制
 	mu       sync.RWMutex
 	ctx      context.Context
@@ -180,11 +196,25 @@ func (r *SessionRecorder) RecordEvent(eventType EventType, metadata map[string]i
 	}
 
 	r.mu.Lock()
-	r.events = append(r.events, event)
+	if r.sink != nil {
+		r.writeToSink(r.sink.WriteEvent(event))
+	}
+	if r.sink == nil || r.retain {
+		r.events = append(r.events, event)
+		if r.flight != nil {
+			r.flight.bytes += estimateEventSize(event)
+			r.trimFlightBufferLocked()
+		}
+	}
+	flight := r.flight
 	r.mu.Unlock()
 
 	// 更新统计
 	r.updateStats(event)
+
+	if flight != nil {
+		r.checkEventTrigger(flight, event)
+	}
 }
 
 // RecordMessage 记录消息
@@ -203,8 +233,25 @@ func (r *SessionRecorder) RecordMessage(direction string, rawData []byte, opcode
 		SequenceNum: sequenceNum,
 	}
 
+	r.mu.RLock()
+	payloadOptions := r.payloadOptions
+	r.mu.RUnlock()
+	var payloadErr error
+	if payloadOptions != nil {
+		payloadErr = DecodeFramePayload(frame, payloadOptions)
+	}
+
 	r.mu.Lock()
-	r.frames = append(r.frames, frame)
+	if r.sink != nil {
+		r.writeToSink(r.sink.WriteFrame(frame))
+	}
+	if r.sink == nil || r.retain {
+		r.frames = append(r.frames, frame)
+		if r.flight != nil {
+			r.flight.bytes += estimateFrameSize(frame)
+			r.trimFlightBufferLocked()
+		}
+	}
 	r.mu.Unlock()
 
 	// 记录消息事件
@@ -213,13 +260,18 @@ func (r *SessionRecorder) RecordMessage(direction string, rawData []byte, opcode
 		eventType = EventMessageReceive
 	}
 
-	r.RecordEvent(eventType, map[string]interface{}{
+	metadata := map[string]interface{}{
 		"opcode":       opcode,
 		"message_size": len(rawData),
 		"body_size":    len(body),
 		"sequence_num": sequenceNum,
 		"direction":    direction,
-	})
+	}
+	annotateMessageEvent(metadata, frame)
+	if payloadErr != nil {
+		metadata["payload_error"] = payloadErr.Error()
+	}
+	r.RecordEvent(eventType, metadata)
 
 	// 更新消息统计
 	if direction == "send" {
@@ -231,6 +283,14 @@ func (r *SessionRecorder) RecordMessage(direction string, rawData []byte, opcode
 	}
 }
 
+// SetPayloadDecoding 启用记录时的消息体解码，之后记录的帧和消息事件带有消息类型与protojson渲染；
+// 传入nil关闭解码
+func (r *SessionRecorder) SetPayloadDecoding(options *PayloadDecodeOptions) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.payloadOptions = options
+}
+
 // RecordLatency 记录延迟
 func (r *SessionRecorder) RecordLatency(latency time.Duration) {
 	if !r.isActive.Load() || latency <= 0 {
@@ -266,6 +326,8 @@ func (r *SessionRecorder) RecordLatency(latency time.Duration) {
 			break
 		}
 	}
+
+	r.checkLatencyTrigger(latency)
 }
 
 // RecordReconnect 记录重连事件
@@ -281,6 +343,16 @@ func (r *SessionRecorder) RecordReconnect(attempt int, duration time.Duration, s
 	r.RecordEvent(EventReconnect, metadata)
 }
 
+// RecordFault 记录计划性故障注入事件（metadata中可带timestamp使用故障发生时间）
+func (r *SessionRecorder) RecordFault(faultType string, metadata map[string]interface{}) {
+	if metadata == nil {
+		metadata = make(map[string]interface{})
+	}
+	metadata["fault_type"] = faultType
+
+	r.RecordEvent(EventFaultInjected, metadata)
+}
+
 // RecordError 记录错误事件
 func (r *SessionRecorder) RecordError(err error, metadata map[string]interface{}) {
 	r.errorCount.Add(1)
@@ -317,11 +389,73 @@ func (r *SessionRecorder) Stop() {
 	// 计算最终统计
 	r.calculateFinalStats()
 
+	r.mu.Lock()
+	if r.sink != nil {
+		r.sink.SetStats(r.stats)
+	}
+	r.mu.Unlock()
+
 	// 记录会话结束事件
 	r.RecordEvent(EventDisconnect, map[string]interface{}{
 		"end_time": time.Now(),
 		"duration": time.Since(r.startTime),
 	})
+
+	// 停止后快照文件都已写完
+	r.WaitFlightSnapshots()
+}
+
+// SessionSink 流式接收录制内容的目标，如分块会话文件。方法在录制器的锁内调用，实现应避免在其中执行网络IO
+type SessionSink interface {
+	WriteEvent(event *SessionEvent) error
+	WriteFrame(frame *MessageFrame) error
+	WriteSession(session *Session) error
+	SetStats(stats *SessionStats)
+}
+
+// StreamTo 将已录制和之后录制的事件和帧按顺序追加写入sink。retain为false时不再在内存中保留，
+// 适合数小时的长录制；写入器由调用方在Stop之后关闭
+func (r *SessionRecorder) StreamTo(writer SessionSink, retain bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// 先写出切换前已录制的内容，保证文件包含完整会话
+	r.writeToSink(writer.WriteSession(&Session{Events: r.events, Frames: r.frames}))
+	if !retain {
+		r.events = make([]*SessionEvent, 0)
+		r.frames = make([]*MessageFrame, 0)
+	}
+	r.sink = writer
+	r.retain = retain
+}
+
+// SinkError 流式写入时遇到的第一个错误
+func (r *SessionRecorder) SinkError() error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.sinkErr
+}
+
+// writeToSink 记录流式写入错误，调用方需持有写锁
+func (r *SessionRecorder) writeToSink(err error) {
+	if err != nil && r.sinkErr == nil {
+		r.sinkErr = err
+	}
+}
+
+// ExportFile 将内存中的会话导出为分块会话文件
+func (r *SessionRecorder) ExportFile(path string, options *SessionFileOptions) error {
+	session := r.GetSession()
+
+	writer, err := CreateSessionFile(path, session.ID, session.StartTime, options)
+	if err != nil {
+		return err
+	}
+	if err := writer.WriteSession(session); err != nil {
+		writer.Close()
+		return err
+	}
+	return writer.Close()
 }
 
 // GetSession 获取完整会话记录
@@ -330,12 +464,13 @@ func (r *SessionRecorder) GetSession() *Session {
 	defer r.mu.RUnlock()
 
 	return &Session{
-		ID:        r.sessionID,
-		StartTime: r.startTime,
-		EndTime:   time.Now(),
-		Events:    append([]*SessionEvent{}, r.events...),
-		Frames:    append([]*MessageFrame{}, r.frames...),
-		Stats:     r.stats,
+		SchemaVersion: CurrentSchemaVersion,
+		ID:            r.sessionID,
+		StartTime:     r.startTime,
+		EndTime:       time.Now(),
+		Events:        append([]*SessionEvent{}, r.events...),
+		Frames:        append([]*MessageFrame{}, r.frames...),
+		Stats:         r.stats,
 	}
 }
 
@@ -402,12 +537,13 @@ func (r *SessionRecorder) ExportJSON() ([]byte, error) {
 	}
 
 	session := &Session{
-		ID:        r.sessionID,
-		StartTime: r.startTime,
-		EndTime:   time.Now(),
-		Events:    filteredEvents,
-		Frames:    append([]*MessageFrame{}, r.frames...),
-		Stats:     r.stats,
+		SchemaVersion: CurrentSchemaVersion,
+		ID:            r.sessionID,
+		StartTime:     r.startTime,
+		EndTime:       time.Now(),
+		Events:        filteredEvents,
+		Frames:        append([]*MessageFrame{}, r.frames...),
+		Stats:         r.stats,
 	}
 
 	return json.MarshalIndent(session, "", "  ")
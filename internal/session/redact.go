@@ -0,0 +1,557 @@
+package session
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"maps"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"GoSlgBenchmarkTest/internal/protocol"
+)
+
+// RedactAction 字段的脱敏方式
+type RedactAction string
+
+const (
+	RedactDrop      RedactAction = "drop"      // 清空字段或删除元数据键
+	RedactHash      RedactAction = "hash"      // 替换为带密钥的哈希，相同原值得到相同结果
+	RedactPseudonym RedactAction = "pseudonym" // 替换为带前缀的假名，所有帧和事件中保持一致
+	RedactScrub     RedactAction = "scrub"     // 替换为字节长度相同的占位文本，保留空白
+)
+
+const (
+	hashLength        = 32 // 哈希结果的十六进制长度
+	pseudonymLength   = 12 // 假名中哈希部分的十六进制长度
+	minEmbeddedLength = 4  // 替换嵌入文本时原值的最短长度，避免误伤短字符串
+)
+
+// RedactRule 一条脱敏规则
+type RedactRule struct {
+	Opcode uint16       `json:"opcode"`           // 0表示所有操作码
+	Field  string       `json:"field"`            // proto字段名，嵌套字段用点分隔；元数据规则中为元数据键
+	Action RedactAction `json:"action"`           // 脱敏方式
+	Prefix string       `json:"prefix,omitempty"` // 假名前缀，如player_
+}
+
+// RedactionConfig 会话脱敏配置
+type RedactionConfig struct {
+	// Key 哈希和假名使用的密钥；为空时每个脱敏器随机生成，假名只在同一脱敏器处理的会话之间一致
+	Key string `json:"-"`
+	// FrameRules 作用于消息体，以及帧和消息事件中已解码的payload
+	FrameRules []RedactRule `json:"frame_rules"`
+	// MetadataRules 作用于事件元数据，Opcode非0时只匹配该操作码的消息事件
+	MetadataRules []RedactRule `json:"metadata_rules"`
+	// ReplaceEmbedded 其他字符串字段、事件错误和元数据中出现的假名原值（如错误信息中的玩家ID）同样替换
+	ReplaceEmbedded bool `json:"replace_embedded"`
+	// OpaqueBodies 未知操作码消息体的处理方式：为空保留原样，RedactDrop清空，RedactScrub按原长度填零
+	OpaqueBodies RedactAction `json:"opaque_bodies"`
+}
+
+// DefaultRedactionConfig 默认脱敏配置：哈希令牌、设备和会话ID，玩家ID使用假名，擦除聊天内容
+func DefaultRedactionConfig() *RedactionConfig {
+	return &RedactionConfig{
+		FrameRules: []RedactRule{
+			{Field: "token", Action: RedactHash},
+			{Field: "device_id", Action: RedactHash},
+			{Field: "session_id", Action: RedactHash},
+			{Field: "player_id", Action: RedactPseudonym, Prefix: "player_"},
+			{Field: "action_data.chat.message", Action: RedactScrub},
+		},
+		MetadataRules: []RedactRule{
+			{Field: "token", Action: RedactDrop},
+			{Field: "device_id", Action: RedactHash},
+			{Field: "player_id", Action: RedactPseudonym, Prefix: "player_"},
+			{Field: "username", Action: RedactPseudonym, Prefix: "user_"},
+		},
+		ReplaceEmbedded: true,
+		OpaqueBodies:    RedactScrub,
+	}
+}
+
+// RedactionReport 脱敏统计，不包含任何原值
+type RedactionReport struct {
+	Frames       int `json:"frames"`        // 改写的帧数
+	Events       int `json:"events"`        // 改写的事件数
+	Fields       int `json:"fields"`        // 脱敏的字段和元数据值数
+	Pseudonyms   int `json:"pseudonyms"`    // 分配了假名的原值数
+	OpaqueFrames int `json:"opaque_frames"` // 按OpaqueBodies处理的未知消息体帧数
+}
+
+// Redactor 会话脱敏器。同一脱敏器处理的多个会话（如同一场战斗的多名玩家）使用相同的假名
+type Redactor struct {
+	config *RedactionConfig
+	key    []byte
+
+	mu         sync.Mutex
+	pseudonyms map[string]string // 原值 -> 假名，用于替换嵌入在其他文本中的原值
+}
+
+// NewRedactor 创建会话脱敏器，config为nil时使用默认配置
+func NewRedactor(config *RedactionConfig) *Redactor {
+	if config == nil {
+		config = DefaultRedactionConfig()
+	}
+	key := []byte(config.Key)
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		rand.Read(key)
+	}
+	return &Redactor{
+		config:     config,
+		key:        key,
+		pseudonyms: make(map[string]string),
+	}
+}
+
+// RedactSession 使用给定配置脱敏单个会话
+func RedactSession(session *Session, config *RedactionConfig) (*Session, *RedactionReport, error) {
+	return NewRedactor(config).Redact(session)
+}
+
+// redactedFrame 第一遍解码并按规则改写后的帧，第二遍替换嵌入文本并重新编码
+type redactedFrame struct {
+	frame   *MessageFrame
+	message proto.Message // 消息体，未知操作码为nil
+	payload proto.Message // 已解码的payload，未解码时为nil
+	changed int
+}
+
+// Redact 返回脱敏后的会话副本，原会话保持不变。消息体按规则改写后重新编码成帧，
+// 消息事件的大小和payload随之更新，因此脱敏后的会话仍可回放和比较
+func (r *Redactor) Redact(session *Session) (*Session, *RedactionReport, error) {
+	if session == nil {
+		return nil, nil, fmt.Errorf("%w: nil session", ErrSessionCorrupt)
+	}
+	report := &RedactionReport{}
+	redacted := &Session{
+		SchemaVersion: session.SchemaVersion,
+		ID:            session.ID,
+		StartTime:     session.StartTime,
+		EndTime:       session.EndTime,
+		Frames:        make([]*MessageFrame, 0, len(session.Frames)),
+		Events:        make([]*SessionEvent, 0, len(session.Events)),
+	}
+	if session.Stats != nil {
+		stats := *session.Stats
+		redacted.Stats = &stats
+	}
+
+	// 第一遍：解码消息体并按规则改写，同时收集假名原值
+	pending := make([]*redactedFrame, 0, len(session.Frames))
+	for i, frame := range session.Frames {
+		if frame == nil {
+			continue
+		}
+		item, err := r.decodeFrame(frame)
+		if err != nil {
+			return nil, nil, fmt.Errorf("redact frame %d (%s): %w", i, protocol.OpcodeToString(frame.Opcode), err)
+		}
+		pending = append(pending, item)
+	}
+
+	eventChanges := make(map[*SessionEvent]int)
+	for _, event := range session.Events {
+		if event == nil {
+			continue
+		}
+		copied := *event
+		copied.Metadata = maps.Clone(event.Metadata)
+		eventChanges[&copied] = r.redactMetadata(&copied)
+		redacted.Events = append(redacted.Events, &copied)
+	}
+
+	// 第二遍：替换嵌入文本中的原值，重新编码改写过的帧
+	replacer := r.replacer()
+	for _, item := range pending {
+		if item.message != nil && replacer != nil {
+			skip := r.rulePaths(item.frame.Opcode)
+			item.changed += replaceStrings(item.message.ProtoReflect(), "", skip, replacer)
+			if item.payload != nil {
+				item.changed += replaceStrings(item.payload.ProtoReflect(), "", skip, replacer)
+			}
+		}
+		frame, err := r.encodeFrame(item, report)
+		if err != nil {
+			return nil, nil, fmt.Errorf("redact %s frame: %w", protocol.OpcodeToString(item.frame.Opcode), err)
+		}
+		if redacted.Stats != nil {
+			delta := int64(len(frame.RawData) - len(item.frame.RawData))
+			if frame.Direction == "send" {
+				redacted.Stats.BytesSent += delta
+			} else {
+				redacted.Stats.BytesReceived += delta
+			}
+		}
+		redacted.Frames = append(redacted.Frames, frame)
+	}
+
+	// 消息事件的大小和payload取自改写后的帧；无法配对的事件不保留payload
+	pairs := pairMessageFrames(redacted)
+	for _, event := range redacted.Events {
+		changed := eventChanges[event]
+		if replacer != nil {
+			changed += r.replaceEventText(event, replacer)
+		}
+		report.Fields += changed
+		if event.Type == EventMessageSend || event.Type == EventMessageReceive {
+			changed += updateMessageEvent(event, pairs[event])
+		}
+		if changed > 0 {
+			report.Events++
+		}
+	}
+
+	r.mu.Lock()
+	report.Pseudonyms = len(r.pseudonyms)
+	r.mu.Unlock()
+	return redacted, report, nil
+}
+
+// decodeFrame 解码帧的消息体和payload并应用帧规则
+func (r *Redactor) decodeFrame(frame *MessageFrame) (*redactedFrame, error) {
+	item := &redactedFrame{frame: frame}
+	item.message = protocol.NewMessage(frame.Opcode)
+	if item.message == nil {
+		return item, nil
+	}
+	if err := proto.Unmarshal(frame.Body, item.message); err != nil {
+		return nil, err
+	}
+	item.changed += r.applyFrameRules(frame.Opcode, item.message.ProtoReflect())
+
+	if frame.Payload != nil {
+		item.payload = protocol.NewMessage(frame.Opcode)
+		if err := protojson.Unmarshal(frame.Payload, item.payload); err != nil {
+			return nil, fmt.Errorf("payload: %w", err)
+		}
+		item.changed += r.applyFrameRules(frame.Opcode, item.payload.ProtoReflect())
+	}
+	return item, nil
+}
+
+// encodeFrame 重新编码改写过的消息体，未改写的帧沿用原始字节
+func (r *Redactor) encodeFrame(item *redactedFrame, report *RedactionReport) (*MessageFrame, error) {
+	frame := *item.frame
+	var body []byte
+	switch {
+	case item.message == nil:
+		switch r.config.OpaqueBodies {
+		case RedactDrop:
+			body = []byte{}
+		case RedactScrub:
+			body = make([]byte, len(frame.Body))
+		default:
+			return &frame, nil
+		}
+		if len(frame.Body) == 0 {
+			return &frame, nil
+		}
+		report.OpaqueFrames++
+	case item.changed == 0:
+		return &frame, nil
+	default:
+		var err error
+		if body, err = proto.Marshal(item.message); err != nil {
+			return nil, err
+		}
+		if item.payload != nil {
+			if frame.Payload, err = renderPayload(item.payload); err != nil {
+				return nil, err
+			}
+		}
+		report.Fields += item.changed
+	}
+
+	if isRawFrame(item.frame) {
+		// 无法解析协议头的原始帧（操作码0，消息体即整帧）保持原始格式，不补协议头
+		frame.RawData = body
+		frame.Body = body
+	} else {
+		raw := protocol.EncodeFrame(frame.Opcode, body)
+		frame.RawData = raw
+		frame.Body = raw[len(raw)-len(body):]
+	}
+	report.Frames++
+	return &frame, nil
+}
+
+// isRawFrame 判断是否为代理按原样录制的非协议帧：操作码为0且消息体就是整帧数据
+func isRawFrame(frame *MessageFrame) bool {
+	return frame.Opcode == 0 && bytes.Equal(frame.Body, frame.RawData)
+}
+
+// applyFrameRules 对消息应用匹配操作码的帧规则，返回脱敏的值数
+func (r *Redactor) applyFrameRules(opcode uint16, message protoreflect.Message) int {
+	changed := 0
+	for _, rule := range r.config.FrameRules {
+		if rule.Opcode != 0 && rule.Opcode != opcode {
+			continue
+		}
+		changed += r.applyField(message, strings.Split(rule.Field, "."), rule)
+	}
+	return changed
+}
+
+// applyField 沿字段路径找到字符串字段并脱敏，路径经过的重复消息逐个处理
+func (r *Redactor) applyField(message protoreflect.Message, path []string, rule RedactRule) int {
+	fd := message.Descriptor().Fields().ByName(protoreflect.Name(path[0]))
+	if fd == nil || fd.IsMap() || !message.Has(fd) {
+		return 0
+	}
+	if len(path) > 1 {
+		if fd.Kind() != protoreflect.MessageKind {
+			return 0
+		}
+		if !fd.IsList() {
+			return r.applyField(message.Mutable(fd).Message(), path[1:], rule)
+		}
+		changed := 0
+		list := message.Mutable(fd).List()
+		for i := 0; i < list.Len(); i++ {
+			changed += r.applyField(list.Get(i).Message(), path[1:], rule)
+		}
+		return changed
+	}
+
+	if rule.Action == RedactDrop {
+		message.Clear(fd)
+		return 1
+	}
+	if fd.Kind() != protoreflect.StringKind {
+		return 0
+	}
+	if !fd.IsList() {
+		message.Set(fd, protoreflect.ValueOfString(r.redactString(message.Get(fd).String(), rule)))
+		return 1
+	}
+	list := message.Mutable(fd).List()
+	for i := 0; i < list.Len(); i++ {
+		list.Set(i, protoreflect.ValueOfString(r.redactString(list.Get(i).String(), rule)))
+	}
+	return list.Len()
+}
+
+// redactMetadata 对事件元数据应用元数据规则，返回脱敏的值数
+func (r *Redactor) redactMetadata(event *SessionEvent) int {
+	changed := 0
+	for _, rule := range r.config.MetadataRules {
+		if rule.Opcode != 0 && rule.Opcode != event.Opcode {
+			continue
+		}
+		value, ok := event.Metadata[rule.Field]
+		if !ok {
+			continue
+		}
+		switch text, isString := value.(string); {
+		case rule.Action == RedactDrop:
+			delete(event.Metadata, rule.Field)
+		case isString:
+			event.Metadata[rule.Field] = r.redactString(text, rule)
+		case rule.Action == RedactScrub:
+			continue
+		default:
+			// 数字形式的ID按文本处理，与帧中的字符串ID得到相同的假名
+			event.Metadata[rule.Field] = r.redactString(fmt.Sprint(value), rule)
+		}
+		changed++
+	}
+	return changed
+}
+
+// replaceEventText 替换事件错误和元数据字符串中嵌入的原值，已由元数据规则处理的键除外
+func (r *Redactor) replaceEventText(event *SessionEvent, replacer *strings.Replacer) int {
+	changed := 0
+	if replaced := replacer.Replace(event.Error); replaced != event.Error {
+		event.Error = replaced
+		changed++
+	}
+	for key, value := range event.Metadata {
+		text, ok := value.(string)
+		if !ok || r.hasMetadataRule(key, event.Opcode) {
+			continue
+		}
+		if replaced := replacer.Replace(text); replaced != text {
+			event.Metadata[key] = replaced
+			changed++
+		}
+	}
+	return changed
+}
+
+// updateMessageEvent 按配对的帧更新消息事件的大小和payload，返回改动数
+func updateMessageEvent(event *SessionEvent, frame *MessageFrame) int {
+	if frame == nil {
+		if _, ok := event.Metadata["payload"]; ok {
+			delete(event.Metadata, "payload")
+			return 1
+		}
+		return 0
+	}
+
+	changed := 0
+	if event.MessageSize != 0 && event.MessageSize != len(frame.RawData) {
+		event.MessageSize = len(frame.RawData)
+		changed++
+	}
+	if event.Metadata == nil {
+		return changed
+	}
+	if _, ok := event.Metadata["message_size"]; ok {
+		event.Metadata["message_size"] = len(frame.RawData)
+		event.Metadata["body_size"] = len(frame.Body)
+	}
+	if _, ok := event.Metadata["payload"]; ok {
+		delete(event.Metadata, "payload")
+		annotateMessageEvent(event.Metadata, frame)
+		changed++
+	}
+	return changed
+}
+
+// redactString 按规则脱敏单个字符串，空字符串保持为空
+func (r *Redactor) redactString(value string, rule RedactRule) string {
+	if value == "" {
+		return value
+	}
+	switch rule.Action {
+	case RedactHash:
+		return r.digest(value)[:hashLength]
+	case RedactPseudonym:
+		pseudonym := rule.Prefix + r.digest(value)[:pseudonymLength]
+		r.mu.Lock()
+		r.pseudonyms[value] = pseudonym
+		r.mu.Unlock()
+		return pseudonym
+	case RedactScrub:
+		return scrubText(value)
+	default:
+		return value
+	}
+}
+
+// digest 计算带密钥的HMAC-SHA256，没有密钥的人无法通过枚举还原原值
+func (r *Redactor) digest(value string) string {
+	mac := hmac.New(sha256.New, r.key)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// replacer 构造嵌入文本的替换器，原值按长度从长到短匹配；未启用或没有原值时返回nil
+func (r *Redactor) replacer() *strings.Replacer {
+	if !r.config.ReplaceEmbedded {
+		return nil
+	}
+	r.mu.Lock()
+	originals := make([]string, 0, len(r.pseudonyms))
+	for original := range r.pseudonyms {
+		if len(original) >= minEmbeddedLength {
+			originals = append(originals, original)
+		}
+	}
+	sort.Slice(originals, func(i, j int) bool {
+		if len(originals[i]) != len(originals[j]) {
+			return len(originals[i]) > len(originals[j])
+		}
+		return originals[i] < originals[j]
+	})
+	pairs := make([]string, 0, 2*len(originals))
+	for _, original := range originals {
+		pairs = append(pairs, original, r.pseudonyms[original])
+	}
+	r.mu.Unlock()
+
+	if len(pairs) == 0 {
+		return nil
+	}
+	return strings.NewReplacer(pairs...)
+}
+
+// rulePaths 匹配操作码的帧规则字段路径，替换嵌入文本时跳过这些已脱敏的字段
+func (r *Redactor) rulePaths(opcode uint16) map[string]bool {
+	paths := make(map[string]bool)
+	for _, rule := range r.config.FrameRules {
+		if rule.Opcode == 0 || rule.Opcode == opcode {
+			paths[rule.Field] = true
+		}
+	}
+	return paths
+}
+
+// hasMetadataRule 元数据键是否已由元数据规则处理
+func (r *Redactor) hasMetadataRule(key string, opcode uint16) bool {
+	for _, rule := range r.config.MetadataRules {
+		if rule.Field == key && (rule.Opcode == 0 || rule.Opcode == opcode) {
+			return true
+		}
+	}
+	return false
+}
+
+// replaceStrings 递归替换消息中所有字符串字段里的原值，返回改动的值数
+func replaceStrings(message protoreflect.Message, prefix string, skip map[string]bool, replacer *strings.Replacer) int {
+	// 遍历期间修改消息的行为未定义，先收集已填充的字段
+	var fields []protoreflect.FieldDescriptor
+	message.Range(func(fd protoreflect.FieldDescriptor, _ protoreflect.Value) bool {
+		fields = append(fields, fd)
+		return true
+	})
+
+	changed := 0
+	for _, fd := range fields {
+		path := prefix + string(fd.Name())
+		if skip[path] || fd.IsMap() {
+			continue
+		}
+		switch {
+		case fd.Kind() == protoreflect.StringKind && fd.IsList():
+			list := message.Mutable(fd).List()
+			for i := 0; i < list.Len(); i++ {
+				if text := list.Get(i).String(); replacer.Replace(text) != text {
+					list.Set(i, protoreflect.ValueOfString(replacer.Replace(text)))
+					changed++
+				}
+			}
+		case fd.Kind() == protoreflect.StringKind:
+			if text := message.Get(fd).String(); replacer.Replace(text) != text {
+				message.Set(fd, protoreflect.ValueOfString(replacer.Replace(text)))
+				changed++
+			}
+		case fd.Kind() == protoreflect.MessageKind && fd.IsList():
+			list := message.Mutable(fd).List()
+			for i := 0; i < list.Len(); i++ {
+				changed += replaceStrings(list.Get(i).Message(), path+".", skip, replacer)
+			}
+		case fd.Kind() == protoreflect.MessageKind:
+			changed += replaceStrings(message.Mutable(fd).Message(), path+".", skip, replacer)
+		}
+	}
+	return changed
+}
+
+// scrubText 将文本替换为字节长度相同的占位字符，保留空白以维持词的分布
+func scrubText(text string) string {
+	var scrubbed strings.Builder
+	scrubbed.Grow(len(text))
+	for len(text) > 0 {
+		char, width := utf8.DecodeRuneInString(text)
+		if unicode.IsSpace(char) {
+			scrubbed.WriteString(text[:width])
+		} else {
+			scrubbed.WriteString(strings.Repeat("x", width))
+		}
+		text = text[width:]
+	}
+	return scrubbed.String()
+}
@@ -0,0 +1,419 @@
+package session
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// errBreakpointNotFound 删除不存在的断点
+var errBreakpointNotFound = errors.New("breakpoint not found")
+
+// maxStepCount 单次step请求最多执行的步数
+const maxStepCount = 1000
+
+// ReplayController 回放调试控制接口，HTTP路由：
+//
+//	GET    /state                              回放状态
+//	POST   /play /pause /resume /stop          播放控制，/play从游标处继续，游标在末尾时从头播放
+//	POST   /step?direction=forward|back&count=N 单步，N最大为1000
+//	POST   /seek?index=N | time=RFC3339 | offset=10m30s
+//	GET    /breakpoints                        断点列表
+//	POST   /breakpoints                        添加断点（请求体为Breakpoint的JSON）
+//	DELETE /breakpoints[?id=N]                 删除断点，不带id时全部删除
+//	GET    /events?from=N&limit=M              按回放顺序查看事件
+//	GET    /ws                                 WebSocket：推送回放事件和断点命中，接受同名命令
+type ReplayController struct {
+	replayer *SessionReplayer
+	mux      *http.ServeMux
+	upgrader websocket.Upgrader
+
+	commandMu sync.Mutex // 串行执行控制命令
+	clientsMu sync.Mutex
+	clients   map[*replayClient]struct{}
+}
+
+// replayClient WebSocket客户端，消息经发送队列写出，慢客户端丢弃消息而不阻塞回放
+type replayClient struct {
+	conn *websocket.Conn
+	send chan []byte
+}
+
+// replayCommand WebSocket命令
+type replayCommand struct {
+	Command    string            `json:"command"`
+	Params     map[string]string `json:"params,omitempty"`
+	Breakpoint *Breakpoint       `json:"breakpoint,omitempty"`
+}
+
+// replayMessage WebSocket推送消息
+type replayMessage struct {
+	Type    string         `json:"type"` // event / breakpoint / result
+	Event   *replayedEvent `json:"event,omitempty"`
+	Hit     *BreakpointHit `json:"hit,omitempty"`
+	Command string         `json:"command,omitempty"`
+	Result  interface{}    `json:"result,omitempty"`
+	Error   string         `json:"error,omitempty"`
+}
+
+// replayedEvent ReplayEvent的JSON形式，错误以字符串输出
+type replayedEvent struct {
+	Index      int           `json:"index"`
+	Event      *SessionEvent `json:"event"`
+	ReplayTime time.Time     `json:"replay_time"`
+	Delay      time.Duration `json:"delay"`
+	Error      string        `json:"error,omitempty"`
+}
+
+// NewReplayController 创建回放控制接口，回放事件和断点命中会推送给所有WebSocket客户端
+func NewReplayController(replayer *SessionReplayer) *ReplayController {
+	c := &ReplayController{
+		replayer: replayer,
+		mux:      http.NewServeMux(),
+		upgrader: websocket.Upgrader{
+			CheckOrigin: func(r *http.Request) bool { return true },
+		},
+		clients: make(map[*replayClient]struct{}),
+	}
+
+	for _, command := range []string{"play", "pause", "resume", "stop", "step", "seek"} {
+		c.mux.HandleFunc("/"+command, c.route(http.MethodPost, command))
+	}
+	c.mux.HandleFunc("/state", c.route(http.MethodGet, "state"))
+	c.mux.HandleFunc("/events", c.route(http.MethodGet, "events"))
+	c.mux.HandleFunc("/breakpoints", c.handleBreakpoints)
+	c.mux.HandleFunc("/ws", c.handleWebSocket)
+
+	replayer.AddCallback(func(event *ReplayEvent) error {
+		c.broadcast(&replayMessage{Type: "event", Event: newReplayedEvent(event)})
+		return nil
+	})
+	replayer.OnBreakpoint(func(hit *BreakpointHit) {
+		c.broadcast(&replayMessage{Type: "breakpoint", Hit: hit})
+	})
+	return c
+}
+
+// ServeHTTP 实现http.Handler
+func (c *ReplayController) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mux.ServeHTTP(w, r)
+}
+
+// route 将HTTP请求映射为控制命令
+func (c *ReplayController) route(method, command string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		c.respond(w, command, r.URL.Query(), nil)
+	}
+}
+
+// handleBreakpoints 断点的查看、添加和删除
+func (c *ReplayController) handleBreakpoints(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		c.respond(w, "breakpoints", r.URL.Query(), nil)
+	case http.MethodPost:
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("read body failed: %v", err), http.StatusBadRequest)
+			return
+		}
+		var breakpoint Breakpoint
+		if err := json.Unmarshal(body, &breakpoint); err != nil {
+			http.Error(w, fmt.Sprintf("invalid breakpoint: %v", err), http.StatusBadRequest)
+			return
+		}
+		c.respond(w, "add_breakpoint", r.URL.Query(), &breakpoint)
+	case http.MethodDelete:
+		if r.URL.Query().Get("id") == "" {
+			c.respond(w, "clear_breakpoints", r.URL.Query(), nil)
+		} else {
+			c.respond(w, "remove_breakpoint", r.URL.Query(), nil)
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// respond 执行命令并输出JSON结果
+func (c *ReplayController) respond(w http.ResponseWriter, command string, params url.Values, breakpoint *Breakpoint) {
+	result, err := c.execute(command, params, breakpoint)
+	if err != nil {
+		status := http.StatusBadRequest
+		switch {
+		case errors.Is(err, ErrReplayRunning):
+			status = http.StatusConflict
+		case errors.Is(err, errBreakpointNotFound):
+			status = http.StatusNotFound
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// execute 执行控制命令，HTTP和WebSocket共用
+func (c *ReplayController) execute(command string, params url.Values, breakpoint *Breakpoint) (interface{}, error) {
+	c.commandMu.Lock()
+	defer c.commandMu.Unlock()
+
+	r := c.replayer
+	switch command {
+	case "state":
+		return r.GetState(), nil
+	case "play", "pause", "resume", "stop":
+		var err error
+		switch command {
+		case "play":
+			err = r.Play()
+		case "pause":
+			err = r.Pause()
+		case "resume":
+			err = r.Resume()
+		case "stop":
+			err = r.Stop()
+		}
+		if err != nil {
+			return nil, err
+		}
+		return r.GetState(), nil
+	case "step":
+		return c.step(params)
+	case "seek":
+		if err := c.seek(params); err != nil {
+			return nil, err
+		}
+		return r.GetState(), nil
+	case "breakpoints":
+		return map[string]interface{}{"breakpoints": r.Breakpoints()}, nil
+	case "add_breakpoint":
+		if breakpoint == nil {
+			return nil, fmt.Errorf("breakpoint is required")
+		}
+		id, err := r.AddBreakpoint(breakpoint)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"id": id}, nil
+	case "remove_breakpoint":
+		id, err := strconv.Atoi(params.Get("id"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid breakpoint id %q", params.Get("id"))
+		}
+		if !r.RemoveBreakpoint(id) {
+			return nil, fmt.Errorf("%w: %d", errBreakpointNotFound, id)
+		}
+		return map[string]interface{}{"removed": id}, nil
+	case "clear_breakpoints":
+		r.ClearBreakpoints()
+		return map[string]interface{}{"breakpoints": r.Breakpoints()}, nil
+	case "events":
+		from, err := intParam(params, "from", r.GetState().Position)
+		if err != nil {
+			return nil, err
+		}
+		limit, err := intParam(params, "limit", 50)
+		if err != nil {
+			return nil, err
+		}
+		events, err := r.EventRange(from, limit)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"from": from, "events": events}, nil
+	}
+	return nil, fmt.Errorf("unknown command %q", command)
+}
+
+// step 单步执行count次（最多maxStepCount次），到达边界时返回已执行的部分
+func (c *ReplayController) step(params url.Values) (interface{}, error) {
+	count, err := intParam(params, "count", 1)
+	if err != nil {
+		return nil, err
+	}
+	if count == 0 {
+		return nil, fmt.Errorf("invalid count %q", params.Get("count"))
+	}
+	count = min(count, maxStepCount)
+	direction := params.Get("direction")
+	if direction != "" && direction != "forward" && direction != "back" {
+		return nil, fmt.Errorf("unknown step direction %q", direction)
+	}
+
+	events := make([]interface{}, 0, count)
+	for len(events) < count {
+		var event interface{}
+		if direction == "back" {
+			event, err = c.replayer.StepBack()
+		} else {
+			var replayEvent *ReplayEvent
+			if replayEvent, err = c.replayer.StepForward(); err == nil {
+				event = newReplayedEvent(replayEvent)
+			}
+		}
+		if err != nil {
+			if len(events) > 0 && (errors.Is(err, io.EOF) || errors.Is(err, ErrReplayAtStart)) {
+				break
+			}
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return map[string]interface{}{"events": events, "state": c.replayer.GetState()}, nil
+}
+
+// seek 按事件序号、绝对时间或相对会话开始的偏移跳转
+func (c *ReplayController) seek(params url.Values) error {
+	switch {
+	case params.Get("index") != "":
+		index, err := strconv.Atoi(params.Get("index"))
+		if err != nil {
+			return fmt.Errorf("invalid index %q", params.Get("index"))
+		}
+		return c.replayer.SeekToIndex(index)
+	case params.Get("time") != "":
+		t, err := time.Parse(time.RFC3339Nano, params.Get("time"))
+		if err != nil {
+			return fmt.Errorf("invalid time %q: %w", params.Get("time"), err)
+		}
+		return c.replayer.SeekTo(t)
+	case params.Get("offset") != "":
+		offset, err := time.ParseDuration(params.Get("offset"))
+		if err != nil {
+			return fmt.Errorf("invalid offset %q: %w", params.Get("offset"), err)
+		}
+		start := c.replayer.session.StartTime
+		if start.IsZero() {
+			if events, _ := c.replayer.EventRange(0, 1); len(events) > 0 {
+				start = events[0].Timestamp
+			}
+		}
+		if start.IsZero() {
+			return fmt.Errorf("%w: session start time is unknown, seek by time instead", ErrReplayNotSeekable)
+		}
+		return c.replayer.SeekTo(start.Add(offset))
+	}
+	return fmt.Errorf("one of index, time or offset is required")
+}
+
+// handleWebSocket 推送回放事件和断点命中，并执行客户端发来的命令
+func (c *ReplayController) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := c.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("Replay control upgrade failed: %v", err)
+		return
+	}
+
+	client := &replayClient{conn: conn, send: make(chan []byte, 256)}
+	c.clientsMu.Lock()
+	c.clients[client] = struct{}{}
+	c.clientsMu.Unlock()
+
+	go client.writeLoop()
+	defer func() {
+		c.clientsMu.Lock()
+		delete(c.clients, client)
+		close(client.send)
+		c.clientsMu.Unlock()
+	}()
+
+	for {
+		var cmd replayCommand
+		if err := conn.ReadJSON(&cmd); err != nil {
+			return
+		}
+		params := url.Values{}
+		for key, value := range cmd.Params {
+			params.Set(key, value)
+		}
+
+		message := &replayMessage{Type: "result", Command: cmd.Command}
+		if result, err := c.execute(cmd.Command, params, cmd.Breakpoint); err != nil {
+			message.Error = err.Error()
+		} else {
+			message.Result = result
+		}
+		c.sendTo(client, message)
+	}
+}
+
+// writeLoop 写出发送队列中的消息，队列关闭后关闭连接
+func (client *replayClient) writeLoop() {
+	defer client.conn.Close()
+	for data := range client.send {
+		client.conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+		if err := client.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+			return
+		}
+	}
+}
+
+// broadcast 推送消息给所有客户端
+func (c *ReplayController) broadcast(message *replayMessage) {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return
+	}
+	c.clientsMu.Lock()
+	defer c.clientsMu.Unlock()
+	for client := range c.clients {
+		select {
+		case client.send <- data:
+		default:
+		}
+	}
+}
+
+// sendTo 推送消息给单个客户端
+func (c *ReplayController) sendTo(client *replayClient, message *replayMessage) {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return
+	}
+	c.clientsMu.Lock()
+	defer c.clientsMu.Unlock()
+	select {
+	case client.send <- data:
+	default:
+	}
+}
+
+// newReplayedEvent 转换为JSON形式
+func newReplayedEvent(event *ReplayEvent) *replayedEvent {
+	view := &replayedEvent{
+		Index:      event.Index,
+		Event:      event.OriginalEvent,
+		ReplayTime: event.ReplayTime,
+		Delay:      event.Delay,
+	}
+	if event.Error != nil {
+		view.Error = event.Error.Error()
+	}
+	return view
+}
+
+// intParam 解析整数查询参数，缺省时返回默认值
+func intParam(params url.Values, name string, fallback int) (int, error) {
+	value := params.Get(name)
+	if value == "" {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid %s %q", name, value)
+	}
+	return n, nil
+}
@@ -0,0 +1,502 @@
+package session
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	"GoSlgBenchmarkTest/internal/protocol"
+)
+
+var (
+	// ErrReplayRunning 回放进行中，单步和跳转需要先暂停
+	ErrReplayRunning = errors.New("session: replay is running, pause it first")
+	// ErrReplayNotSeekable 事件源不支持定位（流式回放只能按时间跳转，且数据源需实现SeekableEventSource）
+	ErrReplayNotSeekable = errors.New("session: event source does not support seeking")
+	// ErrReplayAtStart 已位于第一个事件，无法后退
+	ErrReplayAtStart = errors.New("session: replay is at the first event")
+)
+
+// 消息体条件的比较运算符
+const (
+	PayloadOpEqual        = "=="
+	PayloadOpNotEqual     = "!="
+	PayloadOpLess         = "<"
+	PayloadOpLessEqual    = "<="
+	PayloadOpGreater      = ">"
+	PayloadOpGreaterEqual = ">="
+	PayloadOpContains     = "contains"
+	PayloadOpExists       = "exists"
+)
+
+// PayloadCondition 消息体字段条件。Field为proto字段名，嵌套字段用点分隔（如 units.hp），
+// 重复字段中任一元素满足即可。两侧都能解析为数字时按数值比较，否则按字符串比较
+type PayloadCondition struct {
+	Field string      `json:"field"`
+	Op    string      `json:"op"` // 为空时按 == 处理
+	Value interface{} `json:"value,omitempty"`
+}
+
+// Breakpoint 回放断点，设置的条件需同时满足
+type Breakpoint struct {
+	ID         int                `json:"id"`
+	EventTypes []EventType        `json:"event_types,omitempty"`
+	Opcodes    []uint16           `json:"opcodes,omitempty"`
+	OnError    bool               `json:"on_error,omitempty"` // 错误事件或带错误信息的事件
+	Payload    []PayloadCondition `json:"payload,omitempty"`
+	// Predicate 自定义条件，payload为解码后的消息体（未配对帧且没有解码结果时为nil）
+	Predicate func(event *SessionEvent, payload map[string]interface{}) bool `json:"-"`
+	HitCount  int                                                            `json:"hit_count"`
+}
+
+// BreakpointHit 断点命中记录
+type BreakpointHit struct {
+	Breakpoint Breakpoint             `json:"breakpoint"`
+	Index      int                    `json:"index"`
+	Event      *SessionEvent          `json:"event"`
+	Payload    map[string]interface{} `json:"payload,omitempty"`
+	Time       time.Time              `json:"time"`
+}
+
+// ReplayState 回放调试状态快照
+type ReplayState struct {
+	Playing        bool           `json:"playing"`
+	Paused         bool           `json:"paused"`
+	Position       int            `json:"position"`     // 下一个待回放事件的位置
+	TotalEvents    int            `json:"total_events"` // 流式回放时为-1
+	CurrentTime    time.Time      `json:"current_time"`
+	Next           *SessionEvent  `json:"next,omitempty"`
+	LastBreakpoint *BreakpointHit `json:"last_breakpoint,omitempty"`
+	Stats          ReplayStats    `json:"stats"`
+}
+
+// breakpointMarshaler 断点解码输出零值字段，条件可以匹配 hp == 0 之类的值
+var breakpointMarshaler = protojson.MarshalOptions{UseProtoNames: true, EmitUnpopulated: true}
+
+// StepForward 回放游标处的下一个事件：执行回调但不等待延迟，也不触发断点。
+// 被过滤的事件计入跳过数。没有更多事件时返回io.EOF
+func (r *SessionReplayer) StepForward() (*ReplayEvent, error) {
+	if err := r.requireIdle(); err != nil {
+		return nil, err
+	}
+	r.cursorMu.Lock()
+	defer r.cursorMu.Unlock()
+
+	for {
+		event, index, err := r.nextEvent()
+		if err != nil {
+			return nil, err
+		}
+		if !r.shouldReplayEvent(event) {
+			r.countEvent(true)
+			continue
+		}
+		r.countEvent(false)
+		replayEvent := r.replayEvent(event, index)
+
+		r.mu.Lock()
+		r.skipIndex = r.position
+		r.mu.Unlock()
+		return replayEvent, nil
+	}
+}
+
+// StepBack 将游标后退一个事件并返回该事件，不执行回调。只支持内存会话
+func (r *SessionReplayer) StepBack() (*SessionEvent, error) {
+	if err := r.requireIdle(); err != nil {
+		return nil, err
+	}
+	if r.source != nil {
+		return nil, ErrReplayNotSeekable
+	}
+	r.cursorMu.Lock()
+	defer r.cursorMu.Unlock()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.buildIndexLocked()
+	for r.position > 0 {
+		r.position--
+		event := r.events[r.position]
+		if r.shouldReplayEvent(event) {
+			r.skipIndex = r.position
+			r.resetClockLocked()
+			return event, nil
+		}
+	}
+	return nil, ErrReplayAtStart
+}
+
+// SeekToIndex 将游标移动到回放顺序中的第index个事件，index等于事件总数表示末尾。只支持内存会话
+func (r *SessionReplayer) SeekToIndex(index int) error {
+	if err := r.requireIdle(); err != nil {
+		return err
+	}
+	if r.source != nil {
+		return ErrReplayNotSeekable
+	}
+	r.cursorMu.Lock()
+	defer r.cursorMu.Unlock()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.buildIndexLocked()
+	if index < 0 || index > len(r.events) {
+		return fmt.Errorf("seek index %d out of range [0, %d]", index, len(r.events))
+	}
+	r.position = index
+	r.skipIndex = index
+	r.resetClockLocked()
+	return nil
+}
+
+// EventRange 按回放顺序返回从from开始的最多count个事件。只支持内存会话
+func (r *SessionReplayer) EventRange(from, count int) ([]*SessionEvent, error) {
+	if r.source != nil {
+		return nil, ErrReplayNotSeekable
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.buildIndexLocked()
+	if from < 0 || count < 0 {
+		return nil, fmt.Errorf("invalid event range from %d count %d", from, count)
+	}
+	from = min(from, len(r.events))
+	to := min(from+count, len(r.events))
+	return slices.Clone(r.events[from:to]), nil
+}
+
+// GetState 获取回放调试状态
+func (r *SessionReplayer) GetState() *ReplayState {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	state := &ReplayState{
+		Playing:        r.isPlaying,
+		Paused:         r.isPaused,
+		Position:       r.position,
+		TotalEvents:    -1,
+		CurrentTime:    r.currentTime,
+		LastBreakpoint: r.lastHit,
+		Stats:          *r.stats,
+	}
+	if r.source == nil {
+		r.buildIndexLocked()
+		state.TotalEvents = len(r.events)
+		if r.position < len(r.events) {
+			state.Next = r.events[r.position]
+		}
+	} else {
+		state.Next = r.pending
+	}
+	return state
+}
+
+// AddBreakpoint 添加断点并返回其ID，断点至少需要一个条件
+func (r *SessionReplayer) AddBreakpoint(breakpoint *Breakpoint) (int, error) {
+	if len(breakpoint.EventTypes) == 0 && len(breakpoint.Opcodes) == 0 && !breakpoint.OnError &&
+		len(breakpoint.Payload) == 0 && breakpoint.Predicate == nil {
+		return 0, fmt.Errorf("breakpoint has no conditions")
+	}
+	for i, condition := range breakpoint.Payload {
+		if condition.Field == "" {
+			return 0, fmt.Errorf("payload[%d]: field is required", i)
+		}
+		switch condition.Op {
+		case "", PayloadOpEqual, PayloadOpNotEqual, PayloadOpLess, PayloadOpLessEqual,
+			PayloadOpGreater, PayloadOpGreaterEqual, PayloadOpContains, PayloadOpExists:
+		default:
+			return 0, fmt.Errorf("payload[%d]: unknown operator %q", i, condition.Op)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.nextBreakID++
+	stored := *breakpoint
+	stored.ID = r.nextBreakID
+	stored.HitCount = 0
+	r.breakpoints = append(r.breakpoints, &stored)
+	breakpoint.ID = stored.ID
+	return stored.ID, nil
+}
+
+// RemoveBreakpoint 删除断点，断点不存在时返回false
+func (r *SessionReplayer) RemoveBreakpoint(id int) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, breakpoint := range r.breakpoints {
+		if breakpoint.ID == id {
+			r.breakpoints = slices.Delete(r.breakpoints, i, i+1)
+			return true
+		}
+	}
+	return false
+}
+
+// ClearBreakpoints 删除所有断点
+func (r *SessionReplayer) ClearBreakpoints() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.breakpoints = nil
+}
+
+// Breakpoints 获取断点列表的副本
+func (r *SessionReplayer) Breakpoints() []Breakpoint {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	breakpoints := make([]Breakpoint, 0, len(r.breakpoints))
+	for _, breakpoint := range r.breakpoints {
+		breakpoints = append(breakpoints, *breakpoint)
+	}
+	return breakpoints
+}
+
+// OnBreakpoint 添加断点命中回调，回调在回放协程中执行，此时回放已暂停
+func (r *SessionReplayer) OnBreakpoint(handler func(hit *BreakpointHit)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.breakHandlers = append(r.breakHandlers, handler)
+}
+
+// requireIdle 单步和跳转只能在未回放或暂停时进行
+func (r *SessionReplayer) requireIdle() error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.isPlaying && !r.isPaused {
+		return ErrReplayRunning
+	}
+	return nil
+}
+
+// checkBreakpoints 检查事件是否命中断点，游标刚移动到的事件不会立即再次命中
+func (r *SessionReplayer) checkBreakpoints(event *SessionEvent, index int) *BreakpointHit {
+	r.mu.Lock()
+	skip := r.skipIndex == index
+	r.skipIndex = -1
+	breakpoints := slices.Clone(r.breakpoints)
+	r.mu.Unlock()
+
+	if skip {
+		return nil
+	}
+
+	var payload map[string]interface{}
+	decoded := false
+	for _, breakpoint := range breakpoints {
+		if !breakpoint.matchesEvent(event) {
+			continue
+		}
+		if (len(breakpoint.Payload) > 0 || breakpoint.Predicate != nil) && !decoded {
+			payload, decoded = r.eventPayload(event), true
+		}
+		if !breakpoint.matchesPayload(event, payload) {
+			continue
+		}
+		return &BreakpointHit{
+			Breakpoint: *breakpoint,
+			Index:      index,
+			Event:      event,
+			Payload:    payload,
+			Time:       time.Now(),
+		}
+	}
+	return nil
+}
+
+// pauseAtBreakpoint 命中断点后暂停回放，恢复时从命中的事件继续
+func (r *SessionReplayer) pauseAtBreakpoint(hit *BreakpointHit) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, breakpoint := range r.breakpoints {
+		if breakpoint.ID == hit.Breakpoint.ID {
+			breakpoint.HitCount++
+			hit.Breakpoint.HitCount = breakpoint.HitCount
+		}
+	}
+	r.isPaused = true
+	r.stats.PauseCount++
+	r.lastHit = hit
+	r.skipIndex = hit.Index
+}
+
+// notifyBreakpoint 执行断点命中回调
+func (r *SessionReplayer) notifyBreakpoint(hit *BreakpointHit) {
+	r.mu.RLock()
+	handlers := slices.Clone(r.breakHandlers)
+	r.mu.RUnlock()
+
+	for _, handler := range handlers {
+		handler(hit)
+	}
+}
+
+// eventPayload 获取事件的消息体：优先解码配对的帧，否则使用录制时写入元数据的解码结果
+func (r *SessionReplayer) eventPayload(event *SessionEvent) map[string]interface{} {
+	r.mu.RLock()
+	frame := r.eventFrames[event]
+	r.mu.RUnlock()
+
+	var raw []byte
+	if frame != nil {
+		if message := protocol.NewMessage(frame.Opcode); message != nil && proto.Unmarshal(frame.Body, message) == nil {
+			raw, _ = breakpointMarshaler.Marshal(message)
+		}
+	}
+	if raw == nil {
+		switch payload := event.Metadata["payload"].(type) {
+		case map[string]interface{}:
+			return payload
+		case json.RawMessage:
+			raw = payload
+		case []byte:
+			raw = payload
+		case string:
+			raw = []byte(payload)
+		}
+	}
+	if raw == nil {
+		return nil
+	}
+
+	var payload map[string]interface{}
+	if err := json.Unmarshal(raw, &payload); err != nil {
+		return nil
+	}
+	return payload
+}
+
+// matchesEvent 检查事件类型、操作码和错误条件
+func (b *Breakpoint) matchesEvent(event *SessionEvent) bool {
+	if len(b.EventTypes) > 0 && !slices.Contains(b.EventTypes, event.Type) {
+		return false
+	}
+	if len(b.Opcodes) > 0 && !slices.Contains(b.Opcodes, event.Opcode) {
+		return false
+	}
+	if b.OnError && event.Type != EventError && event.Error == "" {
+		return false
+	}
+	return true
+}
+
+// matchesPayload 检查消息体条件和自定义条件
+func (b *Breakpoint) matchesPayload(event *SessionEvent, payload map[string]interface{}) bool {
+	for _, condition := range b.Payload {
+		if !condition.Matches(payload) {
+			return false
+		}
+	}
+	return b.Predicate == nil || b.Predicate(event, payload)
+}
+
+// Matches 检查解码后的消息体是否满足条件
+func (c PayloadCondition) Matches(payload map[string]interface{}) bool {
+	values := lookupPayloadField(payload, strings.Split(c.Field, "."))
+	if c.Op == PayloadOpExists {
+		return len(values) > 0
+	}
+	for _, value := range values {
+		if comparePayloadValue(value, c.Op, c.Value) {
+			return true
+		}
+	}
+	return false
+}
+
+// lookupPayloadField 按路径取字段值，路径经过数组时展开每个元素
+func lookupPayloadField(value interface{}, path []string) []interface{} {
+	if list, ok := value.([]interface{}); ok {
+		var values []interface{}
+		for _, item := range list {
+			values = append(values, lookupPayloadField(item, path)...)
+		}
+		return values
+	}
+	if len(path) == 0 {
+		if value == nil {
+			return nil
+		}
+		return []interface{}{value}
+	}
+	object, ok := value.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	return lookupPayloadField(object[path[0]], path[1:])
+}
+
+// comparePayloadValue 比较字段值与条件值
+func comparePayloadValue(actual interface{}, op string, expected interface{}) bool {
+	if op == PayloadOpContains {
+		return strings.Contains(fmt.Sprint(actual), fmt.Sprint(expected))
+	}
+
+	a, aNumeric := payloadNumber(actual)
+	e, eNumeric := payloadNumber(expected)
+	cmp := 0
+	if aNumeric && eNumeric {
+		switch {
+		case a < e:
+			cmp = -1
+		case a > e:
+			cmp = 1
+		}
+	} else {
+		cmp = strings.Compare(fmt.Sprint(actual), fmt.Sprint(expected))
+	}
+
+	switch op {
+	case "", PayloadOpEqual:
+		return cmp == 0
+	case PayloadOpNotEqual:
+		return cmp != 0
+	case PayloadOpLess:
+		return cmp < 0
+	case PayloadOpLessEqual:
+		return cmp <= 0
+	case PayloadOpGreater:
+		return cmp > 0
+	case PayloadOpGreaterEqual:
+		return cmp >= 0
+	}
+	return false
+}
+
+// payloadNumber 将数值或数值字符串（protojson将64位整数渲染为字符串）转换为float64
+func payloadNumber(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint16:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
@@ -2,7 +2,10 @@ package session
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"sort"
 	"sync"
 	"time"
 )
@@ -39,6 +42,7 @@ type EventFilter struct {
 // ReplayEvent 回放事件
 type ReplayEvent struct {
 	OriginalEvent *SessionEvent `json:"original_event"`
+	Index         int           `json:"index"` // 事件在回放顺序中的位置
 	ReplayTime    time.Time     `json:"replay_time"`
 	Delay         time.Duration `json:"delay"`
 	Error         error         `json:"error,omitempty"`
@@ -63,9 +67,21 @@ type ReplayStats struct {
 // ReplayCallback 回放回调函数
 type ReplayCallback func(event *ReplayEvent) error
 
+// EventSource 按时间顺序逐个提供事件，结束时返回io.EOF（如SessionFileReader）
+type EventSource interface {
+	NextEvent() (*SessionEvent, error)
+}
+
+// SeekableEventSource 支持按时间定位的事件源（如SessionFileReader借助块索引定位）
+type SeekableEventSource interface {
+	EventSource
+	SeekTime(t time.Time) error
+}
+
 // SessionReplayer 会话回放器
 type SessionReplayer struct {
 	session   *Session
+	source    EventSource // 非nil时从数据源流式读取事件，而不是session.Events
 	config    *ReplayConfig
 	callbacks []ReplayCallback
 	stats     *ReplayStats
@@ -75,14 +91,30 @@ type SessionReplayer struct {
 	isPaused    bool
 	currentTime time.Time
 
-	// 同步控制
+	// 调试状态：内存会话按时间排序后建立索引，position指向下一个待回放的事件；
+	// 流式回放时position为定位后已读取的事件数
+	events        []*SessionEvent
+	eventFrames   map[*SessionEvent]*MessageFrame
+	indexed       bool
+	position      int
+	pending       *SessionEvent // 流式回放中因断点退回的事件
+	drained       bool          // 流式数据源已读到末尾
+	breakpoints   []*Breakpoint
+	nextBreakID   int
+	lastHit       *BreakpointHit
+	skipIndex     int // 恢复、单步或跳转后游标处的事件不立即再次命中断点
+	breakHandlers []func(hit *BreakpointHit)
+	cursorMu      sync.Mutex // 串行化回放协程与单步/跳转对游标和数据源的访问
+
+	// 同步控制：播放状态和控制通道受mu保护，回放协程持有启动时的ctx和stopCh副本
 	mu       sync.RWMutex
+	playMu   sync.Mutex // 串行化Play，等待上一次回放协程退出时不持有mu
 	ctx      context.Context
 	cancel   context.CancelFunc
 	pauseCh  chan struct{}
 	resumeCh chan struct{}
 	stopCh   chan struct{}
-	stopOnce sync.Once
+	stopOnce *sync.Once
 	wg       sync.WaitGroup
 }
 
@@ -106,16 +138,32 @@ func NewSessionReplayer(session *Session, config *ReplayConfig) *SessionReplayer
 		stats: &ReplayStats{
 			StartTime: time.Now(),
 		},
-		ctx:      ctx,
-		cancel:   cancel,
-		pauseCh:  make(chan struct{}),
-		resumeCh: make(chan struct{}),
-		stopCh:   make(chan struct{}),
+		ctx:       ctx,
+		cancel:    cancel,
+		pauseCh:   make(chan struct{}),
+		resumeCh:  make(chan struct{}, 1),
+		stopCh:    make(chan struct{}),
+		stopOnce:  &sync.Once{},
+		skipIndex: -1,
 	}
 
 	return replayer
 }
 
+// NewStreamingReplayer 创建从事件源流式回放的回放器，不需要把整个会话加载到内存。
+// 事件源需按时间顺序提供事件；会话文件的开始时间取自文件头，用于按偏移跳转和重新播放
+func NewStreamingReplayer(source EventSource, config *ReplayConfig) *SessionReplayer {
+	streamed := &Session{}
+	if reader, ok := source.(*SessionFileReader); ok {
+		header := reader.Header()
+		streamed.ID = header.SessionID
+		streamed.StartTime = header.StartTime
+	}
+	replayer := NewSessionReplayer(streamed, config)
+	replayer.source = source
+	return replayer
+}
+
 // AddCallback 添加回放回调
 func (r *SessionReplayer) AddCallback(callback ReplayCallback) {
 	r.mu.Lock()
@@ -125,23 +173,45 @@ func (r *SessionReplayer) AddCallback(callback ReplayCallback) {
 
 // Play 开始回放
 func (r *SessionReplayer) Play() error {
-	if r.isPlaying {
+	r.playMu.Lock()
+	defer r.playMu.Unlock()
+
+	if r.IsPlaying() {
 		return fmt.Errorf("replay is already playing")
 	}
+	// 上一次回放停止后协程可能仍在执行回调，等它退出后再重新布置控制通道，从游标处继续
+	r.wg.Wait()
+	// 游标已在末尾时从头重新播放
+	if err := r.rewindAtEnd(); err != nil {
+		return err
+	}
 
 	r.mu.Lock()
+	if r.isPlaying {
+		r.mu.Unlock()
+		return fmt.Errorf("replay is already playing")
+	}
+	select {
+	case <-r.stopCh:
+		r.cancel()
+		r.ctx, r.cancel = context.WithCancel(context.Background())
+		r.stopCh = make(chan struct{})
+		r.stopOnce = &sync.Once{}
+	default:
+	}
 	r.isPlaying = true
 	r.isPaused = false
-	r.currentTime = r.session.StartTime
+	r.resetClockLocked()
 	r.stats.StartTime = time.Now()
+	ctx, stopCh, stopOnce := r.ctx, r.stopCh, r.stopOnce
+	r.wg.Add(1)
 	r.mu.Unlock()
 
 	// 启动回放协程
-	r.wg.Add(1)
 	go func() {
 		defer r.wg.Done()
-		defer r.stopOnce.Do(func() { close(r.stopCh) })
-		r.replayLoop()
+		defer stopOnce.Do(func() { close(stopCh) })
+		r.replayLoop(ctx, stopCh)
 	}()
 
 	return nil
@@ -149,18 +219,17 @@ func (r *SessionReplayer) Play() error {
 
 // Pause 暂停回放
 func (r *SessionReplayer) Pause() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
 	if !r.isPlaying {
 		return fmt.Errorf("replay is not playing")
 	}
-
 	if r.isPaused {
 		return fmt.Errorf("replay is already paused")
 	}
-
-	r.mu.Lock()
 	r.isPaused = true
 	r.stats.PauseCount++
-	r.mu.Unlock()
 
 	// 发送暂停信号
 	select {
@@ -173,17 +242,16 @@ func (r *SessionReplayer) Pause() error {
 
 // Resume 恢复回放
 func (r *SessionReplayer) Resume() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
 	if !r.isPlaying {
 		return fmt.Errorf("replay is not playing")
 	}
-
 	if !r.isPaused {
 		return fmt.Errorf("replay is not paused")
 	}
-
-	r.mu.Lock()
 	r.isPaused = false
-	r.mu.Unlock()
 
 	// 发送恢复信号
 	select {
@@ -206,10 +274,11 @@ func (r *SessionReplayer) Stop() error {
 	r.isPaused = false
 	r.stats.EndTime = time.Now()
 	r.stats.Duration = r.stats.EndTime.Sub(r.stats.StartTime)
+	stopCh, stopOnce, cancel := r.stopCh, r.stopOnce, r.cancel
 	r.mu.Unlock()
 
-	r.stopOnce.Do(func() { close(r.stopCh) })
-	r.cancel()
+	stopOnce.Do(func() { close(stopCh) })
+	cancel()
 	return nil
 }
 
@@ -238,8 +307,8 @@ func (r *SessionReplayer) GetStats() *ReplayStats {
 	return &stats
 }
 
-// replayLoop 回放主循环
-func (r *SessionReplayer) replayLoop() {
+// replayLoop 回放主循环，从游标处开始
+func (r *SessionReplayer) replayLoop(ctx context.Context, stopCh <-chan struct{}) {
 	defer func() {
 		r.mu.Lock()
 		r.isPlaying = false
@@ -248,76 +317,60 @@ func (r *SessionReplayer) replayLoop() {
 		r.mu.Unlock()
 	}()
 
-	// 按时间顺序排序事件
-	events := r.sortEventsByTime()
-
-	for _, event := range events {
+	for {
 		select {
-		case <-r.ctx.Done():
+		case <-ctx.Done():
 			return
 		default:
 		}
 
-		// 检查是否需要暂停
-		r.mu.RLock()
-		paused := r.isPaused
-		r.mu.RUnlock()
+		// 暂停时等待恢复，暂停期间的单步和跳转会移动游标
+		if !r.waitWhilePaused(ctx, stopCh) {
+			return
+		}
 
-		if paused {
-			select {
-			case <-r.resumeCh:
+		r.cursorMu.Lock()
+		event, index, err := r.nextEvent()
+		if err != nil {
+			r.cursorMu.Unlock()
+			if !errors.Is(err, io.EOF) {
 				r.mu.Lock()
-				r.isPaused = false
+				r.stats.ErrorEvents++
 				r.mu.Unlock()
-			case <-r.ctx.Done():
-				return
-			case <-r.stopCh:
-				return
 			}
+			return
 		}
 
 		// 应用事件过滤器
 		if !r.shouldReplayEvent(event) {
-			r.mu.Lock()
-			r.stats.SkippedEvents++
-			r.mu.Unlock()
+			r.countEvent(true)
+			r.cursorMu.Unlock()
 			continue
 		}
 
-		// 计算回放延迟
-		delay := r.calculateReplayDelay(event)
-
-		// 创建回放事件
-		replayEvent := &ReplayEvent{
-			OriginalEvent: event,
-			ReplayTime:    time.Now(),
-			Delay:         delay,
+		// 命中断点时退回事件并暂停，恢复后从该事件继续
+		if hit := r.checkBreakpoints(event, index); hit != nil {
+			r.unreadEvent(event)
+			r.pauseAtBreakpoint(hit)
+			r.cursorMu.Unlock()
+			r.notifyBreakpoint(hit)
+			continue
 		}
 
-		// 执行回调
-		if err := r.executeCallbacks(replayEvent); err != nil {
-			replayEvent.Error = err
-			r.stats.ErrorEvents++
-
-			if r.config.PauseOnError {
-				r.Pause()
-			}
-		} else {
-			r.mu.Lock()
-			r.stats.ReplayedEvents++
-			r.mu.Unlock()
+		r.countEvent(false)
+		replayEvent := r.replayEvent(event, index)
+		r.cursorMu.Unlock()
+		if replayEvent.Error != nil && r.config.PauseOnError {
+			r.Pause()
 		}
 
-		// 更新统计
-		r.updateReplayStats(replayEvent)
-
 		// 等待延迟时间
 		if r.config.Speed > 0 {
-			waitTime := time.Duration(float64(delay) / float64(r.config.Speed))
+			waitTime := time.Duration(float64(replayEvent.Delay) / float64(r.config.Speed))
 			if waitTime > 0 {
 				select {
 				case <-time.After(waitTime):
-				case <-r.ctx.Done():
+				case <-ctx.Done():
 					return
 				}
 			}
@@ -325,21 +378,153 @@ func (r *SessionReplayer) replayLoop() {
 	}
 }
 
-// sortEventsByTime 按时间排序事件
-func (r *SessionReplayer) sortEventsByTime() []*SessionEvent {
-	events := make([]*SessionEvent, len(r.session.Events))
-	copy(events, r.session.Events)
+// waitWhilePaused 暂停时阻塞直到恢复，回放被停止时返回false
+func (r *SessionReplayer) waitWhilePaused(ctx context.Context, stopCh <-chan struct{}) bool {
+	for r.IsPaused() {
+		select {
+		case <-r.resumeCh:
+		case <-ctx.Done():
+			return false
+		case <-stopCh:
+			return false
+		}
+	}
+	return true
+}
+
+// replayEvent 回放单个事件：计算延迟、执行回调并更新统计
+func (r *SessionReplayer) replayEvent(event *SessionEvent, index int) *ReplayEvent {
+	replayEvent := &ReplayEvent{
+		OriginalEvent: event,
+		Index:         index,
+		ReplayTime:    time.Now(),
+		Delay:         r.calculateReplayDelay(event),
+	}
+
+	// 执行回调
+	if err := r.executeCallbacks(replayEvent); err != nil {
+		replayEvent.Error = err
+		r.mu.Lock()
+		r.stats.ErrorEvents++
+		r.mu.Unlock()
+	} else {
+		r.mu.Lock()
+		r.stats.ReplayedEvents++
+		r.mu.Unlock()
+	}
 
-	// 按时间戳排序
-	for i := 0; i < len(events)-1; i++ {
-		for j := i + 1; j < len(events); j++ {
-			if events[i].Timestamp.After(events[j].Timestamp) {
-				events[i], events[j] = events[j], events[i]
+	// 更新统计
+	r.updateReplayStats(replayEvent)
+	return replayEvent
+}
+
+// countEvent 统计读取的事件
+func (r *SessionReplayer) countEvent(skipped bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stats.TotalEvents++
+	if skipped {
+		r.stats.SkippedEvents++
+	}
+}
+
+// nextEvent 取出游标处的事件并前移游标，没有更多事件时返回io.EOF
+func (r *SessionReplayer) nextEvent() (*SessionEvent, int, error) {
+	if r.source == nil {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.buildIndexLocked()
+		if r.position >= len(r.events) {
+			return nil, r.position, io.EOF
+		}
+		r.position++
+		return r.events[r.position-1], r.position - 1, nil
+	}
+
+	// 数据源只在回放协程或暂停后的单步中读取，读取时不持有锁
+	r.mu.Lock()
+	event, index := r.pending, r.position
+	r.pending = nil
+	r.mu.Unlock()
+
+	if event == nil {
+		var err error
+		if event, err = r.source.NextEvent(); err != nil {
+			if errors.Is(err, io.EOF) {
+				r.mu.Lock()
+				r.drained = true
+				r.mu.Unlock()
 			}
+			return nil, index, err
 		}
 	}
 
-	return events
+	r.mu.Lock()
+	r.position++
+	r.mu.Unlock()
+	return event, index, nil
+}
+
+// rewindAtEnd 游标位于末尾时回到第一个事件；流式数据源需支持定位且已知会话开始时间，否则保持原位
+func (r *SessionReplayer) rewindAtEnd() error {
+	r.mu.Lock()
+	var atEnd bool
+	if r.source == nil {
+		r.buildIndexLocked()
+		atEnd = len(r.events) > 0 && r.position >= len(r.events)
+	} else {
+		atEnd = r.drained
+	}
+	start := r.session.StartTime
+	r.mu.Unlock()
+	if !atEnd {
+		return nil
+	}
+
+	if r.source == nil {
+		return r.SeekToIndex(0)
+	}
+	if _, ok := r.source.(SeekableEventSource); !ok || start.IsZero() {
+		return nil
+	}
+	return r.SeekTo(start)
+}
+
+// unreadEvent 退回刚取出的事件，下次nextEvent重新返回它
+func (r *SessionReplayer) unreadEvent(event *SessionEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.position--
+	if r.source != nil {
+		r.pending = event
+	}
+}
+
+// buildIndexLocked 首次使用时按时间稳定排序事件，并将消息事件与帧配对以便断点解码消息体
+func (r *SessionReplayer) buildIndexLocked() {
+	if r.indexed {
+		return
+	}
+	r.indexed = true
+
+	r.events = make([]*SessionEvent, 0, len(r.session.Events))
+	for _, event := range r.session.Events {
+		if event != nil {
+			r.events = append(r.events, event)
+		}
+	}
+	sort.SliceStable(r.events, func(i, j int) bool {
+		return r.events[i].Timestamp.Before(r.events[j].Timestamp)
+	})
+	r.eventFrames = pairMessageFrames(r.session)
+}
+
+// resetClockLocked 将回放时钟设为游标前一个事件的时间，避免跳转后的第一个事件产生长延迟
+func (r *SessionReplayer) resetClockLocked() {
+	r.currentTime = r.session.StartTime
+	if r.source == nil && r.position > 0 && r.position <= len(r.events) {
+		r.currentTime = r.events[r.position-1].Timestamp
+	}
 }
 
 // shouldReplayEvent 检查是否应该回放事件
@@ -366,6 +551,9 @@ func (r *SessionReplayer) shouldReplayEvent(event *SessionEvent) bool {
 
 // calculateReplayDelay 计算回放延迟
 func (r *SessionReplayer) calculateReplayDelay(event *SessionEvent) time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
 	if r.currentTime.IsZero() {
 		r.currentTime = event.Timestamp
 		return 0
@@ -433,15 +621,40 @@ func (r *SessionReplayer) GetCurrentTime() time.Time {
 	return r.currentTime
 }
 
-// SeekTo 跳转到指定时间
+// SeekTo 跳转到时间不早于targetTime的第一个事件。内存会话在排序后的索引上二分查找，
+// 流式回放要求数据源支持按时间定位。只能在停止或暂停时跳转
 func (r *SessionReplayer) SeekTo(targetTime time.Time) error {
-	if r.isPlaying {
-		return fmt.Errorf("cannot seek while playing")
+	if err := r.requireIdle(); err != nil {
+		return err
 	}
+	r.cursorMu.Lock()
+	defer r.cursorMu.Unlock()
 
-	r.mu.Lock()
-	r.currentTime = targetTime
-	r.mu.Unlock()
+	if r.source != nil {
+		seekable, ok := r.source.(SeekableEventSource)
+		if !ok {
+			return ErrReplayNotSeekable
+		}
+		if err := seekable.SeekTime(targetTime); err != nil {
+			return err
+		}
+		r.mu.Lock()
+		r.pending = nil
+		r.drained = false
+		r.position = 0
+		r.skipIndex = 0
+		r.currentTime = targetTime
+		r.mu.Unlock()
+		return nil
+	}
 
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.buildIndexLocked()
+	r.position = sort.Search(len(r.events), func(i int) bool {
+		return !r.events[i].Timestamp.Before(targetTime)
+	})
+	r.skipIndex = r.position
+	r.resetClockLocked()
 	return nil
 }
@@ -6,10 +6,11 @@ import (
 
 // Session 完整的会话记录
 type Session struct {
-	ID        string          `json:"id"`
-	StartTime time.Time       `json:"start_time"`
-	EndTime   time.Time       `json:"end_time"`
-	Events    []*SessionEvent `json:"events"`
-	Frames    []*MessageFrame `json:"frames"`
-	Stats     *SessionStats   `json:"stats"`
+	SchemaVersion int             `json:"schema_version"`
+	ID            string          `json:"id"`
+	StartTime     time.Time       `json:"start_time"`
+	EndTime       time.Time       `json:"end_time"`
+	Events        []*SessionEvent `json:"events"`
+	Frames        []*MessageFrame `json:"frames"`
+	Stats         *SessionStats   `json:"stats"`
 }
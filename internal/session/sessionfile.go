@@ -0,0 +1,691 @@
+package session
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// 会话文件格式（追加写入，小端序）：
+//
+//	文件头   magic(8) | 元数据长度(u32) | 元数据JSON
+//	块       类型(u8) | 编码(u8) | 载荷长度(u32) | 原始长度(u32) | CRC32(u32) | 载荷
+//
+// 块按写入顺序排列：若干数据块之后跟一个索引块，收尾时依次写出最后的索引块、统计块和固定长度的尾块。
+// 数据块内是长度前缀的记录：类型(u8) | 长度(uvarint) | 内容。事件记录为JSON，帧记录为紧凑二进制，
+// 避免JSON导出时对RawData和Body做base64。每个块都带CRC，进程崩溃时最多丢失最后一个未刷出的数据块，
+// 读取端遇到截断或损坏的块即停止，之前的内容仍可读。
+
+// sessionFileMagic 文件头魔数
+var sessionFileMagic = [8]byte{'S', 'L', 'G', 'S', 'E', 'S', 'S', 1}
+
+// SessionFileVersion 当前文件格式版本。版本2的帧记录增加了frameFlagDecoded
+const SessionFileVersion = 2
+
+// 块类型
+const (
+	blockChunk   byte = 1 // 数据块：一批记录
+	blockIndex   byte = 2 // 索引块：自上一个索引块以来的数据块位置
+	blockStats   byte = 3 // 统计块：SessionStats的JSON
+	blockTrailer byte = 4 // 尾块：最后一个索引块和统计块的偏移，只在正常关闭时写出
+)
+
+// 记录类型
+const (
+	recordEvent byte = 1
+	recordFrame byte = 2
+)
+
+// 帧记录标志位
+const (
+	frameFlagReceive    byte = 1 << 0 // 方向为receive
+	frameFlagBodySuffix byte = 1 << 1 // Body是RawData的后缀，只记录长度
+	frameFlagDecoded    byte = 1 << 2 // Body之后跟MessageType和Payload，版本2起
+)
+
+// frameFlagsForVersion 文件格式版本支持的帧记录标志位
+func frameFlagsForVersion(version int) byte {
+	if version < 2 {
+		return frameFlagReceive | frameFlagBodySuffix
+	}
+	return frameFlagReceive | frameFlagBodySuffix | frameFlagDecoded
+}
+
+const (
+	blockHeaderSize   = 14
+	trailerPayloadLen = 16
+	trailerBlockSize  = blockHeaderSize + trailerPayloadLen
+
+	maxBlockSize  = 64 << 20 // 块载荷和解压后长度的上限，读取时超过即视为损坏
+	maxHeaderSize = 1 << 20  // 文件头元数据长度上限
+)
+
+// Compression 数据块压缩方式
+type Compression byte
+
+const (
+	CompressionNone    Compression = 0
+	CompressionDeflate Compression = 1
+)
+
+func (c Compression) String() string {
+	switch c {
+	case CompressionNone:
+		return "none"
+	case CompressionDeflate:
+		return "deflate"
+	default:
+		return fmt.Sprintf("compression_%d", byte(c))
+	}
+}
+
+// ErrSessionFileCorrupt 会话文件头或块损坏
+var ErrSessionFileCorrupt = errors.New("session file corrupt")
+
+// SessionFileHeader 会话文件头中的元数据
+type SessionFileHeader struct {
+	Version     int         `json:"version"`
+	SessionID   string      `json:"session_id"`
+	StartTime   time.Time   `json:"start_time"`
+	CreatedAt   time.Time   `json:"created_at"`
+	Compression Compression `json:"compression"`
+}
+
+// ChunkIndexEntry 数据块索引项
+type ChunkIndexEntry struct {
+	Offset      int64     `json:"offset"`       // 块在文件中的偏移
+	FirstTime   time.Time `json:"first_time"`   // 块内最早记录的时间
+	LastTime    time.Time `json:"last_time"`    // 块内最晚记录的时间
+	FirstRecord uint64    `json:"first_record"` // 块内第一条记录的全局序号
+	Records     int       `json:"records"`
+}
+
+// SessionFileOptions 会话文件写入选项
+type SessionFileOptions struct {
+	ChunkSize     int           // 数据块未压缩的目标字节数，默认64KB
+	Compression   Compression   // 数据块压缩方式
+	IndexInterval int           // 每多少个数据块写一个索引块，默认16
+	FlushInterval time.Duration // 数据块最长缓冲时间，到期由定时器刷出，0表示只按ChunkSize刷出
+	SyncOnFlush   bool          // 每次刷出数据块后fsync（底层为*os.File时）
+}
+
+// DefaultSessionFileOptions 返回默认写入选项
+func DefaultSessionFileOptions() *SessionFileOptions {
+	return &SessionFileOptions{
+		ChunkSize:     64 * 1024,
+		Compression:   CompressionDeflate,
+		IndexInterval: 16,
+		FlushInterval: time.Second,
+	}
+}
+
+// SessionFileWriter 追加写入的分块会话文件
+type SessionFileWriter struct {
+	w       io.Writer
+	closer  io.Closer
+	syncer  interface{ Sync() error }
+	options SessionFileOptions
+	header  SessionFileHeader
+
+	offset int64
+
+	// 当前数据块
+	chunk        bytes.Buffer
+	chunkFirst   time.Time
+	chunkLast    time.Time
+	chunkRecords int
+	chunkStarted time.Time
+	flushTimer   *time.Timer // 按FlushInterval刷出空闲数据块，没有新记录写入时也能落盘
+
+	records   uint64            // 已写入的记录总数
+	pending   []ChunkIndexEntry // 尚未写入索引块的数据块
+	lastIndex int64             // 最后一个索引块的偏移，-1表示没有
+	stats     *SessionStats
+	deflater  *flate.Writer
+	compBuf   bytes.Buffer
+
+	err    error // 写入失败后的粘滞错误
+	closed bool
+	mu     sync.Mutex
+}
+
+// CreateSessionFile 创建会话文件
+func CreateSessionFile(path, sessionID string, startTime time.Time, options *SessionFileOptions) (*SessionFileWriter, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("create session file: %w", err)
+	}
+
+	writer, err := NewSessionFileWriter(file, sessionID, startTime, options)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	writer.closer = file
+	writer.syncer = file
+	return writer, nil
+}
+
+// NewSessionFileWriter 在w上创建会话文件写入器并写出文件头
+func NewSessionFileWriter(w io.Writer, sessionID string, startTime time.Time, options *SessionFileOptions) (*SessionFileWriter, error) {
+	opts := *DefaultSessionFileOptions()
+	if options != nil {
+		opts = *options
+		if opts.ChunkSize <= 0 {
+			opts.ChunkSize = 64 * 1024
+		}
+		if opts.IndexInterval <= 0 {
+			opts.IndexInterval = 16
+		}
+	}
+
+	writer := &SessionFileWriter{
+		w:       w,
+		options: opts,
+		header: SessionFileHeader{
+			Version:     SessionFileVersion,
+			SessionID:   sessionID,
+			StartTime:   startTime,
+			CreatedAt:   time.Now(),
+			Compression: opts.Compression,
+		},
+		lastIndex: -1,
+	}
+
+	meta, err := json.Marshal(writer.header)
+	if err != nil {
+		return nil, fmt.Errorf("marshal session file header: %w", err)
+	}
+	buf := make([]byte, 0, len(sessionFileMagic)+4+len(meta))
+	buf = append(buf, sessionFileMagic[:]...)
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(meta)))
+	buf = append(buf, meta...)
+	if err := writer.write(buf); err != nil {
+		return nil, err
+	}
+
+	return writer, nil
+}
+
+// Header 获取文件头
+func (w *SessionFileWriter) Header() SessionFileHeader {
+	return w.header
+}
+
+// WriteEvent 追加一个事件
+func (w *SessionFileWriter) WriteEvent(event *SessionEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("marshal event %s: %w", event.ID, err)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.appendRecord(recordEvent, data, event.Timestamp)
+}
+
+// WriteFrame 追加一个消息帧
+func (w *SessionFileWriter) WriteFrame(frame *MessageFrame) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.appendRecord(recordFrame, encodeFrameRecord(frame), frame.Timestamp)
+}
+
+// WriteSession 按时间顺序写入整个会话的事件和帧，并写出统计
+func (w *SessionFileWriter) WriteSession(session *Session) error {
+	events, frames := session.Events, session.Frames
+	for len(events) > 0 || len(frames) > 0 {
+		var err error
+		if len(frames) == 0 || (len(events) > 0 && !events[0].Timestamp.After(frames[0].Timestamp)) {
+			err = w.WriteEvent(events[0])
+			events = events[1:]
+		} else {
+			err = w.WriteFrame(frames[0])
+			frames = frames[1:]
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if session.Stats != nil {
+		w.SetStats(session.Stats)
+	}
+	return nil
+}
+
+// SetStats 设置关闭时写出的会话统计
+func (w *SessionFileWriter) SetStats(stats *SessionStats) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.stats = stats
+}
+
+// Flush 刷出当前数据块
+func (w *SessionFileWriter) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.flushChunk()
+}
+
+// Records 已写入的记录数
+func (w *SessionFileWriter) Records() uint64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.records
+}
+
+// Size 已写入文件的字节数（不含未刷出的数据块）
+func (w *SessionFileWriter) Size() int64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.offset
+}
+
+// Close 刷出剩余数据，写出索引块、统计块和尾块，并关闭底层文件
+func (w *SessionFileWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return w.err
+	}
+	w.closed = true
+	if w.flushTimer != nil {
+		w.flushTimer.Stop()
+	}
+
+	err := w.finish()
+	if w.closer != nil {
+		if closeErr := w.closer.Close(); err == nil && closeErr != nil {
+			err = fmt.Errorf("close session file: %w", closeErr)
+		}
+	}
+	return err
+}
+
+// finish 写出收尾的块
+func (w *SessionFileWriter) finish() error {
+	if err := w.flushChunk(); err != nil {
+		return err
+	}
+	if err := w.writeIndex(); err != nil {
+		return err
+	}
+
+	statsOffset := int64(-1)
+	if w.stats != nil {
+		data, err := json.Marshal(w.stats)
+		if err != nil {
+			return fmt.Errorf("marshal session stats: %w", err)
+		}
+		statsOffset = w.offset
+		if err := w.writeBlock(blockStats, CompressionNone, data, len(data)); err != nil {
+			return err
+		}
+	}
+
+	trailer := make([]byte, 0, trailerPayloadLen)
+	trailer = binary.LittleEndian.AppendUint64(trailer, uint64(w.lastIndex))
+	trailer = binary.LittleEndian.AppendUint64(trailer, uint64(statsOffset))
+	if err := w.writeBlock(blockTrailer, CompressionNone, trailer, len(trailer)); err != nil {
+		return err
+	}
+	return w.sync()
+}
+
+// appendRecord 追加记录到当前数据块，达到大小或时间阈值时刷出
+func (w *SessionFileWriter) appendRecord(kind byte, data []byte, timestamp time.Time) error {
+	if w.closed {
+		return errors.New("session file writer is closed")
+	}
+	if w.err != nil {
+		return w.err
+	}
+	if len(data) > maxBlockSize/2 {
+		return fmt.Errorf("session file record too large: %d bytes", len(data))
+	}
+	// 未压缩的数据块控制在上限的一半以内，压缩膨胀后也不会超过读取端接受的上限
+	if w.chunkRecords > 0 && w.chunk.Len()+len(data) > maxBlockSize/2 {
+		if err := w.flushChunk(); err != nil {
+			return err
+		}
+	}
+
+	if w.chunkRecords == 0 {
+		w.chunkFirst = timestamp
+		w.chunkLast = timestamp
+		w.chunkStarted = time.Now()
+		w.armFlushTimer()
+	}
+	if timestamp.Before(w.chunkFirst) {
+		w.chunkFirst = timestamp
+	}
+	if timestamp.After(w.chunkLast) {
+		w.chunkLast = timestamp
+	}
+
+	w.chunk.WriteByte(kind)
+	w.chunk.Write(binary.AppendUvarint(nil, uint64(len(data))))
+	w.chunk.Write(data)
+	w.chunkRecords++
+	w.records++
+
+	if w.chunk.Len() >= w.options.ChunkSize ||
+		(w.options.FlushInterval > 0 && time.Since(w.chunkStarted) >= w.options.FlushInterval) {
+		return w.flushChunk()
+	}
+	return nil
+}
+
+// armFlushTimer 新数据块开始时启动刷出定时器
+func (w *SessionFileWriter) armFlushTimer() {
+	if w.options.FlushInterval <= 0 {
+		return
+	}
+	if w.flushTimer == nil {
+		w.flushTimer = time.AfterFunc(w.options.FlushInterval, w.flushExpired)
+		return
+	}
+	w.flushTimer.Reset(w.options.FlushInterval)
+}
+
+// flushExpired 定时器到期时刷出缓冲超时的数据块，失败记为粘滞错误由下次写入返回
+func (w *SessionFileWriter) flushExpired() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	// 定时器触发时数据块可能已被刷出并开始了新块，按开始时间重新判断
+	if w.closed || w.chunkRecords == 0 || time.Since(w.chunkStarted) < w.options.FlushInterval {
+		return
+	}
+	if err := w.flushChunk(); err != nil {
+		log.Printf("Flush session file chunk failed: %v", err)
+	}
+}
+
+// flushChunk 写出当前数据块，必要时写出索引块
+func (w *SessionFileWriter) flushChunk() error {
+	if w.err != nil {
+		return w.err
+	}
+	if w.chunkRecords == 0 {
+		return nil
+	}
+
+	raw := w.chunk.Bytes()
+	payload := raw
+	if w.options.Compression == CompressionDeflate {
+		compressed, err := w.deflate(raw)
+		if err != nil {
+			return w.fail(err)
+		}
+		payload = compressed
+	}
+
+	entry := ChunkIndexEntry{
+		Offset:      w.offset,
+		FirstTime:   w.chunkFirst,
+		LastTime:    w.chunkLast,
+		FirstRecord: w.records - uint64(w.chunkRecords),
+		Records:     w.chunkRecords,
+	}
+	if err := w.writeBlock(blockChunk, w.options.Compression, payload, len(raw)); err != nil {
+		return err
+	}
+
+	w.pending = append(w.pending, entry)
+	w.chunk.Reset()
+	w.chunkRecords = 0
+
+	if len(w.pending) >= w.options.IndexInterval {
+		if err := w.writeIndex(); err != nil {
+			return err
+		}
+	}
+
+	if w.options.SyncOnFlush {
+		return w.sync()
+	}
+	return nil
+}
+
+// writeIndex 写出自上一个索引块以来的数据块索引，索引块之间按偏移反向链接
+func (w *SessionFileWriter) writeIndex() error {
+	if len(w.pending) == 0 {
+		return nil
+	}
+
+	data := binary.AppendVarint(nil, w.lastIndex)
+	data = binary.AppendUvarint(data, uint64(len(w.pending)))
+	for _, entry := range w.pending {
+		data = binary.AppendUvarint(data, uint64(entry.Offset))
+		data = binary.AppendVarint(data, entry.FirstTime.UnixNano())
+		data = binary.AppendVarint(data, entry.LastTime.Sub(entry.FirstTime).Nanoseconds())
+		data = binary.AppendUvarint(data, entry.FirstRecord)
+		data = binary.AppendUvarint(data, uint64(entry.Records))
+	}
+
+	offset := w.offset
+	if err := w.writeBlock(blockIndex, CompressionNone, data, len(data)); err != nil {
+		return err
+	}
+	w.lastIndex = offset
+	w.pending = w.pending[:0]
+	return nil
+}
+
+// writeBlock 写出一个带CRC的块
+func (w *SessionFileWriter) writeBlock(kind byte, compression Compression, payload []byte, rawLen int) error {
+	buf := make([]byte, 0, blockHeaderSize+len(payload))
+	buf = append(buf, kind, byte(compression))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(payload)))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(rawLen))
+	buf = binary.LittleEndian.AppendUint32(buf, crc32.ChecksumIEEE(payload))
+	buf = append(buf, payload...)
+	return w.write(buf)
+}
+
+// write 写出字节并推进偏移，失败后后续写入都返回同一错误
+func (w *SessionFileWriter) write(buf []byte) error {
+	if w.err != nil {
+		return w.err
+	}
+	n, err := w.w.Write(buf)
+	w.offset += int64(n)
+	if err != nil {
+		return w.fail(fmt.Errorf("write session file: %w", err))
+	}
+	return nil
+}
+
+// deflate 压缩数据块
+func (w *SessionFileWriter) deflate(raw []byte) ([]byte, error) {
+	w.compBuf.Reset()
+	if w.deflater == nil {
+		deflater, err := flate.NewWriter(&w.compBuf, flate.BestSpeed)
+		if err != nil {
+			return nil, err
+		}
+		w.deflater = deflater
+	} else {
+		w.deflater.Reset(&w.compBuf)
+	}
+
+	if _, err := w.deflater.Write(raw); err != nil {
+		return nil, fmt.Errorf("compress chunk: %w", err)
+	}
+	if err := w.deflater.Close(); err != nil {
+		return nil, fmt.Errorf("compress chunk: %w", err)
+	}
+	return w.compBuf.Bytes(), nil
+}
+
+// sync 将底层文件刷盘
+func (w *SessionFileWriter) sync() error {
+	if w.syncer == nil {
+		return nil
+	}
+	if err := w.syncer.Sync(); err != nil {
+		return w.fail(fmt.Errorf("sync session file: %w", err))
+	}
+	return nil
+}
+
+// fail 记录粘滞错误
+func (w *SessionFileWriter) fail(err error) error {
+	if w.err == nil {
+		w.err = err
+	}
+	return w.err
+}
+
+// encodeFrameRecord 编码帧记录
+func encodeFrameRecord(frame *MessageFrame) []byte {
+	var flags byte
+	if frame.Direction == "receive" {
+		flags |= frameFlagReceive
+	}
+	bodySuffix := len(frame.Body) > 0 && bytes.HasSuffix(frame.RawData, frame.Body)
+	if bodySuffix {
+		flags |= frameFlagBodySuffix
+	}
+	decoded := frame.MessageType != "" || len(frame.Payload) > 0
+	if decoded {
+		flags |= frameFlagDecoded
+	}
+
+	data := make([]byte, 0, len(frame.RawData)+len(frame.Body)+len(frame.MessageType)+len(frame.Payload)+32)
+	data = binary.AppendVarint(data, frame.Timestamp.UnixNano())
+	data = append(data, flags)
+	data = binary.AppendUvarint(data, uint64(frame.Opcode))
+	data = binary.AppendUvarint(data, frame.SequenceNum)
+	data = binary.AppendUvarint(data, uint64(len(frame.RawData)))
+	data = append(data, frame.RawData...)
+	data = binary.AppendUvarint(data, uint64(len(frame.Body)))
+	if !bodySuffix {
+		data = append(data, frame.Body...)
+	}
+	if decoded {
+		data = binary.AppendUvarint(data, uint64(len(frame.MessageType)))
+		data = append(data, frame.MessageType...)
+		data = binary.AppendUvarint(data, uint64(len(frame.Payload)))
+		data = append(data, frame.Payload...)
+	}
+	return data
+}
+
+// decodeFrameRecord 解码帧记录，known为文件版本支持的标志位，出现其他标志位时拒绝解码
+func decodeFrameRecord(data []byte, known byte) (*MessageFrame, error) {
+	r := &byteReader{data: data}
+
+	timestamp := r.varint()
+	flags := r.byte()
+	opcode := r.uvarint()
+	sequence := r.uvarint()
+	raw := r.bytes(r.uvarint())
+	bodyLen := r.uvarint()
+	if r.err != nil {
+		return nil, r.err
+	}
+	if unknown := flags &^ known; unknown != 0 {
+		return nil, fmt.Errorf("%w: unknown frame flags %#x", ErrSessionFileCorrupt, unknown)
+	}
+
+	frame := &MessageFrame{
+		RawData:     raw,
+		Opcode:      uint16(opcode),
+		Timestamp:   time.Unix(0, timestamp),
+		Direction:   "send",
+		SequenceNum: sequence,
+	}
+	if flags&frameFlagReceive != 0 {
+		frame.Direction = "receive"
+	}
+
+	if flags&frameFlagBodySuffix != 0 {
+		if bodyLen > uint64(len(raw)) {
+			return nil, fmt.Errorf("%w: frame body longer than raw data", ErrSessionFileCorrupt)
+		}
+		frame.Body = raw[len(raw)-int(bodyLen):]
+	} else {
+		frame.Body = r.bytes(bodyLen)
+	}
+	if flags&frameFlagDecoded != 0 {
+		frame.MessageType = string(r.bytes(r.uvarint()))
+		if payload := r.bytes(r.uvarint()); len(payload) > 0 {
+			frame.Payload = payload
+		}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return frame, nil
+}
+
+// byteReader 顺序解码变长整数和字节串
+type byteReader struct {
+	data []byte
+	err  error
+}
+
+func (r *byteReader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(r.data)
+	if n <= 0 {
+		r.err = fmt.Errorf("%w: bad uvarint", ErrSessionFileCorrupt)
+		return 0
+	}
+	r.data = r.data[n:]
+	return v
+}
+
+func (r *byteReader) varint() int64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(r.data)
+	if n <= 0 {
+		r.err = fmt.Errorf("%w: bad varint", ErrSessionFileCorrupt)
+		return 0
+	}
+	r.data = r.data[n:]
+	return v
+}
+
+func (r *byteReader) byte() byte {
+	if r.err != nil {
+		return 0
+	}
+	if len(r.data) == 0 {
+		r.err = fmt.Errorf("%w: unexpected end of record", ErrSessionFileCorrupt)
+		return 0
+	}
+	b := r.data[0]
+	r.data = r.data[1:]
+	return b
+}
+
+func (r *byteReader) bytes(n uint64) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n > uint64(len(r.data)) {
+		r.err = fmt.Errorf("%w: unexpected end of record", ErrSessionFileCorrupt)
+		return nil
+	}
+	b := r.data[:n:n]
+	r.data = r.data[n:]
+	return b
+}
@@ -0,0 +1,549 @@
+package session
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"sort"
+	"time"
+)
+
+// FileRecord 会话文件中的一条记录，Event和Frame只有一个非nil
+type FileRecord struct {
+	Index uint64 // 全局记录序号
+	Event *SessionEvent
+	Frame *MessageFrame
+}
+
+// Timestamp 记录时间
+func (r *FileRecord) Timestamp() time.Time {
+	if r.Event != nil {
+		return r.Event.Timestamp
+	}
+	return r.Frame.Timestamp
+}
+
+// FileReadOptions 读取会话时的过滤条件
+type FileReadOptions struct {
+	From          time.Time // 零值表示从头开始
+	To            time.Time // 零值表示读到结尾
+	IncludeFrames bool      // 是否读取消息帧，只分析事件时关闭可大幅减少内存
+}
+
+// SessionFileReader 流式读取会话文件，只在内存中保留当前数据块
+type SessionFileReader struct {
+	r      io.ReadSeeker
+	closer io.Closer
+	header SessionFileHeader
+
+	dataStart int64 // 第一个块的偏移
+	pos       int64 // 下一个块的偏移
+
+	// 当前数据块中尚未返回的记录
+	chunk      []byte
+	nextRecord uint64
+	skipBefore time.Time
+
+	index     []ChunkIndexEntry
+	trailer   *fileTrailer
+	truncated bool
+}
+
+// fileTrailer 尾块内容
+type fileTrailer struct {
+	lastIndex   int64
+	statsOffset int64
+}
+
+// OpenSessionFile 打开会话文件
+func OpenSessionFile(path string) (*SessionFileReader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open session file: %w", err)
+	}
+
+	reader, err := NewSessionFileReader(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	reader.closer = file
+	return reader, nil
+}
+
+// NewSessionFileReader 在r上创建会话文件读取器并解析文件头
+func NewSessionFileReader(r io.ReadSeeker) (*SessionFileReader, error) {
+	prefix := make([]byte, len(sessionFileMagic)+4)
+	if _, err := io.ReadFull(r, prefix); err != nil {
+		return nil, fmt.Errorf("%w: read header: %v", ErrSessionFileCorrupt, err)
+	}
+	if !bytes.Equal(prefix[:len(sessionFileMagic)], sessionFileMagic[:]) {
+		return nil, fmt.Errorf("%w: bad magic", ErrSessionFileCorrupt)
+	}
+
+	metaLen := binary.LittleEndian.Uint32(prefix[len(sessionFileMagic):])
+	if metaLen > maxHeaderSize {
+		return nil, fmt.Errorf("%w: header metadata too large", ErrSessionFileCorrupt)
+	}
+	meta := make([]byte, metaLen)
+	if _, err := io.ReadFull(r, meta); err != nil {
+		return nil, fmt.Errorf("%w: read header metadata: %v", ErrSessionFileCorrupt, err)
+	}
+
+	reader := &SessionFileReader{r: r}
+	if err := json.Unmarshal(meta, &reader.header); err != nil {
+		return nil, fmt.Errorf("%w: parse header metadata: %v", ErrSessionFileCorrupt, err)
+	}
+	if reader.header.Version > SessionFileVersion {
+		return nil, fmt.Errorf("unsupported session file version %d", reader.header.Version)
+	}
+
+	reader.dataStart = int64(len(prefix) + len(meta))
+	reader.pos = reader.dataStart
+	reader.trailer = reader.readTrailer()
+	return reader, nil
+}
+
+// Header 获取文件头
+func (r *SessionFileReader) Header() SessionFileHeader {
+	return r.header
+}
+
+// Complete 文件是否正常关闭（带尾块），为false时可能是录制进程崩溃留下的文件
+func (r *SessionFileReader) Complete() bool {
+	return r.trailer != nil
+}
+
+// Truncated 读取过程中是否遇到截断或损坏的块（之前的记录仍然有效）
+func (r *SessionFileReader) Truncated() bool {
+	return r.truncated
+}
+
+// Close 关闭底层文件
+func (r *SessionFileReader) Close() error {
+	if r.closer != nil {
+		return r.closer.Close()
+	}
+	return nil
+}
+
+// Next 读取下一条记录，读完时返回io.EOF
+func (r *SessionFileReader) Next() (*FileRecord, error) {
+	for {
+		if len(r.chunk) == 0 {
+			if err := r.loadNextChunk(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		record, err := r.decodeRecord()
+		if err != nil {
+			// 数据块CRC正确但记录无法解析，视为损坏，停止读取
+			r.truncated = true
+			r.chunk = nil
+			return nil, err
+		}
+		if !r.skipBefore.IsZero() {
+			if record.Timestamp().Before(r.skipBefore) {
+				continue
+			}
+			r.skipBefore = time.Time{}
+		}
+		return record, nil
+	}
+}
+
+// NextEvent 读取下一个事件，跳过消息帧，读完时返回io.EOF（实现EventSource）
+func (r *SessionFileReader) NextEvent() (*SessionEvent, error) {
+	for {
+		record, err := r.Next()
+		if err != nil {
+			return nil, err
+		}
+		if record.Event != nil {
+			return record.Event, nil
+		}
+	}
+}
+
+// Rewind 回到第一条记录
+func (r *SessionFileReader) Rewind() {
+	r.pos = r.dataStart
+	r.chunk = nil
+	r.nextRecord = 0
+	r.skipBefore = time.Time{}
+}
+
+// SeekTime 定位到时间不早于t的第一条记录，借助索引只读取目标数据块
+func (r *SessionFileReader) SeekTime(t time.Time) error {
+	index, err := r.Index()
+	if err != nil {
+		return err
+	}
+
+	i := sort.Search(len(index), func(i int) bool {
+		return !index[i].LastTime.Before(t)
+	})
+	if i == len(index) {
+		// 所有记录都早于t：定位到结尾
+		r.pos = r.endOfData(index)
+		r.chunk = nil
+		return nil
+	}
+
+	r.pos = index[i].Offset
+	r.chunk = nil
+	r.nextRecord = index[i].FirstRecord
+	r.skipBefore = t
+	return nil
+}
+
+// Index 获取所有数据块的索引。正常关闭的文件沿索引块链读取，
+// 崩溃留下的文件退化为扫描所有块
+func (r *SessionFileReader) Index() ([]ChunkIndexEntry, error) {
+	if r.index != nil {
+		return r.index, nil
+	}
+
+	var index []ChunkIndexEntry
+	var err error
+	if r.trailer != nil && r.trailer.lastIndex >= 0 {
+		index, err = r.readIndexChain(r.trailer.lastIndex)
+	} else {
+		index, err = r.scanIndex()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(index, func(i, j int) bool { return index[i].Offset < index[j].Offset })
+	r.index = index
+	return index, nil
+}
+
+// Stats 读取正常关闭时写出的会话统计，没有时返回nil
+func (r *SessionFileReader) Stats() (*SessionStats, error) {
+	if r.trailer == nil || r.trailer.statsOffset < 0 {
+		return nil, nil
+	}
+
+	block, err := r.readBlockAt(r.trailer.statsOffset)
+	if err != nil {
+		return nil, err
+	}
+	if block.kind != blockStats {
+		return nil, fmt.Errorf("%w: expected stats block at %d", ErrSessionFileCorrupt, r.trailer.statsOffset)
+	}
+
+	stats := &SessionStats{}
+	if err := json.Unmarshal(block.payload, stats); err != nil {
+		return nil, fmt.Errorf("%w: parse stats: %v", ErrSessionFileCorrupt, err)
+	}
+	return stats, nil
+}
+
+// ReadSession 按过滤条件将记录读入内存中的Session，供TimelineAnalyzer等分析一个时间窗口
+func (r *SessionFileReader) ReadSession(options *FileReadOptions) (*Session, error) {
+	if options == nil {
+		options = &FileReadOptions{IncludeFrames: true}
+	}
+
+	if options.From.IsZero() {
+		r.Rewind()
+	} else if err := r.SeekTime(options.From); err != nil {
+		return nil, err
+	}
+
+	session := &Session{
+		SchemaVersion: CurrentSchemaVersion,
+		ID:            r.header.SessionID,
+		StartTime:     r.header.StartTime,
+		Events:        make([]*SessionEvent, 0),
+		Frames:        make([]*MessageFrame, 0),
+	}
+
+	for {
+		record, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return session, err
+		}
+		if !options.To.IsZero() && record.Timestamp().After(options.To) {
+			break
+		}
+
+		if record.Event != nil {
+			session.Events = append(session.Events, record.Event)
+		} else if options.IncludeFrames {
+			session.Frames = append(session.Frames, record.Frame)
+		}
+		if t := record.Timestamp(); t.After(session.EndTime) {
+			session.EndTime = t
+		}
+	}
+
+	stats, err := r.Stats()
+	if err != nil {
+		return session, err
+	}
+	session.Stats = stats
+	return session, nil
+}
+
+// loadNextChunk 读取下一个数据块，跳过索引和统计块
+func (r *SessionFileReader) loadNextChunk() error {
+	for {
+		block, err := r.readBlockAt(r.pos)
+		if errors.Is(err, io.EOF) {
+			return io.EOF
+		}
+		if err != nil {
+			// 截断或损坏的块：崩溃时正在写出的最后一个块，之前的记录仍然有效
+			r.truncated = true
+			return io.EOF
+		}
+
+		r.pos += block.size
+		switch block.kind {
+		case blockChunk:
+			r.chunk = block.payload
+			return nil
+		case blockTrailer:
+			return io.EOF
+		}
+	}
+}
+
+// decodeRecord 从当前数据块中解码一条记录
+func (r *SessionFileReader) decodeRecord() (*FileRecord, error) {
+	br := &byteReader{data: r.chunk}
+	kind := br.byte()
+	data := br.bytes(br.uvarint())
+	if br.err != nil {
+		return nil, br.err
+	}
+	r.chunk = br.data
+
+	record := &FileRecord{Index: r.nextRecord}
+	r.nextRecord++
+
+	switch kind {
+	case recordEvent:
+		event := &SessionEvent{}
+		if err := json.Unmarshal(data, event); err != nil {
+			return nil, fmt.Errorf("%w: parse event: %v", ErrSessionFileCorrupt, err)
+		}
+		restoreMetadataTypes(event)
+		record.Event = event
+	case recordFrame:
+		frame, err := decodeFrameRecord(data, frameFlagsForVersion(r.header.Version))
+		if err != nil {
+			return nil, err
+		}
+		record.Frame = frame
+	default:
+		return nil, fmt.Errorf("%w: unknown record type %d", ErrSessionFileCorrupt, kind)
+	}
+	return record, nil
+}
+
+// fileBlock 读取并校验后的块
+type fileBlock struct {
+	kind    byte
+	payload []byte // 解压后的载荷
+	size    int64  // 块在文件中占用的字节数
+}
+
+// readBlockAt 读取并校验offset处的块；offset处没有数据时返回io.EOF
+func (r *SessionFileReader) readBlockAt(offset int64) (*fileBlock, error) {
+	if _, err := r.r.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, blockHeaderSize)
+	n, err := io.ReadFull(r.r, header)
+	if n == 0 && (err == io.EOF || err == io.ErrUnexpectedEOF) {
+		return nil, io.EOF
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: short block header at %d", ErrSessionFileCorrupt, offset)
+	}
+
+	kind := header[0]
+	compression := Compression(header[1])
+	payloadLen := binary.LittleEndian.Uint32(header[2:])
+	rawLen := binary.LittleEndian.Uint32(header[6:])
+	checksum := binary.LittleEndian.Uint32(header[10:])
+
+	// 长度来自未经校验的块头，分配内存前先检查上限和文件剩余长度
+	if payloadLen > maxBlockSize || rawLen > maxBlockSize {
+		return nil, fmt.Errorf("%w: block too large at %d", ErrSessionFileCorrupt, offset)
+	}
+	end, err := r.size()
+	if err != nil {
+		return nil, err
+	}
+	if offset+blockHeaderSize+int64(payloadLen) > end {
+		return nil, fmt.Errorf("%w: short block at %d", ErrSessionFileCorrupt, offset)
+	}
+
+	payload := make([]byte, payloadLen)
+	if _, err := r.r.Seek(offset+blockHeaderSize, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(r.r, payload); err != nil {
+		return nil, fmt.Errorf("%w: short block at %d", ErrSessionFileCorrupt, offset)
+	}
+	if crc32.ChecksumIEEE(payload) != checksum {
+		return nil, fmt.Errorf("%w: checksum mismatch at %d", ErrSessionFileCorrupt, offset)
+	}
+
+	block := &fileBlock{kind: kind, payload: payload, size: blockHeaderSize + int64(payloadLen)}
+	switch compression {
+	case CompressionNone:
+	case CompressionDeflate:
+		raw := make([]byte, rawLen)
+		inflater := flate.NewReader(bytes.NewReader(payload))
+		defer inflater.Close()
+		if _, err := io.ReadFull(inflater, raw); err != nil {
+			return nil, fmt.Errorf("%w: decompress block at %d: %v", ErrSessionFileCorrupt, offset, err)
+		}
+		block.payload = raw
+	default:
+		return nil, fmt.Errorf("%w: unknown compression %d at %d", ErrSessionFileCorrupt, compression, offset)
+	}
+	return block, nil
+}
+
+// size 当前文件长度；边写边读时文件会继续增长，因此每次重新获取
+func (r *SessionFileReader) size() (int64, error) {
+	return r.r.Seek(0, io.SeekEnd)
+}
+
+// readTrailer 读取文件末尾的尾块，不存在或损坏时返回nil
+func (r *SessionFileReader) readTrailer() *fileTrailer {
+	end, err := r.r.Seek(0, io.SeekEnd)
+	if err != nil || end-trailerBlockSize < r.dataStart {
+		return nil
+	}
+
+	block, err := r.readBlockAt(end - trailerBlockSize)
+	if err != nil || block.kind != blockTrailer || len(block.payload) != trailerPayloadLen {
+		return nil
+	}
+	return &fileTrailer{
+		lastIndex:   int64(binary.LittleEndian.Uint64(block.payload)),
+		statsOffset: int64(binary.LittleEndian.Uint64(block.payload[8:])),
+	}
+}
+
+// readIndexChain 从最后一个索引块开始沿反向链接读取所有索引项
+func (r *SessionFileReader) readIndexChain(offset int64) ([]ChunkIndexEntry, error) {
+	var index []ChunkIndexEntry
+	for offset >= 0 {
+		block, err := r.readBlockAt(offset)
+		if err != nil {
+			return nil, err
+		}
+		if block.kind != blockIndex {
+			return nil, fmt.Errorf("%w: expected index block at %d", ErrSessionFileCorrupt, offset)
+		}
+
+		br := &byteReader{data: block.payload}
+		prev := br.varint()
+		count := br.uvarint()
+		for i := uint64(0); i < count && br.err == nil; i++ {
+			entry := ChunkIndexEntry{Offset: int64(br.uvarint())}
+			first := br.varint()
+			span := br.varint()
+			entry.FirstTime = time.Unix(0, first)
+			entry.LastTime = time.Unix(0, first+span)
+			entry.FirstRecord = br.uvarint()
+			entry.Records = int(br.uvarint())
+			index = append(index, entry)
+		}
+		if br.err != nil {
+			return nil, br.err
+		}
+		offset = prev
+	}
+	return index, nil
+}
+
+// scanIndex 扫描所有数据块重建索引，用于没有尾块的文件
+func (r *SessionFileReader) scanIndex() ([]ChunkIndexEntry, error) {
+	saved := *r
+	defer func() {
+		truncated := r.truncated
+		*r = saved
+		r.truncated = r.truncated || truncated
+	}()
+
+	r.Rewind()
+	index := make([]ChunkIndexEntry, 0)
+	for {
+		offset := r.pos
+		if err := r.loadNextChunk(); err != nil {
+			break
+		}
+
+		entry := ChunkIndexEntry{Offset: offset, FirstRecord: r.nextRecord}
+		for len(r.chunk) > 0 {
+			record, err := r.decodeRecord()
+			if err != nil {
+				r.truncated = true
+				break
+			}
+			t := record.Timestamp()
+			if entry.Records == 0 || t.Before(entry.FirstTime) {
+				entry.FirstTime = t
+			}
+			if entry.Records == 0 || t.After(entry.LastTime) {
+				entry.LastTime = t
+			}
+			entry.Records++
+		}
+		if entry.Records > 0 {
+			index = append(index, entry)
+		}
+	}
+	return index, nil
+}
+
+// endOfData 最后一个数据块之后的偏移
+func (r *SessionFileReader) endOfData(index []ChunkIndexEntry) int64 {
+	if len(index) == 0 {
+		return r.dataStart
+	}
+	last := index[len(index)-1].Offset
+	block, err := r.readBlockAt(last)
+	if err != nil {
+		return last
+	}
+	return last + block.size
+}
+
+// restoreMetadataTypes 恢复经JSON往返后变为float64的常用元数据类型
+func restoreMetadataTypes(event *SessionEvent) {
+	for key, value := range event.Metadata {
+		number, ok := value.(float64)
+		if !ok {
+			continue
+		}
+		switch key {
+		case "opcode":
+			event.Metadata[key] = uint16(number)
+		case "sequence_num":
+			event.Metadata[key] = uint64(number)
+		}
+	}
+}
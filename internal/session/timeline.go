@@ -12,6 +12,7 @@ type TimelineEvent struct {
 	EventType     EventType              `json:"event_type"`
 	Opcode        uint16                 `json:"opcode,omitempty"`
 	MessageID     string                 `json:"message_id,omitempty"`
+	MessageType   string                 `json:"message_type,omitempty"` // 启用消息体解码时的消息类型，消息体在Metadata["payload"]
 	Direction     string                 `json:"direction,omitempty"`
 	Duration      time.Duration          `json:"duration,omitempty"`
 	Metadata      map[string]interface{} `json:"metadata,omitempty"`
@@ -22,6 +23,7 @@ type TimelineEvent struct {
 type MessageFlow struct {
 	MessageID     string        `json:"message_id"`
 	Opcode        uint16        `json:"opcode"`
+	MessageType   string        `json:"message_type,omitempty"`
 	SendTime      time.Time     `json:"send_time"`
 	ReceiveTime   time.Time     `json:"receive_time,omitempty"`
 	Latency       time.Duration `json:"latency,omitempty"`
@@ -72,12 +74,13 @@ func (a *TimelineAnalyzer) AnalyzeTimeline() []*TimelineEvent {
 	// 转换为时间线事件
 	for _, event := range events {
 		timelineEvent := &TimelineEvent{
-			Timestamp: event.Timestamp,
-			EventType: event.Type,
-			Opcode:    event.Opcode,
-			MessageID: event.ID,
-			Duration:  event.Duration,
-			Metadata:  event.Metadata,
+			Timestamp:   event.Timestamp,
+			EventType:   event.Type,
+			Opcode:      event.Opcode,
+			MessageID:   event.ID,
+			MessageType: eventMessageType(event),
+			Duration:    event.Duration,
+			Metadata:    event.Metadata,
 		}
 
 		// 设置方向
@@ -115,6 +118,7 @@ func (a *TimelineAnalyzer) AnalyzeMessageFlows() []*MessageFlow {
 				flow = &MessageFlow{
 					MessageID:     messageID,
 					Opcode:        event.Opcode,
+					MessageType:   eventMessageType(event),
 					RelatedEvents: []string{event.ID},
 				}
 				flowMap[messageID] = flow
@@ -404,6 +408,14 @@ func (a *TimelineAnalyzer) extractMessageID(event *SessionEvent) string {
 	return event.ID
 }
 
+// eventMessageType 消息事件中记录的解码消息类型
+func eventMessageType(event *SessionEvent) string {
+	if messageType, ok := event.Metadata["message_type"].(string); ok {
+		return messageType
+	}
+	return ""
+}
+
 // calculateJitter 计算抖动（相邻延迟变化）
 func (a *TimelineAnalyzer) calculateJitter(latencies []time.Duration, avgLatency time.Duration) time.Duration {
 	if len(latencies) < 2 {
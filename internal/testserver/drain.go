@@ -0,0 +1,136 @@
+package testserver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// CloseServiceRestart 排空时使用的关闭码（1012 service restart），客户端应重连到其他节点
+const CloseServiceRestart = websocket.CloseServiceRestart
+
+// PlayerHandoff 单个玩家交接给其他节点的状态
+type PlayerHandoff struct {
+	PlayerID string   `json:"player_id"`
+	Rooms    []string `json:"rooms,omitempty"`
+}
+
+// HandoffState 节点排空时交接的状态
+type HandoffState struct {
+	NodeID    string          `json:"node_id"`
+	Sequence  uint64          `json:"sequence"` // 最后推送的序列号，接收节点从此之后继续编号，避免客户端按序列号去重时丢弃推送
+	Players   []PlayerHandoff `json:"players"`
+	DrainedAt time.Time       `json:"drained_at"`
+}
+
+// Drain 排空节点：停止接受新连接和推送，快照玩家状态并交给handoff回调，
+// 然后以1012关闭所有连接并等待连接全部退出。回调在关闭连接之前执行，
+// 保证客户端重连到新节点时交接状态已经就位。
+func (s *Server) Drain(ctx context.Context, handoff func(*HandoffState)) (*HandoffState, error) {
+	s.drainMu.Lock()
+	if !s.draining.CompareAndSwap(false, true) {
+		s.drainMu.Unlock()
+		return nil, fmt.Errorf("server is already draining")
+	}
+	s.drainMu.Unlock()
+
+	log.Printf("Draining node %s...", s.config.NodeID)
+
+	state := &HandoffState{
+		NodeID:    s.config.NodeID,
+		Sequence:  s.seqGenerator.Load(),
+		DrainedAt: time.Now(),
+	}
+	s.players.Range(func(key, value interface{}) bool {
+		state.Players = append(state.Players, PlayerHandoff{
+			PlayerID: key.(string),
+			Rooms:    s.rooms.RoomsOf(value.(*Connection)),
+		})
+		return true
+	})
+
+	if handoff != nil {
+		handoff(state)
+	}
+
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		// 每轮都重新关闭，覆盖排空开始时正在升级的连接
+		s.connections.Range(func(key, value interface{}) bool {
+			s.closeConnectionWithCode(value.(*Connection), CloseServiceRestart, "server draining")
+			return true
+		})
+		if s.connCount.Load() == 0 {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return state, fmt.Errorf("drain node %s: %w", s.config.NodeID, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+
+	log.Printf("Node %s drained, handed off %d players at seq %d", s.config.NodeID, len(state.Players), state.Sequence)
+	return state, nil
+}
+
+// IsDraining 是否正在排空或已排空
+func (s *Server) IsDraining() bool {
+	return s.draining.Load()
+}
+
+// ApplyHandoff 接收其他节点交接的状态：推送序列号不回退，玩家登录时恢复其房间订阅
+func (s *Server) ApplyHandoff(state *HandoffState) {
+	for {
+		current := s.seqGenerator.Load()
+		if current >= state.Sequence || s.seqGenerator.CompareAndSwap(current, state.Sequence) {
+			break
+		}
+	}
+
+	s.handoffsMu.Lock()
+	for _, player := range state.Players {
+		s.handoffs[player.PlayerID] = player
+	}
+	s.handoffsMu.Unlock()
+}
+
+// resumeHandoff 玩家登录时恢复交接的状态
+func (s *Server) resumeHandoff(conn *Connection, playerID string) {
+	s.handoffsMu.Lock()
+	player, ok := s.handoffs[playerID]
+	delete(s.handoffs, playerID)
+	s.handoffsMu.Unlock()
+	if !ok {
+		return
+	}
+
+	for _, roomID := range player.Rooms {
+		if err := s.rooms.Join(roomID, conn); err != nil {
+			log.Printf("Restore room %s for %s failed: %v", roomID, playerID, err)
+		}
+	}
+	log.Printf("Resumed handoff for %s: %d rooms", playerID, len(player.Rooms))
+}
+
+// handleDrainControl 处理/control?action=drain，返回交接状态
+func (s *Server) handleDrainControl(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	state, err := s.Drain(ctx, nil)
+	if err != nil && state == nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(state)
+}
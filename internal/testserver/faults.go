@@ -0,0 +1,554 @@
+package testserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"GoSlgBenchmarkTest/internal/protocol"
+	"GoSlgBenchmarkTest/internal/session"
+)
+
+// FaultType 故障类型
+type FaultType string
+
+const (
+	FaultLatency   FaultType = "latency"   // 增加延迟/抖动
+	FaultDrop      FaultType = "drop"      // 丢弃帧
+	FaultDuplicate FaultType = "duplicate" // 重复发送帧
+	FaultReorder   FaultType = "reorder"   // 与下一帧交换顺序
+	FaultCorrupt   FaultType = "corrupt"   // 破坏消息体
+	FaultTruncate  FaultType = "truncate"  // 截断帧
+	FaultHalfOpen  FaultType = "half_open" // 半开连接：停止读写但不关闭
+	FaultClose     FaultType = "close"     // 以指定关闭码关闭连接
+)
+
+// FaultRule 故障注入规则，作用于服务端下行帧
+//
+// ConnID、PlayerID、Opcodes 为空表示不限制；多个条件同时设置时需全部满足。
+// 时间字段均相对于规则添加时刻，使用毫秒以便通过JSON控制。
+type FaultRule struct {
+	ID          string    `json:"id,omitempty"`
+	Type        FaultType `json:"type"`
+	ConnID      string    `json:"conn_id,omitempty"`
+	PlayerID    string    `json:"player_id,omitempty"`
+	Opcodes     []uint16  `json:"opcodes,omitempty"`
+	Probability float64   `json:"probability,omitempty"` // 触发概率，<=0 视为1
+	LatencyMs   int       `json:"latency_ms,omitempty"`  // FaultLatency: 固定延迟
+	JitterMs    int       `json:"jitter_ms,omitempty"`   // FaultLatency: 随机抖动上限
+	CloseCode   int       `json:"close_code,omitempty"`  // FaultClose: 关闭码，默认1011
+
+	StartAfterMs int `json:"start_after_ms,omitempty"` // 添加后多久开始生效
+	DurationMs   int `json:"duration_ms,omitempty"`    // 生效时长，0表示一直生效
+	MaxCount     int `json:"max_count,omitempty"`      // 最多触发次数，0表示不限
+
+	AddedAt time.Time `json:"added_at"`
+	Hits    int       `json:"hits"`
+}
+
+// Validate 校验规则
+func (r *FaultRule) Validate() error {
+	switch r.Type {
+	case FaultLatency:
+		if r.LatencyMs <= 0 && r.JitterMs <= 0 {
+			return fmt.Errorf("latency fault requires latency_ms or jitter_ms")
+		}
+	case FaultDrop, FaultDuplicate, FaultReorder, FaultCorrupt, FaultTruncate, FaultHalfOpen:
+	case FaultClose:
+		if r.CloseCode != 0 && (r.CloseCode < 1000 || r.CloseCode > 4999) {
+			return fmt.Errorf("invalid close code: %d", r.CloseCode)
+		}
+	default:
+		return fmt.Errorf("unknown fault type: %q", r.Type)
+	}
+
+	if r.Probability < 0 || r.Probability > 1 {
+		return fmt.Errorf("probability must be within [0, 1], got %v", r.Probability)
+	}
+	return nil
+}
+
+// active 判断规则在指定时间是否生效
+func (r *FaultRule) active(now time.Time) bool {
+	start := r.AddedAt.Add(time.Duration(r.StartAfterMs) * time.Millisecond)
+	if now.Before(start) {
+		return false
+	}
+	if r.DurationMs > 0 && !now.Before(start.Add(time.Duration(r.DurationMs)*time.Millisecond)) {
+		return false
+	}
+	return r.MaxCount == 0 || r.Hits < r.MaxCount
+}
+
+// matches 判断规则是否匹配指定的连接/玩家/操作码
+func (r *FaultRule) matches(connID, playerID string, opcode uint16) bool {
+	if r.ConnID != "" && r.ConnID != connID {
+		return false
+	}
+	if r.PlayerID != "" && r.PlayerID != playerID {
+		return false
+	}
+	if len(r.Opcodes) == 0 {
+		return true
+	}
+	for _, op := range r.Opcodes {
+		if op == opcode {
+			return true
+		}
+	}
+	return false
+}
+
+// FaultEvent 一次故障注入记录
+type FaultEvent struct {
+	Time     time.Time `json:"time"`
+	RuleID   string    `json:"rule_id"`
+	Type     FaultType `json:"type"`
+	ConnID   string    `json:"conn_id"`
+	PlayerID string    `json:"player_id,omitempty"`
+	Opcode   uint16    `json:"opcode,omitempty"`
+	Detail   string    `json:"detail,omitempty"`
+}
+
+// FaultEngine 基于规则的故障注入引擎
+type FaultEngine struct {
+	rules       []*FaultRule
+	events      []FaultEvent
+	maxEvents   int
+	ruleCounter uint64
+	ruleCount   atomic.Int32 // 用于无规则时的快速路径
+	injected    atomic.Uint64
+	rng         *rand.Rand
+	mu          sync.Mutex
+}
+
+// NewFaultEngine 创建故障注入引擎，seed为0时使用当前时间
+func NewFaultEngine(seed int64) *FaultEngine {
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return &FaultEngine{
+		maxEvents: 10000,
+		rng:       rand.New(rand.NewSource(seed)),
+	}
+}
+
+// AddRule 添加规则并返回规则ID
+func (e *FaultEngine) AddRule(rule FaultRule) (string, error) {
+	ids, err := e.AddRules([]FaultRule{rule})
+	if err != nil {
+		return "", err
+	}
+	return ids[0], nil
+}
+
+// AddRules 原子地添加一组规则：任一规则非法或ID重复时一条都不添加
+func (e *FaultEngine) AddRules(rules []FaultRule) ([]string, error) {
+	for i := range rules {
+		if err := rules[i].Validate(); err != nil {
+			if len(rules) > 1 {
+				return nil, fmt.Errorf("rule %d: %w", i, err)
+			}
+			return nil, err
+		}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	taken := make(map[string]bool, len(e.rules)+len(rules))
+	for _, existing := range e.rules {
+		taken[existing.ID] = true
+	}
+
+	counter := e.ruleCounter
+	added := make([]*FaultRule, 0, len(rules))
+	ids := make([]string, 0, len(rules))
+	now := time.Now()
+	for _, rule := range rules {
+		counter++
+		if rule.ID == "" {
+			rule.ID = fmt.Sprintf("fault_%d", counter)
+		}
+		if taken[rule.ID] {
+			return nil, fmt.Errorf("fault rule %s already exists", rule.ID)
+		}
+		taken[rule.ID] = true
+		rule.AddedAt = now
+		rule.Hits = 0
+		added = append(added, &rule)
+		ids = append(ids, rule.ID)
+	}
+
+	e.ruleCounter = counter
+	e.rules = append(e.rules, added...)
+	e.ruleCount.Store(int32(len(e.rules)))
+	return ids, nil
+}
+
+// RemoveRule 删除规则
+func (e *FaultEngine) RemoveRule(id string) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for i, rule := range e.rules {
+		if rule.ID == id {
+			e.rules = append(e.rules[:i], e.rules[i+1:]...)
+			e.ruleCount.Store(int32(len(e.rules)))
+			return true
+		}
+	}
+	return false
+}
+
+// ClearRules 删除所有规则
+func (e *FaultEngine) ClearRules() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.rules = nil
+	e.ruleCount.Store(0)
+}
+
+// Rules 获取当前规则快照
+func (e *FaultEngine) Rules() []FaultRule {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	rules := make([]FaultRule, len(e.rules))
+	for i, rule := range e.rules {
+		rules[i] = *rule
+	}
+	return rules
+}
+
+// Events 获取故障注入日志
+func (e *FaultEngine) Events() []FaultEvent {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	events := make([]FaultEvent, len(e.events))
+	copy(events, e.events)
+	return events
+}
+
+// InjectedCount 获取已注入的故障次数
+func (e *FaultEngine) InjectedCount() uint64 {
+	return e.injected.Load()
+}
+
+// ExportToRecorder 将故障日志写入会话录制器，playerID非空时只导出该玩家的故障
+func (e *FaultEngine) ExportToRecorder(recorder *session.SessionRecorder, playerID string) int {
+	exported := 0
+	for _, event := range e.Events() {
+		if playerID != "" && event.PlayerID != playerID {
+			continue
+		}
+		recorder.RecordFault(string(event.Type), map[string]interface{}{
+			"timestamp": event.Time,
+			"rule_id":   event.RuleID,
+			"conn_id":   event.ConnID,
+			"player_id": event.PlayerID,
+			"opcode":    event.Opcode,
+			"detail":    event.Detail,
+		})
+		exported++
+	}
+	return exported
+}
+
+// match 返回对该帧生效的规则（命中计数在此处累加）
+func (e *FaultEngine) match(connID, playerID string, opcode uint16) []FaultRule {
+	if e.ruleCount.Load() == 0 {
+		return nil
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	now := time.Now()
+	var hits []FaultRule
+	for _, rule := range e.rules {
+		if !rule.active(now) || !rule.matches(connID, playerID, opcode) {
+			continue
+		}
+		if rule.Probability > 0 && rule.Probability < 1 && e.rng.Float64() >= rule.Probability {
+			continue
+		}
+		rule.Hits++
+		hits = append(hits, *rule)
+	}
+	return hits
+}
+
+// jitter 生成[0, max)的随机抖动
+func (e *FaultEngine) jitter(maxMs int) time.Duration {
+	if maxMs <= 0 {
+		return 0
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return time.Duration(e.rng.Intn(maxMs)) * time.Millisecond
+}
+
+// record 记录一次故障注入
+func (e *FaultEngine) record(rule FaultRule, connID, playerID string, opcode uint16, detail string) {
+	event := FaultEvent{
+		Time:     time.Now(),
+		RuleID:   rule.ID,
+		Type:     rule.Type,
+		ConnID:   connID,
+		PlayerID: playerID,
+		Opcode:   opcode,
+		Detail:   detail,
+	}
+
+	e.injected.Add(1)
+
+	e.mu.Lock()
+	e.events = append(e.events, event)
+	if len(e.events) > e.maxEvents {
+		e.events = e.events[len(e.events)-e.maxEvents:]
+	}
+	e.mu.Unlock()
+
+	log.Printf("💥 Fault injected: rule=%s type=%s conn=%s player=%s opcode=%d %s",
+		rule.ID, rule.Type, connID, playerID, opcode, detail)
+}
+
+// deliverFrame 经过故障注入引擎后发送帧
+func (s *Server) deliverFrame(conn *Connection, opcode uint16, frame []byte, timeout time.Duration) error {
+	// 半开连接：静默丢弃所有下行数据
+	if conn.halfOpen.Load() {
+		return nil
+	}
+
+	conn.mu.RLock()
+	playerID := conn.PlayerID
+	conn.mu.RUnlock()
+
+	hits := s.faults.match(conn.ID, playerID, opcode)
+	if len(hits) == 0 {
+		return s.sendFrames(conn, opcode, timeout, frame)
+	}
+
+	var delay time.Duration
+	copies := 1
+	for _, rule := range hits {
+		switch rule.Type {
+		case FaultDrop:
+			s.recordFault(conn, rule, playerID, opcode, "")
+			return nil
+
+		case FaultHalfOpen:
+			conn.halfOpen.Store(true)
+			s.recordFault(conn, rule, playerID, opcode, "")
+			return nil
+
+		case FaultClose:
+			code := rule.CloseCode
+			if code == 0 {
+				code = websocket.CloseInternalServerErr
+			}
+			s.recordFault(conn, rule, playerID, opcode, fmt.Sprintf("close_code=%d", code))
+			s.closeConnectionWithCode(conn, code, "Fault injected")
+			return nil
+
+		case FaultCorrupt:
+			frame = corruptFrame(frame)
+			s.recordFault(conn, rule, playerID, opcode, "")
+
+		case FaultTruncate:
+			frame = frame[:len(frame)/2]
+			s.recordFault(conn, rule, playerID, opcode, fmt.Sprintf("length=%d", len(frame)))
+
+		case FaultDuplicate:
+			copies++
+			s.recordFault(conn, rule, playerID, opcode, "")
+
+		case FaultLatency:
+			added := time.Duration(rule.LatencyMs)*time.Millisecond + s.faults.jitter(rule.JitterMs)
+			delay += added
+			s.recordFault(conn, rule, playerID, opcode, fmt.Sprintf("delay=%v", added))
+
+		case FaultReorder:
+			if s.holdFrame(conn, frame) {
+				s.recordFault(conn, rule, playerID, opcode, "held")
+				return nil
+			}
+			// 已有暂存帧时本帧照常发出，越过暂存帧同样构成乱序
+			s.recordFault(conn, rule, playerID, opcode, "overtook_held")
+		}
+	}
+
+	frames := make([][]byte, copies)
+	for i := range frames {
+		frames[i] = frame
+	}
+
+	if delay > 0 {
+		time.AfterFunc(delay, func() {
+			if err := s.sendFrames(conn, opcode, timeout, frames...); err != nil {
+				log.Printf("Delayed write to %s failed: %v", conn.ID, err)
+			}
+		})
+		return nil
+	}
+
+	return s.sendFrames(conn, opcode, timeout, frames...)
+}
+
+// reorderHoldTimeout 乱序暂存帧的最长等待时间，超时后没有后续帧也会补发
+const reorderHoldTimeout = 200 * time.Millisecond
+
+// holdFrame 暂存帧等下一帧发出后补发，已有暂存帧时返回false
+func (s *Server) holdFrame(conn *Connection, frame []byte) bool {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+
+	if conn.heldFrame != nil {
+		return false
+	}
+	conn.heldFrame = frame
+	conn.heldGen++
+	gen := conn.heldGen
+	time.AfterFunc(reorderHoldTimeout, func() {
+		conn.mu.Lock()
+		if conn.heldGen != gen || conn.heldFrame == nil {
+			conn.mu.Unlock()
+			return
+		}
+		conn.mu.Unlock()
+		select {
+		case <-conn.stopChan:
+			return
+		default:
+		}
+		s.flushHeldFrame(conn)
+	})
+	return true
+}
+
+// flushHeldFrame 补发乱序注入暂存的帧（超时或连接关闭时），半开连接不补发
+func (s *Server) flushHeldFrame(conn *Connection) {
+	conn.mu.RLock()
+	held := conn.heldFrame != nil
+	conn.mu.RUnlock()
+	if !held || conn.halfOpen.Load() {
+		return
+	}
+	// 不带新帧的写出只补发暂存帧
+	if err := s.writeFrames(conn, time.Second); err != nil {
+		log.Printf("Flush held frame to %s failed: %v", conn.ID, err)
+	}
+}
+
+// takeHeldFrame 取出乱序注入暂存的帧（调用方持有conn.mu）
+func (conn *Connection) takeHeldFrame() []byte {
+	held := conn.heldFrame
+	conn.heldFrame = nil
+	return held
+}
+
+// corruptFrame 复制帧并翻转消息体中的字节（帧头保持不变，仍可被解析）
+func corruptFrame(frame []byte) []byte {
+	corrupted := make([]byte, len(frame))
+	copy(corrupted, frame)
+
+	if len(corrupted) <= protocol.FrameHeaderSize {
+		for i := range corrupted {
+			corrupted[i] ^= 0xFF
+		}
+		return corrupted
+	}
+	for i := protocol.FrameHeaderSize; i < len(corrupted); i += 3 {
+		corrupted[i] ^= 0xFF
+	}
+	return corrupted
+}
+
+// AddFaultRule 添加故障规则
+func (s *Server) AddFaultRule(rule FaultRule) (string, error) {
+	return s.faults.AddRule(rule)
+}
+
+// RemoveFaultRule 删除故障规则
+func (s *Server) RemoveFaultRule(id string) bool {
+	return s.faults.RemoveRule(id)
+}
+
+// ClearFaultRules 清除所有故障规则
+func (s *Server) ClearFaultRules() {
+	s.faults.ClearRules()
+}
+
+// GetFaultEngine 获取故障注入引擎
+func (s *Server) GetFaultEngine() *FaultEngine {
+	return s.faults
+}
+
+// handleFaultControl 处理故障规则控制命令
+//
+//	POST /control?action=add_fault      body为FaultRule JSON或其数组（任一规则非法时全部不添加）
+//	POST /control?action=remove_fault&id=fault_1
+//	POST /control?action=clear_faults
+//	POST /control?action=list_faults    返回规则与故障日志
+func (s *Server) handleFaultControl(w http.ResponseWriter, r *http.Request, action string) {
+	w.Header().Set("Content-Type", "application/json")
+
+	switch action {
+	case "add_fault":
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("read body failed: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		var rules []FaultRule
+		if trimmed := bytes.TrimSpace(body); len(trimmed) > 0 && trimmed[0] == '[' {
+			err = json.Unmarshal(trimmed, &rules)
+		} else {
+			var rule FaultRule
+			err = json.Unmarshal(trimmed, &rule)
+			rules = append(rules, rule)
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid fault rule: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		ids, err := s.faults.AddRules(rules)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"ids": ids})
+
+	case "remove_fault":
+		id := r.URL.Query().Get("id")
+		if !s.faults.RemoveRule(id) {
+			http.Error(w, fmt.Sprintf("fault rule %s not found", id), http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"removed": id})
+
+	case "clear_faults":
+		s.faults.ClearRules()
+		json.NewEncoder(w).Encode(map[string]interface{}{"cleared": true})
+
+	case "list_faults":
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"rules":  s.faults.Rules(),
+			"events": s.faults.Events(),
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package testserver
+
+import (
+	"log"
+	"sync/atomic"
+	"time"
+
+	"GoSlgBenchmarkTest/internal/protocol"
+)
+
+// registerPlayer 按重复登录策略登记玩家连接，新登录被拒绝时返回false
+func (s *Server) registerPlayer(conn *Connection, playerID string) bool {
+	switch s.config.DuplicateLoginPolicy {
+	case protocol.DuplicateLoginRejectNew:
+		if existing, loaded := s.players.LoadOrStore(playerID, conn); loaded && existing != conn {
+			s.kickConnection(conn, protocol.KickLoginConflict, "player is already online on another connection")
+			return false
+		}
+	case protocol.DuplicateLoginKickOld:
+		if previous, loaded := s.players.Swap(playerID, conn); loaded && previous != conn {
+			// 同步踢掉旧连接，保证新连接收到登录响应时旧连接已经下线
+			s.kickConnection(previous.(*Connection), protocol.KickDuplicateLogin, "logged in from another connection")
+		}
+	default:
+		s.players.Store(playerID, conn)
+	}
+	return true
+}
+
+// kickConnection 发送踢下线消息并以CloseKicked关闭连接
+func (s *Server) kickConnection(conn *Connection, reason protocol.KickReason, message string) {
+	counter, _ := s.kicked.LoadOrStore(reason, &atomic.Uint64{})
+	counter.(*atomic.Uint64).Add(1)
+	s.metrics.kickedConnections.WithLabelValues(reason.String()).Inc()
+
+	// 直接写出，绕过发送队列，保证在关闭帧之前送达
+	frame, err := protocol.EncodeKick(reason, message)
+	if err == nil {
+		err = s.writeFrames(conn, time.Second, frame)
+	}
+	if err != nil {
+		log.Printf("Send kick to %s failed: %v", conn.ID, err)
+	}
+
+	log.Printf("Kicking %s (player %s): %s", conn.ID, conn.PlayerID, reason)
+	s.closeConnectionWithCode(conn, protocol.CloseKicked, "kicked: "+reason.String())
+}
+
+// KickCounts 按原因统计的踢下线次数
+func (s *Server) KickCounts() map[protocol.KickReason]uint64 {
+	counts := make(map[protocol.KickReason]uint64)
+	s.kicked.Range(func(key, value interface{}) bool {
+		counts[key.(protocol.KickReason)] = value.(*atomic.Uint64).Load()
+		return true
+	})
+	return counts
+}
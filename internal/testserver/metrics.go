@@ -0,0 +1,116 @@
+package testserver
+
+import (
+	"encoding/binary"
+	"strconv"
+	"time"
+
+	"GoSlgBenchmarkTest/internal/metrics"
+	"GoSlgBenchmarkTest/internal/protocol"
+)
+
+// serverMetrics WebSocket测试服务器的Prometheus指标
+type serverMetrics struct {
+	registry *metrics.Registry
+
+	messagesReceived  *metrics.CounterVec
+	messagesSent      *metrics.CounterVec
+	bytesReceived     *metrics.CounterVec
+	bytesSent         *metrics.CounterVec
+	decodeErrors      *metrics.CounterVec
+	handleDuration    *metrics.HistogramVec
+	roomFanout        *metrics.HistogramVec
+	droppedFrames     *metrics.CounterVec
+	coalescedFrames   *metrics.CounterVec
+	reapedConnections *metrics.CounterVec
+	kickedConnections *metrics.CounterVec
+}
+
+// newServerMetrics 创建并注册服务器指标
+func newServerMetrics(s *Server) *serverMetrics {
+	registry := metrics.NewRegistry()
+
+	m := &serverMetrics{
+		registry:         registry,
+		messagesReceived: registry.Counter("slg_ws_messages_received_total", "WebSocket messages received by opcode.", "opcode"),
+		messagesSent:     registry.Counter("slg_ws_messages_sent_total", "WebSocket messages written by opcode.", "opcode"),
+		bytesReceived:    registry.Counter("slg_ws_received_bytes_total", "WebSocket frame bytes received by opcode.", "opcode"),
+		bytesSent:        registry.Counter("slg_ws_sent_bytes_total", "WebSocket frame bytes written by opcode.", "opcode"),
+		decodeErrors:     registry.Counter("slg_ws_decode_errors_total", "Frames that failed to decode."),
+		handleDuration: registry.Histogram("slg_ws_handle_duration_seconds",
+			"Time spent handling a client message, by opcode.", nil, "opcode"),
+		roomFanout: registry.Histogram("slg_ws_room_fanout_duration_seconds",
+			"Time spent fanning a push out to room members, by room kind.", nil, "kind"),
+		droppedFrames:   registry.Counter("slg_ws_send_queue_dropped_total", "Frames dropped by the slow-consumer policy."),
+		coalescedFrames: registry.Counter("slg_ws_send_queue_coalesced_total", "Frames replaced by a newer state of the same battle."),
+		reapedConnections: registry.Counter("slg_ws_reaped_connections_total",
+			"Connections closed by dead-peer detection, by reason.", "reason"),
+		kickedConnections: registry.Counter("slg_ws_kicked_connections_total",
+			"Connections kicked by the duplicate-login policy, by reason.", "reason"),
+	}
+
+	registry.GaugeFunc("slg_ws_connections", "Currently open WebSocket connections.", func() float64 {
+		return float64(s.connCount.Load())
+	})
+	registry.CounterFunc("slg_ws_connections_total", "WebSocket connections accepted since start.", func() float64 {
+		return float64(s.totalConnections.Load())
+	})
+	registry.GaugeFunc("slg_ws_send_queue_depth", "Frames waiting in all send queues.", func() float64 {
+		var depth int64
+		s.connections.Range(func(key, value interface{}) bool {
+			depth += value.(*Connection).Stats.QueueDepth.Load()
+			return true
+		})
+		return float64(depth)
+	})
+	registry.CounterFunc("slg_ws_faults_injected_total", "Faults injected by the fault engine.", func() float64 {
+		return float64(s.faults.InjectedCount())
+	})
+	registry.GaugeFunc("slg_ws_rooms", "Rooms with at least one member.", func() float64 {
+		return float64(len(s.rooms.Stats()))
+	})
+	registry.GaugeFunc("slg_ws_zombie_connections", "Connections that missed a pong or half the heartbeat deadline.", func() float64 {
+		return float64(s.zombieCount())
+	})
+	registry.GaugeFunc("slg_ws_uptime_seconds", "Seconds since the server was created.", func() float64 {
+		return time.Since(s.startTime).Seconds()
+	})
+
+	return m
+}
+
+// observeReceived 记录收到的消息及处理耗时
+func (m *serverMetrics) observeReceived(opcode uint16, size int, elapsed time.Duration) {
+	label := opcodeLabel(opcode)
+	m.messagesReceived.WithLabelValues(label).Inc()
+	m.bytesReceived.WithLabelValues(label).Add(float64(size))
+	m.handleDuration.WithLabelValues(label).ObserveDuration(elapsed)
+}
+
+// observeSent 记录写出的帧
+func (m *serverMetrics) observeSent(frame []byte) {
+	label := opcodeLabel(frameOpcode(frame))
+	m.messagesSent.WithLabelValues(label).Inc()
+	m.bytesSent.WithLabelValues(label).Add(float64(len(frame)))
+}
+
+// GetMetrics 获取服务器指标注册表
+func (s *Server) GetMetrics() *metrics.Registry {
+	return s.metrics.registry
+}
+
+// frameOpcode 读取帧头中的操作码，帧过短时返回0
+func frameOpcode(frame []byte) uint16 {
+	if len(frame) < 2 {
+		return 0
+	}
+	return binary.BigEndian.Uint16(frame[:2])
+}
+
+// opcodeLabel 操作码标签值，未命名的操作码使用数值
+func opcodeLabel(opcode uint16) string {
+	if name := protocol.OpcodeToString(opcode); name != "UNKNOWN" {
+		return name
+	}
+	return strconv.Itoa(int(opcode))
+}
@@ -0,0 +1,175 @@
+package testserver
+
+import (
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// ReapReason 连接被回收的原因，同时作为关闭帧的原因文本
+type ReapReason string
+
+const (
+	ReapHeartbeatTimeout ReapReason = "heartbeat_timeout" // 超过期限未收到应用层心跳
+	ReapPongTimeout      ReapReason = "pong_timeout"      // WebSocket ping未在期限内应答
+	ReapIdleTimeout      ReapReason = "idle_timeout"      // 超过期限未收到任何消息
+)
+
+// livenessEnabled 是否启用了任一死连接检测
+func (s *Server) livenessEnabled() bool {
+	return s.config.HeartbeatTimeout > 0 || s.config.PingInterval > 0 || s.config.IdleTimeout > 0
+}
+
+// reapInterval 回收检查间隔：最短期限的1/4，限制在5ms到1s之间
+func (s *Server) reapInterval() time.Duration {
+	interval := time.Second
+	for _, d := range []time.Duration{s.config.HeartbeatTimeout, s.config.PingInterval, s.config.PongTimeout, s.config.IdleTimeout} {
+		if d > 0 && d/4 < interval {
+			interval = d / 4
+		}
+	}
+	if interval < 5*time.Millisecond {
+		interval = 5 * time.Millisecond
+	}
+	return interval
+}
+
+// reaperLoop 定期发送ping并回收死连接
+func (s *Server) reaperLoop() {
+	defer s.bgWg.Done()
+
+	ticker := time.NewTicker(s.reapInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stopCh:
+			return
+		case now := <-ticker.C:
+			s.reapConnections(now)
+		}
+	}
+}
+
+// reapConnections 检查所有连接，必要时发送ping，回收超过期限的连接
+func (s *Server) reapConnections(now time.Time) {
+	type reapTarget struct {
+		conn   *Connection
+		reason ReapReason
+	}
+	var targets []reapTarget
+
+	s.connections.Range(func(key, value interface{}) bool {
+		conn := value.(*Connection)
+		if reason, dead := s.checkLiveness(conn, now); dead {
+			targets = append(targets, reapTarget{conn: conn, reason: reason})
+			return true
+		}
+		s.maybePing(conn, now)
+		return true
+	})
+
+	// 在Range完成后关闭，避免在遍历过程中修改map
+	for _, target := range targets {
+		s.reapConnection(target.conn, target.reason)
+	}
+}
+
+// checkLiveness 检查连接是否已超过任一期限
+func (s *Server) checkLiveness(conn *Connection, now time.Time) (ReapReason, bool) {
+	stats := conn.Stats
+
+	// 每个ping间隔都会发送一次ping，存活的客户端两次pong的间隔不会超过ping间隔加往返时延
+	if s.config.PingInterval > 0 && s.config.PongTimeout > 0 &&
+		now.Sub(time.Unix(0, stats.LastPong.Load())) > s.config.PingInterval+s.config.PongTimeout {
+		return ReapPongTimeout, true
+	}
+
+	if s.config.HeartbeatTimeout > 0 {
+		// 心跳期限从登录成功开始计算，登录阶段由握手读超时保护
+		if last := stats.LastHeartbeat.Load(); last > 0 && now.Sub(time.Unix(0, last)) > s.config.HeartbeatTimeout {
+			return ReapHeartbeatTimeout, true
+		}
+	}
+
+	if s.config.IdleTimeout > 0 && now.Sub(time.Unix(0, stats.LastActivity.Load())) > s.config.IdleTimeout {
+		return ReapIdleTimeout, true
+	}
+
+	return "", false
+}
+
+// maybePing 到达ping间隔时发送WebSocket ping，上一次ping未应答时累计错过次数
+func (s *Server) maybePing(conn *Connection, now time.Time) {
+	if s.config.PingInterval <= 0 {
+		return
+	}
+
+	stats := conn.Stats
+	lastPing := stats.LastPing.Load()
+	if now.Sub(time.Unix(0, lastPing)) < s.config.PingInterval {
+		return
+	}
+	if lastPing > stats.LastPong.Load() {
+		stats.MissedPongs.Add(1)
+	}
+
+	stats.LastPing.Store(now.UnixNano())
+	if err := conn.Conn.WriteControl(websocket.PingMessage, nil, now.Add(time.Second)); err != nil {
+		log.Printf("Ping %s failed: %v", conn.ID, err)
+	}
+}
+
+// handlePong 收到pong时刷新存活时间
+func (s *Server) handlePong(conn *Connection) {
+	conn.Stats.LastPong.Store(time.Now().UnixNano())
+	conn.Stats.MissedPongs.Store(0)
+}
+
+// reapConnection 回收死连接
+func (s *Server) reapConnection(conn *Connection, reason ReapReason) {
+	counter, _ := s.reaped.LoadOrStore(reason, &atomic.Uint64{})
+	counter.(*atomic.Uint64).Add(1)
+	s.metrics.reapedConnections.WithLabelValues(string(reason)).Inc()
+
+	idle := time.Since(time.Unix(0, conn.Stats.LastActivity.Load()))
+	log.Printf("Reaping %s: %s (idle %v, missed pongs %d)", conn.ID, reason, idle.Round(time.Millisecond), conn.Stats.MissedPongs.Load())
+	s.closeConnectionWithCode(conn, websocket.CloseGoingAway, string(reason))
+}
+
+// isZombie 连接是否疑似已死：错过了pong，或超过一半心跳期限未收到心跳，但尚未达到回收条件
+func (s *Server) isZombie(conn *Connection, now time.Time) bool {
+	if conn.Stats.MissedPongs.Load() > 0 {
+		return true
+	}
+	if s.config.HeartbeatTimeout > 0 {
+		last := conn.Stats.LastHeartbeat.Load()
+		return last > 0 && now.Sub(time.Unix(0, last)) > s.config.HeartbeatTimeout/2
+	}
+	return false
+}
+
+// zombieCount 当前疑似死连接数
+func (s *Server) zombieCount() int {
+	now := time.Now()
+	count := 0
+	s.connections.Range(func(key, value interface{}) bool {
+		if s.isZombie(value.(*Connection), now) {
+			count++
+		}
+		return true
+	})
+	return count
+}
+
+// ReapedCounts 按原因统计的已回收连接数
+func (s *Server) ReapedCounts() map[ReapReason]uint64 {
+	counts := make(map[ReapReason]uint64)
+	s.reaped.Range(func(key, value interface{}) bool {
+		counts[key.(ReapReason)] = value.(*atomic.Uint64).Load()
+		return true
+	})
+	return counts
+}
@@ -0,0 +1,256 @@
+package testserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"GoSlgBenchmarkTest/internal/protocol"
+	"GoSlgBenchmarkTest/internal/session"
+)
+
+// defaultSessionRetainLimit 未配置SessionRetainLimit时内存中保留的已结束录制数量
+const defaultSessionRetainLimit = 1000
+
+// startRecording 为新连接创建服务端视角的会话录制器
+func (s *Server) startRecording(conn *Connection, remoteAddr string) {
+	if !s.config.EnableSessionRecording {
+		return
+	}
+
+	conn.recorder = session.NewSessionRecorder(fmt.Sprintf("server_%s", conn.ID))
+	conn.recorder.SetPayloadDecoding(s.config.SessionPayloadDecoding)
+	conn.remoteAddr = remoteAddr
+}
+
+// recordFrame 记录一帧收发数据，无法解码的帧按帧头操作码记录
+func (s *Server) recordFrame(conn *Connection, direction string, frame []byte) {
+	if conn.recorder == nil {
+		return
+	}
+
+	opcode, body, err := protocol.DecodeFrame(frame)
+	if err != nil {
+		opcode = frameOpcode(frame)
+	}
+	conn.recorder.RecordMessage(direction, frame, opcode, body, protocol.MessageSequence(opcode, body))
+}
+
+// recordLogin 记录登录事件
+func (s *Server) recordLogin(conn *Connection, playerID string) {
+	if conn.recorder == nil {
+		return
+	}
+
+	conn.recorder.RecordEvent(session.EventLogin, map[string]interface{}{
+		"conn_id":     conn.ID,
+		"player_id":   playerID,
+		"remote_addr": conn.remoteAddr,
+		"side":        "server",
+	})
+}
+
+// recordFault 记录故障注入，同时写入故障引擎日志和连接的会话录制
+func (s *Server) recordFault(conn *Connection, rule FaultRule, playerID string, opcode uint16, detail string) {
+	s.faults.record(rule, conn.ID, playerID, opcode, detail)
+
+	if conn.recorder != nil {
+		conn.recorder.RecordFault(string(rule.Type), map[string]interface{}{
+			"rule_id": rule.ID,
+			"opcode":  opcode,
+			"detail":  detail,
+		})
+	}
+}
+
+// recordDrop 记录被发送队列丢弃的帧
+func (s *Server) recordDrop(conn *Connection, frame []byte, reason string) {
+	if conn.recorder == nil {
+		return
+	}
+
+	opcode, body, err := protocol.DecodeFrame(frame)
+	if err != nil {
+		opcode = frameOpcode(frame)
+	}
+	conn.recorder.RecordEvent(session.EventFrameDropped, map[string]interface{}{
+		"opcode":       opcode,
+		"sequence_num": protocol.MessageSequence(opcode, body),
+		"message_size": len(frame),
+		"reason":       reason,
+	})
+}
+
+// finishRecording 连接关闭时结束录制并按配置导出；未导出或导出失败的录制按玩家ID保留在内存中
+func (s *Server) finishRecording(conn *Connection, code int, reason string) {
+	if conn.recorder == nil {
+		return
+	}
+
+	conn.recorder.RecordClose(session.CloseCode(code), reason)
+
+	conn.mu.RLock()
+	playerID := conn.PlayerID
+	conn.mu.RUnlock()
+	if playerID == "" {
+		playerID = conn.ID // 未登录的连接按连接ID归档
+	}
+
+	if s.config.SessionExportDir != "" {
+		path, err := s.exportRecording(conn.recorder, playerID, conn.ID)
+		if err == nil {
+			log.Printf("Session of %s exported to %s", playerID, path)
+			return
+		}
+		log.Printf("Export session of %s failed: %v", playerID, err)
+	}
+	s.retainRecording(playerID, conn.recorder)
+}
+
+// retainRecording 保留已结束的录制，超过上限时丢弃最早结束的录制
+func (s *Server) retainRecording(playerID string, recorder *session.SessionRecorder) {
+	limit := s.config.SessionRetainLimit
+	if limit <= 0 {
+		limit = defaultSessionRetainLimit
+	}
+
+	s.recordingsMu.Lock()
+	defer s.recordingsMu.Unlock()
+
+	s.recordings[playerID] = append(s.recordings[playerID], recorder)
+	s.recordingOrder = append(s.recordingOrder, playerID)
+	for len(s.recordingOrder) > limit {
+		oldest := s.recordingOrder[0]
+		s.recordingOrder = s.recordingOrder[1:]
+		if recorders := s.recordings[oldest][1:]; len(recorders) > 0 {
+			s.recordings[oldest] = recorders
+		} else {
+			delete(s.recordings, oldest)
+		}
+	}
+}
+
+// exportRecording 将录制导出为JSON文件
+func (s *Server) exportRecording(recorder *session.SessionRecorder, playerID, connID string) (string, error) {
+	if err := os.MkdirAll(s.config.SessionExportDir, 0755); err != nil {
+		return "", fmt.Errorf("create export dir failed: %w", err)
+	}
+
+	data, err := recorder.ExportJSON()
+	if err != nil {
+		return "", fmt.Errorf("marshal session failed: %w", err)
+	}
+
+	name := fmt.Sprintf("%s_%s.json", sanitizeFileName(playerID), sanitizeFileName(connID))
+	path := filepath.Join(s.config.SessionExportDir, name)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return "", fmt.Errorf("write session file failed: %w", err)
+	}
+	return path, nil
+}
+
+// GetRecordedSession 获取玩家最近一次连接的服务端录制，连接仍在线时返回当前快照
+func (s *Server) GetRecordedSession(playerID string) *session.Session {
+	if conn, ok := s.connectionByPlayer(playerID); ok && conn.recorder != nil {
+		return conn.recorder.GetSession()
+	}
+
+	s.recordingsMu.Lock()
+	defer s.recordingsMu.Unlock()
+
+	recorders := s.recordings[playerID]
+	if len(recorders) == 0 {
+		return nil
+	}
+	return recorders[len(recorders)-1].GetSession()
+}
+
+// GetRecordedSessions 获取内存中保留的玩家已结束连接的服务端录制，按关闭顺序排列
+func (s *Server) GetRecordedSessions(playerID string) []*session.Session {
+	s.recordingsMu.Lock()
+	defer s.recordingsMu.Unlock()
+
+	sessions := make([]*session.Session, 0, len(s.recordings[playerID]))
+	for _, recorder := range s.recordings[playerID] {
+		sessions = append(sessions, recorder.GetSession())
+	}
+	return sessions
+}
+
+// TakeRecordedSessions 取出玩家保留在内存中的已结束录制，取出后不再保留
+func (s *Server) TakeRecordedSessions(playerID string) []*session.Session {
+	s.recordingsMu.Lock()
+	recorders := s.recordings[playerID]
+	delete(s.recordings, playerID)
+	s.recordingOrder = slices.DeleteFunc(s.recordingOrder, func(id string) bool { return id == playerID })
+	s.recordingsMu.Unlock()
+
+	sessions := make([]*session.Session, 0, len(recorders))
+	for _, recorder := range recorders {
+		sessions = append(sessions, recorder.GetSession())
+	}
+	return sessions
+}
+
+// handleSessions 处理/sessions请求：无参数时列出已录制的玩家，player=指定玩家时返回其最近一次录制；
+// DELETE /sessions?player=取出该玩家保留的所有已结束录制
+func (s *Server) handleSessions(w http.ResponseWriter, r *http.Request) {
+	if !s.config.EnableSessionRecording {
+		http.Error(w, "Session recording is disabled", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	playerID := r.URL.Query().Get("player")
+	if r.Method == http.MethodDelete {
+		if playerID == "" {
+			http.Error(w, "player is required", http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"sessions": s.TakeRecordedSessions(playerID)})
+		return
+	}
+	if playerID == "" {
+		players := make(map[string]int)
+		s.recordingsMu.Lock()
+		for id, recorders := range s.recordings {
+			players[id] = len(recorders)
+		}
+		s.recordingsMu.Unlock()
+
+		s.players.Range(func(key, value interface{}) bool {
+			if _, ok := players[key.(string)]; !ok {
+				players[key.(string)] = 0
+			}
+			return true
+		})
+
+		json.NewEncoder(w).Encode(map[string]interface{}{"players": players})
+		return
+	}
+
+	recorded := s.GetRecordedSession(playerID)
+	if recorded == nil {
+		http.Error(w, fmt.Sprintf("No session recorded for %s", playerID), http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(recorded)
+}
+
+// sanitizeFileName 替换文件名中的非法字符
+func sanitizeFileName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+			return r
+		default:
+			return '_'
+		}
+	}, name)
+}
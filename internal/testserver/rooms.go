@@ -0,0 +1,442 @@
+package testserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"GoSlgBenchmarkTest/internal/protocol"
+	gamev1 "GoSlgBenchmarkTest/proto/game/v1"
+)
+
+// RoomKind 房间类型
+type RoomKind string
+
+const (
+	RoomBattle   RoomKind = "battle"   // 战斗房间
+	RoomAlliance RoomKind = "alliance" // 联盟频道
+	RoomRegion   RoomKind = "region"   // 地图区域
+)
+
+// BattleRoom 战斗房间ID
+func BattleRoom(battleID string) string {
+	return fmt.Sprintf("%s:%s", RoomBattle, battleID)
+}
+
+// AllianceRoom 联盟房间ID
+func AllianceRoom(allianceID string) string {
+	return fmt.Sprintf("%s:%s", RoomAlliance, allianceID)
+}
+
+// RegionRoom 地图区域房间ID
+func RegionRoom(x, y int) string {
+	return fmt.Sprintf("%s:%d_%d", RoomRegion, x, y)
+}
+
+// ParseRoomID 解析房间ID，格式为 kind:name
+func ParseRoomID(roomID string) (RoomKind, string, error) {
+	kind, name, ok := strings.Cut(roomID, ":")
+	if !ok || name == "" {
+		return "", "", fmt.Errorf("invalid room id %q, expected kind:name", roomID)
+	}
+
+	switch RoomKind(kind) {
+	case RoomBattle, RoomAlliance, RoomRegion:
+		return RoomKind(kind), name, nil
+	default:
+		return "", "", fmt.Errorf("unknown room kind %q", kind)
+	}
+}
+
+// RoomStats 房间扇出统计
+type RoomStats struct {
+	ID              string        `json:"id"`
+	Kind            RoomKind      `json:"kind"`
+	Members         int           `json:"members"`
+	Pushes          uint64        `json:"pushes"`
+	TotalRecipients uint64        `json:"total_recipients"`
+	LastFanout      int           `json:"last_fanout"`
+	MaxFanout       int           `json:"max_fanout"`
+	AvgFanout       float64       `json:"avg_fanout"`
+	LastLatency     time.Duration `json:"last_latency_ns"`
+	MaxLatency      time.Duration `json:"max_latency_ns"`
+	AvgLatency      time.Duration `json:"avg_latency_ns"`
+	FailedDelivers  uint64        `json:"failed_delivers"`
+}
+
+// room 房间
+type room struct {
+	id      string
+	kind    RoomKind
+	members map[string]*Connection // 连接ID -> 连接
+
+	pushes          uint64
+	totalRecipients uint64
+	lastFanout      int
+	maxFanout       int
+	latencySum      time.Duration
+	lastLatency     time.Duration
+	maxLatency      time.Duration
+	failedDelivers  uint64
+}
+
+// RoomManager 房间管理器
+type RoomManager struct {
+	rooms    map[string]*room               // 最后一个成员离开时删除房间及其扇出统计
+	memberOf map[string]map[string]struct{} // 连接ID -> 房间ID集合
+	mu       sync.RWMutex
+}
+
+// NewRoomManager 创建房间管理器
+func NewRoomManager() *RoomManager {
+	return &RoomManager{
+		rooms:    make(map[string]*room),
+		memberOf: make(map[string]map[string]struct{}),
+	}
+}
+
+// Join 连接加入房间
+func (m *RoomManager) Join(roomID string, conn *Connection) error {
+	kind, _, err := ParseRoomID(roomID)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	r, ok := m.rooms[roomID]
+	if !ok {
+		r = &room{id: roomID, kind: kind, members: make(map[string]*Connection)}
+		m.rooms[roomID] = r
+	}
+	r.members[conn.ID] = conn
+
+	joined, ok := m.memberOf[conn.ID]
+	if !ok {
+		joined = make(map[string]struct{})
+		m.memberOf[conn.ID] = joined
+	}
+	joined[roomID] = struct{}{}
+	return nil
+}
+
+// Leave 连接离开房间
+func (m *RoomManager) Leave(roomID string, conn *Connection) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.leaveLocked(roomID, conn.ID)
+}
+
+// LeaveAll 连接离开所有房间（连接关闭时调用）
+func (m *RoomManager) LeaveAll(conn *Connection) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for roomID := range m.memberOf[conn.ID] {
+		m.leaveLocked(roomID, conn.ID)
+	}
+	delete(m.memberOf, conn.ID)
+}
+
+// leaveLocked 离开房间（调用方持有锁）
+func (m *RoomManager) leaveLocked(roomID, connID string) bool {
+	r, ok := m.rooms[roomID]
+	if !ok {
+		return false
+	}
+	if _, ok := r.members[connID]; !ok {
+		return false
+	}
+
+	delete(r.members, connID)
+	if len(r.members) == 0 {
+		delete(m.rooms, roomID)
+	}
+	if joined, ok := m.memberOf[connID]; ok {
+		delete(joined, roomID)
+		if len(joined) == 0 {
+			delete(m.memberOf, connID)
+		}
+	}
+	return true
+}
+
+// Members 获取房间成员快照
+func (m *RoomManager) Members(roomID string) []*Connection {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	r, ok := m.rooms[roomID]
+	if !ok {
+		return nil
+	}
+
+	members := make([]*Connection, 0, len(r.members))
+	for _, conn := range r.members {
+		members = append(members, conn)
+	}
+	return members
+}
+
+// RoomsOf 获取连接所在的房间
+func (m *RoomManager) RoomsOf(conn *Connection) []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	rooms := make([]string, 0, len(m.memberOf[conn.ID]))
+	for roomID := range m.memberOf[conn.ID] {
+		rooms = append(rooms, roomID)
+	}
+	sort.Strings(rooms)
+	return rooms
+}
+
+// ActiveRooms 获取有成员的指定类型房间
+func (m *RoomManager) ActiveRooms(kind RoomKind) []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var rooms []string
+	for id, r := range m.rooms {
+		if r.kind == kind && len(r.members) > 0 {
+			rooms = append(rooms, id)
+		}
+	}
+	sort.Strings(rooms)
+	return rooms
+}
+
+// recordFanout 记录一次扇出
+func (m *RoomManager) recordFanout(roomID string, recipients, failed int, latency time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	r, ok := m.rooms[roomID]
+	if !ok {
+		return
+	}
+
+	r.pushes++
+	r.totalRecipients += uint64(recipients)
+	r.lastFanout = recipients
+	if recipients > r.maxFanout {
+		r.maxFanout = recipients
+	}
+	r.latencySum += latency
+	r.lastLatency = latency
+	if latency > r.maxLatency {
+		r.maxLatency = latency
+	}
+	r.failedDelivers += uint64(failed)
+}
+
+// Stats 获取所有房间的扇出统计（按房间ID排序）
+func (m *RoomManager) Stats() []RoomStats {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	stats := make([]RoomStats, 0, len(m.rooms))
+	for _, r := range m.rooms {
+		stats = append(stats, r.stats())
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].ID < stats[j].ID })
+	return stats
+}
+
+// RoomStats 获取单个房间统计
+func (m *RoomManager) RoomStats(roomID string) (RoomStats, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	r, ok := m.rooms[roomID]
+	if !ok {
+		return RoomStats{}, false
+	}
+	return r.stats(), true
+}
+
+// stats 生成统计快照（调用方持有锁）
+func (r *room) stats() RoomStats {
+	stats := RoomStats{
+		ID:              r.id,
+		Kind:            r.kind,
+		Members:         len(r.members),
+		Pushes:          r.pushes,
+		TotalRecipients: r.totalRecipients,
+		LastFanout:      r.lastFanout,
+		MaxFanout:       r.maxFanout,
+		LastLatency:     r.lastLatency,
+		MaxLatency:      r.maxLatency,
+		FailedDelivers:  r.failedDelivers,
+	}
+	if r.pushes > 0 {
+		stats.AvgFanout = float64(r.totalRecipients) / float64(r.pushes)
+		stats.AvgLatency = r.latencySum / time.Duration(r.pushes)
+	}
+	return stats
+}
+
+// PushToRoom 推送消息给房间内所有成员，返回实际送达的成员数
+func (s *Server) PushToRoom(roomID string, opcode uint16, message proto.Message) (int, error) {
+	body, err := proto.Marshal(message)
+	if err != nil {
+		return 0, fmt.Errorf("marshal room message failed: %w", err)
+	}
+	frame := protocol.EncodeFrame(opcode, body)
+
+	start := time.Now()
+	members := s.rooms.Members(roomID)
+
+	var failedConns []*Connection
+	for _, conn := range members {
+		if err := s.deliverFrame(conn, opcode, frame, 1*time.Second); err != nil {
+			log.Printf("Room %s push to %s failed: %v", roomID, conn.ID, err)
+			failedConns = append(failedConns, conn)
+		}
+	}
+
+	elapsed := time.Since(start)
+	s.rooms.recordFanout(roomID, len(members), len(failedConns), elapsed)
+	if kind, _, err := ParseRoomID(roomID); err == nil {
+		s.metrics.roomFanout.WithLabelValues(string(kind)).ObserveDuration(elapsed)
+	}
+
+	for _, conn := range failedConns {
+		s.closeConnection(conn, "Room push failed")
+	}
+	return len(members) - len(failedConns), nil
+}
+
+// pushBattleRooms 房间路由模式下向每个有成员的战斗房间推送一次战斗状态
+func (s *Server) pushBattleRooms() {
+	for _, roomID := range s.rooms.ActiveRooms(RoomBattle) {
+		_, battleID, _ := ParseRoomID(roomID)
+		seq := s.seqGenerator.Add(1)
+
+		push := &gamev1.BattlePush{
+			Seq:       seq,
+			BattleId:  battleID,
+			StateHash: []byte{byte(seq), byte(seq >> 8), byte(seq >> 16)},
+			Units: []*gamev1.BattleUnit{
+				{
+					UnitId: fmt.Sprintf("unit_%d", seq%10),
+					Hp:     int32(100 - (seq % 100)),
+					Status: gamev1.UnitStatus(seq%4 + 1),
+				},
+			},
+			Timestamp: time.Now().UnixMilli(),
+		}
+
+		if _, err := s.PushToRoom(roomID, protocol.OpBattlePush, push); err != nil {
+			log.Printf("Push battle room %s failed: %v", roomID, err)
+		}
+	}
+}
+
+// handleRoomMessage 处理客户端加入/离开房间请求（消息体为房间ID）
+func (s *Server) handleRoomMessage(conn *Connection, opcode uint16, body []byte) {
+	req := &wrapperspb.StringValue{}
+	if err := proto.Unmarshal(body, req); err != nil {
+		log.Printf("Unmarshal room request failed: %v", err)
+		return
+	}
+
+	var err error
+	if opcode == protocol.OpRoomJoin {
+		err = s.rooms.Join(req.Value, conn)
+	} else if !s.rooms.Leave(req.Value, conn) {
+		err = fmt.Errorf("not a member of room %s", req.Value)
+	}
+
+	if err != nil {
+		s.sendMessage(conn, protocol.OpError, &gamev1.ErrorResp{
+			ErrorCode:    400,
+			ErrorMessage: err.Error(),
+		})
+		return
+	}
+
+	s.sendMessage(conn, protocol.OpRoomResp, req)
+}
+
+// JoinRoom 将玩家的连接加入房间
+func (s *Server) JoinRoom(playerID, roomID string) error {
+	conn, ok := s.connectionByPlayer(playerID)
+	if !ok {
+		return fmt.Errorf("player %s is not connected", playerID)
+	}
+	return s.rooms.Join(roomID, conn)
+}
+
+// LeaveRoom 将玩家的连接移出房间
+func (s *Server) LeaveRoom(playerID, roomID string) bool {
+	conn, ok := s.connectionByPlayer(playerID)
+	if !ok {
+		return false
+	}
+	return s.rooms.Leave(roomID, conn)
+}
+
+// GetRoomStats 获取房间扇出统计
+func (s *Server) GetRoomStats() []RoomStats {
+	return s.rooms.Stats()
+}
+
+// connectionByPlayer 根据玩家ID查找连接
+func (s *Server) connectionByPlayer(playerID string) (*Connection, bool) {
+	value, ok := s.players.Load(playerID)
+	if !ok {
+		return nil, false
+	}
+	return value.(*Connection), true
+}
+
+// handleRooms 处理房间API
+//
+//	GET  /rooms                                    返回所有房间统计
+//	POST /rooms?action=join&room=battle:1&player=p 加入房间
+//	POST /rooms?action=leave&room=battle:1&player=p 离开房间
+func (s *Server) handleRooms(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method == http.MethodGet {
+		json.NewEncoder(w).Encode(map[string]interface{}{"rooms": s.rooms.Stats()})
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	roomID := query.Get("room")
+	playerID := query.Get("player")
+
+	switch query.Get("action") {
+	case "join":
+		if err := s.JoinRoom(playerID, roomID); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	case "leave":
+		if !s.LeaveRoom(playerID, roomID) {
+			http.Error(w, fmt.Sprintf("player %s is not in room %s", playerID, roomID), http.StatusNotFound)
+			return
+		}
+	default:
+		http.Error(w, "Unknown action", http.StatusBadRequest)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{"room": roomID, "player": playerID})
+}
@@ -0,0 +1,216 @@
+package testserver
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"google.golang.org/protobuf/proto"
+
+	"GoSlgBenchmarkTest/internal/protocol"
+	gamev1 "GoSlgBenchmarkTest/proto/game/v1"
+)
+
+// SlowConsumerPolicy 发送队列满时的处理策略
+type SlowConsumerPolicy string
+
+const (
+	PolicyBlock      SlowConsumerPolicy = "block"       // 阻塞推送方直到队列有空位
+	PolicyDropOldest SlowConsumerPolicy = "drop_oldest" // 丢弃队首最旧的帧
+	PolicyDropNewest SlowConsumerPolicy = "drop_newest" // 丢弃新帧
+	PolicyCoalesce   SlowConsumerPolicy = "coalesce"    // 同一战斗只保留最新状态，队列满时丢弃最旧的帧
+	PolicyDisconnect SlowConsumerPolicy = "disconnect"  // 断开慢消费者
+)
+
+// outboundFrame 待发送的帧
+type outboundFrame struct {
+	frame []byte
+	key   string // 合并键（战斗ID），为空表示不可合并
+}
+
+// sendQueue 连接的有界发送队列
+type sendQueue struct {
+	frames   []outboundFrame
+	capacity int
+	closed   bool
+	mu       sync.Mutex
+	cond     *sync.Cond
+}
+
+// newSendQueue 创建发送队列
+func newSendQueue(capacity int) *sendQueue {
+	q := &sendQueue{capacity: capacity}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+// close 关闭队列并唤醒所有等待者
+func (q *sendQueue) close() {
+	q.mu.Lock()
+	q.closed = true
+	q.frames = nil
+	q.mu.Unlock()
+	q.cond.Broadcast()
+}
+
+// pop 阻塞获取下一帧并返回剩余深度，队列关闭时返回false
+func (q *sendQueue) pop() (outboundFrame, int, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for len(q.frames) == 0 && !q.closed {
+		q.cond.Wait()
+	}
+	if q.closed {
+		return outboundFrame{}, 0, false
+	}
+
+	item := q.frames[0]
+	q.frames = q.frames[1:]
+	q.cond.Broadcast() // 唤醒阻塞策略下等待空位的推送方
+	return item, len(q.frames), true
+}
+
+// enqueueResult 入队结果
+type enqueueResult int
+
+const (
+	enqueued enqueueResult = iota
+	enqueueDropped
+	enqueueCoalesced
+	enqueueOverflow // 需要断开慢消费者
+	enqueueClosed
+)
+
+// push 按策略入队
+func (q *sendQueue) push(item outboundFrame, policy SlowConsumerPolicy) (enqueueResult, int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return enqueueClosed, 0
+	}
+
+	result := enqueued
+
+	// 合并：移除同一战斗尚未发出的旧状态，新状态追加到队尾以保持序列号递增
+	if policy == PolicyCoalesce && item.key != "" {
+		for i, pending := range q.frames {
+			if pending.key == item.key {
+				q.frames = append(q.frames[:i], q.frames[i+1:]...)
+				result = enqueueCoalesced
+				break
+			}
+		}
+	}
+
+	for len(q.frames) >= q.capacity {
+		switch policy {
+		case PolicyBlock:
+			q.cond.Wait()
+			if q.closed {
+				return enqueueClosed, 0
+			}
+		case PolicyDropNewest:
+			return enqueueDropped, len(q.frames)
+		case PolicyDisconnect:
+			return enqueueOverflow, len(q.frames)
+		default: // PolicyDropOldest、PolicyCoalesce
+			q.frames = q.frames[1:]
+			result = enqueueDropped
+		}
+	}
+
+	q.frames = append(q.frames, item)
+	q.cond.Broadcast()
+	return result, len(q.frames)
+}
+
+// sendFrames 发送帧：启用发送队列时入队由发送协程写出，否则同步写出
+func (s *Server) sendFrames(conn *Connection, opcode uint16, timeout time.Duration, frames ...[]byte) error {
+	if conn.queue == nil {
+		return s.writeFrames(conn, timeout, frames...)
+	}
+	return s.enqueueFrames(conn, opcode, frames...)
+}
+
+// enqueueFrames 将帧放入连接的发送队列
+func (s *Server) enqueueFrames(conn *Connection, opcode uint16, frames ...[]byte) error {
+	policy := s.config.SlowConsumerPolicy
+
+	for _, frame := range frames {
+		item := outboundFrame{frame: frame}
+		if policy == PolicyCoalesce && opcode == protocol.OpBattlePush {
+			item.key = battleKey(frame)
+		}
+
+		result, depth := conn.queue.push(item, policy)
+		conn.Stats.QueueDepth.Store(int64(depth))
+		storeMax(&conn.Stats.MaxQueueDepth, int64(depth))
+
+		switch result {
+		case enqueueDropped:
+			conn.Stats.DroppedFrames.Add(1)
+			s.metrics.droppedFrames.WithLabelValues().Inc()
+			s.recordDrop(conn, frame, string(policy))
+		case enqueueCoalesced:
+			conn.Stats.CoalescedFrames.Add(1)
+			s.metrics.coalescedFrames.WithLabelValues().Inc()
+		case enqueueOverflow:
+			conn.Stats.DroppedFrames.Add(1)
+			s.metrics.droppedFrames.WithLabelValues().Inc()
+			s.recordDrop(conn, frame, string(policy))
+			log.Printf("Slow consumer %s: send queue full (%d), disconnecting", conn.ID, depth)
+			go s.closeConnectionWithCode(conn, websocket.ClosePolicyViolation, "Slow consumer")
+			return fmt.Errorf("send queue overflow")
+		case enqueueClosed:
+			return fmt.Errorf("send queue closed")
+		}
+	}
+	return nil
+}
+
+// sendLoop 连接的发送协程，从队列取帧写出
+func (s *Server) sendLoop(conn *Connection) {
+	defer s.connWg.Done()
+
+	for {
+		item, depth, ok := conn.queue.pop()
+		if !ok {
+			return
+		}
+
+		conn.Stats.QueueDepth.Store(int64(depth))
+		if err := s.writeFrames(conn, 5*time.Second, item.frame); err != nil {
+			log.Printf("Send loop write to %s failed: %v", conn.ID, err)
+			s.closeConnection(conn, "Send failed")
+			return
+		}
+	}
+}
+
+// battleKey 提取战斗推送的战斗ID作为合并键
+func battleKey(frame []byte) string {
+	_, body, err := protocol.DecodeFrame(frame)
+	if err != nil {
+		return ""
+	}
+	push := &gamev1.BattlePush{}
+	if err := proto.Unmarshal(body, push); err != nil {
+		return ""
+	}
+	return push.BattleId
+}
+
+// storeMax 并发安全地把峰值更新为value，多个发送方同时更新时不丢失较大的值
+func storeMax(peak *atomic.Int64, value int64) {
+	for {
+		current := peak.Load()
+		if value <= current || peak.CompareAndSwap(current, value) {
+			return
+		}
+	}
+}
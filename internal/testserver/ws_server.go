@@ -14,7 +14,10 @@ import (
 	"github.com/gorilla/websocket"
 	"google.golang.org/protobuf/proto"
 
+	"GoSlgBenchmarkTest/internal/auth"
 	"GoSlgBenchmarkTest/internal/protocol"
+	"GoSlgBenchmarkTest/internal/session"
+	"GoSlgBenchmarkTest/internal/world"
 	gamev1 "GoSlgBenchmarkTest/proto/game/v1"
 )
 
@@ -29,6 +32,43 @@ type ServerConfig struct {
 	ReadBufferSize         int
 	WriteBufferSize        int
 	EnableCompression      bool
+
+	// 世界模拟：启用后推送由SLG世界状态驱动，而不是按序列号伪造
+	EnableWorldSimulation bool
+	WorldConfig           *world.Config // 为nil时使用world.DefaultConfig()
+
+	// 故障注入：启动时加载的规则，运行时可通过/control调整
+	FaultRules []FaultRule
+	FaultSeed  int64 // 故障引擎随机种子，0表示使用当前时间
+
+	// 房间路由：启用后战斗推送只发送给对应战斗房间的成员，而不是广播
+	EnableRoomRouting bool
+
+	// 发送队列：大于0时每个连接使用有界队列和独立发送协程，0表示同步写出
+	SendQueueSize      int
+	SlowConsumerPolicy SlowConsumerPolicy // 队列满时的策略，默认drop_oldest
+
+	// 服务端会话录制：启用后每个连接的收发帧与生命周期事件记录到独立会话，按玩家ID归档
+	EnableSessionRecording bool
+	SessionExportDir       string // 非空时连接关闭后将会话导出为JSON文件，导出成功的录制不再保留在内存中
+	SessionRetainLimit     int    // 内存中保留的已结束录制数量上限，超过时丢弃最早的；0表示默认1000
+	// 非nil时录制时解码消息体，/sessions和导出的JSON中每帧带有消息类型和protojson渲染
+	SessionPayloadDecoding *session.PayloadDecodeOptions
+
+	// 认证：设置后登录令牌必须是该认证器签发的有效令牌，玩家ID取自令牌声明；为nil时接受任意令牌
+	Authenticator *auth.Authenticator
+
+	// 集群模式下的节点ID
+	NodeID string
+
+	// 死连接检测：均为0时不启用，只能依赖读错误发现断开，无FIN消失的客户端会一直占用连接
+	HeartbeatTimeout time.Duration // 登录后超过此时间未收到应用层心跳即回收
+	PingInterval     time.Duration // WebSocket层ping发送间隔
+	PongTimeout      time.Duration // ping间隔之外再等待pong的时间，超时即回收
+	IdleTimeout      time.Duration // 超过此时间未收到任何应用层消息即回收
+
+	// 重复登录策略，默认allow；kick_old与reject_new会向被踢的连接发送OpKick后以CloseKicked关闭
+	DuplicateLoginPolicy protocol.DuplicateLoginPolicy
 }
 
 // DefaultServerConfig 返回默认配置
@@ -54,6 +94,18 @@ type ConnectionStats struct {
 	LastActivity     atomic.Int64 // unix nano
 	BytesReceived    atomic.Uint64
 	BytesSent        atomic.Uint64
+
+	// 发送队列统计
+	QueueDepth      atomic.Int64
+	MaxQueueDepth   atomic.Int64
+	DroppedFrames   atomic.Uint64
+	CoalescedFrames atomic.Uint64
+
+	// 死连接检测（unix nano）
+	LastHeartbeat atomic.Int64 // 登录成功时初始化
+	LastPing      atomic.Int64
+	LastPong      atomic.Int64 // 连接建立时初始化
+	MissedPongs   atomic.Int32 // 连续未应答的ping数
 }
 
 // Connection 表示一个WebSocket连接
@@ -66,7 +118,20 @@ type Connection struct {
 	// 控制标志
 	stopChan  chan struct{}
 	closeOnce sync.Once
-	mu        sync.RWMutex
+	mu        sync.RWMutex // 保护PlayerID等元数据，写出期间不持有
+	writeMu   sync.Mutex   // 串行化WebSocket写出，慢消费者阻塞写时不影响元数据读取
+
+	// 发送队列（未启用时为nil）
+	queue *sendQueue
+
+	// 故障注入状态
+	halfOpen  atomic.Bool
+	heldFrame []byte // 乱序注入时暂存的帧，受mu保护
+	heldGen   uint64 // 暂存帧的代数，超时补发时用于识别是否已被后续帧带出
+
+	// 服务端会话录制器（未启用时为nil）
+	recorder   *session.SessionRecorder
+	remoteAddr string
 }
 
 // safeClose 安全关闭连接的stopChan
@@ -80,6 +145,7 @@ func (c *Connection) safeClose() {
 type Server struct {
 	config   *ServerConfig
 	server   *http.Server
+	listener net.Listener
 	upgrader websocket.Upgrader
 
 	// 连接管理
@@ -94,10 +160,40 @@ type Server struct {
 	// 序列号生成器
 	seqGenerator atomic.Uint64
 
+	// 故障注入
+	faults *FaultEngine
+
+	// 房间订阅
+	rooms *RoomManager
+
+	// Prometheus指标
+	metrics *serverMetrics
+
+	// 已结束连接的会话录制，玩家ID -> 按关闭顺序排列的录制器；导出或取出后删除
+	recordings     map[string][]*session.SessionRecorder
+	recordingOrder []string // 所有保留录制按关闭顺序对应的玩家ID，超过上限时从头淘汰
+	recordingsMu   sync.Mutex
+
+	// 排空与交接：推送持读锁，排空持写锁，保证排空快照之后不再产生推送
+	draining   atomic.Bool
+	drainMu    sync.RWMutex
+	handoffs   map[string]PlayerHandoff // 其他节点交接来的玩家状态，登录时恢复
+	handoffsMu sync.Mutex
+
+	// 世界模拟
+	world   *world.World
+	players sync.Map // map[string]*Connection，玩家ID -> 连接
+
 	// 控制标志
 	forceDisconnect atomic.Bool
 	isRunning       atomic.Bool
 
+	// 死连接回收统计，原因 -> *atomic.Uint64
+	reaped sync.Map
+
+	// 踢下线统计，protocol.KickReason -> *atomic.Uint64
+	kicked sync.Map
+
 	// 统计信息
 	totalConnections atomic.Uint64
 	totalMessages    atomic.Uint64
@@ -111,6 +207,12 @@ func New(config *ServerConfig) *Server {
 	if config == nil {
 		config = DefaultServerConfig(":8080")
 	}
+	if config.SendQueueSize > 0 && config.SlowConsumerPolicy == "" {
+		config.SlowConsumerPolicy = PolicyDropOldest
+	}
+	if config.DuplicateLoginPolicy == "" {
+		config.DuplicateLoginPolicy = protocol.DuplicateLoginAllow
+	}
 
 	server := &Server{
 		config: config,
@@ -122,14 +224,32 @@ func New(config *ServerConfig) *Server {
 				return true // 允许所有源
 			},
 		},
-		stopCh:    make(chan struct{}),
-		startTime: time.Now(),
+		stopCh:     make(chan struct{}),
+		startTime:  time.Now(),
+		faults:     NewFaultEngine(config.FaultSeed),
+		rooms:      NewRoomManager(),
+		recordings: make(map[string][]*session.SessionRecorder),
+		handoffs:   make(map[string]PlayerHandoff),
+	}
+	server.metrics = newServerMetrics(server)
+
+	for _, rule := range config.FaultRules {
+		if _, err := server.faults.AddRule(rule); err != nil {
+			log.Printf("Ignore invalid fault rule: %v", err)
+		}
+	}
+
+	if config.EnableWorldSimulation {
+		server.world = world.New(config.WorldConfig, server.pushToPlayers)
 	}
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("/ws", server.handleWebSocket)
 	mux.HandleFunc("/stats", server.handleStats)
 	mux.HandleFunc("/control", server.handleControl)
+	mux.HandleFunc("/rooms", server.handleRooms)
+	mux.Handle("/metrics", server.metrics.registry.Handler())
+	mux.HandleFunc("/sessions", server.handleSessions)
 
 	server.server = &http.Server{
 		Addr:    config.Addr,
@@ -155,6 +275,10 @@ func (s *Server) Start() error {
 
 	log.Printf("✅ Server listening on %s", s.config.Addr)
 
+	s.mu.Lock()
+	s.listener = ln
+	s.mu.Unlock()
+
 	go func() {
 		if err := s.server.Serve(ln); err != nil && err != http.ErrServerClosed {
 			log.Printf("Server error: %v", err)
@@ -170,6 +294,11 @@ func (s *Server) Start() error {
 		go s.battlePushLoop()
 	}
 
+	if s.livenessEnabled() {
+		s.bgWg.Add(1)
+		go s.reaperLoop()
+	}
+
 	return nil
 }
 
@@ -196,6 +325,11 @@ func (s *Server) StartTLS(cert tls.Certificate) error {
 		go s.battlePushLoop()
 	}
 
+	if s.livenessEnabled() {
+		s.bgWg.Add(1)
+		go s.reaperLoop()
+	}
+
 	return nil
 }
 
@@ -247,6 +381,17 @@ func (s *Server) Shutdown(ctx context.Context) error {
 	return s.server.Shutdown(ctx)
 }
 
+// Addr 获取实际监听地址（配置端口为0时返回分配的端口），未启动时返回配置地址
+func (s *Server) Addr() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.listener != nil {
+		return s.listener.Addr().String()
+	}
+	return s.config.Addr
+}
+
 // ForceDisconnectAll 强制断开所有连接
 func (s *Server) ForceDisconnectAll() {
 	s.forceDisconnect.Store(true)
@@ -263,6 +408,10 @@ func (s *Server) ForceDisconnectAll() {
 
 // handleWebSocket 处理WebSocket连接
 func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	if s.draining.Load() {
+		http.Error(w, "Server is draining", http.StatusServiceUnavailable)
+		return
+	}
 	if s.connCount.Load() >= int32(s.config.MaxConnections) {
 		http.Error(w, "Too many connections", http.StatusServiceUnavailable)
 		return
@@ -284,6 +433,18 @@ func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 		stopChan: make(chan struct{}),
 	}
 	conn.Stats.LastActivity.Store(time.Now().UnixNano())
+	conn.Stats.LastPong.Store(time.Now().UnixNano())
+	wsConn.SetPongHandler(func(string) error {
+		s.handlePong(conn)
+		return nil
+	})
+	s.startRecording(conn, r.RemoteAddr)
+
+	if s.config.SendQueueSize > 0 {
+		conn.queue = newSendQueue(s.config.SendQueueSize)
+		s.connWg.Add(1)
+		go s.sendLoop(conn)
+	}
 
 	s.connections.Store(connID, conn)
 	s.connCount.Add(1)
@@ -348,12 +509,18 @@ func (s *Server) handleLogin(conn *Connection) bool {
 		log.Printf("Expected binary message for login")
 		return false
 	}
+	s.recordFrame(conn, "receive", rawData)
 
 	opcode, body, err := protocol.DecodeFrame(rawData)
 	if err != nil {
+		s.metrics.decodeErrors.WithLabelValues().Inc()
 		log.Printf("Decode login frame failed: %v", err)
 		return false
 	}
+	start := time.Now()
+	defer func() {
+		s.metrics.observeReceived(opcode, len(rawData), time.Since(start))
+	}()
 
 	if opcode != protocol.OpLoginReq {
 		log.Printf("Expected login request, got opcode: %d", opcode)
@@ -366,14 +533,34 @@ func (s *Server) handleLogin(conn *Connection) bool {
 		return false
 	}
 
-	// 简单验证（在真实环境中应该验证token）
-	playerID := fmt.Sprintf("player_%s_%d", loginReq.DeviceId, time.Now().Unix())
+	// 未启用认证时由设备ID派生稳定的玩家ID，同一设备重复登录才能被识别
+	playerID := "player_" + loginReq.DeviceId
+	if loginReq.DeviceId == "" {
+		playerID = "player_" + conn.ID
+	}
+	if s.config.Authenticator != nil {
+		claims, err := s.config.Authenticator.Verify(loginReq.Token)
+		if err != nil {
+			log.Printf("Login rejected for %s: %v", conn.ID, err)
+			s.rejectLogin(conn, 401, fmt.Sprintf("unauthorized: %v", err))
+			return false
+		}
+		playerID = claims.PlayerID()
+	}
 
 	// 使用锁保护PlayerID的写入，避免与广播的读取产生数据竞争
 	conn.mu.Lock()
 	conn.PlayerID = playerID
 	conn.mu.Unlock()
 
+	// 先登记玩家，保证客户端收到登录响应后即可按玩家ID寻址
+	if !s.registerPlayer(conn, playerID) {
+		return false
+	}
+	conn.Stats.LastHeartbeat.Store(time.Now().UnixNano())
+	s.recordLogin(conn, playerID)
+	s.resumeHandoff(conn, playerID)
+
 	// 发送登录响应
 	loginResp := &gamev1.LoginResp{
 		Ok:         true,
@@ -387,11 +574,28 @@ func (s *Server) handleLogin(conn *Connection) bool {
 		return false
 	}
 
+	if s.world != nil {
+		// 登录响应之后再创建城市，保证客户端先收到登录结果
+		s.world.AddPlayer(playerID)
+	}
+
 	log.Printf("Login successful: %s -> %s", conn.ID, playerID)
 	log.Printf("Connection %s login completed, starting message loop", conn.ID)
 	return true
 }
 
+// rejectLogin 直接写出登录错误响应，绕过发送队列以保证在关闭连接前送达
+func (s *Server) rejectLogin(conn *Connection, code int32, message string) {
+	body, err := proto.Marshal(&gamev1.ErrorResp{ErrorCode: code, ErrorMessage: message})
+	if err != nil {
+		log.Printf("Marshal login error failed: %v", err)
+		return
+	}
+	if err := s.writeFrames(conn, time.Second, protocol.EncodeFrame(protocol.OpError, body)); err != nil {
+		log.Printf("Send login error to %s failed: %v", conn.ID, err)
+	}
+}
+
 // messageReadLoop 消息读取循环
 func (s *Server) messageReadLoop(conn *Connection) {
 	defer func() {
@@ -406,6 +610,12 @@ func (s *Server) messageReadLoop(conn *Connection) {
 		case <-conn.stopChan:
 			return
 		default:
+			// 半开连接：停止读取但不关闭，直到连接被外部关闭
+			if conn.halfOpen.Load() {
+				<-conn.stopChan
+				return
+			}
+
 			conn.Conn.SetReadDeadline(time.Now().Add(120 * time.Second))
 
 			messageType, rawData, err := conn.Conn.ReadMessage()
@@ -422,13 +632,20 @@ func (s *Server) messageReadLoop(conn *Connection) {
 			s.totalMessages.Add(1)
 
 			if messageType == websocket.PingMessage {
+				conn.writeMu.Lock()
 				conn.Conn.WriteMessage(websocket.PongMessage, rawData)
+				conn.writeMu.Unlock()
 				continue
 			}
 
 			if messageType != websocket.BinaryMessage {
 				continue
 			}
+			s.recordFrame(conn, "receive", rawData)
+
+			if conn.halfOpen.Load() {
+				continue
+			}
 
 			s.handleMessage(conn, rawData)
 		}
@@ -439,15 +656,23 @@ func (s *Server) messageReadLoop(conn *Connection) {
 func (s *Server) handleMessage(conn *Connection, rawData []byte) {
 	opcode, body, err := protocol.DecodeFrame(rawData)
 	if err != nil {
+		s.metrics.decodeErrors.WithLabelValues().Inc()
 		log.Printf("Decode frame failed: %v", err)
 		return
 	}
 
+	start := time.Now()
+	defer func() {
+		s.metrics.observeReceived(opcode, len(rawData), time.Since(start))
+	}()
+
 	switch opcode {
 	case protocol.OpHeartbeat:
 		s.handleHeartbeat(conn, body)
 	case protocol.OpPlayerAction:
 		s.handlePlayerAction(conn, body)
+	case protocol.OpRoomJoin, protocol.OpRoomLeave:
+		s.handleRoomMessage(conn, opcode, body)
 	default:
 		log.Printf("Unknown opcode: %d", opcode)
 	}
@@ -462,6 +687,7 @@ func (s *Server) handleHeartbeat(conn *Connection, body []byte) {
 	}
 
 	now := time.Now()
+	conn.Stats.LastHeartbeat.Store(now.UnixNano())
 	clientTime := time.UnixMilli(heartbeat.ClientUnixMs)
 	rtt := now.Sub(clientTime)
 
@@ -485,8 +711,10 @@ func (s *Server) handlePlayerAction(conn *Connection, body []byte) {
 	log.Printf("Received action from %s: type=%v, seq=%d",
 		conn.PlayerID, action.ActionType, action.ActionSeq)
 
-	// 这里可以添加游戏逻辑处理
-	// 暂时直接回复成功
+	if s.world != nil {
+		s.applyWorldAction(conn.PlayerID, action)
+	}
+
 	resp := &gamev1.PlayerAction{
 		ActionSeq:       action.ActionSeq,
 		PlayerId:        conn.PlayerID,
@@ -497,6 +725,40 @@ func (s *Server) handlePlayerAction(conn *Connection, body []byte) {
 	s.sendMessage(conn, protocol.OpActionResp, resp)
 }
 
+// applyWorldAction 将玩家操作转换为世界模拟中的行军命令
+func (s *Server) applyWorldAction(playerID string, action *gamev1.PlayerAction) {
+	var err error
+
+	switch data := action.GetActionData().GetData().(type) {
+	case *gamev1.ActionData_Move:
+		target := data.Move.GetTargetPosition()
+		if target == nil {
+			return
+		}
+		_, err = s.world.IssueMarch(playerID, world.Point{X: float64(target.X), Y: float64(target.Y)}, 0)
+	case *gamev1.ActionData_Attack:
+		_, err = s.world.IssueAttack(playerID, data.Attack.GetTargetUnitId(), data.Attack.GetDamage())
+	}
+
+	if err != nil {
+		log.Printf("World action from %s rejected: %v", playerID, err)
+	}
+}
+
+// pushToPlayers 推送消息给指定玩家（世界模拟的推送回调）
+func (s *Server) pushToPlayers(playerIDs []string, opcode uint16, message proto.Message) {
+	for _, playerID := range playerIDs {
+		value, ok := s.players.Load(playerID)
+		if !ok {
+			continue
+		}
+		conn := value.(*Connection)
+		if err := s.sendMessage(conn, opcode, message); err != nil {
+			log.Printf("Push to %s failed: %v", playerID, err)
+		}
+	}
+}
+
 // battlePushLoop 战斗推送循环
 func (s *Server) battlePushLoop() {
 	defer s.bgWg.Done()
@@ -509,35 +771,54 @@ func (s *Server) battlePushLoop() {
 		case <-s.stopCh:
 			return
 		case <-ticker.C:
-			if s.connCount.Load() == 0 {
-				continue
+			s.drainMu.RLock()
+			if !s.draining.Load() {
+				s.pushTick()
 			}
+			s.drainMu.RUnlock()
+		}
+	}
+}
 
-			seq := s.seqGenerator.Add(1)
-			battlePush := &gamev1.BattlePush{
-				Seq:       seq,
-				BattleId:  fmt.Sprintf("battle_%d", seq/100), // 每100个消息一个战斗
-				StateHash: []byte{byte(seq), byte(seq >> 8), byte(seq >> 16)},
-				Units: []*gamev1.BattleUnit{
-					{
-						UnitId: fmt.Sprintf("unit_%d", seq%10),
-						Hp:     int32(100 - (seq % 100)),
-						Mp:     int32(50 + (seq % 50)),
-						Position: &gamev1.Position{
-							X: float32(seq % 100),
-							Y: float32((seq * 2) % 100),
-							Z: 0,
-						},
-						Status: gamev1.UnitStatus(seq%4 + 1),
-					},
-				},
-				Timestamp: time.Now().UnixMilli(),
-			}
+// pushTick 执行一轮推送
+func (s *Server) pushTick() {
+	if s.world != nil {
+		s.world.Tick(time.Now())
+		return
+	}
 
-			// 广播给所有连接
-			s.broadcastMessage(protocol.OpBattlePush, battlePush)
-		}
+	if s.connCount.Load() == 0 {
+		return
+	}
+
+	if s.config.EnableRoomRouting {
+		s.pushBattleRooms()
+		return
 	}
+
+	seq := s.seqGenerator.Add(1)
+	battlePush := &gamev1.BattlePush{
+		Seq:       seq,
+		BattleId:  fmt.Sprintf("battle_%d", seq/100), // 每100个消息一个战斗
+		StateHash: []byte{byte(seq), byte(seq >> 8), byte(seq >> 16)},
+		Units: []*gamev1.BattleUnit{
+			{
+				UnitId: fmt.Sprintf("unit_%d", seq%10),
+				Hp:     int32(100 - (seq % 100)),
+				Mp:     int32(50 + (seq % 50)),
+				Position: &gamev1.Position{
+					X: float32(seq % 100),
+					Y: float32((seq * 2) % 100),
+					Z: 0,
+				},
+				Status: gamev1.UnitStatus(seq%4 + 1),
+			},
+		},
+		Timestamp: time.Now().UnixMilli(),
+	}
+
+	// 广播给所有连接
+	s.broadcastMessage(protocol.OpBattlePush, battlePush)
 }
 
 // sendMessage 发送消息给指定连接
@@ -548,18 +829,33 @@ func (s *Server) sendMessage(conn *Connection, opcode uint16, message proto.Mess
 	}
 
 	frame := protocol.EncodeFrame(opcode, body)
+	return s.deliverFrame(conn, opcode, frame, 5*time.Second)
+}
+
+// writeFrames 按顺序写出帧，并补发乱序注入暂存的帧
+func (s *Server) writeFrames(conn *Connection, timeout time.Duration, frames ...[]byte) error {
+	conn.writeMu.Lock()
+	defer conn.writeMu.Unlock()
 
 	conn.mu.Lock()
-	defer conn.mu.Unlock()
+	held := conn.takeHeldFrame()
+	conn.mu.Unlock()
+	if held != nil {
+		frames = append(frames, held)
+	}
 
-	conn.Conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
-	err = conn.Conn.WriteMessage(websocket.BinaryMessage, frame)
-	if err == nil {
+	for _, frame := range frames {
+		conn.Conn.SetWriteDeadline(time.Now().Add(timeout))
+		if err := conn.Conn.WriteMessage(websocket.BinaryMessage, frame); err != nil {
+			return err
+		}
 		conn.Stats.MessagesSent.Add(1)
 		conn.Stats.BytesSent.Add(uint64(len(frame)))
+		s.metrics.observeSent(frame)
+		s.recordFrame(conn, "send", frame)
 	}
 
-	return err
+	return nil
 }
 
 // broadcastMessage 广播消息给所有连接
@@ -578,21 +874,15 @@ func (s *Server) broadcastMessage(opcode uint16, message proto.Message) {
 	s.connections.Range(func(key, value interface{}) bool {
 		conn := value.(*Connection)
 
-		conn.mu.Lock()
 		// 只向已认证的连接推送消息
-		if conn.PlayerID == "" {
-			conn.mu.Unlock()
+		conn.mu.RLock()
+		authenticated := conn.PlayerID != ""
+		conn.mu.RUnlock()
+		if !authenticated {
 			return true // 跳过未认证的连接
 		}
 
-		conn.Conn.SetWriteDeadline(time.Now().Add(1 * time.Second))
-		err := conn.Conn.WriteMessage(websocket.BinaryMessage, frame)
-		if err == nil {
-			conn.Stats.MessagesSent.Add(1)
-			conn.Stats.BytesSent.Add(uint64(len(frame)))
-		}
-		conn.mu.Unlock()
-
+		err := s.deliverFrame(conn, opcode, frame, 1*time.Second)
 		if err != nil {
 			log.Printf("Broadcast to %s failed: %v", conn.ID, err)
 			failedConns = append(failedConns, conn)
@@ -609,17 +899,36 @@ func (s *Server) broadcastMessage(opcode uint16, message proto.Message) {
 
 // closeConnection 关闭连接
 func (s *Server) closeConnection(conn *Connection, reason string) {
-	s.connections.Delete(conn.ID)
-	s.connCount.Add(-1)
+	s.closeConnectionWithCode(conn, websocket.CloseNormalClosure, reason)
+}
 
-	conn.mu.Lock()
+// closeConnectionWithCode 使用指定关闭码关闭连接（重复调用只计数一次）
+func (s *Server) closeConnectionWithCode(conn *Connection, code int, reason string) {
+	if _, loaded := s.connections.LoadAndDelete(conn.ID); loaded {
+		s.connCount.Add(-1)
+		s.flushHeldFrame(conn)
+		s.finishRecording(conn, code, reason)
+	}
+
+	conn.mu.RLock()
+	playerID := conn.PlayerID
+	conn.mu.RUnlock()
+	if playerID != "" {
+		s.players.CompareAndDelete(playerID, conn)
+	}
+	s.rooms.LeaveAll(conn)
+
+	if conn.queue != nil {
+		conn.queue.close()
+	}
+
+	// WriteControl和Close可与写出并发调用，不等待可能阻塞中的writeMu
 	if conn.Conn != nil {
 		conn.Conn.WriteControl(websocket.CloseMessage,
-			websocket.FormatCloseMessage(websocket.CloseNormalClosure, reason),
+			websocket.FormatCloseMessage(code, reason),
 			time.Now().Add(time.Second))
 		conn.Conn.Close()
 	}
-	conn.mu.Unlock()
 
 	select {
 	case <-conn.stopChan:
@@ -672,6 +981,10 @@ func (s *Server) handleControl(w http.ResponseWriter, r *http.Request) {
 	case "toggle_push":
 		// 这里可以添加开关推送的逻辑
 		fmt.Fprintf(w, "Push toggled")
+	case "add_fault", "remove_fault", "clear_faults", "list_faults":
+		s.handleFaultControl(w, r, action)
+	case "drain":
+		s.handleDrainControl(w, r)
 	default:
 		http.Error(w, "Unknown action", http.StatusBadRequest)
 	}
@@ -679,14 +992,69 @@ func (s *Server) handleControl(w http.ResponseWriter, r *http.Request) {
 
 // GetStats 获取服务器统计信息
 func (s *Server) GetStats() map[string]interface{} {
-	return map[string]interface{}{
+	stats := map[string]interface{}{
 		"running":             s.isRunning.Load(),
 		"uptime_seconds":      time.Since(s.startTime).Seconds(),
 		"current_connections": s.connCount.Load(),
 		"total_connections":   s.totalConnections.Load(),
 		"total_messages":      s.totalMessages.Load(),
 		"sequence_number":     s.seqGenerator.Load(),
+		"fault_rules":         len(s.faults.Rules()),
+		"faults_injected":     s.faults.InjectedCount(),
+		"rooms":               len(s.rooms.Stats()),
+		"node_id":             s.config.NodeID,
+		"draining":            s.draining.Load(),
+	}
+
+	var queued int64
+	var dropped, coalesced uint64
+	s.connections.Range(func(key, value interface{}) bool {
+		conn := value.(*Connection)
+		queued += conn.Stats.QueueDepth.Load()
+		dropped += conn.Stats.DroppedFrames.Load()
+		coalesced += conn.Stats.CoalescedFrames.Load()
+		return true
+	})
+	stats["queued_frames"] = queued
+	stats["dropped_frames"] = dropped
+	stats["coalesced_frames"] = coalesced
+
+	kicked := make(map[string]uint64)
+	for reason, count := range s.KickCounts() {
+		kicked[reason.String()] = count
+	}
+	stats["kicked_connections"] = kicked
+	stats["duplicate_login_policy"] = string(s.config.DuplicateLoginPolicy)
+
+	if s.livenessEnabled() {
+		reaped := make(map[string]uint64)
+		for reason, count := range s.ReapedCounts() {
+			reaped[string(reason)] = count
+		}
+		stats["reaped_connections"] = reaped
+		stats["zombie_connections"] = s.zombieCount()
+	}
+
+	if s.world != nil {
+		stats["world"] = s.world.GetStats()
 	}
+
+	return stats
+}
+
+// GetWorld 获取世界模拟（未启用时返回nil）
+func (s *Server) GetWorld() *world.World {
+	return s.world
+}
+
+// OnlinePlayers 获取已登录的玩家ID
+func (s *Server) OnlinePlayers() []string {
+	var players []string
+	s.players.Range(func(key, value interface{}) bool {
+		players = append(players, key.(string))
+		return true
+	})
+	return players
 }
 
 // GetConnectionStats 获取连接统计信息
@@ -0,0 +1,162 @@
+package world
+
+import (
+	"fmt"
+	"time"
+
+	"GoSlgBenchmarkTest/generated/slg/v1_1_0/combat"
+)
+
+// battleSide 战斗的一方（行军部队或城市驻军）
+type battleSide struct {
+	playerID string
+	unitID   string
+	march    *March
+	city     *City
+}
+
+// newMarchSide 以行军部队作为战斗一方
+func newMarchSide(march *March) *battleSide {
+	return &battleSide{playerID: march.PlayerID, unitID: march.ID, march: march}
+}
+
+// newCitySide 以城市驻军作为战斗一方
+func newCitySide(city *City) *battleSide {
+	return &battleSide{playerID: city.PlayerID, unitID: city.ID, city: city}
+}
+
+// troops 当前兵力
+func (s *battleSide) troops() int32 {
+	if s.march != nil {
+		return s.march.Troops
+	}
+	return s.city.Troops
+}
+
+// setTroops 设置兵力
+func (s *battleSide) setTroops(troops int32) {
+	if troops < 0 {
+		troops = 0
+	}
+	if s.march != nil {
+		s.march.Troops = troops
+	} else {
+		s.city.Troops = troops
+	}
+}
+
+// Battle 进行中的战斗
+type Battle struct {
+	ID       string
+	Attacker *battleSide
+	Defender *battleSide
+	Position Point
+	Round    int
+
+	startedAt   time.Duration
+	nextRoundAt time.Duration
+	finished    bool
+}
+
+// startBattle 开始一场战斗
+func (w *World) startBattle(attacker, defender *battleSide, position Point) *Battle {
+	w.battleCounter++
+
+	battle := &Battle{
+		ID:          fmt.Sprintf("battle_%d", w.battleCounter),
+		Attacker:    attacker,
+		Defender:    defender,
+		Position:    position,
+		startedAt:   w.gameTime,
+		nextRoundAt: w.gameTime + w.config.RoundInterval,
+	}
+
+	for _, side := range []*battleSide{attacker, defender} {
+		if side.march != nil {
+			side.march.State = MarchFighting
+			side.march.BattleID = battle.ID
+		} else {
+			side.city.UnderAttack = true
+			w.emitCityUpdate(side.city)
+		}
+	}
+
+	w.battles[battle.ID] = battle
+
+	// 推送开战时的初始状态
+	w.emitBattlePush(battle)
+	return battle
+}
+
+// resolveRound 结算一个战斗回合（双方同时造成伤亡，城市驻军享有防御加成）
+func (w *World) resolveRound(battle *Battle) {
+	battle.Round++
+	battle.nextRoundAt += w.config.RoundInterval
+
+	attackerLoss := w.casualties(battle.Defender)
+	defenderLoss := w.casualties(battle.Attacker)
+
+	battle.Attacker.setTroops(battle.Attacker.troops() - attackerLoss)
+	battle.Defender.setTroops(battle.Defender.troops() - defenderLoss)
+
+	if battle.Defender.city != nil {
+		w.emitCityUpdate(battle.Defender.city)
+	}
+
+	if battle.Attacker.troops() == 0 || battle.Defender.troops() == 0 || battle.Round >= w.config.MaxRounds {
+		battle.finished = true
+	}
+	w.emitBattlePush(battle)
+
+	if battle.finished {
+		w.finishBattle(battle)
+	}
+}
+
+// casualties 计算一方在本回合造成的伤亡
+func (w *World) casualties(source *battleSide) int32 {
+	troops := source.troops()
+	if troops <= 0 {
+		return 0
+	}
+	loss := troops * w.config.TroopAttack / 100
+	if source.city != nil {
+		loss = loss * 6 / 5 // 城防加成20%
+	}
+	if loss < 1 {
+		loss = 1
+	}
+	return loss
+}
+
+// finishBattle 结束战斗并发送战报
+func (w *World) finishBattle(battle *Battle) {
+	attackerTroops := battle.Attacker.troops()
+	defenderTroops := battle.Defender.troops()
+
+	attackerResult := combat.BattleResult_BATTLE_RESULT_DRAW
+	defenderResult := combat.BattleResult_BATTLE_RESULT_DRAW
+	switch {
+	case battle.Round >= w.config.MaxRounds && attackerTroops > 0 && defenderTroops > 0:
+		attackerResult = combat.BattleResult_BATTLE_RESULT_TIMEOUT
+		defenderResult = combat.BattleResult_BATTLE_RESULT_TIMEOUT
+	case attackerTroops > 0 && defenderTroops == 0:
+		attackerResult = combat.BattleResult_BATTLE_RESULT_VICTORY
+		defenderResult = combat.BattleResult_BATTLE_RESULT_DEFEAT
+	case defenderTroops > 0 && attackerTroops == 0:
+		attackerResult = combat.BattleResult_BATTLE_RESULT_DEFEAT
+		defenderResult = combat.BattleResult_BATTLE_RESULT_VICTORY
+	}
+
+	w.emitBattleEnd(battle, battle.Attacker, attackerResult)
+	w.emitBattleEnd(battle, battle.Defender, defenderResult)
+
+	for _, side := range []*battleSide{battle.Attacker, battle.Defender} {
+		if side.march != nil {
+			w.returnHome(side.march, battle.Position)
+		} else {
+			side.city.UnderAttack = false
+			w.emitCityUpdate(side.city)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package world
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	"GoSlgBenchmarkTest/generated/slg/v1_1_0/building"
+	"GoSlgBenchmarkTest/generated/slg/v1_1_0/combat"
+	slgcommon "GoSlgBenchmarkTest/generated/slg/v1_1_0/common"
+	"GoSlgBenchmarkTest/internal/protocol"
+	gamev1 "GoSlgBenchmarkTest/proto/game/v1"
+)
+
+// pendingPush 持锁期间产生、释放锁后发送的推送
+type pendingPush struct {
+	playerIDs []string
+	opcode    uint16
+	message   proto.Message
+}
+
+// send 记录推送并计数，实际发送由flushPushes在释放World.mu后完成
+func (w *World) send(playerIDs []string, opcode uint16, message proto.Message) {
+	w.pushesEmitted++
+	w.outbox = append(w.outbox, pendingPush{playerIDs: playerIDs, opcode: opcode, message: message})
+}
+
+// flushPushes 在不持有World.mu时按产生顺序发送待发推送，慢的发送方不会阻塞世界推进。
+// 同一时刻只有一个goroutine发送；正在发送时其他调用直接返回，由发送方接着取走新产生的推送
+func (w *World) flushPushes() {
+	for {
+		if !w.emitMu.TryLock() {
+			return
+		}
+		for {
+			w.mu.Lock()
+			pushes := w.outbox
+			w.outbox = nil
+			w.mu.Unlock()
+			if len(pushes) == 0 {
+				break
+			}
+			for _, push := range pushes {
+				w.emit(push.playerIDs, push.opcode, push.message)
+			}
+		}
+		w.emitMu.Unlock()
+
+		// 释放emitMu前后可能有新推送入队而对方TryLock失败，重新检查避免推送滞留
+		w.mu.Lock()
+		pending := len(w.outbox) > 0
+		w.mu.Unlock()
+		if !pending {
+			return
+		}
+	}
+}
+
+// nextSeq 分配推送序列号（全局单调递增，客户端按序列号去重）
+func (w *World) nextSeq() uint64 {
+	w.pushSeq++
+	return w.pushSeq
+}
+
+// emitBattlePush 向战斗双方推送当前战斗状态
+func (w *World) emitBattlePush(battle *Battle) {
+	seq := w.nextSeq()
+	units := []*gamev1.BattleUnit{
+		w.sideUnit(battle.Attacker, battle),
+		w.sideUnit(battle.Defender, battle),
+	}
+
+	push := &gamev1.BattlePush{
+		Seq:       seq,
+		BattleId:  battle.ID,
+		StateHash: stateHash(battle.ID, seq, units),
+		Units:     units,
+		Timestamp: time.Now().UnixMilli(),
+	}
+
+	w.send(battleParticipants(battle), protocol.OpBattlePush, push)
+}
+
+// sideUnit 将战斗一方转换为战斗单位
+func (w *World) sideUnit(side *battleSide, battle *Battle) *gamev1.BattleUnit {
+	status := gamev1.UnitStatus_UNIT_STATUS_ATTACKING
+	switch {
+	case side.troops() == 0:
+		status = gamev1.UnitStatus_UNIT_STATUS_DEAD
+	case battle.finished:
+		status = gamev1.UnitStatus_UNIT_STATUS_IDLE
+	}
+
+	position := battle.Position
+	if side.city != nil {
+		position = side.city.Position
+	}
+
+	return &gamev1.BattleUnit{
+		UnitId:   side.unitID,
+		Hp:       side.troops(),
+		Position: &gamev1.Position{X: float32(position.X), Y: float32(position.Y)},
+		Status:   status,
+	}
+}
+
+// emitMarchUpdate 向行军所属玩家推送行军进度（以行军ID作为战斗ID）
+func (w *World) emitMarchUpdate(march *March) {
+	seq := w.nextSeq()
+	position := march.positionAt(w.gameTime)
+	status := gamev1.UnitStatus_UNIT_STATUS_MOVING
+	switch march.State {
+	case MarchStationed, MarchDone:
+		status = gamev1.UnitStatus_UNIT_STATUS_IDLE
+	case MarchFighting:
+		status = gamev1.UnitStatus_UNIT_STATUS_ATTACKING
+	}
+	if march.Troops == 0 {
+		status = gamev1.UnitStatus_UNIT_STATUS_DEAD
+	}
+
+	units := []*gamev1.BattleUnit{{
+		UnitId:   march.ID,
+		Hp:       march.Troops,
+		Position: &gamev1.Position{X: float32(position.X), Y: float32(position.Y)},
+		Status:   status,
+	}}
+
+	push := &gamev1.BattlePush{
+		Seq:       seq,
+		BattleId:  march.ID,
+		StateHash: stateHash(march.ID, seq, units),
+		Units:     units,
+		Timestamp: time.Now().UnixMilli(),
+	}
+
+	w.send([]string{march.PlayerID}, protocol.OpBattlePush, push)
+}
+
+// emitCityUpdate 向城市所属玩家推送城市状态
+func (w *World) emitCityUpdate(city *City) {
+	status := building.CityStatus_CITY_STATUS_NORMAL
+	if city.UnderAttack {
+		status = building.CityStatus_CITY_STATUS_UNDER_ATTACK
+	}
+
+	info := &building.CityInfo{
+		CityId:    city.ID,
+		PlayerId:  city.PlayerID,
+		CityLevel: city.Level,
+		Position: &slgcommon.Position{
+			X: float32(city.Position.X),
+			Y: float32(city.Position.Y),
+		},
+		Status:       status,
+		LastUpdate:   time.Now().UnixMilli(),
+		DefensePower: city.Troops,
+	}
+
+	w.send([]string{city.PlayerID}, protocol.OpSLGCityUpdate, info)
+}
+
+// emitBattleEnd 向一方推送战报
+func (w *World) emitBattleEnd(battle *Battle, side *battleSide, result combat.BattleResult) {
+	report := &combat.BattleResponse{
+		BattleId: battle.ID,
+		Result:   result,
+		BattleUnits: []*combat.BattleUnit{
+			{UnitId: battle.Attacker.unitID, Hp: battle.Attacker.troops()},
+			{UnitId: battle.Defender.unitID, Hp: battle.Defender.troops()},
+		},
+		DurationMs: int32((w.gameTime - battle.startedAt).Milliseconds()),
+	}
+
+	w.send([]string{side.playerID}, protocol.OpSLGBattleEnd, report)
+}
+
+// battleParticipants 获取战斗涉及的玩家（去重）
+func battleParticipants(battle *Battle) []string {
+	if battle.Attacker.playerID == battle.Defender.playerID {
+		return []string{battle.Attacker.playerID}
+	}
+	return []string{battle.Attacker.playerID, battle.Defender.playerID}
+}
+
+// stateHash 计算战斗状态哈希，用于客户端一致性校验
+func stateHash(battleID string, seq uint64, units []*gamev1.BattleUnit) []byte {
+	h := sha256.New()
+	h.Write([]byte(battleID))
+
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], seq)
+	h.Write(buf[:])
+
+	for _, unit := range units {
+		h.Write([]byte(unit.UnitId))
+		binary.BigEndian.PutUint32(buf[:4], uint32(unit.Hp))
+		h.Write(buf[:4])
+	}
+
+	return h.Sum(nil)[:8]
+}
@@ -0,0 +1,623 @@
+package world
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// Terrain 地形类型
+type Terrain int
+
+const (
+	TerrainPlain    Terrain = iota // 平原
+	TerrainForest                  // 森林
+	TerrainMountain                // 山地
+)
+
+// String 实现字符串接口
+func (t Terrain) String() string {
+	switch t {
+	case TerrainPlain:
+		return "PLAIN"
+	case TerrainForest:
+		return "FOREST"
+	case TerrainMountain:
+		return "MOUNTAIN"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// moveCost 地形移动消耗倍数
+func (t Terrain) moveCost() float64 {
+	switch t {
+	case TerrainForest:
+		return 1.5
+	case TerrainMountain:
+		return 2.5
+	default:
+		return 1.0
+	}
+}
+
+// Config 世界模拟配置
+type Config struct {
+	Width         int           // 地图宽度（格）
+	Height        int           // 地图高度（格）
+	Seed          int64         // 随机种子，相同种子生成相同地图
+	TimeScale     float64       // 时间加速倍数（游戏时间/真实时间）
+	MarchSpeed    float64       // 平原行军速度（格/游戏秒）
+	InitialTroops int32         // 城市初始驻军
+	EngageRadius  float64       // 行军遭遇判定半径（格）
+	RoundInterval time.Duration // 战斗回合间隔（游戏时间）
+	MaxRounds     int           // 单场战斗最大回合数
+	TroopAttack   int32         // 每百兵力每回合造成的伤亡
+}
+
+// DefaultConfig 返回默认配置
+func DefaultConfig() *Config {
+	return &Config{
+		Width:         64,
+		Height:        64,
+		Seed:          20240101,
+		TimeScale:     60, // 1秒真实时间 = 1分钟游戏时间
+		MarchSpeed:    0.05,
+		InitialTroops: 1000,
+		EngageRadius:  0.5,
+		RoundInterval: 10 * time.Second,
+		MaxRounds:     30,
+		TroopAttack:   10,
+	}
+}
+
+// Emitter 推送回调，由宿主服务器负责把消息发送给受影响的玩家
+type Emitter func(playerIDs []string, opcode uint16, message proto.Message)
+
+// Point 地图坐标（格，可为小数）
+type Point struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+// distance 计算两点距离
+func (p Point) distance(o Point) float64 {
+	return math.Hypot(p.X-o.X, p.Y-o.Y)
+}
+
+// lerp 线性插值
+func (p Point) lerp(o Point, t float64) Point {
+	return Point{X: p.X + (o.X-p.X)*t, Y: p.Y + (o.Y-p.Y)*t}
+}
+
+// Tile 地块
+type Tile struct {
+	X       int     `json:"x"`
+	Y       int     `json:"y"`
+	Terrain Terrain `json:"terrain"`
+	CityID  string  `json:"city_id,omitempty"`
+}
+
+// City 玩家城市
+type City struct {
+	ID          string `json:"id"`
+	PlayerID    string `json:"player_id"`
+	Position    Point  `json:"position"`
+	Level       int32  `json:"level"`
+	Troops      int32  `json:"troops"`
+	UnderAttack bool   `json:"under_attack"`
+}
+
+// MarchState 行军状态
+type MarchState int
+
+const (
+	MarchMarching  MarchState = iota // 行军中
+	MarchFighting                    // 战斗中
+	MarchStationed                   // 驻扎
+	MarchReturning                   // 回城中
+	MarchDone                        // 已结束（回城或全灭）
+)
+
+// String 实现字符串接口
+func (s MarchState) String() string {
+	switch s {
+	case MarchMarching:
+		return "MARCHING"
+	case MarchFighting:
+		return "FIGHTING"
+	case MarchStationed:
+		return "STATIONED"
+	case MarchReturning:
+		return "RETURNING"
+	case MarchDone:
+		return "DONE"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// March 行军队列
+type March struct {
+	ID           string        `json:"id"`
+	PlayerID     string        `json:"player_id"`
+	From         Point         `json:"from"`
+	To           Point         `json:"to"`
+	Troops       int32         `json:"troops"`
+	TargetCityID string        `json:"target_city_id,omitempty"`
+	DepartAt     time.Duration `json:"depart_at"` // 出发的游戏时间
+	ArriveAt     time.Duration `json:"arrive_at"` // 预计到达的游戏时间
+	State        MarchState    `json:"state"`
+	BattleID     string        `json:"battle_id,omitempty"`
+}
+
+// positionAt 计算指定游戏时间的位置
+func (m *March) positionAt(now time.Duration) Point {
+	if m.ArriveAt <= m.DepartAt || now >= m.ArriveAt {
+		return m.To
+	}
+	if now <= m.DepartAt {
+		return m.From
+	}
+	t := float64(now-m.DepartAt) / float64(m.ArriveAt-m.DepartAt)
+	return m.From.lerp(m.To, t)
+}
+
+// Stats 世界统计
+type Stats struct {
+	GameTime        time.Duration `json:"game_time"`
+	Cities          int           `json:"cities"`
+	ActiveMarches   int           `json:"active_marches"`
+	ActiveBattles   int           `json:"active_battles"`
+	FinishedBattles uint64        `json:"finished_battles"`
+	PushesEmitted   uint64        `json:"pushes_emitted"`
+}
+
+// World SLG世界模拟
+type World struct {
+	config *Config
+	emit   Emitter
+
+	tiles      [][]Tile
+	cities     map[string]*City  // 城市ID -> 城市
+	playerCity map[string]string // 玩家ID -> 城市ID
+	marches    map[string]*March
+	battles    map[string]*Battle
+
+	gameTime time.Duration // 自世界创建以来流逝的游戏时间
+	lastTick time.Time
+	rng      *rand.Rand
+
+	marchCounter    uint64
+	battleCounter   uint64
+	finishedBattles uint64
+	pushesEmitted   uint64
+	pushSeq         uint64
+
+	outbox []pendingPush // 持锁期间产生、尚未发送的推送
+
+	mu     sync.Mutex
+	emitMu sync.Mutex // 串行发送推送，保证推送按序列号顺序到达
+}
+
+// New 创建世界模拟
+func New(config *Config, emit Emitter) *World {
+	if config == nil {
+		config = DefaultConfig()
+	}
+	if emit == nil {
+		emit = func([]string, uint16, proto.Message) {}
+	}
+
+	w := &World{
+		config:     config,
+		emit:       emit,
+		cities:     make(map[string]*City),
+		playerCity: make(map[string]string),
+		marches:    make(map[string]*March),
+		battles:    make(map[string]*Battle),
+		rng:        rand.New(rand.NewSource(config.Seed)),
+	}
+
+	w.generateMap()
+	return w
+}
+
+// generateMap 根据种子生成地形
+func (w *World) generateMap() {
+	w.tiles = make([][]Tile, w.config.Height)
+	for y := 0; y < w.config.Height; y++ {
+		w.tiles[y] = make([]Tile, w.config.Width)
+		for x := 0; x < w.config.Width; x++ {
+			terrain := TerrainPlain
+			switch r := w.rng.Intn(100); {
+			case r < 10:
+				terrain = TerrainMountain
+			case r < 30:
+				terrain = TerrainForest
+			}
+			w.tiles[y][x] = Tile{X: x, Y: y, Terrain: terrain}
+		}
+	}
+}
+
+// tileAt 获取坐标所在地块
+func (w *World) tileAt(p Point) *Tile {
+	x := int(math.Floor(p.X))
+	y := int(math.Floor(p.Y))
+	if x < 0 || y < 0 || y >= len(w.tiles) || x >= len(w.tiles[y]) {
+		return nil
+	}
+	return &w.tiles[y][x]
+}
+
+// AddPlayer 为玩家创建城市（重复调用返回已有城市）
+func (w *World) AddPlayer(playerID string) *City {
+	defer w.flushPushes()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if cityID, ok := w.playerCity[playerID]; ok {
+		city := w.cities[cityID]
+		w.emitCityUpdate(city)
+		return city
+	}
+
+	// 寻找一个没有城市的平原地块
+	var tile *Tile
+	for attempt := 0; attempt < w.config.Width*w.config.Height; attempt++ {
+		candidate := &w.tiles[w.rng.Intn(w.config.Height)][w.rng.Intn(w.config.Width)]
+		if candidate.CityID == "" && candidate.Terrain == TerrainPlain {
+			tile = candidate
+			break
+		}
+	}
+	if tile == nil {
+		return nil
+	}
+
+	city := &City{
+		ID:       fmt.Sprintf("city_%d_%d", tile.X, tile.Y),
+		PlayerID: playerID,
+		Position: Point{X: float64(tile.X) + 0.5, Y: float64(tile.Y) + 0.5},
+		Level:    1,
+		Troops:   w.config.InitialTroops,
+	}
+	tile.CityID = city.ID
+	w.cities[city.ID] = city
+	w.playerCity[playerID] = city.ID
+
+	w.emitCityUpdate(city)
+	return city
+}
+
+// GetCity 获取玩家城市
+func (w *World) GetCity(playerID string) (*City, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	cityID, ok := w.playerCity[playerID]
+	if !ok {
+		return nil, false
+	}
+	city := *w.cities[cityID]
+	return &city, true
+}
+
+// IssueMarch 下达行军命令，troops<=0时派出一半驻军
+func (w *World) IssueMarch(playerID string, target Point, troops int32) (*March, error) {
+	defer w.flushPushes()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	cityID, ok := w.playerCity[playerID]
+	if !ok {
+		return nil, fmt.Errorf("player %s has no city", playerID)
+	}
+	city := w.cities[cityID]
+
+	if w.tileAt(target) == nil {
+		return nil, fmt.Errorf("target (%.1f, %.1f) is out of map", target.X, target.Y)
+	}
+
+	if troops <= 0 {
+		troops = city.Troops / 2
+	}
+	if troops <= 0 || troops > city.Troops {
+		return nil, fmt.Errorf("not enough troops: have %d, want %d", city.Troops, troops)
+	}
+
+	city.Troops -= troops
+	w.marchCounter++
+
+	march := &March{
+		ID:       fmt.Sprintf("march_%d", w.marchCounter),
+		PlayerID: playerID,
+		From:     city.Position,
+		To:       target,
+		Troops:   troops,
+		DepartAt: w.gameTime,
+		State:    MarchMarching,
+	}
+	if tile := w.tileAt(target); tile.CityID != "" && tile.CityID != cityID {
+		march.TargetCityID = tile.CityID
+		march.To = w.cities[tile.CityID].Position
+	}
+	// 目标吸附到城市中心后再计算耗时
+	march.ArriveAt = w.gameTime + w.travelTime(march.From, march.To)
+
+	w.marches[march.ID] = march
+	w.emitCityUpdate(city)
+	w.emitMarchUpdate(march)
+
+	copied := *march
+	return &copied, nil
+}
+
+// IssueAttack 向目标城市发起进攻
+func (w *World) IssueAttack(playerID, targetCityID string, troops int32) (*March, error) {
+	w.mu.Lock()
+	target, ok := w.cities[targetCityID]
+	var position Point
+	if ok {
+		position = target.Position
+	}
+	w.mu.Unlock()
+
+	if !ok {
+		return nil, fmt.Errorf("city %s not found", targetCityID)
+	}
+	return w.IssueMarch(playerID, position, troops)
+}
+
+// travelTime 沿直线按地形消耗计算行军耗时（游戏时间）
+func (w *World) travelTime(from, to Point) time.Duration {
+	distance := from.distance(to)
+	if distance == 0 || w.config.MarchSpeed <= 0 {
+		return 0
+	}
+
+	// 每格采样一次地形消耗
+	samples := int(math.Ceil(distance))
+	var cost float64
+	for i := 0; i < samples; i++ {
+		p := from.lerp(to, (float64(i)+0.5)/float64(samples))
+		if tile := w.tileAt(p); tile != nil {
+			cost += tile.Terrain.moveCost()
+		} else {
+			cost += 1
+		}
+	}
+	avgCost := cost / float64(samples)
+
+	seconds := distance * avgCost / w.config.MarchSpeed
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// Tick 根据真实时间推进世界（受TimeScale加速）
+func (w *World) Tick(now time.Time) {
+	w.mu.Lock()
+	if w.lastTick.IsZero() {
+		w.lastTick = now
+		w.mu.Unlock()
+		return
+	}
+	realDelta := now.Sub(w.lastTick)
+	w.lastTick = now
+	w.mu.Unlock()
+
+	if realDelta <= 0 {
+		return
+	}
+	w.Advance(time.Duration(float64(realDelta) * w.config.TimeScale))
+}
+
+// Advance 推进指定游戏时间（确定性，测试可直接调用）
+func (w *World) Advance(gameDelta time.Duration) {
+	defer w.flushPushes()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	target := w.gameTime + gameDelta
+
+	// 按战斗回合粒度推进，保证长时间跳跃时的结算顺序与逐步推进一致
+	step := w.config.RoundInterval
+	if step <= 0 {
+		step = time.Second
+	}
+	for w.gameTime < target {
+		next := w.gameTime + step
+		if next > target {
+			next = target
+		}
+		w.gameTime = next
+		w.step()
+	}
+}
+
+// step 执行一次模拟步进
+func (w *World) step() {
+	marchIDs := w.sortedMarchIDs()
+
+	// 1. 处理到达
+	for _, id := range marchIDs {
+		march := w.marches[id]
+		if (march.State == MarchMarching || march.State == MarchReturning) && w.gameTime >= march.ArriveAt {
+			w.handleArrival(march)
+		}
+	}
+
+	// 2. 行军途中遭遇
+	w.detectEncounters(marchIDs)
+
+	// 3. 结算战斗回合
+	for _, id := range w.sortedBattleIDs() {
+		battle := w.battles[id]
+		for !battle.finished && w.gameTime >= battle.nextRoundAt {
+			w.resolveRound(battle)
+		}
+		if battle.finished {
+			delete(w.battles, id)
+			w.finishedBattles++
+		}
+	}
+
+	// 4. 推送行军进度并清理已结束的行军
+	for _, id := range marchIDs {
+		march, ok := w.marches[id]
+		if !ok {
+			continue
+		}
+		switch march.State {
+		case MarchMarching, MarchReturning:
+			w.emitMarchUpdate(march)
+		case MarchDone:
+			delete(w.marches, id)
+		}
+	}
+}
+
+// handleArrival 处理行军到达
+func (w *World) handleArrival(march *March) {
+	if march.State == MarchReturning {
+		if cityID, ok := w.playerCity[march.PlayerID]; ok {
+			city := w.cities[cityID]
+			city.Troops += march.Troops
+			w.emitCityUpdate(city)
+		}
+		march.State = MarchDone
+		w.emitMarchUpdate(march)
+		return
+	}
+
+	if march.TargetCityID != "" {
+		if city, ok := w.cities[march.TargetCityID]; ok && city.PlayerID != march.PlayerID {
+			w.startBattle(newMarchSide(march), newCitySide(city), city.Position)
+			return
+		}
+	}
+
+	march.State = MarchStationed
+	w.emitMarchUpdate(march)
+}
+
+// detectEncounters 检测不同玩家行军之间的遭遇
+func (w *World) detectEncounters(marchIDs []string) {
+	for i, idA := range marchIDs {
+		a, ok := w.marches[idA]
+		if !ok || !a.canEngage() {
+			continue
+		}
+		for _, idB := range marchIDs[i+1:] {
+			b, ok := w.marches[idB]
+			if !ok || !b.canEngage() || a.PlayerID == b.PlayerID {
+				continue
+			}
+			pa := a.positionAt(w.gameTime)
+			pb := b.positionAt(w.gameTime)
+			if pa.distance(pb) <= w.config.EngageRadius {
+				a.freezeAt(pa)
+				b.freezeAt(pb)
+				w.startBattle(newMarchSide(a), newMarchSide(b), pa.lerp(pb, 0.5))
+				break
+			}
+		}
+	}
+}
+
+// canEngage 是否可以与其他行军遭遇
+func (m *March) canEngage() bool {
+	return m.State == MarchMarching || m.State == MarchStationed
+}
+
+// freezeAt 停在当前位置
+func (m *March) freezeAt(p Point) {
+	m.From = p
+	m.To = p
+	m.ArriveAt = m.DepartAt
+}
+
+// returnHome 幸存部队回城
+func (w *World) returnHome(march *March, from Point) {
+	cityID, ok := w.playerCity[march.PlayerID]
+	if !ok || march.Troops <= 0 {
+		march.State = MarchDone
+		return
+	}
+	home := w.cities[cityID].Position
+	march.From = from
+	march.To = home
+	march.DepartAt = w.gameTime
+	march.ArriveAt = w.gameTime + w.travelTime(from, home)
+	march.State = MarchReturning
+	march.BattleID = ""
+	march.TargetCityID = ""
+}
+
+// GetStats 获取世界统计
+func (w *World) GetStats() Stats {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return Stats{
+		GameTime:        w.gameTime,
+		Cities:          len(w.cities),
+		ActiveMarches:   len(w.marches),
+		ActiveBattles:   len(w.battles),
+		FinishedBattles: w.finishedBattles,
+		PushesEmitted:   w.pushesEmitted,
+	}
+}
+
+// GameTime 获取当前游戏时间
+func (w *World) GameTime() time.Duration {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.gameTime
+}
+
+// GetMarch 获取行军快照
+func (w *World) GetMarch(marchID string) (*March, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	march, ok := w.marches[marchID]
+	if !ok {
+		return nil, false
+	}
+	copied := *march
+	return &copied, true
+}
+
+// sortedMarchIDs 按ID排序，保证结算顺序确定
+func (w *World) sortedMarchIDs() []string {
+	ids := make([]string, 0, len(w.marches))
+	for id := range w.marches {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return lessID(ids[i], ids[j]) })
+	return ids
+}
+
+// sortedBattleIDs 按ID排序，保证结算顺序确定
+func (w *World) sortedBattleIDs() []string {
+	ids := make([]string, 0, len(w.battles))
+	for id := range w.battles {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return lessID(ids[i], ids[j]) })
+	return ids
+}
+
+// lessID 先按长度再按字典序比较，使 march_2 排在 march_10 之前
+func lessID(a, b string) bool {
+	if len(a) != len(b) {
+		return len(a) < len(b)
+	}
+	return a < b
+}
@@ -15,11 +15,19 @@ import (
 	"github.com/cenkalti/backoff/v4"
 	"github.com/gorilla/websocket"
 	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
 
 	"GoSlgBenchmarkTest/internal/protocol"
+	"GoSlgBenchmarkTest/internal/session"
 	gamev1 "GoSlgBenchmarkTest/proto/game/v1"
 )
 
+// ErrLoginRejected 服务器拒绝登录（如令牌无效或过期）
+var ErrLoginRejected = errors.New("login rejected")
+
+// ErrKicked 被服务器踢下线（如同一玩家在其他连接登录），客户端不会自动重连
+var ErrKicked = errors.New("kicked by server")
+
 // ClientState 客户端连接状态
 type ClientState int32
 
@@ -29,6 +37,7 @@ const (
 	StateConnected
 	StateReconnecting
 	StateClosed
+	StateKicked // 被服务器踢下线，不再自动重连，只能关闭
 )
 
 func (s ClientState) String() string {
@@ -43,6 +52,8 @@ func (s ClientState) String() string {
 		return "RECONNECTING"
 	case StateClosed:
 		return "CLOSED"
+	case StateKicked:
+		return "KICKED"
 	default:
 		return "UNKNOWN"
 	}
@@ -70,6 +81,10 @@ type ClientConfig struct {
 	MaxReconnectTries int
 	EnableCompression bool
 	UserAgent         string
+
+	// 慢速消费者模拟：每处理一条消息后休眠，配合较小的TCP接收缓冲区可快速对服务端形成背压
+	SlowReadDelay    time.Duration
+	SocketReadBuffer int // TCP接收缓冲区字节数，0表示系统默认
 }
 
 // DefaultClientConfig 返回默认配置
@@ -110,6 +125,9 @@ type Client struct {
 	// 序列号管理（用于消息去重）
 	lastSeq atomic.Uint64
 
+	// 登录后服务器分配的玩家ID
+	playerID atomic.Value // string
+
 	// 心跳和RTT统计
 	lastPingSeq  atomic.Int32
 	lastPingTime atomic.Int64 // unix nano
@@ -118,9 +136,19 @@ type Client struct {
 	// 重连控制
 	reconnectCount atomic.Int32
 	reconnects     atomic.Int32 // 重连次数统计
+	lastCloseCode  atomic.Int32 // 最近一次服务器关闭连接时的关闭码
 
 	// 帧解码器
 	frameDecoder *protocol.FrameDecoder
+
+	// 会话录制器（可选），记录收发的原始帧
+	recorder atomic.Pointer[session.SessionRecorder]
+
+	// 静默模式：模拟无FIN消失的客户端
+	silent atomic.Bool
+
+	// 最近一次被踢下线的原因码，0表示未被踢
+	kickReason atomic.Int32
 }
 
 // New 创建新的WebSocket客户端
@@ -132,6 +160,18 @@ func New(config *ClientConfig) *Client {
 	dialer := *websocket.DefaultDialer
 	dialer.HandshakeTimeout = config.HandshakeTimeout
 	dialer.EnableCompression = config.EnableCompression
+	if config.SocketReadBuffer > 0 {
+		dialer.NetDialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			conn, err := (&net.Dialer{}).DialContext(ctx, network, addr)
+			if err != nil {
+				return nil, err
+			}
+			if tcpConn, ok := conn.(*net.TCPConn); ok {
+				tcpConn.SetReadBuffer(config.SocketReadBuffer)
+			}
+			return conn, nil
+		}
+	}
 
 	client := &Client{
 		config:        config,
@@ -160,6 +200,11 @@ func (c *Client) SetRTTHandler(handler RTTHandler) {
 	c.onRTT = handler
 }
 
+// SetRecorder 设置会话录制器，之后收发的每一帧都会被记录；传nil停止记录
+func (c *Client) SetRecorder(recorder *session.SessionRecorder) {
+	c.recorder.Store(recorder)
+}
+
 // Connect 连接到服务器
 func (c *Client) Connect(ctx context.Context) error {
 	log.Printf("🚀 Starting connection process...")
@@ -170,7 +215,11 @@ func (c *Client) Connect(ctx context.Context) error {
 	log.Printf("🔗 Attempting to connect...")
 	if err := c.doConnect(ctx); err != nil {
 		log.Printf("❌ Connection failed: %v", err)
-		c.setState(StateDisconnected)
+		if errors.Is(err, ErrKicked) {
+			c.setState(StateKicked)
+		} else {
+			c.setState(StateDisconnected)
+		}
 		return err
 	}
 
@@ -206,6 +255,10 @@ func (c *Client) doConnect(ctx context.Context) error {
 	}()
 	log.Printf("✅ WebSocket dial successful, response status: %s", resp.Status)
 
+	conn.SetPingHandler(func(appData string) error {
+		return c.handlePing(conn, appData)
+	})
+
 	c.mu.Lock()
 	c.conn = conn
 	c.mu.Unlock()
@@ -237,6 +290,17 @@ func (c *Client) doLogin(ctx context.Context) error {
 		return fmt.Errorf("read login response failed: %w", err)
 	}
 
+	if opcode == protocol.OpKick {
+		return c.kickError(message)
+	}
+
+	if opcode == protocol.OpError {
+		if errResp, ok := message.(*gamev1.ErrorResp); ok {
+			return fmt.Errorf("%w: code=%d %s", ErrLoginRejected, errResp.ErrorCode, errResp.ErrorMessage)
+		}
+		return ErrLoginRejected
+	}
+
 	if opcode != protocol.OpLoginResp {
 		return fmt.Errorf("unexpected opcode for login response: %d", opcode)
 	}
@@ -250,6 +314,15 @@ func (c *Client) doLogin(ctx context.Context) error {
 		return fmt.Errorf("login failed: player_id=%s", loginResp.PlayerId)
 	}
 
+	c.playerID.Store(loginResp.PlayerId)
+
+	// 清除握手阶段设置的读超时，避免空闲连接在推送间隙超时
+	c.mu.RLock()
+	if c.conn != nil {
+		c.conn.SetReadDeadline(time.Time{})
+	}
+	c.mu.RUnlock()
+
 	log.Printf("Login successful: player_id=%s, session_id=%s",
 		loginResp.PlayerId, loginResp.SessionId)
 	log.Printf("Client login completed, connection should be stable now")
@@ -261,7 +334,8 @@ func (c *Client) doLogin(ctx context.Context) error {
 func (c *Client) Close() error {
 	if !c.compareAndSwapState(StateConnected, StateClosed) &&
 		!c.compareAndSwapState(StateReconnecting, StateClosed) &&
-		!c.compareAndSwapState(StateDisconnected, StateClosed) {
+		!c.compareAndSwapState(StateDisconnected, StateClosed) &&
+		!c.compareAndSwapState(StateKicked, StateClosed) {
 		return nil // 已经关闭
 	}
 
@@ -288,6 +362,16 @@ func (c *Client) SendAction(action *gamev1.PlayerAction) error {
 	return c.sendMessage(protocol.OpPlayerAction, action)
 }
 
+// JoinRoom 请求加入房间（如 battle:xxx、alliance:xxx、region:x_y），结果以 OpRoomResp 或 OpError 推送返回
+func (c *Client) JoinRoom(roomID string) error {
+	return c.sendMessage(protocol.OpRoomJoin, wrapperspb.String(roomID))
+}
+
+// LeaveRoom 请求离开房间
+func (c *Client) LeaveRoom(roomID string) error {
+	return c.sendMessage(protocol.OpRoomLeave, wrapperspb.String(roomID))
+}
+
 // sendMessage 发送protobuf消息
 func (c *Client) sendMessage(opcode uint16, message proto.Message) error {
 	body, err := proto.Marshal(message)
@@ -310,7 +394,19 @@ func (c *Client) sendMessage(opcode uint16, message proto.Message) error {
 	defer c.writeMu.Unlock()
 
 	conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
-	return conn.WriteMessage(websocket.BinaryMessage, frame)
+	if err := conn.WriteMessage(websocket.BinaryMessage, frame); err != nil {
+		return err
+	}
+
+	c.recordFrame("send", frame, opcode, body)
+	return nil
+}
+
+// recordFrame 将帧写入会话录制器
+func (c *Client) recordFrame(direction string, frame []byte, opcode uint16, body []byte) {
+	if recorder := c.recorder.Load(); recorder != nil {
+		recorder.RecordMessage(direction, frame, opcode, body, protocol.MessageSequence(opcode, body))
+	}
 }
 
 // readMessage 读取单个消息
@@ -342,6 +438,7 @@ func (c *Client) readMessage(ctx context.Context) (uint16, proto.Message, error)
 	if err != nil {
 		return 0, nil, fmt.Errorf("decode frame failed: %w", err)
 	}
+	c.recordFrame("receive", rawData, opcode, body)
 
 	message, err := c.unmarshalMessage(opcode, body)
 	if err != nil {
@@ -353,20 +450,8 @@ func (c *Client) readMessage(ctx context.Context) (uint16, proto.Message, error)
 
 // unmarshalMessage 根据操作码反序列化消息
 func (c *Client) unmarshalMessage(opcode uint16, body []byte) (proto.Message, error) {
-	var message proto.Message
-
-	switch opcode {
-	case protocol.OpLoginResp:
-		message = &gamev1.LoginResp{}
-	case protocol.OpHeartbeatResp:
-		message = &gamev1.HeartbeatResp{}
-	case protocol.OpBattlePush:
-		message = &gamev1.BattlePush{}
-	case protocol.OpActionResp:
-		message = &gamev1.PlayerAction{} // 这里应该定义专门的响应消息
-	case protocol.OpError:
-		message = &gamev1.ErrorResp{}
-	default:
+	message := protocol.NewMessage(opcode)
+	if message == nil {
 		return nil, fmt.Errorf("unknown opcode: %d", opcode)
 	}
 
@@ -393,10 +478,10 @@ func (c *Client) heartbeatLoop() {
 			return
 		case <-ticker.C:
 			// 检查客户端是否正在关闭
-			if c.getState() == StateClosed {
+			if state := c.getState(); state == StateClosed || state == StateKicked {
 				return
 			}
-			if c.getState() == StateConnected {
+			if c.getState() == StateConnected && !c.silent.Load() {
 				c.sendHeartbeat()
 				c.checkPing()
 			}
@@ -454,15 +539,25 @@ func (c *Client) readLoop() {
 		default:
 			state := c.getState()
 			if state != StateConnected {
-				// 如果已经关闭或正在关闭，不触发重连
-				if state == StateClosed {
+				// 如果已经关闭或被踢下线，不触发重连
+				if state == StateClosed || state == StateKicked {
 					return
 				}
 				time.Sleep(100 * time.Millisecond)
 				continue
 			}
 
+			// 静默模式下不再读取，服务器的推送和ping都积压在socket缓冲区中
+			if c.silent.Load() {
+				time.Sleep(50 * time.Millisecond)
+				continue
+			}
+
 			opcode, message, err := c.readMessage(context.Background())
+			if c.silent.Load() {
+				// 进入静默模式前已阻塞的读取：已经"消失"的客户端对结果毫无反应，也不重连
+				continue
+			}
 			if err != nil {
 				// 检查是否是网络错误而不是超时
 				if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
@@ -476,6 +571,17 @@ func (c *Client) readLoop() {
 					return
 				}
 
+				var closeErr *websocket.CloseError
+				if errors.As(err, &closeErr) {
+					c.lastCloseCode.Store(int32(closeErr.Code))
+					if closeErr.Code == protocol.CloseKicked {
+						// 踢下线消息丢失时以关闭码为准
+						log.Printf("Kicked by server: %s", closeErr.Text)
+						c.compareAndSwapState(StateConnected, StateKicked)
+						return
+					}
+				}
+
 				// 检查错误是否是连接关闭相关的
 				errStr := err.Error()
 				if strings.Contains(errStr, "use of closed network connection") ||
@@ -492,13 +598,47 @@ func (c *Client) readLoop() {
 			}
 
 			c.handleMessage(opcode, message)
+
+			if c.config.SlowReadDelay > 0 {
+				time.Sleep(c.config.SlowReadDelay)
+			}
 		}
 	}
 }
 
+// handlePing 应答服务器的WebSocket ping，静默模式下丢弃
+func (c *Client) handlePing(conn *websocket.Conn, appData string) error {
+	if c.silent.Load() {
+		return nil
+	}
+
+	err := conn.WriteControl(websocket.PongMessage, []byte(appData), time.Now().Add(time.Second))
+	if err == websocket.ErrCloseSent {
+		return nil
+	}
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		return nil
+	}
+	return err
+}
+
+// GoSilent 进入静默模式，模拟移动网络掉线等无FIN消失的客户端：
+// 停止发送心跳、不再应答ping、不再读取消息，但TCP连接保持打开，不会触发重连
+func (c *Client) GoSilent() {
+	c.silent.Store(true)
+	log.Printf("🔇 Client %s went silent", c.PlayerID())
+}
+
+// IsSilent 是否处于静默模式
+func (c *Client) IsSilent() bool {
+	return c.silent.Load()
+}
+
 // handleMessage 处理接收到的消息
 func (c *Client) handleMessage(opcode uint16, message proto.Message) {
 	switch opcode {
+	case protocol.OpKick:
+		c.handleKick(message)
 	case protocol.OpHeartbeatResp:
 		c.handleHeartbeatResp(message.(*gamev1.HeartbeatResp))
 	case protocol.OpBattlePush:
@@ -510,6 +650,27 @@ func (c *Client) handleMessage(opcode uint16, message proto.Message) {
 	}
 }
 
+// handleKick 处理踢下线消息：进入KICKED状态，服务器随后关闭连接
+func (c *Client) handleKick(message proto.Message) {
+	err := c.kickError(message)
+	log.Printf("⛔ %v", err)
+	c.compareAndSwapState(StateConnected, StateKicked)
+
+	if c.onPush != nil {
+		c.onPush(protocol.OpKick, message)
+	}
+}
+
+// kickError 记录踢下线原因并转换为错误
+func (c *Client) kickError(message proto.Message) error {
+	kick, ok := message.(*gamev1.ErrorResp)
+	if !ok {
+		return ErrKicked
+	}
+	c.kickReason.Store(kick.ErrorCode)
+	return fmt.Errorf("%w: %s (%s)", ErrKicked, protocol.KickReason(kick.ErrorCode), kick.ErrorMessage)
+}
+
 // handleHeartbeatResp 处理心跳响应
 func (c *Client) handleHeartbeatResp(resp *gamev1.HeartbeatResp) {
 	pingTime := time.Unix(0, c.lastPingTime.Load())
@@ -586,7 +747,7 @@ func (c *Client) doReconnect() {
 	count := c.reconnectCount.Add(1)
 	if count > int32(c.config.MaxReconnectTries) {
 		log.Printf("Max reconnect tries exceeded, giving up")
-		c.setState(StateDisconnected)
+		c.compareAndSwapState(StateReconnecting, StateDisconnected)
 		return
 	}
 
@@ -607,15 +768,36 @@ func (c *Client) doReconnect() {
 
 	ctx := context.Background()
 	err := backoff.Retry(func() error {
-		return c.doConnect(ctx)
+		if c.getState() == StateClosed {
+			return backoff.Permanent(errors.New("client closed"))
+		}
+		if err := c.doConnect(ctx); err != nil {
+			if errors.Is(err, ErrKicked) {
+				// 重连时被拒绝登录，不再重试
+				return backoff.Permanent(err)
+			}
+			return err
+		}
+		return nil
 	}, backOff)
 
-	if err != nil {
+	if errors.Is(err, ErrKicked) {
+		log.Printf("Reconnect rejected: %v", err)
+		c.compareAndSwapState(StateReconnecting, StateKicked)
+	} else if err != nil {
 		log.Printf("Reconnect failed: %v", err)
-		c.setState(StateDisconnected)
+		c.compareAndSwapState(StateReconnecting, StateDisconnected)
+	} else if !c.compareAndSwapState(StateReconnecting, StateConnected) {
+		// 重连期间客户端已被关闭，丢弃新建立的连接
+		log.Printf("Client closed during reconnect, dropping new connection")
+		c.mu.Lock()
+		if c.conn != nil {
+			c.conn.Close()
+			c.conn = nil
+		}
+		c.mu.Unlock()
 	} else {
 		log.Printf("Reconnected successfully")
-		c.setState(StateConnected)
 		c.reconnectCount.Store(0) // 重置重连计数
 		c.incrReconnect()         // 增加重连成功计数
 	}
@@ -659,6 +841,27 @@ func (c *Client) incrReconnect() {
 	c.reconnects.Add(1)
 }
 
+// IsKicked 是否已被服务器踢下线
+func (c *Client) IsKicked() bool {
+	return c.getState() == StateKicked
+}
+
+// KickReason 最近一次被踢下线的原因，未被踢时返回0
+func (c *Client) KickReason() protocol.KickReason {
+	return protocol.KickReason(c.kickReason.Load())
+}
+
+// LastCloseCode 获取最近一次服务器关闭连接时的关闭码（如排空时的1012），未收到过时为0
+func (c *Client) LastCloseCode() int {
+	return int(c.lastCloseCode.Load())
+}
+
+// PlayerID 获取服务器分配的玩家ID（未登录时为空）
+func (c *Client) PlayerID() string {
+	playerID, _ := c.playerID.Load().(string)
+	return playerID
+}
+
 // setLastSeq 设置最后序列号（线程安全）
 func (c *Client) setLastSeq(v uint64) {
 	c.lastSeq.Store(v)
@@ -676,6 +879,9 @@ func (c *Client) GetStats() map[string]interface{} {
 		"last_seq":        c.lastSeq.Load(),
 		"reconnect_count": c.reconnectCount.Load(),
 		"reconnects":      c.reconnects.Load(),
+		"last_close_code": c.lastCloseCode.Load(),
+		"silent":          c.silent.Load(),
+		"kick_reason":     c.kickReason.Load(),
 		"avg_rtt_ms":      time.Duration(c.avgRTT.Load()).Milliseconds(),
 	}
 }
@@ -18,4 +18,17 @@ WHERE session_id = $1 AND direction = $2
 ORDER BY timestamp DESC;
 
 -- name: CountSessionMessages :one
-SELECT COUNT(*) FROM session_messages WHERE session_id = $1;
\ No newline at end of file
+SELECT COUNT(*) FROM session_messages WHERE session_id = $1;
+
+-- name: CopySessionMessages :copyfrom
+INSERT INTO session_messages (
+    session_id, direction, opcode, message_size, body_size,
+    sequence_num, message_hash, raw_data, timestamp
+) VALUES (
+    $1, $2, $3, $4, $5, $6, $7, $8, $9
+);
+
+-- name: ListSessionMessages :many
+SELECT * FROM session_messages
+WHERE session_id = $1
+ORDER BY id;
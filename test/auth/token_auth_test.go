@@ -0,0 +1,363 @@
+package auth_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+
+	"GoSlgBenchmarkTest/internal/auth"
+	"GoSlgBenchmarkTest/internal/config"
+	"GoSlgBenchmarkTest/internal/grpcserver"
+	"GoSlgBenchmarkTest/internal/httpserver"
+	"GoSlgBenchmarkTest/internal/testserver"
+	"GoSlgBenchmarkTest/internal/testutil"
+	"GoSlgBenchmarkTest/internal/wsclient"
+	gamev1 "GoSlgBenchmarkTest/proto/game/v1"
+)
+
+// fakeClock 可手动拨动的时钟
+type fakeClock struct {
+	now time.Time
+	mu  sync.Mutex
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
+
+// newTestAuthenticator 创建使用假时钟的认证器
+func newTestAuthenticator() (*auth.Authenticator, *fakeClock) {
+	clock := &fakeClock{now: time.Unix(1_700_000_000, 0)}
+	cfg := auth.DefaultConfig()
+	cfg.Secret = []byte("auth-test-secret")
+	cfg.AccessTTL = time.Minute
+	cfg.RefreshTTL = time.Hour
+	cfg.Clock = clock.Now
+	return auth.New(cfg), clock
+}
+
+// TestTokenIssueAndVerify 测试令牌签发、校验以及JWT兼容的载荷
+func TestTokenIssueAndVerify(t *testing.T) {
+	authenticator, clock := newTestAuthenticator()
+
+	token, err := authenticator.Issue("player_1001", "alice")
+	require.NoError(t, err)
+
+	claims, err := authenticator.Verify(token)
+	require.NoError(t, err)
+	assert.Equal(t, "player_1001", claims.PlayerID())
+	assert.Equal(t, "alice", claims.Username)
+	assert.Equal(t, "slg-test-server", claims.Issuer)
+	assert.Equal(t, clock.Now().Add(time.Minute).Unix(), claims.ExpiresAt)
+
+	// 载荷为标准JWT声明，任意JWT库都能解析
+	parts := strings.Split(token, ".")
+	require.Len(t, parts, 3)
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	require.NoError(t, err)
+	var raw map[string]interface{}
+	require.NoError(t, json.Unmarshal(payload, &raw))
+	assert.Equal(t, "player_1001", raw["sub"])
+	assert.Contains(t, raw, "exp")
+	assert.Contains(t, raw, "jti")
+
+	// 刷新令牌不能当作访问令牌使用
+	_, refresh, err := authenticator.IssuePair("player_1001", "alice")
+	require.NoError(t, err)
+	_, err = authenticator.Verify(refresh)
+	assert.ErrorIs(t, err, auth.ErrTokenType)
+}
+
+// TestTokenRejectsTampering 测试篡改载荷、换密钥和alg=none的令牌被拒绝
+func TestTokenRejectsTampering(t *testing.T) {
+	authenticator, _ := newTestAuthenticator()
+	token, err := authenticator.Issue("player_1", "bob")
+	require.NoError(t, err)
+	parts := strings.Split(token, ".")
+
+	forged, _ := json.Marshal(map[string]interface{}{"sub": "player_admin", "typ": "access", "exp": time.Now().Add(time.Hour).Unix()})
+	tampered := parts[0] + "." + base64.RawURLEncoding.EncodeToString(forged) + "." + parts[2]
+	_, err = authenticator.Verify(tampered)
+	assert.ErrorIs(t, err, auth.ErrSignature)
+
+	noneHeader := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","typ":"JWT"}`))
+	_, err = authenticator.Verify(noneHeader + "." + parts[1] + ".")
+	assert.ErrorIs(t, err, auth.ErrMalformed)
+
+	other := auth.New(&auth.Config{Secret: []byte("another-secret"), AccessTTL: time.Minute})
+	_, err = other.Verify(token)
+	assert.ErrorIs(t, err, auth.ErrSignature)
+
+	_, err = authenticator.Verify("not-a-token")
+	assert.ErrorIs(t, err, auth.ErrMalformed)
+
+	stats := authenticator.Stats()
+	assert.Equal(t, uint64(1), stats.Rejected["signature"])
+	assert.Equal(t, uint64(2), stats.Rejected["malformed"])
+	t.Logf("🔒 认证统计: %+v", stats)
+}
+
+// TestTokenHeaderParsing 测试按JSON解析JWT头：字段顺序、空白和省略typ不影响校验，非HS256算法被拒绝
+func TestTokenHeaderParsing(t *testing.T) {
+	authenticator, _ := newTestAuthenticator()
+	token, err := authenticator.Issue("player_1", "bob")
+	require.NoError(t, err)
+	payload := strings.Split(token, ".")[1]
+
+	// 用相同密钥为任意头重新签名，模拟其他JWT库签发的令牌
+	resign := func(header string) string {
+		input := base64.RawURLEncoding.EncodeToString([]byte(header)) + "." + payload
+		mac := hmac.New(sha256.New, []byte("auth-test-secret"))
+		mac.Write([]byte(input))
+		return input + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+	}
+
+	for _, header := range []string{
+		`{"typ":"JWT","alg":"HS256"}`,
+		`{ "alg": "HS256", "typ": "JWT" }`,
+		`{"alg":"HS256"}`,
+		`{"alg":"HS256","typ":"jwt","kid":"k1"}`,
+	} {
+		claims, err := authenticator.Verify(resign(header))
+		require.NoError(t, err, header)
+		assert.Equal(t, "player_1", claims.PlayerID())
+	}
+
+	for _, header := range []string{
+		`{"alg":"none","typ":"JWT"}`,
+		`{"alg":"HS512","typ":"JWT"}`,
+		`{"alg":"HS256","typ":"JWE"}`,
+		`{"typ":"JWT"}`,
+		`not json`,
+	} {
+		_, err := authenticator.Verify(resign(header))
+		assert.ErrorIs(t, err, auth.ErrMalformed, header)
+	}
+}
+
+// TestTokenExpiryAndRevocation 测试过期、时钟容差、单令牌吊销与玩家级吊销
+func TestTokenExpiryAndRevocation(t *testing.T) {
+	authenticator, clock := newTestAuthenticator()
+
+	token, err := authenticator.Issue("player_exp", "carol")
+	require.NoError(t, err)
+
+	clock.Advance(59 * time.Second)
+	_, err = authenticator.Verify(token)
+	require.NoError(t, err)
+
+	clock.Advance(2 * time.Second)
+	_, err = authenticator.Verify(token)
+	assert.ErrorIs(t, err, auth.ErrExpired)
+
+	// 单令牌吊销不影响同一玩家的其他令牌
+	first, err := authenticator.Issue("player_rev", "dave")
+	require.NoError(t, err)
+	second, err := authenticator.Issue("player_rev", "dave")
+	require.NoError(t, err)
+	require.NoError(t, authenticator.Revoke(first))
+	_, err = authenticator.Verify(first)
+	assert.ErrorIs(t, err, auth.ErrRevoked)
+	_, err = authenticator.Verify(second)
+	assert.NoError(t, err)
+
+	// 玩家级吊销使此前签发的全部令牌失效，之后签发的仍有效
+	authenticator.RevokePlayer("player_rev")
+	_, err = authenticator.Verify(second)
+	assert.ErrorIs(t, err, auth.ErrRevoked)
+
+	clock.Advance(time.Second)
+	third, err := authenticator.Issue("player_rev", "dave")
+	require.NoError(t, err)
+	_, err = authenticator.Verify(third)
+	assert.NoError(t, err)
+}
+
+// TestTokenRefreshRotation 测试刷新令牌换取新令牌对后旧刷新令牌失效
+func TestTokenRefreshRotation(t *testing.T) {
+	authenticator, _ := newTestAuthenticator()
+
+	_, refresh, err := authenticator.IssuePair("player_refresh", "erin")
+	require.NoError(t, err)
+
+	access, newRefresh, err := authenticator.Refresh(refresh)
+	require.NoError(t, err)
+	claims, err := authenticator.Verify(access)
+	require.NoError(t, err)
+	assert.Equal(t, "player_refresh", claims.PlayerID())
+
+	_, _, err = authenticator.Refresh(refresh)
+	assert.ErrorIs(t, err, auth.ErrRevoked, "旧刷新令牌不能重复使用")
+
+	_, _, err = authenticator.Refresh(newRefresh)
+	assert.NoError(t, err)
+}
+
+// TestTokenForTestAccounts 测试配置中的测试账号可转换为有效令牌
+func TestTokenForTestAccounts(t *testing.T) {
+	authenticator, _ := newTestAuthenticator()
+
+	accounts := []config.TestAccount{
+		{Username: "tester1", PlayerID: "player_10001"},
+		{Username: "tester2"},
+	}
+	tokens, err := authenticator.IssueForAccounts(accounts)
+	require.NoError(t, err)
+	require.Len(t, tokens, 2)
+
+	claims, err := authenticator.Verify(tokens["tester1"])
+	require.NoError(t, err)
+	assert.Equal(t, "player_10001", claims.PlayerID())
+
+	claims, err = authenticator.Verify(tokens["tester2"])
+	require.NoError(t, err)
+	assert.Equal(t, "player_tester2", claims.PlayerID(), "未配置玩家ID时按用户名生成")
+}
+
+// TestWebSocketLoginWithToken 测试WS服务器按令牌声明确定玩家ID并拒绝无效令牌
+func TestWebSocketLoginWithToken(t *testing.T) {
+	authenticator := auth.New(nil)
+	server := testutil.NewTestServerWithConfig(t, func(config *testserver.ServerConfig) {
+		config.Authenticator = authenticator
+	})
+	server.Start()
+	defer server.Stop()
+
+	token, err := authenticator.Issue("player_ws_1", "ws-user")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	config := wsclient.DefaultClientConfig(server.GetWebSocketURL(), token)
+	config.DeviceID = "auth-valid"
+	client := wsclient.New(config)
+	require.NoError(t, client.Connect(ctx))
+	defer client.Close()
+	assert.Equal(t, "player_ws_1", client.PlayerID())
+
+	for _, bad := range []string{"garbage-token", token[:len(token)-2] + "xx"} {
+		config := wsclient.DefaultClientConfig(server.GetWebSocketURL(), bad)
+		config.DeviceID = "auth-invalid"
+		rejected := wsclient.New(config)
+		err := rejected.Connect(ctx)
+		require.Error(t, err)
+		assert.ErrorIs(t, err, wsclient.ErrLoginRejected)
+		assert.Contains(t, err.Error(), "code=401")
+	}
+
+	assert.Equal(t, uint64(2), sumRejected(authenticator.Stats()))
+}
+
+// TestHTTPLoginVerifyLogout 测试HTTP登录签发的令牌可校验，注销后被拒绝
+func TestHTTPLoginVerifyLogout(t *testing.T) {
+	api := httpserver.NewAPIServer("127.0.0.1:0")
+	authenticator := auth.New(nil)
+	api.SetAuthenticator(authenticator)
+	ts := httptest.NewServer(api.Handler())
+	defer ts.Close()
+
+	body, _ := json.Marshal(map[string]string{"username": "http-user", "password": "secret"})
+	resp, err := http.Post(ts.URL+"/api/v1/auth/login", "application/json", bytes.NewReader(body))
+	require.NoError(t, err)
+	var login struct {
+		Data struct {
+			PlayerID     string `json:"player_id"`
+			AccessToken  string `json:"access_token"`
+			RefreshToken string `json:"refresh_token"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&login))
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	claims, err := authenticator.Verify(login.Data.AccessToken)
+	require.NoError(t, err, "HTTP签发的令牌可被共享认证器校验")
+	assert.Equal(t, login.Data.PlayerID, claims.PlayerID())
+
+	assert.Equal(t, http.StatusOK, authorizedRequest(t, http.MethodGet, ts.URL+"/api/v1/auth/verify", login.Data.AccessToken))
+	assert.Equal(t, http.StatusUnauthorized, authorizedRequest(t, http.MethodGet, ts.URL+"/api/v1/auth/verify", "Bearer forged.token.value"))
+
+	assert.Equal(t, http.StatusOK, authorizedRequest(t, http.MethodPost, ts.URL+"/api/v1/auth/logout", login.Data.AccessToken))
+	assert.Equal(t, http.StatusUnauthorized, authorizedRequest(t, http.MethodGet, ts.URL+"/api/v1/auth/verify", login.Data.AccessToken),
+		"注销后令牌被吊销")
+}
+
+// TestGRPCLoginWithToken 测试gRPC登录在设置认证器后校验令牌
+func TestGRPCLoginWithToken(t *testing.T) {
+	authenticator := auth.New(nil)
+	gameServer := grpcserver.NewGameServer()
+	gameServer.SetAuthenticator(authenticator)
+
+	grpcServer := grpc.NewServer(gameServer.ServerOptions()...)
+	gamev1.RegisterGameServiceServer(grpcServer, gameServer)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go grpcServer.Serve(lis)
+	defer grpcServer.Stop()
+
+	conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+	client := gamev1.NewGameServiceClient(conn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	token, err := authenticator.Issue("player_grpc_1", "grpc-user")
+	require.NoError(t, err)
+	resp, err := client.Login(ctx, &gamev1.LoginReq{Token: token})
+	require.NoError(t, err)
+	assert.Equal(t, "player_grpc_1", resp.PlayerId)
+
+	_, err = client.Login(ctx, &gamev1.LoginReq{Token: "player-token"})
+	require.Error(t, err)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+// authorizedRequest 携带Authorization头发起请求并返回状态码
+func authorizedRequest(t *testing.T, method, url, token string) int {
+	req, err := http.NewRequest(method, url, strings.NewReader("{}"))
+	require.NoError(t, err)
+	req.Header.Set("Authorization", token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+// sumRejected 汇总各原因的拒绝次数
+func sumRejected(stats auth.Stats) uint64 {
+	var total uint64
+	for _, count := range stats.Rejected {
+		total += count
+	}
+	return total
+}
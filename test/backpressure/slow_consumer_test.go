@@ -0,0 +1,265 @@
+package backpressure_test
+
+import (
+	"context"
+	"crypto/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+
+	"GoSlgBenchmarkTest/internal/protocol"
+	"GoSlgBenchmarkTest/internal/testserver"
+	"GoSlgBenchmarkTest/internal/testutil"
+	"GoSlgBenchmarkTest/internal/wsclient"
+	gamev1 "GoSlgBenchmarkTest/proto/game/v1"
+)
+
+const (
+	queueSize   = 8
+	payloadSize = 48 * 1024 // 随机字节无法被压缩，保证填满socket缓冲区
+	readBuffer  = 64 * 1024 // 客户端socket接收缓冲区
+)
+
+// startQueueServer 启动启用发送队列的测试服务器
+func startQueueServer(t *testing.T, policy testserver.SlowConsumerPolicy) *testutil.TestServer {
+	server := testutil.NewTestServerWithConfig(t, func(config *testserver.ServerConfig) {
+		config.EnableBattlePush = false
+		config.EnableRoomRouting = true
+		config.SendQueueSize = queueSize
+		config.SlowConsumerPolicy = policy
+	})
+	server.Start()
+	return server
+}
+
+// slowClient 故意慢速读取的客户端
+type slowClient struct {
+	*wsclient.Client
+
+	mu      sync.Mutex
+	lastSeq map[string]uint64
+	count   int
+	states  []wsclient.ClientState
+}
+
+// connectSlowClient 连接慢速读取客户端并加入战斗房间
+func connectSlowClient(t *testing.T, server *testutil.TestServer, deviceID string, delay time.Duration) *slowClient {
+	config := wsclient.DefaultClientConfig(server.GetWebSocketURL(), "backpressure-token")
+	config.DeviceID = deviceID
+	config.SlowReadDelay = delay
+	config.SocketReadBuffer = readBuffer
+
+	client := &slowClient{Client: wsclient.New(config), lastSeq: make(map[string]uint64)}
+	client.SetPushHandler(func(opcode uint16, message proto.Message) {
+		if push, ok := message.(*gamev1.BattlePush); ok {
+			client.mu.Lock()
+			client.lastSeq[push.BattleId] = push.Seq
+			client.count++
+			client.mu.Unlock()
+		}
+	})
+	client.SetStateChangeHandler(func(oldState, newState wsclient.ClientState) {
+		client.mu.Lock()
+		defer client.mu.Unlock()
+		client.states = append(client.states, newState)
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, client.Connect(ctx))
+	require.NoError(t, server.JoinRoom(client.PlayerID(), testserver.BattleRoom("pressure")))
+	return client
+}
+
+// latest 获取指定战斗最后收到的序列号
+func (c *slowClient) latest(battleID string) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lastSeq[battleID]
+}
+
+// sawState 是否出现过指定状态
+func (c *slowClient) sawState(state wsclient.ClientState) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, s := range c.states {
+		if s == state {
+			return true
+		}
+	}
+	return false
+}
+
+// bigPush 构造携带随机大负载的战斗推送
+func bigPush(t *testing.T, battleID string, seq uint64) *gamev1.BattlePush {
+	payload := make([]byte, payloadSize)
+	_, err := rand.Read(payload)
+	require.NoError(t, err)
+	return &gamev1.BattlePush{Seq: seq, BattleId: battleID, StateHash: payload}
+}
+
+// connectionStats 获取唯一连接的统计
+func connectionStats(t *testing.T, server *testserver.Server) *testserver.ConnectionStats {
+	all := server.GetConnectionStats()
+	require.Len(t, all, 1)
+	for _, stats := range all {
+		return stats
+	}
+	return nil
+}
+
+// TestSlowConsumerDropDoesNotStallPusher 测试丢帧策略下慢客户端不会阻塞推送方
+func TestSlowConsumerDropDoesNotStallPusher(t *testing.T) {
+	for _, policy := range []testserver.SlowConsumerPolicy{testserver.PolicyDropNewest, testserver.PolicyDropOldest} {
+		t.Run(string(policy), func(t *testing.T) {
+			server := startQueueServer(t, policy)
+			defer server.Stop()
+
+			client := connectSlowClient(t, server, "slow-"+string(policy), 50*time.Millisecond)
+			defer client.Close()
+
+			const pushes = 200
+			start := time.Now()
+			for seq := uint64(1); seq <= pushes; seq++ {
+				_, err := server.PushToRoom(testserver.BattleRoom("pressure"), protocol.OpBattlePush,
+					bigPush(t, "pressure", seq))
+				require.NoError(t, err)
+			}
+			elapsed := time.Since(start)
+
+			stats := connectionStats(t, server.Server)
+			assert.Less(t, elapsed, 2*time.Second, "推送方不应被慢客户端阻塞")
+			assert.Greater(t, stats.DroppedFrames.Load(), uint64(0), "队列满时应丢帧")
+			assert.LessOrEqual(t, stats.MaxQueueDepth.Load(), int64(queueSize))
+			assert.Equal(t, stats.DroppedFrames.Load(), server.GetStats()["dropped_frames"])
+
+			t.Logf("🐢 %s: 推送%d条耗时%v, 丢弃%d条, 最大队列深度%d",
+				policy, pushes, elapsed, stats.DroppedFrames.Load(), stats.MaxQueueDepth.Load())
+		})
+	}
+}
+
+// TestSlowConsumerCoalesce 测试合并策略只保留每场战斗的最新状态
+func TestSlowConsumerCoalesce(t *testing.T) {
+	server := startQueueServer(t, testserver.PolicyCoalesce)
+	defer server.Stop()
+
+	client := connectSlowClient(t, server, "slow-coalesce", 10*time.Millisecond)
+	defer client.Close()
+
+	const pushes = 200
+	battles := []string{"alpha", "beta"}
+	for seq := uint64(1); seq <= pushes; seq++ {
+		_, err := server.PushToRoom(testserver.BattleRoom("pressure"), protocol.OpBattlePush,
+			bigPush(t, battles[seq%2], seq))
+		require.NoError(t, err)
+	}
+
+	// 最终每场战斗都应收到最后一次状态
+	require.Eventually(t, func() bool {
+		return client.latest("alpha") == pushes && client.latest("beta") == pushes-1
+	}, 10*time.Second, 20*time.Millisecond)
+
+	stats := connectionStats(t, server.Server)
+	assert.Greater(t, stats.CoalescedFrames.Load(), uint64(0), "积压时同一战斗的旧状态应被合并")
+	assert.LessOrEqual(t, stats.MaxQueueDepth.Load(), int64(len(battles)), "合并后每场战斗最多积压一帧")
+
+	t.Logf("🧩 合并策略: 合并%d条, 丢弃%d条", stats.CoalescedFrames.Load(), stats.DroppedFrames.Load())
+}
+
+// TestSlowConsumerDisconnect 测试断开策略关闭慢消费者
+func TestSlowConsumerDisconnect(t *testing.T) {
+	server := startQueueServer(t, testserver.PolicyDisconnect)
+	defer server.Stop()
+
+	client := connectSlowClient(t, server, "slow-disconnect", 50*time.Millisecond)
+	defer client.Close()
+
+	// 队列溢出后连接被断开，推送送达数降为0
+	delivered := 1
+	for seq := uint64(1); seq <= 200 && delivered > 0; seq++ {
+		var err error
+		delivered, err = server.PushToRoom(testserver.BattleRoom("pressure"), protocol.OpBattlePush,
+			bigPush(t, "pressure", seq))
+		require.NoError(t, err)
+	}
+	require.Zero(t, delivered, "队列溢出的慢消费者应被断开")
+
+	require.Eventually(t, func() bool {
+		return len(server.GetRoomStats()) == 0
+	}, 5*time.Second, 20*time.Millisecond, "慢消费者应被断开并离开房间，空房间随之删除")
+
+	require.Eventually(t, func() bool {
+		return client.sawState(wsclient.StateReconnecting)
+	}, 10*time.Second, 20*time.Millisecond, "被断开的客户端应触发重连")
+}
+
+// TestSlowConsumerBlock 测试阻塞策略下推送方等待慢客户端
+func TestSlowConsumerBlock(t *testing.T) {
+	server := startQueueServer(t, testserver.PolicyBlock)
+	defer server.Stop()
+
+	client := connectSlowClient(t, server, "slow-block", 50*time.Millisecond)
+	defer client.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		for seq := uint64(1); seq <= 200; seq++ {
+			if _, err := server.PushToRoom(testserver.BattleRoom("pressure"), protocol.OpBattlePush,
+				bigPush(t, "pressure", seq)); err != nil {
+				done <- err
+				return
+			}
+		}
+		done <- nil
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("阻塞策略下推送方应等待慢客户端")
+	case <-time.After(500 * time.Millisecond):
+	}
+
+	stats := connectionStats(t, server.Server)
+	assert.Zero(t, stats.DroppedFrames.Load(), "阻塞策略不应丢帧")
+	assert.Equal(t, int64(queueSize), stats.MaxQueueDepth.Load(), "队列应被填满")
+
+	// 客户端断开后队列关闭，推送方被唤醒
+	client.Close()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("连接关闭后推送方应被唤醒")
+	}
+}
+
+// TestStalledConsumerDoesNotStallOthers 测试写出阻塞的客户端不影响同房间其他客户端接收推送
+func TestStalledConsumerDoesNotStallOthers(t *testing.T) {
+	server := startQueueServer(t, testserver.PolicyDropOldest)
+	defer server.Stop()
+
+	stalled := connectSlowClient(t, server, "stalled", 3*time.Second)
+	defer stalled.Close()
+	fast := connectSlowClient(t, server, "fast", 0)
+	defer fast.Close()
+
+	// 推送过程中慢客户端的写出持续阻塞，推送方读取连接元数据不应等待写出
+	const pushes = 100
+	start := time.Now()
+	for seq := uint64(1); seq <= pushes; seq++ {
+		_, err := server.PushToRoom(testserver.BattleRoom("pressure"), protocol.OpBattlePush,
+			bigPush(t, "pressure", seq))
+		require.NoError(t, err)
+		time.Sleep(5 * time.Millisecond)
+	}
+	assert.Less(t, time.Since(start), 2*time.Second, "推送方不应被阻塞的写出拖住")
+
+	require.Eventually(t, func() bool {
+		return fast.latest("pressure") == pushes
+	}, 2*time.Second, 20*time.Millisecond, "快客户端应持续收到推送")
+	assert.Less(t, stalled.latest("pressure"), uint64(pushes), "慢客户端应仍在积压")
+}
@@ -0,0 +1,249 @@
+package cluster_test
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+
+	"GoSlgBenchmarkTest/internal/auth"
+	"GoSlgBenchmarkTest/internal/cluster"
+	"GoSlgBenchmarkTest/internal/protocol"
+	"GoSlgBenchmarkTest/internal/testserver"
+	"GoSlgBenchmarkTest/internal/wsclient"
+)
+
+// clusterClient 经网关连接的测试客户端
+type clusterClient struct {
+	*wsclient.Client
+	roomID string
+	pushes atomic.Int64
+}
+
+// startCluster 启动开启房间路由的3节点集群
+func startCluster(t *testing.T, authenticator *auth.Authenticator) *cluster.Cluster {
+	cfg := cluster.DefaultConfig()
+	cfg.Authenticator = authenticator
+	cfg.NodeConfig = func(nodeID string) *testserver.ServerConfig {
+		config := testserver.DefaultServerConfig("127.0.0.1:0")
+		config.PushInterval = 20 * time.Millisecond
+		config.EnableRoomRouting = true
+		return config
+	}
+
+	c := cluster.New(cfg)
+	require.NoError(t, c.Start())
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		c.Stop(ctx)
+	})
+	return c
+}
+
+// connectClients 连接count个客户端，每个客户端加入自己的战斗房间
+func connectClients(t *testing.T, c *cluster.Cluster, authenticator *auth.Authenticator, count int) []*clusterClient {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	clients := make([]*clusterClient, 0, count)
+	for i := 0; i < count; i++ {
+		token, err := authenticator.Issue(fmt.Sprintf("player_cluster_%d", i), "")
+		require.NoError(t, err)
+
+		config := wsclient.DefaultClientConfig(c.GatewayURL(), token)
+		config.DeviceID = fmt.Sprintf("cluster-device-%d", i)
+		config.ReconnectInterval = 50 * time.Millisecond
+
+		client := &clusterClient{
+			Client: wsclient.New(config),
+			roomID: testserver.BattleRoom(fmt.Sprintf("cluster_%d", i)),
+		}
+		client.SetPushHandler(func(opcode uint16, message proto.Message) {
+			if opcode == protocol.OpBattlePush {
+				client.pushes.Add(1)
+			}
+		})
+		require.NoError(t, client.Connect(ctx))
+		t.Cleanup(func() { client.Close() })
+		require.NoError(t, client.JoinRoom(client.roomID))
+
+		clients = append(clients, client)
+	}
+
+	for _, client := range clients {
+		require.Eventually(t, func() bool { return client.pushes.Load() >= 3 }, 3*time.Second, 20*time.Millisecond,
+			"客户端 %s 应开始收到房间推送", client.PlayerID())
+	}
+	return clients
+}
+
+// nodeOf 查找玩家当前在线的节点
+func nodeOf(c *cluster.Cluster, playerID string) string {
+	for _, node := range c.Nodes() {
+		for _, online := range node.Server.OnlinePlayers() {
+			if online == playerID {
+				return node.ID
+			}
+		}
+	}
+	return ""
+}
+
+// TestHashRingConsistency 测试哈希环分布均衡，且移除节点只迁移该节点的键
+func TestHashRingConsistency(t *testing.T) {
+	ring := cluster.NewHashRing(100)
+	for _, nodeID := range []string{"node-1", "node-2", "node-3"} {
+		ring.Add(nodeID)
+	}
+
+	before := make(map[string]string)
+	counts := make(map[string]int)
+	for i := 0; i < 3000; i++ {
+		key := fmt.Sprintf("player_%d", i)
+		nodeID, ok := ring.Lookup(key)
+		require.True(t, ok)
+		before[key] = nodeID
+		counts[nodeID]++
+	}
+	for nodeID, count := range counts {
+		assert.InDelta(t, 1000, count, 350, "节点 %s 分到的键数量偏离过大", nodeID)
+	}
+
+	ring.Remove("node-2")
+	for key, owner := range before {
+		nodeID, _ := ring.Lookup(key)
+		if owner == "node-2" {
+			assert.NotEqual(t, "node-2", nodeID)
+		} else {
+			assert.Equal(t, owner, nodeID, "未被移除节点的键不应迁移")
+		}
+	}
+	assert.Equal(t, []string{"node-1", "node-3"}, ring.Nodes())
+
+	t.Logf("📊 键分布: %v", counts)
+}
+
+// TestGatewayRoutesByPlayerID 测试网关按令牌中的玩家ID一致性哈希路由
+func TestGatewayRoutesByPlayerID(t *testing.T) {
+	authenticator := auth.New(nil)
+	c := startCluster(t, authenticator)
+	clients := connectClients(t, c, authenticator, 9)
+
+	for _, client := range clients {
+		expected, ok := c.NodeFor(client.PlayerID())
+		require.True(t, ok)
+		assert.Equal(t, expected, nodeOf(c, client.PlayerID()))
+	}
+
+	stats := c.Gateway().Stats()
+	var routed uint64
+	for _, count := range stats.Routed {
+		routed += count
+	}
+	assert.Equal(t, uint64(len(clients)), routed)
+	t.Logf("🧭 路由分布: %v", stats.Active)
+}
+
+// TestDrainNodeMigratesClients 测试排空节点后客户端收到1012并重连到其他节点，房间订阅与推送序列得以延续
+func TestDrainNodeMigratesClients(t *testing.T) {
+	authenticator := auth.New(nil)
+	c := startCluster(t, authenticator)
+	clients := connectClients(t, c, authenticator, 12)
+
+	// 排空承载玩家最多的节点
+	active := c.Gateway().Stats().Active
+	drained := ""
+	for nodeID, count := range active {
+		if drained == "" || count > active[drained] {
+			drained = nodeID
+		}
+	}
+
+	var moved, stayed []*clusterClient
+	for _, client := range clients {
+		if nodeOf(c, client.PlayerID()) == drained {
+			moved = append(moved, client)
+		} else {
+			stayed = append(stayed, client)
+		}
+	}
+	require.NotEmpty(t, moved)
+
+	playerIDs := make(map[*clusterClient]string)
+	pushesBefore := make(map[*clusterClient]int64)
+	for _, client := range clients {
+		playerIDs[client] = client.PlayerID()
+		pushesBefore[client] = client.pushes.Load()
+	}
+
+	state, err := c.DrainNode(context.Background(), drained)
+	require.NoError(t, err)
+	assert.Equal(t, drained, state.NodeID)
+	assert.Len(t, state.Players, len(moved))
+	assert.True(t, c.Node(drained).Server.IsDraining())
+
+	for _, client := range moved {
+		require.Eventually(t, func() bool {
+			return client.Reconnects() == 1 && nodeOf(c, client.PlayerID()) != ""
+		}, 5*time.Second, 20*time.Millisecond, "客户端应重连到其他节点")
+
+		assert.Equal(t, testserver.CloseServiceRestart, client.LastCloseCode())
+		assert.Equal(t, playerIDs[client], client.PlayerID(), "重连后玩家ID不变")
+		assert.NotEqual(t, drained, nodeOf(c, client.PlayerID()))
+	}
+
+	// 房间订阅由交接状态恢复，推送序列号不回退，客户端无需重新加入房间即可继续收到推送
+	for _, client := range clients {
+		before := pushesBefore[client]
+		require.Eventually(t, func() bool { return client.pushes.Load() >= before+5 }, 3*time.Second, 20*time.Millisecond,
+			"客户端 %s 排空后应继续收到推送", client.PlayerID())
+	}
+	for _, client := range stayed {
+		assert.Zero(t, client.Reconnects(), "其他节点上的客户端不受影响")
+	}
+
+	assert.Empty(t, c.Node(drained).Server.OnlinePlayers())
+	direct := wsclient.New(wsclient.DefaultClientConfig(fmt.Sprintf("ws://%s/ws", c.Node(drained).Server.Addr()), "direct"))
+	err = direct.Connect(context.Background())
+	assert.Error(t, err, "排空后的节点拒绝新连接")
+
+	t.Logf("🔁 节点 %s 排空: 迁移%d个客户端，交接序列号%d", drained, len(moved), state.Sequence)
+}
+
+// TestRollingRestart 测试滚动重启全部节点期间客户端持续在线且推送不中断
+func TestRollingRestart(t *testing.T) {
+	authenticator := auth.New(nil)
+	c := startCluster(t, authenticator)
+	clients := connectClients(t, c, authenticator, 9)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	require.NoError(t, c.RollingRestart(ctx, 200*time.Millisecond))
+
+	for _, node := range c.Nodes() {
+		assert.Equal(t, 1, node.Generation)
+		assert.False(t, node.Server.IsDraining())
+	}
+	assert.Len(t, c.Handoffs(), 3)
+
+	totalReconnects := 0
+	for _, client := range clients {
+		playerID := client.PlayerID()
+		require.Eventually(t, func() bool { return nodeOf(c, playerID) != "" }, 5*time.Second, 20*time.Millisecond)
+
+		before := client.pushes.Load()
+		require.Eventually(t, func() bool { return client.pushes.Load() >= before+3 }, 3*time.Second, 20*time.Millisecond,
+			"客户端 %s 滚动重启后应继续收到推送", playerID)
+
+		totalReconnects += client.Reconnects()
+	}
+
+	assert.GreaterOrEqual(t, totalReconnects, len(clients), "每个客户端至少经历一次迁移")
+	t.Logf("🔄 滚动重启完成: %d个客户端共重连%d次", len(clients), totalReconnects)
+}
@@ -0,0 +1,371 @@
+package database_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+
+	"GoSlgBenchmarkTest/internal/database"
+	"GoSlgBenchmarkTest/internal/db"
+	"GoSlgBenchmarkTest/internal/protocol"
+	"GoSlgBenchmarkTest/internal/session"
+	gamev1 "GoSlgBenchmarkTest/proto/game/v1"
+)
+
+// fakeDB 内存中的tests/test_sessions/session_events/session_messages表，按sqlc查询名分派
+type fakeDB struct {
+	mu       sync.Mutex
+	nextID   int64
+	tests    map[int64]*db.Test
+	sessions map[int64]*db.TestSession
+	events   []db.SessionEvent
+	messages []db.SessionMessage
+	copies   map[string]int // 表名 -> COPY次数
+	copyErr  error
+}
+
+func newFakeDB() *fakeDB {
+	return &fakeDB{
+		tests:    make(map[int64]*db.Test),
+		sessions: make(map[int64]*db.TestSession),
+		copies:   make(map[string]int),
+	}
+}
+
+func (f *fakeDB) id() int64 {
+	f.nextID++
+	return f.nextID
+}
+
+// queryName 从sqlc生成的SQL中取出查询名
+func queryName(sql string) string {
+	fields := strings.Fields(strings.TrimPrefix(sql, "-- name: "))
+	return fields[0]
+}
+
+func (f *fakeDB) Exec(context.Context, string, ...interface{}) (pgconn.CommandTag, error) {
+	return pgconn.CommandTag{}, errors.New("fakeDB: exec not supported")
+}
+
+func (f *fakeDB) QueryRow(_ context.Context, sql string, args ...interface{}) pgx.Row {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	now := pgtype.Timestamptz{Time: time.Now(), Valid: true}
+
+	switch queryName(sql) {
+	case "CreateTest":
+		test := &db.Test{ID: f.id(), Name: args[0].(string), Type: args[1].(string), Status: args[2].(string),
+			Config: args[3].(pgtype.Text), CreatedAt: now, UpdatedAt: now}
+		f.tests[test.ID] = test
+		return structRow{item: *test}
+	case "UpdateTest":
+		test := f.tests[args[0].(int64)]
+		test.Status = args[1].(string)
+		test.StartTime = args[2].(pgtype.Timestamptz)
+		test.EndTime = args[3].(pgtype.Timestamptz)
+		test.Duration = args[4].(pgtype.Int8)
+		test.ErrorMessage = args[7].(pgtype.Text)
+		return structRow{item: *test}
+	case "CreateTestSession":
+		row := &db.TestSession{ID: f.id(), TestID: args[0].(int64), SessionID: args[1].(string),
+			ClientType: args[2].(pgtype.Text), ClientInfo: args[3].([]byte), StartTime: args[4].(pgtype.Timestamptz),
+			CreatedAt: now, UpdatedAt: now}
+		f.sessions[row.ID] = row
+		return structRow{item: *row}
+	case "UpdateTestSession":
+		row := f.sessions[args[0].(int64)]
+		row.EndTime = args[1].(pgtype.Timestamptz)
+		row.ConnectionCount = args[2].(pgtype.Int4)
+		row.MessageCount = args[3].(pgtype.Int4)
+		row.BytesTransfer = args[4].(pgtype.Int8)
+		row.AvgLatency = args[5].(pgtype.Int8)
+		row.MinLatency = args[6].(pgtype.Int8)
+		row.MaxLatency = args[7].(pgtype.Int8)
+		row.ErrorCount = args[8].(pgtype.Int4)
+		row.ReconnectCount = args[9].(pgtype.Int4)
+		return structRow{item: *row}
+	case "GetTestSession":
+		for _, row := range f.sessions {
+			if row.SessionID == args[0].(string) {
+				return structRow{item: *row}
+			}
+		}
+		return structRow{err: pgx.ErrNoRows}
+	}
+	return structRow{err: fmt.Errorf("fakeDB: unsupported query %s", queryName(sql))}
+}
+
+func (f *fakeDB) Query(_ context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	rows := &structRows{index: -1}
+	switch queryName(sql) {
+	case "ListSessionEvents":
+		for _, event := range f.events {
+			if event.SessionID == args[0].(int64) {
+				rows.items = append(rows.items, event)
+			}
+		}
+	case "ListSessionMessages":
+		for _, message := range f.messages {
+			if message.SessionID == args[0].(int64) {
+				rows.items = append(rows.items, message)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("fakeDB: unsupported query %s", queryName(sql))
+	}
+	return rows, nil
+}
+
+func (f *fakeDB) CopyFrom(_ context.Context, table pgx.Identifier, columns []string, source pgx.CopyFromSource) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.copyErr != nil {
+		return 0, f.copyErr
+	}
+
+	var count int64
+	for source.Next() {
+		values, err := source.Values()
+		if err != nil {
+			return count, err
+		}
+		switch table[0] {
+		case "session_events":
+			f.events = append(f.events, db.SessionEvent{ID: f.id(), SessionID: values[0].(int64),
+				EventType: values[1].(string), EventData: values[2].([]byte), Timestamp: values[3].(pgtype.Timestamptz)})
+		case "session_messages":
+			f.messages = append(f.messages, db.SessionMessage{ID: f.id(), SessionID: values[0].(int64),
+				Direction: values[1].(string), Opcode: values[2].(pgtype.Int4), MessageSize: values[3].(pgtype.Int4),
+				BodySize: values[4].(pgtype.Int4), SequenceNum: values[5].(pgtype.Int8), MessageHash: values[6].(pgtype.Text),
+				RawData: values[7].([]byte), Timestamp: values[8].(pgtype.Timestamptz)})
+		}
+		count++
+	}
+	f.copies[table[0]]++
+	return count, source.Err()
+}
+
+// scanStruct 按字段顺序把模型结构体赋值给Scan的目标，与sqlc生成的列顺序一致
+func scanStruct(item interface{}, dest []interface{}) error {
+	value := reflect.ValueOf(item)
+	if value.NumField() != len(dest) {
+		return fmt.Errorf("fakeDB: scan %d columns into %d targets", value.NumField(), len(dest))
+	}
+	for i := range dest {
+		reflect.ValueOf(dest[i]).Elem().Set(value.Field(i))
+	}
+	return nil
+}
+
+// structRow 单行查询结果
+type structRow struct {
+	item interface{}
+	err  error
+}
+
+func (r structRow) Scan(dest ...interface{}) error {
+	if r.err != nil {
+		return r.err
+	}
+	return scanStruct(r.item, dest)
+}
+
+// structRows 多行查询结果
+type structRows struct {
+	items []interface{}
+	index int
+}
+
+func (r *structRows) Close()                                       {}
+func (r *structRows) Err() error                                   { return nil }
+func (r *structRows) CommandTag() pgconn.CommandTag                { return pgconn.CommandTag{} }
+func (r *structRows) FieldDescriptions() []pgconn.FieldDescription { return nil }
+func (r *structRows) Next() bool                                   { r.index++; return r.index < len(r.items) }
+func (r *structRows) Scan(dest ...interface{}) error               { return scanStruct(r.items[r.index], dest) }
+func (r *structRows) Values() ([]interface{}, error)               { return nil, errors.New("fakeDB: not supported") }
+func (r *structRows) RawValues() [][]byte                          { return nil }
+func (r *structRows) Conn() *pgx.Conn                              { return nil }
+
+// recordFrames 通过录制器记录登录、操作和一个非协议帧
+func recordFrames(t *testing.T, recorder *session.SessionRecorder, actions int) {
+	record := func(direction string, opcode uint16, message proto.Message) {
+		body, err := proto.Marshal(message)
+		require.NoError(t, err)
+		raw := protocol.EncodeFrame(opcode, body)
+		recorder.RecordMessage(direction, raw, opcode, body, protocol.MessageSequence(opcode, body))
+	}
+
+	record("send", protocol.OpLoginReq, &gamev1.LoginReq{Token: "token", DeviceId: "device"})
+	record("receive", protocol.OpLoginResp, &gamev1.LoginResp{Ok: true, PlayerId: "p1"})
+	for i := 1; i <= actions; i++ {
+		action := &gamev1.PlayerAction{ActionSeq: uint64(i), PlayerId: "p1"}
+		record("send", protocol.OpPlayerAction, action)
+		record("receive", protocol.OpActionResp, action)
+	}
+	recorder.RecordMessage("receive", []byte("not a frame"), 0, []byte("not a frame"), 0)
+	recorder.RecordError(errors.New("read timeout"), nil)
+	recorder.RecordLatency(15 * time.Millisecond)
+}
+
+// TestSessionPersisterRoundTrip 测试录制器流式分批写入数据库后能还原出相同的会话
+func TestSessionPersisterRoundTrip(t *testing.T) {
+	fake := newFakeDB()
+	queries := db.New(fake)
+	ctx := context.Background()
+
+	recorder := session.NewSessionRecorder("db_round_trip")
+	options := database.DefaultSessionPersisterOptions()
+	options.BatchSize = 8
+	options.FlushInterval = 10 * time.Millisecond
+	options.ClientType = "recording-proxy"
+	options.ClientInfo = map[string]interface{}{"target": "ws://game"}
+	persister, err := database.NewSessionPersister(ctx, queries, "db_round_trip", time.Now(), options)
+	require.NoError(t, err)
+	recorder.StreamTo(persister, true)
+
+	recordFrames(t, recorder, 20)
+	recorder.Stop()
+	require.NoError(t, persister.Close(ctx))
+	require.NoError(t, recorder.SinkError())
+
+	original := recorder.GetSession()
+	assert.Greater(t, fake.copies["session_messages"], 1, "frames should be written in several batches")
+	assert.Greater(t, fake.copies["session_events"], 1)
+	assert.Len(t, fake.messages, len(original.Frames))
+	assert.Len(t, fake.events, len(original.Events))
+
+	// 自动创建的测试记录在关闭后标记为完成
+	row := persister.Row()
+	test := fake.tests[row.TestID]
+	require.NotNil(t, test)
+	assert.Equal(t, database.RecordingTestType, test.Type)
+	assert.Equal(t, "completed", test.Status)
+	assert.Equal(t, "recording-proxy", row.ClientType.String)
+	assert.JSONEq(t, `{"target":"ws://game"}`, string(row.ClientInfo))
+	assert.Equal(t, int32(len(original.Frames)), row.MessageCount.Int32)
+	assert.Equal(t, int32(1), row.ErrorCount.Int32)
+	assert.Equal(t, int64(15*time.Millisecond), row.MaxLatency.Int64)
+
+	loaded, err := database.LoadSession(ctx, queries, "db_round_trip")
+	require.NoError(t, err)
+	require.Len(t, loaded.Frames, len(original.Frames))
+	for i, frame := range original.Frames {
+		got := loaded.Frames[i]
+		assert.Equal(t, frame.Direction, got.Direction)
+		assert.Equal(t, frame.Opcode, got.Opcode)
+		assert.Equal(t, frame.RawData, got.RawData)
+		assert.Equal(t, frame.Body, got.Body)
+		assert.Equal(t, frame.SequenceNum, got.SequenceNum)
+		assert.True(t, frame.Timestamp.Equal(got.Timestamp))
+	}
+	require.Len(t, loaded.Events, len(original.Events))
+	for i, event := range original.Events {
+		assert.Equal(t, event.Type, loaded.Events[i].Type)
+		assert.Equal(t, event.ID, loaded.Events[i].ID)
+		assert.Equal(t, event.Opcode, loaded.Events[i].Opcode)
+	}
+	assert.Equal(t, int64(21), loaded.Stats.MessagesSent)
+	assert.Equal(t, int64(22), loaded.Stats.MessagesReceived)
+
+	// 还原的会话可以直接用于回放和断言
+	assert.NoError(t, session.ValidateSession(loaded))
+	assert.NotEmpty(t, session.NewTimelineAnalyzer(loaded).AnalyzeMessageFlows())
+}
+
+// TestPersistSessionLinksExistingTest 测试写入已加载的会话并关联到已有的测试记录
+func TestPersistSessionLinksExistingTest(t *testing.T) {
+	fake := newFakeDB()
+	queries := db.New(fake)
+	ctx := context.Background()
+
+	test, err := queries.CreateTest(ctx, db.CreateTestParams{Name: "capacity", Type: "load", Status: "running"})
+	require.NoError(t, err)
+
+	recorder := session.NewSessionRecorder("exported")
+	recordFrames(t, recorder, 3)
+	recorder.Stop()
+	recorded := recorder.GetSession()
+
+	options := database.DefaultSessionPersisterOptions()
+	options.TestID = test.ID
+	row, err := database.PersistSession(ctx, queries, recorded, options)
+	require.NoError(t, err)
+	assert.Equal(t, test.ID, row.TestID)
+	assert.Len(t, fake.tests, 1)
+	assert.Equal(t, "running", fake.tests[test.ID].Status, "linked tests are not updated")
+	assert.Equal(t, 1, fake.copies["session_messages"])
+
+	loaded, err := database.LoadSessionRow(ctx, queries, row)
+	require.NoError(t, err)
+	assert.Len(t, loaded.Frames, len(recorded.Frames))
+	assert.Len(t, loaded.Events, len(recorded.Events))
+}
+
+// TestSessionPersisterCopyFailure 测试写入失败后录制器收到错误，自动创建的测试标记为失败
+func TestSessionPersisterCopyFailure(t *testing.T) {
+	fake := newFakeDB()
+	queries := db.New(fake)
+	ctx := context.Background()
+
+	persister, err := database.NewSessionPersister(ctx, queries, "broken", time.Now(), nil)
+	require.NoError(t, err)
+	fake.copyErr = errors.New("disk full")
+
+	recorder := session.NewSessionRecorder("broken")
+	recorder.StreamTo(persister, false)
+	recordFrames(t, recorder, 1)
+	recorder.Stop()
+
+	err = persister.Close(ctx)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "disk full")
+
+	test := fake.tests[persister.Row().TestID]
+	assert.Equal(t, "failed", test.Status)
+	assert.Contains(t, test.ErrorMessage.String, "disk full")
+	assert.Error(t, persister.WriteEvent(&session.SessionEvent{Type: session.EventError, Timestamp: time.Now()}))
+}
+
+// TestSessionPersisterFail 测试录制失败时缓冲的事件和帧照常写入，自动创建的测试标记为失败
+func TestSessionPersisterFail(t *testing.T) {
+	fake := newFakeDB()
+	queries := db.New(fake)
+	ctx := context.Background()
+
+	options := database.DefaultSessionPersisterOptions()
+	options.FlushInterval = time.Hour // 关闭前不会自动写入，事件和帧都留在缓冲中
+	persister, err := database.NewSessionPersister(ctx, queries, "assert_failed", time.Now(), options)
+	require.NoError(t, err)
+	recorder := session.NewSessionRecorder("assert_failed")
+	recorder.StreamTo(persister, true)
+	recordFrames(t, recorder, 2)
+	recorder.RecordClose(session.CloseNormal, "done")
+	recorder.Stop()
+	assert.Empty(t, fake.messages)
+
+	persister.Fail(errors.New("断言测试失败: latency p99"))
+	require.NoError(t, persister.Close(ctx))
+
+	original := recorder.GetSession()
+	assert.Len(t, fake.messages, len(original.Frames))
+	assert.Len(t, fake.events, len(original.Events))
+	assert.Equal(t, int32(len(original.Frames)), persister.Row().MessageCount.Int32)
+	test := fake.tests[persister.Row().TestID]
+	assert.Equal(t, "failed", test.Status)
+	assert.Contains(t, test.ErrorMessage.String, "latency p99")
+}
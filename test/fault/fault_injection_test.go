@@ -0,0 +1,375 @@
+package fault_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+
+	"GoSlgBenchmarkTest/internal/protocol"
+	"GoSlgBenchmarkTest/internal/session"
+	"GoSlgBenchmarkTest/internal/testserver"
+	"GoSlgBenchmarkTest/internal/testutil"
+	"GoSlgBenchmarkTest/internal/wsclient"
+	gamev1 "GoSlgBenchmarkTest/proto/game/v1"
+)
+
+// startFaultServer 启动高频推送的测试服务器
+func startFaultServer(t *testing.T) *testutil.TestServer {
+	server := testutil.NewTestServerWithConfig(t, func(config *testserver.ServerConfig) {
+		config.EnableBattlePush = true
+		config.PushInterval = 20 * time.Millisecond
+		config.FaultSeed = 42
+	})
+	server.Start()
+	return server
+}
+
+// faultClient 记录推送与状态变化的测试客户端
+type faultClient struct {
+	*wsclient.Client
+
+	mu       sync.Mutex
+	pushes   []*gamev1.BattlePush
+	states   []wsclient.ClientState
+	received int
+}
+
+// connectClient 连接测试客户端
+func connectClient(t *testing.T, server *testutil.TestServer) *faultClient {
+	client := &faultClient{
+		Client: wsclient.New(wsclient.DefaultClientConfig(server.GetWebSocketURL(), "fault-test-token")),
+	}
+	client.SetPushHandler(func(opcode uint16, message proto.Message) {
+		client.mu.Lock()
+		defer client.mu.Unlock()
+		client.received++
+		if push, ok := message.(*gamev1.BattlePush); ok {
+			client.pushes = append(client.pushes, push)
+		}
+	})
+	client.SetStateChangeHandler(func(oldState, newState wsclient.ClientState) {
+		client.mu.Lock()
+		defer client.mu.Unlock()
+		client.states = append(client.states, newState)
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, client.Connect(ctx))
+	return client
+}
+
+// receivedCount 已收到的推送数量
+func (c *faultClient) receivedCount() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.received
+}
+
+// battlePushes 已收到的战斗推送
+func (c *faultClient) battlePushes() []*gamev1.BattlePush {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]*gamev1.BattlePush(nil), c.pushes...)
+}
+
+// sawState 是否出现过指定状态
+func (c *faultClient) sawState(state wsclient.ClientState) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, s := range c.states {
+		if s == state {
+			return true
+		}
+	}
+	return false
+}
+
+// postControl 调用/control接口
+func postControl(t *testing.T, server *testutil.TestServer, query string, body interface{}) map[string]interface{} {
+	var payload []byte
+	if body != nil {
+		var err error
+		payload, err = json.Marshal(body)
+		require.NoError(t, err)
+	}
+
+	resp, err := http.Post(fmt.Sprintf("%s/control?%s", server.GetHTTPURL(), query),
+		"application/json", bytes.NewReader(payload))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var result map[string]interface{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+	return result
+}
+
+// TestFaultDropIsLogged 测试丢帧故障按次数生效并记录日志
+func TestFaultDropIsLogged(t *testing.T) {
+	server := startFaultServer(t)
+	defer server.Stop()
+
+	client := connectClient(t, server)
+	defer client.Close()
+
+	// 先正常收到若干推送，使丢帧在序列号中可见
+	require.Eventually(t, func() bool {
+		return client.receivedCount() >= 3
+	}, 2*time.Second, 10*time.Millisecond)
+
+	_, err := server.AddFaultRule(testserver.FaultRule{
+		ID:       "drop-pushes",
+		Type:     testserver.FaultDrop,
+		Opcodes:  []uint16{protocol.OpBattlePush},
+		MaxCount: 5,
+	})
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		return server.GetFaultEngine().InjectedCount() >= 5
+	}, 3*time.Second, 20*time.Millisecond)
+
+	// 次数用完后规则不再生效
+	time.Sleep(200 * time.Millisecond)
+	events := server.GetFaultEngine().Events()
+	require.Len(t, events, 5)
+	for _, event := range events {
+		assert.Equal(t, "drop-pushes", event.RuleID)
+		assert.Equal(t, testserver.FaultDrop, event.Type)
+		assert.Equal(t, protocol.OpBattlePush, event.Opcode)
+		assert.NotEmpty(t, event.PlayerID)
+	}
+
+	rules := server.GetFaultEngine().Rules()
+	require.Len(t, rules, 1)
+	assert.Equal(t, 5, rules[0].Hits)
+
+	// 丢帧导致客户端序列号出现空洞
+	messages := client.battlePushes()
+	gaps := 0
+	var lastSeq uint64
+	for _, push := range messages {
+		if lastSeq != 0 && push.Seq > lastSeq+1 {
+			gaps++
+		}
+		lastSeq = push.Seq
+	}
+	assert.Greater(t, gaps, 0, "客户端应观察到被丢弃的序列号")
+
+	t.Logf("💥 丢帧故障: 注入%d次, 客户端收到%d条, 空洞%d处", len(events), len(messages), gaps)
+}
+
+// TestFaultControlAPICloseCode 测试通过/control JSON接口注入指定关闭码
+func TestFaultControlAPICloseCode(t *testing.T) {
+	server := startFaultServer(t)
+	defer server.Stop()
+
+	client := connectClient(t, server)
+	defer client.Close()
+
+	result := postControl(t, server, "action=add_fault", testserver.FaultRule{
+		Type:      testserver.FaultClose,
+		CloseCode: 4001,
+		MaxCount:  1,
+	})
+	ids, ok := result["ids"].([]interface{})
+	require.True(t, ok)
+	require.Len(t, ids, 1)
+
+	// 客户端被断开后应进入重连
+	require.Eventually(t, func() bool {
+		return client.sawState(wsclient.StateReconnecting)
+	}, 5*time.Second, 20*time.Millisecond, "注入关闭后客户端应触发重连")
+
+	listed := postControl(t, server, "action=list_faults", nil)
+	events, ok := listed["events"].([]interface{})
+	require.True(t, ok)
+	require.Len(t, events, 1)
+	event := events[0].(map[string]interface{})
+	assert.Equal(t, "close", event["type"])
+	assert.Equal(t, "close_code=4001", event["detail"])
+
+	cleared := postControl(t, server, "action=clear_faults", nil)
+	assert.Equal(t, true, cleared["cleared"])
+	assert.Empty(t, server.GetFaultEngine().Rules())
+}
+
+// TestFaultHalfOpen 测试半开连接：服务端停止读写但连接仍保持
+func TestFaultHalfOpen(t *testing.T) {
+	server := startFaultServer(t)
+	defer server.Stop()
+
+	client := connectClient(t, server)
+	defer client.Close()
+
+	require.Eventually(t, func() bool {
+		return client.receivedCount() >= 3
+	}, 2*time.Second, 10*time.Millisecond)
+
+	_, err := server.AddFaultRule(testserver.FaultRule{Type: testserver.FaultHalfOpen, MaxCount: 1})
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		return server.GetFaultEngine().InjectedCount() == 1
+	}, 2*time.Second, 10*time.Millisecond)
+
+	before := client.receivedCount()
+	time.Sleep(300 * time.Millisecond)
+	after := client.receivedCount()
+
+	assert.Equal(t, before, after, "半开连接不应再收到推送")
+	assert.Equal(t, int32(1), server.GetStats()["current_connections"], "半开连接不应被关闭")
+}
+
+// TestFaultRuleValidation 测试非法规则被拒绝
+func TestFaultRuleValidation(t *testing.T) {
+	engine := testserver.NewFaultEngine(1)
+
+	_, err := engine.AddRule(testserver.FaultRule{Type: "explode"})
+	assert.Error(t, err)
+
+	_, err = engine.AddRule(testserver.FaultRule{Type: testserver.FaultLatency})
+	assert.Error(t, err, "延迟故障必须指定延迟")
+
+	_, err = engine.AddRule(testserver.FaultRule{Type: testserver.FaultClose, CloseCode: 99})
+	assert.Error(t, err)
+
+	_, err = engine.AddRule(testserver.FaultRule{Type: testserver.FaultDrop, Probability: 1.5})
+	assert.Error(t, err)
+
+	id, err := engine.AddRule(testserver.FaultRule{Type: testserver.FaultLatency, LatencyMs: 50, JitterMs: 20})
+	require.NoError(t, err)
+	assert.Equal(t, "fault_1", id, "校验失败的规则不占用ID")
+
+	_, err = engine.AddRule(testserver.FaultRule{ID: id, Type: testserver.FaultDrop})
+	assert.Error(t, err, "重复ID应被拒绝")
+
+	assert.True(t, engine.RemoveRule(id))
+	assert.False(t, engine.RemoveRule(id))
+}
+
+// TestFaultLogCorrelatesWithSession 测试故障日志导入会话后可被计划性故障豁免断言识别
+func TestFaultLogCorrelatesWithSession(t *testing.T) {
+	server := startFaultServer(t)
+	defer server.Stop()
+
+	client := connectClient(t, server)
+	defer client.Close()
+
+	_, err := server.AddFaultRule(testserver.FaultRule{
+		Type:      testserver.FaultLatency,
+		LatencyMs: 30,
+		JitterMs:  10,
+		MaxCount:  3,
+	})
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		return server.GetFaultEngine().InjectedCount() >= 3
+	}, 3*time.Second, 20*time.Millisecond)
+
+	recorder := session.NewSessionRecorder("fault-correlation")
+	exported := server.GetFaultEngine().ExportToRecorder(recorder, "")
+	assert.Equal(t, 3, exported)
+
+	faultEvents := 0
+	for _, event := range recorder.GetEvents() {
+		if event.Type == session.EventFaultInjected {
+			faultEvents++
+			assert.Equal(t, "latency", event.Metadata["fault_type"])
+		}
+	}
+	assert.Equal(t, 3, faultEvents)
+
+	assertion := session.NewPlannedFaultExemptionAssertion("fault_exemption", "故障豁免", 5)
+	result := assertion.Assert(recorder.GetSession())
+	assert.True(t, result.Passed, result.Message)
+}
+
+// TestFaultReorderRecordsEveryHit 测试乱序故障的每次命中都有记录，且没有后续帧时暂存帧超时补发
+func TestFaultReorderRecordsEveryHit(t *testing.T) {
+	server := testutil.NewTestServerWithConfig(t, func(config *testserver.ServerConfig) {
+		config.EnableBattlePush = false
+		config.FaultSeed = 42
+	})
+	server.Start()
+	defer server.Stop()
+
+	client := connectClient(t, server)
+	defer client.Close()
+	players := server.OnlinePlayers()
+	require.Len(t, players, 1)
+	require.NoError(t, server.JoinRoom(players[0], "battle:reorder"))
+
+	_, err := server.AddFaultRule(testserver.FaultRule{
+		ID:       "reorder",
+		Type:     testserver.FaultReorder,
+		Opcodes:  []uint16{protocol.OpBattlePush},
+		MaxCount: 2,
+	})
+	require.NoError(t, err)
+
+	push := func(seq uint64) {
+		_, err := server.PushToRoom("battle:reorder", protocol.OpBattlePush, &gamev1.BattlePush{Seq: seq, BattleId: "reorder"})
+		require.NoError(t, err)
+	}
+
+	// 第一帧被暂存，第二帧越过它先发出，两次命中都有记录。
+	// 客户端丢弃倒序的推送，因此按2、1推送，乱序后客户端按1、2收到
+	push(2)
+	push(1)
+	require.Eventually(t, func() bool { return len(client.battlePushes()) == 2 }, 2*time.Second, 10*time.Millisecond)
+	pushes := client.battlePushes()
+	assert.Equal(t, []uint64{1, 2}, []uint64{pushes[0].Seq, pushes[1].Seq})
+
+	rules := server.GetFaultEngine().Rules()
+	require.Len(t, rules, 1)
+	events := server.GetFaultEngine().Events()
+	require.Len(t, events, rules[0].Hits, "命中次数与故障日志一致")
+	assert.Equal(t, "held", events[0].Detail)
+	assert.Equal(t, "overtook_held", events[1].Detail)
+
+	// 规则用完后再换一条：只有一帧时暂存帧超时补发
+	server.ClearFaultRules()
+	_, err = server.AddFaultRule(testserver.FaultRule{Type: testserver.FaultReorder, Opcodes: []uint16{protocol.OpBattlePush}, MaxCount: 1})
+	require.NoError(t, err)
+	push(3)
+	require.Eventually(t, func() bool { return len(client.battlePushes()) == 3 }, 2*time.Second, 10*time.Millisecond,
+		"没有后续帧时暂存帧应超时补发")
+}
+
+// TestFaultControlAddIsAtomic 测试批量添加规则时任一规则非法则一条都不添加
+func TestFaultControlAddIsAtomic(t *testing.T) {
+	server := startFaultServer(t)
+	defer server.Stop()
+
+	payload, err := json.Marshal([]testserver.FaultRule{
+		{ID: "ok", Type: testserver.FaultDrop, MaxCount: 1},
+		{ID: "bad", Type: testserver.FaultLatency},
+	})
+	require.NoError(t, err)
+	resp, err := http.Post(server.GetHTTPURL()+"/control?action=add_fault", "application/json", bytes.NewReader(payload))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Empty(t, server.GetFaultEngine().Rules(), "校验失败时不应留下部分规则")
+
+	engine := testserver.NewFaultEngine(1)
+	_, err = engine.AddRules([]testserver.FaultRule{{ID: "dup", Type: testserver.FaultDrop}, {ID: "dup", Type: testserver.FaultDrop}})
+	assert.Error(t, err, "批内重复ID应被拒绝")
+	assert.Empty(t, engine.Rules())
+
+	ids, err := engine.AddRules([]testserver.FaultRule{{Type: testserver.FaultDrop}, {Type: testserver.FaultCorrupt}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"fault_1", "fault_2"}, ids)
+}
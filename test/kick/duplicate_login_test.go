@@ -0,0 +1,290 @@
+package kick_test
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"GoSlgBenchmarkTest/internal/auth"
+	"GoSlgBenchmarkTest/internal/grpcserver"
+	"GoSlgBenchmarkTest/internal/protocol"
+	"GoSlgBenchmarkTest/internal/testserver"
+	"GoSlgBenchmarkTest/internal/testutil"
+	"GoSlgBenchmarkTest/internal/wsclient"
+	gamev1 "GoSlgBenchmarkTest/proto/game/v1"
+)
+
+// startPolicyServer 启动指定重复登录策略的测试服务器，玩家ID取自令牌，保证多设备登录同一玩家
+func startPolicyServer(t *testing.T, policy protocol.DuplicateLoginPolicy) (*testutil.TestServer, string) {
+	authenticator := auth.New(nil)
+	server := testutil.NewTestServerWithConfig(t, func(config *testserver.ServerConfig) {
+		config.EnableBattlePush = false
+		config.Authenticator = authenticator
+		config.DuplicateLoginPolicy = policy
+	})
+	server.Start()
+
+	token, err := authenticator.Issue("player_multi_device", "multi-device")
+	require.NoError(t, err)
+	return server, token
+}
+
+// newDeviceClient 创建同一玩家在指定设备上的客户端，重连间隔很短，便于发现被踢后的重连
+func newDeviceClient(t *testing.T, server *testutil.TestServer, token, deviceID string) *wsclient.Client {
+	config := wsclient.DefaultClientConfig(server.GetWebSocketURL(), token)
+	config.DeviceID = deviceID
+	config.ReconnectInterval = 20 * time.Millisecond
+
+	client := wsclient.New(config)
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+// currentConnections 当前连接数
+func currentConnections(server *testutil.TestServer) int32 {
+	return server.GetStats()["current_connections"].(int32)
+}
+
+// TestKickOldOnDuplicateLogin 测试kick_old策略下新设备登录踢掉旧设备，旧设备不自动重连
+func TestKickOldOnDuplicateLogin(t *testing.T) {
+	server, token := startPolicyServer(t, protocol.DuplicateLoginKickOld)
+	defer server.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	phone := newDeviceClient(t, server, token, "phone")
+	kicks := make(chan *gamev1.ErrorResp, 1)
+	phone.SetPushHandler(func(opcode uint16, message proto.Message) {
+		if opcode == protocol.OpKick {
+			kicks <- message.(*gamev1.ErrorResp)
+		}
+	})
+	require.NoError(t, phone.Connect(ctx))
+
+	tablet := newDeviceClient(t, server, token, "tablet")
+	require.NoError(t, tablet.Connect(ctx))
+
+	select {
+	case kick := <-kicks:
+		assert.Equal(t, int32(protocol.KickDuplicateLogin), kick.ErrorCode)
+		assert.NotEmpty(t, kick.ErrorMessage)
+	case <-time.After(2 * time.Second):
+		t.Fatal("旧设备没有收到踢下线消息")
+	}
+	require.Eventually(t, phone.IsKicked, time.Second, 10*time.Millisecond)
+	assert.Equal(t, protocol.KickDuplicateLogin, phone.KickReason())
+
+	// 被踢的设备不会重连抢回会话
+	time.Sleep(300 * time.Millisecond)
+	assert.Equal(t, "KICKED", phone.GetStats()["state"])
+	assert.Zero(t, phone.Reconnects())
+	assert.Equal(t, "CONNECTED", tablet.GetStats()["state"])
+	assert.False(t, tablet.IsKicked())
+	assert.Equal(t, int32(1), currentConnections(server))
+	assert.Equal(t, []string{"player_multi_device"}, server.OnlinePlayers())
+	assert.Equal(t, uint64(1), server.KickCounts()[protocol.KickDuplicateLogin])
+
+	// 被踢的客户端仍然可以正常关闭
+	require.NoError(t, phone.Close())
+	assert.Equal(t, "CLOSED", phone.GetStats()["state"])
+}
+
+// TestRejectNewOnDuplicateLogin 测试reject_new策略下新设备登录被拒绝，旧设备不受影响
+func TestRejectNewOnDuplicateLogin(t *testing.T) {
+	server, token := startPolicyServer(t, protocol.DuplicateLoginRejectNew)
+	defer server.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	phone := newDeviceClient(t, server, token, "phone")
+	require.NoError(t, phone.Connect(ctx))
+
+	tablet := newDeviceClient(t, server, token, "tablet")
+	err := tablet.Connect(ctx)
+	require.Error(t, err)
+	assert.ErrorIs(t, err, wsclient.ErrKicked)
+	assert.True(t, tablet.IsKicked())
+	assert.Equal(t, protocol.KickLoginConflict, tablet.KickReason())
+
+	time.Sleep(200 * time.Millisecond)
+	assert.Equal(t, "CONNECTED", phone.GetStats()["state"])
+	assert.Equal(t, int32(1), currentConnections(server))
+	assert.Equal(t, uint64(1), server.KickCounts()[protocol.KickLoginConflict])
+
+	// 旧设备下线后新设备可以登录
+	require.NoError(t, phone.Close())
+	require.Eventually(t, func() bool { return len(server.OnlinePlayers()) == 0 }, time.Second, 10*time.Millisecond)
+	retry := newDeviceClient(t, server, token, "tablet")
+	require.NoError(t, retry.Connect(ctx))
+	assert.Equal(t, "player_multi_device", retry.PlayerID())
+}
+
+// TestAllowDuplicateLogin 测试默认allow策略保持多连接并存
+func TestAllowDuplicateLogin(t *testing.T) {
+	server, token := startPolicyServer(t, "")
+	defer server.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	phone := newDeviceClient(t, server, token, "phone")
+	require.NoError(t, phone.Connect(ctx))
+	tablet := newDeviceClient(t, server, token, "tablet")
+	require.NoError(t, tablet.Connect(ctx))
+
+	time.Sleep(200 * time.Millisecond)
+	assert.Equal(t, int32(2), currentConnections(server))
+	assert.False(t, phone.IsKicked())
+	assert.False(t, tablet.IsKicked())
+	assert.Empty(t, server.KickCounts())
+	assert.Equal(t, "allow", server.GetStats()["duplicate_login_policy"])
+}
+
+// TestDuplicateLoginWithoutAuth 测试未启用认证时按设备识别重复登录，两次登录跨越秒边界也能识别
+func TestDuplicateLoginWithoutAuth(t *testing.T) {
+	server := testutil.NewTestServerWithConfig(t, func(config *testserver.ServerConfig) {
+		config.EnableBattlePush = false
+		config.DuplicateLoginPolicy = protocol.DuplicateLoginKickOld
+	})
+	server.Start()
+	defer server.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	first := newDeviceClient(t, server, "", "shared-device")
+	require.NoError(t, first.Connect(ctx))
+
+	// 等到下一秒再登录，排除按登录时间生成玩家ID的情况
+	loginSecond := time.Now().Unix()
+	require.Eventually(t, func() bool { return time.Now().Unix() > loginSecond }, 2*time.Second, 10*time.Millisecond)
+
+	second := newDeviceClient(t, server, "", "shared-device")
+	require.NoError(t, second.Connect(ctx))
+	assert.Equal(t, first.PlayerID(), second.PlayerID())
+
+	require.Eventually(t, first.IsKicked, time.Second, 10*time.Millisecond)
+	assert.Equal(t, protocol.KickDuplicateLogin, first.KickReason())
+	assert.False(t, second.IsKicked())
+	assert.Equal(t, []string{second.PlayerID()}, server.OnlinePlayers())
+
+	// 其他设备仍是不同的玩家
+	other := newDeviceClient(t, server, "", "other-device")
+	require.NoError(t, other.Connect(ctx))
+	assert.NotEqual(t, second.PlayerID(), other.PlayerID())
+	assert.False(t, second.IsKicked())
+}
+
+// TestConcurrentLoginRace 测试同一玩家多设备并发登录时最终只保留一个连接
+func TestConcurrentLoginRace(t *testing.T) {
+	server, token := startPolicyServer(t, protocol.DuplicateLoginKickOld)
+	defer server.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	const devices = 8
+	clients := make([]*wsclient.Client, devices)
+	var wg sync.WaitGroup
+	for i := range clients {
+		clients[i] = newDeviceClient(t, server, token, "race-device")
+		wg.Add(1)
+		go func(client *wsclient.Client) {
+			defer wg.Done()
+			// 登录响应送达前就被后来者踢掉时，Connect直接返回ErrKicked
+			if err := client.Connect(ctx); err != nil {
+				assert.ErrorIs(t, err, wsclient.ErrKicked)
+			}
+		}(clients[i])
+	}
+	wg.Wait()
+
+	require.Eventually(t, func() bool {
+		kicked := 0
+		for _, client := range clients {
+			if client.IsKicked() {
+				kicked++
+			}
+		}
+		return kicked == devices-1
+	}, 2*time.Second, 10*time.Millisecond)
+
+	// 被踢的设备都不重连，不会互相踢来踢去
+	time.Sleep(300 * time.Millisecond)
+	connected := 0
+	for _, client := range clients {
+		assert.Zero(t, client.Reconnects())
+		if client.GetStats()["state"] == "CONNECTED" {
+			connected++
+		}
+	}
+	assert.Equal(t, 1, connected)
+	assert.Equal(t, int32(1), currentConnections(server))
+	assert.Equal(t, uint64(devices-1), server.KickCounts()[protocol.KickDuplicateLogin])
+}
+
+// TestGRPCDuplicateLoginPolicies 测试gRPC登录的重复登录策略
+func TestGRPCDuplicateLoginPolicies(t *testing.T) {
+	gameServer := grpcserver.NewGameServer()
+	grpcServer := grpc.NewServer(gameServer.ServerOptions()...)
+	gamev1.RegisterGameServiceServer(grpcServer, gameServer)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go grpcServer.Serve(lis)
+	defer grpcServer.Stop()
+
+	conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+	client := gamev1.NewGameServiceClient(conn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// 未设置认证器时玩家ID由令牌决定
+	gameServer.SetDuplicateLoginPolicy(protocol.DuplicateLoginRejectNew)
+	first, err := client.Login(ctx, &gamev1.LoginReq{Token: "grpc-dup"})
+	require.NoError(t, err)
+	_, err = client.Login(ctx, &gamev1.LoginReq{Token: "grpc-dup"})
+	require.Error(t, err)
+	assert.Equal(t, codes.AlreadyExists, status.Code(err))
+
+	// kick_old：旧会话失效，旧设备的事件流收到踢下线事件
+	gameServer.SetDuplicateLoginPolicy(protocol.DuplicateLoginKickOld)
+	stream, err := client.StreamPlayerEvents(ctx, &gamev1.PlayerEventStreamReq{PlayerId: first.PlayerId})
+	require.NoError(t, err)
+	// 服务端处理函数异步启动，等待事件流注册踢下线通知
+	time.Sleep(100 * time.Millisecond)
+
+	second, err := client.Login(ctx, &gamev1.LoginReq{Token: "grpc-dup"})
+	require.NoError(t, err)
+	assert.NotEqual(t, first.SessionId, second.SessionId)
+
+	event, err := stream.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, "kicked", event.EventType)
+	assert.Contains(t, event.EventData, "duplicate_login")
+	_, err = stream.Recv()
+	assert.Equal(t, codes.Aborted, status.Code(err))
+
+	logout, err := client.Logout(ctx, &gamev1.LogoutReq{SessionId: first.SessionId})
+	require.NoError(t, err)
+	assert.False(t, logout.Success)
+	assert.Contains(t, logout.Message, "duplicate_login")
+
+	stats := gameServer.GetStats()
+	assert.Equal(t, 1, stats["active_sessions"])
+	assert.Equal(t, uint64(1), stats["kicked_sessions"])
+}
@@ -0,0 +1,151 @@
+package liveness_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"GoSlgBenchmarkTest/internal/session"
+	"GoSlgBenchmarkTest/internal/testserver"
+	"GoSlgBenchmarkTest/internal/testutil"
+	"GoSlgBenchmarkTest/internal/wsclient"
+)
+
+// startLivenessServer 启动开启死连接检测的测试服务器（关闭推送，连接上只有心跳和ping流量）
+func startLivenessServer(t *testing.T, modify func(config *testserver.ServerConfig)) *testutil.TestServer {
+	server := testutil.NewTestServerWithConfig(t, func(config *testserver.ServerConfig) {
+		config.EnableBattlePush = false
+		modify(config)
+	})
+	server.Start()
+	return server
+}
+
+// connectClient 连接测试客户端
+func connectClient(t *testing.T, server *testutil.TestServer, deviceID string, heartbeat time.Duration) *wsclient.Client {
+	config := wsclient.DefaultClientConfig(server.GetWebSocketURL(), "liveness-token")
+	config.DeviceID = deviceID
+	config.HeartbeatInterval = heartbeat
+
+	client := wsclient.New(config)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, client.Connect(ctx))
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+// currentConnections 当前连接数
+func currentConnections(server *testutil.TestServer) int32 {
+	return server.GetStats()["current_connections"].(int32)
+}
+
+// TestSilentClientStaysWithoutDetection 测试未启用检测时静默客户端一直占用连接
+func TestSilentClientStaysWithoutDetection(t *testing.T) {
+	server := startLivenessServer(t, func(config *testserver.ServerConfig) {})
+	defer server.Stop()
+
+	client := connectClient(t, server, "silent-undetected", 50*time.Millisecond)
+	client.GoSilent()
+
+	time.Sleep(500 * time.Millisecond)
+	assert.Equal(t, int32(1), currentConnections(server), "只依赖读错误时静默客户端不会被发现")
+	assert.NotContains(t, server.GetStats(), "reaped_connections")
+}
+
+// TestPongTimeoutReapsSilentClient 测试WebSocket ping未应答的静默客户端被回收，正常客户端不受影响
+func TestPongTimeoutReapsSilentClient(t *testing.T) {
+	server := startLivenessServer(t, func(config *testserver.ServerConfig) {
+		config.PingInterval = 50 * time.Millisecond
+		config.PongTimeout = 300 * time.Millisecond
+	})
+	defer server.Stop()
+
+	alive := connectClient(t, server, "pong-alive", 30*time.Second)
+	silent := connectClient(t, server, "pong-silent", 30*time.Second)
+	require.Equal(t, int32(2), currentConnections(server))
+
+	silent.GoSilent()
+
+	// 回收之前先被识别为疑似死连接
+	require.Eventually(t, func() bool {
+		return server.GetStats()["zombie_connections"].(int) == 1
+	}, time.Second, 5*time.Millisecond)
+
+	require.Eventually(t, func() bool { return currentConnections(server) == 1 }, 2*time.Second, 10*time.Millisecond)
+	assert.Equal(t, uint64(1), server.ReapedCounts()[testserver.ReapPongTimeout])
+	assert.Equal(t, 0, server.GetStats()["zombie_connections"])
+
+	// 正常客户端没有应用层心跳，只靠应答ping保持存活
+	time.Sleep(500 * time.Millisecond)
+	assert.Equal(t, int32(1), currentConnections(server))
+	assert.Equal(t, "CONNECTED", alive.GetStats()["state"])
+	assert.Zero(t, alive.Reconnects())
+}
+
+// TestHeartbeatTimeoutReapsSilentClient 测试停止应用层心跳的客户端按心跳期限回收
+func TestHeartbeatTimeoutReapsSilentClient(t *testing.T) {
+	server := startLivenessServer(t, func(config *testserver.ServerConfig) {
+		config.HeartbeatTimeout = 300 * time.Millisecond
+		config.EnableSessionRecording = true
+	})
+	defer server.Stop()
+
+	connectClient(t, server, "heartbeat-alive", 50*time.Millisecond)
+	silent := connectClient(t, server, "heartbeat-silent", 50*time.Millisecond)
+	silentPlayer := silent.PlayerID()
+
+	time.Sleep(200 * time.Millisecond)
+	silent.GoSilent()
+
+	require.Eventually(t, func() bool { return currentConnections(server) == 1 }, 2*time.Second, 10*time.Millisecond)
+	assert.Equal(t, uint64(1), server.ReapedCounts()[testserver.ReapHeartbeatTimeout])
+
+	// 回收原因写入服务端录制的关闭事件
+	recorded := server.GetRecordedSession(silentPlayer)
+	require.NotNil(t, recorded)
+	var closeEvent *session.SessionEvent
+	for i := range recorded.Events {
+		if recorded.Events[i].Type == session.EventClose {
+			closeEvent = recorded.Events[i]
+		}
+	}
+	require.NotNil(t, closeEvent)
+	assert.Equal(t, string(testserver.ReapHeartbeatTimeout), closeEvent.Metadata["reason"])
+
+	time.Sleep(400 * time.Millisecond)
+	assert.Equal(t, int32(1), currentConnections(server), "持续发送心跳的客户端不会被回收")
+}
+
+// TestIdleTimeoutReapsQuietConnections 测试空闲回收与指标导出
+func TestIdleTimeoutReapsQuietConnections(t *testing.T) {
+	server := startLivenessServer(t, func(config *testserver.ServerConfig) {
+		config.IdleTimeout = 200 * time.Millisecond
+	})
+	defer server.Stop()
+
+	client := connectClient(t, server, "idle-quiet", 30*time.Second)
+
+	// 正常客户端被回收后会收到1001并重连，重连后继续空闲又会被再次回收
+	require.Eventually(t, func() bool {
+		return server.ReapedCounts()[testserver.ReapIdleTimeout] >= 1
+	}, 2*time.Second, 10*time.Millisecond)
+	require.Eventually(t, func() bool { return client.LastCloseCode() == websocket.CloseGoingAway }, time.Second, 10*time.Millisecond)
+	client.Close()
+
+	resp, err := http.Get(server.GetHTTPURL() + "/metrics")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	assert.Contains(t, string(body), `slg_ws_reaped_connections_total{reason="idle_timeout"}`)
+	assert.Contains(t, string(body), "slg_ws_zombie_connections 0")
+	t.Logf("🧹 空闲连接已回收: %v", server.GetStats()["reaped_connections"])
+}
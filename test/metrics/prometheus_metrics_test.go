@@ -0,0 +1,193 @@
+package metrics_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"GoSlgBenchmarkTest/internal/grpcserver"
+	"GoSlgBenchmarkTest/internal/httpserver"
+	"GoSlgBenchmarkTest/internal/metrics"
+	"GoSlgBenchmarkTest/internal/testserver"
+	"GoSlgBenchmarkTest/internal/testutil"
+	"GoSlgBenchmarkTest/internal/wsclient"
+	gamev1 "GoSlgBenchmarkTest/proto/game/v1"
+)
+
+// scrape 抓取/metrics并返回文本
+func scrape(t *testing.T, url string) string {
+	resp, err := http.Get(url)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, metrics.ContentType, resp.Header.Get("Content-Type"))
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return string(body)
+}
+
+// TestRegistryTextFormat 测试注册表输出符合Prometheus文本格式
+func TestRegistryTextFormat(t *testing.T) {
+	registry := metrics.NewRegistry()
+
+	requests := registry.Counter("demo_requests_total", "Requests.\nSecond line.", "path")
+	requests.WithLabelValues(`/a"b`).Add(3)
+	requests.WithLabelValues("/c").Inc()
+	requests.WithLabelValues("/c").Add(-5) // 计数器不能减少
+
+	inflight := registry.Gauge("demo_inflight", "In-flight requests.")
+	inflight.WithLabelValues().Set(2)
+	inflight.WithLabelValues().Dec()
+
+	latency := registry.Histogram("demo_latency_seconds", "Latency.", []float64{0.1, 0.5}, "path")
+	for _, v := range []float64{0.05, 0.1, 0.3, 2} {
+		latency.WithLabelValues("/c").Observe(v)
+	}
+
+	registry.GaugeFunc("demo_up", "Always one.", func() float64 { return 1 })
+
+	// 同名重复注册返回同一指标
+	assert.Same(t, requests, registry.Counter("demo_requests_total", "ignored", "path"))
+
+	var out strings.Builder
+	require.NoError(t, registry.WriteText(&out))
+
+	expected := `# HELP demo_inflight In-flight requests.
+# TYPE demo_inflight gauge
+demo_inflight 1
+# HELP demo_latency_seconds Latency.
+# TYPE demo_latency_seconds histogram
+demo_latency_seconds_bucket{path="/c",le="0.1"} 2
+demo_latency_seconds_bucket{path="/c",le="0.5"} 3
+demo_latency_seconds_bucket{path="/c",le="+Inf"} 4
+demo_latency_seconds_sum{path="/c"} 2.45
+demo_latency_seconds_count{path="/c"} 4
+# HELP demo_requests_total Requests.\nSecond line.
+# TYPE demo_requests_total counter
+demo_requests_total{path="/a\"b"} 3
+demo_requests_total{path="/c"} 1
+# HELP demo_up Always one.
+# TYPE demo_up gauge
+demo_up 1
+`
+	assert.Equal(t, expected, out.String())
+}
+
+// TestWebSocketServerMetrics 测试WS测试服务器按操作码导出指标
+func TestWebSocketServerMetrics(t *testing.T) {
+	server := testutil.NewTestServerWithConfig(t, func(config *testserver.ServerConfig) {
+		config.EnableBattlePush = true
+		config.PushInterval = 20 * time.Millisecond
+	})
+	server.Start()
+	defer server.Stop()
+
+	config := wsclient.DefaultClientConfig(server.GetWebSocketURL(), "metrics-token")
+	config.HeartbeatInterval = 50 * time.Millisecond
+	client := wsclient.New(config)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, client.Connect(ctx))
+	defer client.Close()
+
+	require.NoError(t, client.SendAction(&gamev1.PlayerAction{ActionSeq: 1, ActionType: gamev1.ActionType_ACTION_TYPE_MOVE}))
+	time.Sleep(300 * time.Millisecond)
+
+	text := scrape(t, server.GetHTTPURL()+"/metrics")
+
+	assert.Contains(t, text, "# TYPE slg_ws_messages_received_total counter")
+	assert.Contains(t, text, `slg_ws_messages_received_total{opcode="LOGIN_REQ"} 1`)
+	assert.Contains(t, text, `slg_ws_messages_received_total{opcode="PLAYER_ACTION"} 1`)
+	assert.Contains(t, text, `slg_ws_handle_duration_seconds_bucket{opcode="HEARTBEAT",le="+Inf"}`)
+	assert.Contains(t, text, `slg_ws_handle_duration_seconds_count{opcode="PLAYER_ACTION"} 1`)
+	assert.Contains(t, text, `slg_ws_messages_sent_total{opcode="BATTLE_PUSH"}`)
+	assert.Contains(t, text, "slg_ws_connections 1")
+	assert.Contains(t, text, "# TYPE slg_ws_connections_total counter")
+
+	t.Logf("📊 WS指标输出%d字节", len(text))
+}
+
+// TestHTTPServerMetrics 测试HTTP API服务器按方法与路由模板导出指标
+func TestHTTPServerMetrics(t *testing.T) {
+	api := httpserver.NewAPIServer("127.0.0.1:0")
+	ts := httptest.NewServer(api.Handler())
+	defer ts.Close()
+
+	for i := 0; i < 3; i++ {
+		resp, err := http.Get(ts.URL + "/api/v1/test/fast")
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+	for _, id := range []string{"p1", "p2"} {
+		resp, err := http.Get(ts.URL + "/api/v1/players/" + id)
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+
+	for _, path := range []string{"/api/v1/nope/1", "/wp-login.php?probe=1"} {
+		resp, err := http.Get(ts.URL + path)
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+
+	text := scrape(t, ts.URL+"/metrics")
+
+	assert.Contains(t, text, `slg_http_requests_total{method="GET",route="unmatched",code="404"} 2`, "未匹配的请求使用固定标签")
+	assert.NotContains(t, text, "nope")
+	assert.NotContains(t, text, "wp-login")
+	assert.Contains(t, text, `slg_http_requests_total{method="GET",route="/api/v1/test/fast",code="200"} 3`)
+	assert.Contains(t, text, `slg_http_request_duration_seconds_count{method="GET",route="/api/v1/test/fast"} 3`)
+	assert.Contains(t, text, `slg_http_request_duration_seconds_count{method="GET",route="/api/v1/players/{id}"} 2`,
+		"路径参数应按路由模板聚合")
+	assert.NotContains(t, text, `route="/api/v1/players/p1"`)
+}
+
+// TestGRPCServerMetrics 测试gRPC拦截器按方法与状态码导出指标
+func TestGRPCServerMetrics(t *testing.T) {
+	gameServer := grpcserver.NewGameServer()
+	grpcServer := grpc.NewServer(gameServer.ServerOptions()...)
+	gamev1.RegisterGameServiceServer(grpcServer, gameServer)
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go grpcServer.Serve(lis)
+	defer grpcServer.Stop()
+
+	conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+	client := gamev1.NewGameServiceClient(conn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for i := 0; i < 2; i++ {
+		_, err := client.Login(ctx, &gamev1.LoginReq{Token: fmt.Sprintf("token-%d", i)})
+		require.NoError(t, err)
+	}
+	_, err = client.Login(ctx, &gamev1.LoginReq{})
+	require.Error(t, err)
+
+	ts := httptest.NewServer(gameServer.MetricsHandler())
+	defer ts.Close()
+	text := scrape(t, ts.URL)
+
+	login := gamev1.GameService_Login_FullMethodName
+	assert.Contains(t, text, fmt.Sprintf(`slg_grpc_requests_total{method="%s",code="OK"} 2`, login))
+	assert.Contains(t, text, fmt.Sprintf(`slg_grpc_requests_total{method="%s",code="Unauthenticated"} 1`, login))
+	assert.Contains(t, text, fmt.Sprintf(`slg_grpc_request_duration_seconds_count{method="%s"} 3`, login))
+	assert.Equal(t, int64(3), gameServer.GetStats()["request_count"])
+}
@@ -0,0 +1,208 @@
+package room_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"GoSlgBenchmarkTest/internal/protocol"
+	"GoSlgBenchmarkTest/internal/testserver"
+	"GoSlgBenchmarkTest/internal/testutil"
+	"GoSlgBenchmarkTest/internal/wsclient"
+	gamev1 "GoSlgBenchmarkTest/proto/game/v1"
+)
+
+// roomClient 记录收到的战斗推送与房间应答
+type roomClient struct {
+	*wsclient.Client
+
+	mu        sync.Mutex
+	battleIDs map[string]int
+	joined    []string
+	errors    []string
+}
+
+// connectRoomClient 连接一个使用独立设备ID的客户端
+func connectRoomClient(t *testing.T, server *testutil.TestServer, deviceID string) *roomClient {
+	config := wsclient.DefaultClientConfig(server.GetWebSocketURL(), "room-test-token")
+	config.DeviceID = deviceID
+
+	client := &roomClient{Client: wsclient.New(config), battleIDs: make(map[string]int)}
+	client.SetPushHandler(func(opcode uint16, message proto.Message) {
+		client.mu.Lock()
+		defer client.mu.Unlock()
+		switch msg := message.(type) {
+		case *gamev1.BattlePush:
+			client.battleIDs[msg.BattleId]++
+		case *wrapperspb.StringValue:
+			client.joined = append(client.joined, msg.Value)
+		case *gamev1.ErrorResp:
+			client.errors = append(client.errors, msg.ErrorMessage)
+		}
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, client.Connect(ctx))
+	return client
+}
+
+// received 获取按战斗ID统计的推送数
+func (c *roomClient) received() map[string]int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	copied := make(map[string]int, len(c.battleIDs))
+	for k, v := range c.battleIDs {
+		copied[k] = v
+	}
+	return copied
+}
+
+// acks 获取房间应答与错误数
+func (c *roomClient) acks() (int, int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.joined), len(c.errors)
+}
+
+// TestRoomRoutingIsolatesBattles 测试战斗推送只发送给对应战斗房间的成员
+func TestRoomRoutingIsolatesBattles(t *testing.T) {
+	server := testutil.NewTestServerWithConfig(t, func(config *testserver.ServerConfig) {
+		config.EnableBattlePush = true
+		config.EnableRoomRouting = true
+		config.PushInterval = 20 * time.Millisecond
+	})
+	server.Start()
+	defer server.Stop()
+
+	alice := connectRoomClient(t, server, "room-alice")
+	defer alice.Close()
+	bob := connectRoomClient(t, server, "room-bob")
+	defer bob.Close()
+	carol := connectRoomClient(t, server, "room-carol")
+	defer carol.Close()
+	idle := connectRoomClient(t, server, "room-idle")
+	defer idle.Close()
+
+	// alice、bob通过消息加入同一战斗；carol通过API加入另一场战斗
+	require.NoError(t, alice.JoinRoom(testserver.BattleRoom("alpha")))
+	require.NoError(t, bob.JoinRoom(testserver.BattleRoom("alpha")))
+
+	resp, err := http.Post(fmt.Sprintf("%s/rooms?action=join&room=%s&player=%s",
+		server.GetHTTPURL(), testserver.BattleRoom("beta"), carol.PlayerID()), "application/json", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	require.Eventually(t, func() bool {
+		return alice.received()["alpha"] >= 5 && bob.received()["alpha"] >= 5 && carol.received()["beta"] >= 5
+	}, 3*time.Second, 20*time.Millisecond)
+
+	assert.NotContains(t, alice.received(), "beta", "alice不应收到其他战斗的推送")
+	assert.NotContains(t, carol.received(), "alpha", "carol不应收到其他战斗的推送")
+	assert.Empty(t, idle.received(), "未订阅房间的连接不应收到战斗推送")
+
+	joined, failed := alice.acks()
+	assert.Equal(t, 1, joined, "加入房间应收到应答")
+	assert.Zero(t, failed)
+
+	// 离开后不再收到推送
+	require.NoError(t, alice.LeaveRoom(testserver.BattleRoom("alpha")))
+	require.Eventually(t, func() bool {
+		joined, _ := alice.acks()
+		return joined == 2
+	}, time.Second, 10*time.Millisecond)
+	before := alice.received()["alpha"]
+	time.Sleep(200 * time.Millisecond)
+	assert.Equal(t, before, alice.received()["alpha"], "离开房间后不应再收到推送")
+	assert.Greater(t, bob.received()["alpha"], before, "其他成员仍应收到推送")
+}
+
+// TestRoomFanoutMetrics 测试房间扇出统计
+func TestRoomFanoutMetrics(t *testing.T) {
+	server := testutil.NewTestServerWithConfig(t, func(config *testserver.ServerConfig) {
+		config.EnableBattlePush = false
+		config.EnableRoomRouting = true
+	})
+	server.Start()
+	defer server.Stop()
+
+	const members = 4
+	roomID := testserver.AllianceRoom("dragons")
+	clients := make([]*roomClient, members)
+	for i := range clients {
+		clients[i] = connectRoomClient(t, server, fmt.Sprintf("alliance-%d", i))
+		defer clients[i].Close()
+		require.NoError(t, server.JoinRoom(clients[i].PlayerID(), roomID))
+	}
+
+	// 非法房间ID应被拒绝
+	require.NoError(t, clients[0].JoinRoom("guild:unknown"))
+	require.Eventually(t, func() bool {
+		_, failed := clients[0].acks()
+		return failed == 1
+	}, time.Second, 10*time.Millisecond)
+
+	for seq := uint64(1); seq <= 10; seq++ {
+		delivered, err := server.PushToRoom(roomID, protocol.OpBattlePush, &gamev1.BattlePush{
+			Seq:      seq,
+			BattleId: "alliance-notice",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, members, delivered)
+	}
+
+	for _, client := range clients {
+		require.Eventually(t, func() bool {
+			return client.received()["alliance-notice"] == 10
+		}, time.Second, 10*time.Millisecond)
+	}
+
+	resp, err := http.Get(server.GetHTTPURL() + "/rooms")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	var body struct {
+		Rooms []testserver.RoomStats `json:"rooms"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	require.Len(t, body.Rooms, 1)
+
+	stats := body.Rooms[0]
+	assert.Equal(t, roomID, stats.ID)
+	assert.Equal(t, testserver.RoomAlliance, stats.Kind)
+	assert.Equal(t, members, stats.Members)
+	assert.Equal(t, uint64(10), stats.Pushes)
+	assert.Equal(t, uint64(10*members), stats.TotalRecipients)
+	assert.Equal(t, members, stats.MaxFanout)
+	assert.InDelta(t, float64(members), stats.AvgFanout, 0.001)
+	assert.Greater(t, stats.MaxLatency, time.Duration(0))
+
+	t.Logf("📡 房间扇出: 成员=%d, 平均扇出=%.1f, 平均耗时=%v, 最大耗时=%v",
+		stats.Members, stats.AvgFanout, stats.AvgLatency, stats.MaxLatency)
+
+	// 连接关闭后自动离开房间
+	clients[0].Close()
+	require.Eventually(t, func() bool {
+		stats := server.GetRoomStats()
+		return len(stats) == 1 && stats[0].Members == members-1
+	}, 2*time.Second, 20*time.Millisecond)
+
+	// 最后一个成员离开后房间被删除
+	for _, client := range clients[1:] {
+		client.Close()
+	}
+	require.Eventually(t, func() bool {
+		return len(server.GetRoomStats()) == 0
+	}, 2*time.Second, 20*time.Millisecond)
+}
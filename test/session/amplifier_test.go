@@ -0,0 +1,172 @@
+package session_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"GoSlgBenchmarkTest/internal/auth"
+	"GoSlgBenchmarkTest/internal/protocol"
+	"GoSlgBenchmarkTest/internal/session"
+	gamev1 "GoSlgBenchmarkTest/proto/game/v1"
+)
+
+// buildAmplifySession 构造单个玩家的发送帧：登录、加入战斗房间、三次操作和一次心跳
+func buildAmplifySession(t *testing.T) *session.Session {
+	start := time.Now()
+	at := start
+	frames := make([]*session.MessageFrame, 0)
+	add := func(opcode uint16, message proto.Message) {
+		body, err := proto.Marshal(message)
+		require.NoError(t, err)
+		raw := protocol.EncodeFrame(opcode, body)
+		frames = append(frames, &session.MessageFrame{
+			RawData:   raw,
+			Opcode:    opcode,
+			Body:      raw[len(raw)-len(body):],
+			Timestamp: at,
+			Direction: "send",
+		})
+		at = at.Add(20 * time.Millisecond)
+	}
+
+	add(protocol.OpLoginReq, &gamev1.LoginReq{Token: "recorded_token", DeviceId: "device_1"})
+	add(protocol.OpRoomJoin, wrapperspb.String("battle:b1"))
+	for seq := uint64(41); seq <= 43; seq++ {
+		add(protocol.OpPlayerAction, &gamev1.PlayerAction{
+			ActionSeq:  seq,
+			PlayerId:   "player_recorded",
+			ActionType: gamev1.ActionType_ACTION_TYPE_ATTACK,
+		})
+	}
+	add(protocol.OpHeartbeat, &gamev1.Heartbeat{PingSeq: 7})
+
+	return &session.Session{
+		SchemaVersion: session.CurrentSchemaVersion,
+		ID:            "amplify_source",
+		StartTime:     start,
+		EndTime:       at,
+		Frames:        frames,
+	}
+}
+
+// decodeSent 解码虚拟客户端会话中指定操作码的发送帧
+func decodeSent[T proto.Message](t *testing.T, recorded *session.Session, opcode uint16, newMessage func() T) []T {
+	messages := make([]T, 0)
+	for _, frame := range recorded.Frames {
+		if frame.Direction != "send" || frame.Opcode != opcode {
+			continue
+		}
+		message := newMessage()
+		require.NoError(t, proto.Unmarshal(frame.Body, message))
+		messages = append(messages, message)
+	}
+	return messages
+}
+
+// TestAmplifierSpawnsRewrittenClients 测试虚拟客户端改写令牌、玩家ID、战斗ID和序列号并汇总指标
+func TestAmplifierSpawnsRewrittenClients(t *testing.T) {
+	authenticator := auth.New(nil)
+	server := startReplayTarget(t, authenticator)
+	defer server.Stop()
+
+	config := session.DefaultAmplifierConfig(server.GetWebSocketURL(), 6)
+	config.StartInterval = 20 * time.Millisecond
+	config.Jitter = 0.3
+	config.BattleSize = 3
+	config.Seed = 42
+	config.TokenFor = func(index int) string {
+		token, err := authenticator.Issue(fmt.Sprintf("player_vc_%d", index), "amplified")
+		require.NoError(t, err)
+		return token
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	report, err := session.NewSessionAmplifier(buildAmplifySession(t), config).Run(ctx)
+	require.NoError(t, err)
+	require.Len(t, report.Results, 6)
+	assert.Equal(t, 6, report.Succeeded)
+	assert.Zero(t, report.Failed)
+	assert.Equal(t, 6*6, report.SentFrames)
+	assert.Positive(t, report.SentBytes)
+	assert.Positive(t, report.SendRate)
+
+	for i, result := range report.Results {
+		require.Empty(t, result.Error)
+		assert.Equal(t, fmt.Sprintf("player_vc_%d", i), result.PlayerID)
+		assert.Equal(t, fmt.Sprintf("device_1_vc%d", i), result.DeviceID)
+		assert.Equal(t, fmt.Sprintf("b1_%d", i/3), result.BattleID)
+		assert.Equal(t, time.Duration(i)*20*time.Millisecond, result.StartOffset)
+
+		actions := decodeSent(t, result.Session, protocol.OpPlayerAction, func() *gamev1.PlayerAction { return &gamev1.PlayerAction{} })
+		require.Len(t, actions, 3)
+		for j, action := range actions {
+			assert.Equal(t, uint64(j+1), action.ActionSeq)
+			assert.Equal(t, result.PlayerID, action.PlayerId)
+		}
+		pings := decodeSent(t, result.Session, protocol.OpHeartbeat, func() *gamev1.Heartbeat { return &gamev1.Heartbeat{} })
+		require.Len(t, pings, 1)
+		assert.Equal(t, int32(1), pings[0].PingSeq)
+
+		// 服务器回显的房间响应确认加入的是改写后的战斗房间
+		rooms := framesByOpcode(result.Session, "receive")[protocol.OpRoomResp]
+		require.Len(t, rooms, 1)
+		room := &wrapperspb.StringValue{}
+		require.NoError(t, proto.Unmarshal(rooms[0].Body, room))
+		assert.Equal(t, "battle:"+result.BattleID, room.Value)
+	}
+
+	latency := make(map[uint16]session.LatencyDistribution)
+	for _, entry := range report.Latency {
+		latency[entry.Opcode] = entry.Latency
+	}
+	assert.Equal(t, 6, latency[protocol.OpLoginReq].Count)
+	assert.Equal(t, 18, latency[protocol.OpPlayerAction].Count)
+	assert.Equal(t, 6, latency[protocol.OpHeartbeat].Count)
+	assert.LessOrEqual(t, latency[protocol.OpPlayerAction].P50, latency[protocol.OpPlayerAction].Max)
+}
+
+// TestAmplifierAggregatesFailures 测试部分虚拟客户端登录失败时其余客户端继续运行并汇总错误
+func TestAmplifierAggregatesFailures(t *testing.T) {
+	authenticator := auth.New(nil)
+	server := startReplayTarget(t, authenticator)
+	defer server.Stop()
+
+	config := session.DefaultAmplifierConfig(server.GetWebSocketURL(), 4)
+	config.Speed = session.SpeedInstant
+	config.StartInterval = 0
+	config.TokenFor = func(index int) string {
+		if index%2 == 1 {
+			return "" // 沿用录制的令牌，服务器拒绝
+		}
+		token, err := authenticator.Issue(fmt.Sprintf("player_vc_%d", index), "amplified")
+		require.NoError(t, err)
+		return token
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	report, err := session.NewSessionAmplifier(buildAmplifySession(t), config).Run(ctx)
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, report.Succeeded)
+	assert.Equal(t, 2, report.Failed)
+	assert.Equal(t, map[string]int{"login rejected": 2}, report.Errors)
+	for i, result := range report.Results {
+		if i%2 == 1 {
+			assert.Equal(t, 1, result.SentFrames)
+		} else {
+			assert.Equal(t, 6, result.SentFrames)
+		}
+	}
+
+	_, err = session.NewSessionAmplifier(&session.Session{ID: "empty"}, config).Run(ctx)
+	assert.ErrorIs(t, err, session.ErrNothingToReplay)
+}
@@ -0,0 +1,212 @@
+package session_test
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"GoSlgBenchmarkTest/internal/protocol"
+	"GoSlgBenchmarkTest/internal/session"
+)
+
+// buildAssertionSession 构造断言用的会话：前5秒操作响应较慢，6秒时出错，7秒时重连
+func buildAssertionSession() *session.Session {
+	start := time.Unix(1_700_000_000, 0)
+	at := func(ms int) time.Time { return start.Add(time.Duration(ms) * time.Millisecond) }
+
+	events := []*session.SessionEvent{{ID: "connect", Type: session.EventConnect, Timestamp: at(0)}}
+	for i := 1; i <= 10; i++ {
+		latency := 50 * time.Millisecond
+		if i < 5 {
+			latency = 500 * time.Millisecond
+		}
+		events = append(events,
+			&session.SessionEvent{Type: session.EventMessageReceive, Opcode: protocol.OpActionResp, Timestamp: at(i * 1000), Duration: latency},
+			&session.SessionEvent{Type: session.EventMessageReceive, Opcode: protocol.OpBattlePush, Timestamp: at(i*1000 + 10), Duration: 20 * time.Millisecond},
+		)
+	}
+	events = append(events,
+		&session.SessionEvent{Type: session.EventError, Error: "boom", Timestamp: at(6500)},
+		&session.SessionEvent{Type: session.EventReconnect, Timestamp: at(7500)},
+	)
+	return &session.Session{
+		SchemaVersion: session.CurrentSchemaVersion,
+		ID:            "assert_session",
+		StartTime:     start,
+		EndTime:       at(11000),
+		Events:        events,
+		Stats:         &session.SessionStats{},
+	}
+}
+
+// buildSuite 解析并构建YAML断言套件
+func buildSuite(t *testing.T, text string) *session.AssertionSuite {
+	spec, err := session.ParseAssertionSuiteSpec(strings.NewReader(text))
+	require.NoError(t, err)
+	suite, err := spec.Build()
+	require.NoError(t, err)
+	return suite
+}
+
+// TestAssertionSuiteFromYAML 测试YAML断言的过滤、时间窗口和布尔组合
+func TestAssertionSuiteFromYAML(t *testing.T) {
+	suite := buildSuite(t, `
+name: yaml suite
+assertions:
+  - name: all latency
+    type: latency
+    max_latency: 100ms
+  - name: action latency after warmup
+    type: latency
+    max_latency: 100ms
+    percentile: 99
+    filter: {opcodes: [2003], from: 5s}
+  - name: push order
+    type: message_order
+    opcode: 2001
+    min_count: 10
+    max_count: 10
+  - name: push order in window
+    type: message_order
+    opcode: 2001
+    min_count: 3
+    max_count: 3
+    filter: {from: 2s, to: 5s}
+  - name: stable or few errors
+    any:
+      - {type: reconnect, max_count: 0}
+      - {type: error_rate, max_rate: 0.1}
+  - name: has reconnected
+    not: {type: reconnect, max_count: 0}
+  - name: no errors before fault
+    type: error_rate
+    max_rate: 0
+    filter: {to: 6s}
+  - name: no errors
+    type: error_rate
+    max_rate: 0
+  - name: throughput and budget
+    all:
+      - {type: goodput, min_goodput: 0.5, window: 2s}
+      - {type: tail_latency_budget, budget: 1s}
+      - {type: recovery_time, max_recovery_time: 5s}
+      - {type: planned_fault, exemption_zone: 5}
+  - name: send only
+    type: message_order
+    opcode: 2001
+    filter: {directions: [send]}
+`)
+	results := suite.RunAssertions(buildAssertionSession())
+
+	passed := map[string]bool{}
+	for i, result := range results {
+		passed[suite.Assertions[i].GetName()] = result.Passed
+	}
+	assert.Equal(t, map[string]bool{
+		"all latency":                 false,
+		"action latency after warmup": true,
+		"push order":                  true,
+		"push order in window":        true,
+		"stable or few errors":        true,
+		"has reconnected":             true,
+		"no errors before fault":      true,
+		"no errors":                   false,
+		"throughput and budget":       true,
+		"send only":                   true,
+	}, passed)
+	assert.Equal(t, "yaml suite", suite.Name)
+
+	// 组合断言的结果中列出子断言
+	composite := results[4]
+	assert.Contains(t, composite.Message, "1/2")
+	assert.Contains(t, composite.Actual, "[FAIL] assertions[4].any[0]")
+}
+
+// TestAssertionSpecValidation 测试描述错误时带有断言路径的报错
+func TestAssertionSpecValidation(t *testing.T) {
+	cases := map[string]struct {
+		yaml string
+		err  string
+	}{
+		"未知类型":  {`assertions: [{type: jitter}]`, `assertions[0]: unknown assertion type "jitter"`},
+		"未知字段":  {`assertions: [{type: latency, max_latncy: 1s}]`, "max_latncy"},
+		"类型与组合": {`assertions: [{type: latency, all: [{type: error_rate}]}]`, "cannot be combined"},
+		"缺少参数":  {`assertions: [{type: error_rate}, {any: [{type: error_rate}, {type: message_order}]}]`, "assertions[1].any[1]: message_order: opcode is required"},
+		"多个组合":  {`assertions: [{any: [{type: error_rate}], not: {type: error_rate}}]`, "only one of"},
+		"无效方向":  {`assertions: [{type: error_rate, filter: {directions: [up]}}]`, `unknown direction "up"`},
+		"无效窗口":  {`assertions: [{type: error_rate, filter: {from: 5s, to: 1s}}]`, "invalid time window"},
+		"空套件":   {`name: empty`, "no assertions"},
+		"无效时长":  {`assertions: [{type: latency, max_latency: soon}]`, "parse assertion suite"},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			spec, err := session.ParseAssertionSuiteSpec(strings.NewReader(tc.yaml))
+			if err == nil {
+				_, err = spec.Build()
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tc.err)
+		})
+	}
+}
+
+// TestAssertionSuiteJUnit 测试JUnit XML报告
+func TestAssertionSuiteJUnit(t *testing.T) {
+	suite := buildSuite(t, `
+name: junit suite
+assertions:
+  - {name: passing, type: error_rate, max_rate: 0.5}
+  - {name: failing, description: 不允许重连, type: reconnect, max_count: 0}
+`)
+	var buf bytes.Buffer
+	assert.Error(t, suite.WriteJUnit(&buf, "assert_session"), "尚未运行")
+
+	suite.RunAssertions(buildAssertionSession())
+	require.NoError(t, suite.WriteJUnit(&buf, "assert_session"))
+	assert.True(t, strings.HasPrefix(buf.String(), xml.Header))
+
+	var report struct {
+		Tests    int `xml:"tests,attr"`
+		Failures int `xml:"failures,attr"`
+		Suites   []struct {
+			Name  string `xml:"name,attr"`
+			Cases []struct {
+				Name      string `xml:"name,attr"`
+				Classname string `xml:"classname,attr"`
+				Failure   *struct {
+					Message string `xml:"message,attr"`
+					Text    string `xml:",chardata"`
+				} `xml:"failure"`
+			} `xml:"testcase"`
+		} `xml:"testsuite"`
+	}
+	require.NoError(t, xml.Unmarshal(buf.Bytes(), &report))
+	assert.Equal(t, 2, report.Tests)
+	assert.Equal(t, 1, report.Failures)
+	require.Len(t, report.Suites, 1)
+	assert.Equal(t, "junit suite", report.Suites[0].Name)
+
+	cases := report.Suites[0].Cases
+	require.Len(t, cases, 2)
+	assert.Equal(t, "junit suite.assert_session", cases[0].Classname)
+	assert.Nil(t, cases[0].Failure)
+	require.NotNil(t, cases[1].Failure)
+	assert.Equal(t, "failing", cases[1].Name)
+	assert.Contains(t, cases[1].Failure.Message, "1 reconnects exceed maximum 0")
+	assert.Contains(t, cases[1].Failure.Text, "不允许重连")
+}
+
+// TestExampleAssertionSuite 测试仓库中的示例套件覆盖所有内置断言类型
+func TestExampleAssertionSuite(t *testing.T) {
+	suite, err := session.LoadAssertionSuite("../../configs/assertion-suite.yaml")
+	require.NoError(t, err)
+	assert.Len(t, suite.Assertions, 6)
+
+	results := suite.RunAssertions(buildAssertionSession())
+	assert.Len(t, results, 6)
+}
@@ -0,0 +1,190 @@
+package session_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+
+	"GoSlgBenchmarkTest/internal/protocol"
+	"GoSlgBenchmarkTest/internal/session"
+	gamev1 "GoSlgBenchmarkTest/proto/game/v1"
+)
+
+var battleStart = time.Unix(1_700_000_000, 0)
+
+// battleAt 战斗开始后的毫秒时刻
+func battleAt(ms int) time.Time {
+	return battleStart.Add(time.Duration(ms) * time.Millisecond)
+}
+
+// battleFrame 构造指定时刻收到或发送的帧
+func battleFrame(t *testing.T, direction string, opcode uint16, message proto.Message, at time.Time) *session.MessageFrame {
+	body, err := proto.Marshal(message)
+	require.NoError(t, err)
+	raw := protocol.EncodeFrame(opcode, body)
+	return &session.MessageFrame{
+		RawData:   raw,
+		Opcode:    opcode,
+		Body:      raw[protocol.FrameHeaderSize:],
+		Timestamp: at,
+		Direction: direction,
+	}
+}
+
+// pushAt 构造一条战斗推送帧，服务器时间戳与接收时间一致
+func pushAt(t *testing.T, ms int, battleID string, seq uint64, hash string, units ...*gamev1.BattleUnit) *session.MessageFrame {
+	return battleFrame(t, "receive", protocol.OpBattlePush, &gamev1.BattlePush{
+		Seq:       seq,
+		BattleId:  battleID,
+		StateHash: []byte(hash),
+		Units:     units,
+		Timestamp: battleAt(ms).UnixMilli(),
+	}, battleAt(ms))
+}
+
+// unitAt 构造战斗单位
+func unitAt(id string, hp int32, x, y float32) *gamev1.BattleUnit {
+	return &gamev1.BattleUnit{UnitId: id, Hp: hp, Position: &gamev1.Position{X: x, Y: y}}
+}
+
+// skillAt 构造一次技能操作帧
+func skillAt(t *testing.T, ms int, skillID int32, targets ...string) *session.MessageFrame {
+	return battleFrame(t, "send", protocol.OpPlayerAction, &gamev1.PlayerAction{
+		ActionType: gamev1.ActionType_ACTION_TYPE_SKILL,
+		ActionData: &gamev1.ActionData{Data: &gamev1.ActionData_Skill{Skill: &gamev1.SkillAction{SkillId: skillID, TargetUnitIds: targets}}},
+	}, battleAt(ms))
+}
+
+// battleSession 由帧构造会话
+func battleSession(id string, frames ...*session.MessageFrame) *session.Session {
+	return &session.Session{
+		SchemaVersion: session.CurrentSchemaVersion,
+		ID:            id,
+		StartTime:     battleStart,
+		Frames:        frames,
+		Stats:         &session.SessionStats{},
+	}
+}
+
+// TestBattleSequenceAssertion 测试每场战斗的序列号严格递增
+func TestBattleSequenceAssertion(t *testing.T) {
+	assertion := session.NewBattleSequenceAssertion("battle seq", "")
+
+	ordered := battleSession("ordered",
+		pushAt(t, 0, "A", 1, "h"), pushAt(t, 10, "B", 2, "h"), pushAt(t, 20, "A", 3, "h"),
+		pushAt(t, 30, "B", 4, "h"), pushAt(t, 40, "A", 5, "h"),
+	)
+	result := assertion.Assert(ordered)
+	assert.True(t, result.Passed, result.Message)
+	assert.Contains(t, result.Message, "5 pushes across 2 battles")
+
+	broken := battleSession("broken", append(ordered.Frames,
+		pushAt(t, 50, "A", 4, "h"),
+		pushAt(t, 60, "B", 4, "h"),
+		&session.MessageFrame{Opcode: protocol.OpBattlePush, Direction: "receive", Body: []byte{0xFF}},
+	)...)
+	result = assertion.Assert(broken)
+	assert.False(t, result.Passed)
+	assert.Contains(t, result.Message, "3 violations")
+	assert.Contains(t, result.Actual, "battle A: seq 4 received after 5")
+	assert.Contains(t, result.Actual, "battle B: seq 4 received after 4")
+	assert.Contains(t, result.Actual, "undecodable")
+}
+
+// TestStateHashAgreementAssertion 测试多个客户端的状态哈希一致性
+func TestStateHashAgreementAssertion(t *testing.T) {
+	client1 := battleSession("client1", pushAt(t, 0, "A", 1, "h1"), pushAt(t, 10, "A", 2, "h2"), pushAt(t, 20, "B", 3, "h3"))
+	client2 := battleSession("client2", pushAt(t, 1, "A", 1, "h1"), pushAt(t, 11, "A", 2, "h2"))
+	desynced := battleSession("client3", pushAt(t, 2, "A", 1, "h1"), pushAt(t, 12, "A", 2, "XX"))
+
+	result := session.NewStateHashAgreementAssertion("hash", "", client2).Assert(client1)
+	assert.True(t, result.Passed, result.Message)
+	assert.Contains(t, result.Message, "3 battle states, 2 seen by multiple sessions")
+
+	result = session.NewStateHashAgreementAssertion("hash", "", client2, desynced).Assert(client1)
+	assert.False(t, result.Passed)
+	assert.Contains(t, result.Message, "1 violations")
+	assert.Contains(t, result.Actual, "battle A seq 2: client1=6832, client3=5858")
+
+	// YAML套件通过AttachPeers获得其他客户端的录制，组合断言内同样生效
+	suite := buildSuite(t, `
+assertions:
+  - name: consistency
+    all:
+      - {type: battle_sequence}
+      - {type: state_hash}
+`)
+	suite.RunAssertions(client1)
+	assert.Equal(t, 1, suite.GetPassedCount(), "没有其他客户端时只检查会话内部")
+	suite.AttachPeers(desynced)
+	results := suite.RunAssertions(client1)
+	assert.False(t, results[0].Passed)
+	assert.Contains(t, results[0].Actual, "State hash agreement assertion failed")
+}
+
+// TestUnitSanityAssertion 测试无治疗的回血和超速移动
+func TestUnitSanityAssertion(t *testing.T) {
+	pushes := []*session.MessageFrame{
+		pushAt(t, 0, "A", 1, "h", unitAt("u1", 100, 0, 0), unitAt("u2", 50, 0, 0)),
+		pushAt(t, 1000, "A", 2, "h", unitAt("u1", 80, 3, 4), unitAt("u2", 40, 0, 0)),
+		pushAt(t, 2000, "A", 3, "h", unitAt("u1", 90, 3, 4), unitAt("u2", 45, 0, 0)),
+	}
+
+	// u1在1秒内移动5，两个单位都在没有治疗的情况下回血
+	assertion := session.NewUnitSanityAssertion("units", "", 4)
+	result := assertion.Assert(battleSession("no_heal", pushes...))
+	assert.False(t, result.Passed)
+	assert.Contains(t, result.Message, "3 violations")
+	assert.Contains(t, result.Actual, "unit u1: moved 5.00 in 1s (5.00/s > 4.00/s")
+	assert.Contains(t, result.Actual, "unit u1: hp 80 -> 90 without heal (seq 2 -> 3)")
+	assert.Contains(t, result.Actual, "unit u2: hp 40 -> 45 without heal")
+
+	// 治疗u1的技能只解释u1的回血；提高速度上限后不再超速
+	assertion = session.NewUnitSanityAssertion("units", "", 10)
+	healed := append([]*session.MessageFrame{skillAt(t, 1500, 7, "u1")}, pushes...)
+	result = assertion.Assert(battleSession("heal_u1", healed...))
+	assert.False(t, result.Passed)
+	assert.Contains(t, result.Message, "1 violations")
+	assert.Contains(t, result.Actual, "unit u2")
+
+	// 没有目标的技能可能治疗任何单位，但必须在治疗窗口内且属于治疗技能
+	area := append([]*session.MessageFrame{skillAt(t, 1500, 7)}, pushes...)
+	assert.True(t, assertion.Assert(battleSession("area_heal", area...)).Passed)
+
+	assertion.HealSkills = []int32{9}
+	assert.False(t, assertion.Assert(battleSession("not_heal_skill", area...)).Passed)
+
+	assertion.HealSkills = nil
+	stale := append([]*session.MessageFrame{skillAt(t, 500, 7)}, pushes...)
+	assert.False(t, assertion.Assert(battleSession("stale_heal", stale...)).Passed, "治疗早于窗口")
+
+	// 其他客户端施放的治疗同样有效
+	assertion.Peers = []*session.Session{battleSession("healer", skillAt(t, 1800, 7, "u1", "u2"))}
+	result = assertion.Assert(battleSession("peer_heal", pushes...))
+	assert.True(t, result.Passed, result.Actual)
+	assert.Contains(t, result.Message, "2 units checked across 3 pushes")
+}
+
+// TestBattleAssertionsInYAML 测试在YAML中配置单位合理性断言
+func TestBattleAssertionsInYAML(t *testing.T) {
+	suite := buildSuite(t, `
+assertions:
+  - {name: slow units, type: unit_sanity, max_speed: 10, heal_skills: [7], heal_window: 2s}
+`)
+	frames := []*session.MessageFrame{
+		pushAt(t, 0, "A", 1, "h", unitAt("u1", 80, 0, 0)),
+		skillAt(t, 100, 7, "u1"),
+		pushAt(t, 1500, "A", 2, "h", unitAt("u1", 90, 0, 0)),
+	}
+	results := suite.RunAssertions(battleSession("yaml", frames...))
+	assert.True(t, results[0].Passed, results[0].Actual)
+
+	spec, err := session.ParseAssertionSuiteSpec(strings.NewReader(`assertions: [{type: unit_sanity, heal_window: -1s}]`))
+	require.NoError(t, err)
+	_, err = spec.Build()
+	assert.ErrorContains(t, err, "must not be negative")
+}
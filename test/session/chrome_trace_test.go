@@ -0,0 +1,144 @@
+package session_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"GoSlgBenchmarkTest/internal/protocol"
+	"GoSlgBenchmarkTest/internal/session"
+)
+
+// buildTraceSession 构造包含登录、心跳、操作、错误和一次重连的会话
+func buildTraceSession(id string, start time.Time) *session.Session {
+	events := make([]*session.SessionEvent, 0)
+	add := func(offset time.Duration, eventType session.EventType, opcode uint16) *session.SessionEvent {
+		event := &session.SessionEvent{
+			Type:      eventType,
+			Timestamp: start.Add(offset),
+			Opcode:    opcode,
+			Metadata:  map[string]interface{}{},
+		}
+		events = append(events, event)
+		return event
+	}
+
+	add(0, session.EventConnect, 0)
+	add(1*time.Millisecond, session.EventMessageSend, protocol.OpLoginReq)
+	add(11*time.Millisecond, session.EventMessageReceive, protocol.OpLoginResp)
+	add(100*time.Millisecond, session.EventMessageSend, protocol.OpHeartbeat)
+	add(105*time.Millisecond, session.EventMessageReceive, protocol.OpHeartbeatResp)
+	add(200*time.Millisecond, session.EventMessageSend, protocol.OpPlayerAction)
+	add(230*time.Millisecond, session.EventMessageReceive, protocol.OpActionResp)
+	add(250*time.Millisecond, session.EventMessageReceive, protocol.OpBattlePush)
+	add(300*time.Millisecond, session.EventError, 0).Error = "read timeout"
+	add(310*time.Millisecond, session.EventDisconnect, 0).Metadata["reason"] = "timeout"
+	add(500*time.Millisecond, session.EventReconnect, 0).Metadata["attempt"] = 1
+	add(510*time.Millisecond, session.EventMessageSend, protocol.OpPlayerAction)
+	add(600*time.Millisecond, session.EventClose, 0)
+
+	return &session.Session{
+		SchemaVersion: session.CurrentSchemaVersion,
+		ID:            id,
+		StartTime:     start,
+		EndTime:       start.Add(600 * time.Millisecond),
+		Events:        events,
+	}
+}
+
+// eventsByPhase 按阶段和名称筛选trace事件
+func eventsByPhase(trace *session.ChromeTrace, pid int, phase, name string) []*session.TraceEvent {
+	result := make([]*session.TraceEvent, 0)
+	for _, event := range trace.TraceEvents {
+		if event.PID == pid && event.Phase == phase && (name == "" || event.Name == name) {
+			result = append(result, event)
+		}
+	}
+	return result
+}
+
+// TestChromeTraceTracksAndSpans 测试连接轨道、请求区间、即时事件和RTT计数器
+func TestChromeTraceTracksAndSpans(t *testing.T) {
+	start := time.Unix(1_700_000_000, 0)
+	trace := session.BuildChromeTrace([]*session.Session{buildTraceSession("player_1", start)}, nil)
+
+	// 重连把会话切分成两条连接轨道
+	connections := eventsByPhase(trace, 1, "X", "")
+	require.Len(t, connections, 2)
+	assert.Equal(t, 1, connections[0].TID)
+	assert.InDelta(t, 310_000, connections[0].Duration, 1)
+	assert.Equal(t, 2, connections[1].TID)
+	assert.InDelta(t, 500_000, connections[1].Timestamp, 1)
+	assert.Equal(t, "reconnect", connections[1].Args["started_by"])
+
+	// 登录和操作配对为异步区间，心跳只产生RTT样本
+	begins := eventsByPhase(trace, 1, "b", "")
+	ends := eventsByPhase(trace, 1, "e", "")
+	require.Len(t, begins, 2)
+	require.Len(t, ends, 2)
+	assert.Equal(t, "LOGIN_REQ", begins[0].Name)
+	assert.Equal(t, begins[0].ID, ends[0].ID)
+	assert.InDelta(t, 10.0, ends[0].Args["rtt_ms"], 0.001)
+	assert.Equal(t, "PLAYER_ACTION", begins[1].Name)
+	assert.InDelta(t, 30.0, ends[1].Args["rtt_ms"], 0.001)
+
+	counters := eventsByPhase(trace, 1, "C", "RTT (ms)")
+	require.Len(t, counters, 3)
+	assert.InDelta(t, 5.0, counters[1].Args["rtt"], 0.001)
+
+	// 重连、错误、心跳和未应答请求为即时事件
+	assert.Len(t, eventsByPhase(trace, 1, "i", "reconnect"), 1)
+	errors := eventsByPhase(trace, 1, "i", "error")
+	require.Len(t, errors, 1)
+	assert.Equal(t, "read timeout", errors[0].Args["error"])
+	assert.Len(t, eventsByPhase(trace, 1, "i", "HEARTBEAT"), 1)
+	assert.Len(t, eventsByPhase(trace, 1, "i", "BATTLE_PUSH"), 1)
+	unanswered := eventsByPhase(trace, 1, "i", "PLAYER_ACTION unanswered")
+	require.Len(t, unanswered, 1)
+	assert.Equal(t, 2, unanswered[0].TID)
+
+	// 不输出未配对消息
+	compact := session.BuildChromeTrace([]*session.Session{buildTraceSession("player_1", start)},
+		&session.ChromeTraceOptions{OmitMessages: true})
+	assert.Empty(t, eventsByPhase(compact, 1, "i", "BATTLE_PUSH"))
+}
+
+// TestChromeTraceMultiplePlayers 测试多个玩家共用时间原点并输出为合法JSON
+func TestChromeTraceMultiplePlayers(t *testing.T) {
+	start := time.Unix(1_700_000_000, 0)
+	sessions := []*session.Session{
+		buildTraceSession("player_1", start),
+		buildTraceSession("player_2", start.Add(2*time.Second)),
+	}
+
+	var buffer bytes.Buffer
+	require.NoError(t, session.WriteChromeTrace(&buffer, sessions, nil))
+
+	var decoded session.ChromeTrace
+	require.NoError(t, json.Unmarshal(buffer.Bytes(), &decoded))
+	assert.Equal(t, "ms", decoded.DisplayTimeUnit)
+
+	names := make(map[int]string)
+	for _, event := range eventsByPhase(&decoded, 1, "M", "process_name") {
+		names[1] = event.Args["name"].(string)
+	}
+	for _, event := range eventsByPhase(&decoded, 2, "M", "process_name") {
+		names[2] = event.Args["name"].(string)
+	}
+	assert.Equal(t, map[int]string{1: "player_1", 2: "player_2"}, names)
+
+	second := eventsByPhase(&decoded, 2, "X", "")
+	require.NotEmpty(t, second)
+	assert.InDelta(t, 2_000_000, second[0].Timestamp, 1)
+
+	// 分析器导出单个会话
+	buffer.Reset()
+	analyzer := session.NewTimelineAnalyzer(sessions[0])
+	require.NoError(t, analyzer.WriteChromeTrace(&buffer, nil))
+	require.NoError(t, json.Unmarshal(buffer.Bytes(), &decoded))
+	assert.Empty(t, eventsByPhase(&decoded, 2, "M", ""))
+}
@@ -0,0 +1,231 @@
+package session_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"GoSlgBenchmarkTest/internal/protocol"
+	"GoSlgBenchmarkTest/internal/session"
+)
+
+// flightConfig 只保留窗口、不限流不去重的测试配置
+func flightConfig(dir string) *session.FlightRecorderConfig {
+	return &session.FlightRecorderConfig{
+		Window:                 time.Minute,
+		SnapshotDir:            dir,
+		TriggerOnError:         true,
+		TriggerOnAbnormalClose: true,
+	}
+}
+
+// TestFlightRecorderWindow 测试按时间窗口裁剪缓冲区
+func TestFlightRecorderWindow(t *testing.T) {
+	recorder := session.NewSessionRecorder("flight_window")
+	require.NoError(t, recorder.EnableFlightRecorder(flightConfig(t.TempDir())))
+
+	base := time.Now()
+	for i := 0; i < 30; i++ {
+		recorder.RecordEvent(session.EventHeartbeat, map[string]interface{}{"timestamp": base.Add(time.Duration(i) * 10 * time.Second)})
+	}
+
+	events := recorder.GetEvents()
+	latest := base.Add(290 * time.Second)
+	require.Len(t, events, 7, "最近1分钟内的心跳")
+	assert.Equal(t, latest.Add(-time.Minute), events[0].Timestamp)
+	assert.Equal(t, latest, events[len(events)-1].Timestamp)
+
+	stats := recorder.FlightStats()
+	assert.EqualValues(t, 24, stats.DroppedEvents, "连接事件和前23个心跳")
+	assert.Equal(t, 7, stats.BufferedEvents)
+}
+
+// TestFlightRecorderMaxBytes 测试按大小上限裁剪，丢弃最旧的记录
+func TestFlightRecorderMaxBytes(t *testing.T) {
+	recorder := session.NewSessionRecorder("flight_bytes")
+	require.NoError(t, recorder.EnableFlightRecorder(&session.FlightRecorderConfig{
+		MaxBytes:    64 * 1024,
+		SnapshotDir: t.TempDir(),
+	}))
+
+	body := make([]byte, 1024)
+	for i := 1; i <= 1000; i++ {
+		raw := protocol.EncodeFrame(protocol.OpBattlePush, body)
+		recorder.RecordMessage("receive", raw, protocol.OpBattlePush, raw[protocol.FrameHeaderSize:], uint64(i))
+	}
+
+	stats := recorder.FlightStats()
+	assert.LessOrEqual(t, stats.BufferedBytes, int64(64*1024))
+	assert.Greater(t, stats.BufferedFrames, 10)
+	assert.Less(t, stats.BufferedFrames, 40)
+	assert.Positive(t, stats.DroppedFrames)
+
+	frames := recorder.GetFrames()
+	assert.EqualValues(t, 1000, frames[len(frames)-1].SequenceNum, "保留最新的帧")
+
+	assert.Error(t, session.NewSessionRecorder("x").EnableFlightRecorder(&session.FlightRecorderConfig{SnapshotDir: "x"}), "没有任何上限")
+	assert.Error(t, recorder.EnableFlightRecorder(flightConfig(t.TempDir())), "重复启用")
+}
+
+// TestFlightRecorderTriggers 测试错误、异常关闭、延迟尖刺和接口触发的快照，以及去重和限流
+func TestFlightRecorderTriggers(t *testing.T) {
+	dir := t.TempDir()
+	config := flightConfig(dir)
+	config.LatencyThreshold = 500 * time.Millisecond
+	config.DedupWindow = time.Hour
+	var notified []session.FlightSnapshot
+	config.OnSnapshot = func(snapshot session.FlightSnapshot) { notified = append(notified, snapshot) }
+
+	recorder := session.NewSessionRecorder("flight_triggers")
+	_, err := recorder.Snapshot("before enable")
+	assert.Error(t, err)
+	require.NoError(t, recorder.EnableFlightRecorder(config))
+
+	raw := protocol.EncodeFrame(protocol.OpPlayerAction, []byte{1, 2, 3})
+	recorder.RecordMessage("send", raw, protocol.OpPlayerAction, raw[protocol.FrameHeaderSize:], 1)
+	recorder.RecordError(errors.New("desync"), nil)
+	recorder.WaitFlightSnapshots()
+	recorder.RecordError(errors.New("desync"), nil) // 相同原因被去重
+	recorder.RecordError(errors.New("timeout"), nil)
+	recorder.WaitFlightSnapshots()
+	recorder.RecordLatency(100 * time.Millisecond)
+	recorder.RecordLatency(900 * time.Millisecond)
+	recorder.WaitFlightSnapshots()
+	snapshot, err := recorder.Snapshot("operator")
+	require.NoError(t, err)
+	assert.Equal(t, session.TriggerManual, snapshot.Trigger)
+	recorder.RecordClose(session.CloseAbnormal, "connection lost")
+	recorder.WaitFlightSnapshots()
+
+	snapshots := recorder.FlightSnapshots()
+	triggers := make([]string, 0, len(snapshots))
+	for _, snapshot := range snapshots {
+		triggers = append(triggers, snapshot.Trigger)
+	}
+	assert.Equal(t, []string{"error", "error", "latency", "manual", "close"}, triggers)
+	assert.Equal(t, snapshots, notified)
+	assert.Equal(t, "desync", snapshots[0].Reason)
+	assert.Contains(t, snapshots[2].Reason, "900ms exceeds 500ms")
+	assert.Equal(t, "close code 1006: connection lost", snapshots[4].Reason)
+	assert.Equal(t, 1, recorder.FlightStats().Suppressed)
+
+	// 快照是完整的会话文件，包含触发前的记录和触发事件本身
+	recorded, err := session.LoadSession(snapshots[0].Path)
+	require.NoError(t, err)
+	assert.Equal(t, "flight_triggers", recorded.ID)
+	require.Len(t, recorded.Frames, 1)
+	last := recorded.Events[len(recorded.Events)-1]
+	assert.Equal(t, session.EventError, last.Type)
+	assert.Equal(t, snapshots[0].Events, len(recorded.Events))
+
+	files, err := filepath.Glob(filepath.Join(dir, "flight_flight_triggers_*.slgs"))
+	require.NoError(t, err)
+	assert.Len(t, files, 5)
+
+	// 正常关闭不触发
+	normal := session.NewSessionRecorder("flight_normal")
+	require.NoError(t, normal.EnableFlightRecorder(flightConfig(t.TempDir())))
+	normal.RecordClose(session.CloseNormal, "done")
+	assert.Empty(t, normal.FlightSnapshots())
+}
+
+// TestFlightRecorderRateLimit 测试快照限流和数量上限
+func TestFlightRecorderRateLimit(t *testing.T) {
+	config := flightConfig(t.TempDir())
+	config.MinInterval = time.Hour
+	recorder := session.NewSessionRecorder("flight_rate")
+	require.NoError(t, recorder.EnableFlightRecorder(config))
+
+	recorder.RecordError(errors.New("first"), nil)
+	recorder.RecordError(errors.New("second"), nil)
+	_, err := recorder.Snapshot("api")
+	assert.ErrorIs(t, err, session.ErrSnapshotSuppressed)
+	recorder.WaitFlightSnapshots()
+	assert.Len(t, recorder.FlightSnapshots(), 1)
+	assert.Equal(t, 2, recorder.FlightStats().Suppressed)
+
+	config = flightConfig(t.TempDir())
+	config.MaxSnapshots = 2
+	limited := session.NewSessionRecorder("flight_limit")
+	require.NoError(t, limited.EnableFlightRecorder(config))
+	for _, message := range []string{"a", "b", "c"} {
+		limited.RecordError(errors.New(message), nil)
+		limited.WaitFlightSnapshots()
+	}
+	assert.Len(t, limited.FlightSnapshots(), 2)
+}
+
+// TestFlightRecorderWritesInBackground 测试快照在后台写出，写出期间记录调用立即返回，其余触发被跳过
+func TestFlightRecorderWritesInBackground(t *testing.T) {
+	config := flightConfig(t.TempDir())
+	release := make(chan struct{})
+	config.OnSnapshot = func(snapshot session.FlightSnapshot) { <-release } // 写出槽位在回调返回后才释放
+	recorder := session.NewSessionRecorder("flight_async")
+	require.NoError(t, recorder.EnableFlightRecorder(config))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		recorder.RecordError(errors.New("first"), nil)
+		recorder.RecordError(errors.New("second"), nil)
+		recorder.RecordLatency(time.Second)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		require.FailNow(t, "快照写出期间RecordError不应阻塞")
+	}
+
+	_, err := recorder.Snapshot("operator")
+	assert.ErrorIs(t, err, session.ErrSnapshotSuppressed, "同一时间只写一个快照")
+	assert.Equal(t, 2, recorder.FlightStats().Suppressed)
+
+	close(release)
+	recorder.WaitFlightSnapshots()
+	snapshots := recorder.FlightSnapshots()
+	require.Len(t, snapshots, 1)
+	assert.Equal(t, "first", snapshots[0].Reason)
+
+	// 写完后可以再次触发
+	recorder.RecordError(errors.New("third"), nil)
+	recorder.WaitFlightSnapshots()
+	assert.Len(t, recorder.FlightSnapshots(), 2)
+}
+
+// TestFlightRecorderAssertionTrigger 测试断言失败触发快照
+func TestFlightRecorderAssertionTrigger(t *testing.T) {
+	dir := t.TempDir()
+	config := flightConfig(dir)
+	config.TriggerOnError = false
+	config.Assertions = buildSuite(t, `assertions: [{name: no errors, type: error_rate, max_rate: 0}]`)
+	config.AssertionInterval = 10 * time.Millisecond
+	config.DedupWindow = time.Hour
+
+	recorder := session.NewSessionRecorder("flight_assert")
+	defer recorder.Stop()
+	require.NoError(t, recorder.EnableFlightRecorder(config))
+
+	time.Sleep(50 * time.Millisecond)
+	assert.Empty(t, recorder.FlightSnapshots(), "断言通过时不触发")
+
+	recorder.RecordError(errors.New("boom"), nil)
+	require.Eventually(t, func() bool { return len(recorder.FlightSnapshots()) == 1 }, 5*time.Second, 10*time.Millisecond)
+
+	snapshot := recorder.FlightSnapshots()[0]
+	assert.Equal(t, session.TriggerAssertion, snapshot.Trigger)
+	assert.Contains(t, snapshot.Reason, "no errors")
+	_, err := os.Stat(snapshot.Path)
+	assert.NoError(t, err)
+
+	// 断言持续失败且错误率变化，消息不同但仍是同一断言，按名称去重
+	recorder.RecordError(errors.New("boom again"), nil)
+	suppressed := recorder.FlightStats().Suppressed
+	require.Eventually(t, func() bool { return recorder.FlightStats().Suppressed > suppressed }, 5*time.Second, 10*time.Millisecond)
+	recorder.WaitFlightSnapshots()
+	assert.Len(t, recorder.FlightSnapshots(), 1)
+}
@@ -0,0 +1,189 @@
+package session_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+
+	"GoSlgBenchmarkTest/internal/auth"
+	"GoSlgBenchmarkTest/internal/protocol"
+	"GoSlgBenchmarkTest/internal/session"
+	"GoSlgBenchmarkTest/internal/testserver"
+	"GoSlgBenchmarkTest/internal/testutil"
+	"GoSlgBenchmarkTest/internal/wsclient"
+	gamev1 "GoSlgBenchmarkTest/proto/game/v1"
+)
+
+// startReplayTarget 启动回放目标服务器，玩家ID取自令牌
+func startReplayTarget(t *testing.T, authenticator *auth.Authenticator) *testutil.TestServer {
+	server := testutil.NewTestServerWithConfig(t, func(config *testserver.ServerConfig) {
+		config.EnableBattlePush = false
+		config.Authenticator = authenticator
+	})
+	server.Start()
+	return server
+}
+
+// recordPlaySession 录制一段包含登录、心跳、操作和房间订阅的客户端会话，并经JSON导出加载
+func recordPlaySession(t *testing.T, authenticator *auth.Authenticator) *session.Session {
+	server := startReplayTarget(t, authenticator)
+	defer server.Stop()
+
+	token, err := authenticator.Issue("player_recorded", "recorded")
+	require.NoError(t, err)
+
+	config := wsclient.DefaultClientConfig(server.GetWebSocketURL(), token)
+	config.HeartbeatInterval = 100 * time.Millisecond
+	client := wsclient.New(config)
+	recorder := session.NewSessionRecorder("live_replay_source")
+	client.SetRecorder(recorder)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, client.Connect(ctx))
+
+	for i := 1; i <= 3; i++ {
+		require.NoError(t, client.SendAction(&gamev1.PlayerAction{
+			ActionSeq:       uint64(100 + i),
+			PlayerId:        "player_recorded",
+			ActionType:      gamev1.ActionType_ACTION_TYPE_MOVE,
+			ClientTimestamp: time.Now().UnixMilli(),
+		}))
+		time.Sleep(50 * time.Millisecond)
+	}
+	require.NoError(t, client.JoinRoom("room_replay"))
+	time.Sleep(300 * time.Millisecond)
+	require.NoError(t, client.Close())
+
+	data, err := recorder.ExportJSON()
+	require.NoError(t, err)
+	recorded, err := session.ReadSession(bytes.NewReader(data))
+	require.NoError(t, err)
+	return recorded
+}
+
+// framesByOpcode 统计会话中指定方向的帧
+func framesByOpcode(recorded *session.Session, direction string) map[uint16][]*session.MessageFrame {
+	frames := make(map[uint16][]*session.MessageFrame)
+	for _, frame := range recorded.Frames {
+		if frame.Direction == direction {
+			frames[frame.Opcode] = append(frames[frame.Opcode], frame)
+		}
+	}
+	return frames
+}
+
+// TestLiveReplayAgainstServer 测试录制一次后回放到新的服务器实例，响应与录制一致
+func TestLiveReplayAgainstServer(t *testing.T) {
+	authenticator := auth.New(nil)
+	recorded := recordPlaySession(t, authenticator)
+
+	sent := framesByOpcode(recorded, "send")
+	require.Len(t, sent[protocol.OpLoginReq], 1)
+	require.Len(t, sent[protocol.OpPlayerAction], 3)
+	require.NotEmpty(t, sent[protocol.OpHeartbeat])
+	span := sent[protocol.OpRoomJoin][0].Timestamp.Sub(sent[protocol.OpLoginReq][0].Timestamp)
+
+	server := startReplayTarget(t, authenticator)
+	defer server.Stop()
+	token, err := authenticator.Issue("player_replay", "replay")
+	require.NoError(t, err)
+
+	config := session.DefaultLiveReplayConfig(server.GetWebSocketURL(), token)
+	config.Speed = session.SpeedFast
+	replayer := session.NewLiveReplayer(recorded, config)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	report, err := replayer.Run(ctx)
+	require.NoError(t, err)
+
+	for _, diff := range report.Diffs {
+		t.Logf("差异: %s", diff)
+	}
+	assert.True(t, report.Passed())
+	assert.Equal(t, len(recorded.Frames)-len(receivedOf(recorded)), report.SentFrames)
+	assert.GreaterOrEqual(t, report.Compared, 1+3+1, "登录、操作和房间响应都参与比较")
+	assert.GreaterOrEqual(t, report.Duration, span/2, "按二倍速保持录制的发送间隔")
+
+	// 回放连接使用新令牌登录，操作中的玩家ID和序列号已改写
+	replayed := framesByOpcode(report.Replayed, "send")
+	require.Len(t, replayed[protocol.OpPlayerAction], 3)
+	for i, frame := range replayed[protocol.OpPlayerAction] {
+		action := &gamev1.PlayerAction{}
+		require.NoError(t, proto.Unmarshal(frame.Body, action))
+		assert.Equal(t, "player_replay", action.PlayerId)
+		assert.Equal(t, uint64(i+1), action.ActionSeq)
+	}
+	loginResp := &gamev1.LoginResp{}
+	require.NoError(t, proto.Unmarshal(framesByOpcode(report.Replayed, "receive")[protocol.OpLoginResp][0].Body, loginResp))
+	assert.Equal(t, "player_replay", loginResp.PlayerId)
+}
+
+// TestLiveReplayDetectsRegressions 测试目标服务器行为变化时报告差异
+func TestLiveReplayDetectsRegressions(t *testing.T) {
+	authenticator := auth.New(nil)
+	recorded := recordPlaySession(t, authenticator)
+
+	server := startReplayTarget(t, authenticator)
+	defer server.Stop()
+	token, err := authenticator.Issue("player_replay", "replay")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// 模拟丢失一条操作响应的服务器版本
+	_, err = server.AddFaultRule(testserver.FaultRule{
+		Type:     testserver.FaultDrop,
+		Opcodes:  []uint16{protocol.OpActionResp},
+		MaxCount: 1,
+	})
+	require.NoError(t, err)
+
+	config := session.DefaultLiveReplayConfig(server.GetWebSocketURL(), token)
+	config.Speed = session.SpeedInstant
+	config.ResponseTimeout = 500 * time.Millisecond
+	report, err := session.NewLiveReplayer(recorded, config).Run(ctx)
+	require.NoError(t, err)
+	require.False(t, report.Passed())
+	require.Len(t, report.Diffs, 1)
+	assert.Equal(t, session.DiffMissing, report.Diffs[0].Kind)
+	assert.Equal(t, protocol.OpActionResp, report.Diffs[0].Opcode)
+	assert.Equal(t, 0, report.Diffs[0].Index, "按序列号配对，后两条响应仍然匹配")
+
+	// 不忽略服务器分配的字段时，登录响应必然不同
+	server.ClearFaultRules()
+	config = session.DefaultLiveReplayConfig(server.GetWebSocketURL(), token)
+	config.Speed = session.SpeedInstant
+	config.IgnoreRules = []session.IgnoreRule{{Opcode: protocol.OpHeartbeatResp}, {Opcode: protocol.OpActionResp}}
+	report, err = session.NewLiveReplayer(recorded, config).Run(ctx)
+	require.NoError(t, err)
+	require.Len(t, report.Diffs, 1)
+	assert.Equal(t, session.DiffMismatch, report.Diffs[0].Kind)
+	assert.Equal(t, protocol.OpLoginResp, report.Diffs[0].Opcode)
+	assert.ElementsMatch(t, []string{"player_id", "session_id", "server_time"}, report.Diffs[0].Fields)
+}
+
+// TestLiveReplayRequiresSendFrames 测试只有事件的录制无法实时回放
+func TestLiveReplayRequiresSendFrames(t *testing.T) {
+	recorder := session.NewSessionRecorder("events_only")
+	recorder.RecordEvent(session.EventLogin, map[string]interface{}{"player_id": "unity"})
+
+	_, err := session.NewLiveReplayer(recorder.GetSession(), nil).Run(context.Background())
+	assert.ErrorIs(t, err, session.ErrNothingToReplay)
+}
+
+// receivedOf 会话中的接收帧
+func receivedOf(recorded *session.Session) []*session.MessageFrame {
+	var frames []*session.MessageFrame
+	for _, list := range framesByOpcode(recorded, "receive") {
+		frames = append(frames, list...)
+	}
+	return frames
+}
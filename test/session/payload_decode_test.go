@@ -0,0 +1,164 @@
+package session_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+
+	"GoSlgBenchmarkTest/internal/protocol"
+	"GoSlgBenchmarkTest/internal/session"
+	gamev1 "GoSlgBenchmarkTest/proto/game/v1"
+)
+
+// recordBattleMessages 记录一次操作和一条战斗推送
+func recordBattleMessages(t *testing.T, recorder *session.SessionRecorder) {
+	action, err := proto.Marshal(&gamev1.PlayerAction{ActionSeq: 7, PlayerId: "p1", ActionType: gamev1.ActionType_ACTION_TYPE_ATTACK})
+	require.NoError(t, err)
+	recorder.RecordMessage("send", protocol.EncodeFrame(protocol.OpPlayerAction, action), protocol.OpPlayerAction, action, 7)
+
+	push, err := proto.Marshal(&gamev1.BattlePush{
+		Seq:      3,
+		BattleId: "battle_42",
+		Units:    []*gamev1.BattleUnit{{UnitId: "u1", Hp: 90}, {UnitId: "u2", Hp: 40}},
+	})
+	require.NoError(t, err)
+	recorder.RecordMessage("receive", protocol.EncodeFrame(protocol.OpBattlePush, push), protocol.OpBattlePush, push, 3)
+}
+
+// payloadOf 解析帧的protojson渲染
+func payloadOf(t *testing.T, frame *session.MessageFrame) map[string]interface{} {
+	require.NotNil(t, frame.Payload)
+	var payload map[string]interface{}
+	require.NoError(t, json.Unmarshal(frame.Payload, &payload))
+	return payload
+}
+
+// TestRecorderDecodesPayloads 测试记录时解码消息体，导出和时间线中可以看到消息内容
+func TestRecorderDecodesPayloads(t *testing.T) {
+	recorder := session.NewSessionRecorder("decoded")
+	recorder.SetPayloadDecoding(session.DefaultPayloadDecodeOptions())
+	recordBattleMessages(t, recorder)
+
+	data, err := recorder.ExportJSON()
+	require.NoError(t, err)
+	exported, err := session.ReadSession(bytes.NewReader(data))
+	require.NoError(t, err)
+
+	require.Len(t, exported.Frames, 2)
+	assert.Equal(t, "game.v1.PlayerAction", exported.Frames[0].MessageType)
+	assert.Equal(t, "game.v1.BattlePush", exported.Frames[1].MessageType)
+	push := payloadOf(t, exported.Frames[1])
+	assert.Equal(t, "battle_42", push["battle_id"], "使用proto字段名")
+	assert.Len(t, push["units"], 2)
+	assert.Equal(t, "ACTION_TYPE_ATTACK", payloadOf(t, exported.Frames[0])["action_type"])
+
+	// 时间线报告中的消息事件带有消息类型和内容
+	var pushEvent *session.TimelineEvent
+	for _, event := range session.NewTimelineAnalyzer(recorder.GetSession()).AnalyzeTimeline() {
+		if event.Opcode == protocol.OpBattlePush {
+			pushEvent = event
+		}
+	}
+	require.NotNil(t, pushEvent)
+	assert.Equal(t, "game.v1.BattlePush", pushEvent.MessageType)
+	assert.Contains(t, string(pushEvent.Metadata["payload"].(json.RawMessage)), `"battle_id":"battle_42"`)
+}
+
+// TestPayloadFieldAllowlist 测试按操作码的字段白名单和操作码过滤
+func TestPayloadFieldAllowlist(t *testing.T) {
+	options := &session.PayloadDecodeOptions{
+		Opcodes: []uint16{protocol.OpBattlePush},
+		Fields:  map[uint16][]string{protocol.OpBattlePush: {"battle_id", "units.unit_id"}},
+	}
+	recorder := session.NewSessionRecorder("allowlist")
+	recorder.SetPayloadDecoding(options)
+	recordBattleMessages(t, recorder)
+
+	frames := recorder.GetFrames()
+	require.Len(t, frames, 2)
+	assert.Empty(t, frames[0].MessageType, "操作不在解码范围内")
+	assert.Nil(t, frames[0].Payload)
+
+	assert.JSONEq(t, `{"battle_id":"battle_42","units":[{"unit_id":"u1"},{"unit_id":"u2"}]}`, string(frames[1].Payload))
+	assert.NotEmpty(t, frames[1].Body, "原始消息体保持不变")
+}
+
+// TestDecodeSessionPayloadsLazily 测试对未解码的录制补充解码并写入消息事件
+func TestDecodeSessionPayloadsLazily(t *testing.T) {
+	recorder := session.NewSessionRecorder("lazy")
+	recordBattleMessages(t, recorder)
+	recorder.RecordMessage("receive", protocol.EncodeFrame(protocol.OpBattlePush, []byte{0xFF}), protocol.OpBattlePush, []byte{0xFF}, 0)
+	recorder.RecordMessage("receive", protocol.EncodeFrame(7777, nil), 7777, nil, 0)
+
+	recorded := recorder.GetSession()
+	for _, frame := range recorded.Frames {
+		assert.Nil(t, frame.Payload, "默认不解码")
+	}
+
+	failures := session.DecodeSessionPayloads(recorded, nil)
+	assert.Equal(t, 1, failures, "损坏的消息体")
+	assert.Equal(t, "battle_42", payloadOf(t, recorded.Frames[1])["battle_id"])
+	assert.Equal(t, "game.v1.BattlePush", recorded.Frames[2].MessageType)
+	assert.Nil(t, recorded.Frames[2].Payload)
+	assert.Empty(t, recorded.Frames[3].MessageType, "未知操作码")
+
+	annotated := 0
+	for _, event := range recorded.Events {
+		if event.Type == session.EventMessageReceive && event.Metadata["payload"] != nil {
+			annotated++
+			assert.Equal(t, "game.v1.BattlePush", event.Metadata["message_type"])
+		}
+	}
+	assert.Equal(t, 1, annotated)
+
+	// 记录时解码失败写入事件元数据
+	recorder = session.NewSessionRecorder("broken")
+	recorder.SetPayloadDecoding(session.DefaultPayloadDecodeOptions())
+	recorder.RecordMessage("receive", protocol.EncodeFrame(protocol.OpBattlePush, []byte{0xFF}), protocol.OpBattlePush, []byte{0xFF}, 0)
+	events := recorder.GetEvents()
+	assert.Contains(t, events[len(events)-1].Metadata["payload_error"], "game.v1.BattlePush")
+}
+
+// TestDecodedPayloadsSurviveSessionFile 测试消息类型和解码后的消息体随帧记录写入会话文件并读回
+func TestDecodedPayloadsSurviveSessionFile(t *testing.T) {
+	recorder := session.NewSessionRecorder("decoded_file")
+	recorder.SetPayloadDecoding(session.DefaultPayloadDecodeOptions())
+	recordBattleMessages(t, recorder)
+	recorder.RecordMessage("receive", protocol.EncodeFrame(7777, []byte{1}), 7777, []byte{1}, 0)
+	recorded := recorder.GetSession()
+
+	var buf bytes.Buffer
+	writer, err := session.NewSessionFileWriter(&buf, recorded.ID, recorded.StartTime, nil)
+	require.NoError(t, err)
+	require.NoError(t, writer.WriteSession(recorded))
+	require.NoError(t, writer.Close())
+
+	reader, err := session.NewSessionFileReader(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	loaded, err := reader.ReadSession(nil)
+	require.NoError(t, err)
+
+	require.Len(t, loaded.Frames, len(recorded.Frames))
+	for i, frame := range recorded.Frames {
+		assert.Equal(t, frame.MessageType, loaded.Frames[i].MessageType, "第%d帧消息类型", i)
+		assert.Equal(t, frame.Payload, loaded.Frames[i].Payload, "第%d帧消息体", i)
+		assert.Equal(t, frame.Body, loaded.Frames[i].Body)
+	}
+	assert.Equal(t, "battle_42", payloadOf(t, loaded.Frames[1])["battle_id"])
+	assert.Empty(t, loaded.Frames[2].MessageType, "未知操作码不带解码信息")
+	assert.Nil(t, loaded.Frames[2].Payload)
+	assert.Equal(t, session.SessionFileVersion, reader.Header().Version)
+
+	// 版本1不支持带解码信息的帧记录，读取时报错而不是错位解析
+	old := bytes.Replace(buf.Bytes(), []byte(`"version":2`), []byte(`"version":1`), 1)
+	require.NotEqual(t, buf.Bytes(), old)
+	reader, err = session.NewSessionFileReader(bytes.NewReader(old))
+	require.NoError(t, err)
+	_, err = reader.ReadSession(nil)
+	require.ErrorIs(t, err, session.ErrSessionFileCorrupt)
+	assert.Contains(t, err.Error(), "unknown frame flags")
+}
@@ -0,0 +1,337 @@
+package session_test
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"GoSlgBenchmarkTest/internal/protocol"
+	"GoSlgBenchmarkTest/internal/session"
+)
+
+// assertFramesEqual 比较导入的帧与原始帧的方向、内容和时间戳
+func assertFramesEqual(t *testing.T, expected, actual []*session.MessageFrame, flip bool) {
+	require.Len(t, actual, len(expected))
+	for i, frame := range expected {
+		direction := frame.Direction
+		if flip {
+			direction = map[string]string{"send": "receive", "receive": "send"}[direction]
+		}
+		assert.Equal(t, direction, actual[i].Direction, "第%d帧方向", i)
+		assert.Equal(t, frame.Opcode, actual[i].Opcode)
+		assert.Equal(t, frame.RawData, actual[i].RawData)
+		assert.Equal(t, frame.SequenceNum, actual[i].SequenceNum)
+		assert.True(t, frame.Timestamp.Equal(actual[i].Timestamp), "第%d帧时间戳", i)
+	}
+}
+
+// TestPcapImportWebSocketRoundTrip 测试导出的pcapng可以还原为相同的会话
+func TestPcapImportWebSocketRoundTrip(t *testing.T) {
+	recorded := buildPcapSession(t)
+
+	var buf bytes.Buffer
+	require.NoError(t, session.WritePcapng(&buf, recorded, nil))
+	sessions, err := session.ReadPcap(&buf, nil)
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+
+	imported := sessions[0]
+	assert.True(t, strings.HasPrefix(imported.ID, "pcap_1_10.0.0.2:50000"))
+	assertFramesEqual(t, recorded.Frames, imported.Frames, false)
+	require.NoError(t, session.ValidateSession(imported))
+
+	// 事件与录制器一致：连接、每帧一个消息事件、断开
+	require.Len(t, imported.Events, len(recorded.Frames)+2)
+	assert.Equal(t, session.EventConnect, imported.Events[0].Type)
+	assert.Equal(t, "websocket", imported.Events[0].Metadata["encapsulation"])
+	assert.Equal(t, session.EventDisconnect, imported.Events[len(imported.Events)-1].Type)
+	assert.Equal(t, session.EventMessageSend, imported.Events[1].Type)
+	assert.Equal(t, protocol.OpLoginReq, imported.Events[1].Opcode)
+	assert.Zero(t, imported.Stats.ErrorCount)
+
+	timeline := session.NewTimelineAnalyzer(imported).AnalyzeTimeline()
+	assert.Len(t, timeline, len(imported.Events))
+	assert.Equal(t, "send", timeline[1].Direction)
+}
+
+// TestPcapImportRawTCP 测试TCP封装和服务端视角的录制导入后恢复客户端视角
+func TestPcapImportRawTCP(t *testing.T) {
+	recorded := buildPcapSession(t)
+
+	options := session.DefaultPcapOptions()
+	options.Encapsulation = session.PcapTCP
+	options.ServerPerspective = true
+	var buf bytes.Buffer
+	require.NoError(t, session.WritePcapng(&buf, recorded, options))
+
+	importOptions := session.DefaultPcapImportOptions()
+	importOptions.ServerPorts = []uint16{session.PcapTCPPort}
+	importOptions.SessionID = "device_lab"
+	sessions, err := session.ReadPcap(&buf, importOptions)
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	assert.True(t, strings.HasPrefix(sessions[0].ID, "device_lab_1_"))
+	assert.Equal(t, "tcp", sessions[0].Events[0].Metadata["encapsulation"])
+	assertFramesEqual(t, recorded.Frames, sessions[0].Frames, true)
+
+	// 端口过滤掉所有连接
+	buf.Reset()
+	require.NoError(t, session.WritePcapng(&buf, recorded, options))
+	importOptions.ServerPorts = []uint16{9}
+	sessions, err = session.ReadPcap(&buf, importOptions)
+	require.NoError(t, err)
+	assert.Empty(t, sessions)
+}
+
+// classicPcap 构造经典pcap文件（小端、微秒、Linux cooked capture）
+type classicPcap struct {
+	buf bytes.Buffer
+}
+
+func newClassicPcap() *classicPcap {
+	p := &classicPcap{}
+	header := make([]byte, 24)
+	binary.LittleEndian.PutUint32(header[0:4], 0xA1B2C3D4)
+	binary.LittleEndian.PutUint16(header[4:6], 2)
+	binary.LittleEndian.PutUint16(header[6:8], 4)
+	binary.LittleEndian.PutUint32(header[16:20], 65535)
+	binary.LittleEndian.PutUint32(header[20:24], 113)
+	p.buf.Write(header)
+	return p
+}
+
+// segment 写出一个IPv4/TCP段，不计算校验和（导入不校验）
+func (p *classicPcap) segment(at time.Time, fromClient bool, seq uint32, flags byte, payload []byte) {
+	client, server := []byte{192, 168, 1, 20}, []byte{172, 16, 0, 5}
+	srcIP, dstIP, srcPort, dstPort := client, server, uint16(41000), uint16(7000)
+	if !fromClient {
+		srcIP, dstIP, srcPort, dstPort = server, client, dstPort, srcPort
+	}
+
+	tcp := make([]byte, 20)
+	binary.BigEndian.PutUint16(tcp[0:2], srcPort)
+	binary.BigEndian.PutUint16(tcp[2:4], dstPort)
+	binary.BigEndian.PutUint32(tcp[4:8], seq)
+	tcp[12] = 5 << 4
+	tcp[13] = flags
+	tcp = append(tcp, payload...)
+
+	ip := make([]byte, 20)
+	ip[0] = 0x45
+	binary.BigEndian.PutUint16(ip[2:4], uint16(20+len(tcp)))
+	ip[8], ip[9] = 64, 6
+	copy(ip[12:16], srcIP)
+	copy(ip[16:20], dstIP)
+
+	packet := append(make([]byte, 16), append(ip, tcp...)...)
+	binary.BigEndian.PutUint16(packet[14:16], 0x0800)
+
+	record := make([]byte, 16)
+	binary.LittleEndian.PutUint32(record[0:4], uint32(at.Unix()))
+	binary.LittleEndian.PutUint32(record[4:8], uint32(at.Nanosecond()/1000))
+	binary.LittleEndian.PutUint32(record[8:12], uint32(len(packet)))
+	binary.LittleEndian.PutUint32(record[12:16], uint32(len(packet)))
+	p.buf.Write(record)
+	p.buf.Write(packet)
+}
+
+// TestPcapImportReassembly 测试中途开始的抓包、乱序、重传、跨段帧和缺失段
+func TestPcapImportReassembly(t *testing.T) {
+	start := time.Unix(1_700_000_000, 0)
+	at := func(ms int) time.Time { return start.Add(time.Duration(ms) * time.Millisecond) }
+
+	login := protocol.EncodeFrame(protocol.OpLoginReq, []byte("login"))
+	action := protocol.EncodeFrame(protocol.OpPlayerAction, []byte("action-body"))
+	heartbeat := protocol.EncodeFrame(protocol.OpHeartbeat, nil)
+	loginResp := protocol.EncodeFrame(protocol.OpLoginResp, []byte("ok"))
+	lost := protocol.EncodeFrame(protocol.OpBattlePush, []byte("lost"))
+	push := protocol.EncodeFrame(protocol.OpBattlePush, []byte("push"))
+
+	pcap := newClassicPcap()
+	const clientISN, serverISN uint32 = 7_000_000, 4_294_967_290 // 服务端序号在流中回绕
+	const pshAck = 0x18
+
+	// 客户端：登录帧及其重传
+	pcap.segment(at(0), true, clientISN, pshAck, login)
+	pcap.segment(at(2), true, clientISN, pshAck, login)
+	// 服务端响应跨越序号回绕
+	pcap.segment(at(10), false, serverISN, pshAck, loginResp)
+	// 操作与心跳合并后拆成两段，后一段先到，两帧在前一段到达后才完整
+	batch := append(append([]byte{}, action...), heartbeat...)
+	next := clientISN + uint32(len(login))
+	pcap.segment(at(20), true, next+5, pshAck, batch[5:])
+	pcap.segment(at(21), true, next, pshAck, batch[:5])
+	pcap.segment(at(22), true, next, pshAck, batch[:3])
+	// 服务端第二条推送丢失，之后的推送在缺口之后
+	pcap.segment(at(30), false, serverISN+uint32(len(loginResp)+len(lost)), pshAck, push)
+	pcap.segment(at(40), true, next+uint32(len(batch)), 0x11, nil)
+
+	sessions, err := session.ReadPcap(&pcap.buf, nil)
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	imported := sessions[0]
+	assert.Contains(t, imported.ID, "192.168.1.20:41000", "没有握手时按临时端口判断客户端")
+
+	type summary struct {
+		direction string
+		opcode    uint16
+		at        time.Time
+	}
+	var frames []summary
+	for _, frame := range imported.Frames {
+		frames = append(frames, summary{frame.Direction, frame.Opcode, frame.Timestamp})
+	}
+	assert.Equal(t, []summary{
+		{"send", protocol.OpLoginReq, at(0)},
+		{"receive", protocol.OpLoginResp, at(10)},
+		{"send", protocol.OpPlayerAction, at(21)},
+		{"send", protocol.OpHeartbeat, at(21)},
+		{"receive", protocol.OpBattlePush, at(30)},
+	}, frames)
+	assert.Equal(t, []byte("push"), imported.Frames[4].Body)
+
+	var errors, disconnects int
+	for _, event := range imported.Events {
+		switch event.Type {
+		case session.EventError:
+			errors++
+			assert.Contains(t, event.Error, "gap")
+		case session.EventDisconnect:
+			disconnects++
+		}
+	}
+	assert.Equal(t, 1, errors, "服务端流缺失一段")
+	assert.Equal(t, 1, disconnects)
+	assert.Equal(t, int64(1), imported.Stats.ErrorCount)
+	assert.Equal(t, int64(3), imported.Stats.MessagesSent)
+	require.NoError(t, session.ValidateSession(imported))
+}
+
+// deflateMessage 按permessage-deflate压缩一条消息：同步刷新后去掉末尾的00 00 ff ff
+func deflateMessage(t *testing.T, writer *flate.Writer, buf *bytes.Buffer, message []byte) []byte {
+	buf.Reset()
+	_, err := writer.Write(message)
+	require.NoError(t, err)
+	require.NoError(t, writer.Flush())
+	compressed := bytes.Clone(buf.Bytes())
+	require.True(t, bytes.HasSuffix(compressed, []byte{0x00, 0x00, 0xff, 0xff}))
+	return compressed[:len(compressed)-4]
+}
+
+// wsFrame 构造WebSocket帧，mask非空时按客户端帧掩码
+func wsFrame(first byte, payload []byte, mask []byte) []byte {
+	frame := []byte{first, byte(len(payload))}
+	if len(payload) >= 126 {
+		frame = []byte{first, 126, byte(len(payload) >> 8), byte(len(payload))}
+	}
+	if mask == nil {
+		return append(frame, payload...)
+	}
+	frame[1] |= 0x80
+	frame = append(frame, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	return frame
+}
+
+// compressedCapture 构造启用permessage-deflate的WebSocket会话抓包：客户端每条消息重置上下文，服务端跨消息保留上下文
+func compressedCapture(t *testing.T, extensions string) (*classicPcap, [][]byte) {
+	start := time.Unix(1_700_000_000, 0)
+	at := func(ms int) time.Time { return start.Add(time.Duration(ms) * time.Millisecond) }
+	const pshAck = 0x18
+	mask := []byte{0x11, 0x22, 0x33, 0x44}
+
+	pcap := newClassicPcap()
+	clientSeq, serverSeq := uint32(1000), uint32(5000)
+	send := func(ms int, fromClient bool, data []byte) {
+		if fromClient {
+			pcap.segment(at(ms), true, clientSeq, pshAck, data)
+			clientSeq += uint32(len(data))
+		} else {
+			pcap.segment(at(ms), false, serverSeq, pshAck, data)
+			serverSeq += uint32(len(data))
+		}
+	}
+
+	send(0, true, []byte("GET /ws HTTP/1.1\r\nHost: game\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"+
+		"Sec-WebSocket-Extensions: permessage-deflate; client_max_window_bits\r\n\r\n"))
+	send(1, false, []byte("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"+extensions+"\r\n"))
+
+	state := bytes.Repeat([]byte("unit:archer hp:100 pos:12,34;"), 20)
+	frames := [][]byte{
+		protocol.EncodeFrame(protocol.OpLoginReq, []byte("compressed-login")),
+		protocol.EncodeFrame(protocol.OpLoginResp, []byte("ok")),
+		protocol.EncodeFrame(protocol.OpBattlePush, state),
+		protocol.EncodeFrame(protocol.OpBattlePush, append(bytes.Clone(state), "tick:2"...)),
+		protocol.EncodeFrame(protocol.OpPlayerAction, []byte("compressed-action")),
+		protocol.EncodeFrame(protocol.OpBattlePush, []byte("plain")),
+	}
+
+	var clientBuf, serverBuf bytes.Buffer
+	clientWriter, err := flate.NewWriter(&clientBuf, flate.BestSpeed)
+	require.NoError(t, err)
+	serverWriter, err := flate.NewWriter(&serverBuf, flate.BestSpeed)
+	require.NoError(t, err)
+	clientMessage := func(message []byte) []byte {
+		clientWriter.Reset(&clientBuf) // client_no_context_takeover
+		return wsFrame(0xC2, deflateMessage(t, clientWriter, &clientBuf, message), mask)
+	}
+
+	send(10, true, clientMessage(frames[0]))
+	send(20, false, wsFrame(0xC2, deflateMessage(t, serverWriter, &serverBuf, frames[1]), nil))
+	send(30, false, wsFrame(0xC2, deflateMessage(t, serverWriter, &serverBuf, frames[2]), nil))
+	// 第二条推送依赖上一条消息的压缩上下文，并拆成两个分片，只有首帧置RSV1
+	second := deflateMessage(t, serverWriter, &serverBuf, frames[3])
+	require.Less(t, len(second), len(frames[3])/4, "应引用上一条消息的内容")
+	send(40, false, append(wsFrame(0x42, second[:3], nil), wsFrame(0x80, second[3:], nil)...))
+	send(50, true, clientMessage(frames[4]))
+	// 协商压缩后仍允许发送未压缩的消息
+	send(60, false, wsFrame(0x82, frames[5], nil))
+	return pcap, frames
+}
+
+// TestPcapImportPermessageDeflate 测试按握手协商的permessage-deflate参数解压消息
+func TestPcapImportPermessageDeflate(t *testing.T) {
+	pcap, frames := compressedCapture(t, "Sec-WebSocket-Extensions: permessage-deflate; client_no_context_takeover\r\n")
+	sessions, err := session.ReadPcap(&pcap.buf, nil)
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	imported := sessions[0]
+
+	assert.Equal(t, "permessage-deflate", imported.Events[0].Metadata["compression"])
+	assert.Zero(t, imported.Stats.ErrorCount)
+	require.Len(t, imported.Frames, len(frames))
+	directions := []string{"send", "receive", "receive", "receive", "send", "receive"}
+	for i, frame := range imported.Frames {
+		assert.Equal(t, directions[i], frame.Direction, "第%d帧方向", i)
+		assert.Equal(t, frames[i], frame.RawData, "第%d帧内容", i)
+	}
+	require.NoError(t, session.ValidateSession(imported))
+
+	// 没有协商扩展时压缩消息无法解码，记录错误而不是当作协议帧
+	pcap, _ = compressedCapture(t, "")
+	sessions, err = session.ReadPcap(&pcap.buf, nil)
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	assert.Len(t, sessions[0].Frames, 1, "只剩未压缩的推送")
+	assert.Equal(t, int64(5), sessions[0].Stats.ErrorCount)
+}
+
+// TestPcapImportRejectsOtherFormats 测试非抓包文件
+func TestPcapImportRejectsOtherFormats(t *testing.T) {
+	_, err := session.ReadPcap(strings.NewReader(`{"id":"json_session"}`), nil)
+	assert.ErrorIs(t, err, session.ErrNotPcap)
+
+	truncated := newClassicPcap()
+	truncated.segment(time.Unix(1, 0), true, 1, 0x18, []byte{1, 2, 3})
+	data := truncated.buf.Bytes()
+	_, err = session.ReadPcap(bytes.NewReader(data[:len(data)-2]), nil)
+	assert.ErrorIs(t, err, session.ErrSessionCorrupt)
+}
@@ -0,0 +1,264 @@
+package session_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+
+	"GoSlgBenchmarkTest/internal/auth"
+	"GoSlgBenchmarkTest/internal/protocol"
+	"GoSlgBenchmarkTest/internal/session"
+	gamev1 "GoSlgBenchmarkTest/proto/game/v1"
+)
+
+// buildSensitiveSession 录制一段带令牌、玩家ID、聊天内容和错误信息的会话，并经JSON导出加载
+func buildSensitiveSession(t *testing.T) *session.Session {
+	recorder := session.NewSessionRecorder("redact_source")
+	recorder.SetPayloadDecoding(session.DefaultPayloadDecodeOptions())
+	record := func(direction string, opcode uint16, message proto.Message) {
+		body, err := proto.Marshal(message)
+		require.NoError(t, err)
+		raw := protocol.EncodeFrame(opcode, body)
+		recorder.RecordMessage(direction, raw, opcode, raw[len(raw)-len(body):], 0)
+	}
+
+	recorder.RecordEvent(session.EventConnect, map[string]interface{}{
+		"player_id": "p_real_42",
+		"username":  "alice",
+		"token":     "secret_token",
+	})
+	record("send", protocol.OpLoginReq, &gamev1.LoginReq{Token: "secret_token", DeviceId: "device_real"})
+	record("receive", protocol.OpLoginResp, &gamev1.LoginResp{Ok: true, PlayerId: "p_real_42", SessionId: "sess_real"})
+	record("send", protocol.OpPlayerAction, &gamev1.PlayerAction{
+		ActionSeq:  1,
+		PlayerId:   "p_real_42",
+		ActionType: gamev1.ActionType_ACTION_TYPE_CHAT,
+		ActionData: &gamev1.ActionData{Data: &gamev1.ActionData_Chat{Chat: &gamev1.ChatAction{
+			Message: "集合 at base 7",
+			Channel: gamev1.ChatChannel_CHAT_CHANNEL_TEAM,
+		}}},
+	})
+	record("receive", protocol.OpError, &gamev1.ErrorResp{ErrorCode: 3, ErrorMessage: "player p_real_42 is muted"})
+	opaque := []byte("meet me at 8")
+	raw := protocol.EncodeFrame(protocol.OpChatMessage, opaque)
+	recorder.RecordMessage("send", raw, protocol.OpChatMessage, raw[len(raw)-len(opaque):], 0)
+	recorder.RecordError(errors.New("kick p_real_42: timeout"), map[string]interface{}{"player_id": "p_real_42"})
+	recorder.Stop()
+
+	data, err := recorder.ExportJSON()
+	require.NoError(t, err)
+	recorded, err := session.ReadSession(bytes.NewReader(data))
+	require.NoError(t, err)
+	return recorded
+}
+
+// TestRedactSessionRules 测试令牌哈希、玩家ID假名一致、聊天等长擦除，以及帧重新编码
+func TestRedactSessionRules(t *testing.T) {
+	recorded := buildSensitiveSession(t)
+	original, err := json.Marshal(recorded)
+	require.NoError(t, err)
+
+	config := session.DefaultRedactionConfig()
+	config.Key = "vendor-export"
+	redacted, report, err := session.RedactSession(recorded, config)
+	require.NoError(t, err)
+
+	// 原会话保持不变，脱敏结果中不再出现任何原值
+	unchanged, err := json.Marshal(recorded)
+	require.NoError(t, err)
+	assert.JSONEq(t, string(original), string(unchanged))
+	exported, err := json.Marshal(redacted)
+	require.NoError(t, err)
+	for _, secret := range []string{"secret_token", "device_real", "p_real_42", "sess_real", "alice", "集合", "base", "meet me"} {
+		assert.NotContains(t, string(exported), secret)
+	}
+	require.NoError(t, session.ValidateSession(redacted))
+
+	sent := framesByOpcode(redacted, "send")
+	received := framesByOpcode(redacted, "receive")
+	for _, frame := range redacted.Frames {
+		opcode, body, err := protocol.DecodeFrame(frame.RawData)
+		require.NoError(t, err)
+		assert.Equal(t, frame.Opcode, opcode)
+		assert.Equal(t, body, frame.Body)
+	}
+
+	login := &gamev1.LoginReq{}
+	require.NoError(t, proto.Unmarshal(sent[protocol.OpLoginReq][0].Body, login))
+	assert.Len(t, login.Token, 32)
+
+	loginResp := &gamev1.LoginResp{}
+	require.NoError(t, proto.Unmarshal(received[protocol.OpLoginResp][0].Body, loginResp))
+	pseudonym := loginResp.PlayerId
+	assert.True(t, strings.HasPrefix(pseudonym, "player_"))
+	assert.True(t, loginResp.Ok)
+
+	action := &gamev1.PlayerAction{}
+	require.NoError(t, proto.Unmarshal(sent[protocol.OpPlayerAction][0].Body, action))
+	assert.Equal(t, pseudonym, action.PlayerId)
+	chat := action.GetActionData().GetChat()
+	assert.Equal(t, "xxxxxx xx xxxx x", chat.Message, "保留空白和字节长度")
+	assert.Equal(t, gamev1.ChatChannel_CHAT_CHANNEL_TEAM, chat.Channel)
+
+	errorResp := &gamev1.ErrorResp{}
+	require.NoError(t, proto.Unmarshal(received[protocol.OpError][0].Body, errorResp))
+	assert.Equal(t, "player "+pseudonym+" is muted", errorResp.ErrorMessage)
+
+	assert.Equal(t, make([]byte, len("meet me at 8")), sent[protocol.OpChatMessage][0].Body)
+	assert.Equal(t, 1, report.OpaqueFrames)
+	assert.Equal(t, 5, report.Frames)
+	assert.Equal(t, 2, report.Pseudonyms, "玩家ID和用户名")
+
+	// 事件元数据、错误信息和payload使用同一假名，消息大小与改写后的帧一致
+	for _, event := range redacted.Events {
+		switch event.Type {
+		case session.EventConnect:
+			if _, ok := event.Metadata["username"]; !ok {
+				continue
+			}
+			assert.Equal(t, pseudonym, event.Metadata["player_id"])
+			assert.True(t, strings.HasPrefix(event.Metadata["username"].(string), "user_"))
+			assert.NotContains(t, event.Metadata, "token")
+		case session.EventError:
+			assert.Equal(t, "kick "+pseudonym+": timeout", event.Metadata["error"])
+			assert.Equal(t, pseudonym, event.Metadata["player_id"])
+		}
+	}
+	for event, frame := range pairedEvents(redacted) {
+		assert.Equal(t, len(frame.RawData), event.Metadata["message_size"])
+		if frame.Payload != nil {
+			assert.JSONEq(t, string(frame.Payload), string(event.Metadata["payload"].(json.RawMessage)))
+		}
+	}
+	var payload map[string]interface{}
+	require.NoError(t, json.Unmarshal(received[protocol.OpLoginResp][0].Payload, &payload))
+	assert.Equal(t, pseudonym, payload["player_id"])
+
+	var delta int64
+	for i, frame := range redacted.Frames {
+		if frame.Direction == "send" {
+			delta += int64(len(frame.RawData) - len(recorded.Frames[i].RawData))
+		}
+	}
+	assert.NotZero(t, delta)
+	assert.Equal(t, recorded.Stats.BytesSent+delta, redacted.Stats.BytesSent)
+
+	// 同一密钥的另一个脱敏器得到相同假名，不同密钥得到不同假名
+	again, _, err := session.RedactSession(recorded, config)
+	require.NoError(t, err)
+	assert.Equal(t, redacted.Frames[1].RawData, again.Frames[1].RawData)
+	other := session.DefaultRedactionConfig()
+	other.Key = "another-vendor"
+	different, _, err := session.RedactSession(recorded, other)
+	require.NoError(t, err)
+	assert.NotEqual(t, redacted.Frames[1].RawData, different.Frames[1].RawData)
+}
+
+// pairedEvents 按方向依次配对消息事件与帧
+func pairedEvents(recorded *session.Session) map[*session.SessionEvent]*session.MessageFrame {
+	frames := map[string][]*session.MessageFrame{}
+	for _, frame := range recorded.Frames {
+		frames[frame.Direction] = append(frames[frame.Direction], frame)
+	}
+	pairs := make(map[*session.SessionEvent]*session.MessageFrame)
+	for _, event := range recorded.Events {
+		direction := map[session.EventType]string{session.EventMessageSend: "send", session.EventMessageReceive: "receive"}[event.Type]
+		if direction == "" || len(frames[direction]) == 0 {
+			continue
+		}
+		pairs[event] = frames[direction][0]
+		frames[direction] = frames[direction][1:]
+	}
+	return pairs
+}
+
+// TestRedactCustomRules 测试自定义规则：丢弃令牌、按操作码限定规则、关闭嵌入替换
+func TestRedactCustomRules(t *testing.T) {
+	recorded := buildSensitiveSession(t)
+	config := &session.RedactionConfig{
+		Key: "custom",
+		FrameRules: []session.RedactRule{
+			{Opcode: protocol.OpLoginReq, Field: "token", Action: session.RedactDrop},
+			{Opcode: protocol.OpPlayerAction, Field: "player_id", Action: session.RedactPseudonym, Prefix: "anon_"},
+		},
+	}
+	redacted, report, err := session.RedactSession(recorded, config)
+	require.NoError(t, err)
+	assert.Zero(t, report.OpaqueFrames)
+
+	sent := framesByOpcode(redacted, "send")
+	received := framesByOpcode(redacted, "receive")
+	login := &gamev1.LoginReq{}
+	require.NoError(t, proto.Unmarshal(sent[protocol.OpLoginReq][0].Body, login))
+	assert.Empty(t, login.Token)
+	assert.Equal(t, "device_real", login.DeviceId)
+
+	action := &gamev1.PlayerAction{}
+	require.NoError(t, proto.Unmarshal(sent[protocol.OpPlayerAction][0].Body, action))
+	assert.True(t, strings.HasPrefix(action.PlayerId, "anon_"))
+	assert.Equal(t, "集合 at base 7", action.GetActionData().GetChat().Message)
+
+	// 规则限定在PlayerAction，登录响应和错误信息保持原样
+	loginResp := &gamev1.LoginResp{}
+	require.NoError(t, proto.Unmarshal(received[protocol.OpLoginResp][0].Body, loginResp))
+	assert.Equal(t, "p_real_42", loginResp.PlayerId)
+	assert.Equal(t, recorded.Frames[3].RawData, received[protocol.OpError][0].RawData)
+	assert.Equal(t, []byte("meet me at 8"), sent[protocol.OpChatMessage][0].Body)
+}
+
+// TestRedactedSessionReplays 测试脱敏后的录制仍可实时回放，响应与录制一致
+func TestRedactedSessionReplays(t *testing.T) {
+	authenticator := auth.New(nil)
+	recorded := recordPlaySession(t, authenticator)
+	redacted, report, err := session.RedactSession(recorded, nil)
+	require.NoError(t, err)
+	assert.Positive(t, report.Frames)
+
+	exported, err := json.Marshal(redacted)
+	require.NoError(t, err)
+	assert.NotContains(t, string(exported), "player_recorded")
+
+	server := startReplayTarget(t, authenticator)
+	defer server.Stop()
+	token, err := authenticator.Issue("player_replay", "replay")
+	require.NoError(t, err)
+
+	config := session.DefaultLiveReplayConfig(server.GetWebSocketURL(), token)
+	config.Speed = session.SpeedInstant
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	replayReport, err := session.NewLiveReplayer(redacted, config).Run(ctx)
+	require.NoError(t, err)
+	for _, diff := range replayReport.Diffs {
+		t.Logf("差异: %s", diff)
+	}
+	assert.True(t, replayReport.Passed())
+	assert.GreaterOrEqual(t, replayReport.Compared, 1+3+1)
+}
+
+// TestRedactRawFrames 测试代理录制的非协议帧按原长度擦除，不补协议头
+func TestRedactRawFrames(t *testing.T) {
+	recorder := session.NewSessionRecorder("redact_raw")
+	data := []byte("not a protocol frame: p_real_42")
+	recorder.RecordMessage("receive", data, 0, data, 0)
+	recorder.Stop()
+
+	redacted, report, err := session.RedactSession(recorder.GetSession(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, 1, report.OpaqueFrames)
+	require.Len(t, redacted.Frames, 1)
+	frame := redacted.Frames[0]
+	assert.Zero(t, frame.Opcode)
+	assert.Equal(t, make([]byte, len(data)), frame.RawData)
+	assert.Equal(t, frame.RawData, frame.Body)
+	assert.Equal(t, redacted.Stats.BytesReceived, recorder.GetSession().Stats.BytesReceived)
+	assert.Equal(t, "not a protocol frame: p_real_42", string(data), "原会话保持不变")
+}
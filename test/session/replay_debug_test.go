@@ -0,0 +1,436 @@
+package session_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"GoSlgBenchmarkTest/internal/protocol"
+	"GoSlgBenchmarkTest/internal/session"
+)
+
+// debugSession 构造调试用会话：5次战斗推送，单位hp依次为100/75/50/25/0，250ms时出错。
+// 按回放顺序：0 connect, 1-2 push, 3 error, 4-6 push, 7 close；错误事件故意放在末尾，验证按时间排序
+func debugSession(t *testing.T) *session.Session {
+	recorded := battleSession("debug")
+	recorded.Events = []*session.SessionEvent{{ID: "connect", Type: session.EventConnect, Timestamp: battleAt(0)}}
+	for i := 1; i <= 5; i++ {
+		frame := pushAt(t, i*100, "A", uint64(i), "h", unitAt("u1", int32(125-25*i), 0, 0))
+		recorded.Frames = append(recorded.Frames, frame)
+		recorded.Events = append(recorded.Events, &session.SessionEvent{
+			Type: session.EventMessageReceive, Opcode: protocol.OpBattlePush, Timestamp: frame.Timestamp,
+		})
+	}
+	recorded.Events = append(recorded.Events,
+		&session.SessionEvent{ID: "close", Type: session.EventClose, Timestamp: battleAt(600)},
+		&session.SessionEvent{ID: "error", Type: session.EventError, Error: "desync", Timestamp: battleAt(250)},
+	)
+	return recorded
+}
+
+// TestReplayStepAndSeek 测试按事件单步和按时间/序号跳转
+func TestReplayStepAndSeek(t *testing.T) {
+	replayer := session.NewSessionReplayer(debugSession(t), &session.ReplayConfig{Speed: 0})
+	var replayed []int
+	replayer.AddCallback(func(event *session.ReplayEvent) error {
+		replayed = append(replayed, event.Index)
+		return nil
+	})
+
+	_, err := replayer.StepBack()
+	assert.ErrorIs(t, err, session.ErrReplayAtStart)
+
+	for i := 0; i < 4; i++ {
+		_, err := replayer.StepForward()
+		require.NoError(t, err)
+	}
+	assert.Equal(t, []int{0, 1, 2, 3}, replayed)
+	assert.Equal(t, protocol.OpBattlePush, replayer.GetState().Next.Opcode, "错误事件之后游标指向下一个推送")
+
+	event, err := replayer.StepBack()
+	require.NoError(t, err)
+	assert.Equal(t, session.EventError, event.Type)
+	assert.Equal(t, 3, replayer.GetState().Position)
+
+	require.NoError(t, replayer.SeekTo(battleAt(250)))
+	assert.Equal(t, 3, replayer.GetState().Position)
+	require.NoError(t, replayer.SeekTo(battleAt(260)))
+	state := replayer.GetState()
+	assert.Equal(t, 4, state.Position)
+	assert.Equal(t, battleAt(250), state.CurrentTime, "跳转后回放时钟对齐到前一个事件")
+	assert.Equal(t, 8, state.TotalEvents)
+
+	require.NoError(t, replayer.SeekToIndex(7))
+	step, err := replayer.StepForward()
+	require.NoError(t, err)
+	assert.Equal(t, "close", step.OriginalEvent.ID)
+	assert.Equal(t, 100*time.Millisecond, step.Delay)
+	_, err = replayer.StepForward()
+	assert.ErrorIs(t, err, io.EOF)
+
+	assert.Error(t, replayer.SeekToIndex(9))
+	events, err := replayer.EventRange(6, 10)
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	assert.Equal(t, "close", events[1].ID)
+
+	// 跳转后从游标处继续播放
+	require.NoError(t, replayer.SeekToIndex(5))
+	replayed = nil
+	require.NoError(t, replayer.Play())
+	replayer.Wait()
+	assert.Equal(t, []int{5, 6, 7}, replayed)
+}
+
+// TestReplaySeekLargeSession 测试大会话上的二分定位
+func TestReplaySeekLargeSession(t *testing.T) {
+	const count = 200_000
+	recorded := battleSession("large")
+	for i := count - 1; i >= 0; i-- {
+		recorded.Events = append(recorded.Events, &session.SessionEvent{Type: session.EventHeartbeat, Timestamp: battleAt(i * 10)})
+	}
+	replayer := session.NewSessionReplayer(recorded, &session.ReplayConfig{Speed: 0})
+
+	start := time.Now()
+	require.NoError(t, replayer.SeekTo(battleAt(1_234_565)))
+	assert.Less(t, time.Since(start), 5*time.Second)
+	assert.Equal(t, 123_457, replayer.GetState().Position)
+
+	for i := 0; i < 1000; i++ {
+		require.NoError(t, replayer.SeekTo(battleAt(i*1990)))
+		require.Equal(t, i*199, replayer.GetState().Position)
+	}
+}
+
+// TestReplayBreakpoints 测试操作码、错误、消息体条件和自定义条件断点
+func TestReplayBreakpoints(t *testing.T) {
+	replayer := session.NewSessionReplayer(debugSession(t), &session.ReplayConfig{Speed: 0})
+	hits := make(chan *session.BreakpointHit, 10)
+	replayer.OnBreakpoint(func(hit *session.BreakpointHit) { hits <- hit })
+
+	_, err := replayer.AddBreakpoint(&session.Breakpoint{})
+	assert.ErrorContains(t, err, "no conditions")
+	_, err = replayer.AddBreakpoint(&session.Breakpoint{Payload: []session.PayloadCondition{{Field: "hp", Op: "~"}}})
+	assert.ErrorContains(t, err, "unknown operator")
+
+	_, err = replayer.AddBreakpoint(&session.Breakpoint{OnError: true})
+	require.NoError(t, err)
+	lowHP, err := replayer.AddBreakpoint(&session.Breakpoint{
+		Opcodes: []uint16{protocol.OpBattlePush},
+		Payload: []session.PayloadCondition{{Field: "units.hp", Op: "<=", Value: 25}, {Field: "battle_id", Value: "A"}},
+	})
+	require.NoError(t, err)
+	_, err = replayer.AddBreakpoint(&session.Breakpoint{
+		EventTypes: []session.EventType{session.EventClose},
+		Predicate: func(event *session.SessionEvent, payload map[string]interface{}) bool {
+			return event.ID == "close" && payload == nil
+		},
+	})
+	require.NoError(t, err)
+
+	next := func() *session.BreakpointHit {
+		select {
+		case hit := <-hits:
+			assert.True(t, replayer.IsPaused())
+			return hit
+		case <-time.After(5 * time.Second):
+			require.FailNow(t, "断点未命中")
+			return nil
+		}
+	}
+
+	require.NoError(t, replayer.Play())
+	hit := next()
+	assert.Equal(t, 3, hit.Index)
+	assert.Equal(t, "desync", hit.Event.Error)
+	assert.Equal(t, 3, replayer.ReplayedEvents(), "命中的事件尚未回放")
+	_, err = replayer.StepForward()
+	require.NoError(t, err, "暂停时可以单步")
+
+	require.NoError(t, replayer.Resume())
+	hit = next()
+	assert.Equal(t, 5, hit.Index)
+	assert.Equal(t, lowHP, hit.Breakpoint.ID)
+	units := hit.Payload["units"].([]interface{})
+	assert.EqualValues(t, 25, units[0].(map[string]interface{})["hp"])
+
+	// 恢复后命中的事件不会再次触发，hp为0的零值字段同样可以匹配
+	require.NoError(t, replayer.Resume())
+	hit = next()
+	assert.Equal(t, 6, hit.Index)
+	assert.Equal(t, 2, hit.Breakpoint.HitCount)
+	assert.Equal(t, hit, replayer.GetState().LastBreakpoint)
+
+	require.NoError(t, replayer.Resume())
+	hit = next()
+	assert.Equal(t, 7, hit.Index)
+
+	assert.True(t, replayer.RemoveBreakpoint(lowHP))
+	assert.False(t, replayer.RemoveBreakpoint(lowHP))
+	assert.Len(t, replayer.Breakpoints(), 2)
+	replayer.ClearBreakpoints()
+	require.NoError(t, replayer.Resume())
+	replayer.Wait()
+
+	stats := replayer.GetStats()
+	assert.Equal(t, 8, stats.ReplayedEvents)
+	assert.Equal(t, 4, stats.PauseCount)
+}
+
+// TestReplayConcurrentControl 测试断点命中期间从多个协程并发播放、暂停、恢复、跳转和单步，配合-race检查控制状态的同步
+func TestReplayConcurrentControl(t *testing.T) {
+	replayer := session.NewSessionReplayer(debugSession(t), &session.ReplayConfig{Speed: 0})
+	_, err := replayer.AddBreakpoint(&session.Breakpoint{Opcodes: []uint16{protocol.OpBattlePush}})
+	require.NoError(t, err)
+	var hits atomic.Int64
+	replayer.OnBreakpoint(func(hit *session.BreakpointHit) { hits.Add(1) })
+
+	// 持续并发操作直到断点多次命中，最长5秒
+	start := time.Now()
+	running := func() bool {
+		elapsed := time.Since(start)
+		return elapsed < 5*time.Second && (elapsed < 200*time.Millisecond || hits.Load() < 10)
+	}
+	operations := []func(){
+		func() { replayer.Play() },
+		func() { replayer.Pause() },
+		func() { replayer.Resume() },
+		func() { replayer.SeekTo(battleAt(0)) },
+		func() { replayer.StepForward() },
+		func() { replayer.Stop() },
+		func() { replayer.GetState() },
+	}
+	var wg sync.WaitGroup
+	for _, operation := range operations {
+		for range 2 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for running() {
+					operation()
+					time.Sleep(100 * time.Microsecond)
+				}
+			}()
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		replayer.Stop()
+		replayer.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		require.FailNow(t, "并发控制回放器时死锁")
+	}
+
+	assert.GreaterOrEqual(t, hits.Load(), int64(10), "并发控制期间断点应持续命中")
+	assert.False(t, replayer.IsPlaying())
+
+	// 并发控制结束后回放器仍可正常使用
+	replayer.ClearBreakpoints()
+	require.NoError(t, replayer.SeekTo(battleAt(0)))
+	require.NoError(t, replayer.Play())
+	replayer.Wait()
+	assert.Equal(t, 8, replayer.GetState().Position)
+}
+
+// TestReplayControlAPI 测试HTTP和WebSocket控制接口
+func TestReplayControlAPI(t *testing.T) {
+	replayer := session.NewSessionReplayer(debugSession(t), &session.ReplayConfig{Speed: 0})
+	server := httptest.NewServer(session.NewReplayController(replayer))
+	defer server.Close()
+
+	call := func(method, path, body string, expectedStatus int) map[string]interface{} {
+		t.Helper()
+		request, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		require.NoError(t, err)
+		response, err := http.DefaultClient.Do(request)
+		require.NoError(t, err)
+		defer response.Body.Close()
+		data, err := io.ReadAll(response.Body)
+		require.NoError(t, err)
+		require.Equal(t, expectedStatus, response.StatusCode, string(data))
+		result := map[string]interface{}{}
+		if expectedStatus == http.StatusOK {
+			require.NoError(t, json.Unmarshal(data, &result))
+		}
+		return result
+	}
+
+	result := call(http.MethodPost, "/breakpoints", `{"opcodes":[2001],"payload":[{"field":"seq","op":">=","value":3}]}`, http.StatusOK)
+	assert.EqualValues(t, 1, result["id"])
+	call(http.MethodPost, "/breakpoints", `{}`, http.StatusBadRequest)
+	call(http.MethodGet, "/play", "", http.StatusMethodNotAllowed)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws", nil)
+	require.NoError(t, err)
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	// 等待连接注册后再开始回放
+	require.NoError(t, conn.WriteJSON(map[string]string{"command": "state"}))
+	readUntil := func(messageType string) map[string]interface{} {
+		t.Helper()
+		for {
+			var message map[string]interface{}
+			require.NoError(t, conn.ReadJSON(&message))
+			if message["type"] == messageType {
+				return message
+			}
+		}
+	}
+	readUntil("result")
+
+	call(http.MethodPost, "/play", "", http.StatusOK)
+	hit := readUntil("breakpoint")["hit"].(map[string]interface{})
+	assert.EqualValues(t, 4, hit["index"], "seq为3的推送")
+
+	state := call(http.MethodGet, "/state", "", http.StatusOK)
+	assert.Equal(t, true, state["paused"])
+	assert.EqualValues(t, 4, state["position"])
+
+	result = call(http.MethodPost, "/step?count=2", "", http.StatusOK)
+	assert.Len(t, result["events"], 2)
+	result = call(http.MethodPost, "/step?direction=back", "", http.StatusOK)
+	assert.EqualValues(t, 5, result["state"].(map[string]interface{})["position"])
+	call(http.MethodPost, "/step?direction=sideways", "", http.StatusBadRequest)
+
+	state = call(http.MethodPost, "/seek?offset=100ms", "", http.StatusOK)
+	assert.EqualValues(t, 1, state["position"])
+	call(http.MethodPost, "/seek?index=abc", "", http.StatusBadRequest)
+	call(http.MethodPost, "/seek", "", http.StatusBadRequest)
+
+	result = call(http.MethodGet, "/events?from=0&limit=3", "", http.StatusOK)
+	assert.Len(t, result["events"], 3)
+
+	call(http.MethodDelete, "/breakpoints?id=99", "", http.StatusNotFound)
+	require.NoError(t, conn.WriteJSON(map[string]interface{}{
+		"command":    "add_breakpoint",
+		"breakpoint": map[string]interface{}{"event_types": []string{"CLOSE"}},
+	}))
+	assert.EqualValues(t, 2, readUntil("result")["result"].(map[string]interface{})["id"])
+	call(http.MethodDelete, "/breakpoints?id=1", "", http.StatusOK)
+
+	require.NoError(t, conn.WriteJSON(map[string]string{"command": "resume"}))
+	hit = readUntil("breakpoint")["hit"].(map[string]interface{})
+	assert.EqualValues(t, 7, hit["index"])
+
+	result = call(http.MethodDelete, "/breakpoints", "", http.StatusOK)
+	assert.Empty(t, result["breakpoints"])
+	call(http.MethodPost, "/resume", "", http.StatusOK)
+	event := readUntil("event")["event"].(map[string]interface{})
+	assert.EqualValues(t, 7, event["index"])
+	replayer.Wait()
+}
+
+// callControl 调用回放控制接口，检查状态码并解析JSON结果
+func callControl(t *testing.T, server *httptest.Server, method, path string, expectedStatus int) map[string]interface{} {
+	t.Helper()
+	request, err := http.NewRequest(method, server.URL+path, nil)
+	require.NoError(t, err)
+	response, err := http.DefaultClient.Do(request)
+	require.NoError(t, err)
+	defer response.Body.Close()
+	data, err := io.ReadAll(response.Body)
+	require.NoError(t, err)
+	require.Equal(t, expectedStatus, response.StatusCode, string(data))
+	result := map[string]interface{}{}
+	if expectedStatus == http.StatusOK {
+		require.NoError(t, json.Unmarshal(data, &result))
+	}
+	return result
+}
+
+// TestReplayControlStepLimitAndReplay 测试单步数量的校验和上限，以及游标到末尾后/play从头重新播放
+func TestReplayControlStepLimitAndReplay(t *testing.T) {
+	replayer := session.NewSessionReplayer(debugSession(t), &session.ReplayConfig{Speed: session.SpeedInstant})
+	var replayed atomic.Int32
+	replayer.AddCallback(func(event *session.ReplayEvent) error {
+		replayed.Add(1)
+		return nil
+	})
+	server := httptest.NewServer(session.NewReplayController(replayer))
+	defer server.Close()
+
+	callControl(t, server, http.MethodPost, "/step?count=0", http.StatusBadRequest)
+	callControl(t, server, http.MethodPost, "/step?count=-1", http.StatusBadRequest)
+	result := callControl(t, server, http.MethodPost, "/step?count=1000000000000", http.StatusOK)
+	assert.Len(t, result["events"], 8, "超大步数被限制，到末尾时返回已执行的部分")
+	assert.EqualValues(t, 8, replayed.Load())
+
+	for round := 1; round <= 2; round++ {
+		callControl(t, server, http.MethodPost, "/play", http.StatusOK)
+		replayer.Wait()
+		assert.EqualValues(t, 8+8*round, replayed.Load(), "第%d次播放从头开始", round)
+	}
+
+	// 游标不在末尾时从游标处继续
+	callControl(t, server, http.MethodPost, "/seek?index=6", http.StatusOK)
+	callControl(t, server, http.MethodPost, "/play", http.StatusOK)
+	replayer.Wait()
+	assert.EqualValues(t, 8+16+2, replayed.Load())
+}
+
+// TestStreamingReplayControlOffsetSeek 测试流式回放按相对会话开始的偏移跳转，开始时间取自文件头
+func TestStreamingReplayControlOffsetSeek(t *testing.T) {
+	start := time.Unix(1_700_000_000, 0)
+	path := filepath.Join(t.TempDir(), "offset.slgs")
+	writer, err := session.CreateSessionFile(path, "offset", start, nil)
+	require.NoError(t, err)
+	writeSyntheticSession(t, writer, start, 300)
+	require.NoError(t, writer.Close())
+
+	reader, err := session.OpenSessionFile(path)
+	require.NoError(t, err)
+	defer reader.Close()
+	replayer := session.NewStreamingReplayer(reader, &session.ReplayConfig{Speed: session.SpeedInstant})
+	server := httptest.NewServer(session.NewReplayController(replayer))
+	defer server.Close()
+
+	callControl(t, server, http.MethodPost, "/seek?offset=2s", http.StatusOK)
+	result := callControl(t, server, http.MethodPost, "/step", http.StatusOK)
+	events := result["events"].([]interface{})
+	require.Len(t, events, 1)
+	event := events[0].(map[string]interface{})["event"].(map[string]interface{})
+	assert.Equal(t, "event_200", event["id"])
+
+	// 流式回放读到末尾后重新播放，从文件开头开始
+	var replayed atomic.Int32
+	replayer.AddCallback(func(event *session.ReplayEvent) error {
+		replayed.Add(1)
+		return nil
+	})
+	callControl(t, server, http.MethodPost, "/play", http.StatusOK)
+	replayer.Wait()
+	assert.EqualValues(t, 99, replayed.Load())
+	callControl(t, server, http.MethodPost, "/play", http.StatusOK)
+	replayer.Wait()
+	assert.EqualValues(t, 99+300, replayed.Load())
+
+	// 文件头没有开始时间时拒绝按偏移跳转
+	unknownPath := filepath.Join(t.TempDir(), "unknown.slgs")
+	writer, err = session.CreateSessionFile(unknownPath, "unknown", time.Time{}, nil)
+	require.NoError(t, err)
+	writeSyntheticSession(t, writer, start, 10)
+	require.NoError(t, writer.Close())
+	unknown, err := session.OpenSessionFile(unknownPath)
+	require.NoError(t, err)
+	defer unknown.Close()
+	unknownServer := httptest.NewServer(session.NewReplayController(session.NewStreamingReplayer(unknown, nil)))
+	defer unknownServer.Close()
+	callControl(t, unknownServer, http.MethodPost, "/seek?offset=50ms", http.StatusBadRequest)
+}
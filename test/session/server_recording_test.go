@@ -0,0 +1,205 @@
+package session_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"GoSlgBenchmarkTest/internal/protocol"
+	"GoSlgBenchmarkTest/internal/session"
+	"GoSlgBenchmarkTest/internal/testserver"
+	"GoSlgBenchmarkTest/internal/testutil"
+	"GoSlgBenchmarkTest/internal/wsclient"
+	gamev1 "GoSlgBenchmarkTest/proto/game/v1"
+)
+
+// startRecordingServer 启动开启服务端会话录制的测试服务器
+func startRecordingServer(t *testing.T, exportDir string) *testutil.TestServer {
+	server := testutil.NewTestServerWithConfig(t, func(config *testserver.ServerConfig) {
+		config.EnableBattlePush = true
+		config.PushInterval = 20 * time.Millisecond
+		config.EnableSessionRecording = true
+		config.SessionExportDir = exportDir
+		config.FaultSeed = 7
+	})
+	server.Start()
+	return server
+}
+
+// connectRecordedClient 连接带客户端录制器的测试客户端
+func connectRecordedClient(t *testing.T, server *testutil.TestServer, deviceID string) (*wsclient.Client, *session.SessionRecorder) {
+	config := wsclient.DefaultClientConfig(server.GetWebSocketURL(), "recording-token")
+	config.DeviceID = deviceID
+	config.HeartbeatInterval = 100 * time.Millisecond
+
+	client := wsclient.New(config)
+	recorder := session.NewSessionRecorder("client_" + deviceID)
+	client.SetRecorder(recorder)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, client.Connect(ctx))
+	return client, recorder
+}
+
+// countEvents 统计指定类型的事件
+func countEvents(s *session.Session, eventType session.EventType) int {
+	count := 0
+	for _, event := range s.Events {
+		if event.Type == eventType {
+			count++
+		}
+	}
+	return count
+}
+
+// TestServerSideRecordingCorrelatesWithClient 测试服务端录制与客户端录制可逐帧关联出单向延迟
+func TestServerSideRecordingCorrelatesWithClient(t *testing.T) {
+	server := startRecordingServer(t, "")
+	defer server.Stop()
+
+	client, clientRecorder := connectRecordedClient(t, server, "recording-correlate")
+	defer client.Close()
+
+	for i := 1; i <= 3; i++ {
+		require.NoError(t, client.SendAction(&gamev1.PlayerAction{
+			ActionSeq:  uint64(i),
+			ActionType: gamev1.ActionType_ACTION_TYPE_MOVE,
+		}))
+	}
+
+	// 丢弃若干推送，服务端录制中应留下故障记录
+	_, err := server.AddFaultRule(testserver.FaultRule{
+		Type:     testserver.FaultDrop,
+		Opcodes:  []uint16{protocol.OpBattlePush},
+		MaxCount: 3,
+	})
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		return len(clientRecorder.GetFrames()) >= 30
+	}, 3*time.Second, 20*time.Millisecond)
+
+	// 停止推送后再取快照，避免在途帧被误判为丢失
+	server.Server.GetFaultEngine().ClearRules()
+	client.Close()
+	time.Sleep(200 * time.Millisecond)
+
+	serverSession := server.GetRecordedSession(client.PlayerID())
+	require.NotNil(t, serverSession, "应按玩家ID找到服务端录制")
+	assert.True(t, strings.HasPrefix(serverSession.ID, "server_conn_"))
+
+	report := session.CorrelateSessions(clientRecorder.GetSession(), serverSession)
+
+	// 上行：登录请求与3个操作都应被服务端收到
+	actions := 0
+	for _, match := range report.Uplink.Matched {
+		if match.Opcode == protocol.OpPlayerAction {
+			actions++
+		}
+		assert.GreaterOrEqual(t, match.Delay, time.Duration(0))
+	}
+	assert.Equal(t, 3, actions)
+	assert.Equal(t, protocol.OpLoginReq, report.Uplink.Matched[0].Opcode)
+	assert.Empty(t, report.Uplink.Unexpected)
+
+	// 下行：服务端写出的推送与客户端收到的推送逐帧对应
+	assert.Greater(t, len(report.Downlink.Matched), 20)
+	assert.Empty(t, report.Downlink.Unexpected)
+	assert.LessOrEqual(t, report.Downlink.MaxDelay, time.Second)
+	assert.LessOrEqual(t, report.Downlink.MinDelay, report.Downlink.AvgDelay)
+
+	// 被丢弃的推送没有写出，只作为故障事件出现在服务端录制中
+	assert.Equal(t, 3, countEvents(serverSession, session.EventFaultInjected))
+	assert.Equal(t, 1, countEvents(serverSession, session.EventLogin))
+	assert.Equal(t, 1, countEvents(serverSession, session.EventClose))
+
+	t.Logf("⏱️ 上行: 匹配%d帧 平均%v; 下行: 匹配%d帧 平均%v 最大%v 丢失%d帧",
+		len(report.Uplink.Matched), report.Uplink.AvgDelay,
+		len(report.Downlink.Matched), report.Downlink.AvgDelay, report.Downlink.MaxDelay, len(report.Downlink.Lost))
+}
+
+// TestServerSideRecordingExportOnDisconnect 测试连接断开后服务端录制按玩家归档并导出
+func TestServerSideRecordingExportOnDisconnect(t *testing.T) {
+	exportDir := t.TempDir()
+	server := startRecordingServer(t, exportDir)
+	defer server.Stop()
+
+	client, _ := connectRecordedClient(t, server, "recording-export")
+	playerID := client.PlayerID()
+
+	time.Sleep(200 * time.Millisecond)
+	client.Close()
+
+	var files []string
+	require.Eventually(t, func() bool {
+		files, _ = filepath.Glob(filepath.Join(exportDir, "*.json"))
+		return len(files) == 1
+	}, 2*time.Second, 20*time.Millisecond)
+	assert.True(t, strings.HasPrefix(filepath.Base(files[0]), playerID+"_conn_"))
+
+	data, err := os.ReadFile(files[0])
+	require.NoError(t, err)
+	var exported session.Session
+	require.NoError(t, json.Unmarshal(data, &exported))
+	assert.NotEmpty(t, exported.Frames)
+	assert.Equal(t, 1, countEvents(&exported, session.EventClose))
+
+	resp, err := http.Get(server.GetHTTPURL() + "/sessions")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	var listed struct {
+		Players map[string]int `json:"players"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&listed))
+	assert.Zero(t, listed.Players[playerID], "导出成功的录制不再保留在内存中")
+	assert.Empty(t, server.GetRecordedSessions(playerID))
+}
+
+// TestServerSideRecordingRetention 测试未导出的录制按上限淘汰最早的，取出后不再保留
+func TestServerSideRecordingRetention(t *testing.T) {
+	server := testutil.NewTestServerWithConfig(t, func(config *testserver.ServerConfig) {
+		config.EnableSessionRecording = true
+		config.SessionRetainLimit = 2
+	})
+	server.Start()
+	defer server.Stop()
+
+	var players []string
+	for i := 0; i < 3; i++ {
+		client, _ := connectRecordedClient(t, server, fmt.Sprintf("recording-retain-%d", i))
+		players = append(players, client.PlayerID())
+		client.Close()
+		require.Eventually(t, func() bool {
+			return len(server.GetRecordedSessions(client.PlayerID())) == 1
+		}, 2*time.Second, 20*time.Millisecond)
+	}
+
+	assert.Empty(t, server.GetRecordedSessions(players[0]), "超过上限时淘汰最早结束的录制")
+	assert.Len(t, server.GetRecordedSessions(players[1]), 1)
+
+	request, err := http.NewRequest(http.MethodDelete, server.GetHTTPURL()+"/sessions?player="+players[2], nil)
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(request)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	var taken struct {
+		Sessions []*session.Session `json:"sessions"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&taken))
+	require.Len(t, taken.Sessions, 1)
+	assert.Equal(t, 1, countEvents(taken.Sessions[0], session.EventClose))
+	assert.Empty(t, server.GetRecordedSessions(players[2]), "取出后不再保留")
+	assert.Nil(t, server.GetRecordedSession(players[2]))
+	assert.Len(t, server.TakeRecordedSessions(players[1]), 1)
+}
@@ -0,0 +1,196 @@
+package session_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+
+	"GoSlgBenchmarkTest/internal/protocol"
+	"GoSlgBenchmarkTest/internal/session"
+	gamev1 "GoSlgBenchmarkTest/proto/game/v1"
+)
+
+// diffScenario 构造对比用会话的参数
+type diffScenario struct {
+	id           string
+	actions      []uint64      // 发送的操作序列号
+	respDelay    time.Duration // 操作响应延迟
+	pushOrder    []uint64      // 战斗推送的到达顺序
+	firstPushHP  int32         // 第一条推送中单位的血量
+	loginSession string
+}
+
+// buildDiffSession 按场景构造包含登录、操作和推送的会话
+func buildDiffSession(t *testing.T, scenario diffScenario) *session.Session {
+	start := time.Unix(1_700_000_000, 0)
+	at := start
+	frames := make([]*session.MessageFrame, 0)
+	add := func(direction string, opcode uint16, message proto.Message, when time.Time) {
+		body, err := proto.Marshal(message)
+		require.NoError(t, err)
+		raw := protocol.EncodeFrame(opcode, body)
+		frames = append(frames, &session.MessageFrame{
+			RawData:     raw,
+			Opcode:      opcode,
+			Body:        raw[len(raw)-len(body):],
+			Timestamp:   when,
+			Direction:   direction,
+			SequenceNum: protocol.MessageSequence(opcode, body),
+		})
+	}
+
+	add("send", protocol.OpLoginReq, &gamev1.LoginReq{Token: scenario.id + "_token"}, at)
+	add("receive", protocol.OpLoginResp, &gamev1.LoginResp{Ok: true, PlayerId: "p1", SessionId: scenario.loginSession, ServerTime: at.UnixMilli()}, at.Add(5*time.Millisecond))
+
+	for _, seq := range scenario.actions {
+		at = at.Add(100 * time.Millisecond)
+		action := &gamev1.PlayerAction{ActionSeq: seq, PlayerId: "p1", ActionType: gamev1.ActionType_ACTION_TYPE_MOVE}
+		add("send", protocol.OpPlayerAction, action, at)
+		add("receive", protocol.OpActionResp, action, at.Add(scenario.respDelay))
+	}
+
+	for _, seq := range scenario.pushOrder {
+		at = at.Add(100 * time.Millisecond)
+		push := &gamev1.BattlePush{Seq: seq, BattleId: "battle_1", Timestamp: at.UnixMilli()}
+		if seq == 1 {
+			push.Units = []*gamev1.BattleUnit{{UnitId: "u1", Hp: scenario.firstPushHP}}
+		}
+		add("receive", protocol.OpBattlePush, push, at)
+	}
+
+	return &session.Session{
+		SchemaVersion: session.CurrentSchemaVersion,
+		ID:            scenario.id,
+		StartTime:     start,
+		EndTime:       at,
+		Frames:        frames,
+	}
+}
+
+// TestDiffIdenticalSessions 测试只有时间戳和服务器ID不同的会话被视为一致
+func TestDiffIdenticalSessions(t *testing.T) {
+	base := buildDiffSession(t, diffScenario{
+		id: "before", actions: []uint64{1, 2, 3}, respDelay: 10 * time.Millisecond,
+		pushOrder: []uint64{1, 2, 3}, firstPushHP: 100, loginSession: "session_a",
+	})
+	target := buildDiffSession(t, diffScenario{
+		id: "after", actions: []uint64{1, 2, 3}, respDelay: 10 * time.Millisecond,
+		pushOrder: []uint64{1, 2, 3}, firstPushHP: 100, loginSession: "session_b",
+	})
+
+	diff := session.DiffSessions(base, target, nil)
+	assert.True(t, diff.Identical())
+	assert.Equal(t, 2+3*2+3, diff.Matched)
+	for _, shift := range diff.Latency {
+		assert.Zero(t, shift.P50Shift)
+	}
+
+	// 不使用忽略规则时登录的令牌和会话ID不同
+	strict := session.DiffSessions(base, target, &session.SessionDiffOptions{})
+	require.Len(t, strict.Changed, 2)
+	assert.Equal(t, []string{"token"}, strict.Changed[0].Fields)
+	assert.Equal(t, []string{"session_id"}, strict.Changed[1].Fields)
+}
+
+// TestDiffReportsFlowChanges 测试报告增删、乱序、字段差异和延迟变化
+func TestDiffReportsFlowChanges(t *testing.T) {
+	base := buildDiffSession(t, diffScenario{
+		id: "before", actions: []uint64{1, 2, 3, 4, 5}, respDelay: 10 * time.Millisecond,
+		pushOrder: []uint64{1, 2, 3, 4}, firstPushHP: 100, loginSession: "session_a",
+	})
+	target := buildDiffSession(t, diffScenario{
+		id: "after", actions: []uint64{1, 2, 4, 5, 6}, respDelay: 40 * time.Millisecond,
+		pushOrder: []uint64{1, 3, 2, 4}, firstPushHP: 80, loginSession: "session_b",
+	})
+
+	diff := session.DiffSessions(base, target, nil)
+	require.False(t, diff.Identical())
+
+	keys := func(messages []*session.DiffedMessage) []string {
+		result := make([]string, 0, len(messages))
+		for _, message := range messages {
+			result = append(result, message.Direction+" "+protocol.OpcodeToString(message.Opcode)+" "+message.Key)
+		}
+		return result
+	}
+	assert.ElementsMatch(t, []string{"send PLAYER_ACTION 2002/seq:3", "receive ACTION_RESP 2003/seq:3"}, keys(diff.Removed))
+	assert.ElementsMatch(t, []string{"send PLAYER_ACTION 2002/seq:6", "receive ACTION_RESP 2003/seq:6"}, keys(diff.Added))
+	require.Len(t, diff.Reordered, 1, "两条推送交换顺序，只需移动其中一条")
+	assert.Equal(t, protocol.OpBattlePush, diff.Reordered[0].Opcode)
+
+	require.Len(t, diff.Changed, 1)
+	assert.Equal(t, protocol.OpBattlePush, diff.Changed[0].Opcode)
+	assert.Equal(t, "2001/seq:1", diff.Changed[0].Key)
+	assert.Equal(t, []string{"units"}, diff.Changed[0].Fields)
+
+	var actionLatency *session.LatencyShift
+	for _, shift := range diff.Latency {
+		if shift.Opcode == protocol.OpPlayerAction {
+			actionLatency = shift
+		}
+	}
+	require.NotNil(t, actionLatency)
+	assert.Equal(t, 5, actionLatency.Base.Count)
+	assert.Equal(t, 10*time.Millisecond, actionLatency.Base.P90)
+	assert.Equal(t, 30*time.Millisecond, actionLatency.P50Shift)
+	assert.Equal(t, 30*time.Millisecond, actionLatency.P99Shift)
+}
+
+// TestDiffLatencySkipsUnmatchedResponses 测试序列号对不上任何请求的响应不参与延迟配对
+func TestDiffLatencySkipsUnmatchedResponses(t *testing.T) {
+	base := buildDiffSession(t, diffScenario{
+		id: "before", actions: []uint64{1, 2, 3}, respDelay: 10 * time.Millisecond,
+		firstPushHP: 100, loginSession: "session_a",
+	})
+	target := buildDiffSession(t, diffScenario{
+		id: "after", actions: []uint64{1, 2, 3}, respDelay: 10 * time.Millisecond,
+		firstPushHP: 100, loginSession: "session_b",
+	})
+
+	// 在第一个操作请求之后插入一条序列号未知的响应（如上一个会话遗留的响应）
+	stray := &gamev1.PlayerAction{ActionSeq: 99, PlayerId: "p1"}
+	body, err := proto.Marshal(stray)
+	require.NoError(t, err)
+	raw := protocol.EncodeFrame(protocol.OpActionResp, body)
+	request := target.Frames[2]
+	strayFrame := &session.MessageFrame{
+		RawData: raw, Opcode: protocol.OpActionResp, Body: raw[len(raw)-len(body):],
+		Timestamp: request.Timestamp.Add(time.Millisecond), Direction: "receive", SequenceNum: 99,
+	}
+	target.Frames = append(target.Frames[:3:3], append([]*session.MessageFrame{strayFrame}, target.Frames[3:]...)...)
+
+	diff := session.DiffSessions(base, target, nil)
+	var actionLatency *session.LatencyShift
+	for _, shift := range diff.Latency {
+		if shift.Opcode == protocol.OpPlayerAction {
+			actionLatency = shift
+		}
+	}
+	require.NotNil(t, actionLatency)
+	assert.Equal(t, 3, actionLatency.Target.Count)
+	assert.Equal(t, 10*time.Millisecond, actionLatency.Target.Mean, "未配对的响应不应抢占最早的请求")
+	assert.Equal(t, actionLatency.Base, actionLatency.Target)
+}
+
+// TestDiffIgnoreRules 测试自定义忽略规则
+func TestDiffIgnoreRules(t *testing.T) {
+	base := buildDiffSession(t, diffScenario{
+		id: "before", actions: []uint64{1}, pushOrder: []uint64{1, 2}, firstPushHP: 100, loginSession: "s",
+	})
+	target := buildDiffSession(t, diffScenario{
+		id: "after", actions: []uint64{1}, pushOrder: []uint64{1}, firstPushHP: 50, loginSession: "s",
+	})
+
+	options := session.DefaultSessionDiffOptions()
+	options.IgnoreRules = append(options.IgnoreRules, session.IgnoreRule{Opcode: protocol.OpBattlePush, Fields: []string{"units.hp"}})
+	diff := session.DiffSessions(base, target, options)
+	assert.Empty(t, diff.Changed, "嵌套字段units.hp被忽略")
+	require.Len(t, diff.Removed, 1)
+
+	options.IgnoreRules = append(options.IgnoreRules, session.IgnoreRule{Opcode: protocol.OpBattlePush})
+	diff = session.DiffSessions(base, target, options)
+	assert.True(t, diff.Identical(), "整个操作码被忽略")
+}
@@ -0,0 +1,357 @@
+package session_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+
+	"GoSlgBenchmarkTest/internal/protocol"
+	"GoSlgBenchmarkTest/internal/session"
+	gamev1 "GoSlgBenchmarkTest/proto/game/v1"
+)
+
+// battlePushFrame 构造一个战斗推送帧
+func battlePushFrame(t *testing.T, seq uint64, at time.Time) *session.MessageFrame {
+	body, err := proto.Marshal(&gamev1.BattlePush{Seq: seq, BattleId: fmt.Sprintf("battle_%d", seq/100), Timestamp: at.UnixMilli()})
+	require.NoError(t, err)
+	raw := protocol.EncodeFrame(protocol.OpBattlePush, body)
+	return &session.MessageFrame{
+		RawData:     raw,
+		Opcode:      protocol.OpBattlePush,
+		Body:        raw[len(raw)-len(body):],
+		Timestamp:   at,
+		Direction:   "receive",
+		SequenceNum: seq,
+	}
+}
+
+// writeSyntheticSession 写入n组"事件+帧"记录，记录间隔10ms
+func writeSyntheticSession(t *testing.T, writer *session.SessionFileWriter, start time.Time, n int) {
+	for i := 0; i < n; i++ {
+		at := start.Add(time.Duration(i) * 10 * time.Millisecond)
+		require.NoError(t, writer.WriteEvent(&session.SessionEvent{
+			ID:        fmt.Sprintf("event_%d", i),
+			Type:      session.EventMessageReceive,
+			Timestamp: at,
+			Opcode:    protocol.OpBattlePush,
+			Metadata:  map[string]interface{}{"opcode": protocol.OpBattlePush, "sequence_num": uint64(i)},
+		}))
+		require.NoError(t, writer.WriteFrame(battlePushFrame(t, uint64(i), at)))
+	}
+}
+
+// TestSessionFileRoundTrip 测试录制器导出的会话文件可完整读回，且比JSON导出小
+func TestSessionFileRoundTrip(t *testing.T) {
+	recorder := session.NewSessionRecorder("file_round_trip")
+	start := time.Now()
+	for i := 0; i < 500; i++ {
+		frame := battlePushFrame(t, uint64(i+1), start)
+		recorder.RecordMessage("receive", frame.RawData, frame.Opcode, frame.Body, frame.SequenceNum)
+	}
+	recorder.RecordLatency(5 * time.Millisecond)
+	recorder.RecordClose(session.CloseNormal, "done")
+	original := recorder.GetSession()
+
+	for _, compression := range []session.Compression{session.CompressionNone, session.CompressionDeflate} {
+		t.Run(compression.String(), func(t *testing.T) {
+			options := session.DefaultSessionFileOptions()
+			options.Compression = compression
+			options.ChunkSize = 4 * 1024
+			options.IndexInterval = 4
+
+			path := filepath.Join(t.TempDir(), "session.slgs")
+			require.NoError(t, recorder.ExportFile(path, options))
+
+			reader, err := session.OpenSessionFile(path)
+			require.NoError(t, err)
+			defer reader.Close()
+
+			assert.True(t, reader.Complete())
+			assert.Equal(t, "file_round_trip", reader.Header().SessionID)
+			assert.Equal(t, compression, reader.Header().Compression)
+
+			loaded, err := reader.ReadSession(nil)
+			require.NoError(t, err)
+			assert.False(t, reader.Truncated())
+			require.Len(t, loaded.Events, len(original.Events))
+			require.Len(t, loaded.Frames, len(original.Frames))
+			for i, frame := range original.Frames {
+				assert.Equal(t, frame.RawData, loaded.Frames[i].RawData)
+				assert.Equal(t, frame.Body, loaded.Frames[i].Body)
+				assert.Equal(t, frame.SequenceNum, loaded.Frames[i].SequenceNum)
+				assert.True(t, frame.Timestamp.Equal(loaded.Frames[i].Timestamp))
+			}
+			for i, event := range original.Events {
+				assert.Equal(t, event.ID, loaded.Events[i].ID)
+				assert.Equal(t, event.Type, loaded.Events[i].Type)
+			}
+			require.NotNil(t, loaded.Stats)
+			assert.Equal(t, time.Duration(5*time.Millisecond), loaded.Stats.MaxLatency)
+
+			index, err := reader.Index()
+			require.NoError(t, err)
+			assert.Greater(t, len(index), 1, "小数据块应产生多个索引项")
+
+			jsonData, err := recorder.ExportJSON()
+			require.NoError(t, err)
+			info, err := os.Stat(path)
+			require.NoError(t, err)
+			assert.Less(t, info.Size(), int64(len(jsonData)), "二进制格式应小于JSON导出")
+			if compression == session.CompressionDeflate {
+				assert.Less(t, info.Size(), int64(len(jsonData)/4), "压缩后应明显小于JSON导出")
+			}
+			t.Logf("📦 %s: %d 字节, JSON: %d 字节, %d 个数据块", compression, info.Size(), len(jsonData), len(index))
+		})
+	}
+}
+
+// TestRecorderStreamsToFileWithoutRetaining 测试长录制模式下录制器不在内存中保留事件和帧
+func TestRecorderStreamsToFileWithoutRetaining(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "streaming.slgs")
+	recorder := session.NewSessionRecorder("streaming")
+
+	writer, err := session.CreateSessionFile(path, "streaming", time.Now(), nil)
+	require.NoError(t, err)
+	recorder.StreamTo(writer, false)
+
+	start := time.Now()
+	for i := 0; i < 1000; i++ {
+		frame := battlePushFrame(t, uint64(i+1), start)
+		recorder.RecordMessage("receive", frame.RawData, frame.Opcode, frame.Body, frame.SequenceNum)
+	}
+	recorder.RecordClose(session.CloseNormal, "done")
+	require.NoError(t, recorder.SinkError())
+	require.NoError(t, writer.Close())
+
+	assert.Empty(t, recorder.GetFrames(), "不保留时内存中没有帧")
+	assert.Empty(t, recorder.GetEvents())
+
+	reader, err := session.OpenSessionFile(path)
+	require.NoError(t, err)
+	defer reader.Close()
+
+	frames, events := 0, 0
+	for {
+		record, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		require.NoError(t, err)
+		if record.Frame != nil {
+			frames++
+			assert.Equal(t, uint64(frames), record.Frame.SequenceNum)
+		} else {
+			events++
+		}
+	}
+	assert.Equal(t, 1000, frames)
+	assert.Equal(t, 1000+1+1, events, "每帧一个消息事件，加上连接和关闭事件")
+
+	stats, err := reader.Stats()
+	require.NoError(t, err)
+	require.NotNil(t, stats)
+	assert.Equal(t, int64(1000), stats.MessagesReceived)
+}
+
+// TestSessionFileCrashRecovery 测试未正常关闭、末尾写了一半的文件仍可读出已刷盘的记录
+func TestSessionFileCrashRecovery(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "crashed.slgs")
+	options := session.DefaultSessionFileOptions()
+	options.ChunkSize = 2 * 1024
+	options.SyncOnFlush = true
+
+	writer, err := session.CreateSessionFile(path, "crashed", time.Now(), options)
+	require.NoError(t, err)
+	start := time.Unix(1_700_000_000, 0)
+	writeSyntheticSession(t, writer, start, 200)
+	require.NoError(t, writer.Flush())
+	flushed := writer.Records()
+	flushedSize := writer.Size()
+
+	// 模拟进程在写出下一个数据块时崩溃：文件末尾只有半个块，且没有尾块
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	require.NoError(t, err)
+	_, err = file.Write([]byte{1, 1, 0xff, 0x00, 0x00, 0x00, 0x10})
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	reader, err := session.OpenSessionFile(path)
+	require.NoError(t, err)
+	defer reader.Close()
+	assert.False(t, reader.Complete())
+
+	loaded, err := reader.ReadSession(nil)
+	require.NoError(t, err)
+	assert.True(t, reader.Truncated())
+	assert.Equal(t, flushed, uint64(len(loaded.Events)+len(loaded.Frames)))
+	assert.Nil(t, loaded.Stats)
+
+	// 没有尾块时扫描数据块重建索引，仍然可以按时间定位
+	index, err := reader.Index()
+	require.NoError(t, err)
+	require.NotEmpty(t, index)
+	require.NoError(t, reader.SeekTime(start.Add(1500*time.Millisecond)))
+	record, err := reader.Next()
+	require.NoError(t, err)
+	assert.True(t, record.Timestamp().Equal(start.Add(1500*time.Millisecond)))
+	t.Logf("🩹 已恢复 %d 条记录（%d 字节），%d 个数据块", flushed, flushedSize, len(index))
+}
+
+// TestSessionFileRejectsOversizedBlock 测试块头中的长度超过上限或文件剩余长度时按损坏处理，不按声明长度分配内存
+func TestSessionFileRejectsOversizedBlock(t *testing.T) {
+	start := time.Unix(1_700_000_000, 0)
+	for name, header := range map[string][]byte{
+		"payload_over_limit": {1, 0, 0xf0, 0xff, 0xff, 0xff, 0x10, 0, 0, 0, 0, 0, 0, 0},
+		"raw_over_limit":     {1, 1, 0x10, 0, 0, 0, 0xf0, 0xff, 0xff, 0xff, 0, 0, 0, 0},
+		"beyond_file_end":    {1, 0, 0x00, 0x00, 0x10, 0x00, 0x00, 0x00, 0x10, 0x00, 0, 0, 0, 0},
+	} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), name+".slgs")
+			writer, err := session.CreateSessionFile(path, name, start, nil)
+			require.NoError(t, err)
+			writeSyntheticSession(t, writer, start, 20)
+			require.NoError(t, writer.Flush())
+			flushed := writer.Records()
+
+			// 在已刷出的数据块之后追加伪造的块头和少量载荷
+			file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+			require.NoError(t, err)
+			_, err = file.Write(append(header, make([]byte, 16)...))
+			require.NoError(t, err)
+			require.NoError(t, file.Close())
+
+			reader, err := session.OpenSessionFile(path)
+			require.NoError(t, err)
+			defer reader.Close()
+			loaded, err := reader.ReadSession(nil)
+			require.NoError(t, err)
+			assert.True(t, reader.Truncated())
+			assert.Equal(t, flushed, uint64(len(loaded.Events)+len(loaded.Frames)))
+		})
+	}
+
+	// 文件头元数据长度同样受限
+	forged := append([]byte("SLGSESS\x01"), 0xff, 0xff, 0xff, 0xff)
+	_, err := session.NewSessionFileReader(bytes.NewReader(forged))
+	assert.ErrorIs(t, err, session.ErrSessionFileCorrupt)
+}
+
+// TestSessionFileFlushTimer 测试没有新记录写入时数据块也按FlushInterval刷出，未关闭的文件可以读到
+func TestSessionFileFlushTimer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "idle.slgs")
+	options := session.DefaultSessionFileOptions()
+	options.FlushInterval = 50 * time.Millisecond
+
+	writer, err := session.CreateSessionFile(path, "idle", time.Now(), options)
+	require.NoError(t, err)
+	defer writer.Close()
+	headerSize := writer.Size()
+
+	start := time.Unix(1_700_000_000, 0)
+	writeSyntheticSession(t, writer, start, 3)
+	assert.Equal(t, headerSize, writer.Size(), "记录先在数据块中缓冲")
+
+	require.Eventually(t, func() bool { return writer.Size() > headerSize }, time.Second, 10*time.Millisecond)
+	reader, err := session.OpenSessionFile(path)
+	require.NoError(t, err)
+	defer reader.Close()
+	assert.False(t, reader.Complete())
+	loaded, err := reader.ReadSession(nil)
+	require.NoError(t, err)
+	assert.Len(t, loaded.Events, 3)
+	assert.Len(t, loaded.Frames, 3)
+
+	// 刷出后写入的记录开始新的数据块，同样按时刷出
+	writeSyntheticSession(t, writer, start.Add(time.Second), 1)
+	flushed := writer.Size()
+	require.Eventually(t, func() bool { return writer.Size() > flushed }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, uint64(8), writer.Records())
+}
+
+// TestSessionFileSeekByIndex 测试按时间定位只读取目标数据块
+func TestSessionFileSeekByIndex(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "seek.slgs")
+	options := session.DefaultSessionFileOptions()
+	options.ChunkSize = 1024
+	options.IndexInterval = 3
+
+	writer, err := session.CreateSessionFile(path, "seek", time.Now(), options)
+	require.NoError(t, err)
+	start := time.Unix(1_700_000_000, 0)
+	writeSyntheticSession(t, writer, start, 1000)
+	require.NoError(t, writer.Close())
+
+	reader, err := session.OpenSessionFile(path)
+	require.NoError(t, err)
+	defer reader.Close()
+
+	index, err := reader.Index()
+	require.NoError(t, err)
+	require.Greater(t, len(index), 10)
+	total := 0
+	for i, entry := range index {
+		total += entry.Records
+		if i > 0 {
+			assert.False(t, entry.FirstTime.Before(index[i-1].LastTime), "索引项按时间有序")
+		}
+	}
+	assert.Equal(t, 2000, total)
+
+	target := start.Add(7*time.Second + 5*time.Millisecond)
+	require.NoError(t, reader.SeekTime(target))
+	record, err := reader.Next()
+	require.NoError(t, err)
+	require.NotNil(t, record.Event)
+	assert.Equal(t, "event_701", record.Event.ID, "定位到不早于目标时间的第一条记录")
+	assert.Equal(t, uint64(1402), record.Index)
+
+	// 超出结尾时直接返回EOF
+	require.NoError(t, reader.SeekTime(start.Add(time.Hour)))
+	_, err = reader.Next()
+	assert.ErrorIs(t, err, io.EOF)
+
+	// 时间窗口只加载事件供时间线分析
+	window, err := reader.ReadSession(&session.FileReadOptions{From: start.Add(2 * time.Second), To: start.Add(3 * time.Second)})
+	require.NoError(t, err)
+	assert.Len(t, window.Events, 101)
+	assert.Empty(t, window.Frames)
+	flows := session.NewTimelineAnalyzer(window).AnalyzeMessageFlows()
+	assert.Len(t, flows, 101, "sequence_num经文件往返后仍可作为消息ID")
+}
+
+// TestStreamingReplayFromFile 测试从会话文件流式回放
+func TestStreamingReplayFromFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "replay.slgs")
+	writer, err := session.CreateSessionFile(path, "replay", time.Now(), nil)
+	require.NoError(t, err)
+	writeSyntheticSession(t, writer, time.Unix(1_700_000_000, 0), 300)
+	require.NoError(t, writer.Close())
+
+	reader, err := session.OpenSessionFile(path)
+	require.NoError(t, err)
+	defer reader.Close()
+
+	replayer := session.NewStreamingReplayer(reader, &session.ReplayConfig{Speed: session.SpeedInstant})
+	var lastID string
+	replayer.AddCallback(func(event *session.ReplayEvent) error {
+		lastID = event.OriginalEvent.ID
+		return nil
+	})
+	require.NoError(t, replayer.Play())
+	replayer.Wait()
+
+	stats := replayer.GetStats()
+	assert.Equal(t, 300, stats.ReplayedEvents)
+	assert.Equal(t, 300, stats.TotalEvents)
+	assert.Equal(t, 10*time.Millisecond, stats.MaxDelay)
+	assert.Equal(t, "event_299", lastID)
+}
@@ -1,6 +1,7 @@
 package session_test
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -804,11 +805,11 @@ func TestSessionExportAndImport(t *testing.T) {
 	t.Logf("   📤 导出完成: %d 字节", len(exportedData))
 
 	// 解析导出的数据
-	var importedSession session.Session
-	err = json.Unmarshal(exportedData, &importedSession)
+	importedSession, err := session.ReadSession(bytes.NewReader(exportedData))
 	require.NoError(t, err)
 
 	// 验证导入的数据
+	assert.Equal(t, session.CurrentSchemaVersion, importedSession.SchemaVersion)
 	assert.Equal(t, sessionID, importedSession.ID)
 	assert.Equal(t, 4, len(importedSession.Events)) // Connect + Send + Receive + Close
 
@@ -0,0 +1,161 @@
+package session_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"GoSlgBenchmarkTest/internal/protocol"
+	"GoSlgBenchmarkTest/internal/session"
+)
+
+// legacyDataDir 旧版本录制文件目录
+const legacyDataDir = "../../testdata"
+
+// TestLoadLegacyUnityRecording 测试加载unity-recorder在加入格式版本之前导出的会话
+func TestLoadLegacyUnityRecording(t *testing.T) {
+	loaded, err := session.LoadSession(filepath.Join(legacyDataDir, "session_unity_v0.json"))
+	require.NoError(t, err)
+
+	assert.Equal(t, session.CurrentSchemaVersion, loaded.SchemaVersion)
+	assert.Equal(t, "unity_1727600000", loaded.ID)
+	require.NotNil(t, loaded.Stats)
+	assert.Equal(t, 18*time.Millisecond, loaded.Stats.MaxLatency)
+
+	received := 0
+	for _, event := range loaded.Events {
+		if event.Type == session.EventMessageReceive {
+			received++
+			assert.Equal(t, protocol.OpBattlePush, event.Opcode)
+			assert.Equal(t, protocol.OpBattlePush, event.Metadata["opcode"], "元数据中的opcode恢复为uint16")
+		}
+	}
+	assert.Equal(t, 3, received)
+}
+
+// TestLoadLegacyProxyRecording 测试迁移recording-proxy旧录制中的方向和事件类型
+func TestLoadLegacyProxyRecording(t *testing.T) {
+	loaded, err := session.LoadSession(filepath.Join(legacyDataDir, "session_proxy_v0.json"))
+	require.NoError(t, err)
+
+	require.Len(t, loaded.Frames, 2)
+	assert.Equal(t, "send", loaded.Frames[0].Direction)
+	assert.Equal(t, protocol.OpLoginReq, loaded.Frames[0].Opcode)
+	assert.Equal(t, "receive", loaded.Frames[1].Direction)
+	assert.Equal(t, protocol.OpBattlePush, loaded.Frames[1].Opcode)
+
+	// 旧代理把下行消息记成了MESSAGE_SEND
+	sends, receives := 0, 0
+	for _, event := range loaded.Events {
+		switch event.Type {
+		case session.EventMessageSend:
+			sends++
+			assert.Equal(t, "send", event.Metadata["direction"])
+		case session.EventMessageReceive:
+			receives++
+			assert.Equal(t, "receive", event.Metadata["direction"])
+		}
+	}
+	assert.Equal(t, 2, sends)
+	assert.Equal(t, 2, receives)
+
+	// 迁移后的会话可以重新导出并原样读回
+	data, err := json.Marshal(loaded)
+	require.NoError(t, err)
+	reloaded, err := session.ReadSession(bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, loaded.Events[len(loaded.Events)-1].ID, reloaded.Events[len(reloaded.Events)-1].ID)
+	assert.Equal(t, loaded.Frames[1].Body, reloaded.Frames[1].Body)
+}
+
+// TestLoadSessionRoundTrip 测试JSON导出和分块会话文件都能通过同一入口加载
+func TestLoadSessionRoundTrip(t *testing.T) {
+	recorder := session.NewSessionRecorder("loader_round_trip")
+	start := time.Now()
+	for i := 0; i < 20; i++ {
+		frame := battlePushFrame(t, uint64(i+1), start)
+		recorder.RecordMessage("receive", frame.RawData, frame.Opcode, frame.Body, frame.SequenceNum)
+	}
+	recorder.RecordClose(session.CloseNormal, "done")
+
+	dir := t.TempDir()
+	jsonData, err := recorder.ExportJSON()
+	require.NoError(t, err)
+	jsonPath := filepath.Join(dir, "session.json")
+	require.NoError(t, os.WriteFile(jsonPath, jsonData, 0644))
+
+	filePath := filepath.Join(dir, "session.slgs")
+	require.NoError(t, recorder.ExportFile(filePath, nil))
+
+	for _, path := range []string{jsonPath, filePath} {
+		loaded, err := session.LoadSession(path)
+		require.NoError(t, err, path)
+		assert.Equal(t, session.CurrentSchemaVersion, loaded.SchemaVersion)
+		assert.Equal(t, "loader_round_trip", loaded.ID)
+		require.Len(t, loaded.Frames, 20)
+		assert.Equal(t, uint64(20), loaded.Frames[19].SequenceNum)
+		assert.Equal(t, uint64(20), loaded.Events[len(loaded.Events)-2].Metadata["sequence_num"])
+	}
+}
+
+// TestLoadSessionRejectsCorruptData 测试损坏、不完整和版本过新的数据被拒绝
+func TestLoadSessionRejectsCorruptData(t *testing.T) {
+	recorder := session.NewSessionRecorder("corrupt")
+	frame := battlePushFrame(t, 1, time.Now())
+	recorder.RecordMessage("receive", frame.RawData, frame.Opcode, frame.Body, frame.SequenceNum)
+	valid, err := recorder.ExportJSON()
+	require.NoError(t, err)
+
+	mutate := func(edit func(doc map[string]interface{})) []byte {
+		var doc map[string]interface{}
+		require.NoError(t, json.Unmarshal(valid, &doc))
+		edit(doc)
+		data, err := json.Marshal(doc)
+		require.NoError(t, err)
+		return data
+	}
+
+	corrupt := map[string][]byte{
+		"empty":         nil,
+		"truncated":     valid[:len(valid)/2],
+		"not an object": []byte(`[1, 2, 3]`),
+		"missing id":    mutate(func(doc map[string]interface{}) { delete(doc, "id") }),
+		"bad version":   mutate(func(doc map[string]interface{}) { doc["schema_version"] = "one" }),
+		"wrong type":    mutate(func(doc map[string]interface{}) { doc["events"] = "none" }),
+		"null event":    mutate(func(doc map[string]interface{}) { doc["events"] = []interface{}{nil} }),
+		"bad direction": mutate(func(doc map[string]interface{}) {
+			doc["frames"].([]interface{})[0].(map[string]interface{})["direction"] = "sideways"
+		}),
+		"frame mismatch": mutate(func(doc map[string]interface{}) {
+			doc["frames"].([]interface{})[0].(map[string]interface{})["opcode"] = 9999
+		}),
+	}
+	for name, data := range corrupt {
+		t.Run(name, func(t *testing.T) {
+			_, err := session.ReadSession(bytes.NewReader(data))
+			assert.ErrorIs(t, err, session.ErrSessionCorrupt)
+		})
+	}
+
+	newer := mutate(func(doc map[string]interface{}) { doc["schema_version"] = session.CurrentSchemaVersion + 1 })
+	_, err = session.ReadSession(bytes.NewReader(newer))
+	assert.ErrorIs(t, err, session.ErrUnsupportedSchema)
+
+	// 未正常关闭的分块会话文件不能作为完整会话加载
+	path := filepath.Join(t.TempDir(), "partial.slgs")
+	writer, err := session.CreateSessionFile(path, "partial", time.Now(), nil)
+	require.NoError(t, err)
+	writeSyntheticSession(t, writer, time.Unix(1_700_000_000, 0), 10)
+	require.NoError(t, writer.Flush())
+	_, err = session.LoadSession(path)
+	assert.ErrorIs(t, err, session.ErrSessionCorrupt)
+	assert.True(t, strings.Contains(err.Error(), "partial"))
+	require.NoError(t, writer.Close())
+}
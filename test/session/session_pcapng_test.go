@@ -0,0 +1,306 @@
+package session_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"net/netip"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+
+	"GoSlgBenchmarkTest/internal/protocol"
+	"GoSlgBenchmarkTest/internal/session"
+	gamev1 "GoSlgBenchmarkTest/proto/game/v1"
+)
+
+// pcapBlock 解析出的pcapng块
+type pcapBlock struct {
+	blockType uint32
+	body      []byte
+}
+
+// pcapPacket 解析出的报文
+type pcapPacket struct {
+	timestamp  time.Time
+	outbound   bool
+	comment    string
+	srcPort    uint16
+	tcpFlags   byte
+	seq        uint32
+	payload    []byte
+	checksumOK bool
+}
+
+// readPcapBlocks 按块类型和长度切分pcapng文件
+func readPcapBlocks(t *testing.T, data []byte) []pcapBlock {
+	var blocks []pcapBlock
+	for len(data) > 0 {
+		require.GreaterOrEqual(t, len(data), 12)
+		blockType := binary.LittleEndian.Uint32(data[0:4])
+		total := int(binary.LittleEndian.Uint32(data[4:8]))
+		require.Zero(t, total%4, "块长度按4字节对齐")
+		require.LessOrEqual(t, total, len(data))
+		require.Equal(t, uint32(total), binary.LittleEndian.Uint32(data[total-4:total]), "首尾长度一致")
+		blocks = append(blocks, pcapBlock{blockType: blockType, body: data[8 : total-4]})
+		data = data[total:]
+	}
+	return blocks
+}
+
+// readPcapOptions 解析选项列表
+func readPcapOptions(data []byte) map[uint16][]byte {
+	options := make(map[uint16][]byte)
+	for len(data) >= 4 {
+		code := binary.LittleEndian.Uint16(data[0:2])
+		length := int(binary.LittleEndian.Uint16(data[2:4]))
+		if code == 0 {
+			break
+		}
+		options[code] = data[4 : 4+length]
+		data = data[4+length+(4-length%4)%4:]
+	}
+	return options
+}
+
+// checksum16 计算RFC 1071校验和，结果为0表示校验通过
+func checksum16(chunks ...[]byte) uint16 {
+	var sum uint32
+	for _, chunk := range chunks {
+		for i := 0; i+1 < len(chunk); i += 2 {
+			sum += uint32(binary.BigEndian.Uint16(chunk[i:]))
+		}
+		if len(chunk)%2 == 1 {
+			sum += uint32(chunk[len(chunk)-1]) << 8
+		}
+	}
+	for sum>>16 != 0 {
+		sum = (sum & 0xFFFF) + (sum >> 16)
+	}
+	return ^uint16(sum)
+}
+
+// parsePcapPacket 解析增强报文块中的Ethernet/IPv4/TCP报文
+func parsePcapPacket(t *testing.T, body []byte) pcapPacket {
+	timestamp := uint64(binary.LittleEndian.Uint32(body[4:8]))<<32 | uint64(binary.LittleEndian.Uint32(body[8:12]))
+	captured := int(binary.LittleEndian.Uint32(body[12:16]))
+	packet := body[20 : 20+captured]
+	options := readPcapOptions(body[20+captured+(4-captured%4)%4:])
+
+	require.Equal(t, uint16(0x0800), binary.BigEndian.Uint16(packet[12:14]))
+	ip := packet[14:]
+	require.Equal(t, byte(0x45), ip[0])
+	require.Equal(t, len(ip), int(binary.BigEndian.Uint16(ip[2:4])))
+	tcp := ip[20:]
+	pseudo := append(append([]byte{}, ip[12:20]...), 0, 6, byte(len(tcp)>>8), byte(len(tcp)))
+
+	return pcapPacket{
+		timestamp:  time.Unix(0, int64(timestamp)),
+		outbound:   binary.LittleEndian.Uint32(options[2]) == 2,
+		comment:    string(options[1]),
+		srcPort:    binary.BigEndian.Uint16(tcp[0:2]),
+		tcpFlags:   tcp[13],
+		seq:        binary.BigEndian.Uint32(tcp[4:8]),
+		payload:    tcp[int(tcp[12]>>4)*4:],
+		checksumOK: checksum16(ip[:20]) == 0 && checksum16(pseudo, tcp) == 0,
+	}
+}
+
+// unwrapWebSocket 拆出WebSocket二进制帧的载荷，客户端帧去掉掩码
+func unwrapWebSocket(t *testing.T, data []byte) []byte {
+	require.Equal(t, byte(0x82), data[0], "FIN + 二进制帧")
+	length := int(data[1] & 0x7F)
+	offset := 2
+	switch length {
+	case 126:
+		length = int(binary.BigEndian.Uint16(data[2:4]))
+		offset = 4
+	case 127:
+		length = int(binary.BigEndian.Uint64(data[2:10]))
+		offset = 10
+	}
+	if data[1]&0x80 == 0 {
+		return data[offset : offset+length]
+	}
+	mask := data[offset : offset+4]
+	payload := make([]byte, length)
+	for i := range payload {
+		payload[i] = data[offset+4+i] ^ mask[i%4]
+	}
+	return payload
+}
+
+// buildPcapSession 构造包含登录、操作和一条超过MSS的大推送的会话
+func buildPcapSession(t *testing.T) *session.Session {
+	recorded := buildDiffSession(t, diffScenario{
+		id: "pcap_session", actions: []uint64{1, 2}, respDelay: 15 * time.Millisecond,
+		pushOrder: []uint64{1}, firstPushHP: 100, loginSession: "s",
+	})
+
+	units := make([]*gamev1.BattleUnit, 0, 200)
+	for i := 0; i < 200; i++ {
+		units = append(units, &gamev1.BattleUnit{UnitId: "unit_with_a_long_identifier", Hp: int32(i)})
+	}
+	body, err := proto.Marshal(&gamev1.BattlePush{Seq: 2, BattleId: "battle_1", Units: units})
+	require.NoError(t, err)
+	raw := protocol.EncodeFrame(protocol.OpBattlePush, body)
+	require.Greater(t, len(raw), 1460)
+	recorded.Frames = append(recorded.Frames, &session.MessageFrame{
+		RawData:     raw,
+		Opcode:      protocol.OpBattlePush,
+		Body:        body,
+		Timestamp:   recorded.EndTime.Add(time.Second),
+		Direction:   "receive",
+		SequenceNum: 2,
+	})
+	return recorded
+}
+
+// TestPcapngWebSocketExport 测试WebSocket封装的pcapng结构、时间戳、方向和载荷
+func TestPcapngWebSocketExport(t *testing.T) {
+	recorded := buildPcapSession(t)
+
+	var buf bytes.Buffer
+	require.NoError(t, session.WritePcapng(&buf, recorded, nil))
+	blocks := readPcapBlocks(t, buf.Bytes())
+	require.Greater(t, len(blocks), 2)
+
+	// 文件头：字节序标记和会话元数据注释
+	require.Equal(t, uint32(0x0A0D0D0A), blocks[0].blockType)
+	assert.Equal(t, uint32(0x1A2B3C4D), binary.LittleEndian.Uint32(blocks[0].body[0:4]))
+	var metadata map[string]interface{}
+	require.NoError(t, json.Unmarshal(readPcapOptions(blocks[0].body[16:])[1], &metadata))
+	assert.Equal(t, "pcap_session", metadata["session_id"])
+	assert.EqualValues(t, len(recorded.Frames), metadata["frames"])
+
+	// 接口：以太网链路，纳秒时间戳
+	require.Equal(t, uint32(1), blocks[1].blockType)
+	assert.Equal(t, uint16(1), binary.LittleEndian.Uint16(blocks[1].body[0:2]))
+	assert.Equal(t, []byte{9}, readPcapOptions(blocks[1].body[8:])[9])
+
+	packets := make([]pcapPacket, 0, len(blocks)-2)
+	for _, block := range blocks[2:] {
+		require.Equal(t, uint32(6), block.blockType)
+		packets = append(packets, parsePcapPacket(t, block.body))
+	}
+
+	// 三次握手 + HTTP升级
+	require.GreaterOrEqual(t, len(packets), 5)
+	assert.Equal(t, byte(0x02), packets[0].tcpFlags, "SYN")
+	assert.Equal(t, byte(0x12), packets[1].tcpFlags, "SYN/ACK")
+	assert.Contains(t, string(packets[3].payload), "Upgrade: websocket")
+	assert.Contains(t, string(packets[4].payload), "101 Switching Protocols")
+	assert.True(t, packets[4].timestamp.Before(recorded.Frames[0].Timestamp), "合成握手早于第一帧")
+
+	// 按方向重组TCP流，逐帧还原协议帧
+	streams := map[bool][]byte{}
+	nextSeq := map[bool]uint32{}
+	var commented []pcapPacket
+	for i, packet := range packets {
+		assert.True(t, packet.checksumOK, "报文%d校验和", i)
+		assert.Equal(t, packet.outbound, packet.srcPort == 50000, "客户端发出的报文标记为出站")
+		if i > 0 {
+			assert.False(t, packet.timestamp.Before(packets[i-1].timestamp), "时间戳单调")
+		}
+		if len(packet.payload) > 0 && i >= 5 {
+			if expected, ok := nextSeq[packet.outbound]; ok {
+				assert.Equal(t, expected, packet.seq, "序号连续")
+			}
+			streams[packet.outbound] = append(streams[packet.outbound], packet.payload...)
+			nextSeq[packet.outbound] = packet.seq + uint32(len(packet.payload))
+		}
+		if packet.comment != "" && i >= 5 {
+			commented = append(commented, packet)
+		}
+	}
+
+	require.Len(t, commented, len(recorded.Frames))
+	for i, frame := range recorded.Frames {
+		assert.Equal(t, frame.Timestamp.UnixNano(), commented[i].timestamp.UnixNano())
+		assert.Equal(t, frame.Direction == "send", commented[i].outbound)
+		assert.Contains(t, commented[i].comment, protocol.OpcodeToString(frame.Opcode))
+
+		outbound := frame.Direction == "send"
+		payload := unwrapWebSocket(t, streams[outbound])
+		assert.Equal(t, frame.RawData, payload, "第%d帧载荷", i)
+		header := 2
+		if len(payload) >= 126 {
+			header = 4
+		}
+		if outbound {
+			header += 4
+		}
+		streams[outbound] = streams[outbound][header+len(payload):]
+	}
+	assert.Empty(t, streams[true])
+	assert.Empty(t, streams[false])
+
+	// 结束时双方发送FIN
+	assert.Equal(t, byte(0x11), packets[len(packets)-3].tcpFlags&0x11)
+	assert.Equal(t, byte(0x11), packets[len(packets)-2].tcpFlags&0x11)
+}
+
+// TestPcapngTCPExport 测试TCP封装直接承载协议帧，服务端视角的录制反转方向
+func TestPcapngTCPExport(t *testing.T) {
+	recorded := buildPcapSession(t)
+
+	options := session.DefaultPcapOptions()
+	options.Encapsulation = session.PcapTCP
+	options.ServerPerspective = true
+
+	var buf bytes.Buffer
+	require.NoError(t, session.WritePcapng(&buf, recorded, options))
+
+	streams := map[bool][]byte{}
+	for _, block := range readPcapBlocks(t, buf.Bytes())[2:] {
+		packet := parsePcapPacket(t, block.body)
+		if len(packet.payload) > 0 {
+			require.Equal(t, packet.outbound, packet.srcPort != uint16(session.PcapTCPPort))
+			streams[packet.outbound] = append(streams[packet.outbound], packet.payload...)
+		}
+	}
+
+	// 服务端录制中receive是客户端发出的帧
+	var clientFrames, serverFrames []byte
+	for _, frame := range recorded.Frames {
+		if frame.Direction == "receive" {
+			clientFrames = append(clientFrames, frame.RawData...)
+		} else {
+			serverFrames = append(serverFrames, frame.RawData...)
+		}
+	}
+	assert.Equal(t, clientFrames, streams[true])
+	assert.Equal(t, serverFrames, streams[false])
+
+	for stream := streams[false]; len(stream) > 0; {
+		require.GreaterOrEqual(t, len(stream), protocol.FrameHeaderSize)
+		size := protocol.FrameHeaderSize + int(binary.BigEndian.Uint32(stream[2:6]))
+		opcode, _, err := protocol.DecodeFrame(stream[:size])
+		require.NoError(t, err, "TCP流可以按帧头切分")
+		assert.NotZero(t, opcode)
+		stream = stream[size:]
+	}
+
+	options.ClientAddr = netip.MustParseAddrPort("[::1]:50000")
+	assert.Error(t, session.WritePcapng(&bytes.Buffer{}, recorded, options), "仅支持IPv4")
+}
+
+// TestRecorderExportPcapng 测试录制器直接导出pcapng文件
+func TestRecorderExportPcapng(t *testing.T) {
+	recorder := session.NewSessionRecorder("pcap_recorder")
+	body, err := proto.Marshal(&gamev1.Heartbeat{ClientUnixMs: 1})
+	require.NoError(t, err)
+	recorder.RecordMessage("send", protocol.EncodeFrame(protocol.OpHeartbeat, body), protocol.OpHeartbeat, body, 0)
+
+	path := t.TempDir() + "/session.pcapng"
+	require.NoError(t, recorder.ExportPcapng(path, nil))
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	blocks := readPcapBlocks(t, data)
+	assert.Equal(t, uint32(0x0A0D0D0A), blocks[0].blockType)
+	assert.Len(t, blocks, 2+3+2+1+3, "文件头、接口、握手、升级、一帧、挥手")
+}
@@ -0,0 +1,350 @@
+package world_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+
+	"GoSlgBenchmarkTest/generated/slg/v1_1_0/building"
+	"GoSlgBenchmarkTest/generated/slg/v1_1_0/combat"
+	"GoSlgBenchmarkTest/internal/protocol"
+	"GoSlgBenchmarkTest/internal/testserver"
+	"GoSlgBenchmarkTest/internal/testutil"
+	"GoSlgBenchmarkTest/internal/world"
+	"GoSlgBenchmarkTest/internal/wsclient"
+	gamev1 "GoSlgBenchmarkTest/proto/game/v1"
+)
+
+// pushRecord 记录的一次推送
+type pushRecord struct {
+	playerIDs []string
+	opcode    uint16
+	message   proto.Message
+}
+
+// pushCollector 收集世界模拟产生的推送
+type pushCollector struct {
+	mu      sync.Mutex
+	records []pushRecord
+}
+
+func (c *pushCollector) emit(playerIDs []string, opcode uint16, message proto.Message) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.records = append(c.records, pushRecord{playerIDs: playerIDs, opcode: opcode, message: message})
+}
+
+func (c *pushCollector) byOpcode(opcode uint16) []pushRecord {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var result []pushRecord
+	for _, record := range c.records {
+		if record.opcode == opcode {
+			result = append(result, record)
+		}
+	}
+	return result
+}
+
+// runSiege 运行一场攻城并返回双方城市与战报
+func runSiege(t *testing.T) (*pushCollector, *world.City, *world.City) {
+	collector := &pushCollector{}
+	w := world.New(world.DefaultConfig(), collector.emit)
+
+	attacker := w.AddPlayer("attacker")
+	defender := w.AddPlayer("defender")
+	require.NotNil(t, attacker)
+	require.NotNil(t, defender)
+
+	march, err := w.IssueAttack("attacker", defender.ID, 800)
+	require.NoError(t, err)
+	assert.Equal(t, defender.ID, march.TargetCityID)
+	assert.Greater(t, march.ArriveAt, march.DepartAt, "行军应有正的耗时")
+
+	w.Advance(24 * time.Hour)
+
+	stats := w.GetStats()
+	assert.Equal(t, uint64(1), stats.FinishedBattles)
+	assert.Equal(t, 0, stats.ActiveBattles)
+	assert.Equal(t, 0, stats.ActiveMarches, "幸存部队应已回城")
+
+	finalAttacker, _ := w.GetCity("attacker")
+	finalDefender, _ := w.GetCity("defender")
+	return collector, finalAttacker, finalDefender
+}
+
+// TestWorldSiegeDeterministic 测试相同种子下攻城结果可复现
+func TestWorldSiegeDeterministic(t *testing.T) {
+	first, attackerA, defenderA := runSiege(t)
+	second, attackerB, defenderB := runSiege(t)
+
+	assert.Equal(t, attackerA, attackerB, "相同种子应得到相同的进攻方城市")
+	assert.Equal(t, defenderA, defenderB, "相同种子应得到相同的防守方城市")
+
+	endsA := first.byOpcode(protocol.OpSLGBattleEnd)
+	endsB := second.byOpcode(protocol.OpSLGBattleEnd)
+	require.Len(t, endsA, 2, "双方各收到一份战报")
+	require.Len(t, endsB, 2)
+
+	for i := range endsA {
+		reportA := endsA[i].message.(*combat.BattleResponse)
+		reportB := endsB[i].message.(*combat.BattleResponse)
+		assert.True(t, proto.Equal(reportA, reportB), "战报应完全一致")
+	}
+
+	// 进攻方800兵对守城1000兵（含城防加成），进攻方应落败
+	attackerReport := endsA[0].message.(*combat.BattleResponse)
+	defenderReport := endsA[1].message.(*combat.BattleResponse)
+	assert.Equal(t, []string{"attacker"}, endsA[0].playerIDs)
+	assert.Equal(t, combat.BattleResult_BATTLE_RESULT_DEFEAT, attackerReport.Result)
+	assert.Equal(t, combat.BattleResult_BATTLE_RESULT_VICTORY, defenderReport.Result)
+	assert.Less(t, defenderA.Troops, int32(1000), "守军应有伤亡")
+	assert.Equal(t, int32(200), attackerA.Troops, "全灭的行军不会带回兵力")
+
+	t.Logf("⚔️ 攻城结束: 进攻方剩余%d, 防守方剩余%d, 战斗耗时%dms",
+		attackerA.Troops, defenderA.Troops, attackerReport.DurationMs)
+}
+
+// TestWorldBattlePushesAreCausal 测试战斗推送只发送给参战玩家且序列号递增
+func TestWorldBattlePushesAreCausal(t *testing.T) {
+	collector := &pushCollector{}
+	w := world.New(world.DefaultConfig(), collector.emit)
+
+	require.NotNil(t, w.AddPlayer("attacker"))
+	defender := w.AddPlayer("defender")
+	require.NotNil(t, w.AddPlayer("bystander"))
+
+	_, err := w.IssueAttack("attacker", defender.ID, 0)
+	require.NoError(t, err)
+	w.Advance(24 * time.Hour)
+
+	pushes := collector.byOpcode(protocol.OpBattlePush)
+	require.NotEmpty(t, pushes)
+
+	var lastSeq uint64
+	battlePushes := 0
+	for _, record := range pushes {
+		push := record.message.(*gamev1.BattlePush)
+		assert.Greater(t, push.Seq, lastSeq, "推送序列号应单调递增")
+		lastSeq = push.Seq
+		assert.Len(t, push.StateHash, 8)
+		assert.NotContains(t, record.playerIDs, "bystander", "旁观玩家不应收到战斗推送")
+
+		if push.BattleId == "battle_1" {
+			battlePushes++
+			assert.ElementsMatch(t, []string{"attacker", "defender"}, record.playerIDs)
+			assert.Len(t, push.Units, 2)
+		}
+	}
+	assert.Greater(t, battlePushes, 1, "战斗应按回合推送多次")
+
+	for _, record := range collector.byOpcode(protocol.OpSLGCityUpdate) {
+		info := record.message.(*building.CityInfo)
+		assert.Equal(t, []string{info.PlayerId}, record.playerIDs, "城市更新只推送给城主")
+	}
+}
+
+// TestWorldMarchEncounter 测试两支行军在途中相遇并发生战斗
+func TestWorldMarchEncounter(t *testing.T) {
+	collector := &pushCollector{}
+	w := world.New(world.DefaultConfig(), collector.emit)
+
+	cityA := w.AddPlayer("alpha")
+	cityB := w.AddPlayer("beta")
+	require.NotNil(t, cityA)
+	require.NotNil(t, cityB)
+
+	// 双方向对方城市出兵，必然在途中相遇
+	_, err := w.IssueMarch("alpha", cityB.Position, 300)
+	require.NoError(t, err)
+	_, err = w.IssueMarch("beta", cityA.Position, 300)
+	require.NoError(t, err)
+
+	w.Advance(24 * time.Hour)
+
+	ends := collector.byOpcode(protocol.OpSLGBattleEnd)
+	require.NotEmpty(t, ends)
+	first := ends[0].message.(*combat.BattleResponse)
+	assert.Equal(t, "battle_1", first.BattleId)
+
+	// 遭遇战双方都是行军部队，战报单位应为行军ID
+	for _, unit := range first.BattleUnits {
+		assert.Contains(t, unit.UnitId, "march_")
+	}
+	// 兵力相同的遭遇战按比例同步损耗，打满回合数后超时
+	assert.Equal(t, combat.BattleResult_BATTLE_RESULT_TIMEOUT, first.Result)
+	assert.Equal(t, first.BattleUnits[0].Hp, first.BattleUnits[1].Hp)
+}
+
+// TestWorldMarchSnapsToCityCenter 测试目标落在城市地块内时按城市中心计算到达时间
+func TestWorldMarchSnapsToCityCenter(t *testing.T) {
+	w := world.New(world.DefaultConfig(), nil)
+	require.NotNil(t, w.AddPlayer("attacker"))
+	defender := w.AddPlayer("defender")
+	require.NotNil(t, defender)
+
+	centered, err := w.IssueMarch("attacker", defender.Position, 100)
+	require.NoError(t, err)
+	offset := world.Point{X: defender.Position.X + 0.45, Y: defender.Position.Y - 0.45}
+	snapped, err := w.IssueMarch("attacker", offset, 100)
+	require.NoError(t, err)
+
+	assert.Equal(t, defender.ID, snapped.TargetCityID)
+	assert.Equal(t, defender.Position, snapped.To)
+	assert.Equal(t, centered.ArriveAt-centered.DepartAt, snapped.ArriveAt-snapped.DepartAt)
+}
+
+// TestWorldSlowEmitterDoesNotBlock 测试推送在释放世界锁之后发送，阻塞的发送方不影响其他调用
+func TestWorldSlowEmitterDoesNotBlock(t *testing.T) {
+	collector := &pushCollector{}
+	release := make(chan struct{})
+	blocked := make(chan struct{})
+	var once sync.Once
+	w := world.New(world.DefaultConfig(), func(playerIDs []string, opcode uint16, message proto.Message) {
+		once.Do(func() {
+			close(blocked)
+			<-release
+		})
+		collector.emit(playerIDs, opcode, message)
+	})
+
+	go w.AddPlayer("slow")
+	<-blocked
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		w.AddPlayer("fast")
+		_, _ = w.IssueMarch("fast", world.Point{X: 1.5, Y: 1.5}, 10)
+		w.Advance(time.Minute)
+		w.GetStats()
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("发送方阻塞时世界调用不应被阻塞")
+	}
+
+	close(release)
+	assert.Eventually(t, func() bool {
+		return len(collector.byOpcode(protocol.OpSLGCityUpdate)) >= 3
+	}, time.Second, 10*time.Millisecond, "阻塞期间产生的推送在发送方恢复后送出")
+
+	// 推送仍按序列号顺序送出
+	var lastSeq uint64
+	for _, record := range collector.byOpcode(protocol.OpBattlePush) {
+		push := record.message.(*gamev1.BattlePush)
+		assert.Greater(t, push.Seq, lastSeq)
+		lastSeq = push.Seq
+	}
+}
+
+// TestWorldSimulationOverWebSocket 测试启用世界模拟的服务器推送真实的世界状态
+func TestWorldSimulationOverWebSocket(t *testing.T) {
+	server := testutil.NewTestServerWithConfig(t, func(config *testserver.ServerConfig) {
+		config.EnableBattlePush = true
+		config.PushInterval = 20 * time.Millisecond
+		config.EnableWorldSimulation = true
+
+		worldConfig := world.DefaultConfig()
+		worldConfig.Width = 8
+		worldConfig.Height = 8
+		worldConfig.TimeScale = 600 // 1秒真实时间 = 10分钟游戏时间
+		worldConfig.MarchSpeed = 0.5
+		config.WorldConfig = worldConfig
+	})
+	server.Start()
+	defer server.Stop()
+
+	type pushes struct {
+		mu     sync.Mutex
+		cities []*building.CityInfo
+		ends   []*combat.BattleResponse
+		battle int
+	}
+
+	connect := func(deviceID string) (*wsclient.Client, *pushes) {
+		received := &pushes{}
+		clientConfig := wsclient.DefaultClientConfig(server.GetWebSocketURL(), "world-token")
+		clientConfig.DeviceID = deviceID // 玩家ID由设备ID派生，需保证不同
+		client := wsclient.New(clientConfig)
+		client.SetPushHandler(func(opcode uint16, message proto.Message) {
+			received.mu.Lock()
+			defer received.mu.Unlock()
+			switch opcode {
+			case protocol.OpSLGCityUpdate:
+				received.cities = append(received.cities, message.(*building.CityInfo))
+			case protocol.OpSLGBattleEnd:
+				received.ends = append(received.ends, message.(*combat.BattleResponse))
+			case protocol.OpBattlePush:
+				received.battle++
+			}
+		})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		require.NoError(t, client.Connect(ctx))
+		return client, received
+	}
+
+	attacker, attackerPushes := connect("world-attacker")
+	defer attacker.Close()
+	defender, defenderPushes := connect("world-defender")
+	defer defender.Close()
+
+	// 等待防守方收到自己的城市信息
+	var targetCityID string
+	require.Eventually(t, func() bool {
+		defenderPushes.mu.Lock()
+		defer defenderPushes.mu.Unlock()
+		if len(defenderPushes.cities) == 0 {
+			return false
+		}
+		targetCityID = defenderPushes.cities[0].CityId
+		return true
+	}, 3*time.Second, 20*time.Millisecond)
+
+	err := attacker.SendAction(&gamev1.PlayerAction{
+		ActionSeq:       1,
+		ActionType:      gamev1.ActionType_ACTION_TYPE_ATTACK,
+		ClientTimestamp: time.Now().UnixMilli(),
+		ActionData: &gamev1.ActionData{
+			Data: &gamev1.ActionData_Attack{
+				Attack: &gamev1.AttackAction{TargetUnitId: targetCityID},
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	// 双方都应收到战报
+	require.Eventually(t, func() bool {
+		attackerPushes.mu.Lock()
+		defer attackerPushes.mu.Unlock()
+		defenderPushes.mu.Lock()
+		defer defenderPushes.mu.Unlock()
+		return len(attackerPushes.ends) > 0 && len(defenderPushes.ends) > 0
+	}, 15*time.Second, 50*time.Millisecond, "攻城战应在加速时间内结束")
+
+	attackerPushes.mu.Lock()
+	defer attackerPushes.mu.Unlock()
+	defenderPushes.mu.Lock()
+	defer defenderPushes.mu.Unlock()
+
+	assert.Equal(t, attackerPushes.ends[0].BattleId, defenderPushes.ends[0].BattleId)
+	assert.Greater(t, attackerPushes.battle, 0, "进攻方应收到行军和战斗推送")
+
+	stats := server.GetStats()
+	worldStats, ok := stats["world"].(world.Stats)
+	require.True(t, ok, "服务器统计应包含世界模拟状态")
+	assert.Equal(t, 2, worldStats.Cities)
+	assert.GreaterOrEqual(t, worldStats.FinishedBattles, uint64(1))
+
+	t.Logf("🌍 世界模拟: 游戏时间=%v, 推送=%d, 战斗=%d",
+		worldStats.GameTime, worldStats.PushesEmitted, worldStats.FinishedBattles)
+}
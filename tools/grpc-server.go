@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"log"
 	"net"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
@@ -21,7 +22,7 @@ import (
 )
 
 // createOptimizedGRPCServer 创建优化配置的gRPC服务器
-func createOptimizedGRPCServer() *grpc.Server {
+func createOptimizedGRPCServer(gameServer *grpcserver.GameServer) *grpc.Server {
 	// KeepAlive参数配置
 	keepaliveParams := keepalive.ServerParameters{
 		MaxConnectionIdle:     30 * time.Second,  // 空闲连接最大生存时间
@@ -38,19 +39,22 @@ func createOptimizedGRPCServer() *grpc.Server {
 	}
 
 	// 创建优化配置的gRPC服务器
-	server := grpc.NewServer(
+	options := []grpc.ServerOption{
 		// KeepAlive配置
 		grpc.KeepaliveParams(keepaliveParams),
 		grpc.KeepaliveEnforcementPolicy(keepalivePolicy),
 
 		// 连接限制
-		grpc.MaxConcurrentStreams(10000), // 最大并发流数
-		grpc.MaxRecvMsgSize(4*1024*1024), // 最大接收消息大小 (4MB)
-		grpc.MaxSendMsgSize(4*1024*1024), // 最大发送消息大小 (4MB)
+		grpc.MaxConcurrentStreams(10000),     // 最大并发流数
+		grpc.MaxRecvMsgSize(4 * 1024 * 1024), // 最大接收消息大小 (4MB)
+		grpc.MaxSendMsgSize(4 * 1024 * 1024), // 最大发送消息大小 (4MB)
 
 		// 连接超时设置
-		grpc.ConnectionTimeout(10*time.Second),
-	)
+		grpc.ConnectionTimeout(10 * time.Second),
+	}
+	// 指标拦截器
+	options = append(options, gameServer.ServerOptions()...)
+	server := grpc.NewServer(options...)
 
 	fmt.Println("🔧 gRPC服务器优化配置:")
 	fmt.Println("  • KeepAlive: 30s空闲, 300s最大生存时间")
@@ -58,6 +62,7 @@ func createOptimizedGRPCServer() *grpc.Server {
 	fmt.Println("  • 消息大小: 4MB")
 	fmt.Println("  • 压缩: GZIP启用")
 	fmt.Println("  • 连接超时: 10s")
+	fmt.Println("  • 指标: 请求数/延迟直方图拦截器")
 
 	return server
 }
@@ -91,6 +96,7 @@ func main() {
 			fmt.Println("  SERVER_TYPE    - 服务器类型 (grpc|websocket)")
 			fmt.Println("  GRPC_PORT      - gRPC服务器端口 (默认19001)")
 			fmt.Println("  WS_PORT        - WebSocket服务器端口 (默认18090)")
+			fmt.Println("  METRICS_PORT   - gRPC指标端口 (默认19002)")
 			fmt.Println("  CI             - CI环境标识 (true时启用额外日志)")
 			os.Exit(0)
 		}
@@ -123,21 +129,37 @@ func startGRPCServer() {
 	}
 	defer lis.Close()
 
-	// 创建优化配置的gRPC服务器
-	s := createOptimizedGRPCServer()
-
 	// 创建游戏服务器实例
 	gameServer := grpcserver.NewGameServer()
 
+	// 创建优化配置的gRPC服务器
+	s := createOptimizedGRPCServer(gameServer)
+
 	// 注册服务
 	gamev1.RegisterGameServiceServer(s, gameServer)
 
 	// 启用反射（可选，用于调试）
 	reflection.Register(s)
 
+	// Prometheus指标端点，默认端口19002
+	metricsPort := "19002"
+	if envPort := os.Getenv("METRICS_PORT"); envPort != "" {
+		metricsPort = envPort
+	}
+	metricsMux := http.NewServeMux()
+	metricsMux.Handle("/metrics", gameServer.MetricsHandler())
+	metricsServer := &http.Server{Addr: ":" + metricsPort, Handler: metricsMux}
+	go func() {
+		if err := metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Printf("❌ 指标服务器错误: %v", err)
+		}
+	}()
+	defer metricsServer.Close()
+
 	fmt.Printf("✅ gRPC服务器启动成功!\n")
 	fmt.Printf("📍 监听地址: 0.0.0.0:%s\n", port)
 	fmt.Printf("🔧 服务端点: localhost:%s\n", port)
+	fmt.Printf("📊 指标端点: http://localhost:%s/metrics\n", metricsPort)
 	fmt.Println("\n🎯 支持的gRPC方法:")
 	fmt.Println("  • Login - 用户登录")
 	fmt.Println("  • Logout - 用户登出")
@@ -208,6 +230,7 @@ func startWebSocketServer() {
 	if os.Getenv("CI") == "true" {
 		fmt.Printf("🔧 CI环境变量: WS_PORT=%s\n", port)
 		fmt.Printf("🔧 健康检查端点: http://localhost:%s/health\n", port)
+		fmt.Printf("🔧 指标端点: http://localhost:%s/metrics\n", port)
 	}
 	fmt.Println("\n🎯 WebSocket服务器特性:")
 	fmt.Println("  • 支持二进制消息传输")
@@ -0,0 +1,103 @@
+-- SLG游戏协议帧解析器（Wireshark Lua插件）
+--
+-- 帧格式见 internal/protocol/frame.go：
+--   | opcode (2字节, 大端) | body长度 (4字节, 大端) | body (protobuf) |
+--
+-- 使用方法：复制到Wireshark个人插件目录，或启动时指定
+--   wireshark -X lua_script:tools/wireshark/slg_frame.lua session.pcapng
+-- session.WritePcapng 默认生成的端口已在下方注册：
+--   WebSocket封装 ws.port 18000，TCP封装 tcp.port 18100
+
+local slg = Proto("slg", "SLG Game Frame")
+
+local HEADER_SIZE = 6
+local MAX_FRAME_SIZE = 1024 * 1024
+
+-- 与 internal/protocol/opcode.go、slg_adapter.go 保持一致
+local opcodes = {
+    [1001] = "LOGIN_REQ",
+    [1002] = "LOGIN_RESP",
+    [1003] = "LOGOUT",
+    [1004] = "KICK",
+    [1100] = "HEARTBEAT",
+    [1101] = "HEARTBEAT_RESP",
+    [2001] = "BATTLE_PUSH",
+    [2002] = "PLAYER_ACTION",
+    [2003] = "ACTION_RESP",
+    [3001] = "CHAT_MESSAGE",
+    [3002] = "CHAT_RESP",
+    [4001] = "ROOM_JOIN",
+    [4002] = "ROOM_LEAVE",
+    [4003] = "ROOM_RESP",
+    [5001] = "SLG_BATTLE_REQUEST",
+    [5002] = "SLG_BATTLE_RESPONSE",
+    [5003] = "SLG_BATTLE_UPDATE",
+    [5004] = "SLG_BATTLE_END",
+    [5101] = "SLG_CITY_UPDATE",
+    [5102] = "SLG_BUILDING_UPGRADE",
+    [5103] = "SLG_BUILDING_COMPLETE",
+    [5201] = "SLG_ACTIVITY_START",
+    [5202] = "SLG_ACTIVITY_UPDATE",
+    [5203] = "SLG_ACTIVITY_END",
+    [5301] = "SLG_PVP_REQUEST",
+    [5302] = "SLG_PVP_RESPONSE",
+    [5303] = "SLG_PVP_UPDATE",
+    [9999] = "ERROR",
+}
+
+local f_opcode = ProtoField.uint16("slg.opcode", "Opcode", base.DEC, opcodes)
+local f_length = ProtoField.uint32("slg.length", "Body Length", base.DEC)
+local f_body = ProtoField.bytes("slg.body", "Body")
+slg.fields = { f_opcode, f_length, f_body }
+
+local e_too_large = ProtoExpert.new("slg.too_large", "Frame exceeds MaxFrameSize",
+    expert.group.MALFORMED, expert.severity.ERROR)
+slg.experts = { e_too_large }
+
+-- 一个缓冲区可能包含多个帧；TCP封装时帧可能跨段，交给TCP重组
+function slg.dissector(buffer, pinfo, tree)
+    local offset = 0
+    local total = buffer:len()
+    local names = {}
+
+    while offset < total do
+        local remaining = total - offset
+        if remaining < HEADER_SIZE then
+            pinfo.desegment_offset = offset
+            pinfo.desegment_len = DESEGMENT_ONE_MORE_SEGMENT
+            return total
+        end
+
+        local length = buffer(offset + 2, 4):uint()
+        local frame_size = HEADER_SIZE + length
+        if frame_size > MAX_FRAME_SIZE then
+            local item = tree:add(slg, buffer(offset))
+            item:add_proto_expert_info(e_too_large)
+            return total
+        end
+        if remaining < frame_size then
+            pinfo.desegment_offset = offset
+            pinfo.desegment_len = frame_size - remaining
+            return total
+        end
+
+        local opcode = buffer(offset, 2):uint()
+        local name = opcodes[opcode] or "UNKNOWN"
+        local subtree = tree:add(slg, buffer(offset, frame_size), "SLG Frame, " .. name)
+        subtree:add(f_opcode, buffer(offset, 2))
+        subtree:add(f_length, buffer(offset + 2, 4))
+        if length > 0 then
+            subtree:add(f_body, buffer(offset + HEADER_SIZE, length))
+        end
+
+        names[#names + 1] = name
+        offset = offset + frame_size
+    end
+
+    pinfo.cols.protocol = "SLG"
+    pinfo.cols.info:set(table.concat(names, ", "))
+    return offset
+end
+
+DissectorTable.get("ws.port"):add(18000, slg)
+DissectorTable.get("tcp.port"):add(18100, slg)